@@ -15,7 +15,9 @@
 package main
 
 import (
+	"errors"
 	"log/slog"
+	"net/http"
 	"os"
 	"time"
 
@@ -24,6 +26,7 @@ import (
 	"github.com/joaovrmoraes/bataudit/internal/auth"
 	"github.com/joaovrmoraes/bataudit/internal/config"
 	"github.com/joaovrmoraes/bataudit/internal/db"
+	"github.com/joaovrmoraes/bataudit/internal/metrics"
 	_ "github.com/joaovrmoraes/bataudit/docs"
 	"gorm.io/gorm"
 )
@@ -58,9 +61,19 @@ func main() {
 
 	r := gin.Default()
 	r.Use(cors.Default())
+	r.Use(metrics.GinMiddleware("reader"))
 
 	registerRoutes(r, conn, authService)
 
+	// Metrics carry project IDs, so they stay off the public port.
+	metricsAddr := ":" + config.GetEnv("READER_METRICS_PORT", "9093")
+	go func() {
+		slog.Info("Reader metrics server running", "addr", metricsAddr)
+		if err := metrics.Serve(metricsAddr); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			slog.Error("Reader metrics server failed", "error", err)
+		}
+	}()
+
 	port := config.GetEnv("API_READER_PORT", "8082")
 	slog.Info("Reader server running", "port", port)
 	if err := r.Run(":" + port); err != nil {
@@ -1,19 +1,30 @@
 package main
 
 import (
+	"context"
 	"log/slog"
 	"net/http"
 	"strings"
 
 	"github.com/gin-gonic/gin"
+	"github.com/go-redis/redis/v8"
 	"github.com/joaovrmoraes/bataudit/internal/anomaly"
+	"github.com/joaovrmoraes/bataudit/internal/archive"
 	"github.com/joaovrmoraes/bataudit/internal/audit"
 	"github.com/joaovrmoraes/bataudit/internal/auth"
 	"github.com/joaovrmoraes/bataudit/internal/config"
+	"github.com/joaovrmoraes/bataudit/internal/erasure"
+	"github.com/joaovrmoraes/bataudit/internal/fieldcrypt"
+	"github.com/joaovrmoraes/bataudit/internal/geoip"
 	"github.com/joaovrmoraes/bataudit/internal/health"
 	hcpkg "github.com/joaovrmoraes/bataudit/internal/healthcheck"
+	"github.com/joaovrmoraes/bataudit/internal/integrity"
+	"github.com/joaovrmoraes/bataudit/internal/legalhold"
+	"github.com/joaovrmoraes/bataudit/internal/livetail"
 	"github.com/joaovrmoraes/bataudit/internal/notification"
+	"github.com/joaovrmoraes/bataudit/internal/pipeline"
 	"github.com/joaovrmoraes/bataudit/internal/reports"
+	"github.com/joaovrmoraes/bataudit/internal/subjectexport"
 	"github.com/joaovrmoraes/bataudit/internal/tiering"
 	"github.com/joaovrmoraes/bataudit/internal/wallboard"
 	swaggerFiles "github.com/swaggo/files"
@@ -32,10 +43,36 @@ func registerRoutes(r *gin.Engine, conn *gorm.DB, authService *auth.Service) {
 	authHandler.RegisterProtectedRoutes(protectedAuth)
 
 	// ── Audit ─────────────────────────────────────────────────────────────────
+	// Field encryption keys are shared with the Worker, which seals events;
+	// without them Details returns sealed fields as stored.
+	keyring, err := fieldcrypt.NewKeyringFromEnv(conn, config.GetEnv)
+	if err != nil {
+		slog.Warn("Invalid field encryption configuration — encrypted fields cannot be decrypted", "error", err)
+	}
 	auditGroup := v1.Group("/audit")
 	auditGroup.Use(authService.JWTMiddleware())
 	auditHandler := audit.NewHandler(audit.NewRepository(conn))
 	auditHandler.SetQueryDB(conn)
+	if keyring != nil {
+		auditHandler.SetOpener(keyring)
+	}
+	// Live tail: the Worker announces stored events on Redis pub/sub. Without
+	// Redis, streams still deliver events at each poll.
+	tailHub := livetail.NewHub(
+		redis.NewClient(&redis.Options{Addr: config.GetEnv("REDIS_ADDRESS", "localhost:6379")}),
+		config.GetEnv("LIVE_TAIL_CHANNEL", livetail.DefaultChannel),
+	)
+	go tailHub.Start(context.Background())
+	tail := audit.NewTail(audit.NewRepository(conn), tailHub)
+	auditHandler.SetLiveTail(tail)
+	auditHandler.SetProjectScope(authService)
+	// Identity profiles resolve IPs to countries when a GeoIP database is set.
+	geo, err := geoip.NewFromEnv(config.GetEnv)
+	if err != nil {
+		slog.Warn("Invalid GeoIP database — identity profiles list no countries", "error", err)
+	} else if geo != nil {
+		auditHandler.SetGeolocator(geo)
+	}
 	auditHandler.RegisterReadRoutes(auditGroup)
 
 	// ── Reports (Studio) ──────────────────────────────────────────────────────
@@ -48,10 +85,63 @@ func registerRoutes(r *gin.Engine, conn *gorm.DB, authService *auth.Service) {
 	anomalyGroup.Use(authService.JWTMiddleware())
 	anomaly.NewHandler(anomaly.NewRepository(conn)).RegisterRoutes(anomalyGroup)
 
+	// ── Processing pipeline ───────────────────────────────────────────────────
+	pipelineGroup := v1.Group("/pipeline")
+	pipelineGroup.Use(authService.JWTMiddleware())
+	pipeline.NewHandler(pipeline.NewRepository(conn)).RegisterRoutes(pipelineGroup)
+
 	// ── Tiering ───────────────────────────────────────────────────────────────
 	tieringGroup := v1.Group("/audit/stats")
 	tieringGroup.Use(authService.JWTMiddleware())
-	tiering.NewHandler(tiering.NewRepository(conn)).RegisterRoutes(tieringGroup)
+	tieringHandler := tiering.NewHandler(tiering.NewRepository(conn)).
+		WithSettings(tiering.SettingsFromEnv(config.GetEnv))
+	tieringHandler.RegisterRoutes(tieringGroup)
+
+	retentionGroup := v1.Group("/retention")
+	retentionGroup.Use(authService.JWTMiddleware())
+	tieringHandler.RegisterRetentionRoutes(retentionGroup)
+
+	// ── Legal holds ───────────────────────────────────────────────────────────
+	holdGroup := v1.Group("/legal-holds")
+	holdGroup.Use(authService.JWTMiddleware())
+	legalhold.NewHandler(legalhold.NewRepository(conn)).RegisterRoutes(holdGroup)
+
+	// ── Data-subject erasure ──────────────────────────────────────────────────
+	erasureGroup := v1.Group("/erasures")
+	erasureGroup.Use(authService.JWTMiddleware())
+	erasure.NewHandler(erasure.NewManager(conn)).RegisterRoutes(erasureGroup)
+
+	// ── Archive rehydration ───────────────────────────────────────────────────
+	rehydrator, err := archive.NewRehydratorFromEnv(conn, config.GetEnv)
+	if err != nil {
+		slog.Warn("Invalid archive configuration — rehydration unavailable", "error", err)
+		rehydrator = archive.NewRehydrator(conn, nil)
+	}
+	rehydrator.WithRedactor(erasure.NewRedactor(conn))
+	archiveGroup := v1.Group("/archive")
+	archiveGroup.Use(authService.JWTMiddleware())
+	archive.NewHandler(rehydrator).RegisterRoutes(archiveGroup)
+
+	// ── Data-subject access exports ───────────────────────────────────────────
+	exporter, err := subjectexport.NewExporterFromEnv(conn, config.GetEnv)
+	if err != nil {
+		slog.Warn("Invalid archive configuration — access exports cover live events only", "error", err)
+		exporter = subjectexport.NewExporter(conn, nil)
+	}
+	exporter.WithRedactor(erasure.NewRedactor(conn))
+	subjectExportGroup := v1.Group("/subject-exports")
+	subjectExportGroup.Use(authService.JWTMiddleware())
+	subjectexport.NewHandler(exporter).RegisterRoutes(subjectExportGroup)
+
+	// ── Encryption ────────────────────────────────────────────────────────────
+	encryptionGroup := v1.Group("/encryption")
+	encryptionGroup.Use(authService.JWTMiddleware())
+	fieldcrypt.NewHandler(keyring).RegisterRoutes(encryptionGroup)
+
+	// ── Integrity ─────────────────────────────────────────────────────────────
+	integrityGroup := v1.Group("/integrity")
+	integrityGroup.Use(authService.JWTMiddleware())
+	integrity.NewHandler(integrity.NewRepository(conn)).RegisterRoutes(integrityGroup)
 
 	// ── Notifications ─────────────────────────────────────────────────────────
 	vapidPub := config.GetEnv("VAPID_PUBLIC_KEY", "")
@@ -77,7 +167,7 @@ func registerRoutes(r *gin.Engine, conn *gorm.DB, authService *auth.Service) {
 
 	// ── Wallboard ─────────────────────────────────────────────────────────────
 	jwtSecret := config.GetEnv("JWT_SECRET", "change-me-in-production")
-	wbHandler := wallboard.NewHandler(wallboard.NewRepository(conn), jwtSecret)
+	wbHandler := wallboard.NewHandler(wallboard.NewRepository(conn), jwtSecret).WithTail(tail)
 	wbHandler.RegisterPublicRoutes(v1.Group("/wallboard"))
 	wbHandler.RegisterDataRoutes(v1.Group("/wallboard"))
 	wbManage := v1.Group("/wallboard")
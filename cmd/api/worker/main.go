@@ -3,17 +3,28 @@ package main
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"log/slog"
+	"net/http"
 	"os"
 	"time"
 
 	"github.com/google/uuid"
 	"github.com/joaovrmoraes/bataudit/internal/anomaly"
+	"github.com/joaovrmoraes/bataudit/internal/archive"
 	"github.com/joaovrmoraes/bataudit/internal/audit"
 	"github.com/joaovrmoraes/bataudit/internal/config"
 	"github.com/joaovrmoraes/bataudit/internal/db"
+	"github.com/joaovrmoraes/bataudit/internal/erasure"
+	"github.com/joaovrmoraes/bataudit/internal/fieldcrypt"
 	"github.com/joaovrmoraes/bataudit/internal/healthcheck"
+	"github.com/joaovrmoraes/bataudit/internal/integrity"
+	"github.com/joaovrmoraes/bataudit/internal/livetail"
+	"github.com/joaovrmoraes/bataudit/internal/metrics"
 	"github.com/joaovrmoraes/bataudit/internal/notification"
+	"github.com/joaovrmoraes/bataudit/internal/partition"
+	"github.com/joaovrmoraes/bataudit/internal/pipeline"
+	"github.com/joaovrmoraes/bataudit/internal/subjectexport"
 	"github.com/joaovrmoraes/bataudit/internal/tiering"
 	"github.com/joaovrmoraes/bataudit/internal/worker"
 	"gorm.io/datatypes"
@@ -62,9 +73,30 @@ func main() {
 	sink := &auditAlertSink{svc: auditService, notif: notifSender}
 
 	anomalyRepo := anomaly.NewRepository(conn)
-	detector := anomaly.NewDetector(anomalyRepo, sink)
+	// Detector windows and cooldowns live in Redis so restarts keep the hourly
+	// baseline and replicas don't fire duplicate alerts.
+	detector := anomaly.NewDetector(anomalyRepo, sink).
+		WithRedisState(redisQueue.Client(), config.GetEnv("ANOMALY_STATE_PREFIX", anomaly.DefaultStatePrefix))
 
-	workerService := worker.NewService(cfg, auditService, redisQueue).WithDetector(detector)
+	// Per-project processor chains run between dequeue and insert.
+	pipelineRunner := pipeline.NewRunner(pipeline.NewRepository(conn))
+
+	// Optional field encryption (FIELD_ENCRYPTION_FIELDS). Storing fields in
+	// plaintext that were meant to be sealed is worse than not starting.
+	keyring, err := fieldcrypt.NewKeyringFromEnv(conn, config.GetEnv)
+	if err != nil {
+		slog.Error("Invalid field encryption configuration", "error", err)
+		os.Exit(1)
+	}
+
+	workerService := worker.NewService(cfg, auditService, redisQueue).
+		WithDetector(detector).
+		WithPipeline(pipelineRunner).
+		WithPublisher(livetail.NewPublisher(redisQueue.Client(), config.GetEnv("LIVE_TAIL_CHANNEL", livetail.DefaultChannel)))
+	if keyring != nil {
+		slog.Info("Field encryption enabled", "fields", keyring.Fields(), "master_key_id", keyring.MasterKeyID())
+		workerService.WithKeyring(keyring)
+	}
 
 	ctx, cancel := context.WithCancel(context.Background())
 	defer cancel()
@@ -79,11 +111,79 @@ func main() {
 	hcPoller := healthcheck.NewPoller(hcRepo, hcSink)
 	hcPoller.Start(ctx)
 
+	// Expression indexes for field filters on hot paths (FIELD_FILTER_INDEXES).
+	fieldIndexes, err := audit.ParseFieldIndexes(config.GetEnv("FIELD_FILTER_INDEXES", ""))
+	if err != nil {
+		slog.Error("Invalid FIELD_FILTER_INDEXES", "error", err)
+		os.Exit(1)
+	}
+	go func() {
+		if err := audit.EnsureFieldIndexes(ctx, conn, fieldIndexes); err != nil {
+			slog.Error("Failed to create field filter indexes", "error", err)
+		}
+	}()
+
+	// Keep audits partitions created ahead of time (Postgres, opt-in via
+	// AUDIT_PARTITION_INTERVAL); converts the table on first run.
+	partitionMgr := partition.NewManager(conn, partition.ConfigFromEnv(config.GetEnv))
+	go partitionMgr.Start(ctx)
+
 	// Start data tiering scheduler (aggregates old events nightly).
 	tieringRepo := tiering.NewRepository(conn)
-	tieringScheduler := tiering.NewSchedulerFromEnv(tieringRepo, config.GetEnv)
+	tieringScheduler := tiering.NewSchedulerFromEnv(tieringRepo, config.GetEnv).WithPartitions(partitionMgr)
+
+	// Optional cold archive (ARCHIVE_TARGET): raw events are copied to verified
+	// files before tiering removes them. A bad target must not fall back to
+	// deleting without a copy, so refuse to start.
+	archiver, err := archive.NewArchiverFromEnv(conn, config.GetEnv)
+	if err != nil {
+		slog.Error("Invalid archive configuration", "error", err)
+		os.Exit(1)
+	}
+	if archiver != nil {
+		slog.Info("Cold archive enabled", "target", archiver.Store().Describe())
+		tieringScheduler.WithArchiver(archiver)
+	}
 	go tieringScheduler.Start(ctx)
 
+	// Drop rehydrated archive events once their TTL passes.
+	go archive.NewJanitor(conn).Start(ctx)
+
+	// Drop access export bundles once their TTL passes.
+	go subjectexport.NewJanitor(conn).Start(ctx)
+
+	// Sign each project's new hash chain links periodically. Refuse to start
+	// with an unusable key rather than silently stop signing.
+	checkpointer, err := integrity.NewCheckpointerFromEnv(integrity.NewRepository(conn), config.GetEnv)
+	if err != nil {
+		slog.Error("Invalid integrity signing key", "error", err)
+		os.Exit(1)
+	}
+	go checkpointer.Start(ctx)
+
+	// Carry out data-subject erasure requests queued through the API.
+	eraser, err := erasure.NewRunnerFromEnv(conn, config.GetEnv)
+	if err != nil {
+		slog.Error("Invalid integrity signing key", "error", err)
+		os.Exit(1)
+	}
+	go eraser.Start(ctx)
+
+	// Rewrap data keys after a master key rotation and re-encrypt events
+	// sealed with rotated data keys.
+	if keyring != nil {
+		go fieldcrypt.NewRotatorFromEnv(keyring, config.GetEnv).Start(ctx)
+	}
+
+	// The worker has no API, so metrics get their own listener.
+	metricsAddr := ":" + config.GetEnv("WORKER_METRICS_PORT", "9091")
+	go func() {
+		slog.Info("Worker metrics server running", "addr", metricsAddr)
+		if err := metrics.Serve(metricsAddr); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			slog.Error("Worker metrics server failed", "error", err)
+		}
+	}()
+
 	slog.Info("Starting BatAudit worker service", "autoscaling", cfg.EnableAutoscaling)
 	if err := workerService.Start(ctx); err != nil {
 		slog.Error("Worker service failed", "error", err)
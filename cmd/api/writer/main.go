@@ -1,7 +1,9 @@
 package main
 
 import (
+	"errors"
 	"log/slog"
+	"net/http"
 	"os"
 	"time"
 
@@ -11,6 +13,7 @@ import (
 	"github.com/joaovrmoraes/bataudit/internal/auth"
 	"github.com/joaovrmoraes/bataudit/internal/config"
 	"github.com/joaovrmoraes/bataudit/internal/db"
+	"github.com/joaovrmoraes/bataudit/internal/metrics"
 	"github.com/joaovrmoraes/bataudit/internal/queue"
 	"gorm.io/gorm"
 )
@@ -43,9 +46,19 @@ func main() {
 
 	r := gin.Default()
 	r.Use(cors.Default())
+	r.Use(metrics.GinMiddleware("writer"))
 
 	registerRoutes(r, conn, authService, redisQueue)
 
+	// Metrics carry project IDs, so they stay off the public port.
+	metricsAddr := ":" + config.GetEnv("WRITER_METRICS_PORT", "9092")
+	go func() {
+		slog.Info("Writer metrics server running", "addr", metricsAddr)
+		if err := metrics.Serve(metricsAddr); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			slog.Error("Writer metrics server failed", "error", err)
+		}
+	}()
+
 	port := config.GetEnv("API_WRITER_PORT", "8081")
 	slog.Info("Writer server running", "port", port)
 	if err := r.Run(":" + port); err != nil {
@@ -68,6 +68,8 @@ func resetAndReseed(conn *gorm.DB) error {
 		"healthcheck_monitors",
 		"wallboard_tokens",
 		"audit_summaries",
+		"audit_latency_sketches",
+		"audit_sessions",
 		"anomaly_rules",
 		"audits",
 		"api_keys",
@@ -117,6 +119,10 @@ func resetAndReseed(conn *gorm.DB) error {
 
 	seedAnomalies(conn, project.ID)
 	total := seedEvents(conn, project.ID)
+	// Events inserted in bulk skip session tracking.
+	if err := audit.NewRepository(conn).RebuildSessions(project.ID); err != nil {
+		slog.Warn("failed to rebuild sessions", "error", err)
+	}
 	slog.Info("reseed complete", "events_inserted", total, "project_id", project.ID)
 	return nil
 }
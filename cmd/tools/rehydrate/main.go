@@ -0,0 +1,68 @@
+// rehydrate restores a project's archived events for a time range into
+// audits_rehydrated, where the API, export and SQL console can read them until
+// the TTL passes. Uses the same ARCHIVE_* settings as the worker.
+//
+//	go run ./cmd/tools/rehydrate -project <id> -from 2026-01-01T00:00:00Z -to 2026-01-08T00:00:00Z
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"log/slog"
+	"os"
+	"time"
+
+	"github.com/joaovrmoraes/bataudit/internal/archive"
+	"github.com/joaovrmoraes/bataudit/internal/config"
+	"github.com/joaovrmoraes/bataudit/internal/db"
+	"github.com/joaovrmoraes/bataudit/internal/erasure"
+)
+
+var (
+	projectID = flag.String("project", "", "Project ID to restore")
+	from      = flag.String("from", "", "Range start (RFC 3339)")
+	to        = flag.String("to", "", "Range end (RFC 3339)")
+	ttl       = flag.Duration("ttl", 0, "How long restored events stay queryable (default ARCHIVE_REHYDRATE_TTL or 72h)")
+)
+
+func main() {
+	slog.SetDefault(slog.New(slog.NewTextHandler(os.Stdout, &slog.HandlerOptions{Level: slog.LevelInfo})))
+	flag.Parse()
+
+	start, err := time.Parse(time.RFC3339, *from)
+	if err != nil {
+		fail("invalid -from", err)
+	}
+	end, err := time.Parse(time.RFC3339, *to)
+	if err != nil {
+		fail("invalid -to", err)
+	}
+
+	conn, err := db.Init()
+	if err != nil {
+		fail("database connection failed", err)
+	}
+	rehydrator, err := archive.NewRehydratorFromEnv(conn, config.GetEnv)
+	if err != nil {
+		fail("invalid archive configuration", err)
+	}
+	rehydrator.WithRedactor(erasure.NewRedactor(conn))
+
+	reh, err := rehydrator.Request(*projectID, start, end, *ttl, "cli")
+	if err != nil {
+		fail("rehydration rejected", err)
+	}
+	if err := rehydrator.Run(context.Background(), reh); err != nil {
+		fail("rehydration failed", err)
+	}
+
+	fmt.Printf("rehydration %s ready: %d events from %d files, queryable until %s\n",
+		reh.ID, reh.RowCount, reh.Files, reh.ExpiresAt.Format(time.RFC3339))
+	fmt.Printf("list them with GET /v1/audit?rehydrated=true&rehydration_id=%s\n", reh.ID)
+}
+
+func fail(msg string, err error) {
+	slog.Error(msg, "error", err)
+	os.Exit(1)
+}
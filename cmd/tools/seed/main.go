@@ -97,6 +97,10 @@ func main() {
 
 	// Seed audit events.
 	total := seedEvents(conn, project.ID)
+	// Events inserted in bulk skip session tracking.
+	if err := audit.NewRepository(conn).RebuildSessions(project.ID); err != nil {
+		slog.Warn("failed to rebuild sessions", "error", err)
+	}
 	slog.Info("seed complete", "events_inserted", total, "project_id", project.ID)
 }
 
@@ -0,0 +1,74 @@
+// verify-bundle checks an evidence bundle from GET /v1/integrity/bundle
+// offline, without database access: checkpoint signatures, event hashes,
+// Merkle inclusion proofs and chain links. Pin the instance key with -pubkey
+// to reject bundles signed by any other key. Exits 1 if the bundle does not
+// verify, 2 if it cannot be read.
+//
+//	go run ./cmd/tools/verify-bundle -pubkey <base64> bundle.json
+package main
+
+import (
+	"crypto/ed25519"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/joaovrmoraes/bataudit/internal/integrity"
+)
+
+var pubkey = flag.String("pubkey", "", "Trusted base64 Ed25519 public key (recommended)")
+
+func main() {
+	flag.Usage = func() {
+		fmt.Fprintln(os.Stderr, "usage: verify-bundle [-pubkey <base64>] <bundle.json | ->")
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+	if flag.NArg() != 1 {
+		flag.Usage()
+		os.Exit(2)
+	}
+
+	var trusted ed25519.PublicKey
+	if *pubkey != "" {
+		var err error
+		if trusted, err = integrity.ParsePublicKey(*pubkey); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(2)
+		}
+	}
+
+	in := os.Stdin
+	if name := flag.Arg(0); name != "-" {
+		f, err := os.Open(name)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(2)
+		}
+		defer f.Close()
+		in = f
+	}
+	data, err := io.ReadAll(in)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(2)
+	}
+	var bundle integrity.Bundle
+	if err := json.Unmarshal(data, &bundle); err != nil {
+		fmt.Fprintln(os.Stderr, "invalid bundle:", err)
+		os.Exit(2)
+	}
+
+	report := integrity.VerifyBundle(&bundle, trusted)
+	enc := json.NewEncoder(os.Stdout)
+	enc.SetIndent("", "  ")
+	_ = enc.Encode(report)
+	if trusted == nil && report.Valid {
+		fmt.Fprintln(os.Stderr, "warning: no -pubkey given; the bundle is only consistent with the keys it carries")
+	}
+	if !report.Valid {
+		os.Exit(1)
+	}
+}
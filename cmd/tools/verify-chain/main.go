@@ -0,0 +1,52 @@
+// verify-chain walks a project's tamper-evident hash chain and reports the
+// first break. Exits 1 on a break, 2 on error.
+//
+//	go run ./cmd/tools/verify-chain -project <id> [-from 1] [-to 0]
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"log/slog"
+	"os"
+
+	"github.com/joaovrmoraes/bataudit/internal/audit"
+	"github.com/joaovrmoraes/bataudit/internal/db"
+)
+
+var (
+	projectID = flag.String("project", "", "Project ID whose chain to verify")
+	fromSeq   = flag.Int64("from", 1, "First chain position")
+	toSeq     = flag.Int64("to", 0, "Last chain position (0 = head)")
+)
+
+func main() {
+	slog.SetDefault(slog.New(slog.NewTextHandler(os.Stderr, &slog.HandlerOptions{Level: slog.LevelInfo})))
+	flag.Parse()
+
+	if *projectID == "" {
+		fmt.Fprintln(os.Stderr, "-project is required")
+		os.Exit(2)
+	}
+
+	conn, err := db.Init()
+	if err != nil {
+		slog.Error("database connection failed", "error", err)
+		os.Exit(2)
+	}
+
+	res, err := audit.NewRepository(conn).VerifyChain(context.Background(), *projectID, *fromSeq, *toSeq)
+	if err != nil {
+		slog.Error("verification failed", "error", err)
+		os.Exit(2)
+	}
+
+	enc := json.NewEncoder(os.Stdout)
+	enc.SetIndent("", "  ")
+	_ = enc.Encode(res)
+	if !res.Valid {
+		os.Exit(1)
+	}
+}
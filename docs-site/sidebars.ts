@@ -42,6 +42,10 @@ const sidebars: SidebarsConfig = {
         'concepts/wallboard',
         'concepts/team-management',
         'concepts/insights',
+        'concepts/processing-pipeline',
+        'concepts/integrity',
+        'concepts/data-subjects',
+        'concepts/encryption',
       ],
     },
     {
@@ -1,12 +1,16 @@
 import { fetchWithAuth } from '@/lib/api'
 
 export interface Session {
+  id?: string
+  session_id?: string
   identifier: string
   service_name: string
   session_start: string
   session_end: string
   duration_seconds: number
   event_count: number
+  error_count: number
+  avg_response_time: number
 }
 
 export interface SessionEvent {
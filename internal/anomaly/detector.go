@@ -4,8 +4,11 @@ import (
 	"context"
 	"log/slog"
 	"math"
-	"sync"
+	"strings"
 	"time"
+
+	"github.com/go-redis/redis/v8"
+	"github.com/joaovrmoraes/bataudit/internal/metrics"
 )
 
 // Event is a minimal representation of an audit event for detection purposes.
@@ -20,58 +23,6 @@ type Event struct {
 	Identifier  string
 }
 
-// entry is a single data point in a sliding window.
-type entry struct {
-	Timestamp  time.Time
-	StatusCode int
-	Method     string
-	Identifier string
-}
-
-// window holds the rolling entries for one (project, service) pair.
-type window struct {
-	mu          sync.Mutex
-	entries     []entry
-	lastEventAt time.Time
-}
-
-func (w *window) add(e entry) {
-	w.mu.Lock()
-	defer w.mu.Unlock()
-
-	w.entries = append(w.entries, e)
-	w.lastEventAt = e.Timestamp
-
-	// Trim entries older than 1 hour (max lookback for any rule)
-	cutoff := time.Now().Add(-time.Hour)
-	i := 0
-	for i < len(w.entries) && w.entries[i].Timestamp.Before(cutoff) {
-		i++
-	}
-	if i > 0 {
-		w.entries = w.entries[i:]
-	}
-}
-
-// since returns a copy of entries at or after the given time.
-func (w *window) since(t time.Time) []entry {
-	w.mu.Lock()
-	defer w.mu.Unlock()
-	out := make([]entry, 0)
-	for _, e := range w.entries {
-		if !e.Timestamp.Before(t) {
-			out = append(out, e)
-		}
-	}
-	return out
-}
-
-func (w *window) getLastEventAt() time.Time {
-	w.mu.Lock()
-	defer w.mu.Unlock()
-	return w.lastEventAt
-}
-
 // windowKey builds the map key for a (project, service) pair.
 func windowKey(projectID, serviceName string) string {
 	return projectID + ":" + serviceName
@@ -84,48 +35,40 @@ func cooldownKey(projectID string, rt RuleType) string {
 
 // Detector processes audit events and fires alerts when rules are triggered.
 type Detector struct {
-	mu       sync.RWMutex
-	windows  map[string]*window
-	cooldown map[string]time.Time // last alert time per (project, ruleType)
-	repo     Repository
-	sink     AlertSink
+	state stateStore
+	repo  Repository
+	sink  AlertSink
 
 	cooldownDur time.Duration // minimum interval between same-type alerts per project
-
-	// Route-level error rate detection (per project:path:method).
-	routeWindows  map[string]*window
-	routeCooldown map[string]time.Time // 10-min cooldown per route
 }
 
 // NewDetector creates a Detector backed by the given repository and alert sink.
+// State is kept in memory until WithRedisState is called.
 func NewDetector(repo Repository, sink AlertSink) *Detector {
 	return &Detector{
-		windows:       make(map[string]*window),
-		cooldown:      make(map[string]time.Time),
-		repo:          repo,
-		sink:          sink,
-		cooldownDur:   5 * time.Minute,
-		routeWindows:  make(map[string]*window),
-		routeCooldown: make(map[string]time.Time),
+		state:       newMemoryStore(),
+		repo:        repo,
+		sink:        sink,
+		cooldownDur: 5 * time.Minute,
 	}
 }
 
+// WithRedisState moves the sliding windows and alert cooldowns to Redis, so the
+// hourly baseline and cooldowns survive restarts and are shared by replicas.
+// An empty prefix uses DefaultStatePrefix.
+func (d *Detector) WithRedisState(client *redis.Client, prefix string) *Detector {
+	d.state = newRedisStore(client, prefix)
+	return d
+}
+
 // Start launches the background goroutine that checks for silent-service anomalies.
 func (d *Detector) Start(ctx context.Context) {
 	go d.silentServiceLoop(ctx)
 }
 
 // getOrCreate returns the window for the given (projectID, serviceName), creating it if needed.
-func (d *Detector) getOrCreate(projectID, serviceName string) *window {
-	key := windowKey(projectID, serviceName)
-	d.mu.Lock()
-	w, ok := d.windows[key]
-	if !ok {
-		w = &window{}
-		d.windows[key] = w
-	}
-	d.mu.Unlock()
-	return w
+func (d *Detector) getOrCreate(projectID, serviceName string) windowState {
+	return d.state.window(windowKey(projectID, serviceName))
 }
 
 // ProcessEvent adds the event to the relevant sliding window and evaluates all rules.
@@ -159,7 +102,7 @@ func (d *Detector) ProcessEvent(ev Event) {
 }
 
 // evaluate runs a single rule against the current window state.
-func (d *Detector) evaluate(ev Event, rule AnomalyRule, w *window) {
+func (d *Detector) evaluate(ev Event, rule AnomalyRule, w windowState) {
 	switch rule.RuleType {
 	case RuleVolumeSpike:
 		d.checkVolumeSpike(ev, rule, w)
@@ -175,18 +118,9 @@ func (d *Detector) evaluate(ev Event, rule AnomalyRule, w *window) {
 
 // checkVolumeSpike detects event-per-minute spikes using z-score.
 // It compares the current 1-minute bucket against the mean+Nσ of the previous 59 buckets.
-func (d *Detector) checkVolumeSpike(ev Event, rule AnomalyRule, w *window) {
-	now := time.Now()
-	buckets := make([]float64, 60)
-
-	// Fill buckets: bucket[0] = most recent minute, bucket[59] = oldest
-	for _, e := range w.since(now.Add(-time.Hour)) {
-		age := now.Sub(e.Timestamp)
-		idx := int(age.Minutes())
-		if idx >= 0 && idx < 60 {
-			buckets[idx]++
-		}
-	}
+func (d *Detector) checkVolumeSpike(ev Event, rule AnomalyRule, w windowState) {
+	// buckets[0] = most recent minute, buckets[59] = oldest
+	buckets := w.perMinute(time.Now())
 
 	current := buckets[0]
 	history := buckets[1:] // 59 previous minutes
@@ -207,48 +141,34 @@ func (d *Detector) checkVolumeSpike(ev Event, rule AnomalyRule, w *window) {
 }
 
 // checkErrorRate detects when 4xx/5xx rate exceeds threshold% in the window.
-func (d *Detector) checkErrorRate(ev Event, rule AnomalyRule, w *window) {
+func (d *Detector) checkErrorRate(ev Event, rule AnomalyRule, w windowState) {
 	since := time.Now().Add(-time.Duration(rule.WindowSeconds) * time.Second)
-	entries := w.since(since)
-	if len(entries) < 10 { // need a minimum sample size
+	c := w.counts(since)
+	if c.Total < 10 { // need a minimum sample size
 		return
 	}
 
-	errors := 0
-	for _, e := range entries {
-		if e.StatusCode >= 400 {
-			errors++
-		}
-	}
-
-	rate := float64(errors) / float64(len(entries)) * 100
+	rate := float64(c.Errors) / float64(c.Total) * 100
 	if rate >= rule.Threshold {
 		d.fire(ev, rule.RuleType, map[string]any{
 			"error_rate_pct": math.Round(rate*100) / 100,
 			"threshold_pct":  rule.Threshold,
-			"error_count":    errors,
-			"total_count":    len(entries),
+			"error_count":    c.Errors,
+			"total_count":    c.Total,
 		})
 	}
 }
 
 // checkBruteForce detects repeated 401/403 from the same identifier.
-func (d *Detector) checkBruteForce(ev Event, rule AnomalyRule, w *window) {
+func (d *Detector) checkBruteForce(ev Event, rule AnomalyRule, w windowState) {
 	if ev.StatusCode != 401 && ev.StatusCode != 403 {
 		return
 	}
 
 	since := time.Now().Add(-time.Duration(rule.WindowSeconds) * time.Second)
-	entries := w.since(since)
+	c := w.counts(since)
 
-	counts := make(map[string]int)
-	for _, e := range entries {
-		if e.StatusCode == 401 || e.StatusCode == 403 {
-			counts[e.Identifier]++
-		}
-	}
-
-	if count := counts[ev.Identifier]; float64(count) >= rule.Threshold {
+	if count := c.AuthFailures[ev.Identifier]; float64(count) >= rule.Threshold {
 		d.fire(ev, rule.RuleType, map[string]any{
 			"identifier":   ev.Identifier,
 			"fail_count":   count,
@@ -259,20 +179,13 @@ func (d *Detector) checkBruteForce(ev Event, rule AnomalyRule, w *window) {
 }
 
 // checkMassDelete detects a high volume of DELETE requests in the window.
-func (d *Detector) checkMassDelete(ev Event, rule AnomalyRule, w *window) {
+func (d *Detector) checkMassDelete(ev Event, rule AnomalyRule, w windowState) {
 	if ev.Method != "DELETE" {
 		return
 	}
 
 	since := time.Now().Add(-time.Duration(rule.WindowSeconds) * time.Second)
-	entries := w.since(since)
-
-	deletes := 0
-	for _, e := range entries {
-		if e.Method == "DELETE" {
-			deletes++
-		}
-	}
+	deletes := w.counts(since).Deletes
 
 	if float64(deletes) >= rule.Threshold {
 		d.fire(ev, rule.RuleType, map[string]any{
@@ -299,33 +212,14 @@ func (d *Detector) silentServiceLoop(ctx context.Context) {
 }
 
 func (d *Detector) checkAllSilentServices() {
-	d.mu.RLock()
-	keys := make([]string, 0, len(d.windows))
-	for k := range d.windows {
-		keys = append(keys, k)
-	}
-	d.mu.RUnlock()
-
-	for _, key := range keys {
-		d.mu.RLock()
-		w := d.windows[key]
-		d.mu.RUnlock()
-
-		last := w.getLastEventAt()
+	for _, key := range d.state.windowKeys() {
+		last := d.state.window(key).getLastEventAt()
 		if last.IsZero() {
 			continue
 		}
 
 		// Resolve project from key (format: "projectID:serviceName")
-		sep := len(key)
-		for i, c := range key {
-			if c == ':' {
-				sep = i
-				break
-			}
-		}
-		projectID := key[:sep]
-		serviceName := key[sep+1:]
+		projectID, serviceName, _ := strings.Cut(key, ":")
 
 		rules, err := d.repo.ListByProject(projectID)
 		if err != nil {
@@ -356,17 +250,11 @@ func (d *Detector) checkAllSilentServices() {
 
 // fire emits an alert if the cooldown for this (project, ruleType) has expired.
 func (d *Detector) fire(ev Event, rt RuleType, details map[string]any) {
-	ck := cooldownKey(ev.ProjectID, rt)
-
-	d.mu.Lock()
-	last, ok := d.cooldown[ck]
-	if ok && time.Since(last) < d.cooldownDur {
-		d.mu.Unlock()
+	if !d.state.allowAlert(cooldownKey(ev.ProjectID, rt), d.cooldownDur) {
 		return
 	}
-	d.cooldown[ck] = time.Now()
-	d.mu.Unlock()
 
+	metrics.AlertsFired.Inc(string(rt))
 	slog.Warn("Anomaly detected",
 		"project_id", ev.ProjectID,
 		"service", ev.ServiceName,
@@ -394,44 +282,25 @@ func (d *Detector) checkErrorRateByRoute(ev Event) {
 		routeCooldown = 10 * time.Minute
 	)
 
-	key := routeWindowKey(ev.ProjectID, ev.Path, ev.Method)
-
-	d.mu.Lock()
-	w, ok := d.routeWindows[key]
-	if !ok {
-		w = &window{}
-		d.routeWindows[key] = w
-	}
-	d.mu.Unlock()
-
+	w := d.state.routeWindow(routeWindowKey(ev.ProjectID, ev.Path, ev.Method))
 	w.add(entry{Timestamp: ev.Timestamp, StatusCode: ev.StatusCode, Method: ev.Method})
 
-	entries := w.since(time.Now().Add(-windowDur))
-	if len(entries) < minRequests {
+	c := w.counts(time.Now().Add(-windowDur))
+	if c.Total < minRequests {
 		return
 	}
 
-	errors := 0
-	for _, e := range entries {
-		if e.StatusCode >= 400 {
-			errors++
-		}
-	}
-
-	rate := float64(errors) / float64(len(entries)) * 100
+	rate := float64(c.Errors) / float64(c.Total) * 100
 	if rate < threshold {
 		return
 	}
 
 	// Route-level cooldown — independent of project-wide cooldown.
-	d.mu.Lock()
-	if last, ok := d.routeCooldown[key]; ok && time.Since(last) < routeCooldown {
-		d.mu.Unlock()
+	if !d.state.allowAlert("route:"+routeWindowKey(ev.ProjectID, ev.Path, ev.Method), routeCooldown) {
 		return
 	}
-	d.routeCooldown[key] = time.Now()
-	d.mu.Unlock()
 
+	metrics.AlertsFired.Inc(string(RuleErrorRateByRoute))
 	slog.Warn("Route error rate anomaly detected",
 		"project_id", ev.ProjectID,
 		"path", ev.Path,
@@ -443,8 +312,8 @@ func (d *Detector) checkErrorRateByRoute(ev Event) {
 		"path":            ev.Path,
 		"method":          ev.Method,
 		"error_rate":      math.Round(rate*100) / 100,
-		"error_count":     errors,
-		"total_requests":  len(entries),
+		"error_count":     c.Errors,
+		"total_requests":  c.Total,
 		"window_seconds":  int(windowDur.Seconds()),
 	}); err != nil {
 		slog.Error("anomaly: failed to persist route error rate alert", "error", err)
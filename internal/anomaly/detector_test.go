@@ -404,3 +404,58 @@ func TestDefaultRules_allActive(t *testing.T) {
 		}
 	}
 }
+
+// --- State store ---
+
+func TestWindow_counts(t *testing.T) {
+	w := &window{}
+	now := time.Now()
+
+	w.add(entry{Timestamp: now.Add(-10 * time.Minute), StatusCode: 500})
+	w.add(entry{Timestamp: now, StatusCode: 200, Method: "DELETE"})
+	w.add(entry{Timestamp: now, StatusCode: 401, Identifier: "u1"})
+	w.add(entry{Timestamp: now, StatusCode: 403, Identifier: "u1"})
+
+	c := w.counts(now.Add(-5 * time.Minute))
+	if c.Total != 3 {
+		t.Errorf("total: want 3, got %d", c.Total)
+	}
+	if c.Errors != 2 {
+		t.Errorf("errors: want 2, got %d", c.Errors)
+	}
+	if c.Deletes != 1 {
+		t.Errorf("deletes: want 1, got %d", c.Deletes)
+	}
+	if c.AuthFailures["u1"] != 2 {
+		t.Errorf("auth failures: want 2, got %d", c.AuthFailures["u1"])
+	}
+}
+
+func TestMemoryStore_allowAlert(t *testing.T) {
+	s := newMemoryStore()
+
+	if !s.allowAlert("p1:error_rate", time.Minute) {
+		t.Fatal("first alert should be allowed")
+	}
+	if s.allowAlert("p1:error_rate", time.Minute) {
+		t.Error("second alert within cooldown should be suppressed")
+	}
+	if !s.allowAlert("p2:error_rate", time.Minute) {
+		t.Error("cooldown must be scoped per key")
+	}
+}
+
+func TestSilentService_usesStoreKeys(t *testing.T) {
+	rule := AnomalyRule{RuleType: RuleSilentService, Threshold: 5, Active: true}
+	d, sink := newDetector([]AnomalyRule{rule})
+
+	d.getOrCreate("p1", "svc:with:colons").add(entry{Timestamp: time.Now().Add(-10 * time.Minute)})
+	d.checkAllSilentServices()
+
+	if sink.count() != 1 {
+		t.Fatalf("expected 1 silent-service alert, got %d", sink.count())
+	}
+	if a := sink.last(); a.ProjectID != "p1" || a.ServiceName != "svc:with:colons" {
+		t.Errorf("wrong scope: project=%s service=%s", a.ProjectID, a.ServiceName)
+	}
+}
@@ -65,9 +65,7 @@ type createRuleRequest struct {
 // @Success      201  {object}  AnomalyRule
 // @Router       /anomaly/rules [post]
 func (h *Handler) CreateRule(c *gin.Context) {
-	claims, ok := c.MustGet("claims").(*auth.Claims)
-	if !ok || (claims.Role != auth.RoleOwner && claims.Role != auth.RoleAdmin) {
-		c.JSON(http.StatusForbidden, gin.H{"error": "insufficient permissions"})
+	if !auth.RequireManager(c) {
 		return
 	}
 
@@ -102,9 +100,7 @@ func (h *Handler) CreateRule(c *gin.Context) {
 // @Success      204
 // @Router       /anomaly/rules/{id} [delete]
 func (h *Handler) DeleteRule(c *gin.Context) {
-	claims, ok := c.MustGet("claims").(*auth.Claims)
-	if !ok || (claims.Role != auth.RoleOwner && claims.Role != auth.RoleAdmin) {
-		c.JSON(http.StatusForbidden, gin.H{"error": "insufficient permissions"})
+	if !auth.RequireManager(c) {
 		return
 	}
 
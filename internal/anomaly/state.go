@@ -0,0 +1,174 @@
+package anomaly
+
+import (
+	"sync"
+	"time"
+)
+
+// counts is the aggregated activity of a window over a time range.
+type counts struct {
+	Total        int
+	Errors       int            // status >= 400
+	Deletes      int            // DELETE requests
+	AuthFailures map[string]int // 401/403 per identifier
+}
+
+// windowState is the activity history of one (project, service) pair or one
+// route. Rules only ever read aggregates, so a backend may store counters
+// instead of individual entries.
+type windowState interface {
+	add(e entry)
+	counts(since time.Time) counts
+	// perMinute returns 60 event counts: [0] = current minute, [59] = oldest.
+	perMinute(now time.Time) []float64
+	getLastEventAt() time.Time
+}
+
+// stateStore holds every window plus the alert cooldowns. The in-memory store
+// is the default; the Redis store shares state across restarts and replicas.
+type stateStore interface {
+	window(key string) windowState
+	routeWindow(key string) windowState
+	// windowKeys lists the (project, service) keys that have received events.
+	windowKeys() []string
+	// allowAlert reports whether an alert for key may fire now and, if so,
+	// starts its cooldown. A cooldown <= 0 always allows.
+	allowAlert(key string, cooldown time.Duration) bool
+}
+
+// entry is a single data point in a sliding window.
+type entry struct {
+	Timestamp  time.Time
+	StatusCode int
+	Method     string
+	Identifier string
+}
+
+// window holds the rolling entries for one (project, service) pair.
+type window struct {
+	mu          sync.Mutex
+	entries     []entry
+	lastEventAt time.Time
+}
+
+func (w *window) add(e entry) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	w.entries = append(w.entries, e)
+	w.lastEventAt = e.Timestamp
+
+	// Trim entries older than 1 hour (max lookback for any rule)
+	cutoff := time.Now().Add(-time.Hour)
+	i := 0
+	for i < len(w.entries) && w.entries[i].Timestamp.Before(cutoff) {
+		i++
+	}
+	if i > 0 {
+		w.entries = w.entries[i:]
+	}
+}
+
+// since returns a copy of entries at or after the given time.
+func (w *window) since(t time.Time) []entry {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	out := make([]entry, 0)
+	for _, e := range w.entries {
+		if !e.Timestamp.Before(t) {
+			out = append(out, e)
+		}
+	}
+	return out
+}
+
+func (w *window) counts(since time.Time) counts {
+	c := counts{AuthFailures: make(map[string]int)}
+	for _, e := range w.since(since) {
+		c.Total++
+		if e.StatusCode >= 400 {
+			c.Errors++
+		}
+		if e.StatusCode == 401 || e.StatusCode == 403 {
+			c.AuthFailures[e.Identifier]++
+		}
+		if e.Method == "DELETE" {
+			c.Deletes++
+		}
+	}
+	return c
+}
+
+func (w *window) perMinute(now time.Time) []float64 {
+	buckets := make([]float64, 60)
+	for _, e := range w.since(now.Add(-time.Hour)) {
+		idx := int(now.Sub(e.Timestamp).Minutes())
+		if idx >= 0 && idx < 60 {
+			buckets[idx]++
+		}
+	}
+	return buckets
+}
+
+func (w *window) getLastEventAt() time.Time {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return w.lastEventAt
+}
+
+// memoryStore keeps detector state in process memory. It is lost on restart
+// and not shared between worker replicas.
+type memoryStore struct {
+	mu            sync.RWMutex
+	windows       map[string]*window
+	routeWindows  map[string]*window
+	cooldownUntil map[string]time.Time
+}
+
+func newMemoryStore() *memoryStore {
+	return &memoryStore{
+		windows:       make(map[string]*window),
+		routeWindows:  make(map[string]*window),
+		cooldownUntil: make(map[string]time.Time),
+	}
+}
+
+func (s *memoryStore) window(key string) windowState {
+	return s.getOrCreate(s.windows, key)
+}
+
+func (s *memoryStore) routeWindow(key string) windowState {
+	return s.getOrCreate(s.routeWindows, key)
+}
+
+func (s *memoryStore) getOrCreate(m map[string]*window, key string) *window {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	w, ok := m[key]
+	if !ok {
+		w = &window{}
+		m[key] = w
+	}
+	return w
+}
+
+func (s *memoryStore) windowKeys() []string {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	keys := make([]string, 0, len(s.windows))
+	for k := range s.windows {
+		keys = append(keys, k)
+	}
+	return keys
+}
+
+func (s *memoryStore) allowAlert(key string, cooldown time.Duration) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	now := time.Now()
+	if until, ok := s.cooldownUntil[key]; ok && now.Before(until) {
+		return false
+	}
+	s.cooldownUntil[key] = now.Add(cooldown)
+	return true
+}
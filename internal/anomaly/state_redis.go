@@ -0,0 +1,205 @@
+package anomaly
+
+import (
+	"context"
+	"log/slog"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+)
+
+const (
+	// DefaultStatePrefix namespaces every detector key in Redis.
+	DefaultStatePrefix = "bataudit:anomaly"
+
+	// bucketTTL keeps one-minute buckets a little longer than the longest
+	// lookback (1h) so a restart never loses part of the baseline.
+	bucketTTL    = 2 * time.Hour
+	redisTimeout = 2 * time.Second
+)
+
+// Hash fields inside a one-minute bucket.
+const (
+	fieldTotal      = "n"
+	fieldErrors     = "e"
+	fieldDeletes    = "d"
+	fieldAuthPrefix = "a:" // a:<identifier> → 401/403 count
+)
+
+// redisStore keeps detector state in Redis so it survives worker restarts and
+// is shared across replicas. Windows are stored as one-minute buckets:
+//
+//	<prefix>:w:<scope>:<unix-minute>  HASH  n, e, d, a:<identifier>
+//	<prefix>:last_seen                HASH  <project:service> → unix ms
+//	<prefix>:cd:<key>                 STRING with TTL (alert cooldown)
+//
+// Rule windows are therefore rounded to whole minutes.
+type redisStore struct {
+	client *redis.Client
+	prefix string
+}
+
+func newRedisStore(client *redis.Client, prefix string) *redisStore {
+	if prefix == "" {
+		prefix = DefaultStatePrefix
+	}
+	return &redisStore{client: client, prefix: prefix}
+}
+
+func (s *redisStore) window(key string) windowState {
+	return &redisWindow{store: s, scope: "svc:" + key, key: key, trackLastSeen: true}
+}
+
+func (s *redisStore) routeWindow(key string) windowState {
+	return &redisWindow{store: s, scope: "route:" + key, key: key}
+}
+
+func (s *redisStore) lastSeenKey() string {
+	return s.prefix + ":last_seen"
+}
+
+func (s *redisStore) windowKeys() []string {
+	ctx, cancel := context.WithTimeout(context.Background(), redisTimeout)
+	defer cancel()
+
+	keys, err := s.client.HKeys(ctx, s.lastSeenKey()).Result()
+	if err != nil {
+		slog.Error("anomaly: failed to list windows", "error", err)
+		return nil
+	}
+	return keys
+}
+
+func (s *redisStore) allowAlert(key string, cooldown time.Duration) bool {
+	if cooldown <= 0 {
+		return true
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), redisTimeout)
+	defer cancel()
+
+	ok, err := s.client.SetNX(ctx, s.prefix+":cd:"+key, time.Now().Unix(), cooldown).Result()
+	if err != nil {
+		// Prefer a possible duplicate alert over a silently missed one.
+		slog.Error("anomaly: cooldown check failed", "key", key, "error", err)
+		return true
+	}
+	return ok
+}
+
+// redisWindow is a view over the minute buckets of one scope.
+type redisWindow struct {
+	store         *redisStore
+	scope         string
+	key           string
+	trackLastSeen bool
+}
+
+func minuteOf(t time.Time) int64 {
+	return t.Unix() / 60
+}
+
+func (w *redisWindow) bucketKey(minute int64) string {
+	return w.store.prefix + ":w:" + w.scope + ":" + strconv.FormatInt(minute, 10)
+}
+
+func (w *redisWindow) add(e entry) {
+	if e.Timestamp.Before(time.Now().Add(-time.Hour)) {
+		return // outside every rule's lookback
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), redisTimeout)
+	defer cancel()
+
+	key := w.bucketKey(minuteOf(e.Timestamp))
+	pipe := w.store.client.TxPipeline()
+	pipe.HIncrBy(ctx, key, fieldTotal, 1)
+	if e.StatusCode >= 400 {
+		pipe.HIncrBy(ctx, key, fieldErrors, 1)
+	}
+	if e.StatusCode == 401 || e.StatusCode == 403 {
+		pipe.HIncrBy(ctx, key, fieldAuthPrefix+e.Identifier, 1)
+	}
+	if e.Method == "DELETE" {
+		pipe.HIncrBy(ctx, key, fieldDeletes, 1)
+	}
+	pipe.Expire(ctx, key, bucketTTL)
+	if w.trackLastSeen {
+		pipe.HSet(ctx, w.store.lastSeenKey(), w.key, e.Timestamp.UnixMilli())
+	}
+	if _, err := pipe.Exec(ctx); err != nil {
+		slog.Error("anomaly: failed to record event", "scope", w.scope, "error", err)
+	}
+}
+
+// buckets fetches the buckets from the given minute up to the current one.
+// Index 0 is the current minute.
+func (w *redisWindow) buckets(from, now int64) []map[string]string {
+	if from > now {
+		from = now
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), redisTimeout)
+	defer cancel()
+
+	pipe := w.store.client.Pipeline()
+	cmds := make([]*redis.StringStringMapCmd, 0, now-from+1)
+	for m := now; m >= from; m-- {
+		cmds = append(cmds, pipe.HGetAll(ctx, w.bucketKey(m)))
+	}
+	if _, err := pipe.Exec(ctx); err != nil && err != redis.Nil {
+		slog.Error("anomaly: failed to read window", "scope", w.scope, "error", err)
+		return nil
+	}
+
+	out := make([]map[string]string, len(cmds))
+	for i, cmd := range cmds {
+		out[i] = cmd.Val()
+	}
+	return out
+}
+
+func (w *redisWindow) counts(since time.Time) counts {
+	c := counts{AuthFailures: make(map[string]int)}
+	for _, b := range w.buckets(minuteOf(since), minuteOf(time.Now())) {
+		for field, raw := range b {
+			n, _ := strconv.Atoi(raw)
+			switch {
+			case field == fieldTotal:
+				c.Total += n
+			case field == fieldErrors:
+				c.Errors += n
+			case field == fieldDeletes:
+				c.Deletes += n
+			case strings.HasPrefix(field, fieldAuthPrefix):
+				c.AuthFailures[strings.TrimPrefix(field, fieldAuthPrefix)] += n
+			}
+		}
+	}
+	return c
+}
+
+func (w *redisWindow) perMinute(now time.Time) []float64 {
+	out := make([]float64, 60)
+	current := minuteOf(now)
+	for i, b := range w.buckets(current-59, current) {
+		n, _ := strconv.Atoi(b[fieldTotal])
+		out[i] = float64(n)
+	}
+	return out
+}
+
+func (w *redisWindow) getLastEventAt() time.Time {
+	ctx, cancel := context.WithTimeout(context.Background(), redisTimeout)
+	defer cancel()
+
+	ms, err := w.store.client.HGet(ctx, w.store.lastSeenKey(), w.key).Int64()
+	if err != nil {
+		if err != redis.Nil {
+			slog.Error("anomaly: failed to read last event time", "key", w.key, "error", err)
+		}
+		return time.Time{}
+	}
+	return time.UnixMilli(ms)
+}
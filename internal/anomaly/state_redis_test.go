@@ -0,0 +1,161 @@
+package anomaly
+
+import (
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/go-redis/redis/v8"
+)
+
+// newTestRedis starts an in-process Redis and returns a factory for clients,
+// each standing in for a separate worker process or replica.
+func newTestRedis(t *testing.T) (*miniredis.Miniredis, func() *redis.Client) {
+	t.Helper()
+	mr := miniredis.RunT(t)
+	return mr, func() *redis.Client {
+		c := redis.NewClient(&redis.Options{Addr: mr.Addr()})
+		t.Cleanup(func() { c.Close() })
+		return c
+	}
+}
+
+func TestRedisStore_survivesRestart(t *testing.T) {
+	_, client := newTestRedis(t)
+	now := time.Now()
+
+	before := newRedisStore(client(), "")
+	w := before.window(windowKey("p1", "api"))
+	w.add(entry{Timestamp: now, StatusCode: 200, Method: "GET"})
+	w.add(entry{Timestamp: now, StatusCode: 401, Method: "POST", Identifier: "u1"})
+	w.add(entry{Timestamp: now, StatusCode: 500, Method: "DELETE"})
+	before.routeWindow("p1:GET /users").add(entry{Timestamp: now, StatusCode: 503})
+	if !before.allowAlert("p1:error_rate", time.Minute) {
+		t.Fatal("first alert should be allowed")
+	}
+
+	// A new store on a new connection is what a restarted worker sees.
+	after := newRedisStore(client(), "")
+	c := after.window(windowKey("p1", "api")).counts(now.Add(-5 * time.Minute))
+	if c.Total != 3 || c.Errors != 2 || c.Deletes != 1 || c.AuthFailures["u1"] != 1 {
+		t.Errorf("counts after restart: %+v", c)
+	}
+	if rc := after.routeWindow("p1:GET /users").counts(now.Add(-5 * time.Minute)); rc.Errors != 1 {
+		t.Errorf("route errors after restart: want 1, got %d", rc.Errors)
+	}
+	if pm := after.window(windowKey("p1", "api")).perMinute(time.Now()); pm[0] != 3 {
+		t.Errorf("current minute after restart: want 3, got %v", pm[0])
+	}
+	if got := after.window(windowKey("p1", "api")).getLastEventAt(); got.UnixMilli() != now.UnixMilli() {
+		t.Errorf("last event after restart: want %v, got %v", now, got)
+	}
+	if keys := after.windowKeys(); len(keys) != 1 || keys[0] != windowKey("p1", "api") {
+		t.Errorf("window keys after restart: %v", keys)
+	}
+	if after.allowAlert("p1:error_rate", time.Minute) {
+		t.Error("cooldown should survive a restart")
+	}
+}
+
+func TestRedisStore_cooldownExpires(t *testing.T) {
+	mr, client := newTestRedis(t)
+	s := newRedisStore(client(), "")
+
+	if !s.allowAlert("p1:mass_delete", time.Minute) {
+		t.Fatal("first alert should be allowed")
+	}
+	mr.FastForward(61 * time.Second)
+	if !s.allowAlert("p1:mass_delete", time.Minute) {
+		t.Error("alert should be allowed once the cooldown has passed")
+	}
+}
+
+func TestRedisStore_concurrentReplicas(t *testing.T) {
+	_, client := newTestRedis(t)
+	replicas := []*redisStore{newRedisStore(client(), ""), newRedisStore(client(), "")}
+	now := time.Now()
+
+	const perReplica = 50
+	var wg sync.WaitGroup
+	for _, s := range replicas {
+		wg.Add(1)
+		go func(s *redisStore) {
+			defer wg.Done()
+			w := s.window(windowKey("p1", "api"))
+			for i := 0; i < perReplica; i++ {
+				w.add(entry{Timestamp: now, StatusCode: 403, Method: "DELETE", Identifier: "u1"})
+			}
+		}(s)
+	}
+	wg.Wait()
+
+	for i, s := range replicas {
+		c := s.window(windowKey("p1", "api")).counts(now.Add(-5 * time.Minute))
+		if c.Total != 2*perReplica || c.Errors != 2*perReplica || c.Deletes != 2*perReplica || c.AuthFailures["u1"] != 2*perReplica {
+			t.Errorf("replica %d: counts %+v, want %d of each", i, c, 2*perReplica)
+		}
+	}
+
+	// Both replicas race for the same alert; only one may send it.
+	var (
+		mu      sync.Mutex
+		allowed int
+	)
+	for i := 0; i < 20; i++ {
+		wg.Add(1)
+		go func(s *redisStore) {
+			defer wg.Done()
+			if s.allowAlert("p1:brute_force", time.Minute) {
+				mu.Lock()
+				allowed++
+				mu.Unlock()
+			}
+		}(replicas[i%2])
+	}
+	wg.Wait()
+	if allowed != 1 {
+		t.Errorf("want exactly 1 replica to fire the alert, got %d", allowed)
+	}
+}
+
+func TestRedisStore_prefixIsolation(t *testing.T) {
+	_, client := newTestRedis(t)
+	a := newRedisStore(client(), "staging")
+	b := newRedisStore(client(), "prod")
+
+	a.window(windowKey("p1", "api")).add(entry{Timestamp: time.Now(), StatusCode: 200})
+	a.allowAlert("p1:error_rate", time.Minute)
+
+	if c := b.window(windowKey("p1", "api")).counts(time.Now().Add(-time.Minute)); c.Total != 0 {
+		t.Errorf("other prefix should see no events, got %d", c.Total)
+	}
+	if keys := b.windowKeys(); len(keys) != 0 {
+		t.Errorf("other prefix should have no windows, got %v", keys)
+	}
+	if !b.allowAlert("p1:error_rate", time.Minute) {
+		t.Error("cooldowns must not leak across prefixes")
+	}
+}
+
+func TestDetector_redisCooldownAcrossReplicas(t *testing.T) {
+	_, client := newTestRedis(t)
+	rule := AnomalyRule{RuleType: RuleMassDelete, Threshold: 3, WindowSeconds: 60, Active: true}
+
+	var sinks []*captureSink
+	var detectors []*Detector
+	for i := 0; i < 2; i++ {
+		sink := &captureSink{}
+		sinks = append(sinks, sink)
+		detectors = append(detectors, NewDetector(&staticRepo{rules: []AnomalyRule{rule}}, sink).WithRedisState(client(), ""))
+	}
+
+	// Deletes spread across replicas still add up to one shared window.
+	for i := 0; i < 4; i++ {
+		detectors[i%2].ProcessEvent(testEvent("p1", "api", "prod", 200, "DELETE"))
+	}
+
+	if total := sinks[0].count() + sinks[1].count(); total != 1 {
+		t.Errorf("want 1 mass-delete alert across replicas, got %d", total)
+	}
+}
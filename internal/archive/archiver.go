@@ -0,0 +1,202 @@
+package archive
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"strconv"
+	"time"
+
+	"github.com/joaovrmoraes/bataudit/internal/audit"
+	"github.com/joaovrmoraes/bataudit/internal/metrics"
+	"gorm.io/gorm"
+)
+
+// DefaultBatchRows caps how many events go into one archive file.
+const DefaultBatchRows = 20000
+
+// Archiver copies raw events into verified archive files before tiering
+// removes them.
+type Archiver struct {
+	db        *gorm.DB
+	store     Store
+	batchRows int
+}
+
+func NewArchiver(db *gorm.DB, store Store) *Archiver {
+	return &Archiver{db: db, store: store, batchRows: DefaultBatchRows}
+}
+
+// WithBatchRows sets the maximum number of events per archive file.
+func (a *Archiver) WithBatchRows(n int) *Archiver {
+	if n > 0 {
+		a.batchRows = n
+	}
+	return a
+}
+
+// NewArchiverFromEnv builds an Archiver from ARCHIVE_TARGET (file:// or s3://)
+// and ARCHIVE_BATCH_ROWS. It returns nil when ARCHIVE_TARGET is unset.
+func NewArchiverFromEnv(db *gorm.DB, getEnv func(string, string) string) (*Archiver, error) {
+	target := getEnv("ARCHIVE_TARGET", "")
+	if target == "" {
+		return nil, nil
+	}
+	store, err := NewStore(target, getEnv)
+	if err != nil {
+		return nil, err
+	}
+	batch, _ := strconv.Atoi(getEnv("ARCHIVE_BATCH_ROWS", ""))
+	return NewArchiver(db, store).WithBatchRows(batch), nil
+}
+
+// Store returns the archive's object store.
+func (a *Archiver) Store() Store { return a.store }
+
+// Archive writes the raw events matching where (a condition on audits) into
+// archive files, one or more per project and UTC day. Each file and its
+// manifest are read back and checked before remove, when non-nil, is called
+// with the IDs of the events it holds; rows are therefore only ever removed
+// once a verified copy exists. Returns the number of events archived.
+func (a *Archiver) Archive(ctx context.Context, where string, args []interface{}, remove func(ids []string) error) (int64, error) {
+	rows, err := a.db.WithContext(ctx).Model(&audit.Audit{}).
+		Where(where, args...).
+		Order("project_id, timestamp, id").
+		Rows()
+	if err != nil {
+		return 0, err
+	}
+	defer rows.Close()
+
+	var (
+		total   int64
+		batch   []audit.Audit
+		project string
+		day     time.Time
+	)
+	flush := func() error {
+		if len(batch) == 0 {
+			return nil
+		}
+		err := a.writeFile(ctx, project, batch, remove)
+		if err != nil {
+			metrics.ArchiveFiles.Inc("error")
+			return err
+		}
+		metrics.ArchiveFiles.Inc("ok")
+		metrics.ArchiveRows.Add(float64(len(batch)))
+		total += int64(len(batch))
+		batch = batch[:0]
+		return nil
+	}
+
+	for rows.Next() {
+		var ev audit.Audit
+		if err := a.db.ScanRows(rows, &ev); err != nil {
+			return total, err
+		}
+		evDay := ev.Timestamp.UTC().Truncate(24 * time.Hour)
+		if len(batch) > 0 && (ev.ProjectID != project || !evDay.Equal(day) || len(batch) >= a.batchRows) {
+			if err := flush(); err != nil {
+				return total, err
+			}
+		}
+		project, day = ev.ProjectID, evDay
+		batch = append(batch, ev)
+	}
+	if err := rows.Err(); err != nil {
+		return total, err
+	}
+	return total, flush()
+}
+
+// writeFile stores one batch and its manifest, verifies both, then hands the
+// IDs to remove. A key that already exists holds identical content from an
+// interrupted earlier run, so it is verified rather than rewritten.
+func (a *Archiver) writeFile(ctx context.Context, projectID string, events []audit.Audit, remove func(ids []string) error) error {
+	data, err := encode(events)
+	if err != nil {
+		return fmt.Errorf("archive: encode: %w", err)
+	}
+	sum := sha256Hex(data)
+	key := objectKey(projectID, events[0].Timestamp, sum)
+
+	m := Manifest{
+		Version:   manifestVersion,
+		Format:    formatNDJSONGzip,
+		Object:    key,
+		ProjectID: projectID,
+		Day:       events[0].Timestamp.UTC().Format("2006-01-02"),
+		Rows:      len(events),
+		From:      events[0].Timestamp.UTC(),
+		To:        events[len(events)-1].Timestamp.UTC(),
+		SHA256:    sum,
+		Bytes:     len(data),
+		CreatedAt: time.Now().UTC(),
+	}
+	manifest, err := json.MarshalIndent(m, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	if err := a.store.Put(ctx, key, data); err != nil && !errors.Is(err, ErrExists) {
+		return err
+	}
+	if err := a.store.Put(ctx, manifestKey(key), manifest); err != nil && !errors.Is(err, ErrExists) {
+		return err
+	}
+
+	ids := make([]string, len(events))
+	for i := range events {
+		ids[i] = events[i].ID
+	}
+	if err := a.verify(ctx, m, ids); err != nil {
+		return err
+	}
+	slog.Debug("archive: file written", "key", key, "rows", m.Rows, "bytes", m.Bytes)
+
+	if remove == nil {
+		return nil
+	}
+	return remove(ids)
+}
+
+// verify reads the file and manifest back and checks them against what was
+// written: checksum, size, row count and event IDs.
+func (a *Archiver) verify(ctx context.Context, want Manifest, ids []string) error {
+	data, err := a.store.Get(ctx, want.Object)
+	if err != nil {
+		return fmt.Errorf("archive: verify %s: %w", want.Object, err)
+	}
+	if len(data) != want.Bytes || sha256Hex(data) != want.SHA256 {
+		return fmt.Errorf("archive: verify %s: checksum mismatch", want.Object)
+	}
+	events, err := decode(data)
+	if err != nil {
+		return fmt.Errorf("archive: verify %s: %w", want.Object, err)
+	}
+	if len(events) != len(ids) {
+		return fmt.Errorf("archive: verify %s: %d rows, want %d", want.Object, len(events), len(ids))
+	}
+	for i := range events {
+		if events[i].ID != ids[i] {
+			return fmt.Errorf("archive: verify %s: row %d is %s, want %s", want.Object, i, events[i].ID, ids[i])
+		}
+	}
+
+	raw, err := a.store.Get(ctx, manifestKey(want.Object))
+	if err != nil {
+		return fmt.Errorf("archive: verify manifest of %s: %w", want.Object, err)
+	}
+	var got Manifest
+	if err := json.NewDecoder(bytes.NewReader(raw)).Decode(&got); err != nil {
+		return fmt.Errorf("archive: verify manifest of %s: %w", want.Object, err)
+	}
+	if got.Object != want.Object || got.SHA256 != want.SHA256 || got.Rows != want.Rows || got.Bytes != want.Bytes {
+		return fmt.Errorf("archive: verify manifest of %s: does not match the file", want.Object)
+	}
+	return nil
+}
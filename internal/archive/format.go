@@ -0,0 +1,113 @@
+package archive
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/joaovrmoraes/bataudit/internal/audit"
+)
+
+const (
+	formatNDJSONGzip = "ndjson.gz"
+	manifestVersion  = 1
+
+	// rawPrefix is where raw-event archives live:
+	// raw/project=<id>/day=<YYYY-MM-DD>/<oldest>-<sha256[:16]>.ndjson.gz
+	rawPrefix = "raw"
+	// noProject stands in for events without a project.
+	noProject = "_none"
+
+	dataSuffix     = ".ndjson.gz"
+	manifestSuffix = ".manifest.json"
+)
+
+// Manifest describes one archive file. It is stored next to the file as
+// <name>.manifest.json.
+type Manifest struct {
+	Version   int       `json:"version"`
+	Format    string    `json:"format"`
+	Object    string    `json:"object"` // key of the data file
+	ProjectID string    `json:"project_id"`
+	Day       string    `json:"day"` // UTC, YYYY-MM-DD
+	Rows      int       `json:"rows"`
+	From      time.Time `json:"from"` // oldest event
+	To        time.Time `json:"to"`   // newest event
+	SHA256    string    `json:"sha256"`
+	Bytes     int       `json:"bytes"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// projectPrefix returns the key prefix of all of one project's archives.
+func projectPrefix(projectID string) string {
+	if projectID == "" {
+		projectID = noProject
+	}
+	return fmt.Sprintf("%s/project=%s/", rawPrefix, url.PathEscape(projectID))
+}
+
+// dayPrefix returns the key prefix of one project's archives for one day.
+func dayPrefix(projectID string, day time.Time) string {
+	return projectPrefix(projectID) + "day=" + day.UTC().Format("2006-01-02") + "/"
+}
+
+// objectKey names a data file after its oldest event and content hash, so
+// re-archiving identical rows after an interrupted run maps to the same key.
+func objectKey(projectID string, oldest time.Time, sum string) string {
+	return dayPrefix(projectID, oldest) + oldest.UTC().Format("20060102T150405Z") + "-" + sum[:16] + dataSuffix
+}
+
+func manifestKey(object string) string {
+	return strings.TrimSuffix(object, dataSuffix) + manifestSuffix
+}
+
+// encode writes events as gzip-compressed NDJSON, one event per line. The
+// output is deterministic for the same events.
+func encode(events []audit.Audit) ([]byte, error) {
+	var buf bytes.Buffer
+	zw := gzip.NewWriter(&buf)
+	enc := json.NewEncoder(zw)
+	for i := range events {
+		if err := enc.Encode(&events[i]); err != nil {
+			return nil, err
+		}
+	}
+	if err := zw.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// record decodes an archived event. Method is a plain string so events the
+// API would reject today (system events have no method) still round-trip.
+type record struct {
+	audit.Audit
+	Method string `json:"method"`
+}
+
+// decode reads an archive file written by encode.
+func decode(data []byte) ([]audit.Audit, error) {
+	zr, err := gzip.NewReader(bytes.NewReader(data))
+	if err != nil {
+		return nil, err
+	}
+	defer zr.Close()
+
+	var events []audit.Audit
+	sc := bufio.NewScanner(zr)
+	sc.Buffer(make([]byte, 0, 64*1024), 64*1024*1024)
+	for sc.Scan() {
+		var rec record
+		if err := json.Unmarshal(sc.Bytes(), &rec); err != nil {
+			return nil, fmt.Errorf("line %d: %w", len(events)+1, err)
+		}
+		rec.Audit.Method = audit.HTTPMethod(rec.Method)
+		events = append(events, rec.Audit)
+	}
+	return events, sc.Err()
+}
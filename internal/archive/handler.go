@@ -0,0 +1,169 @@
+package archive
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/joaovrmoraes/bataudit/internal/auth"
+	"gorm.io/gorm"
+)
+
+// Handler exposes rehydration of archived events.
+type Handler struct {
+	rehydrator *Rehydrator
+}
+
+func NewHandler(rehydrator *Rehydrator) *Handler {
+	return &Handler{rehydrator: rehydrator}
+}
+
+// RegisterRoutes mounts the archive endpoints onto an already-JWT-protected
+// group. Expected base path: /v1/archive
+func (h *Handler) RegisterRoutes(rg *gin.RouterGroup) {
+	rg.GET("/rehydrations", h.ListRehydrations)
+	rg.POST("/rehydrations", h.CreateRehydration)
+	rg.GET("/rehydrations/:id", h.GetRehydration)
+	rg.DELETE("/rehydrations/:id", h.DeleteRehydration)
+}
+
+type rehydrationRequest struct {
+	ProjectID string    `json:"project_id" binding:"required"`
+	From      time.Time `json:"from"       binding:"required"`
+	To        time.Time `json:"to"         binding:"required"`
+	// TTLHours overrides ARCHIVE_REHYDRATE_TTL for this request (max 720).
+	TTLHours int `json:"ttl_hours"`
+}
+
+// CreateRehydration godoc
+// @Summary      Restore archived events for investigation
+// @Description  Loads a project's archived events for a time range into audits_rehydrated. Runs in the background; poll GET /archive/rehydrations/{id}. Restored events are listed with rehydrated=true and expire after the TTL.
+// @Tags         archive
+// @Accept       json
+// @Produce      json
+// @Security     BearerAuth
+// @Param        body  body  rehydrationRequest  true  "Slice to restore"
+// @Success      202  {object}  Rehydration
+// @Failure      400  {object}  map[string]string
+// @Failure      403  {object}  map[string]string
+// @Failure      503  {object}  map[string]string
+// @Router       /archive/rehydrations [post]
+func (h *Handler) CreateRehydration(c *gin.Context) {
+	if !auth.RequireManager(c) {
+		return
+	}
+
+	var req rehydrationRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	requestedBy := ""
+	if claims, ok := c.MustGet("claims").(*auth.Claims); ok {
+		requestedBy = claims.Email
+	}
+	reh, err := h.rehydrator.Request(req.ProjectID, req.From, req.To, time.Duration(req.TTLHours)*time.Hour, requestedBy)
+	if errors.Is(err, ErrNotConfigured) {
+		c.JSON(http.StatusServiceUnavailable, gin.H{"error": err.Error()})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	go func(reh Rehydration) {
+		_ = h.rehydrator.Run(context.Background(), &reh)
+	}(*reh)
+
+	c.JSON(http.StatusAccepted, reh)
+}
+
+// ListRehydrations godoc
+// @Summary      List a project's rehydrations
+// @Tags         archive
+// @Produce      json
+// @Security     BearerAuth
+// @Param        project_id  query  string  true  "Project ID"
+// @Success      200  {array}  Rehydration
+// @Failure      400  {object}  map[string]string
+// @Router       /archive/rehydrations [get]
+func (h *Handler) ListRehydrations(c *gin.Context) {
+	projectID := c.Query("project_id")
+	if projectID == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "project_id required"})
+		return
+	}
+
+	list, err := h.rehydrator.List(projectID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, list)
+}
+
+// GetRehydration godoc
+// @Summary      Get a rehydration's status
+// @Tags         archive
+// @Produce      json
+// @Security     BearerAuth
+// @Param        id          path   string  true  "Rehydration ID"
+// @Param        project_id  query  string  true  "Project ID"
+// @Success      200  {object}  Rehydration
+// @Failure      404  {object}  map[string]string
+// @Router       /archive/rehydrations/{id} [get]
+func (h *Handler) GetRehydration(c *gin.Context) {
+	reh, ok := h.find(c)
+	if !ok {
+		return
+	}
+	c.JSON(http.StatusOK, reh)
+}
+
+// DeleteRehydration godoc
+// @Summary      Expire a rehydration now
+// @Description  Deletes the restored events; the rehydration record is kept with status expired.
+// @Tags         archive
+// @Security     BearerAuth
+// @Param        id          path   string  true  "Rehydration ID"
+// @Param        project_id  query  string  true  "Project ID"
+// @Success      204
+// @Failure      403  {object}  map[string]string
+// @Failure      404  {object}  map[string]string
+// @Router       /archive/rehydrations/{id} [delete]
+func (h *Handler) DeleteRehydration(c *gin.Context) {
+	if !auth.RequireManager(c) {
+		return
+	}
+	reh, ok := h.find(c)
+	if !ok {
+		return
+	}
+	if err := h.rehydrator.Expire(reh.ID); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.Status(http.StatusNoContent)
+}
+
+func (h *Handler) find(c *gin.Context) (*Rehydration, bool) {
+	projectID := c.Query("project_id")
+	if projectID == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "project_id required"})
+		return nil, false
+	}
+	reh, err := h.rehydrator.Get(c.Param("id"), projectID)
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "rehydration not found"})
+		return nil, false
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return nil, false
+	}
+	return reh, true
+}
@@ -0,0 +1,375 @@
+package archive
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/joaovrmoraes/bataudit/internal/audit"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+const (
+	DefaultRehydrationTTL     = 72 * time.Hour
+	DefaultRehydrationMaxRows = 1_000_000
+
+	maxRehydrationTTL   = 30 * 24 * time.Hour
+	maxRehydrationRange = 366 * 24 * time.Hour
+	insertBatchSize     = 500
+)
+
+// ErrNotConfigured is returned when rehydration is requested without an
+// archive target.
+var ErrNotConfigured = errors.New("cold archive is not configured (set ARCHIVE_TARGET)")
+
+type RehydrationStatus string
+
+const (
+	RehydrationPending RehydrationStatus = "pending"
+	RehydrationRunning RehydrationStatus = "running"
+	RehydrationReady   RehydrationStatus = "ready"
+	RehydrationFailed  RehydrationStatus = "failed"
+	RehydrationExpired RehydrationStatus = "expired"
+)
+
+// Rehydration is one request to restore a project's archived events for a
+// time range into audits_rehydrated. The record is kept after expiry as a
+// trail of who looked at archived data.
+type Rehydration struct {
+	ID          string            `json:"id"           gorm:"primaryKey"`
+	ProjectID   string            `json:"project_id"`
+	FromTime    time.Time         `json:"from"         gorm:"column:from_time"`
+	ToTime      time.Time         `json:"to"           gorm:"column:to_time"`
+	Status      RehydrationStatus `json:"status"`
+	Files       int               `json:"files"`
+	RowCount    int64             `json:"row_count"`
+	Error       string            `json:"error,omitempty"`
+	RequestedBy string            `json:"requested_by"`
+	ExpiresAt   time.Time         `json:"expires_at"`
+	CreatedAt   time.Time         `json:"created_at"`
+	CompletedAt *time.Time        `json:"completed_at,omitempty"`
+}
+
+func (Rehydration) TableName() string { return "rehydrations" }
+
+// rehydratedEvent is an archived event restored into audits_rehydrated.
+type rehydratedEvent struct {
+	audit.Audit
+	RehydrationID string
+	ExpiresAt     time.Time
+}
+
+func (rehydratedEvent) TableName() string { return "audits_rehydrated" }
+
+// Rehydrator restores archived events into audits_rehydrated.
+type Rehydrator struct {
+	db       *gorm.DB
+	store    Store // nil = archive not configured
+	ttl      time.Duration
+	maxRows  int64
+	redactor Redactor // nil = events are restored as archived
+}
+
+// Redactor erases personal data from restored events before they are stored,
+// for subjects whose erasure was requested after the events were archived.
+// Implemented by erasure.Redactor.
+type Redactor interface {
+	Redact(ctx context.Context, projectID string, events []audit.Audit) error
+}
+
+func NewRehydrator(db *gorm.DB, store Store) *Rehydrator {
+	return &Rehydrator{db: db, store: store, ttl: DefaultRehydrationTTL, maxRows: DefaultRehydrationMaxRows}
+}
+
+// WithTTL sets how long restored events stay queryable by default.
+func (r *Rehydrator) WithTTL(ttl time.Duration) *Rehydrator {
+	if ttl > 0 {
+		r.ttl = min(ttl, maxRehydrationTTL)
+	}
+	return r
+}
+
+// WithMaxRows caps how many events one rehydration may restore.
+func (r *Rehydrator) WithMaxRows(n int64) *Rehydrator {
+	if n > 0 {
+		r.maxRows = n
+	}
+	return r
+}
+
+// WithRedactor applies data-subject erasures to restored events.
+func (r *Rehydrator) WithRedactor(redactor Redactor) *Rehydrator {
+	r.redactor = redactor
+	return r
+}
+
+// NewRehydratorFromEnv builds a Rehydrator from ARCHIVE_TARGET,
+// ARCHIVE_REHYDRATE_TTL (default 72h) and ARCHIVE_REHYDRATE_MAX_ROWS (default
+// 1,000,000). Without ARCHIVE_TARGET, existing rehydrations can still be
+// listed and expired but new ones are refused.
+func NewRehydratorFromEnv(db *gorm.DB, getEnv func(string, string) string) (*Rehydrator, error) {
+	var store Store
+	if target := getEnv("ARCHIVE_TARGET", ""); target != "" {
+		var err error
+		if store, err = NewStore(target, getEnv); err != nil {
+			return nil, err
+		}
+	}
+	ttl, _ := time.ParseDuration(getEnv("ARCHIVE_REHYDRATE_TTL", ""))
+	maxRows, _ := strconv.ParseInt(getEnv("ARCHIVE_REHYDRATE_MAX_ROWS", ""), 10, 64)
+	return NewRehydrator(db, store).WithTTL(ttl).WithMaxRows(maxRows), nil
+}
+
+// Request validates and records a rehydration of [from, to] for a project.
+// A zero ttl uses the default. Call Run to restore the events.
+func (r *Rehydrator) Request(projectID string, from, to time.Time, ttl time.Duration, requestedBy string) (*Rehydration, error) {
+	if r.store == nil {
+		return nil, ErrNotConfigured
+	}
+	if projectID == "" {
+		return nil, errors.New("project_id required")
+	}
+	from, to = from.UTC(), to.UTC()
+	if !to.After(from) {
+		return nil, errors.New("to must be after from")
+	}
+	if to.Sub(from) > maxRehydrationRange {
+		return nil, errors.New("time range must not exceed 366 days")
+	}
+	if ttl <= 0 {
+		ttl = r.ttl
+	}
+	if ttl > maxRehydrationTTL {
+		return nil, errors.New("ttl must not exceed 30 days")
+	}
+
+	now := time.Now().UTC()
+	reh := &Rehydration{
+		ID:          uuid.New().String(),
+		ProjectID:   projectID,
+		FromTime:    from,
+		ToTime:      to,
+		Status:      RehydrationPending,
+		RequestedBy: requestedBy,
+		ExpiresAt:   now.Add(ttl),
+		CreatedAt:   now,
+	}
+	if err := r.db.Create(reh).Error; err != nil {
+		return nil, err
+	}
+	return reh, nil
+}
+
+// Run restores the events of a requested rehydration and records the outcome.
+func (r *Rehydrator) Run(ctx context.Context, reh *Rehydration) error {
+	reh.Status = RehydrationRunning
+	r.db.Model(reh).Update("status", reh.Status)
+
+	files, rows, err := r.restore(ctx, reh)
+	now := time.Now().UTC()
+	reh.Files, reh.RowCount, reh.CompletedAt = files, rows, &now
+	reh.Status = RehydrationReady
+	if err != nil {
+		reh.Status, reh.Error = RehydrationFailed, err.Error()
+		// A partial restore would look complete; drop it.
+		r.db.Where("rehydration_id = ?", reh.ID).Delete(&rehydratedEvent{})
+		reh.RowCount = 0
+	}
+	if uerr := r.db.Model(reh).Updates(map[string]any{
+		"status":       reh.Status,
+		"files":        reh.Files,
+		"row_count":    reh.RowCount,
+		"error":        reh.Error,
+		"completed_at": reh.CompletedAt,
+	}).Error; uerr != nil && err == nil {
+		err = uerr
+	}
+
+	slog.Info("archive: rehydration finished",
+		"id", reh.ID, "project_id", reh.ProjectID, "status", reh.Status, "files", files, "rows", rows)
+	return err
+}
+
+// restore walks the project's archive day by day, loading every file whose
+// manifest overlaps the range. Files are verified against their manifest
+// before use. Events already restored by this rehydration (an event archived
+// twice) are skipped.
+func (r *Rehydrator) restore(ctx context.Context, reh *Rehydration) (int, int64, error) {
+	var (
+		files int
+		rows  int64
+	)
+	for day := reh.FromTime.Truncate(24 * time.Hour); !day.After(reh.ToTime); day = day.Add(24 * time.Hour) {
+		keys, err := r.store.List(ctx, dayPrefix(reh.ProjectID, day))
+		if err != nil {
+			return files, rows, err
+		}
+		for _, key := range keys {
+			if !strings.HasSuffix(key, manifestSuffix) {
+				continue
+			}
+			n, used, err := r.restoreFile(ctx, reh, key)
+			if err != nil {
+				return files, rows, err
+			}
+			if used {
+				files++
+			}
+			rows += n
+			if rows > r.maxRows {
+				return files, rows, fmt.Errorf("more than %d events in range; narrow it and try again", r.maxRows)
+			}
+		}
+	}
+	return files, rows, nil
+}
+
+func (r *Rehydrator) restoreFile(ctx context.Context, reh *Rehydration, manifestKey string) (int64, bool, error) {
+	m, err := readManifest(ctx, r.store, manifestKey)
+	if err != nil {
+		return 0, false, err
+	}
+	if m.To.Before(reh.FromTime) || m.From.After(reh.ToTime) {
+		return 0, false, nil
+	}
+
+	events, err := readFile(ctx, r.store, m)
+	if err != nil {
+		return 0, false, err
+	}
+	if r.redactor != nil {
+		if err := r.redactor.Redact(ctx, reh.ProjectID, events); err != nil {
+			return 0, false, err
+		}
+	}
+
+	batch := make([]rehydratedEvent, 0, insertBatchSize)
+	var inserted int64
+	flush := func() error {
+		if len(batch) == 0 {
+			return nil
+		}
+		res := r.db.WithContext(ctx).Clauses(clause.OnConflict{DoNothing: true}).Create(&batch)
+		inserted += res.RowsAffected
+		batch = batch[:0]
+		return res.Error
+	}
+	for _, ev := range events {
+		if ev.Timestamp.Before(reh.FromTime) || ev.Timestamp.After(reh.ToTime) {
+			continue
+		}
+		batch = append(batch, rehydratedEvent{Audit: ev, RehydrationID: reh.ID, ExpiresAt: reh.ExpiresAt})
+		if len(batch) == insertBatchSize {
+			if err := flush(); err != nil {
+				return inserted, true, err
+			}
+		}
+	}
+	return inserted, true, flush()
+}
+
+// List returns a project's rehydrations, newest first.
+func (r *Rehydrator) List(projectID string) ([]Rehydration, error) {
+	var list []Rehydration
+	err := r.db.Where("project_id = ?", projectID).Order("created_at DESC").Find(&list).Error
+	return list, err
+}
+
+func (r *Rehydrator) Get(id, projectID string) (*Rehydration, error) {
+	var reh Rehydration
+	if err := r.db.Where("id = ? AND project_id = ?", id, projectID).First(&reh).Error; err != nil {
+		return nil, err
+	}
+	return &reh, nil
+}
+
+// Expire removes a rehydration's events now instead of waiting for its TTL.
+func (r *Rehydrator) Expire(id string) error {
+	return expire(r.db, []string{id})
+}
+
+func expire(db *gorm.DB, ids []string) error {
+	return db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("rehydration_id IN ?", ids).Delete(&rehydratedEvent{}).Error; err != nil {
+			return err
+		}
+		return tx.Model(&Rehydration{}).Where("id IN ?", ids).
+			Updates(map[string]any{"status": RehydrationExpired, "expires_at": time.Now().UTC()}).Error
+	})
+}
+
+// staleAfter marks a rehydration still pending or running after this long as
+// interrupted (e.g. the Reader restarted mid-restore).
+const staleAfter = 6 * time.Hour
+
+// Janitor deletes rehydrated events once their TTL has passed.
+type Janitor struct {
+	db    *gorm.DB
+	every time.Duration
+}
+
+func NewJanitor(db *gorm.DB) *Janitor {
+	return &Janitor{db: db, every: 10 * time.Minute}
+}
+
+// Start blocks until ctx is cancelled, sweeping periodically.
+func (j *Janitor) Start(ctx context.Context) {
+	ticker := time.NewTicker(j.every)
+	defer ticker.Stop()
+	for {
+		if n, err := j.Sweep(ctx); err != nil {
+			slog.Error("archive: rehydration sweep failed", "error", err)
+		} else if n > 0 {
+			slog.Info("archive: rehydrations expired", "count", n)
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// Sweep expires rehydrations past their TTL and fails stale ones. Returns the
+// number expired.
+func (j *Janitor) Sweep(ctx context.Context) (int, error) {
+	db := j.db.WithContext(ctx)
+	now := time.Now().UTC()
+
+	var stale []string
+	if err := db.Model(&Rehydration{}).
+		Where("status IN ? AND created_at < ?", []RehydrationStatus{RehydrationPending, RehydrationRunning}, now.Add(-staleAfter)).
+		Pluck("id", &stale).Error; err != nil {
+		return 0, err
+	}
+	if len(stale) > 0 {
+		// Same as a failed Run: partial restores are dropped.
+		err := db.Transaction(func(tx *gorm.DB) error {
+			if err := tx.Where("rehydration_id IN ?", stale).Delete(&rehydratedEvent{}).Error; err != nil {
+				return err
+			}
+			return tx.Model(&Rehydration{}).Where("id IN ?", stale).
+				Updates(map[string]any{"status": RehydrationFailed, "error": "interrupted", "row_count": 0}).Error
+		})
+		if err != nil {
+			return 0, err
+		}
+	}
+
+	var ids []string
+	if err := db.Model(&Rehydration{}).
+		Where("status NOT IN ? AND expires_at < ?", []RehydrationStatus{RehydrationExpired, RehydrationFailed}, now).
+		Pluck("id", &ids).Error; err != nil {
+		return 0, err
+	}
+	if len(ids) == 0 {
+		return 0, nil
+	}
+	return len(ids), expire(db, ids)
+}
@@ -0,0 +1,69 @@
+package archive
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"github.com/joaovrmoraes/bataudit/internal/audit"
+)
+
+func readManifest(ctx context.Context, store Store, key string) (Manifest, error) {
+	var m Manifest
+	raw, err := store.Get(ctx, key)
+	if err != nil {
+		return m, err
+	}
+	if err := json.Unmarshal(raw, &m); err != nil {
+		return m, fmt.Errorf("%s: %w", key, err)
+	}
+	return m, nil
+}
+
+// readFile loads the events of an archive file after checking it against its
+// manifest.
+func readFile(ctx context.Context, store Store, m Manifest) ([]audit.Audit, error) {
+	data, err := store.Get(ctx, m.Object)
+	if err != nil {
+		return nil, err
+	}
+	if len(data) != m.Bytes || sha256Hex(data) != m.SHA256 {
+		return nil, fmt.Errorf("%s: checksum does not match its manifest", m.Object)
+	}
+	events, err := decode(data)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", m.Object, err)
+	}
+	return events, nil
+}
+
+// Scan calls fn with the events of each of a project's archive files, oldest
+// day first. Every file is verified against its manifest before use. An event
+// archived twice is passed twice.
+func Scan(ctx context.Context, store Store, projectID string, fn func(events []audit.Audit) error) error {
+	keys, err := store.List(ctx, projectPrefix(projectID))
+	if err != nil {
+		return err
+	}
+	for _, key := range keys {
+		if !strings.HasSuffix(key, manifestSuffix) {
+			continue
+		}
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		m, err := readManifest(ctx, store, key)
+		if err != nil {
+			return err
+		}
+		events, err := readFile(ctx, store, m)
+		if err != nil {
+			return err
+		}
+		if err := fn(events); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,64 @@
+package archive
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/url"
+	"strings"
+)
+
+var (
+	// ErrExists is returned by Store.Put when the key is already taken.
+	// Archive objects are never overwritten.
+	ErrExists = errors.New("archive: object already exists")
+	// ErrNotFound is returned by Store.Get for a missing key.
+	ErrNotFound = errors.New("archive: object not found")
+)
+
+// Store is write-once object storage for archive files. Keys are
+// slash-separated paths.
+type Store interface {
+	// Put stores data under key, failing with ErrExists if key is taken.
+	Put(ctx context.Context, key string, data []byte) error
+	Get(ctx context.Context, key string) ([]byte, error)
+	// List returns the keys under prefix, sorted.
+	List(ctx context.Context, prefix string) ([]string, error)
+	// Describe identifies the store in logs, without credentials.
+	Describe() string
+}
+
+// NewStore builds a Store from a target URL:
+//
+//	file:///var/lib/bataudit/archive
+//	s3://bucket/optional/prefix
+//
+// S3 settings (endpoint, region, credentials) are read through getEnv.
+func NewStore(target string, getEnv func(string, string) string) (Store, error) {
+	u, err := url.Parse(target)
+	if err != nil {
+		return nil, fmt.Errorf("archive: invalid target %q: %w", target, err)
+	}
+	switch u.Scheme {
+	case "file", "":
+		dir := u.Path
+		if u.Scheme == "" {
+			dir = target
+		}
+		return NewLocalStore(dir)
+	case "s3":
+		if u.Host == "" {
+			return nil, fmt.Errorf("archive: %q has no bucket", target)
+		}
+		return NewS3Store(S3Config{
+			Endpoint:  getEnv("ARCHIVE_S3_ENDPOINT", ""),
+			Region:    getEnv("ARCHIVE_S3_REGION", "us-east-1"),
+			Bucket:    u.Host,
+			Prefix:    strings.Trim(u.Path, "/"),
+			AccessKey: getEnv("ARCHIVE_S3_ACCESS_KEY", ""),
+			SecretKey: getEnv("ARCHIVE_S3_SECRET_KEY", ""),
+		})
+	default:
+		return nil, fmt.Errorf("archive: unsupported target scheme %q (want file:// or s3://)", u.Scheme)
+	}
+}
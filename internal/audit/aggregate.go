@@ -0,0 +1,705 @@
+package audit
+
+import (
+	"fmt"
+	"slices"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/joaovrmoraes/bataudit/internal/dialect"
+	"github.com/joaovrmoraes/bataudit/internal/latency"
+)
+
+// Aggregation answers dashboard questions (volume per service per hour, error
+// rate per route, p95 per tenant...) with one generic query instead of a
+// repository method each. Metrics, dimensions and intervals are names from
+// fixed tables below, compiled to fixed SQL expressions; every value is
+// bound, so a request can never inject SQL.
+//
+// Raw events older than their retention are deleted by tiering, leaving
+// hourly and daily summaries per project and service, and latency sketches
+// per route. A query these can answer reads them for the hours tiering has
+// summarized and raw events after: counts and errors from the summaries, the
+// latency distribution from the sketches. Other queries read raw events only
+// and report from when those are complete (AggregateResult.RawSince).
+
+const (
+	defaultAggregateRows = 1000
+	maxAggregateRows     = 10000
+)
+
+// aggregateDimensions maps group-by dimensions to their expression on audits.
+var aggregateDimensions = map[string]string{
+	"service":      "service_name",
+	"route":        "path",
+	"method":       "method",
+	"status_class": "CASE WHEN status_code >= 500 THEN '5xx' WHEN status_code >= 400 THEN '4xx' WHEN status_code >= 300 THEN '3xx' WHEN status_code >= 200 THEN '2xx' ELSE 'other' END",
+	"environment":  "environment",
+	"tenant":       "COALESCE(tenant_id, '')",
+	"user_type":    "COALESCE(user_type, '')",
+	"source":       "COALESCE(NULLIF(source, ''), 'backend')",
+}
+
+// aggregatePercentiles are the latency percentiles a query may ask for.
+var aggregatePercentiles = map[string]float64{
+	"p50_latency": 0.5,
+	"p90_latency": 0.9,
+	"p95_latency": 0.95,
+	"p99_latency": 0.99,
+}
+
+// aggregateMetrics lists every metric; percentiles are in
+// aggregatePercentiles.
+var aggregateMetrics = []string{
+	"count", "error_count", "error_rate", "avg_latency", "max_latency", "distinct_identifiers",
+	"p50_latency", "p90_latency", "p95_latency", "p99_latency",
+}
+
+// aggregateIntervals maps bucket intervals to the minutes of a Bucket (0 for
+// a Trunc unit).
+var aggregateIntervals = map[string]int{
+	"minute": 0,
+	"5m":     5,
+	"15m":    15,
+	"hour":   0,
+	"day":    0,
+}
+
+// AggregateQuery is a request to POST /audit/aggregate.
+type AggregateQuery struct {
+	Metrics  []string // see aggregateMetrics; errors are status_code >= 400
+	GroupBy  []string // see aggregateDimensions
+	Interval string   // minute | 5m | 15m | hour | day; empty = no time buckets
+	Limit    int      // rows; 0 = defaultAggregateRows
+	// Filters are the list filters. EventType defaults to http: the metrics
+	// describe requests.
+	Filters ListFilters
+}
+
+// Validate checks metrics, dimensions and interval against the known names
+// and applies the defaults.
+func (q *AggregateQuery) Validate() error {
+	if len(q.Metrics) == 0 {
+		return fmt.Errorf("metrics required: %s", strings.Join(aggregateMetrics, ", "))
+	}
+	for _, m := range q.Metrics {
+		if !slices.Contains(aggregateMetrics, m) {
+			return fmt.Errorf("unknown metric %q: expected one of %s", m, strings.Join(aggregateMetrics, ", "))
+		}
+	}
+	seen := map[string]bool{}
+	for _, g := range q.GroupBy {
+		if _, ok := aggregateDimensions[g]; !ok {
+			return fmt.Errorf("unknown group_by %q: expected service, route, method, status_class, environment, tenant, user_type or source", g)
+		}
+		if seen[g] {
+			return fmt.Errorf("duplicate group_by %q", g)
+		}
+		seen[g] = true
+	}
+	if _, ok := aggregateIntervals[q.Interval]; !ok && q.Interval != "" {
+		return fmt.Errorf("unknown interval %q: expected minute, 5m, 15m, hour or day", q.Interval)
+	}
+	if q.Limit < 0 || q.Limit > maxAggregateRows {
+		return fmt.Errorf("limit must be between 1 and %d", maxAggregateRows)
+	}
+	if q.Limit == 0 {
+		q.Limit = defaultAggregateRows
+	}
+	if q.Filters.EventType == "" {
+		q.Filters.EventType = "http"
+	}
+	return nil
+}
+
+// AggregateRow is one group of an aggregation.
+type AggregateRow struct {
+	Bucket  *time.Time         `json:"bucket,omitempty"` // start of the interval
+	Group   map[string]string  `json:"group,omitempty"`  // dimension -> value
+	Metrics map[string]float64 `json:"metrics"`
+}
+
+// AggregateResult is the answer to an AggregateQuery, ordered by bucket, then
+// by count descending.
+type AggregateResult struct {
+	Rows []AggregateRow `json:"rows"`
+	// Tiers lists what was read: raw events, tiering summaries or both.
+	// Summaries resolve to whole hours or days.
+	Tiers []string `json:"tiers"`
+	// RawSince is set when the query needed raw events tiering has already
+	// summarized and deleted, and the summaries cannot answer it: rows before
+	// it may be missing events.
+	RawSince  *time.Time `json:"raw_since,omitempty"`
+	Truncated bool       `json:"truncated,omitempty"` // more than Limit rows
+}
+
+// aggregateRow is a group as scanned from either tier: the sums its metrics
+// derive from, so groups of both tiers can merge.
+type aggregateRow struct {
+	Bucket      dialect.Time `gorm:"column:bucket"`
+	Service     string       `gorm:"column:g_service"`
+	Route       string       `gorm:"column:g_route"`
+	Method      string       `gorm:"column:g_method"`
+	StatusClass string       `gorm:"column:g_status_class"`
+	Environment string       `gorm:"column:g_environment"`
+	Tenant      string       `gorm:"column:g_tenant"`
+	UserType    string       `gorm:"column:g_user_type"`
+	Source      string       `gorm:"column:g_source"`
+
+	Count      int64    `gorm:"column:event_count"`
+	Errors     int64    `gorm:"column:error_count"`
+	LatencySum float64  `gorm:"column:latency_sum"`
+	LatencyMax float64  `gorm:"column:latency_max"`
+	Distinct   int64    `gorm:"column:distinct_identifiers"`
+	P50        *float64 `gorm:"column:p50_latency"`
+	P90        *float64 `gorm:"column:p90_latency"`
+	P95        *float64 `gorm:"column:p95_latency"`
+	P99        *float64 `gorm:"column:p99_latency"`
+}
+
+func (row *aggregateRow) dimension(name string) string {
+	switch name {
+	case "service":
+		return row.Service
+	case "route":
+		return row.Route
+	case "method":
+		return row.Method
+	case "status_class":
+		return row.StatusClass
+	case "environment":
+		return row.Environment
+	case "tenant":
+		return row.Tenant
+	case "user_type":
+		return row.UserType
+	default:
+		return row.Source
+	}
+}
+
+func (row *aggregateRow) percentile(metric string) *float64 {
+	switch metric {
+	case "p50_latency":
+		return row.P50
+	case "p90_latency":
+		return row.P90
+	case "p95_latency":
+		return row.P95
+	default:
+		return row.P99
+	}
+}
+
+// merge adds other, the same group from the summaries, to row. Only the
+// counts are merged: the latency distribution comes from the sketches (see
+// withLatency).
+func (row *aggregateRow) merge(other aggregateRow) {
+	row.Count += other.Count
+	row.Errors += other.Errors
+	row.LatencySum += other.LatencySum
+}
+
+// summaryTiers reports which tiering tables can answer q over summarized
+// periods. The summaries are per project, service and hour or day, with the
+// count, status class counts and average latency of HTTP events; the latency
+// sketches are per route, with the count and the latency distribution. A
+// query may need both, or neither can answer it.
+func (q AggregateQuery) summaryTiers() (summaries, sketches bool) {
+	f := q.Filters
+	if f.Rehydrated || f.EventType != "http" || f.Identifier != "" || f.StatusCode != 0 ||
+		f.StatusClass != "" || f.Environment != "" || f.TraceID != "" || f.Search != "" || len(f.Fields) > 0 {
+		return false, false
+	}
+	if q.Interval != "" && q.Interval != "hour" && q.Interval != "day" {
+		return false, false
+	}
+	byService, byRoute := true, true
+	for _, g := range q.GroupBy {
+		byService = byService && g == "service"
+		byRoute = byRoute && (g == "service" || g == "route" || g == "method")
+	}
+	errorMetrics, distribution := false, false
+	for _, m := range q.Metrics {
+		switch m {
+		case "count", "avg_latency":
+		case "error_count", "error_rate":
+			errorMetrics = true
+		case "max_latency":
+			distribution = true
+		case "distinct_identifiers":
+			return false, false
+		default: // percentiles
+			distribution = true
+		}
+	}
+	switch {
+	case byService && f.Method == "" && f.Path == "":
+		return true, distribution
+	case byRoute && !errorMetrics:
+		return false, true
+	}
+	return false, false
+}
+
+// Aggregate runs q, which must be valid.
+func (r *repository) Aggregate(q AggregateQuery) (*AggregateResult, error) {
+	result := &AggregateResult{Rows: []AggregateRow{}, Tiers: []string{"raw"}}
+
+	summarized, err := r.summarizedUntil("audit_summaries", q.Filters.ProjectID)
+	if err != nil {
+		return nil, err
+	}
+	sketched, err := r.summarizedUntil("audit_latency_sketches", q.Filters.ProjectID)
+	if err != nil {
+		return nil, err
+	}
+	// Only projects whose summaries reach into the range matter.
+	for _, ends := range []map[string]time.Time{summarized, sketched} {
+		for project, until := range ends {
+			if q.Filters.StartDate != nil && !until.After(*q.Filters.StartDate) {
+				delete(ends, project)
+			}
+		}
+	}
+	useSummaries, useSketches := q.summaryTiers()
+	if len(summarized) == 0 && len(sketched) == 0 {
+		useSummaries, useSketches = false, false
+	}
+	// Periods summarized before latency sketches were kept have none.
+	var rawSince time.Time
+	for project, until := range summarized {
+		answered := (useSummaries || useSketches) && !(useSketches && sketched[project].Before(until))
+		if !answered && until.After(rawSince) {
+			rawSince = until
+		}
+	}
+	if !rawSince.IsZero() {
+		result.RawSince = &rawSince
+	}
+
+	var rows []aggregateRow
+	switch {
+	case useSummaries:
+		raw := q
+		raw.Metrics = slices.DeleteFunc(slices.Clone(q.Metrics), func(m string) bool {
+			_, ok := aggregatePercentiles[m]
+			return ok
+		})
+		rawRows, truncated, err := r.aggregateRaw(raw, summarized, true)
+		if err != nil {
+			return nil, err
+		}
+		summaryRows, summaryTruncated, err := r.aggregateSummaries(q)
+		if err != nil {
+			return nil, err
+		}
+		result.Truncated = truncated || summaryTruncated
+		rows = mergeAggregateRows(q, append(summaryRows, rawRows...))
+		if useSketches {
+			latencyRows, err := r.aggregateSketches(q, sketched)
+			if err != nil {
+				return nil, err
+			}
+			withLatency(q, rows, latencyRows)
+		}
+		result.Tiers = []string{"summary", "raw"}
+	case useSketches:
+		if rows, err = r.aggregateSketches(q, sketched); err != nil {
+			return nil, err
+		}
+		result.Tiers = []string{"summary", "raw"}
+	default:
+		if rows, result.Truncated, err = r.aggregateRaw(q, summarized, false); err != nil {
+			return nil, err
+		}
+	}
+
+	sort.SliceStable(rows, func(i, j int) bool {
+		if !rows[i].Bucket.Equal(rows[j].Bucket.Time) {
+			return rows[i].Bucket.Before(rows[j].Bucket.Time)
+		}
+		return rows[i].Count > rows[j].Count
+	})
+	if len(rows) > q.Limit {
+		rows = rows[:q.Limit]
+		result.Truncated = true
+	}
+	for i := range rows {
+		result.Rows = append(result.Rows, q.render(&rows[i]))
+	}
+	return result, nil
+}
+
+// summarizedUntil returns, per project, the end of the newest period tiering
+// wrote to table (audit_summaries or audit_latency_sketches): raw events
+// before it are counted there, and may have been deleted.
+func (r *repository) summarizedUntil(table, projectID string) (map[string]time.Time, error) {
+	query := r.db.Table(table).
+		Select("project_id, period_type, MAX(period_start) AS period_start").
+		Group("project_id, period_type")
+	if projectID != "" {
+		query = query.Where("project_id = ?", projectID)
+	}
+	var periods []summarizedPeriod
+	if err := query.Scan(&periods).Error; err != nil {
+		return nil, err
+	}
+	return summaryEnds(periods), nil
+}
+
+// summarizedPeriod is the newest period of one type summarized for a project.
+type summarizedPeriod struct {
+	ProjectID   string       `gorm:"column:project_id"`
+	PeriodType  string       `gorm:"column:period_type"`
+	PeriodStart dialect.Time `gorm:"column:period_start"`
+}
+
+// summaryEnds returns, per project, where its summaries end. Hours are
+// folded into their day from an hourly cutoff, so a day may only be
+// summarized in part: its end counts only without hourly rows.
+func summaryEnds(periods []summarizedPeriod) map[string]time.Time {
+	until := map[string]time.Time{}
+	for _, p := range periods {
+		if p.PeriodType == "hour" {
+			until[p.ProjectID] = p.PeriodStart.Add(time.Hour).UTC()
+		}
+	}
+	for _, p := range periods {
+		if _, ok := until[p.ProjectID]; !ok && p.PeriodType == "day" {
+			until[p.ProjectID] = p.PeriodStart.AddDate(0, 0, 1).UTC()
+		}
+	}
+	return until
+}
+
+// bucketExpr returns the expression truncating column to q's interval.
+func (q AggregateQuery) bucketExpr(d dialect.Dialect, column string) string {
+	if minutes := aggregateIntervals[q.Interval]; minutes > 0 {
+		return d.Bucket(minutes, column)
+	}
+	return d.Trunc(q.Interval, column)
+}
+
+// aggregateRaw aggregates raw events. With skipSummarized, the events of
+// each project before its summarized period end are left to the summaries.
+func (r *repository) aggregateRaw(q AggregateQuery, summarized map[string]time.Time, skipSummarized bool) ([]aggregateRow, bool, error) {
+	d := dialect.Of(r.db)
+	query, err := r.filtered(q.Filters)
+	if err != nil {
+		return nil, false, err
+	}
+	if skipSummarized {
+		for project, until := range summarized {
+			query = query.Where("(project_id IS NULL OR project_id != ? OR timestamp >= ?)", project, until)
+		}
+	}
+
+	var selects, groups []string
+	if q.Interval != "" {
+		selects = append(selects, q.bucketExpr(d, "timestamp")+" AS bucket")
+		groups = append(groups, q.bucketExpr(d, "timestamp"))
+	}
+	for _, g := range q.GroupBy {
+		selects = append(selects, aggregateDimensions[g]+" AS g_"+g)
+		groups = append(groups, aggregateDimensions[g])
+	}
+	selects = append(selects,
+		"COUNT(*) AS event_count",
+		"COUNT(CASE WHEN status_code >= 400 THEN 1 END) AS error_count",
+		"COALESCE(SUM(response_time), 0) AS latency_sum",
+		"COALESCE(MAX(response_time), 0) AS latency_max")
+	for _, m := range q.Metrics {
+		if p, ok := aggregatePercentiles[m]; ok {
+			selects = append(selects, d.Percentile(p, "response_time")+" AS "+m)
+		}
+		if m == "distinct_identifiers" {
+			selects = append(selects, "COUNT(DISTINCT CASE WHEN identifier != 'anonymous' THEN identifier END) AS distinct_identifiers")
+		}
+	}
+
+	query = query.Select(strings.Join(selects, ", "))
+	if len(groups) > 0 {
+		query = query.Group(strings.Join(groups, ", "))
+	}
+	if q.Interval != "" {
+		query = query.Order("bucket")
+	}
+	var rows []aggregateRow
+	if err := query.Order("event_count DESC").Limit(q.Limit + 1).Scan(&rows).Error; err != nil {
+		return nil, false, err
+	}
+	// Without groups, an empty range still yields one row of zeroes.
+	if len(rows) == 1 && rows[0].Count == 0 {
+		return nil, false, nil
+	}
+	return rows, len(rows) > q.Limit, nil
+}
+
+// aggregateSummaries aggregates the tiering summaries in q's range. A summary
+// is in the range when its period starts in it.
+func (r *repository) aggregateSummaries(q AggregateQuery) ([]aggregateRow, bool, error) {
+	d := dialect.Of(r.db)
+	query := r.db.Table("audit_summaries")
+	if q.Filters.ProjectID != "" {
+		query = query.Where("project_id = ?", q.Filters.ProjectID)
+	}
+	if q.Filters.ServiceName != "" {
+		query = query.Where("service_name = ?", q.Filters.ServiceName)
+	}
+	if q.Filters.StartDate != nil {
+		query = query.Where("period_start >= ?", q.Filters.StartDate)
+	}
+	if q.Filters.EndDate != nil {
+		query = query.Where("period_start <= ?", q.Filters.EndDate)
+	}
+
+	var selects, groups []string
+	if q.Interval != "" {
+		selects = append(selects, q.bucketExpr(d, "period_start")+" AS bucket")
+		groups = append(groups, q.bucketExpr(d, "period_start"))
+	}
+	if slices.Contains(q.GroupBy, "service") {
+		selects = append(selects, "service_name AS g_service")
+		groups = append(groups, "service_name")
+	}
+	selects = append(selects,
+		"COALESCE(SUM(event_count), 0) AS event_count",
+		"COALESCE(SUM(status_4xx + status_5xx), 0) AS error_count",
+		"COALESCE(SUM(avg_ms * event_count), 0) AS latency_sum")
+
+	query = query.Select(strings.Join(selects, ", "))
+	if len(groups) > 0 {
+		query = query.Group(strings.Join(groups, ", "))
+	}
+	if q.Interval != "" {
+		query = query.Order("bucket")
+	}
+	var rows []aggregateRow
+	if err := query.Order("event_count DESC").Limit(q.Limit + 1).Scan(&rows).Error; err != nil {
+		return nil, false, err
+	}
+	if len(rows) == 1 && rows[0].Count == 0 {
+		return nil, false, nil
+	}
+	return rows, len(rows) > q.Limit, nil
+}
+
+// aggregateSketches aggregates the latency sketches in q's range and the raw
+// events after them into one sketch per bucket and group, so the latency
+// distribution of each row is that of all its events. A sketch is in the
+// range when its period starts in it.
+func (r *repository) aggregateSketches(q AggregateQuery, sketched map[string]time.Time) ([]aggregateRow, error) {
+	var keys []string
+	groups := map[string]*aggregateRow{}
+	sketches := map[string]*latency.Sketch{}
+	sketchOf := func(row aggregateRow) *latency.Sketch {
+		key := q.rowKey(&row)
+		if sketches[key] == nil {
+			keys = append(keys, key)
+			groups[key] = &row
+			sketches[key] = latency.New()
+		}
+		return sketches[key]
+	}
+	// Only the dimensions q groups by.
+	group := func(bucket time.Time, service, method, path string) aggregateRow {
+		row := aggregateRow{Bucket: dialect.Time{Time: bucket}}
+		for _, g := range q.GroupBy {
+			switch g {
+			case "service":
+				row.Service = service
+			case "route":
+				row.Route = path
+			case "method":
+				row.Method = method
+			}
+		}
+		return row
+	}
+
+	if len(sketched) > 0 {
+		query := r.db.Table("audit_latency_sketches").
+			Select("period_start, service_name, method, path, event_count, sum_ms, max_ms, buckets")
+		query = latencyFilter(query, LatencyFilters{
+			ProjectID:   q.Filters.ProjectID,
+			ServiceName: q.Filters.ServiceName,
+			Method:      q.Filters.Method,
+			Path:        q.Filters.Path,
+			StartDate:   q.Filters.StartDate,
+			EndDate:     q.Filters.EndDate,
+		}, "period_start")
+		var stored []struct {
+			PeriodStart dialect.Time `gorm:"column:period_start"`
+			ServiceName string       `gorm:"column:service_name"`
+			Method      string       `gorm:"column:method"`
+			Path        string       `gorm:"column:path"`
+			EventCount  int64        `gorm:"column:event_count"`
+			SumMs       int64        `gorm:"column:sum_ms"`
+			MaxMs       int64        `gorm:"column:max_ms"`
+			Buckets     string       `gorm:"column:buckets"`
+		}
+		if err := query.Scan(&stored).Error; err != nil {
+			return nil, err
+		}
+		for _, row := range stored {
+			s, err := latency.Decode(row.Buckets, row.EventCount, row.SumMs, row.MaxMs)
+			if err != nil {
+				return nil, err
+			}
+			sketchOf(group(q.truncate(row.PeriodStart.Time), row.ServiceName, row.Method, row.Path)).Merge(s)
+		}
+	}
+
+	d := dialect.Of(r.db)
+	query, err := r.filtered(q.Filters)
+	if err != nil {
+		return nil, err
+	}
+	for project, until := range sketched {
+		query = query.Where("(project_id IS NULL OR project_id != ? OR timestamp >= ?)", project, until)
+	}
+	selects := []string{
+		"service_name", "method", "path",
+		latency.IndexExpr("response_time") + " AS latency_bucket",
+		"COUNT(*) AS event_count",
+		"COALESCE(SUM(response_time), 0) AS sum_ms",
+		"COALESCE(MAX(response_time), 0) AS max_ms",
+	}
+	groupBy := []string{"service_name", "method", "path", latency.IndexExpr("response_time")}
+	if q.Interval != "" {
+		selects = append(selects, q.bucketExpr(d, "timestamp")+" AS bucket")
+		groupBy = append(groupBy, q.bucketExpr(d, "timestamp"))
+	}
+	var raw []struct {
+		Bucket      dialect.Time `gorm:"column:bucket"`
+		ServiceName string       `gorm:"column:service_name"`
+		Method      string       `gorm:"column:method"`
+		Path        string       `gorm:"column:path"`
+		Index       int          `gorm:"column:latency_bucket"`
+		EventCount  int64        `gorm:"column:event_count"`
+		SumMs       int64        `gorm:"column:sum_ms"`
+		MaxMs       int64        `gorm:"column:max_ms"`
+	}
+	if err := query.Select(strings.Join(selects, ", ")).Group(strings.Join(groupBy, ", ")).Scan(&raw).Error; err != nil {
+		return nil, err
+	}
+	for _, row := range raw {
+		sketchOf(group(row.Bucket.UTC(), row.ServiceName, row.Method, row.Path)).
+			AddBucket(row.Index, row.EventCount, row.SumMs, row.MaxMs)
+	}
+
+	rows := make([]aggregateRow, 0, len(keys))
+	for _, key := range keys {
+		row, s := *groups[key], sketches[key]
+		if s.Count == 0 {
+			continue
+		}
+		row.Count = s.Count
+		row.LatencySum = float64(s.SumMs)
+		row.LatencyMax = float64(s.MaxMs)
+		quantile := func(p float64) *float64 {
+			v := s.Quantile(p)
+			return &v
+		}
+		row.P50, row.P90, row.P95, row.P99 = quantile(0.5), quantile(0.9), quantile(0.95), quantile(0.99)
+		rows = append(rows, row)
+	}
+	return rows, nil
+}
+
+// withLatency sets the latency distribution of rows from the rows of
+// aggregateSketches.
+func withLatency(q AggregateQuery, rows, latencyRows []aggregateRow) {
+	index := make(map[string]*aggregateRow, len(latencyRows))
+	for i := range latencyRows {
+		index[q.rowKey(&latencyRows[i])] = &latencyRows[i]
+	}
+	for i := range rows {
+		if l := index[q.rowKey(&rows[i])]; l != nil {
+			rows[i].LatencyMax = l.LatencyMax
+			rows[i].P50, rows[i].P90, rows[i].P95, rows[i].P99 = l.P50, l.P90, l.P95, l.P99
+		}
+	}
+}
+
+// truncate returns the start of the bucket of q's interval holding t, as
+// bucketExpr does in SQL for hours and days.
+func (q AggregateQuery) truncate(t time.Time) time.Time {
+	t = t.UTC()
+	switch q.Interval {
+	case "hour":
+		return t.Truncate(time.Hour)
+	case "day":
+		return time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, time.UTC)
+	}
+	return time.Time{}
+}
+
+// rowKey identifies the bucket and group of row.
+func (q AggregateQuery) rowKey(row *aggregateRow) string {
+	key := row.Bucket.UTC().Format(time.RFC3339)
+	for _, g := range q.GroupBy {
+		key += "\x00" + row.dimension(g)
+	}
+	return key
+}
+
+// mergeAggregateRows merges the rows of the same bucket and group.
+func mergeAggregateRows(q AggregateQuery, rows []aggregateRow) []aggregateRow {
+	index := map[string]int{}
+	merged := make([]aggregateRow, 0, len(rows))
+	for _, row := range rows {
+		key := q.rowKey(&row)
+		if i, ok := index[key]; ok {
+			merged[i].merge(row)
+			continue
+		}
+		index[key] = len(merged)
+		merged = append(merged, row)
+	}
+	return merged
+}
+
+// render picks the metrics q asked for out of row.
+func (q AggregateQuery) render(row *aggregateRow) AggregateRow {
+	out := AggregateRow{Metrics: make(map[string]float64, len(q.Metrics))}
+	if q.Interval != "" {
+		bucket := row.Bucket.UTC()
+		out.Bucket = &bucket
+	}
+	if len(q.GroupBy) > 0 {
+		out.Group = make(map[string]string, len(q.GroupBy))
+		for _, g := range q.GroupBy {
+			out.Group[g] = row.dimension(g)
+		}
+	}
+	for _, m := range q.Metrics {
+		var v float64
+		switch m {
+		case "count":
+			v = float64(row.Count)
+		case "error_count":
+			v = float64(row.Errors)
+		case "error_rate":
+			if row.Count > 0 {
+				v = float64(row.Errors) / float64(row.Count) * 100
+			}
+		case "avg_latency":
+			if row.Count > 0 {
+				v = row.LatencySum / float64(row.Count)
+			}
+		case "max_latency":
+			v = row.LatencyMax
+		case "distinct_identifiers":
+			v = float64(row.Distinct)
+		default:
+			if p := row.percentile(m); p != nil {
+				v = *p
+			}
+		}
+		out.Metrics[m] = v
+	}
+	return out
+}
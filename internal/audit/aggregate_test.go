@@ -0,0 +1,102 @@
+package audit
+
+import (
+	"testing"
+	"time"
+
+	"github.com/joaovrmoraes/bataudit/internal/dialect"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestAggregateQueryValidate(t *testing.T) {
+	q := AggregateQuery{Metrics: []string{"count"}, GroupBy: []string{"service", "route"}, Interval: "5m"}
+	require.NoError(t, q.Validate())
+	assert.Equal(t, defaultAggregateRows, q.Limit)
+	assert.Equal(t, "http", q.Filters.EventType)
+
+	for name, q := range map[string]AggregateQuery{
+		"no metrics":         {},
+		"unknown metric":     {Metrics: []string{"sum(response_time)"}},
+		"unknown dimension":  {Metrics: []string{"count"}, GroupBy: []string{"path; DROP TABLE audits"}},
+		"duplicate group_by": {Metrics: []string{"count"}, GroupBy: []string{"method", "method"}},
+		"unknown interval":   {Metrics: []string{"count"}, Interval: "week"},
+		"limit too high":     {Metrics: []string{"count"}, Limit: maxAggregateRows + 1},
+	} {
+		assert.Error(t, q.Validate(), name)
+	}
+}
+
+func TestAggregateQuerySummaryTiers(t *testing.T) {
+	query := func(edit func(*AggregateQuery)) AggregateQuery {
+		q := AggregateQuery{Metrics: []string{"count", "error_rate", "avg_latency"}, GroupBy: []string{"service"}, Interval: "day"}
+		edit(&q)
+		require.NoError(t, q.Validate())
+		return q
+	}
+	for name, tc := range map[string]struct {
+		edit                func(*AggregateQuery)
+		summaries, sketches bool
+	}{
+		"counts":      {func(q *AggregateQuery) {}, true, false},
+		"percentiles": {func(q *AggregateQuery) { q.Metrics = append(q.Metrics, "p99_latency") }, true, true},
+		"route": {func(q *AggregateQuery) {
+			q.Metrics, q.GroupBy = []string{"count", "p95_latency"}, []string{"route", "method"}
+		}, false, true},
+		"path filter":  {func(q *AggregateQuery) { q.Metrics, q.Filters.Path = []string{"max_latency"}, "/users" }, false, true},
+		"route errors": {func(q *AggregateQuery) { q.GroupBy = []string{"route"} }, false, false},
+		"distinct":     {func(q *AggregateQuery) { q.Metrics = []string{"distinct_identifiers"} }, false, false},
+		"minutes":      {func(q *AggregateQuery) { q.Interval = "15m" }, false, false},
+		"environment":  {func(q *AggregateQuery) { q.Filters.Environment = "production" }, false, false},
+		"alerts":       {func(q *AggregateQuery) { q.Filters.EventType = "system.alert" }, false, false},
+		"search":       {func(q *AggregateQuery) { q.Filters.Search = "timeout" }, false, false},
+		"field filter": {func(q *AggregateQuery) { q.Filters.Fields = []string{"body.plan=pro"} }, false, false},
+	} {
+		summaries, sketches := query(tc.edit).summaryTiers()
+		assert.Equal(t, [2]bool{tc.summaries, tc.sketches}, [2]bool{summaries, sketches}, name)
+	}
+}
+
+func TestMergeAggregateRows(t *testing.T) {
+	hour := time.Date(2024, 1, 15, 14, 0, 0, 0, time.UTC)
+	p95 := func(v float64) *float64 { return &v }
+	q := AggregateQuery{Metrics: []string{"count", "error_rate", "avg_latency", "p95_latency"}, GroupBy: []string{"service"}, Interval: "hour"}
+
+	rows := mergeAggregateRows(q, []aggregateRow{
+		{Service: "api", Count: 3, Errors: 1, LatencySum: 300},
+		{Service: "web", Count: 1, LatencySum: 50},
+		{Service: "api", Count: 1, Errors: 1, LatencySum: 100},
+	})
+	for i := range rows {
+		rows[i].Bucket.Time = hour
+	}
+	require.Len(t, rows, 2)
+	withLatency(q, rows, []aggregateRow{
+		{Bucket: dialect.Time{Time: hour}, Service: "api", Count: 4, P95: p95(190)},
+	})
+
+	out := q.render(&rows[0])
+	assert.Equal(t, map[string]string{"service": "api"}, out.Group)
+	assert.True(t, hour.Equal(*out.Bucket))
+	assert.Equal(t, map[string]float64{"count": 4, "error_rate": 50, "avg_latency": 100, "p95_latency": 190}, out.Metrics)
+	assert.Nil(t, rows[1].P95, "no sketch for web")
+}
+
+func TestSummaryEnds(t *testing.T) {
+	day := time.Date(2026, 10, 1, 0, 0, 0, 0, time.UTC)
+	period := func(project, kind string, start time.Time) summarizedPeriod {
+		return summarizedPeriod{ProjectID: project, PeriodType: kind, PeriodStart: dialect.Time{Time: start}}
+	}
+	ends := summaryEnds([]summarizedPeriod{
+		// p1's newest day is only folded up to 06:00; its hours go on.
+		period("p1", "day", day),
+		period("p1", "hour", day.Add(9*time.Hour)),
+		period("p2", "day", day),
+		period("p3", "hour", day.Add(23*time.Hour)),
+	})
+	assert.Equal(t, map[string]time.Time{
+		"p1": day.Add(10 * time.Hour),
+		"p2": day.AddDate(0, 0, 1),
+		"p3": day.AddDate(0, 0, 1),
+	}, ends)
+}
@@ -0,0 +1,340 @@
+package audit
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"math/big"
+	"time"
+
+	"github.com/joaovrmoraes/bataudit/internal/dialect"
+	"gorm.io/datatypes"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// Hash chain
+//
+// Every event the Worker stores is linked into its project's chain:
+//
+//	hash = SHA-256("bataudit-chain-v1\n" + prev_hash + "\n" + canonical(event))
+//
+// canonical is a fixed-order JSON encoding of the stored columns (see
+// canonicalEvent), so editing any column, or deleting or reordering events,
+// breaks the chain from that point on. Events removed on purpose (tiering,
+// archiving, partition drops) leave a ChainCheckpoint behind, which lets
+// verification step over them. Events whose personal data was erased keep
+// their original hash and carry erased_at, which is not hashed; verification
+// checks their links, and that a completed erasure covers them, but not
+// their content. Of a column encrypted by the
+// Worker, only the envelope's version and ID are hashed (see Sealed), so
+// rotating its data key does not break the chain.
+
+const chainVersion = "bataudit-chain-v1"
+
+// Checkpoint reasons.
+const (
+	CheckpointTiering       = "tiering"
+	CheckpointArchived      = "archived"
+	CheckpointPartitionDrop = "partition_drop"
+)
+
+// ChainHead is the last link of a project's chain. ProjectID is "" for events
+// without a project.
+type ChainHead struct {
+	ProjectID string `gorm:"primaryKey"`
+	Seq       int64
+	Hash      string
+	UpdatedAt time.Time
+}
+
+func (ChainHead) TableName() string { return "audit_chain_heads" }
+
+// ChainCheckpoint records a run of consecutive chain links that was removed
+// on purpose: PrevHash is what the first removed event linked to, LastHash the
+// hash of the last one.
+type ChainCheckpoint struct {
+	ID        int64     `json:"id"`
+	ProjectID string    `json:"project_id"`
+	FirstSeq  int64     `json:"first_seq"`
+	LastSeq   int64     `json:"last_seq"`
+	PrevHash  string    `json:"prev_hash"`
+	LastHash  string    `json:"last_hash"`
+	RowCount  int64     `json:"row_count"`
+	Reason    string    `json:"reason"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+func (ChainCheckpoint) TableName() string { return "audit_chain_checkpoints" }
+
+// canonicalEvent fixes the field order and names of the hashed content. The
+// chain hashes stored values, so it must only change together with
+// chainVersion — except for fields added with omitempty, which leave the
+// hash of events without them unchanged.
+type canonicalEvent struct {
+	ID           string          `json:"id"`
+	EventType    string          `json:"event_type"`
+	Method       string          `json:"method"`
+	Path         string          `json:"path"`
+	StatusCode   int             `json:"status_code"`
+	ResponseTime int64           `json:"response_time"`
+	Identifier   string          `json:"identifier"`
+	UserEmail    string          `json:"user_email"`
+	UserName     string          `json:"user_name"`
+	UserRoles    json.RawMessage `json:"user_roles"`
+	UserType     string          `json:"user_type"`
+	TenantID     string          `json:"tenant_id"`
+	IP           string          `json:"ip"`
+	UserAgent    string          `json:"user_agent"`
+	RequestID    string          `json:"request_id"`
+	QueryParams  json.RawMessage `json:"query_params"`
+	PathParams   json.RawMessage `json:"path_params"`
+	RequestBody  json.RawMessage `json:"request_body"`
+	ResponseBody json.RawMessage `json:"response_body"`
+	ErrorMessage string          `json:"error_message"`
+	Source       string          `json:"source"`
+	ServiceName  string          `json:"service_name"`
+	Environment  string          `json:"environment"`
+	Timestamp    string          `json:"timestamp"`
+	ProjectID    string          `json:"project_id"`
+	SessionID    string          `json:"session_id"`
+	ChainSeq     int64           `json:"chain_seq"`
+	TraceID      string          `json:"trace_id,omitempty"`
+	SpanID       string          `json:"span_id,omitempty"`
+	ParentSpanID string          `json:"parent_span_id,omitempty"`
+}
+
+// chainTimestamp is the timestamp as stored: UTC, microsecond precision.
+func chainTimestamp(t time.Time) time.Time {
+	return t.UTC().Truncate(time.Microsecond)
+}
+
+// canonicalContent encodes the hashed content of a.
+func canonicalContent(a *Audit) ([]byte, error) {
+	ev := canonicalEvent{
+		ID:           a.ID,
+		EventType:    a.EventType,
+		Method:       string(a.Method),
+		Path:         a.Path,
+		StatusCode:   a.StatusCode,
+		ResponseTime: a.ResponseTime,
+		Identifier:   a.Identifier,
+		UserEmail:    a.UserEmail,
+		UserName:     a.UserName,
+		UserType:     a.UserType,
+		TenantID:     a.TenantID,
+		IP:           a.IP,
+		UserAgent:    a.UserAgent,
+		RequestID:    a.RequestID,
+		ErrorMessage: a.ErrorMessage,
+		Source:       a.Source,
+		ServiceName:  a.ServiceName,
+		Environment:  a.Environment,
+		Timestamp:    chainTimestamp(a.Timestamp).Format(time.RFC3339Nano),
+		ProjectID:    a.ProjectID,
+		SessionID:    a.SessionID,
+		ChainSeq:     a.ChainSeq,
+		TraceID:      a.TraceID,
+		SpanID:       a.SpanID,
+		ParentSpanID: a.ParentSpanID,
+	}
+	var err error
+	for _, f := range []struct {
+		dst *json.RawMessage
+		src datatypes.JSON
+	}{
+		{&ev.UserRoles, a.UserRoles},
+		{&ev.QueryParams, a.QueryParams},
+		{&ev.PathParams, a.PathParams},
+		{&ev.RequestBody, a.RequestBody},
+		{&ev.ResponseBody, a.ResponseBody},
+	} {
+		if sealed, ok := ParseSealed(f.src); ok {
+			*f.dst = sealed.chainContent()
+			continue
+		}
+		if *f.dst, err = canonicalJSON(f.src); err != nil {
+			return nil, err
+		}
+	}
+	return json.Marshal(ev)
+}
+
+// canonicalJSON re-encodes a JSON column the way it reads back from the
+// database regardless of how it was sent: object keys sorted, no whitespace,
+// numbers in shortest exact decimal form (jsonb normalizes all three). Empty
+// and null both encode as null.
+func canonicalJSON(raw datatypes.JSON) (json.RawMessage, error) {
+	if len(bytes.TrimSpace(raw)) == 0 {
+		return json.RawMessage("null"), nil
+	}
+	dec := json.NewDecoder(bytes.NewReader(raw))
+	dec.UseNumber()
+	var v any
+	if err := dec.Decode(&v); err != nil {
+		return nil, fmt.Errorf("chain: invalid JSON column: %w", err)
+	}
+	out, err := json.Marshal(canonicalNumbers(v))
+	return json.RawMessage(out), err
+}
+
+func canonicalNumbers(v any) any {
+	switch t := v.(type) {
+	case map[string]any:
+		for k, e := range t {
+			t[k] = canonicalNumbers(e)
+		}
+	case []any:
+		for i, e := range t {
+			t[i] = canonicalNumbers(e)
+		}
+	case json.Number:
+		return json.Number(canonicalNumber(string(t)))
+	}
+	return v
+}
+
+// canonicalNumber writes a JSON number without exponent or redundant zeros,
+// so 1e2, 100 and 100.0 agree. JSON numbers are finite decimals, so the
+// search for an exact representation terminates.
+func canonicalNumber(s string) string {
+	r, ok := new(big.Rat).SetString(s)
+	if !ok {
+		return s
+	}
+	if r.IsInt() {
+		return r.Num().String()
+	}
+	for prec := 1; prec <= 1000; prec++ {
+		f := r.FloatString(prec)
+		if back, _ := new(big.Rat).SetString(f); back.Cmp(r) == 0 {
+			return f
+		}
+	}
+	return s
+}
+
+// ChainHash computes an event's hash from its content and prevHash.
+func ChainHash(a *Audit, prevHash string) (string, error) {
+	content, err := canonicalContent(a)
+	if err != nil {
+		return "", err
+	}
+	h := sha256.New()
+	h.Write([]byte(chainVersion + "\n" + prevHash + "\n"))
+	h.Write(content)
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// link inserts a as the next event of its project's chain inside tx. The head
+// row is locked until tx commits, so concurrent inserts for one project (across
+// all Worker replicas) are linked one at a time.
+func link(tx *gorm.DB, a *Audit) error {
+	head := ChainHead{ProjectID: a.ProjectID}
+	if err := tx.Clauses(clause.OnConflict{DoNothing: true}).Create(&head).Error; err != nil {
+		return err
+	}
+	if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+		First(&head, "project_id = ?", a.ProjectID).Error; err != nil {
+		return err
+	}
+
+	a.Timestamp = chainTimestamp(a.Timestamp)
+	a.ChainSeq = head.Seq + 1
+	a.PrevHash = head.Hash
+	hash, err := ChainHash(a, a.PrevHash)
+	if err != nil {
+		return err
+	}
+	a.Hash = hash
+
+	db := tx
+	if a.ProjectID == "" {
+		db = db.Omit("ProjectID")
+	}
+	if err := db.Create(a).Error; err != nil {
+		return err
+	}
+	return tx.Model(&ChainHead{}).Where("project_id = ?", a.ProjectID).Updates(map[string]any{
+		"seq":        a.ChainSeq,
+		"hash":       a.Hash,
+		"updated_at": time.Now().UTC(),
+	}).Error
+}
+
+// checkpointRuns groups the chained rows of src (a table or CTE with
+// project_id, chain_seq, prev_hash and hash) into runs of consecutive
+// sequence numbers, one checkpoint each.
+func checkpointRuns(src string) string {
+	return `
+		INSERT INTO audit_chain_checkpoints (project_id, first_seq, last_seq, prev_hash, last_hash, row_count, reason)
+		SELECT chain_key, MIN(chain_seq), MAX(chain_seq),
+		       (ARRAY_AGG(COALESCE(prev_hash, '') ORDER BY chain_seq))[1],
+		       (ARRAY_AGG(hash ORDER BY chain_seq DESC))[1],
+		       COUNT(*), ?
+		FROM (
+			SELECT COALESCE(project_id, '') AS chain_key, chain_seq, prev_hash, hash,
+			       chain_seq - ROW_NUMBER() OVER (PARTITION BY COALESCE(project_id, '') ORDER BY chain_seq) AS run
+			FROM ` + src + `
+			WHERE chain_seq IS NOT NULL
+		) links
+		GROUP BY chain_key, run`
+}
+
+// sqliteCheckpointRuns is checkpointRuns for SQLite, which has no ARRAY_AGG:
+// it reads the runs of the audits matching where, still in place, and looks
+// up the hashes at their ends. The reason is bound before the where args.
+func sqliteCheckpointRuns(where string) string {
+	return `
+		INSERT INTO audit_chain_checkpoints (project_id, first_seq, last_seq, prev_hash, last_hash, row_count, reason)
+		SELECT chain_key, first_seq, last_seq,
+		       (SELECT COALESCE(c.prev_hash, '') FROM audits c
+		        WHERE COALESCE(c.project_id, '') = runs.chain_key AND c.chain_seq = runs.first_seq),
+		       (SELECT c.hash FROM audits c
+		        WHERE COALESCE(c.project_id, '') = runs.chain_key AND c.chain_seq = runs.last_seq),
+		       row_count, ?
+		FROM (
+			SELECT chain_key, MIN(chain_seq) AS first_seq, MAX(chain_seq) AS last_seq, COUNT(*) AS row_count
+			FROM (
+				SELECT COALESCE(project_id, '') AS chain_key, chain_seq,
+				       chain_seq - ROW_NUMBER() OVER (PARTITION BY COALESCE(project_id, '') ORDER BY chain_seq) AS run
+				FROM audits
+				WHERE (` + where + `) AND chain_seq IS NOT NULL
+			) links
+			GROUP BY chain_key, run
+		) runs`
+}
+
+// DeleteWithCheckpoints deletes the audits matching where and records
+// checkpoints for the chain links removed, in the same statement on
+// PostgreSQL and the same transaction on SQLite.
+func DeleteWithCheckpoints(db *gorm.DB, where string, args []interface{}, reason string) (int64, error) {
+	var removed int64
+	if dialect.Of(db) == dialect.SQLite {
+		err := db.Transaction(func(tx *gorm.DB) error {
+			if err := tx.Exec(sqliteCheckpointRuns(where), append([]interface{}{reason}, args...)...).Error; err != nil {
+				return err
+			}
+			res := tx.Exec(`DELETE FROM audits WHERE `+where, args...)
+			removed = res.RowsAffected
+			return res.Error
+		})
+		return removed, err
+	}
+	err := db.Raw(`
+		WITH removed AS (
+			DELETE FROM audits WHERE `+where+`
+			RETURNING project_id, chain_seq, prev_hash, hash
+		), checkpoints AS (`+checkpointRuns("removed")+`
+		)
+		SELECT COUNT(*) FROM removed`, append(append([]interface{}{}, args...), reason)...).Scan(&removed).Error
+	return removed, err
+}
+
+// CheckpointTable records checkpoints for every chain link in table, a
+// partition about to be detached from audits. PostgreSQL.
+func CheckpointTable(db *gorm.DB, table, reason string) error {
+	return db.Exec(checkpointRuns(table), reason).Error
+}
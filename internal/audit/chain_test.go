@@ -0,0 +1,71 @@
+package audit
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gorm.io/datatypes"
+)
+
+func TestCanonicalJSON(t *testing.T) {
+	a, err := canonicalJSON(datatypes.JSON(`{"b": [1.50, 1e2], "a": {"y": 0.0, "x": -3}}`))
+	require.NoError(t, err)
+	b, err := canonicalJSON(datatypes.JSON(`{"a":{"x":-3,"y":0},"b":[1.5,100]}`))
+	require.NoError(t, err)
+	assert.JSONEq(t, string(a), string(b))
+	assert.Equal(t, string(a), string(b), "encoding is byte-identical")
+
+	for _, empty := range []datatypes.JSON{nil, datatypes.JSON(""), datatypes.JSON("null")} {
+		got, err := canonicalJSON(empty)
+		require.NoError(t, err)
+		assert.Equal(t, "null", string(got))
+	}
+}
+
+func TestCanonicalNumber(t *testing.T) {
+	for in, want := range map[string]string{
+		"100":                            "100",
+		"1e2":                            "100",
+		"1.50":                           "1.5",
+		"-0.125":                         "-0.125",
+		"2.5E-3":                         "0.0025",
+		"123456789012345678901234567890": "123456789012345678901234567890",
+	} {
+		assert.Equal(t, want, canonicalNumber(in), in)
+	}
+}
+
+func TestChainHash(t *testing.T) {
+	ts := time.Date(2026, 10, 19, 12, 0, 0, 123456789, time.FixedZone("BRT", -3*3600))
+	event := Audit{
+		ID: "11111111-1111-1111-1111-111111111111", EventType: "http", Method: GET, Path: "/a",
+		StatusCode: 200, Identifier: "u1", ServiceName: "api", Environment: "prod",
+		Timestamp: ts, ProjectID: "p1", ChainSeq: 1,
+		RequestBody: datatypes.JSON(`{"b": 1, "a": 2}`),
+	}
+	h1, err := ChainHash(&event, "")
+	require.NoError(t, err)
+	assert.Len(t, h1, 64)
+
+	// As read back from the database: UTC, microseconds, normalized jsonb.
+	stored := event
+	stored.Timestamp = chainTimestamp(ts)
+	stored.RequestBody = datatypes.JSON(`{"a":2,"b":1}`)
+	h2, _ := ChainHash(&stored, "")
+	assert.Equal(t, h1, h2)
+
+	edited := stored
+	edited.StatusCode = 500
+	h3, _ := ChainHash(&edited, "")
+	assert.NotEqual(t, h1, h3, "content is covered")
+
+	h4, _ := ChainHash(&stored, h1)
+	assert.NotEqual(t, h1, h4, "previous hash is covered")
+
+	moved := stored
+	moved.ChainSeq = 2
+	h5, _ := ChainHash(&moved, "")
+	assert.NotEqual(t, h1, h5, "position is covered")
+}
@@ -0,0 +1,294 @@
+package audit
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// Comparison modes of the stats and insights endpoints.
+const (
+	ComparePreviousPeriod     = "previous_period"       // the window just before
+	CompareSamePeriodLastWeek = "same_period_last_week" // the window 7 days earlier
+	CompareCustom             = "custom"                // compare_start/compare_end
+)
+
+const (
+	compareStatusNew    = "new"
+	compareStatusGone   = "gone"
+	maxComparedRankings = 10
+)
+
+// Window is a time range, start inclusive, end exclusive.
+type Window struct {
+	Start time.Time `json:"start"`
+	End   time.Time `json:"end"`
+}
+
+// ComparisonWindow returns the window current is compared with. custom is
+// only read, and required, for CompareCustom.
+func ComparisonWindow(mode string, current Window, custom *Window) (Window, error) {
+	switch mode {
+	case ComparePreviousPeriod:
+		length := current.End.Sub(current.Start)
+		return Window{Start: current.Start.Add(-length), End: current.Start}, nil
+	case CompareSamePeriodLastWeek:
+		return Window{Start: current.Start.AddDate(0, 0, -7), End: current.End.AddDate(0, 0, -7)}, nil
+	case CompareCustom:
+		if custom == nil || !custom.End.After(custom.Start) {
+			return Window{}, errors.New("compare=custom requires compare_start before compare_end")
+		}
+		return *custom, nil
+	}
+	return Window{}, fmt.Errorf("compare must be %s, %s or %s", ComparePreviousPeriod, CompareSamePeriodLastWeek, CompareCustom)
+}
+
+// Delta is a value in both windows of a comparison.
+type Delta struct {
+	Current  float64 `json:"current"`
+	Previous float64 `json:"previous"`
+	Change   float64 `json:"change"`
+	// Percent is the change relative to Previous, null when Previous is 0.
+	Percent *float64 `json:"percent"`
+}
+
+func newDelta(current, previous float64) Delta {
+	d := Delta{Current: current, Previous: previous, Change: current - previous}
+	if previous != 0 {
+		p := d.Change / previous * 100
+		d.Percent = &p
+	}
+	return d
+}
+
+// status tells whether what d measures appeared or disappeared between the
+// two windows.
+func (d Delta) status() string {
+	switch {
+	case d.Previous == 0 && d.Current != 0:
+		return compareStatusNew
+	case d.Current == 0 && d.Previous != 0:
+		return compareStatusGone
+	}
+	return ""
+}
+
+// ServiceDelta compares a service's traffic between the two windows.
+type ServiceDelta struct {
+	ServiceName string `json:"service_name"`
+	Requests    Delta  `json:"requests"`
+	Errors      Delta  `json:"errors"`
+	Status      string `json:"status,omitempty"` // new | gone
+}
+
+// StatsComparison is the answer to GET /audit/stats with compare.
+type StatsComparison struct {
+	Window         Window      `json:"window"`
+	PreviousWindow Window      `json:"previous_window"`
+	Current        *AuditStats `json:"current"`
+	Previous       *AuditStats `json:"previous"`
+	// Deltas has the totals, error classes and latency: total, errors_4xx,
+	// errors_5xx, error_rate and the *_response_time fields of AuditStats.
+	Deltas        map[string]Delta `json:"deltas"`
+	ByStatusClass map[string]Delta `json:"by_status_class"`
+	Services      []ServiceDelta   `json:"services"`
+}
+
+func compareStats(current, previous *AuditStats) (map[string]Delta, map[string]Delta, []ServiceDelta) {
+	errorRate := func(s *AuditStats) float64 {
+		if s.Total == 0 {
+			return 0
+		}
+		return float64(s.Errors4xx+s.Errors5xx) / float64(s.Total) * 100
+	}
+	deltas := map[string]Delta{
+		"total":             newDelta(float64(current.Total), float64(previous.Total)),
+		"errors_4xx":        newDelta(float64(current.Errors4xx), float64(previous.Errors4xx)),
+		"errors_5xx":        newDelta(float64(current.Errors5xx), float64(previous.Errors5xx)),
+		"error_rate":        newDelta(errorRate(current), errorRate(previous)),
+		"avg_response_time": newDelta(current.AvgResponseTime, previous.AvgResponseTime),
+		"p50_response_time": newDelta(current.P50ResponseTime, previous.P50ResponseTime),
+		"p95_response_time": newDelta(current.P95ResponseTime, previous.P95ResponseTime),
+		"p99_response_time": newDelta(current.P99ResponseTime, previous.P99ResponseTime),
+		"max_response_time": newDelta(float64(current.MaxResponseTime), float64(previous.MaxResponseTime)),
+	}
+
+	classes := map[string]Delta{}
+	for class := range current.ByStatusClass {
+		classes[class] = newDelta(float64(current.ByStatusClass[class]), float64(previous.ByStatusClass[class]))
+	}
+	for class := range previous.ByStatusClass {
+		classes[class] = newDelta(float64(current.ByStatusClass[class]), float64(previous.ByStatusClass[class]))
+	}
+
+	type pair struct{ current, previous ServiceBreakdown }
+	byName := map[string]*pair{}
+	order := []string{}
+	for _, list := range [][]ServiceBreakdown{current.ByService, previous.ByService} {
+		for _, s := range list {
+			if byName[s.ServiceName] == nil {
+				byName[s.ServiceName] = &pair{}
+				order = append(order, s.ServiceName)
+			}
+		}
+	}
+	for _, s := range current.ByService {
+		byName[s.ServiceName].current = s
+	}
+	for _, s := range previous.ByService {
+		byName[s.ServiceName].previous = s
+	}
+	services := make([]ServiceDelta, 0, len(order))
+	for _, name := range order {
+		p := byName[name]
+		requests := newDelta(float64(p.current.Requests), float64(p.previous.Requests))
+		services = append(services, ServiceDelta{
+			ServiceName: name,
+			Requests:    requests,
+			Errors:      newDelta(float64(p.current.Errors), float64(p.previous.Errors)),
+			Status:      requests.status(),
+		})
+	}
+	sort.SliceStable(services, func(i, j int) bool {
+		return services[i].Requests.Current > services[j].Requests.Current
+	})
+	return deltas, classes, services
+}
+
+// RankedDelta is an entry of a compared ranking: a route or a user, with
+// the ranked value in both windows.
+type RankedDelta struct {
+	Path       string `json:"path,omitempty"`
+	Method     string `json:"method,omitempty"`
+	Identifier string `json:"identifier,omitempty"`
+	UserEmail  string `json:"user_email,omitempty"`
+	UserName   string `json:"user_name,omitempty"`
+	Delta
+	Status string `json:"status,omitempty"` // new | gone
+}
+
+// InsightsComparison is the answer to GET /audit/insights with compare.
+// Each ranking holds the top 10 of the current window, then up to 10
+// entries of the previous window that are gone from the current one.
+type InsightsComparison struct {
+	Window         Window        `json:"window"`
+	PreviousWindow Window        `json:"previous_window"`
+	TopEndpoints   []RankedDelta `json:"top_endpoints"`    // by requests
+	TopUsers       []RankedDelta `json:"top_users"`        // by requests
+	TopErrorRoutes []RankedDelta `json:"top_error_routes"` // by errors
+	TopSlowRoutes  []RankedDelta `json:"top_slow_routes"`  // by average ms
+}
+
+// ranking describes a compared ranking. value is an aggregate of the events
+// matching the %s condition; an entry is absent from a window where it is 0.
+type ranking struct {
+	columns string
+	groupBy string
+	where   string
+	value   string
+}
+
+var (
+	endpointRanking = ranking{
+		columns: "path, method",
+		groupBy: "path, method",
+		value:   "COUNT(CASE WHEN %s THEN 1 END)",
+	}
+	userRanking = ranking{
+		columns: "identifier, COALESCE(MAX(user_email), '') AS user_email, COALESCE(MAX(user_name), '') AS user_name",
+		groupBy: "identifier",
+		where:   "identifier != '' AND identifier != 'anonymous'",
+		value:   "COUNT(CASE WHEN %s THEN 1 END)",
+	}
+	errorRouteRanking = ranking{
+		columns: "path, method",
+		groupBy: "path, method",
+		value:   "COUNT(CASE WHEN %s AND status_code >= 400 THEN 1 END)",
+	}
+	slowRouteRanking = ranking{
+		columns: "path, method",
+		groupBy: "path, method",
+		value:   "COALESCE(AVG(CASE WHEN %s AND response_time > 0 THEN response_time END), 0)",
+	}
+)
+
+func (r *repository) CompareInsights(filters InsightFilters, current, previous Window) (*InsightsComparison, error) {
+	result := &InsightsComparison{Window: current, PreviousWindow: previous}
+	for _, list := range []struct {
+		ranking ranking
+		into    *[]RankedDelta
+	}{
+		{endpointRanking, &result.TopEndpoints},
+		{userRanking, &result.TopUsers},
+		{errorRouteRanking, &result.TopErrorRoutes},
+		{slowRouteRanking, &result.TopSlowRoutes},
+	} {
+		ranked, err := r.compareRanking(filters, list.ranking, current, previous)
+		if err != nil {
+			return nil, err
+		}
+		*list.into = ranked
+	}
+	return result, nil
+}
+
+// compareRanking reads the top entries of the current window, then the
+// top entries of the previous window absent from the current one.
+func (r *repository) compareRanking(filters InsightFilters, rk ranking, current, previous Window) ([]RankedDelta, error) {
+	const inWindow = "timestamp >= ? AND timestamp < ?"
+	value := fmt.Sprintf(rk.value, inWindow)
+
+	query := func() *gorm.DB {
+		q := r.insightScope(filters).
+			Where("("+inWindow+") OR ("+inWindow+")", current.Start, current.End, previous.Start, previous.End).
+			Select(rk.columns+", "+value+" AS current_value, "+value+" AS previous_value",
+				current.Start, current.End, previous.Start, previous.End).
+			Group(rk.groupBy).
+			Limit(maxComparedRankings)
+		if rk.where != "" {
+			q = q.Where(rk.where)
+		}
+		return q
+	}
+	type row struct {
+		Path          string
+		Method        string
+		Identifier    string
+		UserEmail     string
+		UserName      string
+		CurrentValue  float64
+		PreviousValue float64
+	}
+
+	var top, gone []row
+	if err := query().
+		Having(value+" > 0", current.Start, current.End).
+		Order("current_value DESC, " + rk.groupBy).
+		Scan(&top).Error; err != nil {
+		return nil, err
+	}
+	if err := query().
+		Having(value+" = 0 AND "+value+" > 0", current.Start, current.End, previous.Start, previous.End).
+		Order("previous_value DESC, " + rk.groupBy).
+		Scan(&gone).Error; err != nil {
+		return nil, err
+	}
+
+	ranked := make([]RankedDelta, 0, len(top)+len(gone))
+	for _, row := range append(top, gone...) {
+		d := newDelta(row.CurrentValue, row.PreviousValue)
+		ranked = append(ranked, RankedDelta{
+			Path:       row.Path,
+			Method:     row.Method,
+			Identifier: row.Identifier,
+			UserEmail:  row.UserEmail,
+			UserName:   row.UserName,
+			Delta:      d,
+			Status:     d.status(),
+		})
+	}
+	return ranked, nil
+}
@@ -0,0 +1,62 @@
+package audit
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestComparisonWindow(t *testing.T) {
+	start := time.Date(2024, 1, 15, 0, 0, 0, 0, time.UTC)
+	current := Window{Start: start, End: start.Add(48 * time.Hour)}
+
+	previous, err := ComparisonWindow(ComparePreviousPeriod, current, nil)
+	require.NoError(t, err)
+	assert.Equal(t, Window{Start: start.Add(-48 * time.Hour), End: start}, previous)
+
+	lastWeek, err := ComparisonWindow(CompareSamePeriodLastWeek, current, nil)
+	require.NoError(t, err)
+	assert.Equal(t, Window{Start: start.AddDate(0, 0, -7), End: start.AddDate(0, 0, -5)}, lastWeek)
+
+	custom := Window{Start: start.AddDate(-1, 0, 0), End: start.AddDate(-1, 0, 1)}
+	got, err := ComparisonWindow(CompareCustom, current, &custom)
+	require.NoError(t, err)
+	assert.Equal(t, custom, got)
+
+	_, err = ComparisonWindow(CompareCustom, current, nil)
+	assert.Error(t, err)
+	_, err = ComparisonWindow(CompareCustom, current, &Window{Start: start, End: start})
+	assert.Error(t, err)
+	_, err = ComparisonWindow("yesterday", current, nil)
+	assert.Error(t, err)
+}
+
+func TestCompareStats(t *testing.T) {
+	current := &AuditStats{
+		Total: 150, Errors5xx: 15, AvgResponseTime: 80,
+		ByStatusClass: map[string]int64{"2xx": 135, "5xx": 15},
+		ByService:     []ServiceBreakdown{{ServiceName: "api", Requests: 100}, {ServiceName: "billing", Requests: 50}},
+	}
+	previous := &AuditStats{
+		Total: 100, Errors4xx: 10, AvgResponseTime: 100,
+		ByStatusClass: map[string]int64{"2xx": 90, "4xx": 10},
+		ByService:     []ServiceBreakdown{{ServiceName: "api", Requests: 80}, {ServiceName: "legacy", Requests: 20}},
+	}
+	deltas, classes, services := compareStats(current, previous)
+
+	assert.Equal(t, 50.0, deltas["total"].Change)
+	assert.Equal(t, 50.0, *deltas["total"].Percent)
+	assert.Equal(t, -20.0, *deltas["avg_response_time"].Percent)
+	assert.Equal(t, 10.0, deltas["error_rate"].Current)
+	assert.Nil(t, deltas["errors_5xx"].Percent)
+	assert.Equal(t, -10.0, classes["4xx"].Change)
+	assert.Equal(t, 15.0, classes["5xx"].Current)
+
+	require.Len(t, services, 3)
+	assert.Equal(t, "api", services[0].ServiceName)
+	assert.Empty(t, services[0].Status)
+	assert.Equal(t, ServiceDelta{ServiceName: "billing", Requests: newDelta(50, 0), Errors: newDelta(0, 0), Status: "new"}, services[1])
+	assert.Equal(t, "gone", services[2].Status)
+}
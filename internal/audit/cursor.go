@@ -0,0 +1,124 @@
+package audit
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// Keyset pagination: a Cursor is the sort value and ID of the last event of
+// a page, and the next page continues strictly after it. Unlike OFFSET,
+// reaching page 1,000 costs the same as reaching page 2, and events stored
+// meanwhile do not shift the pages.
+
+// TotalMode is how List computes TotalItems.
+type TotalMode string
+
+const (
+	TotalExact    TotalMode = "exact"    // COUNT(*)
+	TotalEstimate TotalMode = "estimate" // the Postgres planner's row estimate
+	TotalNone     TotalMode = "none"     // not computed
+)
+
+// Cursor is a position in a list sorted by SortBy, then by ID.
+type Cursor struct {
+	SortBy string     `json:"s"`
+	Order  string     `json:"o"`
+	Time   *time.Time `json:"t,omitempty"` // SortBy timestamp or session_start
+	Number *int64     `json:"n,omitempty"` // SortBy status_code or response_time
+	ID     string     `json:"id"`
+}
+
+var errInvalidCursor = errors.New("invalid cursor")
+
+// Encode renders the cursor as the opaque string clients pass back.
+func (c Cursor) Encode() string {
+	b, _ := json.Marshal(c)
+	return base64.RawURLEncoding.EncodeToString(b)
+}
+
+// ParseCursor decodes a cursor returned as next_cursor.
+func ParseCursor(s string) (*Cursor, error) {
+	b, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return nil, errInvalidCursor
+	}
+	var c Cursor
+	if err := json.Unmarshal(b, &c); err != nil || c.ID == "" || (c.Order != "asc" && c.Order != "desc") {
+		return nil, errInvalidCursor
+	}
+	switch c.SortBy {
+	case "timestamp", sessionCursorSort:
+		if c.Time == nil {
+			return nil, errInvalidCursor
+		}
+	case "status_code", "response_time":
+		if c.Number == nil {
+			return nil, errInvalidCursor
+		}
+	default:
+		return nil, errInvalidCursor
+	}
+	return &c, nil
+}
+
+// listOrder returns the sort column and direction of filters.
+func listOrder(filters ListFilters) (string, string) {
+	allowedSortCols := map[string]bool{"timestamp": true, "status_code": true, "response_time": true}
+	sortCol := "timestamp"
+	if allowedSortCols[filters.SortBy] {
+		sortCol = filters.SortBy
+	}
+	sortOrder := "desc"
+	if filters.SortOrder == "asc" {
+		sortOrder = "asc"
+	}
+	return sortCol, sortOrder
+}
+
+// cursorAfter returns the cursor of the event a, in the order of filters.
+func cursorAfter(a AuditSummary, filters ListFilters) Cursor {
+	sortCol, sortOrder := listOrder(filters)
+	c := Cursor{SortBy: sortCol, Order: sortOrder, ID: a.ID}
+	switch sortCol {
+	case "timestamp":
+		t := a.Timestamp
+		c.Time = &t
+	case "status_code":
+		n := int64(a.StatusCode)
+		c.Number = &n
+	case "response_time":
+		n := a.ResponseTime
+		c.Number = &n
+	}
+	return c
+}
+
+// applyKeyset orders query by filters' sort, then by ID, and narrows it to
+// events after filters.After. The cursor must come from a list with the
+// same sort.
+func applyKeyset(query *gorm.DB, filters ListFilters) (*gorm.DB, error) {
+	sortCol, sortOrder := listOrder(filters)
+	c := filters.After
+	if c != nil && (c.SortBy != sortCol || c.Order != sortOrder) {
+		return nil, errors.New("cursor does not match sort_by and sort_order")
+	}
+	query = query.Order(sortCol + " " + sortOrder).Order("id " + sortOrder)
+	if c == nil {
+		return query, nil
+	}
+	var value any
+	if c.Time != nil {
+		value = *c.Time
+	} else {
+		value = *c.Number
+	}
+	op := "<"
+	if sortOrder == "asc" {
+		op = ">"
+	}
+	return query.Where("("+sortCol+" "+op+" ? OR ("+sortCol+" = ? AND id "+op+" ?))", value, value, c.ID), nil
+}
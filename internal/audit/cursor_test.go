@@ -0,0 +1,47 @@
+package audit
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCursor_roundTrip(t *testing.T) {
+	ts := time.Date(2026, 10, 19, 9, 30, 0, 123456000, time.UTC)
+	a := AuditSummary{ID: "e1", Timestamp: ts, StatusCode: 503, ResponseTime: 42}
+
+	c, err := ParseCursor(cursorAfter(a, ListFilters{}).Encode())
+	require.NoError(t, err)
+	assert.Equal(t, "timestamp", c.SortBy)
+	assert.Equal(t, "desc", c.Order)
+	assert.True(t, ts.Equal(*c.Time), "keeps sub-second precision")
+	assert.Equal(t, "e1", c.ID)
+
+	c, err = ParseCursor(cursorAfter(a, ListFilters{SortBy: "response_time", SortOrder: "asc"}).Encode())
+	require.NoError(t, err)
+	assert.Equal(t, int64(42), *c.Number)
+	assert.Equal(t, "asc", c.Order)
+}
+
+func TestParseCursor_Invalid(t *testing.T) {
+	for _, s := range []string{
+		"",
+		"not base64!",
+		Cursor{SortBy: "timestamp", Order: "desc", ID: "e1"}.Encode(),
+		Cursor{SortBy: "path", Order: "desc", ID: "e1", Number: new(int64)}.Encode(),
+		Cursor{SortBy: "status_code", Order: "sideways", ID: "e1", Number: new(int64)}.Encode(),
+		Cursor{SortBy: "status_code", Order: "asc", Number: new(int64)}.Encode(),
+	} {
+		_, err := ParseCursor(s)
+		assert.Error(t, err, s)
+	}
+}
+
+func TestApplyKeyset_sortMismatch(t *testing.T) {
+	c, err := ParseCursor(Cursor{SortBy: "status_code", Order: "asc", ID: "e1", Number: new(int64)}.Encode())
+	require.NoError(t, err)
+	_, err = applyKeyset(nil, ListFilters{After: c})
+	assert.Error(t, err)
+}
@@ -0,0 +1,303 @@
+package audit
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"gorm.io/gorm"
+)
+
+// Field filters (the filter parameter of List, Export and Sessions, and
+// {{filters}} in the SQL console) reach into the JSON columns of an event:
+//
+//	body.customer.id=123       request_body
+//	response.status=refused    response_body
+//	query.page>5               query_params
+//	path.id=42                 path_params
+//	roles contains admin       user_roles
+//
+// Paths are checked against fieldSegment and written into the SQL, so that
+// expression indexes on them are used; values are always bound parameters.
+//
+// = and != compare the text of the value, so 123 matches both the number and
+// the string "123". <, <=, > and >= compare numerically when the value is a
+// number, numeric strings included, and as text otherwise. contains matches
+// an element of an array, or the value itself when it is not an array.
+// Missing values never match, not even with !=, and neither do columns sealed
+// by field encryption.
+
+const (
+	maxFieldFilters   = 10
+	maxFieldPathDepth = 8
+	maxFieldValue     = 256
+)
+
+// fieldColumns maps the first part of a field reference to its column.
+var fieldColumns = map[string]string{
+	"body":     "request_body",
+	"response": "response_body",
+	"query":    "query_params",
+	"path":     "path_params",
+	"roles":    "user_roles",
+}
+
+var (
+	fieldSegment   = regexp.MustCompile(`^[A-Za-z0-9_-]+$`)
+	fieldArrayItem = regexp.MustCompile(`^[0-9]+$`)
+	fieldNumber    = regexp.MustCompile(`^-?[0-9]+(\.[0-9]+)?([eE][-+]?[0-9]+)?$`)
+	fieldOperator  = regexp.MustCompile(`(!=|>=|<=|=|>|<|\s(?i:contains)\s)`)
+)
+
+// FieldRef is a value inside one of an event's JSON columns. An empty Path
+// is the whole column.
+type FieldRef struct {
+	Column string
+	Path   []string
+}
+
+// String renders the reference as it is written in filters.
+func (r FieldRef) String() string {
+	for prefix, column := range fieldColumns {
+		if column == r.Column {
+			return strings.Join(append([]string{prefix}, r.Path...), ".")
+		}
+	}
+	return r.Column
+}
+
+// FieldFilter compares a FieldRef with a value.
+type FieldFilter struct {
+	FieldRef
+	Op    string // = != < <= > >= contains
+	Value string
+}
+
+// ParseFieldRef parses a field reference such as body.customer.id.
+func ParseFieldRef(s string) (FieldRef, error) {
+	parts := strings.Split(strings.TrimSpace(s), ".")
+	column, ok := fieldColumns[parts[0]]
+	if !ok {
+		return FieldRef{}, fmt.Errorf("unknown field %q: must start with body, response, query, path or roles", s)
+	}
+	if len(parts)-1 > maxFieldPathDepth {
+		return FieldRef{}, fmt.Errorf("field %q is nested more than %d levels", s, maxFieldPathDepth)
+	}
+	for _, p := range parts[1:] {
+		if !fieldSegment.MatchString(p) {
+			return FieldRef{}, fmt.Errorf("invalid field %q: path parts may only contain letters, digits, _ and -", s)
+		}
+	}
+	return FieldRef{Column: column, Path: parts[1:]}, nil
+}
+
+// ParseFieldFilter parses a filter such as body.customer.id=123 or
+// roles contains admin. A value in double quotes is taken as is, spaces
+// included.
+func ParseFieldFilter(s string) (FieldFilter, error) {
+	loc := fieldOperator.FindStringIndex(s)
+	if loc == nil {
+		return FieldFilter{}, fmt.Errorf("invalid filter %q: expected field, operator and value", s)
+	}
+	ref, err := ParseFieldRef(s[:loc[0]])
+	if err != nil {
+		return FieldFilter{}, err
+	}
+	f := FieldFilter{
+		FieldRef: ref,
+		Op:       strings.ToLower(strings.TrimSpace(s[loc[0]:loc[1]])),
+		Value:    strings.TrimSpace(s[loc[1]:]),
+	}
+	if len(f.Value) >= 2 && strings.HasPrefix(f.Value, `"`) && strings.HasSuffix(f.Value, `"`) {
+		f.Value = f.Value[1 : len(f.Value)-1]
+	} else if f.Value == "" {
+		return FieldFilter{}, fmt.Errorf("invalid filter %q: missing value (use \"\" for an empty string)", s)
+	}
+	if len(f.Value) > maxFieldValue {
+		return FieldFilter{}, fmt.Errorf("filter value must be at most %d characters", maxFieldValue)
+	}
+	return f, nil
+}
+
+// ParseFieldFilters parses every filter in raw.
+func ParseFieldFilters(raw []string) ([]FieldFilter, error) {
+	if len(raw) > maxFieldFilters {
+		return nil, fmt.Errorf("at most %d filters are allowed", maxFieldFilters)
+	}
+	filters := make([]FieldFilter, 0, len(raw))
+	for _, s := range raw {
+		f, err := ParseFieldFilter(s)
+		if err != nil {
+			return nil, err
+		}
+		filters = append(filters, f)
+	}
+	return filters, nil
+}
+
+// pgPath renders the path as a Postgres text[] literal.
+func (r FieldRef) pgPath() string {
+	return "'{" + strings.Join(r.Path, ",") + "}'"
+}
+
+// sqlitePath renders the path as a SQLite JSON path literal.
+func (r FieldRef) sqlitePath() string {
+	var b strings.Builder
+	b.WriteString("'$")
+	for _, p := range r.Path {
+		if fieldArrayItem.MatchString(p) {
+			b.WriteString("[" + p + "]")
+		} else {
+			b.WriteString(`."` + p + `"`)
+		}
+	}
+	b.WriteString("'")
+	return b.String()
+}
+
+// textSQL is the value as text, NULL when it is missing. It is also the
+// expression field indexes are built on.
+func (r FieldRef) textSQL(dialect string) string {
+	if dialect == "sqlite" {
+		return sqliteText(fmt.Sprintf("json_type(%s, %s)", r.Column, r.sqlitePath()),
+			fmt.Sprintf("json_extract(%s, %s)", r.Column, r.sqlitePath()))
+	}
+	return "(" + r.Column + " #>> " + r.pgPath() + ")"
+}
+
+// sqliteText renders a JSON value as Postgres' #>> would: booleans as
+// true and false rather than 1 and 0.
+func sqliteText(typ, value string) string {
+	return "CASE " + typ + " WHEN 'true' THEN 'true' WHEN 'false' THEN 'false' ELSE CAST(" + value + " AS TEXT) END"
+}
+
+// numberSQL is the value as a number, NULL when it is missing or neither a
+// number nor a numeric string.
+func (r FieldRef) numberSQL(dialect string) string {
+	if dialect == "sqlite" {
+		typ := fmt.Sprintf("json_type(%s, %s)", r.Column, r.sqlitePath())
+		value := fmt.Sprintf("json_extract(%s, %s)", r.Column, r.sqlitePath())
+		return "CASE WHEN " + typ + " IN ('integer', 'real') THEN " + value +
+			" WHEN " + typ + " = 'text' AND " + value + " GLOB '*[0-9]*' AND " + value + " NOT GLOB '*[^0-9eE.+-]*'" +
+			" THEN CAST(" + value + " AS REAL) END"
+	}
+	// No ? in the pattern: gorm would take it for a parameter.
+	text := r.textSQL(dialect)
+	return "CASE WHEN " + text + ` ~ '^-{0,1}[0-9]+(\.[0-9]+){0,1}([eE][-+]{0,1}[0-9]+){0,1}$' THEN ` + text + "::numeric END"
+}
+
+// sql renders f as a condition on the current row, with ? placeholders.
+func (f FieldFilter) sql(dialect string) (string, []any) {
+	switch f.Op {
+	case "=", "!=":
+		op := "="
+		if f.Op == "!=" {
+			op = "<>"
+		}
+		return f.textSQL(dialect) + " " + op + " ?", []any{f.Value}
+	case "contains":
+		return f.containsSQL(dialect)
+	}
+	if fieldNumber.MatchString(f.Value) {
+		if dialect == "sqlite" {
+			n, _ := strconv.ParseFloat(f.Value, 64)
+			return "(" + f.numberSQL(dialect) + ") " + f.Op + " ?", []any{n}
+		}
+		return "(" + f.numberSQL(dialect) + ") " + f.Op + " ?::numeric", []any{f.Value}
+	}
+	if dialect == "sqlite" {
+		return "(" + f.textSQL(dialect) + ") " + f.Op + " ?", []any{f.Value}
+	}
+	// Byte order, as SQLite compares.
+	return f.textSQL(dialect) + ` COLLATE "C" ` + f.Op + " ?", []any{f.Value}
+}
+
+func (f FieldFilter) containsSQL(dialect string) (string, []any) {
+	if dialect == "sqlite" {
+		path := f.sqlitePath()
+		return fmt.Sprintf("(json_type(%s, %s) <> 'object' AND EXISTS (SELECT 1 FROM json_each(%s, %s) WHERE %s = ?))",
+			f.Column, path, f.Column, path, sqliteText("type", "value")), []any{f.Value}
+	}
+	// A jsonb array contains a scalar when one of its elements equals it.
+	value := "(" + f.Column + " #> " + f.pgPath() + ")"
+	conds := []string{value + " @> to_jsonb(?::text)"}
+	args := []any{f.Value}
+	if fieldNumber.MatchString(f.Value) {
+		conds = append(conds, value+" @> to_jsonb(?::numeric)")
+		args = append(args, f.Value)
+	}
+	if f.Value == "true" || f.Value == "false" {
+		conds = append(conds, value+" @> to_jsonb(?::boolean)")
+		args = append(args, f.Value)
+	}
+	return "(" + strings.Join(conds, " OR ") + ")", args
+}
+
+// fieldFiltersSQL parses raw and renders every filter as one condition.
+// It returns an empty condition when there are no filters.
+func fieldFiltersSQL(raw []string, dialect string) (string, []any, error) {
+	filters, err := ParseFieldFilters(raw)
+	if err != nil {
+		return "", nil, err
+	}
+	conds := make([]string, 0, len(filters))
+	var args []any
+	for _, f := range filters {
+		cond, a := f.sql(dialect)
+		conds = append(conds, "("+cond+")")
+		args = append(args, a...)
+	}
+	return strings.Join(conds, " AND "), args, nil
+}
+
+// applyFieldFilters narrows query to events matching every filter.
+func applyFieldFilters(query *gorm.DB, raw []string) (*gorm.DB, error) {
+	if len(raw) == 0 {
+		return query, nil
+	}
+	cond, args, err := fieldFiltersSQL(raw, query.Dialector.Name())
+	if err != nil {
+		return nil, err
+	}
+	return query.Where(cond, args...), nil
+}
+
+var filtersPlaceholder = regexp.MustCompile(`\{\{\s*filters\s*\}\}`)
+
+// ExpandFilters replaces {{filters}} in a SQL console query with the
+// condition of the given field filters, or 1=1 when there are none, and
+// returns the parameters it binds. Placeholders are numbered ($1 or ?1), so
+// {{filters}} may appear more than once.
+func ExpandFilters(q string, raw []string, dialect string) (string, []any, error) {
+	if !filtersPlaceholder.MatchString(q) {
+		if len(raw) > 0 {
+			return "", nil, errors.New("filters need a {{filters}} placeholder in the query")
+		}
+		return q, nil, nil
+	}
+	cond, args, err := fieldFiltersSQL(raw, dialect)
+	if err != nil {
+		return "", nil, err
+	}
+	if cond == "" {
+		cond = "1=1"
+	}
+	prefix := "$"
+	if dialect == "sqlite" {
+		prefix = "?"
+	}
+	var b strings.Builder
+	n := 0
+	for _, r := range cond {
+		if r == '?' {
+			n++
+			b.WriteString(prefix + strconv.Itoa(n))
+			continue
+		}
+		b.WriteRune(r)
+	}
+	cond = "(" + b.String() + ")"
+	return filtersPlaceholder.ReplaceAllLiteralString(q, cond), args, nil
+}
@@ -0,0 +1,104 @@
+package audit
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseFieldFilter(t *testing.T) {
+	cases := map[string]FieldFilter{
+		"body.customer.id=123":        {FieldRef{"request_body", []string{"customer", "id"}}, "=", "123"},
+		"query.page > 5":              {FieldRef{"query_params", []string{"page"}}, ">", "5"},
+		"response.status!=refused":    {FieldRef{"response_body", []string{"status"}}, "!=", "refused"},
+		"roles contains admin":        {FieldRef{"user_roles", []string{}}, "contains", "admin"},
+		"body.items.0.sku CONTAINS A": {FieldRef{"request_body", []string{"items", "0", "sku"}}, "contains", "A"},
+		`body.name="Bob = Smith"`:     {FieldRef{"request_body", []string{"name"}}, "=", "Bob = Smith"},
+		`body.note=""`:                {FieldRef{"request_body", []string{"note"}}, "=", ""},
+		"path.order-id>=2026-01-01":   {FieldRef{"path_params", []string{"order-id"}}, ">=", "2026-01-01"},
+	}
+	for s, want := range cases {
+		got, err := ParseFieldFilter(s)
+		require.NoError(t, err, s)
+		assert.Equal(t, want, got, s)
+	}
+}
+
+func TestParseFieldFilter_Invalid(t *testing.T) {
+	for _, s := range []string{
+		"body.customer.id",
+		"body.customer.id=",
+		"user_email=a@b.c",
+		"body.customer..id=1",
+		"body.customer'id=1",
+		"body.a.b.c.d.e.f.g.h.i=1",
+		"roles contains",
+	} {
+		_, err := ParseFieldFilter(s)
+		assert.Error(t, err, s)
+	}
+
+	_, err := ParseFieldFilters(make([]string, maxFieldFilters+1))
+	assert.Error(t, err)
+}
+
+func TestFieldFilterSQL(t *testing.T) {
+	f, err := ParseFieldFilter("body.customer.id=123")
+	require.NoError(t, err)
+	sql, args := f.sql("postgres")
+	assert.Equal(t, "(request_body #>> '{customer,id}') = ?", sql)
+	assert.Equal(t, []any{"123"}, args)
+	sql, _ = f.sql("sqlite")
+	assert.Equal(t, `CASE json_type(request_body, '$."customer"."id"') WHEN 'true' THEN 'true' WHEN 'false' THEN 'false' ELSE CAST(json_extract(request_body, '$."customer"."id"') AS TEXT) END = ?`, sql)
+
+	f, err = ParseFieldFilter("query.page>5")
+	require.NoError(t, err)
+	sql, args = f.sql("postgres")
+	assert.Contains(t, sql, "::numeric END) > ?::numeric")
+	assert.NotContains(t, sql[:len(sql)-len("?::numeric")], "?", "no stray placeholders")
+	assert.Equal(t, []any{"5"}, args)
+	_, args = f.sql("sqlite")
+	assert.Equal(t, []any{5.0}, args)
+
+	f, err = ParseFieldFilter("body.tags contains 5")
+	require.NoError(t, err)
+	sql, args = f.sql("postgres")
+	assert.Equal(t, "((request_body #> '{tags}') @> to_jsonb(?::text) OR (request_body #> '{tags}') @> to_jsonb(?::numeric))", sql)
+	assert.Equal(t, []any{"5", "5"}, args)
+
+	f, err = ParseFieldFilter("body.items.0.sku=A")
+	require.NoError(t, err)
+	assert.Equal(t, `'$."items"[0]."sku"'`, f.sqlitePath())
+}
+
+func TestExpandFilters(t *testing.T) {
+	q, args, err := ExpandFilters("SELECT count(*) FROM audits WHERE {{filters}} AND {{ filters }}", []string{"query.page>5", "roles contains admin"}, "postgres")
+	require.NoError(t, err)
+	assert.Contains(t, q, "$1::numeric")
+	assert.Contains(t, q, "to_jsonb($2::text)")
+	assert.NotContains(t, q, "?")
+	assert.NotContains(t, q, "{{")
+	assert.Equal(t, []any{"5", "admin"}, args)
+
+	q, args, err = ExpandFilters("SELECT 1 FROM audits WHERE {{filters}}", nil, "sqlite")
+	require.NoError(t, err)
+	assert.Equal(t, "SELECT 1 FROM audits WHERE (1=1)", q)
+	assert.Empty(t, args)
+
+	_, _, err = ExpandFilters("SELECT 1 FROM audits", []string{"body.a=1"}, "sqlite")
+	assert.Error(t, err, "filters without a placeholder")
+}
+
+func TestParseFieldIndexes(t *testing.T) {
+	refs, err := ParseFieldIndexes(" body.customer.id, response.status ,")
+	require.NoError(t, err)
+	require.Len(t, refs, 2)
+	assert.Equal(t, "body.customer.id", refs[0].String())
+	assert.Equal(t, "response.status", refs[1].String())
+	assert.NotEqual(t, fieldIndexName(refs[0]), fieldIndexName(refs[1]))
+	assert.LessOrEqual(t, len(fieldIndexName(refs[0])), 63)
+
+	_, err = ParseFieldIndexes("body.customer.id,email")
+	assert.Error(t, err)
+}
@@ -0,0 +1,115 @@
+package audit
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"log/slog"
+	"strings"
+
+	"gorm.io/gorm"
+)
+
+// ParseFieldIndexes parses FIELD_FILTER_INDEXES: a comma-separated list of
+// field references (body.customer.id,response.status).
+func ParseFieldIndexes(s string) ([]FieldRef, error) {
+	var refs []FieldRef
+	for _, part := range strings.Split(s, ",") {
+		if strings.TrimSpace(part) == "" {
+			continue
+		}
+		ref, err := ParseFieldRef(part)
+		if err != nil {
+			return nil, err
+		}
+		refs = append(refs, ref)
+	}
+	return refs, nil
+}
+
+// fieldIndexName names the index of ref on audits. It is derived from the
+// column and path so every replica picks the same name.
+func fieldIndexName(ref FieldRef) string {
+	sum := sha256.Sum256([]byte(ref.Column + ":" + strings.Join(ref.Path, ".")))
+	return "idx_audits_field_" + hex.EncodeToString(sum[:6])
+}
+
+// EnsureFieldIndexes creates an expression index on audits for every ref
+// that lacks one, so = filters on hot paths do not scan the table. Indexes
+// for paths removed from the list are left in place.
+//
+// On Postgres indexes are built concurrently, without blocking inserts. A
+// partitioned audits gets the index on each partition, attached to an index
+// on the parent; partitions created later inherit it.
+func EnsureFieldIndexes(ctx context.Context, db *gorm.DB, refs []FieldRef) error {
+	conn := db.WithContext(ctx)
+	dialect := db.Dialector.Name()
+	for _, ref := range refs {
+		name := fieldIndexName(ref)
+		expr := ref.textSQL(dialect)
+		var err error
+		if dialect == "sqlite" {
+			err = conn.Exec(fmt.Sprintf(`CREATE INDEX IF NOT EXISTS %s ON audits (%s)`, name, expr)).Error
+		} else {
+			err = ensurePostgresFieldIndex(conn, name, expr)
+		}
+		if err != nil {
+			return fmt.Errorf("index %s on %s: %w", name, ref, err)
+		}
+		slog.Info("Field filter index ready", "field", ref.String(), "index", name)
+	}
+	return nil
+}
+
+func ensurePostgresFieldIndex(conn *gorm.DB, name, expr string) error {
+	var partitions []string
+	if err := conn.Raw(`SELECT c.relname FROM pg_inherits i JOIN pg_class c ON c.oid = i.inhrelid
+		WHERE i.inhparent = to_regclass('audits')`).Scan(&partitions).Error; err != nil {
+		return err
+	}
+	if len(partitions) == 0 {
+		return createIndexConcurrently(conn, name, "audits", expr)
+	}
+
+	// CONCURRENTLY is not supported on a partitioned table: build the
+	// parent index empty (ON ONLY), then one per partition, and attach them.
+	if err := conn.Exec(fmt.Sprintf(`CREATE INDEX IF NOT EXISTS %s ON ONLY audits (%s)`, name, expr)).Error; err != nil {
+		return err
+	}
+	suffix := strings.TrimPrefix(name, "idx_audits")
+	for _, p := range partitions {
+		child := p
+		if len(child)+len(suffix) > 63 {
+			child = child[:63-len(suffix)]
+		}
+		child += suffix
+		if err := createIndexConcurrently(conn, child, p, expr); err != nil {
+			return err
+		}
+		if err := conn.Exec(fmt.Sprintf(`ALTER INDEX %s ATTACH PARTITION %s`, name, child)).Error; err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// createIndexConcurrently builds an index without blocking writes. An
+// interrupted concurrent build leaves an invalid index behind, which is
+// dropped and rebuilt.
+func createIndexConcurrently(conn *gorm.DB, name, table, expr string) error {
+	var valid []bool
+	if err := conn.Raw(`SELECT indisvalid FROM pg_index WHERE indexrelid = to_regclass(?)`, name).Scan(&valid).Error; err != nil {
+		return err
+	}
+	if len(valid) == 1 && valid[0] {
+		return nil
+	}
+	if len(valid) == 1 {
+		slog.Warn("Rebuilding invalid field filter index", "index", name)
+		if err := conn.Exec(`DROP INDEX CONCURRENTLY IF EXISTS ` + name).Error; err != nil {
+			return err
+		}
+	}
+	return conn.Exec(fmt.Sprintf(`CREATE INDEX CONCURRENTLY IF NOT EXISTS %s ON %s (%s)`, name, table, expr)).Error
+}
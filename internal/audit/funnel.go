@@ -0,0 +1,454 @@
+package audit
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/joaovrmoraes/bataudit/internal/dialect"
+)
+
+// Funnels and path analysis follow the journeys of users: the HTTP events of
+// one identifier (anonymous ones aside) or, with by=session, of one explicit
+// session_id, in time order. Steps further apart than the maximum gap do not
+// belong to the same journey.
+
+const (
+	minFunnelSteps         = 2
+	maxFunnelSteps         = 10
+	defaultJourneyGap      = 30 * time.Minute
+	maxJourneyGap          = 7 * 24 * time.Hour
+	defaultJourneyRange    = 7 * 24 * time.Hour
+	maxJourneyRange        = 90 * 24 * time.Hour
+	defaultPathTransitions = 10
+	maxPathTransitions     = 100
+)
+
+// journeyColumns are the columns a journey is followed by, with the
+// condition its events must meet.
+var journeyColumns = map[string][2]string{
+	"identifier": {"identifier", "identifier != '' AND identifier != 'anonymous'"},
+	"session":    {"session_id", "session_id IS NOT NULL AND session_id != ''"},
+}
+
+// JourneyFilters selects the events journeys are followed in.
+type JourneyFilters struct {
+	ProjectID   string
+	ServiceName string
+	Environment string
+	StartDate   *time.Time
+	EndDate     *time.Time
+	By          string        // identifier (default) | session
+	MaxGap      time.Duration // between consecutive steps (default 30m)
+}
+
+// validate applies the defaults: the last 7 days, by identifier, 30 minutes.
+func (f *JourneyFilters) validate() error {
+	if f.By == "" {
+		f.By = "identifier"
+	}
+	if _, ok := journeyColumns[f.By]; !ok {
+		return errors.New("by must be identifier or session")
+	}
+	if f.MaxGap == 0 {
+		f.MaxGap = defaultJourneyGap
+	}
+	if f.MaxGap < 0 || f.MaxGap > maxJourneyGap {
+		return errors.New("max_step_gap must be positive and at most 168h")
+	}
+	end := time.Now().UTC()
+	if f.EndDate != nil {
+		end = *f.EndDate
+	}
+	if f.StartDate == nil {
+		start := end.Add(-defaultJourneyRange)
+		f.StartDate = &start
+	}
+	if end.Sub(*f.StartDate) > maxJourneyRange {
+		return errors.New("time range must not exceed 90 days")
+	}
+	return nil
+}
+
+// where renders the filters as a condition on audits, with its arguments.
+func (f JourneyFilters) where() (string, []any) {
+	where := "event_type = 'http' AND " + journeyColumns[f.By][1] + " AND timestamp >= ?"
+	args := []any{*f.StartDate}
+	if f.EndDate != nil {
+		where += " AND timestamp <= ?"
+		args = append(args, *f.EndDate)
+	}
+	if f.ProjectID != "" {
+		where += " AND project_id = ?"
+		args = append(args, f.ProjectID)
+	}
+	if f.ServiceName != "" {
+		where += " AND service_name = ?"
+		args = append(args, f.ServiceName)
+	}
+	if f.Environment != "" {
+		where += " AND environment = ?"
+		args = append(args, f.Environment)
+	}
+	return where, args
+}
+
+// FunnelStep matches the events of a funnel step: a method and route and,
+// optionally, a status code (201) or class (2xx).
+type FunnelStep struct {
+	Method string `json:"method"`
+	Path   string `json:"path"`
+	Status string `json:"status,omitempty"`
+}
+
+func (s *FunnelStep) validate() error {
+	s.Method = strings.ToUpper(s.Method)
+	if s.Method == "" || s.Path == "" {
+		return errors.New("every step needs a method and a path")
+	}
+	if s.Status == "" {
+		return nil
+	}
+	if code, err := strconv.Atoi(s.Status); err == nil && code >= 100 && code <= 599 {
+		return nil
+	}
+	if len(s.Status) == 3 && s.Status[0] >= '1' && s.Status[0] <= '5' && strings.ToLower(s.Status[1:]) == "xx" {
+		s.Status = strings.ToLower(s.Status)
+		return nil
+	}
+	return fmt.Errorf("invalid step status %q: expected a code (201) or a class (2xx)", s.Status)
+}
+
+// statusRange is the range of status codes the step accepts, [from, to).
+func (s FunnelStep) statusRange() (from, to int) {
+	if s.Status == "" {
+		return 0, 1000
+	}
+	if code, err := strconv.Atoi(s.Status); err == nil {
+		return code, code + 1
+	}
+	class := int(s.Status[0]-'0') * 100
+	return class, class + 100
+}
+
+func (s FunnelStep) matches(method, path string, status int) bool {
+	from, to := s.statusRange()
+	return method == s.Method && path == s.Path && status >= from && status < to
+}
+
+// FunnelQuery is the body of POST /audit/funnels.
+type FunnelQuery struct {
+	JourneyFilters
+	Steps []FunnelStep
+}
+
+// Validate checks the steps and applies the defaults of the filters.
+func (q *FunnelQuery) Validate() error {
+	if len(q.Steps) < minFunnelSteps || len(q.Steps) > maxFunnelSteps {
+		return fmt.Errorf("a funnel has %d to %d steps", minFunnelSteps, maxFunnelSteps)
+	}
+	for i := range q.Steps {
+		if err := q.Steps[i].validate(); err != nil {
+			return err
+		}
+	}
+	return q.JourneyFilters.validate()
+}
+
+// FunnelStepResult is how many journeys reached a step of a funnel.
+type FunnelStepResult struct {
+	FunnelStep
+	Entered int64 `json:"entered"`
+	// DropOff reached the previous step but not this one.
+	DropOff            int64   `json:"drop_off"`
+	ConversionRate     float64 `json:"conversion_rate"`      // % of the first step
+	StepConversionRate float64 `json:"step_conversion_rate"` // % of the previous step
+	// AvgSecondsFromPrevious is the average time from the previous step.
+	AvgSecondsFromPrevious float64 `json:"avg_seconds_from_previous"`
+}
+
+// FunnelResult is the answer to POST /audit/funnels.
+type FunnelResult struct {
+	By     string             `json:"by"`
+	MaxGap string             `json:"max_step_gap"`
+	Steps  []FunnelStepResult `json:"steps"`
+}
+
+// funnelCounter counts the steps journeys reach, reading the events of one
+// journey after the other, each in time order. Every first-step event starts
+// an attempt, which moves to the next step at its first matching event
+// within the maximum gap and is dropped when the gap runs out. Of the
+// attempts at the same step only the latest is followed, as it has the most
+// time left. A journey counts with its furthest attempt.
+type funnelCounter struct {
+	steps   []FunnelStep
+	maxGap  time.Duration
+	reached []int64
+	waited  []time.Duration // total time from the previous step, per step
+
+	journey  string
+	attempts []funnelAttempt // by steps reached, minus one
+	best     int
+	bestWait []time.Duration
+}
+
+// funnelAttempt is one way through the funnel: when it reached its last step
+// and how long each step took from the previous one.
+type funnelAttempt struct {
+	live bool
+	last time.Time
+	wait []time.Duration
+}
+
+func newFunnelCounter(steps []FunnelStep, maxGap time.Duration) *funnelCounter {
+	f := &funnelCounter{
+		steps:    steps,
+		maxGap:   maxGap,
+		reached:  make([]int64, len(steps)),
+		waited:   make([]time.Duration, len(steps)),
+		attempts: make([]funnelAttempt, len(steps)),
+		bestWait: make([]time.Duration, len(steps)),
+	}
+	for i := range f.attempts {
+		f.attempts[i].wait = make([]time.Duration, len(steps))
+	}
+	return f
+}
+
+func (f *funnelCounter) add(journey, method, path string, status int, at time.Time) {
+	if journey != f.journey {
+		f.flush()
+		f.journey = journey
+	}
+	if f.best == len(f.steps) {
+		return
+	}
+	// From the furthest attempt down, so an event moves each by one step.
+	for i := len(f.attempts) - 1; i >= 0; i-- {
+		a := &f.attempts[i]
+		if !a.live {
+			continue
+		}
+		if at.Sub(a.last) > f.maxGap {
+			a.live = false
+			continue
+		}
+		next := i + 1
+		if next == len(f.steps) || !f.steps[next].matches(method, path, status) {
+			continue
+		}
+		moved := &f.attempts[next]
+		copy(moved.wait, a.wait[:next])
+		moved.wait[next] = at.Sub(a.last)
+		moved.live, moved.last = true, at
+		a.live = false
+		f.reach(next + 1)
+	}
+	if f.steps[0].matches(method, path, status) {
+		f.attempts[0].live, f.attempts[0].last = true, at
+		f.reach(1)
+	}
+}
+
+// reach records that an attempt reached n steps.
+func (f *funnelCounter) reach(n int) {
+	if n > f.best {
+		f.best = n
+		copy(f.bestWait, f.attempts[n-1].wait[:n])
+	}
+}
+
+// flush counts the journey read so far.
+func (f *funnelCounter) flush() {
+	for i := 0; i < f.best; i++ {
+		f.reached[i]++
+		f.waited[i] += f.bestWait[i]
+	}
+	f.best = 0
+	for i := range f.attempts {
+		f.attempts[i].live = false
+	}
+}
+
+func (f *funnelCounter) result() []FunnelStepResult {
+	f.flush()
+	steps := make([]FunnelStepResult, len(f.steps))
+	for i, step := range f.steps {
+		s := FunnelStepResult{FunnelStep: step, Entered: f.reached[i]}
+		if f.reached[0] > 0 {
+			s.ConversionRate = float64(s.Entered) / float64(f.reached[0]) * 100
+		}
+		if i == 0 {
+			s.StepConversionRate = 100
+			if s.Entered == 0 {
+				s.StepConversionRate = 0
+			}
+		} else {
+			s.DropOff = f.reached[i-1] - s.Entered
+			if f.reached[i-1] > 0 {
+				s.StepConversionRate = float64(s.Entered) / float64(f.reached[i-1]) * 100
+			}
+			if s.Entered > 0 {
+				s.AvgSecondsFromPrevious = f.waited[i].Seconds() / float64(s.Entered)
+			}
+		}
+		steps[i] = s
+	}
+	return steps
+}
+
+func (r *repository) Funnel(q FunnelQuery) (*FunnelResult, error) {
+	where, args := q.where()
+	steps := make([]string, len(q.Steps))
+	var stepArgs []any
+	for i, s := range q.Steps {
+		from, to := s.statusRange()
+		steps[i] = "(method = ? AND path = ? AND status_code >= ? AND status_code < ?)"
+		stepArgs = append(stepArgs, s.Method, s.Path, from, to)
+	}
+	journey := journeyColumns[q.By][0]
+	rows, err := r.db.Model(&Audit{}).
+		Select(journey+" AS journey, method, path, status_code, timestamp").
+		Where(where, args...).
+		Where(strings.Join(steps, " OR "), stepArgs...).
+		Order(journey + ", timestamp, id").
+		Rows()
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	counter := newFunnelCounter(q.Steps, q.MaxGap)
+	for rows.Next() {
+		var ev struct {
+			Journey    string
+			Method     string
+			Path       string
+			StatusCode int
+			Timestamp  dialect.Time
+		}
+		if err := r.db.ScanRows(rows, &ev); err != nil {
+			return nil, err
+		}
+		counter.add(ev.Journey, ev.Method, ev.Path, ev.StatusCode, ev.Timestamp.Time)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return &FunnelResult{By: q.By, MaxGap: q.MaxGap.String(), Steps: counter.result()}, nil
+}
+
+// PathQuery asks which routes journeys take after (next) or before
+// (previous) a route.
+type PathQuery struct {
+	JourneyFilters
+	Method    string
+	Path      string
+	Direction string // next (default) | previous
+	Limit     int    // transitions, most common first
+}
+
+// Validate applies the defaults.
+func (q *PathQuery) Validate() error {
+	q.Method = strings.ToUpper(q.Method)
+	if q.Method == "" || q.Path == "" {
+		return errors.New("method and path required")
+	}
+	if q.Direction == "" {
+		q.Direction = "next"
+	}
+	if q.Direction != "next" && q.Direction != "previous" {
+		return errors.New("direction must be next or previous")
+	}
+	if q.Limit == 0 {
+		q.Limit = defaultPathTransitions
+	}
+	if q.Limit < 0 || q.Limit > maxPathTransitions {
+		return fmt.Errorf("limit must be between 1 and %d", maxPathTransitions)
+	}
+	return q.JourneyFilters.validate()
+}
+
+// PathTransition is a route journeys took after or before the queried one.
+type PathTransition struct {
+	Method     string  `json:"method"`
+	Path       string  `json:"path"`
+	Count      int64   `json:"count"`
+	Percent    float64 `json:"percent"` // of the occurrences
+	AvgSeconds float64 `json:"avg_seconds"`
+}
+
+// PathResult is the answer to GET /audit/paths.
+type PathResult struct {
+	Method      string `json:"method"`
+	Path        string `json:"path"`
+	Direction   string `json:"direction"`
+	Occurrences int64  `json:"occurrences"`
+	// None counts the occurrences with no event within the maximum gap
+	// after them (exits) or before them (entries).
+	None        int64            `json:"none"`
+	Transitions []PathTransition `json:"transitions"`
+}
+
+func (r *repository) Paths(q PathQuery) (*PathResult, error) {
+	d := dialect.Of(r.db)
+	where, args := q.where()
+	window, seconds := "LEAD", d.Seconds("timestamp", "other_ts")
+	if q.Direction == "previous" {
+		window, seconds = "LAG", d.Seconds("other_ts", "timestamp")
+	}
+	journey := journeyColumns[q.By][0]
+	seq := `
+		WITH seq AS (
+			SELECT method, path, timestamp,
+				` + window + `(method) OVER w AS other_method,
+				` + window + `(path) OVER w AS other_path,
+				` + window + `(timestamp) OVER w AS other_ts
+			FROM audits
+			WHERE ` + where + `
+			WINDOW w AS (PARTITION BY ` + journey + ` ORDER BY timestamp, id)
+		)`
+	within := "other_ts IS NOT NULL AND " + seconds + " <= ?"
+	gap := q.MaxGap.Seconds()
+
+	var totals struct {
+		Occurrences int64
+		Followed    int64
+	}
+	err := r.db.Raw(seq+`
+		SELECT COUNT(*) AS occurrences, COUNT(CASE WHEN `+within+` THEN 1 END) AS followed
+		FROM seq WHERE method = ? AND path = ?`,
+		append(args, gap, q.Method, q.Path)...).Scan(&totals).Error
+	if err != nil {
+		return nil, err
+	}
+
+	var transitions []PathTransition
+	err = r.db.Raw(seq+`
+		SELECT other_method AS method, other_path AS path, COUNT(*) AS count,
+			AVG(`+seconds+`) AS avg_seconds
+		FROM seq WHERE method = ? AND path = ? AND `+within+`
+		GROUP BY other_method, other_path
+		ORDER BY count DESC, other_method, other_path
+		LIMIT ?`,
+		append(args, q.Method, q.Path, gap, q.Limit)...).Scan(&transitions).Error
+	if err != nil {
+		return nil, err
+	}
+	if transitions == nil {
+		transitions = []PathTransition{}
+	}
+	for i := range transitions {
+		transitions[i].Percent = float64(transitions[i].Count) / float64(totals.Occurrences) * 100
+	}
+	return &PathResult{
+		Method:      q.Method,
+		Path:        q.Path,
+		Direction:   q.Direction,
+		Occurrences: totals.Occurrences,
+		None:        totals.Occurrences - totals.Followed,
+		Transitions: transitions,
+	}, nil
+}
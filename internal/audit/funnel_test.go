@@ -0,0 +1,93 @@
+package audit
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var checkout = []FunnelStep{
+	{Method: "GET", Path: "/cart"},
+	{Method: "POST", Path: "/checkout"},
+	{Method: "POST", Path: "/pay", Status: "2xx"},
+}
+
+func TestFunnelQueryValidate(t *testing.T) {
+	q := FunnelQuery{Steps: []FunnelStep{{Method: "get", Path: "/cart"}, {Method: "POST", Path: "/pay", Status: "2XX"}}}
+	require.NoError(t, q.Validate())
+	assert.Equal(t, "GET", q.Steps[0].Method)
+	assert.Equal(t, "2xx", q.Steps[1].Status)
+	assert.Equal(t, "identifier", q.By)
+	assert.Equal(t, defaultJourneyGap, q.MaxGap)
+	require.NotNil(t, q.StartDate)
+
+	long := time.Now().UTC().AddDate(0, 0, -91)
+	for name, q := range map[string]FunnelQuery{
+		"one step":       {Steps: checkout[:1]},
+		"no path":        {Steps: []FunnelStep{{Method: "GET"}, {Method: "GET", Path: "/b"}}},
+		"bad status":     {Steps: []FunnelStep{{Method: "GET", Path: "/a", Status: "6xx"}, {Method: "GET", Path: "/b"}}},
+		"unknown by":     {Steps: checkout, JourneyFilters: JourneyFilters{By: "tenant"}},
+		"gap too long":   {Steps: checkout, JourneyFilters: JourneyFilters{MaxGap: 8 * 24 * time.Hour}},
+		"range too long": {Steps: checkout, JourneyFilters: JourneyFilters{StartDate: &long}},
+	} {
+		assert.Error(t, q.Validate(), name)
+	}
+}
+
+func TestFunnelCounter(t *testing.T) {
+	t0 := time.Date(2024, 1, 15, 10, 0, 0, 0, time.UTC)
+	at := func(minutes int) time.Time { return t0.Add(time.Duration(minutes) * time.Minute) }
+	f := newFunnelCounter(checkout, 30*time.Minute)
+
+	// alice converts, with a detour.
+	f.add("alice", "GET", "/cart", 200, at(0))
+	f.add("alice", "GET", "/cart", 200, at(1))
+	f.add("alice", "POST", "/checkout", 200, at(10))
+	f.add("alice", "POST", "/pay", 402, at(12))
+	f.add("alice", "POST", "/pay", 201, at(20))
+	// bob waits too long for checkout, then tries again.
+	f.add("bob", "GET", "/cart", 200, at(0))
+	f.add("bob", "POST", "/checkout", 200, at(45))
+	f.add("bob", "GET", "/cart", 200, at(60))
+	f.add("bob", "POST", "/checkout", 200, at(70))
+	// carol never gets to the cart.
+	f.add("carol", "POST", "/checkout", 200, at(0))
+	// dave only sees the cart.
+	f.add("dave", "GET", "/cart", 200, at(0))
+
+	steps := f.result()
+	require.Len(t, steps, 3)
+	assert.Equal(t, []int64{3, 2, 1}, []int64{steps[0].Entered, steps[1].Entered, steps[2].Entered})
+	assert.Equal(t, []int64{0, 1, 1}, []int64{steps[0].DropOff, steps[1].DropOff, steps[2].DropOff})
+	assert.Equal(t, 100.0, steps[0].StepConversionRate)
+	assert.Equal(t, 50.0, steps[2].StepConversionRate)
+	assert.InDelta(t, 33.33, steps[2].ConversionRate, 0.01)
+	// From the latest cart view: 9 minutes for alice, 10 for bob.
+	assert.Equal(t, 570.0, steps[1].AvgSecondsFromPrevious)
+	assert.Equal(t, 600.0, steps[2].AvgSecondsFromPrevious)
+}
+
+func TestFunnelCounter_repeatedSteps(t *testing.T) {
+	t0 := time.Date(2024, 1, 15, 10, 0, 0, 0, time.UTC)
+	at := func(minutes int) time.Time { return t0.Add(time.Duration(minutes) * time.Minute) }
+	f := newFunnelCounter(checkout, 30*time.Minute)
+
+	// alice views the cart again before the gap runs out: checkout is 15
+	// minutes after the second view, though 40 after the first.
+	f.add("alice", "GET", "/cart", 200, at(0))
+	f.add("alice", "GET", "/cart", 200, at(25))
+	f.add("alice", "POST", "/checkout", 200, at(40))
+	// bob goes back to the cart after checking out, then pays.
+	f.add("bob", "GET", "/cart", 200, at(0))
+	f.add("bob", "POST", "/checkout", 200, at(5))
+	f.add("bob", "GET", "/cart", 200, at(10))
+	f.add("bob", "POST", "/pay", 201, at(15))
+
+	steps := f.result()
+	require.Len(t, steps, 3)
+	assert.Equal(t, []int64{2, 2, 1}, []int64{steps[0].Entered, steps[1].Entered, steps[2].Entered})
+	assert.Equal(t, 600.0, steps[1].AvgSecondsFromPrevious)
+	assert.Equal(t, 600.0, steps[2].AvgSecondsFromPrevious)
+}
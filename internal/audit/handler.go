@@ -4,13 +4,19 @@ import (
 	"context"
 	"encoding/csv"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"log/slog"
 	"net/http"
+	"slices"
+	"strings"
 	"time"
 
 	"github.com/gin-gonic/gin"
 	"github.com/go-playground/validator/v10"
 	"github.com/google/uuid"
+	"github.com/joaovrmoraes/bataudit/internal/auth"
+	"github.com/joaovrmoraes/bataudit/internal/metrics"
 	"github.com/joaovrmoraes/bataudit/internal/queue"
 	"gorm.io/gorm"
 )
@@ -19,7 +25,11 @@ type Handler struct {
 	validator  *validator.Validate
 	repository Repository
 	service    *Service
-	queryDB    *gorm.DB // connection used by the SQL Query Console (READ ONLY tx)
+	queryDB    *gorm.DB     // connection used by the SQL Query Console (READ ONLY tx)
+	opener     Opener       // nil = sealed fields are always returned as stored
+	tail       *Tail        // nil = live tail unavailable
+	scope      ProjectScope // nil = no live tail; traces and identities span every project
+	geo        Geolocator   // nil = identity profiles list no countries
 }
 
 // SetQueryDB wires the connection used by the SQL Query Console.
@@ -27,6 +37,40 @@ func (h *Handler) SetQueryDB(db *gorm.DB) {
 	h.queryDB = db
 }
 
+// SetLiveTail enables GET /audit/stream. It needs a project scope.
+func (h *Handler) SetLiveTail(t *Tail) {
+	h.tail = t
+}
+
+// SetProjectScope limits the live tail, traces and identity profiles to the
+// projects the caller may read.
+func (h *Handler) SetProjectScope(scope ProjectScope) {
+	h.scope = scope
+}
+
+// SetGeolocator resolves the IPs of identity profiles to countries.
+func (h *Handler) SetGeolocator(g Geolocator) {
+	h.geo = g
+}
+
+// readableProjects returns the projects the caller may read, nil for every
+// project when there is no scope. It writes a 500 when they cannot be
+// resolved.
+func (h *Handler) readableProjects(c *gin.Context) ([]string, bool) {
+	if h.scope == nil {
+		return nil, true
+	}
+	projects, err := h.scope.ReadableProjects(c.GetString("user_id"), c.GetString("user_role"))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to resolve projects", "details": err.Error()})
+		return nil, false
+	}
+	if projects == nil {
+		projects = []string{}
+	}
+	return projects, true
+}
+
 // ProjectResolver resolves or auto-creates a project for a given service_name + api_key_id.
 type ProjectResolver interface {
 	EnsureProject(serviceName, apiKeyID string) (string, error)
@@ -67,38 +111,51 @@ func (h *QueueHandler) RegisterWriteRoutes(router *gin.RouterGroup) {
 func (h *Handler) RegisterReadRoutes(router *gin.RouterGroup) {
 	router.GET("", h.List)
 	router.GET("/export", h.Export)
+	router.GET("/stream", h.Stream)
 	router.GET("/stats", h.Stats)
 	router.GET("/sessions", h.Sessions)
 	router.GET("/sessions/:session_id", h.SessionByID)
+	router.GET("/session-settings", h.GetSessionSettings)
+	router.PUT("/session-settings", h.SaveSessionSettings)
 	router.GET("/orphans", h.Orphans)
+	router.GET("/traces/:trace_id", h.TraceByID)
 	router.GET("/insights", h.Insights)
+	router.POST("/aggregate", h.Aggregate)
+	router.GET("/latency", h.Latency)
+	router.POST("/funnels", h.Funnel)
+	router.GET("/paths", h.Paths)
 	router.GET("/affected-users", h.AffectedUsers)
+	router.GET("/identities/:identifier", h.Identity)
+	router.GET("/identities/:identifier/timeline", h.IdentityTimeline)
 	router.POST("/query", h.Query)
+	router.GET("/verify", h.Verify)
 	router.GET("/:id", h.Details)
 }
 
 // Query runs an ad-hoc read-only SQL SELECT against the audit data (SQL Query
 // Console / Studio). Owner/admin only. Writes are impossible: the query runs on
 // a read-only role inside a READ ONLY transaction with a statement timeout.
+// Field filters sent with the query replace its {{filters}} placeholder, as
+// bound parameters (see ExpandFilters).
 //
 // @Summary      Run a read-only SQL query
 // @Tags         audit
 // @Accept       json
 // @Produce      json
 // @Security     BearerAuth
-// @Param        body  body      object  true  "{ \"sql\": \"SELECT ...\" }"
+// @Param        body  body      object  true  "{ \"sql\": \"SELECT ... WHERE {{filters}}\", \"filters\": [\"body.customer.id=123\"] }"
 // @Success      200   {object}  QueryResult
 // @Failure      400   {object}  map[string]string
 // @Failure      403   {object}  map[string]string
 // @Router       /audit/query [post]
 func (h *Handler) Query(c *gin.Context) {
-	if role := c.GetString("user_role"); role != "owner" && role != "admin" {
-		c.JSON(http.StatusForbidden, gin.H{"error": "owner or admin only"})
+	if !auth.RequireManager(c) {
 		return
 	}
 
 	var req struct {
-		SQL string `json:"sql"`
+		SQL     string   `json:"sql"`
+		Filters []string `json:"filters"`
 	}
 	if err := c.ShouldBindJSON(&req); err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid request body"})
@@ -110,11 +167,52 @@ func (h *Handler) Query(c *gin.Context) {
 		return
 	}
 
-	result, err := RunQuery(c.Request.Context(), h.queryDB, req.SQL)
+	sql, args, err := ExpandFilters(req.SQL, req.Filters, h.queryDB.Dialector.Name())
 	if err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 		return
 	}
+
+	result, err := RunQuery(c.Request.Context(), h.queryDB, sql, args...)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, result)
+}
+
+// Verify godoc
+// @Summary      Verify a project's hash chain
+// @Description  Recomputes the hash of every stored event in the range and checks each link to the previous one. Ranges removed by tiering, archiving or partition drops are crossed through their checkpoints. Reports the first break: an edited event (hash_mismatch), a rewritten link (link_mismatch), events deleted directly (missing), a forged position (duplicate) or a truncated tail (head_mismatch).
+// @Tags         audit
+// @Produce      json
+// @Security     BearerAuth
+// @Param        project_id  query     string  true   "Project ID"
+// @Param        from_seq    query     int     false  "First chain position (default: 1)"
+// @Param        to_seq      query     int     false  "Last chain position (default: head)"
+// @Success      200         {object}  ChainVerification
+// @Failure      400         {object}  map[string]string
+// @Failure      500         {object}  map[string]string
+// @Router       /audit/verify [get]
+func (h *Handler) Verify(c *gin.Context) {
+	projectID := c.Query("project_id")
+	if projectID == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "project_id required"})
+		return
+	}
+	var fromSeq, toSeq int64
+	if v := c.Query("from_seq"); v != "" {
+		_, _ = fmt.Sscanf(v, "%d", &fromSeq)
+	}
+	if v := c.Query("to_seq"); v != "" {
+		_, _ = fmt.Sscanf(v, "%d", &toSeq)
+	}
+
+	result, err := h.repository.VerifyChain(c.Request.Context(), projectID, fromSeq, toSeq)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "verification failed", "details": err.Error()})
+		return
+	}
 	c.JSON(http.StatusOK, result)
 }
 
@@ -135,6 +233,7 @@ func (h *QueueHandler) Create(c *gin.Context) {
 	var audit Audit
 
 	if err := c.ShouldBindJSON(&audit); err != nil {
+		metrics.IngestEvents.Inc("", "rejected", "BAT-001")
 		c.JSON(http.StatusBadRequest, gin.H{
 			"error":   "Invalid JSON format",
 			"details": err.Error(),
@@ -158,6 +257,7 @@ func (h *QueueHandler) Create(c *gin.Context) {
 		var validationErrors []map[string]string
 
 		for _, err := range err.(validator.ValidationErrors) {
+			metrics.ValidationFailures.Inc(err.Field(), err.Tag())
 			fieldErr := map[string]string{
 				"field":   err.Field(),
 				"value":   fmt.Sprintf("%v", err.Value()),
@@ -168,6 +268,7 @@ func (h *QueueHandler) Create(c *gin.Context) {
 			validationErrors = append(validationErrors, fieldErr)
 		}
 
+		metrics.IngestEvents.Inc(audit.ProjectID, "rejected", "BAT-002")
 		c.JSON(http.StatusBadRequest, gin.H{
 			"error":      "Validation failed",
 			"validation": validationErrors,
@@ -177,6 +278,8 @@ func (h *QueueHandler) Create(c *gin.Context) {
 		return
 	}
 
+	ApplyTraceparent(&audit)
+
 	if audit.ID == "" {
 		audit.ID = uuid.New().String()
 	}
@@ -203,6 +306,7 @@ func (h *QueueHandler) Create(c *gin.Context) {
 
 	err := h.queue.Enqueue(ctx, audit)
 	if err != nil {
+		metrics.IngestEvents.Inc(audit.ProjectID, "rejected", "BAT-003")
 		c.JSON(http.StatusInternalServerError, gin.H{
 			"error":   "Failed to queue audit event",
 			"details": err.Error(),
@@ -212,6 +316,7 @@ func (h *QueueHandler) Create(c *gin.Context) {
 		return
 	}
 
+	metrics.IngestEvents.Inc(audit.ProjectID, "accepted", "")
 	c.JSON(http.StatusAccepted, gin.H{
 		"message":    "Audit received and will be processed",
 		"status":     "success",
@@ -223,7 +328,7 @@ func (h *QueueHandler) Create(c *gin.Context) {
 
 // List godoc
 // @Summary      List audit events
-// @Description  Returns a paginated list of audit events with optional filters
+// @Description  Returns a paginated list of audit events with optional filters. Every page returns a next_cursor; passing it as cursor continues by keyset, which stays fast on deep pages. With q, only events matching the full-text search are listed, each with a snippet of the best match (HTML-escaped, matches in <mark> tags).
 // @Tags         audit
 // @Produce      json
 // @Security     BearerAuth
@@ -235,11 +340,19 @@ func (h *QueueHandler) Create(c *gin.Context) {
 // @Param        method       query     string  false  "Filter by HTTP method (GET, POST, PUT, DELETE, PATCH)"
 // @Param        status_code  query     int     false  "Filter by HTTP status code"
 // @Param        environment  query     string  false  "Filter by environment (prod, staging, dev)"
+// @Param        trace_id     query     string  false  "Filter by trace ID"
 // @Param        start_date   query     string  false  "Filter from date (ISO 8601)"
 // @Param        end_date     query     string  false  "Filter to date (ISO 8601)"
 // @Param        sort_by      query     string  false  "Sort column: timestamp | status_code | response_time (default: timestamp)"
 // @Param        sort_order   query     string  false  "Sort direction: asc | desc (default: desc)"
+// @Param        q            query     string  false  "Full-text search over path, error message, user fields and body values: words, quoted phrases and prefix* terms"
+// @Param        filter       query     []string  false  "JSON field filter, repeatable: body.customer.id=123, query.page>5, response.status!=ok, roles contains admin"  collectionFormat(multi)
+// @Param        rehydrated   query     bool    false  "List restored archive events instead of live ones"
+// @Param        rehydration_id query   string  false  "With rehydrated=true, only events from this rehydration"
+// @Param        cursor       query     string  false  "Continue after the page that returned this next_cursor; page is ignored"
+// @Param        total        query     string  false  "exact (default) | estimate | none (default with cursor)"
 // @Success      200          {object}  map[string]interface{}
+// @Failure      400          {object}  map[string]string
 // @Failure      500          {object}  map[string]string
 // @Router       /audit [get]
 func (h *Handler) List(c *gin.Context) {
@@ -261,6 +374,124 @@ func (h *Handler) List(c *gin.Context) {
 
 	offset := (page - 1) * limit
 
+	filters, ok := listFilters(c)
+	if !ok {
+		return
+	}
+	filters.SortBy = c.Query("sort_by")
+	filters.SortOrder = c.Query("sort_order")
+	filters.Rehydrated = c.Query("rehydrated") == "true"
+	filters.RehydrationID = c.Query("rehydration_id")
+
+	if cur := c.Query("cursor"); cur != "" {
+		after, err := ParseCursor(cur)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		if sortCol, sortOrder := listOrder(filters); after.SortBy != sortCol || after.Order != sortOrder {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "cursor does not match sort_by and sort_order"})
+			return
+		}
+		filters.After = after
+		filters.Total = TotalNone
+	}
+	switch total := TotalMode(c.Query("total")); total {
+	case "":
+	case TotalExact, TotalEstimate, TotalNone:
+		filters.Total = total
+	default:
+		c.JSON(http.StatusBadRequest, gin.H{"error": "total must be exact, estimate or none"})
+		return
+	}
+
+	result, err := h.service.ListAudits(limit, offset, filters)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error":   "Failed to retrieve audit records",
+			"details": err.Error(),
+		})
+		return
+	}
+
+	pagination := gin.H{
+		"limit":       limit,
+		"next_cursor": result.NextCursor,
+	}
+	if filters.After == nil {
+		pagination["page"] = page
+	}
+	if filters.Total != TotalNone {
+		pagination["totalItems"] = result.TotalItems
+		pagination["totalPage"] = (result.TotalItems + int64(limit) - 1) / int64(limit)
+		if result.TotalEstimated {
+			pagination["total_estimated"] = true
+		}
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"data":       result.Data,
+		"pagination": pagination,
+	})
+}
+
+// Stream godoc
+// @Summary      Live tail of audit events
+// @Description  Server-Sent Events feed of events as the Worker stores them, with the filters of the list endpoint (sort, pagination and rehydrated aside). Each "audit" message carries an event and, as its ID, the stream position: reconnecting with that ID in Last-Event-ID (or last_event_id) delivers exactly the events stored meanwhile. A "ready" message opens the stream. Only projects the caller is a member of are streamed (all projects for owners).
+// @Tags         audit
+// @Produce      text/event-stream
+// @Security     BearerAuth
+// @Param        Last-Event-ID  header  string  false  "Resume after this position"
+// @Param        last_event_id  query   string  false  "Resume after this position, for clients that cannot set headers"
+// @Param        project_id   query     string  false  "Filter by project ID"
+// @Param        service_name query     string  false  "Filter by service name"
+// @Param        identifier   query     string  false  "Filter by user/client identifier"
+// @Param        method       query     string  false  "Filter by HTTP method"
+// @Param        status_code  query     int     false  "Filter by HTTP status code"
+// @Param        status_class query     string  false  "Filter by status class: 2xx | 3xx | 4xx | 5xx"
+// @Param        environment  query     string  false  "Filter by environment"
+// @Param        event_type   query     string  false  "Filter by event type: http | system.alert"
+// @Param        trace_id     query     string  false  "Filter by trace ID"
+// @Param        q            query     string  false  "Full-text search, as on the list endpoint"
+// @Param        filter       query     []string  false  "JSON field filter, repeatable, as on the list endpoint"  collectionFormat(multi)
+// @Success      200          {object}  TailEvent
+// @Failure      400          {object}  map[string]string
+// @Failure      403          {object}  map[string]string
+// @Failure      503          {object}  map[string]string
+// @Router       /audit/stream [get]
+func (h *Handler) Stream(c *gin.Context) {
+	if h.tail == nil || h.scope == nil {
+		c.JSON(http.StatusServiceUnavailable, gin.H{"error": "live tail unavailable"})
+		return
+	}
+	filters, ok := listFilters(c)
+	if !ok {
+		return
+	}
+
+	projects, err := h.scope.ReadableProjects(c.GetString("user_id"), c.GetString("user_role"))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to resolve projects", "details": err.Error()})
+		return
+	}
+	if filters.ProjectID != "" {
+		if !slices.Contains(projects, filters.ProjectID) {
+			c.JSON(http.StatusForbidden, gin.H{"error": "no access to project"})
+			return
+		}
+		projects = []string{filters.ProjectID}
+	}
+	if len(projects) == 0 {
+		c.JSON(http.StatusForbidden, gin.H{"error": "no projects to stream"})
+		return
+	}
+
+	h.tail.Serve(c, "audit", filters, projects, func(ev TailEvent) any { return ev })
+}
+
+// listFilters reads the event filters shared by List and Stream. It responds
+// 400 and returns false when the search or a field filter does not parse.
+func listFilters(c *gin.Context) (ListFilters, bool) {
 	filters := ListFilters{
 		ProjectID:   c.Query("project_id"),
 		ServiceName: c.Query("service_name"),
@@ -270,13 +501,17 @@ func (h *Handler) List(c *gin.Context) {
 		Environment: c.Query("environment"),
 		StatusClass: c.Query("status_class"),
 		EventType:   c.Query("event_type"),
-		SortBy:      c.Query("sort_by"),
-		SortOrder:   c.Query("sort_order"),
+		TraceID:     strings.ToLower(c.Query("trace_id")),
+		Search:      c.Query("q"),
+		Fields:      c.QueryArray("filter"),
 	}
 
 	if sc := c.Query("status_code"); sc != "" {
 		_, _ = fmt.Sscanf(sc, "%d", &filters.StatusCode)
 	}
+	if !validSearch(c, filters.Search) || !validFieldFilters(c, filters.Fields) {
+		return ListFilters{}, false
+	}
 
 	if sd := c.Query("start_date"); sd != "" {
 		if t, err := time.Parse(time.RFC3339, sd); err == nil {
@@ -288,41 +523,25 @@ func (h *Handler) List(c *gin.Context) {
 			filters.EndDate = &t
 		}
 	}
-
-	result, err := h.service.ListAudits(limit, offset, filters)
-	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{
-			"error":   "Failed to retrieve audit records",
-			"details": err.Error(),
-		})
-		return
-	}
-
-	totalPages := (result.TotalItems + int64(limit) - 1) / int64(limit)
-
-	c.JSON(http.StatusOK, gin.H{
-		"data": result.Data,
-		"pagination": gin.H{
-			"page":       page,
-			"totalPage":  totalPages,
-			"limit":      limit,
-			"totalItems": result.TotalItems,
-		},
-	})
+	return filters, true
 }
 
 // Sessions godoc
 // @Summary      List sessions
-// @Description  Returns derived user sessions using a 30-minute inactivity gap algorithm
+// @Description  Returns user sessions, newest first, maintained by the Worker as events arrive: explicit sessions by session_id, derived ones by identifier and service with the project's inactivity timeout (default 30 minutes). Pages are continued with next_cursor. With filter, sessions are derived from the matching raw events instead (last 7 days by default, up to 200, no pagination).
 // @Tags         audit
 // @Produce      json
 // @Security     BearerAuth
 // @Param        project_id   query     string  false  "Filter by project ID"
 // @Param        identifier   query     string  false  "Filter by user/client identifier"
 // @Param        service_name query     string  false  "Filter by service name"
-// @Param        start_date   query     string  false  "Filter from date (ISO 8601)"
-// @Param        end_date     query     string  false  "Filter to date (ISO 8601)"
+// @Param        start_date   query     string  false  "Sessions with events from this date (ISO 8601)"
+// @Param        end_date     query     string  false  "Sessions with events until this date (ISO 8601)"
+// @Param        limit        query     int     false  "Sessions per page (default: 100, max: 1000)"
+// @Param        cursor       query     string  false  "next_cursor of the previous page"
+// @Param        filter       query     []string  false  "JSON field filter on the events, repeatable, as on the list endpoint"  collectionFormat(multi)
 // @Success      200          {object}  map[string]interface{}
+// @Failure      400          {object}  map[string]string
 // @Failure      500          {object}  map[string]string
 // @Router       /audit/sessions [get]
 func (h *Handler) Sessions(c *gin.Context) {
@@ -330,6 +549,17 @@ func (h *Handler) Sessions(c *gin.Context) {
 		ProjectID:   c.Query("project_id"),
 		Identifier:  c.Query("identifier"),
 		ServiceName: c.Query("service_name"),
+		Fields:      c.QueryArray("filter"),
+		Limit:       DefaultSessionLimit,
+	}
+	if !validFieldFilters(c, filters.Fields) {
+		return
+	}
+	if l := c.Query("limit"); l != "" {
+		_, _ = fmt.Sscanf(l, "%d", &filters.Limit)
+	}
+	if filters.Limit <= 0 || filters.Limit > MaxSessionLimit {
+		filters.Limit = DefaultSessionLimit
 	}
 	if sd := c.Query("start_date"); sd != "" {
 		if t, err := time.Parse(time.RFC3339, sd); err == nil {
@@ -341,13 +571,101 @@ func (h *Handler) Sessions(c *gin.Context) {
 			filters.EndDate = &t
 		}
 	}
+	if cur := c.Query("cursor"); cur != "" {
+		after, err := ParseCursor(cur)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		if after.SortBy != sessionCursorSort || after.Order != "desc" {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "cursor does not come from the session list"})
+			return
+		}
+		filters.After = after
+	}
 
-	sessions, err := h.service.GetSessions(filters)
+	page, err := h.service.GetSessions(filters)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to retrieve sessions"})
 		return
 	}
-	c.JSON(http.StatusOK, gin.H{"data": sessions})
+	c.JSON(http.StatusOK, gin.H{
+		"data": page.Data,
+		"pagination": gin.H{
+			"limit":       filters.Limit,
+			"next_cursor": page.NextCursor,
+		},
+	})
+}
+
+// GetSessionSettings godoc
+// @Summary      Get a project's session settings
+// @Description  Returns the inactivity timeout after which a derived session of the project ends. default is set when the project uses the instance default of 30 minutes.
+// @Tags         audit
+// @Produce      json
+// @Security     BearerAuth
+// @Param        project_id  query     string  true  "Project ID"
+// @Success      200         {object}  SessionSettings
+// @Failure      400         {object}  map[string]string
+// @Failure      500         {object}  map[string]string
+// @Router       /audit/session-settings [get]
+func (h *Handler) GetSessionSettings(c *gin.Context) {
+	projectID := c.Query("project_id")
+	if projectID == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "project_id required"})
+		return
+	}
+	settings, err := h.repository.GetSessionSettings(projectID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to retrieve session settings", "details": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, settings)
+}
+
+// SaveSessionSettings godoc
+// @Summary      Set a project's session inactivity timeout
+// @Description  Sets the inactivity timeout of the project's derived sessions, from 60 seconds to 24 hours. It applies to the events stored from then on; existing sessions are kept as they are. Owner or admin only.
+// @Tags         audit
+// @Accept       json
+// @Produce      json
+// @Security     BearerAuth
+// @Param        body  body      object  true  "{ \"project_id\": \"...\", \"inactivity_timeout_seconds\": 900 }"
+// @Success      200   {object}  SessionSettings
+// @Failure      400   {object}  map[string]string
+// @Failure      403   {object}  map[string]string
+// @Failure      500   {object}  map[string]string
+// @Router       /audit/session-settings [put]
+func (h *Handler) SaveSessionSettings(c *gin.Context) {
+	if !auth.RequireManager(c) {
+		return
+	}
+
+	var req struct {
+		ProjectID                string `json:"project_id"`
+		InactivityTimeoutSeconds int    `json:"inactivity_timeout_seconds"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid request body"})
+		return
+	}
+	if req.ProjectID == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "project_id required"})
+		return
+	}
+	timeout := time.Duration(req.InactivityTimeoutSeconds) * time.Second
+	if timeout < MinSessionTimeout || timeout > MaxSessionTimeout {
+		c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("inactivity_timeout_seconds must be between %d and %d",
+			int(MinSessionTimeout/time.Second), int(MaxSessionTimeout/time.Second))})
+		return
+	}
+
+	settings := &SessionSettings{ProjectID: req.ProjectID, InactivityTimeoutSeconds: req.InactivityTimeoutSeconds}
+	if err := h.repository.SaveSessionSettings(settings); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to save session settings", "details": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, settings)
 }
 
 // SessionByID godoc
@@ -375,30 +693,152 @@ func (h *Handler) SessionByID(c *gin.Context) {
 	c.JSON(http.StatusOK, detail)
 }
 
+// statsPeriods are the periods GET /audit/stats accepts, ending now.
+var statsPeriods = map[string]time.Duration{
+	"24h": 24 * time.Hour,
+	"7d":  7 * 24 * time.Hour,
+	"30d": 30 * 24 * time.Hour,
+	"90d": 90 * 24 * time.Hour,
+}
+
 // Stats godoc
 // @Summary      Audit statistics
-// @Description  Returns aggregated metrics: totals, error rates, response times (avg + p95), active services, 24h timeline, breakdown by service/status/method
+// @Description  Returns aggregated metrics: totals, error rates, response times (avg + p95), active services, 24h timeline, breakdown by service/status/method. Covers every event unless a period or start_date/end_date is given. With compare, returns the stats of both windows and their deltas instead (StatsComparison); the window defaults to the last 24h.
 // @Tags         audit
 // @Produce      json
 // @Security     BearerAuth
-// @Param        project_id  query     string  false  "Filter by project ID (omit for all projects)"
-// @Success      200         {object}  AuditStats
-// @Failure      500         {object}  map[string]string
+// @Param        project_id     query     string  false  "Filter by project ID (omit for all projects)"
+// @Param        period         query     string  false  "Window ending now: 24h | 7d | 30d | 90d"
+// @Param        start_date     query     string  false  "Window start (ISO 8601)"
+// @Param        end_date       query     string  false  "Window end, exclusive (ISO 8601)"
+// @Param        compare        query     string  false  "previous_period | same_period_last_week | custom"
+// @Param        compare_start  query     string  false  "Start of the compared window, for compare=custom (ISO 8601)"
+// @Param        compare_end    query     string  false  "End of the compared window, for compare=custom (ISO 8601)"
+// @Success      200            {object}  AuditStats
+// @Failure      400            {object}  map[string]string
+// @Failure      500            {object}  map[string]string
 // @Router       /audit/stats [get]
 func (h *Handler) Stats(c *gin.Context) {
-	projectID := c.Query("project_id")
-	environment := c.Query("environment")
-	stats, err := h.service.GetStats(projectID, environment)
+	filters := StatsFilters{
+		ProjectID:   c.Query("project_id"),
+		Environment: c.Query("environment"),
+	}
+	now := time.Now().UTC()
+	if period := c.Query("period"); period != "" {
+		length, ok := statsPeriods[period]
+		if !ok {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "period must be 24h, 7d, 30d or 90d"})
+			return
+		}
+		start := now.Add(-length)
+		filters.Start, filters.End = &start, &now
+	}
+	if sd := c.Query("start_date"); sd != "" {
+		if t, err := time.Parse(time.RFC3339, sd); err == nil {
+			filters.Start = &t
+		}
+	}
+	if ed := c.Query("end_date"); ed != "" {
+		if t, err := time.Parse(time.RFC3339, ed); err == nil {
+			filters.End = &t
+		}
+	}
+
+	if c.Query("compare") == "" {
+		stats, err := h.service.GetStats(filters)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to retrieve stats"})
+			return
+		}
+		c.JSON(http.StatusOK, stats)
+		return
+	}
+
+	// A comparison needs a bounded window: the last 24h by default.
+	if filters.End == nil {
+		filters.End = &now
+	}
+	if filters.Start == nil {
+		start := filters.End.Add(-24 * time.Hour)
+		filters.Start = &start
+	}
+	previous, ok := comparisonWindow(c, Window{Start: *filters.Start, End: *filters.End})
+	if !ok {
+		return
+	}
+	result, err := h.service.CompareStats(filters, previous)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to retrieve stats"})
 		return
 	}
-	c.JSON(http.StatusOK, stats)
+	c.JSON(http.StatusOK, result)
+}
+
+// comparisonWindow returns the window the compare parameter asks to compare
+// current with, writing a 400 when it is invalid.
+func comparisonWindow(c *gin.Context, current Window) (Window, bool) {
+	var custom *Window
+	if c.Query("compare") == CompareCustom {
+		start, startErr := time.Parse(time.RFC3339, c.Query("compare_start"))
+		end, endErr := time.Parse(time.RFC3339, c.Query("compare_end"))
+		if startErr == nil && endErr == nil {
+			custom = &Window{Start: start, End: end}
+		}
+	}
+	previous, err := ComparisonWindow(c.Query("compare"), current, custom)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return Window{}, false
+	}
+	return previous, true
+}
+
+// SetOpener wires the decryption of sealed fields in Details.
+func (h *Handler) SetOpener(o Opener) {
+	h.opener = o
+}
+
+// open decrypts the sealed fields of ev for callers allowed to see them,
+// writing a 500 when decryption fails. Others get the envelopes as stored.
+func (h *Handler) open(c *gin.Context, ev *Audit) bool {
+	if h.opener == nil || !c.GetBool("can_decrypt") {
+		return true
+	}
+	if err := h.opener.Open(c.Request.Context(), ev); err != nil {
+		slog.Error("decrypting event fields failed", "event_id", ev.ID, "error", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to decrypt event fields"})
+		return false
+	}
+	slog.Info("event fields decrypted", "event_id", ev.ID, "user_id", c.GetString("user_id"))
+	return true
+}
+
+// validSearch reports whether q is a valid full-text query, writing a 400
+// when not.
+func validSearch(c *gin.Context, q string) bool {
+	if q == "" {
+		return true
+	}
+	if _, err := ParseSearch(q); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return false
+	}
+	return true
+}
+
+// validFieldFilters responds 400 and returns false when a filter parameter
+// does not parse.
+func validFieldFilters(c *gin.Context, filters []string) bool {
+	if _, err := ParseFieldFilters(filters); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return false
+	}
+	return true
 }
 
 // Details godoc
 // @Summary      Get audit event
-// @Description  Returns full details of a single audit event by ID
+// @Description  Returns full details of a single audit event by ID. Unexpired rehydrated archive events are found too and carry "rehydrated": true. Encrypted fields are decrypted for users with the can_decrypt permission and returned as stored otherwise.
 // @Tags         audit
 // @Produce      json
 // @Security     BearerAuth
@@ -410,6 +850,19 @@ func (h *Handler) Stats(c *gin.Context) {
 func (h *Handler) Details(c *gin.Context) {
 	id := c.Param("id")
 	audit, err := h.service.GetAuditByID(id)
+	if err == gorm.ErrRecordNotFound {
+		// Fall back to restored archive events.
+		if restored, rerr := h.repository.GetRehydratedByID(id); rerr == nil {
+			if !h.open(c, restored) {
+				return
+			}
+			c.JSON(http.StatusOK, struct {
+				*Audit
+				Rehydrated bool `json:"rehydrated"`
+			}{restored, true})
+			return
+		}
+	}
 	if err != nil {
 		if err == gorm.ErrRecordNotFound {
 			c.JSON(http.StatusNotFound, gin.H{
@@ -424,12 +877,15 @@ func (h *Handler) Details(c *gin.Context) {
 		return
 	}
 
+	if !h.open(c, audit) {
+		return
+	}
 	c.JSON(http.StatusOK, audit)
 }
 
 // Export godoc
 // @Summary      Export audit events
-// @Description  Downloads audit events as CSV or JSON with the same filters as the list endpoint. Max 100,000 rows.
+// @Description  Downloads audit events as CSV or JSON with the same filters as the list endpoint. Max 100,000 rows. Rows are streamed as they are read.
 // @Tags         audit
 // @Produce      text/csv,application/json
 // @Security     BearerAuth
@@ -442,6 +898,10 @@ func (h *Handler) Details(c *gin.Context) {
 // @Param        environment  query     string  false  "Filter by environment"
 // @Param        start_date   query     string  false  "Filter from date (ISO 8601)"
 // @Param        end_date     query     string  false  "Filter to date (ISO 8601)"
+// @Param        q            query     string  false  "Full-text search, as on the list endpoint"
+// @Param        filter       query     []string  false  "JSON field filter, repeatable, as on the list endpoint"  collectionFormat(multi)
+// @Param        rehydrated   query     bool    false  "Export restored archive events instead of live ones"
+// @Param        rehydration_id query   string  false  "With rehydrated=true, only events from this rehydration"
 // @Success      200
 // @Failure      400  {object}  map[string]string
 // @Failure      500  {object}  map[string]string
@@ -457,10 +917,18 @@ func (h *Handler) Export(c *gin.Context) {
 		Environment: c.Query("environment"),
 		StatusClass: c.Query("status_class"),
 		EventType:   c.Query("event_type"),
+		Search:      c.Query("q"),
+		Fields:      c.QueryArray("filter"),
+
+		Rehydrated:    c.Query("rehydrated") == "true",
+		RehydrationID: c.Query("rehydration_id"),
 	}
 	if sc := c.Query("status_code"); sc != "" {
 		_, _ = fmt.Sscanf(sc, "%d", &filters.StatusCode)
 	}
+	if !validSearch(c, filters.Search) || !validFieldFilters(c, filters.Fields) {
+		return
+	}
 	if sd := c.Query("start_date"); sd != "" {
 		if t, err := time.Parse(time.RFC3339, sd); err == nil {
 			filters.StartDate = &t
@@ -472,34 +940,46 @@ func (h *Handler) Export(c *gin.Context) {
 		}
 	}
 
-	rows, err := h.repository.Export(filters, maxRows+1)
-	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "export failed"})
-		return
-	}
-	if len(rows) > maxRows {
-		c.JSON(http.StatusBadRequest, gin.H{
-			"error": fmt.Sprintf("result exceeds %d rows — narrow the date range and try again", maxRows),
-		})
-		return
-	}
-
 	format := c.DefaultQuery("format", "csv")
 	dateTag := time.Now().UTC().Format("2006-01-02")
 
-	switch format {
-	case "json":
-		c.Header("Content-Disposition", fmt.Sprintf(`attachment; filename="bataudit-export-%s.json"`, dateTag))
-		c.Header("Content-Type", "application/json")
-		enc := json.NewEncoder(c.Writer)
-		_ = enc.Encode(rows)
-	default:
-		c.Header("Content-Disposition", fmt.Sprintf(`attachment; filename="bataudit-export-%s.csv"`, dateTag))
-		c.Header("Content-Type", "text/csv")
-		w := csv.NewWriter(c.Writer)
-		_ = w.Write([]string{"id", "event_type", "timestamp", "service_name", "method", "path", "status_code", "response_time_ms", "identifier", "user_email", "user_name"})
+	// Rows are written batch by batch as they are read. The header goes out
+	// with the first batch, so errors before it still get a status code.
+	var csvw *csv.Writer
+	started := false
+	start := func() {
+		started = true
+		switch format {
+		case "json":
+			c.Header("Content-Disposition", fmt.Sprintf(`attachment; filename="bataudit-export-%s.json"`, dateTag))
+			c.Header("Content-Type", "application/json")
+			_, _ = c.Writer.WriteString("[")
+		default:
+			c.Header("Content-Disposition", fmt.Sprintf(`attachment; filename="bataudit-export-%s.csv"`, dateTag))
+			c.Header("Content-Type", "text/csv")
+			csvw = csv.NewWriter(c.Writer)
+			_ = csvw.Write([]string{"id", "event_type", "timestamp", "service_name", "method", "path", "status_code", "response_time_ms", "identifier", "user_email", "user_name"})
+		}
+	}
+	first := true
+	err := h.repository.Export(filters, maxRows, func(rows []AuditSummary) error {
+		if !started {
+			start()
+		}
 		for _, r := range rows {
-			_ = w.Write([]string{
+			if csvw == nil {
+				b, err := json.Marshal(r)
+				if err != nil {
+					return err
+				}
+				if !first {
+					_, _ = c.Writer.WriteString(",")
+				}
+				first = false
+				_, _ = c.Writer.Write(b)
+				continue
+			}
+			_ = csvw.Write([]string{
 				r.ID,
 				r.EventType,
 				r.Timestamp.UTC().Format(time.RFC3339),
@@ -513,13 +993,41 @@ func (h *Handler) Export(c *gin.Context) {
 				r.UserName,
 			})
 		}
-		w.Flush()
+		if csvw != nil {
+			csvw.Flush()
+			return csvw.Error()
+		}
+		c.Writer.Flush()
+		return nil
+	})
+	if errors.Is(err, ErrExportTooLarge) {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": fmt.Sprintf("result exceeds %d rows — narrow the date range and try again", maxRows),
+		})
+		return
+	}
+	if err != nil && !started {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "export failed"})
+		return
+	}
+	if err != nil {
+		// Too late for a status code: the download ends truncated.
+		slog.Error("Export failed while streaming", "error", err)
+		return
 	}
+	if !started {
+		start()
+	}
+	if csvw != nil {
+		csvw.Flush()
+		return
+	}
+	_, _ = c.Writer.WriteString("]\n")
 }
 
 // Orphans godoc
 // @Summary      List orphan events
-// @Description  Returns browser-source events that have no matching backend event with the same request_id. Indicates requests the backend failed to audit (crash, timeout, OOM).
+// @Description  Returns browser-source events that have no matching backend event: none with the same request_id and, for traced events, none in the same trace. Indicates requests the backend failed to audit (crash, timeout, OOM).
 // @Tags         audit
 // @Produce      json
 // @Security     BearerAuth
@@ -557,16 +1065,318 @@ func (h *Handler) Orphans(c *gin.Context) {
 	})
 }
 
+// TraceByID godoc
+// @Summary      Get a trace
+// @Description  Returns the events of a trace as a tree: each event under the event whose span is its parent_span_id, or under the browser event with its request_id. Each event carries offset_ms from the start of the trace and hop_ms from its parent's start. Events whose parent span is not stored are roots with missing_parent. Limited to the caller's projects; at most 1000 events.
+// @Tags         audit
+// @Produce      json
+// @Security     BearerAuth
+// @Param        trace_id  path      string  true  "Trace ID (32 hex digits)"
+// @Success      200       {object}  Trace
+// @Failure      400       {object}  map[string]string
+// @Failure      404       {object}  map[string]string
+// @Failure      500       {object}  map[string]string
+// @Router       /audit/traces/{trace_id} [get]
+func (h *Handler) TraceByID(c *gin.Context) {
+	traceID := strings.ToLower(c.Param("trace_id"))
+	if !validTraceID(traceID) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid trace_id: expected 32 hex digits"})
+		return
+	}
+
+	projects, ok := h.readableProjects(c)
+	if !ok {
+		return
+	}
+
+	trace, err := h.service.GetTrace(traceID, projects)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to retrieve trace", "details": err.Error()})
+		return
+	}
+	if trace.EventCount == 0 {
+		c.JSON(http.StatusNotFound, gin.H{"error": "trace not found"})
+		return
+	}
+	c.JSON(http.StatusOK, trace)
+}
+
+// Aggregate godoc
+// @Summary      Aggregate events
+// @Description  Computes metrics (count, error_count, error_rate, avg_latency, max_latency, p50/p90/p95/p99_latency, distinct_identifiers) over the events matching the list filters, grouped by dimensions (service, route, method, status_class, environment, tenant, user_type, source) and optionally by time bucket (minute, 5m, 15m, hour, day). Events default to http. Queries by service alone read the tiering summaries for the ranges tiering has summarized; other queries set raw_since when raw events in the range may have been deleted.
+// @Tags         audit
+// @Accept       json
+// @Produce      json
+// @Security     BearerAuth
+// @Param        body  body      object  true  "{ \"metrics\": [\"count\", \"p95_latency\"], \"group_by\": [\"service\"], \"interval\": \"hour\", \"filters\": { \"project_id\": \"...\", \"start_date\": \"2024-01-01T00:00:00Z\" } }"
+// @Success      200   {object}  AggregateResult
+// @Failure      400   {object}  map[string]string
+// @Failure      500   {object}  map[string]string
+// @Router       /audit/aggregate [post]
+func (h *Handler) Aggregate(c *gin.Context) {
+	var req struct {
+		Metrics  []string `json:"metrics"`
+		GroupBy  []string `json:"group_by"`
+		Interval string   `json:"interval"`
+		Limit    int      `json:"limit"`
+		Filters  struct {
+			ProjectID   string     `json:"project_id"`
+			ServiceName string     `json:"service_name"`
+			Identifier  string     `json:"identifier"`
+			Method      string     `json:"method"`
+			Path        string     `json:"path"`
+			StatusCode  int        `json:"status_code"`
+			StatusClass string     `json:"status_class"`
+			Environment string     `json:"environment"`
+			EventType   string     `json:"event_type"`
+			TraceID     string     `json:"trace_id"`
+			StartDate   *time.Time `json:"start_date"`
+			EndDate     *time.Time `json:"end_date"`
+			Search      string     `json:"q"`
+			Fields      []string   `json:"filter"`
+		} `json:"filters"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid request body", "details": err.Error()})
+		return
+	}
+	f := req.Filters
+	if !validSearch(c, f.Search) || !validFieldFilters(c, f.Fields) {
+		return
+	}
+
+	q := AggregateQuery{
+		Metrics:  req.Metrics,
+		GroupBy:  req.GroupBy,
+		Interval: req.Interval,
+		Limit:    req.Limit,
+		Filters: ListFilters{
+			ProjectID:   f.ProjectID,
+			ServiceName: f.ServiceName,
+			Identifier:  f.Identifier,
+			Method:      f.Method,
+			Path:        f.Path,
+			StatusCode:  f.StatusCode,
+			StatusClass: f.StatusClass,
+			Environment: f.Environment,
+			EventType:   f.EventType,
+			TraceID:     strings.ToLower(f.TraceID),
+			StartDate:   f.StartDate,
+			EndDate:     f.EndDate,
+			Search:      f.Search,
+			Fields:      f.Fields,
+		},
+	}
+	if err := q.Validate(); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	result, err := h.service.Aggregate(q)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to aggregate events", "details": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, result)
+}
+
+// Latency godoc
+// @Summary      Latency distribution per route
+// @Description  Returns the count, average, p50/p90/p95/p99, maximum and histogram buckets of HTTP response times per route, per service or overall. Ranges tiering has summarized are read from its latency sketches, which merge exactly with the raw events after them; percentiles are estimated within their bucket.
+// @Tags         audit
+// @Produce      json
+// @Security     BearerAuth
+// @Param        project_id    query     string  false  "Filter by project ID"
+// @Param        service_name  query     string  false  "Filter by service"
+// @Param        method        query     string  false  "Filter by HTTP method"
+// @Param        path          query     string  false  "Filter by path"
+// @Param        start_date    query     string  false  "Filter from date (ISO 8601)"
+// @Param        end_date      query     string  false  "Filter to date (ISO 8601)"
+// @Param        group_by      query     string  false  "route (default) | service | none"
+// @Param        limit         query     int     false  "Groups, busiest first (default: 50, max: 500)"
+// @Success      200           {object}  LatencyResult
+// @Failure      400           {object}  map[string]string
+// @Failure      500           {object}  map[string]string
+// @Router       /audit/latency [get]
+func (h *Handler) Latency(c *gin.Context) {
+	filters := LatencyFilters{
+		ProjectID:   c.Query("project_id"),
+		ServiceName: c.Query("service_name"),
+		Method:      c.Query("method"),
+		Path:        c.Query("path"),
+		GroupBy:     c.DefaultQuery("group_by", "route"),
+	}
+	if filters.GroupBy != "route" && filters.GroupBy != "service" && filters.GroupBy != "none" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "group_by must be route, service or none"})
+		return
+	}
+	if l := c.Query("limit"); l != "" {
+		_, _ = fmt.Sscanf(l, "%d", &filters.Limit)
+	}
+	if sd := c.Query("start_date"); sd != "" {
+		if t, err := time.Parse(time.RFC3339, sd); err == nil {
+			filters.StartDate = &t
+		}
+	}
+	if ed := c.Query("end_date"); ed != "" {
+		if t, err := time.Parse(time.RFC3339, ed); err == nil {
+			filters.EndDate = &t
+		}
+	}
+
+	result, err := h.service.GetLatency(filters)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to retrieve latency", "details": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, result)
+}
+
+// Funnel godoc
+// @Summary      Funnel conversion
+// @Description  Counts the journeys (the events of one identifier, or of one explicit session_id with by=session) that went through ordered steps, each step within max_step_gap (default 30m) of the previous one. Returns the journeys reaching each step, the drop-off from the previous step and the conversion rates. Steps match a method and route, and optionally a status code or class. Ranges default to the last 7 days, up to 90 days.
+// @Tags         audit
+// @Accept       json
+// @Produce      json
+// @Security     BearerAuth
+// @Param        body  body      object  true  "{ \"steps\": [{ \"method\": \"GET\", \"path\": \"/cart\" }, { \"method\": \"POST\", \"path\": \"/checkout\", \"status\": \"2xx\" }], \"max_step_gap\": \"30m\", \"project_id\": \"...\" }"
+// @Success      200   {object}  FunnelResult
+// @Failure      400   {object}  map[string]string
+// @Failure      500   {object}  map[string]string
+// @Router       /audit/funnels [post]
+func (h *Handler) Funnel(c *gin.Context) {
+	var req struct {
+		ProjectID   string       `json:"project_id"`
+		ServiceName string       `json:"service_name"`
+		Environment string       `json:"environment"`
+		StartDate   *time.Time   `json:"start_date"`
+		EndDate     *time.Time   `json:"end_date"`
+		By          string       `json:"by"`
+		MaxStepGap  string       `json:"max_step_gap"`
+		Steps       []FunnelStep `json:"steps"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid request body", "details": err.Error()})
+		return
+	}
+	gap, ok := maxStepGap(c, req.MaxStepGap)
+	if !ok {
+		return
+	}
+	q := FunnelQuery{
+		JourneyFilters: JourneyFilters{
+			ProjectID:   req.ProjectID,
+			ServiceName: req.ServiceName,
+			Environment: req.Environment,
+			StartDate:   req.StartDate,
+			EndDate:     req.EndDate,
+			By:          req.By,
+			MaxGap:      gap,
+		},
+		Steps: req.Steps,
+	}
+	if err := q.Validate(); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	result, err := h.service.Funnel(q)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to compute funnel", "details": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, result)
+}
+
+// Paths godoc
+// @Summary      Next and previous paths
+// @Description  Returns the routes journeys most often took right after (direction=next) or right before (direction=previous) a route, within max_step_gap (default 30m). none counts the occurrences with no such route: exits, or entries. Journeys are followed as for funnels.
+// @Tags         audit
+// @Produce      json
+// @Security     BearerAuth
+// @Param        method        query     string  true   "HTTP method of the route"
+// @Param        path          query     string  true   "Route"
+// @Param        direction     query     string  false  "next (default) | previous"
+// @Param        by            query     string  false  "identifier (default) | session"
+// @Param        max_step_gap  query     string  false  "Maximum time between two steps (default: 30m)"
+// @Param        limit         query     int     false  "Transitions, most common first (default: 10, max: 100)"
+// @Param        project_id    query     string  false  "Filter by project ID"
+// @Param        service_name  query     string  false  "Filter by service"
+// @Param        start_date    query     string  false  "Filter from date (ISO 8601)"
+// @Param        end_date      query     string  false  "Filter to date (ISO 8601)"
+// @Success      200           {object}  PathResult
+// @Failure      400           {object}  map[string]string
+// @Failure      500           {object}  map[string]string
+// @Router       /audit/paths [get]
+func (h *Handler) Paths(c *gin.Context) {
+	gap, ok := maxStepGap(c, c.Query("max_step_gap"))
+	if !ok {
+		return
+	}
+	q := PathQuery{
+		JourneyFilters: JourneyFilters{
+			ProjectID:   c.Query("project_id"),
+			ServiceName: c.Query("service_name"),
+			Environment: c.Query("environment"),
+			By:          c.Query("by"),
+			MaxGap:      gap,
+		},
+		Method:    c.Query("method"),
+		Path:      c.Query("path"),
+		Direction: c.Query("direction"),
+	}
+	if l := c.Query("limit"); l != "" {
+		_, _ = fmt.Sscanf(l, "%d", &q.Limit)
+	}
+	if sd := c.Query("start_date"); sd != "" {
+		if t, err := time.Parse(time.RFC3339, sd); err == nil {
+			q.StartDate = &t
+		}
+	}
+	if ed := c.Query("end_date"); ed != "" {
+		if t, err := time.Parse(time.RFC3339, ed); err == nil {
+			q.EndDate = &t
+		}
+	}
+	if err := q.Validate(); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	result, err := h.service.Paths(q)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to compute paths", "details": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, result)
+}
+
+// maxStepGap parses the max_step_gap of a funnel or path query, writing a 400
+// when it is not a duration. Empty is the default.
+func maxStepGap(c *gin.Context, s string) (time.Duration, bool) {
+	if s == "" {
+		return 0, true
+	}
+	gap, err := time.ParseDuration(s)
+	if err != nil || gap <= 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "max_step_gap must be a positive duration, such as 30m"})
+		return 0, false
+	}
+	return gap, true
+}
+
 // Insights godoc
 // @Summary      Usage analytics rankings
-// @Description  Returns top 10 rankings: endpoints by volume, users by activity, routes by error rate, routes by response time. Period: 7d (default) | 30d | 90d.
+// @Description  Returns top 10 rankings: endpoints by volume, users by activity, routes by error rate, routes by response time. Period: 7d (default) | 30d | 90d. With compare, each ranking compares the period with another window instead (InsightsComparison), and lists the entries gone since then.
 // @Tags         audit
 // @Produce      json
 // @Security     BearerAuth
-// @Param        project_id  query     string  false  "Filter by project ID"
-// @Param        period      query     string  false  "Period: 7d | 30d | 90d (default: 7d)"
-// @Success      200         {object}  InsightsResult
-// @Failure      500         {object}  map[string]string
+// @Param        project_id     query     string  false  "Filter by project ID"
+// @Param        period         query     string  false  "Period: 7d | 30d | 90d (default: 7d)"
+// @Param        compare        query     string  false  "previous_period | same_period_last_week | custom"
+// @Param        compare_start  query     string  false  "Start of the compared window, for compare=custom (ISO 8601)"
+// @Param        compare_end    query     string  false  "End of the compared window, for compare=custom (ISO 8601)"
+// @Success      200            {object}  InsightsResult
+// @Failure      400            {object}  map[string]string
+// @Failure      500            {object}  map[string]string
 // @Router       /audit/insights [get]
 func (h *Handler) Insights(c *gin.Context) {
 	period := c.Query("period")
@@ -578,6 +1388,22 @@ func (h *Handler) Insights(c *gin.Context) {
 		Period:      period,
 		Environment: c.Query("environment"),
 	}
+
+	if c.Query("compare") != "" {
+		current := filters.Window(time.Now().UTC())
+		previous, ok := comparisonWindow(c, current)
+		if !ok {
+			return
+		}
+		result, err := h.service.CompareInsights(filters, current, previous)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to retrieve insights"})
+			return
+		}
+		c.JSON(http.StatusOK, result)
+		return
+	}
+
 	result, err := h.service.GetInsights(filters)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to retrieve insights"})
@@ -586,6 +1412,114 @@ func (h *Handler) Insights(c *gin.Context) {
 	c.JSON(http.StatusOK, result)
 }
 
+// Identity godoc
+// @Summary      Identity profile
+// @Description  Returns everything stored about one identifier across the projects the caller may read: first and last seen, event and error counts, the projects, services, tenants, IPs, countries and user agents seen (50 most used each), its sessions of the last 30 days and up to 50 alerts naming it. Countries need a GeoIP database (GEOIP_COUNTRY_CSV).
+// @Tags         audit
+// @Produce      json
+// @Security     BearerAuth
+// @Param        identifier  path      string  true  "User or API client identifier"
+// @Success      200         {object}  IdentityProfile
+// @Failure      404         {object}  map[string]string
+// @Failure      500         {object}  map[string]string
+// @Router       /audit/identities/{identifier} [get]
+func (h *Handler) Identity(c *gin.Context) {
+	projects, ok := h.readableProjects(c)
+	if !ok {
+		return
+	}
+	profile, err := h.service.GetIdentity(c.Param("identifier"), projects)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to retrieve identity", "details": err.Error()})
+		return
+	}
+	if profile == nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "identity not found"})
+		return
+	}
+	if h.geo != nil {
+		profile.Countries = countries(h.geo, profile.IPs)
+	}
+	c.JSON(http.StatusOK, profile)
+}
+
+// IdentityTimeline godoc
+// @Summary      Identity activity timeline
+// @Description  Lists the events of one identifier across the projects the caller may read, merged in time order, newest first by default. Pages are continued with next_cursor.
+// @Tags         audit
+// @Produce      json
+// @Security     BearerAuth
+// @Param        identifier  path      string  true   "User or API client identifier"
+// @Param        limit       query     int     false  "Events per page (default: 50, max: 500)"
+// @Param        order       query     string  false  "desc (default) or asc"
+// @Param        cursor      query     string  false  "next_cursor of the previous page"
+// @Param        start_date  query     string  false  "Filter from date (ISO 8601)"
+// @Param        end_date    query     string  false  "Filter to date (ISO 8601)"
+// @Success      200         {object}  map[string]interface{}
+// @Failure      400         {object}  map[string]string
+// @Failure      500         {object}  map[string]string
+// @Router       /audit/identities/{identifier}/timeline [get]
+func (h *Handler) IdentityTimeline(c *gin.Context) {
+	limit := 50
+	if l := c.Query("limit"); l != "" {
+		_, _ = fmt.Sscanf(l, "%d", &limit)
+	}
+	if limit <= 0 || limit > 500 {
+		limit = 50
+	}
+	order := c.DefaultQuery("order", "desc")
+	if order != "asc" && order != "desc" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "order must be asc or desc"})
+		return
+	}
+	projects, ok := h.readableProjects(c)
+	if !ok {
+		return
+	}
+	filters := ListFilters{
+		ProjectIDs: projects,
+		Identifier: c.Param("identifier"),
+		SortBy:     "timestamp",
+		SortOrder:  order,
+		Total:      TotalNone,
+	}
+	if sd := c.Query("start_date"); sd != "" {
+		if t, err := time.Parse(time.RFC3339, sd); err == nil {
+			filters.StartDate = &t
+		}
+	}
+	if ed := c.Query("end_date"); ed != "" {
+		if t, err := time.Parse(time.RFC3339, ed); err == nil {
+			filters.EndDate = &t
+		}
+	}
+	if cur := c.Query("cursor"); cur != "" {
+		after, err := ParseCursor(cur)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		if after.SortBy != "timestamp" || after.Order != order {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "cursor does not match order"})
+			return
+		}
+		filters.After = after
+	}
+
+	result, err := h.service.ListAudits(limit, 0, filters)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to retrieve timeline", "details": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"data": result.Data,
+		"pagination": gin.H{
+			"limit":       limit,
+			"next_cursor": result.NextCursor,
+		},
+	})
+}
+
 func (h *Handler) AffectedUsers(c *gin.Context) {
 	projectID := c.Query("project_id")
 	if projectID == "" {
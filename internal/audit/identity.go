@@ -0,0 +1,198 @@
+package audit
+
+import (
+	"sort"
+	"time"
+
+	"github.com/joaovrmoraes/bataudit/internal/dialect"
+	"gorm.io/gorm"
+)
+
+const (
+	// maxIdentityValues caps each list of an identity profile, most used
+	// values first.
+	maxIdentityValues = 50
+	maxIdentityAlerts = 50
+	// maxIdentitySessions caps the sessions of a profile, newest first.
+	maxIdentitySessions = 200
+	// identitySessionDays is how far back the sessions of a profile go.
+	identitySessionDays = 30
+)
+
+// Geolocator resolves IP addresses to ISO 3166-1 alpha-2 country codes,
+// returning "" when unknown.
+type Geolocator interface {
+	Country(ip string) string
+}
+
+// IdentityValue is a value seen in the events of an identity: a service, a
+// tenant, an IP, a country or a user agent.
+type IdentityValue struct {
+	Value    string    `json:"value"`
+	Count    int64     `json:"count"`
+	LastSeen time.Time `json:"last_seen"`
+}
+
+// IdentityProfile is the answer to GET /audit/identities/:identifier:
+// everything stored about one identifier in the projects the caller may
+// read.
+type IdentityProfile struct {
+	Identifier string          `json:"identifier"`
+	UserEmail  string          `json:"user_email"`
+	UserName   string          `json:"user_name"`
+	FirstSeen  time.Time       `json:"first_seen"`
+	LastSeen   time.Time       `json:"last_seen"`
+	EventCount int64           `json:"event_count"`
+	Errors4xx  int64           `json:"errors_4xx"`
+	Errors5xx  int64           `json:"errors_5xx"`
+	Projects   []IdentityValue `json:"projects"`
+	Services   []IdentityValue `json:"services"`
+	Tenants    []IdentityValue `json:"tenants"`
+	IPs        []IdentityValue `json:"ips"`
+	// Countries of the listed IPs; empty unless a Geolocator is set.
+	Countries  []IdentityValue `json:"countries"`
+	UserAgents []IdentityValue `json:"user_agents"`
+	Sessions   []Session       `json:"sessions"` // last 30 days
+	Alerts     []AuditSummary  `json:"alerts"`   // alerts naming the identifier, newest first
+}
+
+// identityValueColumns are the columns of the value lists of a profile.
+var identityValueColumns = []struct {
+	column string
+	list   func(*IdentityProfile) *[]IdentityValue
+}{
+	{"project_id", func(p *IdentityProfile) *[]IdentityValue { return &p.Projects }},
+	{"service_name", func(p *IdentityProfile) *[]IdentityValue { return &p.Services }},
+	{"tenant_id", func(p *IdentityProfile) *[]IdentityValue { return &p.Tenants }},
+	{"ip", func(p *IdentityProfile) *[]IdentityValue { return &p.IPs }},
+	{"user_agent", func(p *IdentityProfile) *[]IdentityValue { return &p.UserAgents }},
+}
+
+// GetIdentity returns the profile of identifier, or nil when it has no
+// events. A non-nil projectIDs limits it to those projects.
+func (r *repository) GetIdentity(identifier string, projectIDs []string) (*IdentityProfile, error) {
+	base := func() *gorm.DB {
+		q := r.db.Model(&Audit{}).Where("identifier = ?", identifier)
+		if projectIDs != nil {
+			q = q.Where("project_id IN ?", projectIDs)
+		}
+		return q
+	}
+
+	var summary struct {
+		UserEmail  string
+		UserName   string
+		FirstSeen  dialect.Time
+		LastSeen   dialect.Time
+		EventCount int64
+		Errors4xx  int64 `gorm:"column:errors_4xx"`
+		Errors5xx  int64 `gorm:"column:errors_5xx"`
+	}
+	err := base().
+		Select(`COALESCE(MAX(user_email), '') AS user_email,
+			COALESCE(MAX(user_name), '') AS user_name,
+			MIN(timestamp) AS first_seen,
+			MAX(timestamp) AS last_seen,
+			COUNT(*) AS event_count,
+			COUNT(CASE WHEN status_code >= 400 AND status_code < 500 THEN 1 END) AS errors_4xx,
+			COUNT(CASE WHEN status_code >= 500 THEN 1 END) AS errors_5xx`).
+		Scan(&summary).Error
+	if err != nil {
+		return nil, err
+	}
+	if summary.EventCount == 0 {
+		return nil, nil
+	}
+	profile := &IdentityProfile{
+		Identifier: identifier,
+		UserEmail:  summary.UserEmail,
+		UserName:   summary.UserName,
+		FirstSeen:  summary.FirstSeen.Time,
+		LastSeen:   summary.LastSeen.Time,
+		EventCount: summary.EventCount,
+		Errors4xx:  summary.Errors4xx,
+		Errors5xx:  summary.Errors5xx,
+		Countries:  []IdentityValue{},
+		Alerts:     []AuditSummary{},
+	}
+
+	for _, values := range identityValueColumns {
+		var rows []struct {
+			Value    string
+			Count    int64
+			LastSeen dialect.Time
+		}
+		err := base().
+			Select(values.column + " AS value, COUNT(*) AS count, MAX(timestamp) AS last_seen").
+			Where(values.column + " IS NOT NULL AND " + values.column + " != ''").
+			Group(values.column).
+			Order("count DESC, " + values.column).
+			Limit(maxIdentityValues).
+			Scan(&rows).Error
+		if err != nil {
+			return nil, err
+		}
+		list := make([]IdentityValue, len(rows))
+		for i, row := range rows {
+			list[i] = IdentityValue{Value: row.Value, Count: row.Count, LastSeen: row.LastSeen.Time}
+		}
+		*values.list(profile) = list
+	}
+
+	since := time.Now().UTC().AddDate(0, 0, -identitySessionDays)
+	sessions, err := r.GetSessions(SessionFilters{Identifier: identifier, ProjectIDs: projectIDs, StartDate: &since, Limit: maxIdentitySessions})
+	if err != nil {
+		return nil, err
+	}
+	profile.Sessions = sessions.Data
+
+	// Alerts carry their subject in their details, such as the identifier
+	// of a brute-force alert.
+	named := FieldFilter{FieldRef: FieldRef{Column: "request_body", Path: []string{"identifier"}}, Op: "=", Value: identifier}
+	cond, args := named.sql(r.db.Dialector.Name())
+	alerts := r.db.Model(&Audit{}).
+		Where("event_type = 'system.alert'").
+		Where(cond, args...)
+	if projectIDs != nil {
+		alerts = alerts.Where("project_id IN ?", projectIDs)
+	}
+	if err := alerts.
+		Select(summaryColumns).
+		Order("timestamp DESC").
+		Limit(maxIdentityAlerts).
+		Find(&profile.Alerts).Error; err != nil {
+		return nil, err
+	}
+	return profile, nil
+}
+
+// countries adds up the IPs of a profile by country.
+func countries(geo Geolocator, ips []IdentityValue) []IdentityValue {
+	byCountry := map[string]*IdentityValue{}
+	for _, ip := range ips {
+		country := geo.Country(ip.Value)
+		if country == "" {
+			continue
+		}
+		c := byCountry[country]
+		if c == nil {
+			c = &IdentityValue{Value: country}
+			byCountry[country] = c
+		}
+		c.Count += ip.Count
+		if ip.LastSeen.After(c.LastSeen) {
+			c.LastSeen = ip.LastSeen
+		}
+	}
+	list := make([]IdentityValue, 0, len(byCountry))
+	for _, c := range byCountry {
+		list = append(list, *c)
+	}
+	sort.Slice(list, func(i, j int) bool {
+		if list[i].Count != list[j].Count {
+			return list[i].Count > list[j].Count
+		}
+		return list[i].Value < list[j].Value
+	})
+	return list
+}
@@ -0,0 +1,30 @@
+package audit
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type geoStub map[string]string
+
+func (g geoStub) Country(ip string) string { return g[ip] }
+
+func TestCountries(t *testing.T) {
+	early := time.Date(2024, 1, 15, 9, 0, 0, 0, time.UTC)
+	late := early.Add(time.Hour)
+	geo := geoStub{"192.0.2.1": "BR", "192.0.2.2": "BR", "198.51.100.1": "PT"}
+
+	got := countries(geo, []IdentityValue{
+		{Value: "192.0.2.1", Count: 3, LastSeen: early},
+		{Value: "198.51.100.1", Count: 4, LastSeen: early},
+		{Value: "192.0.2.2", Count: 2, LastSeen: late},
+		{Value: "10.0.0.1", Count: 9, LastSeen: late},
+	})
+	assert.Equal(t, []IdentityValue{
+		{Value: "BR", Count: 5, LastSeen: late},
+		{Value: "PT", Count: 4, LastSeen: early},
+	}, got)
+	assert.Empty(t, countries(geo, nil))
+}
@@ -0,0 +1,212 @@
+package audit
+
+import (
+	"slices"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/joaovrmoraes/bataudit/internal/latency"
+	"gorm.io/gorm"
+)
+
+// Latency distributions are read from latency sketches (see package latency):
+// tiering stores one per route and hour or day, and the raw events after the
+// newest sketched period are counted into sketches on the fly. Sketches of
+// the same route merge exactly, so the percentiles of a range are as precise
+// whether it spans raw events, summaries or both.
+
+const (
+	defaultLatencyGroups = 50
+	maxLatencyGroups     = 500
+)
+
+// LatencyFilters selects the HTTP events of GET /audit/latency.
+type LatencyFilters struct {
+	ProjectID   string
+	ServiceName string
+	Method      string
+	Path        string
+	StartDate   *time.Time
+	EndDate     *time.Time
+	GroupBy     string // route (default) | service | none
+	Limit       int    // groups, by count descending
+}
+
+// LatencyStats is the latency distribution of a group of requests.
+type LatencyStats struct {
+	ServiceName string           `json:"service_name,omitempty"`
+	Method      string           `json:"method,omitempty"`
+	Path        string           `json:"path,omitempty"`
+	Count       int64            `json:"count"`
+	AvgMs       float64          `json:"avg_ms"`
+	P50Ms       float64          `json:"p50_ms"`
+	P90Ms       float64          `json:"p90_ms"`
+	P95Ms       float64          `json:"p95_ms"`
+	P99Ms       float64          `json:"p99_ms"`
+	MaxMs       int64            `json:"max_ms"`
+	Buckets     []latency.Bucket `json:"buckets"`
+}
+
+// LatencyResult is the answer to GET /audit/latency.
+type LatencyResult struct {
+	Data []LatencyStats `json:"data"`
+	// Tiers lists what was read: raw events, tiering's latency sketches or
+	// both. Sketched periods count as whole hours or days.
+	Tiers     []string `json:"tiers"`
+	Truncated bool     `json:"truncated,omitempty"` // more than Limit groups
+}
+
+// latencyGroup is the group key of a sketch.
+type latencyGroup struct {
+	ServiceName, Method, Path string
+}
+
+// latencyColumns returns the columns a GroupBy groups on.
+func latencyColumns(groupBy string) []string {
+	switch groupBy {
+	case "service":
+		return []string{"service_name"}
+	case "none":
+		return nil
+	default:
+		return []string{"service_name", "method", "path"}
+	}
+}
+
+// latencyFilter applies filters to a query on audits or on sketches, whose
+// time column is timeColumn.
+func latencyFilter(query *gorm.DB, filters LatencyFilters, timeColumn string) *gorm.DB {
+	if filters.ProjectID != "" {
+		query = query.Where("project_id = ?", filters.ProjectID)
+	}
+	if filters.ServiceName != "" {
+		query = query.Where("service_name = ?", filters.ServiceName)
+	}
+	if filters.Method != "" {
+		query = query.Where("method = ?", filters.Method)
+	}
+	if filters.Path != "" {
+		query = query.Where("path = ?", filters.Path)
+	}
+	if filters.StartDate != nil {
+		query = query.Where(timeColumn+" >= ?", filters.StartDate)
+	}
+	if filters.EndDate != nil {
+		query = query.Where(timeColumn+" <= ?", filters.EndDate)
+	}
+	return query
+}
+
+func (r *repository) GetLatency(filters LatencyFilters) (*LatencyResult, error) {
+	result := &LatencyResult{Data: []LatencyStats{}, Tiers: []string{"raw"}}
+	columns := latencyColumns(filters.GroupBy)
+	limit := filters.Limit
+	if limit <= 0 || limit > maxLatencyGroups {
+		limit = defaultLatencyGroups
+	}
+
+	sketched, err := r.summarizedUntil("audit_latency_sketches", filters.ProjectID)
+	if err != nil {
+		return nil, err
+	}
+	for project, until := range sketched {
+		if filters.StartDate != nil && !until.After(*filters.StartDate) {
+			delete(sketched, project)
+		}
+	}
+
+	groups := map[latencyGroup]*latency.Sketch{}
+	sketchOf := func(g latencyGroup) *latency.Sketch {
+		if groups[g] == nil {
+			groups[g] = latency.New()
+		}
+		return groups[g]
+	}
+
+	if len(sketched) > 0 {
+		result.Tiers = []string{"summary", "raw"}
+		query := r.db.Table("audit_latency_sketches").
+			Select(strings.Join(slices.Concat(columns, []string{"event_count", "sum_ms", "max_ms", "buckets"}), ", "))
+		query = latencyFilter(query, filters, "period_start")
+		var stored []struct {
+			ServiceName string `gorm:"column:service_name"`
+			Method      string `gorm:"column:method"`
+			Path        string `gorm:"column:path"`
+			EventCount  int64  `gorm:"column:event_count"`
+			SumMs       int64  `gorm:"column:sum_ms"`
+			MaxMs       int64  `gorm:"column:max_ms"`
+			Buckets     string `gorm:"column:buckets"`
+		}
+		if err := query.Scan(&stored).Error; err != nil {
+			return nil, err
+		}
+		for _, row := range stored {
+			s, err := latency.Decode(row.Buckets, row.EventCount, row.SumMs, row.MaxMs)
+			if err != nil {
+				return nil, err
+			}
+			sketchOf(latencyGroup{row.ServiceName, row.Method, row.Path}).Merge(s)
+		}
+	}
+
+	query := r.db.Model(&Audit{}).
+		Select(strings.Join(slices.Concat(columns, []string{
+			latency.IndexExpr("response_time") + " AS bucket",
+			"COUNT(*) AS event_count",
+			"COALESCE(SUM(response_time), 0) AS sum_ms",
+			"COALESCE(MAX(response_time), 0) AS max_ms",
+		}), ", ")).
+		Where("event_type = 'http'").
+		Group(strings.Join(slices.Concat(columns, []string{latency.IndexExpr("response_time")}), ", "))
+	query = latencyFilter(query, filters, "timestamp")
+	for project, until := range sketched {
+		query = query.Where("(project_id IS NULL OR project_id != ? OR timestamp >= ?)", project, until)
+	}
+	var raw []struct {
+		ServiceName string `gorm:"column:service_name"`
+		Method      string `gorm:"column:method"`
+		Path        string `gorm:"column:path"`
+		Bucket      int    `gorm:"column:bucket"`
+		EventCount  int64  `gorm:"column:event_count"`
+		SumMs       int64  `gorm:"column:sum_ms"`
+		MaxMs       int64  `gorm:"column:max_ms"`
+	}
+	if err := query.Scan(&raw).Error; err != nil {
+		return nil, err
+	}
+	for _, row := range raw {
+		sketchOf(latencyGroup{row.ServiceName, row.Method, row.Path}).AddBucket(row.Bucket, row.EventCount, row.SumMs, row.MaxMs)
+	}
+
+	for g, s := range groups {
+		if s.Count == 0 {
+			continue
+		}
+		result.Data = append(result.Data, LatencyStats{
+			ServiceName: g.ServiceName,
+			Method:      g.Method,
+			Path:        g.Path,
+			Count:       s.Count,
+			AvgMs:       s.Mean(),
+			P50Ms:       s.Quantile(0.5),
+			P90Ms:       s.Quantile(0.9),
+			P95Ms:       s.Quantile(0.95),
+			P99Ms:       s.Quantile(0.99),
+			MaxMs:       s.MaxMs,
+			Buckets:     s.Buckets(),
+		})
+	}
+	sort.Slice(result.Data, func(i, j int) bool {
+		a, b := result.Data[i], result.Data[j]
+		if a.Count != b.Count {
+			return a.Count > b.Count
+		}
+		return a.ServiceName+" "+a.Method+" "+a.Path < b.ServiceName+" "+b.Method+" "+b.Path
+	})
+	if len(result.Data) > limit {
+		result.Data = result.Data[:limit]
+		result.Truncated = true
+	}
+	return result, nil
+}
@@ -53,22 +53,22 @@ type Audit struct {
 	ResponseTime int64      `json:"response_time" validate:"omitempty,min=0"`
 
 	// User info
-	Identifier string         `json:"identifier" validate:"required,min=1,max=100"`          // ID of the user or API client
-	UserEmail  string         `json:"user_email,omitempty" validate:"omitempty,valid_email"` // User email (if available)
-	UserName   string         `json:"user_name,omitempty" validate:"omitempty,max=100"`      // User name (if available)
-	UserRoles  datatypes.JSON `json:"user_roles,omitempty" gorm:"type:jsonb"`                // User roles/permissions
-	UserType   string         `json:"user_type,omitempty" validate:"omitempty,max=50"`       // User type (admin, client, etc)
-	TenantID   string         `json:"tenant_id,omitempty" validate:"omitempty,max=100"`      // Organization/tenant ID (for multi-tenant SaaS)
+	Identifier string         `json:"identifier" validate:"required,min=1,max=100"`                 // ID of the user or API client
+	UserEmail  string         `json:"user_email,omitempty" validate:"omitempty,valid_email"`        // User email (if available)
+	UserName   string         `json:"user_name,omitempty" validate:"omitempty,max=100"`             // User name (if available)
+	UserRoles  datatypes.JSON `json:"user_roles,omitempty" gorm:"type:jsonb" validate:"not_sealed"` // User roles/permissions
+	UserType   string         `json:"user_type,omitempty" validate:"omitempty,max=50"`              // User type (admin, client, etc)
+	TenantID   string         `json:"tenant_id,omitempty" validate:"omitempty,max=100"`             // Organization/tenant ID (for multi-tenant SaaS)
 
 	// Request info
-	IP           string         `json:"ip" validate:"omitempty,valid_ip"`                      // Source IP of the request
-	UserAgent    string         `json:"user_agent" validate:"omitempty,max=500"`               // User-Agent of the client
-	RequestID    string         `json:"request_id" validate:"omitempty,max=100"`               // Request traceability ID
-	QueryParams  datatypes.JSON `json:"query_params,omitempty" gorm:"type:jsonb"`              // Query string parameters
-	PathParams   datatypes.JSON `json:"path_params,omitempty" gorm:"type:jsonb"`               // Path parameters
-	RequestBody  datatypes.JSON `json:"request_body,omitempty" gorm:"type:jsonb"`              // Request body
-	ResponseBody datatypes.JSON `json:"response_body,omitempty" gorm:"type:jsonb"`             // Response body (opt-in: captureResponseBody)
-	ErrorMessage string         `json:"error_message,omitempty" validate:"omitempty,max=1000"` // Error message (if any)
+	IP           string         `json:"ip" validate:"omitempty,valid_ip"`                                // Source IP of the request
+	UserAgent    string         `json:"user_agent" validate:"omitempty,max=500"`                         // User-Agent of the client
+	RequestID    string         `json:"request_id" validate:"omitempty,max=100"`                         // Request traceability ID
+	QueryParams  datatypes.JSON `json:"query_params,omitempty" gorm:"type:jsonb" validate:"not_sealed"`  // Query string parameters
+	PathParams   datatypes.JSON `json:"path_params,omitempty" gorm:"type:jsonb" validate:"not_sealed"`   // Path parameters
+	RequestBody  datatypes.JSON `json:"request_body,omitempty" gorm:"type:jsonb" validate:"not_sealed"`  // Request body
+	ResponseBody datatypes.JSON `json:"response_body,omitempty" gorm:"type:jsonb" validate:"not_sealed"` // Response body (opt-in: captureResponseBody)
+	ErrorMessage string         `json:"error_message,omitempty" validate:"omitempty,max=1000"`           // Error message (if any)
 
 	// System context
 	Source      string    `json:"source,omitempty" validate:"omitempty,oneof=backend browser"` // Event source: backend (default) or browser
@@ -77,15 +77,36 @@ type Audit struct {
 	Timestamp   time.Time `json:"timestamp" validate:"required"`                                // Timestamp of the request
 	ProjectID   string    `json:"project_id,omitempty"  gorm:"default:null"`                    // Resolved project (set by Writer automatically)
 	SessionID   string    `json:"session_id,omitempty" validate:"omitempty,max=100"`            // Optional explicit session ID (opt-in)
+
+	// Distributed tracing (W3C trace context). Traceparent is the header of
+	// the audited request; the Writer derives the IDs from it (see
+	// ApplyTraceparent) and does not store it.
+	TraceID      string `json:"trace_id,omitempty" gorm:"default:null" validate:"omitempty,valid_trace_id"`      // 32 hex digits
+	SpanID       string `json:"span_id,omitempty" gorm:"default:null" validate:"omitempty,valid_span_id"`        // 16 hex digits
+	ParentSpanID string `json:"parent_span_id,omitempty" gorm:"default:null" validate:"omitempty,valid_span_id"` // Span that called this service
+	Traceparent  string `json:"traceparent,omitempty" gorm:"-" validate:"omitempty,valid_traceparent"`
+
+	// Tamper-evident chain (set by the Worker on insert; client values are ignored)
+	ChainSeq int64  `json:"chain_seq,omitempty" gorm:"default:null"` // Position in the project's chain, from 1
+	PrevHash string `json:"prev_hash,omitempty" gorm:"default:null"` // Hash of the previous event in the chain
+	Hash     string `json:"hash,omitempty" gorm:"default:null"`      // SHA-256 of the canonical content and PrevHash
+
+	// Set when a data-subject erasure pseudonymized or removed the event's
+	// personal data; Hash still covers the original content.
+	ErasedAt *time.Time `json:"erased_at,omitempty" gorm:"default:null"`
 }
 
 type Session struct {
+	ID              string  `json:"id,omitempty"`         // empty when derived from raw events
+	SessionID       string  `json:"session_id,omitempty"` // explicit sessions only
 	Identifier      string  `json:"identifier"`
 	ServiceName     string  `json:"service_name"`
 	SessionStart    string  `json:"session_start"`
 	SessionEnd      string  `json:"session_end"`
 	DurationSeconds float64 `json:"duration_seconds"`
 	EventCount      int64   `json:"event_count"`
+	ErrorCount      int64   `json:"error_count"`
+	AvgResponseTime float64 `json:"avg_response_time"`
 }
 
 // SessionDetail is returned by GET /audit/sessions/:session_id (explicit session_id tracking).
@@ -102,10 +123,15 @@ type SessionDetail struct {
 
 type SessionFilters struct {
 	ProjectID   string
+	ProjectIDs  []string // non-nil limits to these projects
 	Identifier  string
 	ServiceName string
 	StartDate   *time.Time
 	EndDate     *time.Time
+	Fields      []string // JSON field filters on the events, see ParseFieldFilter
+	Limit       int      // default DefaultSessionLimit
+	// After continues the list after this position.
+	After *Cursor
 }
 
 type OrphanFilters struct {
@@ -133,7 +159,10 @@ type AuditStats struct {
 	Errors4xx       int64              `json:"errors_4xx"`
 	Errors5xx       int64              `json:"errors_5xx"`
 	AvgResponseTime float64            `json:"avg_response_time"`
+	P50ResponseTime float64            `json:"p50_response_time"`
 	P95ResponseTime float64            `json:"p95_response_time"`
+	P99ResponseTime float64            `json:"p99_response_time"`
+	MaxResponseTime int64              `json:"max_response_time"`
 	ActiveServices  int64              `json:"active_services"`
 	LastEventAt     string             `json:"last_event_at"`
 	ByService       []ServiceBreakdown `json:"by_service"`
@@ -142,6 +171,15 @@ type AuditStats struct {
 	Timeline        []TimelinePoint    `json:"timeline"`
 }
 
+// StatsFilters selects the events of the stats endpoint. Without a window,
+// stats cover every stored event.
+type StatsFilters struct {
+	ProjectID   string
+	Environment string
+	Start       *time.Time // inclusive
+	End         *time.Time // exclusive
+}
+
 // InsightFilters for the insights/rankings endpoints
 type InsightFilters struct {
 	ProjectID   string
@@ -149,6 +187,18 @@ type InsightFilters struct {
 	Environment string
 }
 
+// Window returns the period of the insights, ending at now.
+func (f InsightFilters) Window(now time.Time) Window {
+	days := 7
+	switch f.Period {
+	case "30d":
+		days = 30
+	case "90d":
+		days = 90
+	}
+	return Window{Start: now.AddDate(0, 0, -days), End: now}
+}
+
 type TopEndpoint struct {
 	Path   string `json:"path"`
 	Method string `json:"method"`
@@ -204,4 +254,9 @@ type AuditSummary struct {
 	Timestamp    time.Time  `json:"timestamp"`
 	ResponseTime int64      `json:"response_time"`
 	ProjectID    string     `json:"project_id,omitempty"`
+	TraceID      string     `json:"trace_id,omitempty"`
+	Rehydrated   bool       `json:"rehydrated,omitempty" gorm:"-"`
+	// Snippet is the best match of a full-text search, HTML-escaped with
+	// matches in <mark> tags.
+	Snippet string `json:"snippet,omitempty" gorm:"-"`
 }
@@ -9,6 +9,7 @@ import (
 	"strings"
 	"time"
 
+	"github.com/joaovrmoraes/bataudit/internal/dialect"
 	"gorm.io/gorm"
 )
 
@@ -36,7 +37,8 @@ var hasLimit = regexp.MustCompile(`(?i)\blimit\s+\d+`)
 // so a keyword blacklist would reject legitimate queries. The real guarantee is
 // the database itself: queries run on a read-only role inside a READ ONLY
 // transaction, so any write (including a data-modifying CTE) is rejected by
-// PostgreSQL, not by string matching.
+// PostgreSQL, not by string matching. SQLite gets the same guarantee from
+// query_only and a check of the compiled statement (see runSQLiteQuery).
 func ValidateQuery(raw string) (string, error) {
 	q := strings.TrimSpace(raw)
 	q = strings.TrimRight(q, "; \t\r\n")
@@ -65,7 +67,8 @@ func enforceLimit(q string, max int) string {
 }
 
 // RunQuery executes a validated SELECT inside a READ ONLY transaction with a
-// statement timeout, and returns generic columns/rows.
+// statement timeout, and returns generic columns/rows. args are bound to the
+// query's placeholders.
 //
 // Two database-enforced guards run here, both inside one transaction that is
 // always rolled back:
@@ -75,7 +78,9 @@ func enforceLimit(q string, max int) string {
 //   - SET LOCAL ROLE bataudit_readonly — when the read-only role exists, the
 //     query can only read the audit tables it was granted. Best-effort: if the
 //     role isn't provisioned, the write protection above still applies.
-func RunQuery(ctx context.Context, db *gorm.DB, raw string) (*QueryResult, error) {
+//
+// SQLite has neither roles nor read-only transactions; see runSQLiteQuery.
+func RunQuery(ctx context.Context, db *gorm.DB, raw string, args ...any) (*QueryResult, error) {
 	q, err := ValidateQuery(raw)
 	if err != nil {
 		return nil, err
@@ -86,6 +91,9 @@ func RunQuery(ctx context.Context, db *gorm.DB, raw string) (*QueryResult, error
 	if err != nil {
 		return nil, fmt.Errorf("db handle: %w", err)
 	}
+	if dialect.Of(db) == dialect.SQLite {
+		return runSQLiteQuery(ctx, sqlDB, q, args)
+	}
 
 	ctx, cancel := context.WithTimeout(ctx, defaultTimeout+time.Second)
 	defer cancel()
@@ -96,7 +104,7 @@ func RunQuery(ctx context.Context, db *gorm.DB, raw string) (*QueryResult, error
 	}
 	defer func() { _ = tx.Rollback() }()
 
-	// Postgres-enforced statement timeout (ignored harmlessly elsewhere).
+	// Postgres-enforced statement timeout.
 	_, _ = tx.ExecContext(ctx, fmt.Sprintf(readOnlyEnforce, defaultTimeout.Milliseconds()))
 	// Drop to the read-only role for table-level scoping when it exists. Guarded
 	// by a savepoint: on PostgreSQL a failed statement aborts the whole
@@ -111,12 +119,17 @@ func RunQuery(ctx context.Context, db *gorm.DB, raw string) (*QueryResult, error
 	}
 
 	start := time.Now()
-	rows, err := tx.QueryContext(ctx, q)
+	rows, err := tx.QueryContext(ctx, q, args...)
 	if err != nil {
 		return nil, friendlyDBError(err)
 	}
 	defer rows.Close()
+	return scanResult(rows, start)
+}
 
+// scanResult reads up to defaultMaxRows rows of a console query started at
+// start.
+func scanResult(rows *sql.Rows, start time.Time) (*QueryResult, error) {
 	cols, err := rows.Columns()
 	if err != nil {
 		return nil, err
@@ -165,7 +178,7 @@ func normalizeValue(v any) any {
 func friendlyDBError(err error) error {
 	msg := err.Error()
 	// Surface read-only / permission rejections clearly.
-	if strings.Contains(msg, "read-only") || strings.Contains(msg, "permission denied") {
+	if strings.Contains(msg, "read-only") || strings.Contains(msg, "readonly") || strings.Contains(msg, "permission denied") {
 		return fmt.Errorf("query rejected: %s", msg)
 	}
 	return fmt.Errorf("query error: %s", msg)
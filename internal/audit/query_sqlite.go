@@ -0,0 +1,126 @@
+package audit
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// queryTables are the tables the SQL Query Console may read on SQLite: those
+// granted to the bataudit_readonly role on Postgres.
+var queryTables = []any{"audits", "audit_summaries", "audit_latency_sketches", "audit_sessions", "audits_rehydrated"}
+
+const queryTablesHint = "only audits, audit_summaries, audit_latency_sketches, audit_sessions and audits_rehydrated can be queried"
+
+// sqliteWriteOps are the opcodes of a program that changes the database.
+var sqliteWriteOps = map[string]bool{
+	"OpenWrite": true, "Insert": true, "Delete": true, "IdxInsert": true, "IdxDelete": true,
+	"Clear": true, "Destroy": true, "CreateBtree": true, "ParseSchema": true, "SqlExec": true,
+	"DropTable": true, "DropIndex": true, "DropTrigger": true, "SetCookie": true,
+	"VCreate": true, "VDestroy": true, "VUpdate": true, "Vacuum": true, "IncrVacuum": true,
+	"JournalMode": true, "Checkpoint": true, "MaxPgcnt": true,
+}
+
+// runSQLiteQuery is RunQuery on SQLite, on a connection taken from the pool
+// for the duration of the query. Three guards apply:
+//   - PRAGMA query_only — SQLite rejects any write on the connection. It is
+//     switched off again before the connection goes back to the pool.
+//   - authorizeSQLite — the statement may only read queryTables.
+//   - the context deadline — the driver interrupts a statement still running
+//     after defaultTimeout.
+func runSQLiteQuery(ctx context.Context, sqlDB *sql.DB, q string, args []any) (*QueryResult, error) {
+	ctx, cancel := context.WithTimeout(ctx, defaultTimeout)
+	defer cancel()
+
+	conn, err := sqlDB.Conn(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("db connection: %w", err)
+	}
+	defer conn.Close()
+
+	if _, err := conn.ExecContext(ctx, "PRAGMA query_only = ON"); err != nil {
+		return nil, fmt.Errorf("enable query_only: %w", err)
+	}
+	defer func() {
+		// A connection left read-only would break writers sharing the pool:
+		// discard it when query_only cannot be switched off.
+		if _, err := conn.ExecContext(context.Background(), "PRAGMA query_only = OFF"); err != nil {
+			_ = conn.Raw(func(any) error { return driver.ErrBadConn })
+		}
+	}()
+
+	if err := authorizeSQLite(ctx, conn, q, args); err != nil {
+		return nil, err
+	}
+
+	start := time.Now()
+	rows, err := conn.QueryContext(ctx, q, args...)
+	if err != nil {
+		return nil, friendlyDBError(err)
+	}
+	defer rows.Close()
+	return scanResult(rows, start)
+}
+
+// authorizeSQLite does the job of an authorizer callback, which
+// modernc.org/sqlite does not expose: it compiles the statement with EXPLAIN
+// and checks the program. Every table or index the program opens must belong
+// to queryTables, in the main database, and no opcode may write. Virtual
+// tables (json_each, the full-text index of audits) carry no name in the
+// program and are allowed; none of them reads another table's rows.
+func authorizeSQLite(ctx context.Context, conn *sql.Conn, q string, args []any) error {
+	// Root page of every b-tree, and whether it may be read.
+	type btree struct {
+		table   string
+		allowed bool
+	}
+	pages := map[int64]btree{}
+	placeholders := strings.TrimSuffix(strings.Repeat("?, ", len(queryTables)), ", ")
+	schema, err := conn.QueryContext(ctx, `SELECT rootpage, tbl_name, tbl_name IN (`+placeholders+`) FROM sqlite_schema WHERE rootpage > 0`, queryTables...)
+	if err != nil {
+		return fmt.Errorf("read schema: %w", err)
+	}
+	for schema.Next() {
+		var page int64
+		var b btree
+		if err := schema.Scan(&page, &b.table, &b.allowed); err != nil {
+			schema.Close()
+			return err
+		}
+		pages[page] = b
+	}
+	schema.Close()
+	if err := schema.Err(); err != nil {
+		return err
+	}
+
+	program, err := conn.QueryContext(ctx, "EXPLAIN "+q, args...)
+	if err != nil {
+		return friendlyDBError(err)
+	}
+	defer program.Close()
+	for program.Next() {
+		var addr, p1, p2, p3, p5 int64
+		var opcode string
+		var p4, comment any
+		if err := program.Scan(&addr, &opcode, &p1, &p2, &p3, &p4, &p5, &comment); err != nil {
+			return err
+		}
+		switch {
+		case sqliteWriteOps[opcode], opcode == "Transaction" && p2 != 0:
+			return fmt.Errorf("query rejected: the query console is read-only")
+		case opcode == "OpenRead" || opcode == "ReopenIdx":
+			b, ok := pages[p2]
+			if p3 != 0 || !ok {
+				return fmt.Errorf("query rejected: %s", queryTablesHint)
+			}
+			if !b.allowed {
+				return fmt.Errorf("query rejected: %s cannot be read; %s", b.table, queryTablesHint)
+			}
+		}
+	}
+	return program.Err()
+}
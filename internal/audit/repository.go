@@ -1,18 +1,28 @@
 package audit
 
 import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
 	"time"
 
+	"github.com/joaovrmoraes/bataudit/internal/dialect"
 	"gorm.io/gorm"
 )
 
 type ListResult struct {
 	Data       []AuditSummary
 	TotalItems int64
+	// TotalEstimated is set when TotalItems is the planner's estimate.
+	TotalEstimated bool
+	// NextCursor continues the list after Data; empty on the last page.
+	NextCursor string
 }
 
 type ListFilters struct {
 	ProjectID   string
+	ProjectIDs  []string // non-nil limits to these projects
 	ServiceName string
 	Identifier  string
 	Method      string
@@ -21,23 +31,48 @@ type ListFilters struct {
 	StatusClass string // 2xx | 3xx | 4xx | 5xx
 	Environment string
 	EventType   string // http | system.alert
+	TraceID     string
 	StartDate   *time.Time
 	EndDate     *time.Time
-	SortBy      string // timestamp | status_code | response_time
-	SortOrder   string // asc | desc
+	SortBy      string   // timestamp | status_code | response_time
+	SortOrder   string   // asc | desc
+	Search      string   // full-text query, see ParseSearch
+	Fields      []string // JSON field filters, see ParseFieldFilter
+	// Rehydrated reads restored archive events (audits_rehydrated) instead
+	// of live ones; RehydrationID narrows to one rehydration.
+	Rehydrated    bool
+	RehydrationID string
+	// After continues a keyset listing after this position, instead of
+	// the offset. Total is how List computes TotalItems (default exact).
+	After *Cursor
+	Total TotalMode
 }
 
 type Repository interface {
 	Create(audit *Audit) error
 	List(limit, offset int, filters ListFilters) (ListResult, error)
-	Export(filters ListFilters, maxRows int) ([]AuditSummary, error)
+	Export(filters ListFilters, maxRows int, fn func([]AuditSummary) error) error
 	GetByID(id string) (*Audit, error)
-	GetStats(projectID, environment string) (*AuditStats, error)
-	GetSessions(filters SessionFilters) ([]Session, error)
+	GetRehydratedByID(id string) (*Audit, error)
+	GetStats(filters StatsFilters) (*AuditStats, error)
+	GetSessions(filters SessionFilters) (SessionPage, error)
+	GetSessionSettings(projectID string) (*SessionSettings, error)
+	SaveSessionSettings(s *SessionSettings) error
+	RebuildSessions(projectID string) error
 	GetSessionByID(sessionID string) (*SessionDetail, error)
 	GetOrphans(filters OrphanFilters) ([]AuditSummary, error)
 	GetInsights(filters InsightFilters) (*InsightsResult, error)
+	CompareInsights(filters InsightFilters, current, previous Window) (*InsightsComparison, error)
+	GetIdentity(identifier string, projectIDs []string) (*IdentityProfile, error)
 	GetAffectedUsers(projectID, path, method, start, end string, limit int) ([]AffectedUser, error)
+	VerifyChain(ctx context.Context, projectID string, fromSeq, toSeq int64) (*ChainVerification, error)
+	ChainHeads(projectIDs []string) (map[string]int64, error)
+	ListAfterSeq(filters ListFilters, projectID string, afterSeq, toSeq int64, limit int) ([]TailEvent, error)
+	GetTrace(traceID string, projectIDs []string, limit int) ([]TraceSpan, error)
+	Aggregate(q AggregateQuery) (*AggregateResult, error)
+	GetLatency(filters LatencyFilters) (*LatencyResult, error)
+	Funnel(q FunnelQuery) (*FunnelResult, error)
+	Paths(q PathQuery) (*PathResult, error)
 }
 
 type repository struct {
@@ -48,23 +83,40 @@ func NewRepository(db *gorm.DB) Repository {
 	return &repository{db: db}
 }
 
+// Create stores audit as the next link of its project's hash chain and adds
+// it to its session.
 func (r *repository) Create(audit *Audit) error {
-	db := r.db
-	if audit.ProjectID == "" {
-		db = db.Omit("ProjectID")
-	}
-	return db.Create(audit).Error
+	return r.db.Transaction(func(tx *gorm.DB) error {
+		if err := link(tx, audit); err != nil {
+			return err
+		}
+		return trackSession(tx, audit)
+	})
 }
 
-func (r *repository) List(limit, offset int, filters ListFilters) (ListResult, error) {
-	var audits []AuditSummary
-	var totalItems int64
+// source picks the table List and Export read: live audits, or unexpired
+// rehydrated archive events when filters.Rehydrated is set.
+func (r *repository) source(filters ListFilters) *gorm.DB {
+	if !filters.Rehydrated {
+		return r.db.Model(&Audit{})
+	}
+	query := r.db.Table("audits_rehydrated").Where("expires_at > ?", time.Now().UTC())
+	if filters.RehydrationID != "" {
+		query = query.Where("rehydration_id = ?", filters.RehydrationID)
+	}
+	return query
+}
 
-	query := r.db.Model(&Audit{})
+// filtered applies every filter of filters except the sort.
+func (r *repository) filtered(filters ListFilters) (*gorm.DB, error) {
+	query := r.source(filters)
 
 	if filters.ProjectID != "" {
 		query = query.Where("project_id = ?", filters.ProjectID)
 	}
+	if filters.ProjectIDs != nil {
+		query = query.Where("project_id IN ?", filters.ProjectIDs)
+	}
 	if filters.ServiceName != "" {
 		query = query.Where("service_name = ?", filters.ServiceName)
 	}
@@ -96,92 +148,197 @@ func (r *repository) List(limit, offset int, filters ListFilters) (ListResult, e
 	if filters.EventType != "" {
 		query = query.Where("event_type = ?", filters.EventType)
 	}
+	if filters.TraceID != "" {
+		query = query.Where("trace_id = ?", filters.TraceID)
+	}
 	if filters.StartDate != nil {
 		query = query.Where("timestamp >= ?", filters.StartDate)
 	}
 	if filters.EndDate != nil {
 		query = query.Where("timestamp <= ?", filters.EndDate)
 	}
+	query, err := applySearch(query, filters)
+	if err != nil {
+		return nil, err
+	}
+	return applyFieldFilters(query, filters.Fields)
+}
+
+const summaryColumns = "id, event_type, identifier, user_email, user_name, method, path, status_code, service_name, timestamp, response_time, trace_id"
+
+func (r *repository) List(limit, offset int, filters ListFilters) (ListResult, error) {
+	var audits []AuditSummary
+	var result ListResult
 
-	if err := query.Count(&totalItems).Error; err != nil {
+	query, err := r.filtered(filters)
+	if err != nil {
 		return ListResult{}, err
 	}
 
-	allowedSortCols := map[string]bool{"timestamp": true, "status_code": true, "response_time": true}
-	sortCol := "timestamp"
-	if allowedSortCols[filters.SortBy] {
-		sortCol = filters.SortBy
+	switch filters.Total {
+	case TotalNone:
+	case TotalEstimate:
+		result.TotalItems, result.TotalEstimated, err = r.estimate(query)
+	default:
+		err = query.Session(&gorm.Session{}).Count(&result.TotalItems).Error
 	}
-	sortOrder := "desc"
-	if filters.SortOrder == "asc" {
-		sortOrder = "asc"
+	if err != nil {
+		return ListResult{}, err
 	}
 
-	err := query.
-		Select("id, event_type, identifier, user_email, user_name, method, path, status_code, service_name, timestamp, response_time").
-		Order(sortCol + " " + sortOrder).
-		Limit(limit).
-		Offset(offset).
+	query, err = applyKeyset(query, filters)
+	if err != nil {
+		return ListResult{}, err
+	}
+	if filters.After == nil {
+		query = query.Offset(offset)
+	}
+	// One extra row tells whether there is a next page.
+	err = query.
+		Select(summaryColumns).
+		Limit(limit + 1).
 		Find(&audits).Error
 	if err != nil {
 		return ListResult{}, err
 	}
+	if len(audits) > limit {
+		audits = audits[:limit]
+		result.NextCursor = cursorAfter(audits[limit-1], filters).Encode()
+	}
+	markRehydrated(audits, filters.Rehydrated)
+	if err := r.attachSnippets(audits, filters); err != nil {
+		return ListResult{}, err
+	}
 
-	return ListResult{
-		Data:       audits,
-		TotalItems: totalItems,
-	}, nil
+	result.Data = audits
+	return result, nil
 }
 
-func (r *repository) Export(filters ListFilters, maxRows int) ([]AuditSummary, error) {
-	var audits []AuditSummary
-
-	query := r.db.Model(&Audit{})
+// ChainHeads returns the last chain position of each of projectIDs. Projects
+// without events are missing from the map.
+func (r *repository) ChainHeads(projectIDs []string) (map[string]int64, error) {
+	var heads []ChainHead
+	if err := r.db.Where("project_id IN ?", projectIDs).Find(&heads).Error; err != nil {
+		return nil, err
+	}
+	seqs := make(map[string]int64, len(heads))
+	for _, h := range heads {
+		seqs[h.ProjectID] = h.Seq
+	}
+	return seqs, nil
+}
 
-	if filters.ProjectID != "" {
-		query = query.Where("project_id = ?", filters.ProjectID)
+// ListAfterSeq returns up to limit live events of projectID matching filters
+// whose chain position is in (afterSeq, toSeq], in chain order.
+func (r *repository) ListAfterSeq(filters ListFilters, projectID string, afterSeq, toSeq int64, limit int) ([]TailEvent, error) {
+	filters.ProjectID = projectID
+	filters.Rehydrated = false
+	query, err := r.filtered(filters)
+	if err != nil {
+		return nil, err
 	}
-	if filters.ServiceName != "" {
-		query = query.Where("service_name = ?", filters.ServiceName)
+	var events []TailEvent
+	err = query.
+		Where("chain_seq > ? AND chain_seq <= ?", afterSeq, toSeq).
+		Select(summaryColumns + ", project_id, chain_seq").
+		Order("chain_seq").
+		Limit(limit).
+		Find(&events).Error
+	if err != nil || filters.Search == "" {
+		return events, err
 	}
-	if filters.Identifier != "" {
-		query = query.Where("identifier = ?", filters.Identifier)
+
+	summaries := make([]AuditSummary, len(events))
+	for i := range events {
+		summaries[i] = events[i].AuditSummary
 	}
-	if filters.Method != "" {
-		query = query.Where("method = ?", filters.Method)
+	if err := r.attachSnippets(summaries, filters); err != nil {
+		return nil, err
 	}
-	if filters.StatusCode != 0 {
-		query = query.Where("status_code = ?", filters.StatusCode)
+	for i := range events {
+		events[i].Snippet = summaries[i].Snippet
 	}
-	switch filters.StatusClass {
-	case "2xx":
-		query = query.Where("status_code >= 200 AND status_code < 300")
-	case "3xx":
-		query = query.Where("status_code >= 300 AND status_code < 400")
-	case "4xx":
-		query = query.Where("status_code >= 400 AND status_code < 500")
-	case "5xx":
-		query = query.Where("status_code >= 500")
+	return events, nil
+}
+
+// estimate returns the planner's estimate of the rows query matches, and
+// true. SQLite keeps no row estimates, so there the count is exact and the
+// second result false.
+func (r *repository) estimate(query *gorm.DB) (int64, bool, error) {
+	if r.db.Dialector.Name() == "sqlite" {
+		var n int64
+		err := query.Session(&gorm.Session{}).Count(&n).Error
+		return n, false, err
+	}
+	stmt := query.Session(&gorm.Session{DryRun: true}).Select("id").Find(&[]AuditSummary{}).Statement
+	var plan string
+	if err := r.db.ConnPool.QueryRowContext(context.Background(), "EXPLAIN (FORMAT JSON) "+stmt.SQL.String(), stmt.Vars...).Scan(&plan); err != nil {
+		return 0, false, err
+	}
+	var nodes []struct {
+		Plan struct {
+			Rows float64 `json:"Plan Rows"`
+		}
 	}
-	if filters.Environment != "" {
-		query = query.Where("environment = ?", filters.Environment)
+	if err := json.Unmarshal([]byte(plan), &nodes); err != nil || len(nodes) == 0 {
+		return 0, false, fmt.Errorf("unexpected EXPLAIN output: %w", err)
 	}
-	if filters.EventType != "" {
-		query = query.Where("event_type = ?", filters.EventType)
+	return int64(nodes[0].Plan.Rows), true, nil
+}
+
+// ErrExportTooLarge is returned by Export when more events match than it
+// may return.
+var ErrExportTooLarge = errors.New("export exceeds the row limit")
+
+const exportBatchSize = 1000
+
+// Export calls fn with the events matching filters, newest first, in batches
+// read by cursor, so they are never all held in memory. When more than
+// maxRows events match, it returns ErrExportTooLarge before calling fn.
+func (r *repository) Export(filters ListFilters, maxRows int, fn func([]AuditSummary) error) error {
+	filters.SortBy, filters.SortOrder, filters.After = "timestamp", "desc", nil
+	query, err := r.filtered(filters)
+	if err != nil {
+		return err
 	}
-	if filters.StartDate != nil {
-		query = query.Where("timestamp >= ?", filters.StartDate)
+
+	var n int64
+	err = r.db.Table("(?) AS matched", query.Session(&gorm.Session{}).Select("1").Limit(maxRows+1)).Count(&n).Error
+	if err != nil {
+		return err
 	}
-	if filters.EndDate != nil {
-		query = query.Where("timestamp <= ?", filters.EndDate)
+	if n > int64(maxRows) {
+		return ErrExportTooLarge
 	}
 
-	err := query.
-		Select("id, event_type, identifier, user_email, user_name, method, path, status_code, service_name, timestamp, response_time").
-		Order("timestamp desc").
-		Limit(maxRows).
-		Find(&audits).Error
-	return audits, err
+	for {
+		page, err := applyKeyset(query.Session(&gorm.Session{}), filters)
+		if err != nil {
+			return err
+		}
+		var batch []AuditSummary
+		if err := page.Select(summaryColumns).Limit(exportBatchSize).Find(&batch).Error; err != nil {
+			return err
+		}
+		if len(batch) == 0 {
+			return nil
+		}
+		markRehydrated(batch, filters.Rehydrated)
+		if err := fn(batch); err != nil {
+			return err
+		}
+		if len(batch) < exportBatchSize {
+			return nil
+		}
+		after := cursorAfter(batch[len(batch)-1], filters)
+		filters.After = &after
+	}
+}
+
+func markRehydrated(audits []AuditSummary, rehydrated bool) {
+	for i := range audits {
+		audits[i].Rehydrated = rehydrated
+	}
 }
 
 func (r *repository) GetByID(id string) (*Audit, error) {
@@ -192,84 +349,18 @@ func (r *repository) GetByID(id string) (*Audit, error) {
 	return &audit, nil
 }
 
-func (r *repository) GetSessions(filters SessionFilters) ([]Session, error) {
-	// Uses a gap-based session detection: a new session starts when
-	// the gap between consecutive events exceeds 30 minutes.
-	// We achieve this in PostgreSQL using LAG() window function.
-	where := "1=1"
-	args := []interface{}{}
-
-	if filters.ProjectID != "" {
-		where += " AND project_id = ?"
-		args = append(args, filters.ProjectID)
-	}
-	if filters.Identifier != "" {
-		where += " AND identifier = ?"
-		args = append(args, filters.Identifier)
-	}
-	if filters.ServiceName != "" {
-		where += " AND service_name = ?"
-		args = append(args, filters.ServiceName)
-	}
-	// Default to last 7 days to avoid full-table window function scans.
-	if filters.StartDate != nil {
-		where += " AND timestamp >= ?"
-		args = append(args, filters.StartDate)
-	} else {
-		where += " AND timestamp >= NOW() - INTERVAL '7 days'"
-	}
-	if filters.EndDate != nil {
-		where += " AND timestamp <= ?"
-		args = append(args, filters.EndDate)
-	}
-
-	query := `
-		WITH ranked AS (
-			SELECT
-				identifier,
-				service_name,
-				timestamp,
-				LAG(timestamp) OVER (PARTITION BY identifier, service_name ORDER BY timestamp) AS prev_ts
-			FROM audits
-			WHERE ` + where + `
-		),
-		session_starts AS (
-			SELECT
-				identifier,
-				service_name,
-				timestamp,
-				CASE
-					WHEN prev_ts IS NULL OR EXTRACT(EPOCH FROM (timestamp - prev_ts)) > 1800 THEN 1
-					ELSE 0
-				END AS is_new_session
-			FROM ranked
-		),
-		session_groups AS (
-			SELECT
-				identifier,
-				service_name,
-				timestamp,
-				SUM(is_new_session) OVER (PARTITION BY identifier, service_name ORDER BY timestamp) AS session_id
-			FROM session_starts
-		)
-		SELECT
-			identifier,
-			service_name,
-			TO_CHAR(MIN(timestamp), 'YYYY-MM-DD"T"HH24:MI:SS"Z"') AS session_start,
-			TO_CHAR(MAX(timestamp), 'YYYY-MM-DD"T"HH24:MI:SS"Z"') AS session_end,
-			EXTRACT(EPOCH FROM (MAX(timestamp) - MIN(timestamp))) AS duration_seconds,
-			COUNT(*) AS event_count
-		FROM session_groups
-		GROUP BY identifier, service_name, session_id
-		ORDER BY MIN(timestamp) DESC
-		LIMIT 200
-	`
-
-	var sessions []Session
-	if err := r.db.Raw(query, args...).Scan(&sessions).Error; err != nil {
+// GetRehydratedByID looks an event up among unexpired rehydrated archive
+// events. An event restored by several rehydrations is returned once.
+func (r *repository) GetRehydratedByID(id string) (*Audit, error) {
+	var audit Audit
+	err := r.db.Table("audits_rehydrated").
+		Where("id = ? AND expires_at > ?", id, time.Now().UTC()).
+		Order("expires_at desc").
+		Take(&audit).Error
+	if err != nil {
 		return nil, err
 	}
-	return sessions, nil
+	return &audit, nil
 }
 
 func (r *repository) GetSessionByID(sessionID string) (*SessionDetail, error) {
@@ -282,6 +373,25 @@ func (r *repository) GetSessionByID(sessionID string) (*SessionDetail, error) {
 	if err != nil {
 		return nil, err
 	}
+
+	// The stored session keeps its stats once tiering removed its events.
+	var stored []StoredSession
+	if err := r.db.Where("session_id = ?", sessionID).Order("started_at").Limit(1).Find(&stored).Error; err != nil {
+		return nil, err
+	}
+	if len(stored) == 1 {
+		s := stored[0].session()
+		return &SessionDetail{
+			SessionID:       sessionID,
+			Identifier:      s.Identifier,
+			ServiceName:     s.ServiceName,
+			SessionStart:    s.SessionStart,
+			SessionEnd:      s.SessionEnd,
+			DurationSeconds: s.DurationSeconds,
+			EventCount:      s.EventCount,
+			Events:          events,
+		}, nil
+	}
 	if len(events) == 0 {
 		return nil, nil
 	}
@@ -294,14 +404,15 @@ func (r *repository) GetSessionByID(sessionID string) (*SessionDetail, error) {
 		DurationSeconds float64
 		EventCount      int64
 	}
+	d := dialect.Of(r.db)
 	r.db.Model(&Audit{}).
 		Where("session_id = ?", sessionID).
 		Select(`
 			identifier,
 			service_name,
-			TO_CHAR(MIN(timestamp), 'YYYY-MM-DD"T"HH24:MI:SS"Z"') AS session_start,
-			TO_CHAR(MAX(timestamp), 'YYYY-MM-DD"T"HH24:MI:SS"Z"') AS session_end,
-			EXTRACT(EPOCH FROM (MAX(timestamp) - MIN(timestamp))) AS duration_seconds,
+			` + d.ISOTime("MIN(timestamp)") + ` AS session_start,
+			` + d.ISOTime("MAX(timestamp)") + ` AS session_end,
+			` + d.Seconds("MIN(timestamp)", "MAX(timestamp)") + ` AS duration_seconds,
 			COUNT(*) AS event_count
 		`).
 		Group("identifier, service_name").
@@ -319,7 +430,7 @@ func (r *repository) GetSessionByID(sessionID string) (*SessionDetail, error) {
 	}, nil
 }
 
-func (r *repository) GetStats(projectID, environment string) (*AuditStats, error) {
+func (r *repository) GetStats(filters StatsFilters) (*AuditStats, error) {
 	stats := &AuditStats{
 		ByService:     []ServiceBreakdown{},
 		ByStatusClass: map[string]int64{"2xx": 0, "3xx": 0, "4xx": 0, "5xx": 0},
@@ -327,16 +438,31 @@ func (r *repository) GetStats(projectID, environment string) (*AuditStats, error
 		Timeline:      []TimelinePoint{},
 	}
 
+	d := dialect.Of(r.db)
+
 	// Build WHERE clause once — shared across all CTEs
 	where := "1=1"
 	args := []interface{}{}
-	if projectID != "" {
+	if filters.ProjectID != "" {
 		where += " AND project_id = ?"
-		args = append(args, projectID)
+		args = append(args, filters.ProjectID)
 	}
-	if environment != "" {
+	if filters.Environment != "" {
 		where += " AND environment = ?"
-		args = append(args, environment)
+		args = append(args, filters.Environment)
+	}
+	if filters.Start != nil {
+		where += " AND timestamp >= ?"
+		args = append(args, *filters.Start)
+	}
+	if filters.End != nil {
+		where += " AND timestamp < ?"
+		args = append(args, *filters.End)
+	}
+	// The timeline covers the last 24 hours of the window.
+	timelineEnd := time.Now().UTC()
+	if filters.End != nil {
+		timelineEnd = *filters.End
 	}
 
 	// ── Main metrics ──────────────────────────────────────────────────────────
@@ -345,7 +471,10 @@ func (r *repository) GetStats(projectID, environment string) (*AuditStats, error
 		Errors4xx       int64   `gorm:"column:errors_4xx"`
 		Errors5xx       int64   `gorm:"column:errors_5xx"`
 		AvgResponseTime float64 `gorm:"column:avg_response_time"`
+		P50ResponseTime float64 `gorm:"column:p50_response_time"`
 		P95ResponseTime float64 `gorm:"column:p95_response_time"`
+		P99ResponseTime float64 `gorm:"column:p99_response_time"`
+		MaxResponseTime int64   `gorm:"column:max_response_time"`
 		ActiveServices  int64   `gorm:"column:active_services"`
 		LastEventAt     string  `gorm:"column:last_event_at"`
 	}
@@ -356,16 +485,22 @@ func (r *repository) GetStats(projectID, environment string) (*AuditStats, error
 			COUNT(CASE WHEN status_code >= 400 AND status_code < 500 THEN 1 END) AS errors_4xx,
 			COUNT(CASE WHEN status_code >= 500 THEN 1 END) AS errors_5xx,
 			COALESCE(AVG(response_time), 0) AS avg_response_time,
-			COALESCE(PERCENTILE_CONT(0.95) WITHIN GROUP (ORDER BY response_time), 0) AS p95_response_time,
+			COALESCE(`+d.Percentile(0.5, "response_time")+`, 0) AS p50_response_time,
+			COALESCE(`+d.Percentile(0.95, "response_time")+`, 0) AS p95_response_time,
+			COALESCE(`+d.Percentile(0.99, "response_time")+`, 0) AS p99_response_time,
+			COALESCE(MAX(response_time), 0) AS max_response_time,
 			COUNT(DISTINCT service_name) AS active_services,
-			COALESCE(TO_CHAR(MAX(timestamp), 'YYYY-MM-DD"T"HH24:MI:SS"Z"'), '') AS last_event_at
+			COALESCE(`+d.ISOTime("MAX(timestamp)")+`, '') AS last_event_at
 		FROM audits WHERE `+where, args...).Scan(&m)
 
 	stats.Total = m.Total
 	stats.Errors4xx = m.Errors4xx
 	stats.Errors5xx = m.Errors5xx
 	stats.AvgResponseTime = m.AvgResponseTime
+	stats.P50ResponseTime = m.P50ResponseTime
 	stats.P95ResponseTime = m.P95ResponseTime
+	stats.P99ResponseTime = m.P99ResponseTime
+	stats.MaxResponseTime = m.MaxResponseTime
 	stats.ActiveServices = m.ActiveServices
 	stats.LastEventAt = m.LastEventAt
 
@@ -391,7 +526,7 @@ func (r *repository) GetStats(projectID, environment string) (*AuditStats, error
 			COUNT(*) AS n,
 			COUNT(CASE WHEN status_code >= 400 THEN 1 END) AS errors,
 			COALESCE(AVG(response_time), 0) AS avg_ms,
-			COALESCE(TO_CHAR(MAX(timestamp), 'YYYY-MM-DD"T"HH24:MI:SS"Z"'), '') AS last_event_at
+			COALESCE(`+d.ISOTime("MAX(timestamp)")+`, '') AS last_event_at
 		FROM f GROUP BY service_name
 
 		UNION ALL
@@ -416,13 +551,13 @@ func (r *repository) GetStats(projectID, environment string) (*AuditStats, error
 		UNION ALL
 
 		SELECT 'timeline' AS kind,
-			TO_CHAR(DATE_TRUNC('hour', timestamp), 'YYYY-MM-DD"T"HH24:MI:SS"Z"') AS key1, '' AS key2,
+			`+d.ISOTime(d.Trunc("hour", "timestamp"))+` AS key1, '' AS key2,
 			COUNT(*) AS n, 0 AS errors, 0 AS avg_ms, '' AS last_event_at
 		FROM f
-		WHERE timestamp >= NOW() - INTERVAL '24 hours'
+		WHERE timestamp >= ?
 		GROUP BY key1
 		ORDER BY key1 ASC
-	`, args...).Scan(&rows)
+	`, append(args, timelineEnd.Add(-24*time.Hour))...).Scan(&rows)
 
 	serviceOrder := []string{}
 	serviceMap := map[string]*ServiceBreakdown{}
@@ -456,10 +591,14 @@ func (r *repository) GetStats(projectID, environment string) (*AuditStats, error
 }
 
 func (r *repository) GetOrphans(filters OrphanFilters) ([]AuditSummary, error) {
+	// A browser event is correlated by its request_id and, when traced, by
+	// its trace: any backend event of the same trace means the action
+	// reached the backend.
 	query := r.db.Model(&Audit{}).
 		Where("source = ?", "browser").
-		Where("request_id != ''").
-		Where("NOT EXISTS (SELECT 1 FROM audits a WHERE a.source = 'backend' AND a.request_id = audits.request_id AND a.request_id != '')")
+		Where("(request_id != '' OR trace_id IS NOT NULL)").
+		Where("NOT EXISTS (SELECT 1 FROM audits a WHERE a.source = 'backend' AND a.request_id = audits.request_id AND a.request_id != '')").
+		Where("NOT EXISTS (SELECT 1 FROM audits a WHERE a.source = 'backend' AND a.trace_id = audits.trace_id)")
 
 	if filters.ProjectID != "" {
 		query = query.Where("project_id = ?", filters.ProjectID)
@@ -476,7 +615,7 @@ func (r *repository) GetOrphans(filters OrphanFilters) ([]AuditSummary, error) {
 
 	var orphans []AuditSummary
 	err := query.
-		Select("id, event_type, identifier, user_email, user_name, method, path, status_code, service_name, timestamp, response_time").
+		Select(summaryColumns).
 		Order("timestamp DESC").
 		Limit(100).
 		Find(&orphans).Error
@@ -484,6 +623,36 @@ func (r *repository) GetOrphans(filters OrphanFilters) ([]AuditSummary, error) {
 	return orphans, err
 }
 
+// GetTrace returns up to limit events of a trace, oldest first. A non-nil
+// projectIDs limits them to those projects.
+func (r *repository) GetTrace(traceID string, projectIDs []string, limit int) ([]TraceSpan, error) {
+	query := r.db.Model(&Audit{}).Where("trace_id = ?", traceID)
+	if projectIDs != nil {
+		query = query.Where("project_id IN ?", projectIDs)
+	}
+	var spans []TraceSpan
+	err := query.
+		Select(summaryColumns + ", project_id, span_id, parent_span_id, source, request_id").
+		Order("timestamp, id").
+		Limit(limit).
+		Find(&spans).Error
+	return spans, err
+}
+
+// insightScope selects the events the insights rank: those of the filtered
+// project and environment, alerts excepted.
+func (r *repository) insightScope(filters InsightFilters) *gorm.DB {
+	q := r.db.Model(&Audit{}).
+		Where("event_type != 'system.alert' OR event_type IS NULL")
+	if filters.ProjectID != "" {
+		q = q.Where("project_id = ?", filters.ProjectID)
+	}
+	if filters.Environment != "" {
+		q = q.Where("environment = ?", filters.Environment)
+	}
+	return q
+}
+
 func (r *repository) GetInsights(filters InsightFilters) (*InsightsResult, error) {
 	result := &InsightsResult{
 		TopEndpoints:   []TopEndpoint{},
@@ -492,25 +661,9 @@ func (r *repository) GetInsights(filters InsightFilters) (*InsightsResult, error
 		TopSlowRoutes:  []TopSlowRoute{},
 	}
 
-	days := 7
-	switch filters.Period {
-	case "30d":
-		days = 30
-	case "90d":
-		days = 90
-	}
-
+	window := filters.Window(time.Now().UTC())
 	base := func() *gorm.DB {
-		q := r.db.Model(&Audit{}).
-			Where("timestamp >= NOW() - INTERVAL '1 day' * ?", days).
-			Where("event_type != 'system.alert' OR event_type IS NULL")
-		if filters.ProjectID != "" {
-			q = q.Where("project_id = ?", filters.ProjectID)
-		}
-		if filters.Environment != "" {
-			q = q.Where("environment = ?", filters.Environment)
-		}
-		return q
+		return r.insightScope(filters).Where("timestamp >= ?", window.Start)
 	}
 
 	// Top endpoints
@@ -601,10 +754,29 @@ func (r *repository) GetAffectedUsers(projectID, path, method, start, end string
 		q = q.Where("timestamp <= ?", end)
 	}
 
-	var users []AffectedUser
+	var rows []struct {
+		Identifier string
+		UserEmail  string
+		UserName   string
+		ErrorCount int64
+		LastSeen   dialect.Time
+	}
 	err := q.Group("identifier, user_email, user_name").
 		Order("error_count DESC").
 		Limit(limit).
-		Scan(&users).Error
-	return users, err
+		Scan(&rows).Error
+	if err != nil {
+		return nil, err
+	}
+	users := make([]AffectedUser, len(rows))
+	for i, row := range rows {
+		users[i] = AffectedUser{
+			Identifier: row.Identifier,
+			UserEmail:  row.UserEmail,
+			UserName:   row.UserName,
+			ErrorCount: row.ErrorCount,
+			LastSeen:   row.LastSeen.Time,
+		}
+	}
+	return users, nil
 }
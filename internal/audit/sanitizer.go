@@ -21,6 +21,10 @@ func SanitizeAudit(audit *Audit) {
 	audit.ErrorMessage = sanitizeString(audit.ErrorMessage)
 	audit.ServiceName = sanitizeString(audit.ServiceName)
 	audit.Environment = sanitizeEnvironment(audit.Environment)
+	audit.TraceID = strings.ToLower(strings.TrimSpace(audit.TraceID))
+	audit.SpanID = strings.ToLower(strings.TrimSpace(audit.SpanID))
+	audit.ParentSpanID = strings.ToLower(strings.TrimSpace(audit.ParentSpanID))
+	audit.Traceparent = strings.ToLower(strings.TrimSpace(audit.Traceparent))
 
 	if len(audit.UserRoles) > 0 {
 		audit.UserRoles = sanitizeJSON(audit.UserRoles)
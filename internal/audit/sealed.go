@@ -0,0 +1,54 @@
+package audit
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+)
+
+// SealedVersion is the envelope version written by the Worker.
+const SealedVersion = 1
+
+// Sealed is the stored form of a JSON column encrypted by the Worker (see
+// package fieldcrypt): the value is replaced by this envelope. ID is fixed
+// when the value is first sealed and is all the hash chain covers, so a value
+// re-encrypted under a new data key keeps its hash. The ciphertext is
+// authenticated, together with the event ID, column and envelope ID, when it
+// is decrypted.
+type Sealed struct {
+	Version int    `json:"bataudit_enc"`
+	ID      string `json:"id"`
+	KeyID   string `json:"kid"`
+	Data    string `json:"ct"`
+}
+
+// ParseSealed returns raw as a sealed envelope, or false when it is not one.
+func ParseSealed(raw []byte) (*Sealed, bool) {
+	if !bytes.Contains(raw, []byte(`"bataudit_enc"`)) {
+		return nil, false
+	}
+	dec := json.NewDecoder(bytes.NewReader(raw))
+	dec.DisallowUnknownFields()
+	var s Sealed
+	if err := dec.Decode(&s); err != nil {
+		return nil, false
+	}
+	if s.Version != SealedVersion || s.ID == "" || s.KeyID == "" || s.Data == "" {
+		return nil, false
+	}
+	return &s, true
+}
+
+// chainContent is the part of the envelope the hash chain covers.
+func (s *Sealed) chainContent() json.RawMessage {
+	out, _ := json.Marshal(struct {
+		Version int    `json:"bataudit_enc"`
+		ID      string `json:"id"`
+	}{s.Version, s.ID})
+	return out
+}
+
+// Opener decrypts the sealed fields of an event in place.
+type Opener interface {
+	Open(ctx context.Context, ev *Audit) error
+}
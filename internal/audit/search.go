@@ -0,0 +1,219 @@
+package audit
+
+import (
+	"errors"
+	"fmt"
+	"html"
+	"strings"
+	"unicode"
+
+	"gorm.io/gorm"
+)
+
+// Full-text search (the q parameter of List and Export) covers the path,
+// error message, identifier, user email and name, and the string and number
+// values of request and response bodies. Bodies sealed by field encryption
+// are not indexed.
+//
+// On Postgres, searchDocument is indexed with GIN (migration 000027); it must
+// stay identical to the index expression or the index is not used. On SQLite,
+// triggers keep the FTS5 table audit_search in sync with audits and
+// audits_rehydrated.
+const searchDocument = `(to_tsvector('simple', translate(coalesce(path, ''), '/', ' ') || ' ' || coalesce(error_message, '') || ' ' || coalesce(identifier, '') || ' ' || coalesce(user_email, '') || ' ' || coalesce(user_name, ''))` +
+	` || jsonb_to_tsvector('simple', CASE WHEN request_body -> 'bataudit_enc' IS NULL THEN coalesce(request_body, 'null') ELSE 'null' END, '["string", "numeric"]')` +
+	` || jsonb_to_tsvector('simple', CASE WHEN response_body -> 'bataudit_enc' IS NULL THEN coalesce(response_body, 'null') ELSE 'null' END, '["string", "numeric"]'))`
+
+// searchText is the text snippets are cut from on Postgres.
+const searchText = `concat_ws(' ', translate(path, '/', ' '), error_message, identifier, user_email, user_name,` +
+	` CASE WHEN request_body -> 'bataudit_enc' IS NULL THEN request_body::text END,` +
+	` CASE WHEN response_body -> 'bataudit_enc' IS NULL THEN response_body::text END)`
+
+const (
+	maxSearchLength = 256
+	maxSearchTerms  = 16
+
+	// Snippet highlight markers, replaced by <mark> tags once the snippet
+	// is HTML-escaped.
+	markStart = "\x01"
+	markStop  = "\x02"
+)
+
+// SearchTerm is one term of a search: a word or a quoted phrase. Every term
+// must match. A trailing * makes the last word a prefix.
+type SearchTerm struct {
+	Text   string
+	Phrase bool
+	Prefix bool
+}
+
+// ParseSearch parses a search query: words, "quoted phrases", and a trailing
+// * for prefix matching (ord*, "order 44"*).
+func ParseSearch(q string) ([]SearchTerm, error) {
+	if len(q) > maxSearchLength {
+		return nil, fmt.Errorf("q must be at most %d characters", maxSearchLength)
+	}
+	var terms []SearchTerm
+	rs := []rune(q)
+	for i := 0; i < len(rs); {
+		if unicode.IsSpace(rs[i]) {
+			i++
+			continue
+		}
+		var t SearchTerm
+		if rs[i] == '"' {
+			end := i + 1
+			for end < len(rs) && rs[end] != '"' {
+				end++
+			}
+			t = SearchTerm{Text: string(rs[i+1 : min(end, len(rs))]), Phrase: true}
+			i = end + 1
+		} else {
+			end := i
+			for end < len(rs) && !unicode.IsSpace(rs[end]) && rs[end] != '"' {
+				end++
+			}
+			t = SearchTerm{Text: string(rs[i:end])}
+			i = end
+		}
+		for i < len(rs) && rs[i] == '*' {
+			t.Prefix = true
+			i++
+		}
+		if strings.HasSuffix(t.Text, "*") {
+			t.Text = strings.TrimRight(t.Text, "*")
+			t.Prefix = true
+		}
+		if len(searchWords(t.Text)) == 0 {
+			continue
+		}
+		terms = append(terms, t)
+	}
+	if len(terms) == 0 {
+		return nil, errors.New("q has no words to search for")
+	}
+	if len(terms) > maxSearchTerms {
+		return nil, fmt.Errorf("q may have at most %d terms", maxSearchTerms)
+	}
+	return terms, nil
+}
+
+// searchWords splits text into runs of letters and digits, as both engines
+// tokenize it.
+func searchWords(text string) []string {
+	return strings.FieldsFunc(text, func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	})
+}
+
+// tsquery renders terms as a Postgres tsquery expression.
+func tsquery(terms []SearchTerm) (string, []any) {
+	parts := make([]string, 0, len(terms))
+	args := make([]any, 0, len(terms))
+	for _, t := range terms {
+		if !t.Prefix {
+			// Parsed like the indexed text, so e-mail addresses and paths
+			// match as they were indexed.
+			parts = append(parts, "phraseto_tsquery('simple', ?)")
+			args = append(args, strings.ReplaceAll(t.Text, "/", " "))
+			continue
+		}
+		words := searchWords(t.Text)
+		for i, w := range words {
+			words[i] = "'" + w + "'"
+		}
+		parts = append(parts, "to_tsquery('simple', ?)")
+		args = append(args, strings.Join(words, " <-> ")+":*")
+	}
+	return "(" + strings.Join(parts, " && ") + ")", args
+}
+
+// ftsQuery renders terms as an FTS5 MATCH expression.
+func ftsQuery(terms []SearchTerm) string {
+	parts := make([]string, 0, len(terms))
+	for _, t := range terms {
+		p := `"` + strings.ReplaceAll(t.Text, `"`, `""`) + `"`
+		if t.Prefix {
+			p += "*"
+		}
+		parts = append(parts, p)
+	}
+	return strings.Join(parts, " ")
+}
+
+// searchTable returns the table List and Export read for filters.
+func searchTable(filters ListFilters) string {
+	if filters.Rehydrated {
+		return "audits_rehydrated"
+	}
+	return "audits"
+}
+
+// applySearch narrows query to events matching filters.Search.
+func applySearch(query *gorm.DB, filters ListFilters) (*gorm.DB, error) {
+	if filters.Search == "" {
+		return query, nil
+	}
+	terms, err := ParseSearch(filters.Search)
+	if err != nil {
+		return nil, err
+	}
+	if query.Dialector.Name() == "sqlite" {
+		return query.Where(`id IN (SELECT r.audit_id FROM audit_search s JOIN audit_search_rows r ON r.rowid = s.rowid
+			WHERE audit_search MATCH ? AND r.source = ?)`, ftsQuery(terms), searchTable(filters)), nil
+	}
+	tsq, args := tsquery(terms)
+	return query.Where(searchDocument+" @@ "+tsq, args...), nil
+}
+
+// attachSnippets sets the snippet of each listed event: the best-matching
+// part of its searched text, HTML-escaped, with matches in <mark> tags.
+func (r *repository) attachSnippets(audits []AuditSummary, filters ListFilters) error {
+	if filters.Search == "" || len(audits) == 0 {
+		return nil
+	}
+	terms, err := ParseSearch(filters.Search)
+	if err != nil {
+		return err
+	}
+	ids := make([]string, len(audits))
+	for i := range audits {
+		ids[i] = audits[i].ID
+	}
+
+	var rows []struct {
+		ID      string
+		Snippet string
+	}
+	if r.db.Dialector.Name() == "sqlite" {
+		err = r.db.Raw(`SELECT r.audit_id AS id, snippet(audit_search, -1, ?, ?, '…', 12) AS snippet
+			FROM audit_search s JOIN audit_search_rows r ON r.rowid = s.rowid
+			WHERE audit_search MATCH ? AND r.source = ? AND r.audit_id IN ?`,
+			markStart, markStop, ftsQuery(terms), searchTable(filters), ids).Scan(&rows).Error
+	} else {
+		tsq, args := tsquery(terms)
+		options := "StartSel=" + markStart + ", StopSel=" + markStop + ", MaxWords=20, MinWords=8, MaxFragments=2, FragmentDelimiter=\" … \""
+		err = r.db.Table(searchTable(filters)).
+			Select("id, ts_headline('simple', "+searchText+", "+tsq+", ?) AS snippet", append(args, options)...).
+			Where("id IN ?", ids).
+			Scan(&rows).Error
+	}
+	if err != nil {
+		return err
+	}
+
+	snippets := make(map[string]string, len(rows))
+	for _, row := range rows {
+		snippets[row.ID] = highlight(row.Snippet)
+	}
+	for i := range audits {
+		audits[i].Snippet = snippets[audits[i].ID]
+	}
+	return nil
+}
+
+// highlight HTML-escapes a snippet and turns its markers into <mark> tags.
+func highlight(snippet string) string {
+	s := html.EscapeString(snippet)
+	s = strings.ReplaceAll(s, markStart, "<mark>")
+	return strings.ReplaceAll(s, markStop, "</mark>")
+}
@@ -0,0 +1,53 @@
+package audit
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseSearch(t *testing.T) {
+	terms, err := ParseSearch(`order 4471  "ship to"* cust* "unterminated phrase`)
+	require.NoError(t, err)
+	assert.Equal(t, []SearchTerm{
+		{Text: "order"},
+		{Text: "4471"},
+		{Text: "ship to", Phrase: true, Prefix: true},
+		{Text: "cust", Prefix: true},
+		{Text: "unterminated phrase", Phrase: true},
+	}, terms)
+
+	terms, err = ParseSearch(`alice@example.com - "" ***`)
+	require.NoError(t, err)
+	assert.Equal(t, []SearchTerm{{Text: "alice@example.com"}}, terms, "terms without words are dropped")
+}
+
+func TestParseSearch_Invalid(t *testing.T) {
+	for _, q := range []string{"", "   ", `"" * -`, strings.Repeat("a", maxSearchLength+1), strings.Repeat("a ", maxSearchTerms+1)} {
+		_, err := ParseSearch(q)
+		assert.Error(t, err, "%q", q)
+	}
+}
+
+func TestTsquery(t *testing.T) {
+	terms, err := ParseSearch(`/v1/orders "ship to" o'reilly*`)
+	require.NoError(t, err)
+	sql, args := tsquery(terms)
+	assert.Equal(t, "(phraseto_tsquery('simple', ?) && phraseto_tsquery('simple', ?) && to_tsquery('simple', ?))", sql)
+	assert.Equal(t, []any{" v1 orders", "ship to", "'o' <-> 'reilly':*"}, args)
+}
+
+func TestFtsQuery(t *testing.T) {
+	terms, err := ParseSearch(`order say"hi" "ship to"*`)
+	require.NoError(t, err)
+	assert.Equal(t, `"order" "say" "hi" "ship to"*`, ftsQuery(terms))
+
+	terms = []SearchTerm{{Text: `a"b`}}
+	assert.Equal(t, `"a""b"`, ftsQuery(terms), "quotes are escaped")
+}
+
+func TestHighlight(t *testing.T) {
+	assert.Equal(t, "&lt;b&gt;<mark>4471</mark>&lt;/b&gt;", highlight("<b>"+markStart+"4471"+markStop+"</b>"))
+}
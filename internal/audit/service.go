@@ -26,22 +26,86 @@ func (service *Service) ListAudits(limit, offset int, filters ListFilters) (List
 	return service.repo.List(limit, offset, filters)
 }
 
-func (service *Service) GetSessions(filters SessionFilters) ([]Session, error) {
+func (service *Service) GetSessions(filters SessionFilters) (SessionPage, error) {
 	return service.repo.GetSessions(filters)
 }
 
-func (service *Service) GetStats(projectID, environment string) (*AuditStats, error) {
-	return service.repo.GetStats(projectID, environment)
+func (service *Service) GetStats(filters StatsFilters) (*AuditStats, error) {
+	return service.repo.GetStats(filters)
+}
+
+// CompareStats returns the stats of filters' window and of previous, with
+// their deltas.
+func (service *Service) CompareStats(filters StatsFilters, previous Window) (*StatsComparison, error) {
+	current, err := service.repo.GetStats(filters)
+	if err != nil {
+		return nil, err
+	}
+	before := filters
+	before.Start, before.End = &previous.Start, &previous.End
+	past, err := service.repo.GetStats(before)
+	if err != nil {
+		return nil, err
+	}
+	result := &StatsComparison{
+		Window:         Window{Start: *filters.Start, End: *filters.End},
+		PreviousWindow: previous,
+		Current:        current,
+		Previous:       past,
+	}
+	result.Deltas, result.ByStatusClass, result.Services = compareStats(current, past)
+	return result, nil
 }
 
 func (service *Service) GetOrphans(filters OrphanFilters) ([]AuditSummary, error) {
 	return service.repo.GetOrphans(filters)
 }
 
+// GetTrace returns the event tree of a trace, limited to projectIDs when not
+// nil. Its Truncated flag is set past maxTraceEvents events.
+func (service *Service) GetTrace(traceID string, projectIDs []string) (*Trace, error) {
+	spans, err := service.repo.GetTrace(traceID, projectIDs, maxTraceEvents+1)
+	if err != nil {
+		return nil, err
+	}
+	truncated := len(spans) > maxTraceEvents
+	if truncated {
+		spans = spans[:maxTraceEvents]
+	}
+	trace := BuildTrace(traceID, spans)
+	trace.Truncated = truncated
+	return trace, nil
+}
+
+// Aggregate runs q, which must have been validated.
+func (service *Service) Aggregate(q AggregateQuery) (*AggregateResult, error) {
+	return service.repo.Aggregate(q)
+}
+
+func (service *Service) GetLatency(filters LatencyFilters) (*LatencyResult, error) {
+	return service.repo.GetLatency(filters)
+}
+
+func (service *Service) Funnel(q FunnelQuery) (*FunnelResult, error) {
+	return service.repo.Funnel(q)
+}
+
+func (service *Service) Paths(q PathQuery) (*PathResult, error) {
+	return service.repo.Paths(q)
+}
+
 func (service *Service) GetInsights(filters InsightFilters) (*InsightsResult, error) {
 	return service.repo.GetInsights(filters)
 }
 
+func (service *Service) GetIdentity(identifier string, projectIDs []string) (*IdentityProfile, error) {
+	return service.repo.GetIdentity(identifier, projectIDs)
+}
+
+func (service *Service) CompareInsights(filters InsightFilters, current, previous Window) (*InsightsComparison, error) {
+	return service.repo.CompareInsights(filters, current, previous)
+}
+
 func (service *Service) GetAffectedUsers(projectID, path, method, start, end string, limit int) ([]AffectedUser, error) {
 	return service.repo.GetAffectedUsers(projectID, path, method, start, end, limit)
 }
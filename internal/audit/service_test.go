@@ -1,12 +1,14 @@
 package audit
 
 import (
+	"context"
 	"errors"
 	"testing"
 	"time"
 
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
+	"gorm.io/gorm"
 )
 
 // --- Mock Repository ---
@@ -14,10 +16,10 @@ import (
 type mockRepository struct {
 	createFn           func(audit *Audit) error
 	listFn             func(limit, offset int, filters ListFilters) (ListResult, error)
-	exportFn           func(filters ListFilters, maxRows int) ([]AuditSummary, error)
+	exportFn           func(filters ListFilters, maxRows int, fn func([]AuditSummary) error) error
 	getByIDFn          func(id string) (*Audit, error)
 	getStatsFn         func(projectID string) (*AuditStats, error)
-	getSessionsFn      func(filters SessionFilters) ([]Session, error)
+	getSessionsFn      func(filters SessionFilters) (SessionPage, error)
 	getSessionByIDFn   func(sessionID string) (*SessionDetail, error)
 	getOrphansFn       func(filters OrphanFilters) ([]AuditSummary, error)
 	getInsightsFn      func(filters InsightFilters) (*InsightsResult, error)
@@ -37,11 +39,11 @@ func (m *mockRepository) List(limit, offset int, filters ListFilters) (ListResul
 	return ListResult{}, nil
 }
 
-func (m *mockRepository) Export(filters ListFilters, maxRows int) ([]AuditSummary, error) {
+func (m *mockRepository) Export(filters ListFilters, maxRows int, fn func([]AuditSummary) error) error {
 	if m.exportFn != nil {
-		return m.exportFn(filters, maxRows)
+		return m.exportFn(filters, maxRows, fn)
 	}
-	return nil, nil
+	return nil
 }
 
 func (m *mockRepository) GetByID(id string) (*Audit, error) {
@@ -51,18 +53,66 @@ func (m *mockRepository) GetByID(id string) (*Audit, error) {
 	return nil, nil
 }
 
-func (m *mockRepository) GetStats(projectID, environment string) (*AuditStats, error) {
+func (m *mockRepository) GetRehydratedByID(id string) (*Audit, error) {
+	return nil, gorm.ErrRecordNotFound
+}
+
+func (m *mockRepository) VerifyChain(ctx context.Context, projectID string, fromSeq, toSeq int64) (*ChainVerification, error) {
+	return &ChainVerification{ProjectID: projectID, Valid: true}, nil
+}
+
+func (m *mockRepository) ChainHeads(projectIDs []string) (map[string]int64, error) {
+	return map[string]int64{}, nil
+}
+
+func (m *mockRepository) ListAfterSeq(filters ListFilters, projectID string, afterSeq, toSeq int64, limit int) ([]TailEvent, error) {
+	return nil, nil
+}
+
+func (m *mockRepository) GetTrace(traceID string, projectIDs []string, limit int) ([]TraceSpan, error) {
+	return nil, nil
+}
+
+func (m *mockRepository) GetLatency(filters LatencyFilters) (*LatencyResult, error) {
+	return &LatencyResult{Data: []LatencyStats{}, Tiers: []string{"raw"}}, nil
+}
+
+func (m *mockRepository) Funnel(q FunnelQuery) (*FunnelResult, error) {
+	return &FunnelResult{By: q.By, Steps: []FunnelStepResult{}}, nil
+}
+
+func (m *mockRepository) Paths(q PathQuery) (*PathResult, error) {
+	return &PathResult{Transitions: []PathTransition{}}, nil
+}
+
+func (m *mockRepository) Aggregate(q AggregateQuery) (*AggregateResult, error) {
+	return &AggregateResult{Rows: []AggregateRow{}, Tiers: []string{"raw"}}, nil
+}
+
+func (m *mockRepository) GetStats(filters StatsFilters) (*AuditStats, error) {
 	if m.getStatsFn != nil {
-		return m.getStatsFn(projectID)
+		return m.getStatsFn(filters.ProjectID)
 	}
 	return &AuditStats{}, nil
 }
 
-func (m *mockRepository) GetSessions(filters SessionFilters) ([]Session, error) {
+func (m *mockRepository) GetSessions(filters SessionFilters) (SessionPage, error) {
 	if m.getSessionsFn != nil {
 		return m.getSessionsFn(filters)
 	}
-	return nil, nil
+	return SessionPage{}, nil
+}
+
+func (m *mockRepository) GetSessionSettings(projectID string) (*SessionSettings, error) {
+	return &SessionSettings{ProjectID: projectID, InactivityTimeoutSeconds: 1800, Default: true}, nil
+}
+
+func (m *mockRepository) SaveSessionSettings(s *SessionSettings) error {
+	return nil
+}
+
+func (m *mockRepository) RebuildSessions(projectID string) error {
+	return nil
 }
 
 func (m *mockRepository) GetSessionByID(sessionID string) (*SessionDetail, error) {
@@ -91,6 +141,14 @@ func (m *mockRepository) GetInsights(filters InsightFilters) (*InsightsResult, e
 	}, nil
 }
 
+func (m *mockRepository) CompareInsights(filters InsightFilters, current, previous Window) (*InsightsComparison, error) {
+	return &InsightsComparison{Window: current, PreviousWindow: previous}, nil
+}
+
+func (m *mockRepository) GetIdentity(identifier string, projectIDs []string) (*IdentityProfile, error) {
+	return nil, nil
+}
+
 func (m *mockRepository) GetAffectedUsers(projectID, path, method, start, end string, limit int) ([]AffectedUser, error) {
 	return []AffectedUser{}, nil
 }
@@ -239,7 +297,7 @@ func TestGetStats_ReturnsRepoResult(t *testing.T) {
 	}
 	svc := newService(repo)
 
-	result, err := svc.GetStats("proj-1", "")
+	result, err := svc.GetStats(StatsFilters{ProjectID: "proj-1"})
 	require.NoError(t, err)
 	assert.Equal(t, expected, result)
 }
@@ -254,7 +312,7 @@ func TestGetStats_ForwardsProjectID(t *testing.T) {
 	}
 	svc := newService(repo)
 
-	svc.GetStats("my-project", "")
+	svc.GetStats(StatsFilters{ProjectID: "my-project"})
 	assert.Equal(t, "my-project", capturedID)
 }
 
@@ -262,7 +320,7 @@ func TestGetStats_ForwardsEnvironment(t *testing.T) {
 	var capturedEnv string
 	svc := &Service{repo: &envCaptureMock{capturedEnv: &capturedEnv}}
 
-	svc.GetStats("proj-1", "production")
+	svc.GetStats(StatsFilters{ProjectID: "proj-1", Environment: "production"})
 	assert.Equal(t, "production", capturedEnv)
 }
 
@@ -271,8 +329,8 @@ type envCaptureMock struct {
 	capturedEnv *string
 }
 
-func (m *envCaptureMock) GetStats(projectID, environment string) (*AuditStats, error) {
-	*m.capturedEnv = environment
+func (m *envCaptureMock) GetStats(filters StatsFilters) (*AuditStats, error) {
+	*m.capturedEnv = filters.Environment
 	return &AuditStats{}, nil
 }
 
@@ -291,23 +349,23 @@ func TestGetSessions_ReturnsRepoResult(t *testing.T) {
 		},
 	}
 	repo := &mockRepository{
-		getSessionsFn: func(filters SessionFilters) ([]Session, error) {
-			return expected, nil
+		getSessionsFn: func(filters SessionFilters) (SessionPage, error) {
+			return SessionPage{Data: expected}, nil
 		},
 	}
 	svc := newService(repo)
 
 	result, err := svc.GetSessions(SessionFilters{})
 	require.NoError(t, err)
-	assert.Equal(t, expected, result)
+	assert.Equal(t, expected, result.Data)
 }
 
 func TestGetSessions_ForwardsFilters(t *testing.T) {
 	var capturedFilters SessionFilters
 	repo := &mockRepository{
-		getSessionsFn: func(filters SessionFilters) ([]Session, error) {
+		getSessionsFn: func(filters SessionFilters) (SessionPage, error) {
 			capturedFilters = filters
-			return nil, nil
+			return SessionPage{}, nil
 		},
 	}
 	svc := newService(repo)
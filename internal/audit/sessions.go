@@ -0,0 +1,441 @@
+package audit
+
+import (
+	"errors"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/joaovrmoraes/bataudit/internal/dialect"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+const (
+	// DefaultSessionTimeout ends a derived session after 30 minutes without
+	// events, unless its project sets its own inactivity timeout.
+	DefaultSessionTimeout = 30 * time.Minute
+	MinSessionTimeout     = time.Minute
+	MaxSessionTimeout     = 24 * time.Hour
+
+	DefaultSessionLimit = 100
+	MaxSessionLimit     = 1000
+	// maxDerivedSessions caps the sessions derived from raw events when
+	// GetSessions is given field filters.
+	maxDerivedSessions = 200
+
+	sessionTimeLayout = "2006-01-02T15:04:05Z"
+	sessionCursorSort = "session_start"
+)
+
+// StoredSession is a row of audit_sessions. The Worker adds each event it
+// stores to its session: the explicit session of its SessionID, or else the
+// derived session of its identifier and service within the project's
+// inactivity timeout. Tiering leaves the table alone, so the stats of a
+// session stay exact once its events are summarized.
+type StoredSession struct {
+	ID                string `gorm:"primaryKey"`
+	ProjectID         string
+	SessionID         string // "" = derived session
+	Identifier        string
+	ServiceName       string
+	StartedAt         time.Time
+	EndedAt           time.Time
+	EventCount        int64
+	ErrorCount        int64 // status_code >= 400
+	TotalResponseTime int64 // ms
+	CreatedAt         time.Time
+	UpdatedAt         time.Time
+}
+
+func (StoredSession) TableName() string { return "audit_sessions" }
+
+// SessionSettings is a project's inactivity timeout for derived sessions.
+type SessionSettings struct {
+	ProjectID                string     `json:"project_id" gorm:"primaryKey"`
+	InactivityTimeoutSeconds int        `json:"inactivity_timeout_seconds"`
+	UpdatedAt                *time.Time `json:"updated_at,omitempty"`
+	// Default is set when the project has no timeout of its own.
+	Default bool `json:"default" gorm:"-"`
+}
+
+func (SessionSettings) TableName() string { return "session_settings" }
+
+// SessionPage is a page of GetSessions.
+type SessionPage struct {
+	Data []Session
+	// NextCursor continues the list after Data; empty on the last page.
+	NextCursor string
+}
+
+// merge adds the events of o to s.
+func (s *StoredSession) merge(o StoredSession) {
+	if o.StartedAt.Before(s.StartedAt) {
+		s.StartedAt = o.StartedAt
+	}
+	if o.EndedAt.After(s.EndedAt) {
+		s.EndedAt = o.EndedAt
+	}
+	if s.Identifier == "" {
+		s.Identifier = o.Identifier
+	}
+	if s.ServiceName == "" {
+		s.ServiceName = o.ServiceName
+	}
+	s.EventCount += o.EventCount
+	s.ErrorCount += o.ErrorCount
+	s.TotalResponseTime += o.TotalResponseTime
+}
+
+func (s StoredSession) session() Session {
+	sess := Session{
+		ID:              s.ID,
+		SessionID:       s.SessionID,
+		Identifier:      s.Identifier,
+		ServiceName:     s.ServiceName,
+		SessionStart:    s.StartedAt.UTC().Format(sessionTimeLayout),
+		SessionEnd:      s.EndedAt.UTC().Format(sessionTimeLayout),
+		DurationSeconds: s.EndedAt.Sub(s.StartedAt).Seconds(),
+		EventCount:      s.EventCount,
+		ErrorCount:      s.ErrorCount,
+	}
+	if s.EventCount > 0 {
+		sess.AvgResponseTime = float64(s.TotalResponseTime) / float64(s.EventCount)
+	}
+	return sess
+}
+
+// trackSession adds a, just inserted by link, to its session. link holds the
+// chain head of a's project until tx commits, so a project's sessions are
+// updated one event at a time across Worker replicas.
+func trackSession(tx *gorm.DB, a *Audit) error {
+	ev := StoredSession{
+		ProjectID:         a.ProjectID,
+		SessionID:         a.SessionID,
+		Identifier:        a.Identifier,
+		ServiceName:       a.ServiceName,
+		StartedAt:         a.Timestamp,
+		EndedAt:           a.Timestamp,
+		EventCount:        1,
+		TotalResponseTime: a.ResponseTime,
+	}
+	if a.StatusCode >= 400 {
+		ev.ErrorCount = 1
+	}
+
+	query := tx.Where("project_id = ?", a.ProjectID)
+	if a.SessionID != "" {
+		query = query.Where("session_id = ?", a.SessionID)
+	} else {
+		timeout, err := sessionTimeout(tx, a.ProjectID)
+		if err != nil {
+			return err
+		}
+		query = query.
+			Where("session_id = '' AND identifier = ? AND service_name = ?", a.Identifier, a.ServiceName).
+			Where("started_at <= ? AND ended_at >= ?", a.Timestamp.Add(timeout), a.Timestamp.Add(-timeout))
+	}
+	var found []StoredSession
+	if err := query.Order("started_at").Find(&found).Error; err != nil {
+		return err
+	}
+
+	now := time.Now().UTC()
+	if len(found) == 0 {
+		ev.ID = uuid.New().String()
+		ev.CreatedAt, ev.UpdatedAt = now, now
+		return tx.Create(&ev).Error
+	}
+	// A late event can close the gap between two sessions, which become one.
+	s := found[0]
+	s.merge(ev)
+	if len(found) > 1 {
+		ids := make([]string, 0, len(found)-1)
+		for _, other := range found[1:] {
+			s.merge(other)
+			ids = append(ids, other.ID)
+		}
+		if err := tx.Where("id IN ?", ids).Delete(&StoredSession{}).Error; err != nil {
+			return err
+		}
+	}
+	s.UpdatedAt = now
+	return tx.Save(&s).Error
+}
+
+// sessionTimeout returns the inactivity timeout of projectID's derived
+// sessions.
+func sessionTimeout(db *gorm.DB, projectID string) (time.Duration, error) {
+	var settings []SessionSettings
+	if err := db.Where("project_id = ?", projectID).Limit(1).Find(&settings).Error; err != nil {
+		return 0, err
+	}
+	if len(settings) == 0 {
+		return DefaultSessionTimeout, nil
+	}
+	return time.Duration(settings[0].InactivityTimeoutSeconds) * time.Second, nil
+}
+
+// RebuildSessions recomputes the sessions of projectID from its raw events,
+// for events stored without Create, such as by the seed tools. Sessions
+// whose events were tiered away are lost.
+func (r *repository) RebuildSessions(projectID string) error {
+	return r.db.Transaction(func(tx *gorm.DB) error {
+		timeout, err := sessionTimeout(tx, projectID)
+		if err != nil {
+			return err
+		}
+		rows, err := tx.Model(&Audit{}).
+			Select(`COALESCE(session_id, '') AS session_id, COALESCE(identifier, '') AS identifier,
+				COALESCE(service_name, '') AS service_name, timestamp,
+				COALESCE(status_code, 0) AS status_code, COALESCE(response_time, 0) AS response_time`).
+			Where("project_id = ?", projectID).
+			Order("session_id, identifier, service_name, timestamp").
+			Rows()
+		if err != nil {
+			return err
+		}
+		now := time.Now().UTC()
+		var sessions []StoredSession
+		for rows.Next() {
+			var a Audit
+			if err := tx.ScanRows(rows, &a); err != nil {
+				rows.Close()
+				return err
+			}
+			ev := StoredSession{
+				ProjectID:         projectID,
+				SessionID:         a.SessionID,
+				Identifier:        a.Identifier,
+				ServiceName:       a.ServiceName,
+				StartedAt:         a.Timestamp.UTC(),
+				EndedAt:           a.Timestamp.UTC(),
+				EventCount:        1,
+				TotalResponseTime: a.ResponseTime,
+			}
+			if a.StatusCode >= 400 {
+				ev.ErrorCount = 1
+			}
+			if n := len(sessions); n > 0 {
+				last := &sessions[n-1]
+				if last.SessionID == ev.SessionID && (ev.SessionID != "" ||
+					last.Identifier == ev.Identifier && last.ServiceName == ev.ServiceName && ev.StartedAt.Sub(last.EndedAt) <= timeout) {
+					last.merge(ev)
+					continue
+				}
+			}
+			ev.ID = uuid.New().String()
+			ev.CreatedAt, ev.UpdatedAt = now, now
+			sessions = append(sessions, ev)
+		}
+		if err := rows.Err(); err != nil {
+			rows.Close()
+			return err
+		}
+		if err := rows.Close(); err != nil {
+			return err
+		}
+
+		if err := tx.Where("project_id = ?", projectID).Delete(&StoredSession{}).Error; err != nil {
+			return err
+		}
+		if len(sessions) == 0 {
+			return nil
+		}
+		return tx.CreateInBatches(sessions, 500).Error
+	})
+}
+
+// GetSessionSettings returns the inactivity timeout of projectID, the
+// default one when it has none.
+func (r *repository) GetSessionSettings(projectID string) (*SessionSettings, error) {
+	var settings []SessionSettings
+	if err := r.db.Where("project_id = ?", projectID).Limit(1).Find(&settings).Error; err != nil {
+		return nil, err
+	}
+	if len(settings) == 0 {
+		return &SessionSettings{
+			ProjectID:                projectID,
+			InactivityTimeoutSeconds: int(DefaultSessionTimeout / time.Second),
+			Default:                  true,
+		}, nil
+	}
+	return &settings[0], nil
+}
+
+// SaveSessionSettings sets the inactivity timeout of a project. It applies
+// to the events stored from then on; existing sessions are kept as they are.
+func (r *repository) SaveSessionSettings(s *SessionSettings) error {
+	now := time.Now().UTC()
+	s.UpdatedAt = &now
+	s.Default = false
+	return r.db.Clauses(clause.OnConflict{
+		Columns:   []clause.Column{{Name: "project_id"}},
+		DoUpdates: clause.AssignmentColumns([]string{"inactivity_timeout_seconds", "updated_at"}),
+	}).Create(s).Error
+}
+
+// GetSessions lists sessions by start, newest first, from audit_sessions. A
+// session is listed when it has events between StartDate and EndDate. With
+// field filters, sessions are instead derived from the matching raw events.
+func (r *repository) GetSessions(filters SessionFilters) (SessionPage, error) {
+	if len(filters.Fields) > 0 {
+		sessions, err := r.deriveSessions(filters)
+		return SessionPage{Data: sessions}, err
+	}
+
+	limit := filters.Limit
+	if limit <= 0 {
+		limit = DefaultSessionLimit
+	}
+	query := r.db.Model(&StoredSession{})
+	if filters.ProjectID != "" {
+		query = query.Where("project_id = ?", filters.ProjectID)
+	}
+	if filters.ProjectIDs != nil {
+		query = query.Where("project_id IN ?", filters.ProjectIDs)
+	}
+	if filters.Identifier != "" {
+		query = query.Where("identifier = ?", filters.Identifier)
+	}
+	if filters.ServiceName != "" {
+		query = query.Where("service_name = ?", filters.ServiceName)
+	}
+	if filters.StartDate != nil {
+		query = query.Where("ended_at >= ?", filters.StartDate.UTC())
+	}
+	if filters.EndDate != nil {
+		query = query.Where("started_at <= ?", filters.EndDate.UTC())
+	}
+	if c := filters.After; c != nil {
+		if c.SortBy != sessionCursorSort || c.Order != "desc" {
+			return SessionPage{}, errors.New("cursor does not match the session list")
+		}
+		query = query.Where("(started_at < ? OR (started_at = ? AND id < ?))", *c.Time, *c.Time, c.ID)
+	}
+
+	// One extra row tells whether there is a next page.
+	var rows []StoredSession
+	if err := query.Order("started_at DESC").Order("id DESC").Limit(limit + 1).Find(&rows).Error; err != nil {
+		return SessionPage{}, err
+	}
+	var page SessionPage
+	if len(rows) > limit {
+		rows = rows[:limit]
+		last := rows[limit-1]
+		started := last.StartedAt.UTC()
+		page.NextCursor = Cursor{SortBy: sessionCursorSort, Order: "desc", Time: &started, ID: last.ID}.Encode()
+	}
+	page.Data = make([]Session, len(rows))
+	for i, row := range rows {
+		page.Data[i] = row.session()
+	}
+	return page, nil
+}
+
+// deriveSessions groups the raw events matching filters into sessions by
+// identifier and service, with the inactivity timeout of filters.ProjectID.
+// It reads the last 7 days by default and returns up to 200 sessions.
+func (r *repository) deriveSessions(filters SessionFilters) ([]Session, error) {
+	d := dialect.Of(r.db)
+	where := "1=1"
+	args := []interface{}{}
+
+	if filters.ProjectID != "" {
+		where += " AND project_id = ?"
+		args = append(args, filters.ProjectID)
+	}
+	if filters.ProjectIDs != nil {
+		where += " AND project_id IN ?"
+		args = append(args, filters.ProjectIDs)
+	}
+	if filters.Identifier != "" {
+		where += " AND identifier = ?"
+		args = append(args, filters.Identifier)
+	}
+	if filters.ServiceName != "" {
+		where += " AND service_name = ?"
+		args = append(args, filters.ServiceName)
+	}
+	// Default to last 7 days to avoid full-table window function scans.
+	if filters.StartDate != nil {
+		where += " AND timestamp >= ?"
+		args = append(args, filters.StartDate)
+	} else {
+		where += " AND timestamp >= ?"
+		args = append(args, time.Now().UTC().Add(-7*24*time.Hour))
+	}
+	if filters.EndDate != nil {
+		where += " AND timestamp <= ?"
+		args = append(args, filters.EndDate)
+	}
+	cond, fieldArgs, err := fieldFiltersSQL(filters.Fields, r.db.Dialector.Name())
+	if err != nil {
+		return nil, err
+	}
+	where += " AND " + cond
+	args = append(args, fieldArgs...)
+
+	timeout := DefaultSessionTimeout
+	if filters.ProjectID != "" {
+		if timeout, err = sessionTimeout(r.db, filters.ProjectID); err != nil {
+			return nil, err
+		}
+	}
+	args = append(args, timeout.Seconds(), maxDerivedSessions)
+
+	query := `
+		WITH ranked AS (
+			SELECT
+				identifier,
+				service_name,
+				timestamp,
+				status_code,
+				response_time,
+				LAG(timestamp) OVER (PARTITION BY identifier, service_name ORDER BY timestamp) AS prev_ts
+			FROM audits
+			WHERE ` + where + `
+		),
+		session_starts AS (
+			SELECT
+				identifier,
+				service_name,
+				timestamp,
+				status_code,
+				response_time,
+				CASE
+					WHEN prev_ts IS NULL OR ` + d.Seconds("prev_ts", "timestamp") + ` > ? THEN 1
+					ELSE 0
+				END AS is_new_session
+			FROM ranked
+		),
+		session_groups AS (
+			SELECT
+				identifier,
+				service_name,
+				timestamp,
+				status_code,
+				response_time,
+				SUM(is_new_session) OVER (PARTITION BY identifier, service_name ORDER BY timestamp) AS session_id
+			FROM session_starts
+		)
+		SELECT
+			identifier,
+			service_name,
+			` + d.ISOTime("MIN(timestamp)") + ` AS session_start,
+			` + d.ISOTime("MAX(timestamp)") + ` AS session_end,
+			` + d.Seconds("MIN(timestamp)", "MAX(timestamp)") + ` AS duration_seconds,
+			COUNT(*) AS event_count,
+			COUNT(CASE WHEN status_code >= 400 THEN 1 END) AS error_count,
+			COALESCE(AVG(COALESCE(response_time, 0)), 0) AS avg_response_time
+		FROM session_groups
+		GROUP BY identifier, service_name, session_id
+		ORDER BY MIN(timestamp) DESC
+		LIMIT ?
+	`
+
+	var sessions []Session
+	if err := r.db.Raw(query, args...).Scan(&sessions).Error; err != nil {
+		return nil, err
+	}
+	return sessions, nil
+}
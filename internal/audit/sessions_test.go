@@ -0,0 +1,46 @@
+package audit
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestStoredSessionMerge(t *testing.T) {
+	start := time.Date(2026, 10, 19, 9, 0, 0, 0, time.UTC)
+	s := StoredSession{
+		ID:                "s1",
+		ServiceName:       "api",
+		StartedAt:         start.Add(10 * time.Minute),
+		EndedAt:           start.Add(20 * time.Minute),
+		EventCount:        2,
+		ErrorCount:        1,
+		TotalResponseTime: 30,
+	}
+	s.merge(StoredSession{Identifier: "alice", StartedAt: start, EndedAt: start, EventCount: 1, TotalResponseTime: 10})
+	s.merge(StoredSession{Identifier: "bob", StartedAt: start.Add(25 * time.Minute), EndedAt: start.Add(40 * time.Minute), EventCount: 3, ErrorCount: 2, TotalResponseTime: 60})
+
+	assert.Equal(t, "alice", s.Identifier, "the first identifier is kept")
+	assert.Equal(t, Session{
+		ID:              "s1",
+		Identifier:      "alice",
+		ServiceName:     "api",
+		SessionStart:    "2026-10-19T09:00:00Z",
+		SessionEnd:      "2026-10-19T09:40:00Z",
+		DurationSeconds: 2400,
+		EventCount:      6,
+		ErrorCount:      3,
+		AvgResponseTime: 100.0 / 6,
+	}, s.session())
+}
+
+func TestParseCursor_Session(t *testing.T) {
+	ts := time.Date(2026, 10, 19, 9, 30, 0, 500, time.UTC)
+	c, err := ParseCursor(Cursor{SortBy: sessionCursorSort, Order: "desc", Time: &ts, ID: "s1"}.Encode())
+	if assert.NoError(t, err) {
+		assert.True(t, ts.Equal(*c.Time))
+	}
+	_, err = ParseCursor(Cursor{SortBy: sessionCursorSort, Order: "desc", ID: "s1"}.Encode())
+	assert.Error(t, err)
+}
@@ -0,0 +1,283 @@
+package audit
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Live tail: the Worker announces every committed event on Redis (see
+// package livetail) and each open stream re-reads the announced project's
+// chain past the position it has delivered, with the same filters as List.
+// Chain positions are taken under the chain head lock, so within a project
+// they follow commit order: a stream never skips an event that committed
+// late, and a client resuming from a position gets exactly what it missed.
+
+const (
+	defaultTailPoll  = 10 * time.Second
+	defaultTailBatch = 200
+)
+
+// Notifier tells live tails which projects have committed new events.
+type Notifier interface {
+	// Subscribe calls notify with the project of each committed event until
+	// cancel is called. notify must not block.
+	Subscribe(notify func(projectID string)) (cancel func())
+}
+
+// ProjectScope lists the projects a user may read.
+type ProjectScope interface {
+	ReadableProjects(userID, role string) ([]string, error)
+}
+
+// TailEvent is an event delivered by a live tail.
+type TailEvent struct {
+	AuditSummary
+	ChainSeq int64 `json:"chain_seq"`
+}
+
+// TailPosition is the last chain position a stream has delivered, per
+// project. It is the SSE event ID; a client resumes after it by sending it
+// back as Last-Event-ID.
+type TailPosition map[string]int64
+
+var errInvalidTailPosition = errors.New("invalid Last-Event-ID")
+
+// Encode renders the position as the opaque string clients pass back.
+func (p TailPosition) Encode() string {
+	b, _ := json.Marshal(p)
+	return base64.RawURLEncoding.EncodeToString(b)
+}
+
+// ParseTailPosition decodes a position returned as an event ID.
+func ParseTailPosition(s string) (TailPosition, error) {
+	b, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return nil, errInvalidTailPosition
+	}
+	var p TailPosition
+	if err := json.Unmarshal(b, &p); err != nil {
+		return nil, errInvalidTailPosition
+	}
+	for _, seq := range p {
+		if seq < 0 {
+			return nil, errInvalidTailPosition
+		}
+	}
+	return p, nil
+}
+
+// Tail streams newly committed events.
+type Tail struct {
+	repo     Repository
+	notifier Notifier // nil = poll only
+	poll     time.Duration
+	batch    int
+}
+
+// NewTail creates a live tail over repo, woken by notifier. Streams also
+// re-read every project each poll interval, so a lost notice (or Redis being
+// down) delays events instead of dropping them.
+func NewTail(repo Repository, notifier Notifier) *Tail {
+	return &Tail{repo: repo, notifier: notifier, poll: defaultTailPoll, batch: defaultTailBatch}
+}
+
+// WithPollInterval sets how often streams re-read every project.
+func (t *Tail) WithPollInterval(d time.Duration) *Tail {
+	t.poll = d
+	return t
+}
+
+// Start returns the position a stream over projects starts at: from's
+// position for the projects it has, the current chain head for the others.
+// Projects in from that are not in projects are dropped.
+func (t *Tail) Start(projects []string, from TailPosition) (TailPosition, error) {
+	heads, err := t.repo.ChainHeads(projects)
+	if err != nil {
+		return nil, err
+	}
+	pos := make(TailPosition, len(projects))
+	for _, p := range projects {
+		if seq, ok := from[p]; ok {
+			pos[p] = seq
+		} else {
+			pos[p] = heads[p]
+		}
+	}
+	return pos, nil
+}
+
+// Run delivers the events matching filters committed after pos, in chain
+// order per project, until ctx is done or a callback fails. emit receives
+// each event with the position that includes it; idle is called each poll
+// interval with the current position, which also advances over events the
+// filters skip. Run updates pos in place.
+func (t *Tail) Run(ctx context.Context, filters ListFilters, pos TailPosition,
+	emit func(TailEvent, TailPosition) error, idle func(TailPosition) error) error {
+	all := make([]string, 0, len(pos))
+	scope := make(map[string]bool, len(pos))
+	for p := range pos {
+		all = append(all, p)
+		scope[p] = true
+	}
+
+	var (
+		mu      sync.Mutex
+		pending = map[string]bool{}
+		wake    = make(chan struct{}, 1)
+	)
+	if t.notifier != nil {
+		cancel := t.notifier.Subscribe(func(projectID string) {
+			if !scope[projectID] {
+				return
+			}
+			mu.Lock()
+			pending[projectID] = true
+			mu.Unlock()
+			select {
+			case wake <- struct{}{}:
+			default:
+			}
+		})
+		defer cancel()
+	}
+
+	// Catch up first: a resumed stream replays what it missed.
+	if err := t.catchUp(filters, all, pos, emit); err != nil {
+		return err
+	}
+
+	ticker := time.NewTicker(t.poll)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-wake:
+			mu.Lock()
+			projects := make([]string, 0, len(pending))
+			for p := range pending {
+				projects = append(projects, p)
+			}
+			pending = map[string]bool{}
+			mu.Unlock()
+			if err := t.catchUp(filters, projects, pos, emit); err != nil {
+				return err
+			}
+		case <-ticker.C:
+			if err := t.catchUp(filters, all, pos, emit); err != nil {
+				return err
+			}
+			if err := idle(pos); err != nil {
+				return err
+			}
+		}
+	}
+}
+
+// catchUp delivers the events of projects committed after pos. The head is
+// read before the events, so an event committed meanwhile is left for the
+// next round rather than skipped.
+func (t *Tail) catchUp(filters ListFilters, projects []string, pos TailPosition,
+	emit func(TailEvent, TailPosition) error) error {
+	heads, err := t.repo.ChainHeads(projects)
+	if err != nil {
+		return err
+	}
+	for _, p := range projects {
+		head := heads[p]
+		for head > pos[p] {
+			events, err := t.repo.ListAfterSeq(filters, p, pos[p], head, t.batch)
+			if err != nil {
+				return err
+			}
+			for _, ev := range events {
+				pos[p] = ev.ChainSeq
+				if err := emit(ev, pos); err != nil {
+					return err
+				}
+			}
+			if len(events) < t.batch {
+				pos[p] = head
+			}
+		}
+	}
+	return nil
+}
+
+// Serve runs a live tail over projects as a Server-Sent Events response.
+// Each delivered event is a message named event whose data is render's
+// result (nil skips the event) and whose ID is the stream position; a
+// client reconnecting with Last-Event-ID (or ?last_event_id=) resumes after
+// it. A "ready" message carries the starting position, and idle periods
+// send the position without data so the client's Last-Event-ID stays
+// current.
+func (t *Tail) Serve(c *gin.Context, event string, filters ListFilters, projects []string, render func(TailEvent) any) {
+	var from TailPosition
+	lastID := c.GetHeader("Last-Event-ID")
+	if lastID == "" {
+		lastID = c.Query("last_event_id")
+	}
+	if lastID != "" {
+		var err error
+		if from, err = ParseTailPosition(lastID); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+	}
+
+	pos, err := t.Start(projects, from)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to start live tail", "details": err.Error()})
+		return
+	}
+
+	c.Header("Content-Type", "text/event-stream")
+	c.Header("Cache-Control", "no-cache")
+	c.Header("Connection", "keep-alive")
+	c.Header("X-Accel-Buffering", "no") // nginx would buffer the stream
+	c.Status(http.StatusOK)
+
+	w := c.Writer
+	send := func(id, name string, data any) error {
+		frame := "id: " + id + "\n"
+		if name != "" {
+			b, err := json.Marshal(data)
+			if err != nil {
+				return err
+			}
+			frame += "event: " + name + "\ndata: " + string(b) + "\n"
+		}
+		if _, err := fmt.Fprint(w, frame+"\n"); err != nil {
+			return err
+		}
+		w.Flush()
+		return nil
+	}
+
+	if err := send(pos.Encode(), "ready", gin.H{}); err != nil {
+		return
+	}
+	err = t.Run(c.Request.Context(), filters, pos,
+		func(ev TailEvent, pos TailPosition) error {
+			data := render(ev)
+			if data == nil {
+				return nil
+			}
+			return send(pos.Encode(), event, data)
+		},
+		func(pos TailPosition) error {
+			return send(pos.Encode(), "", nil)
+		})
+	if err != nil && c.Request.Context().Err() == nil {
+		slog.Warn("Live tail stopped", "error", err)
+	}
+}
@@ -0,0 +1,32 @@
+package audit
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestTailPosition_roundTrip(t *testing.T) {
+	p, err := ParseTailPosition(TailPosition{"p1": 42, "p2": 0}.Encode())
+	require.NoError(t, err)
+	assert.Equal(t, TailPosition{"p1": 42, "p2": 0}, p)
+}
+
+func TestParseTailPosition_Invalid(t *testing.T) {
+	for _, s := range []string{
+		"not base64!",
+		"bm90IGpzb24",
+		TailPosition{"p1": -1}.Encode(),
+	} {
+		_, err := ParseTailPosition(s)
+		assert.Error(t, err, s)
+	}
+}
+
+func TestTailStart(t *testing.T) {
+	repo := &mockRepository{}
+	pos, err := NewTail(repo, nil).Start([]string{"p1", "p2"}, TailPosition{"p1": 7, "gone": 3})
+	require.NoError(t, err)
+	assert.Equal(t, TailPosition{"p1": 7, "p2": 0}, pos, "resumes p1, starts p2 at its head, drops projects out of scope")
+}
@@ -0,0 +1,181 @@
+package audit
+
+import (
+	"sort"
+	"strings"
+	"time"
+)
+
+// Distributed tracing follows W3C Trace Context
+// (https://www.w3.org/TR/trace-context/): the events of one user action share
+// a trace ID across services, and each event may name its own span and the
+// span that called its service.
+
+// maxTraceEvents caps the events GET /audit/traces/:trace_id returns.
+const maxTraceEvents = 1000
+
+func validTraceID(s string) bool {
+	return len(s) == 32 && isLowerHex(s) && strings.Trim(s, "0") != ""
+}
+
+func validSpanID(s string) bool {
+	return len(s) == 16 && isLowerHex(s) && strings.Trim(s, "0") != ""
+}
+
+func isLowerHex(s string) bool {
+	for _, c := range s {
+		if (c < '0' || c > '9') && (c < 'a' || c > 'f') {
+			return false
+		}
+	}
+	return true
+}
+
+// ParseTraceparent returns the trace ID and parent ID of a traceparent header
+// value: version-traceid-parentid-flags. Versions after 00 may append fields,
+// which are ignored.
+func ParseTraceparent(s string) (traceID, parentID string, ok bool) {
+	parts := strings.Split(s, "-")
+	if len(parts) < 4 || len(parts[0]) != 2 || !isLowerHex(parts[0]) || parts[0] == "ff" {
+		return "", "", false
+	}
+	if parts[0] == "00" && len(parts) != 4 {
+		return "", "", false
+	}
+	if !validTraceID(parts[1]) || !validSpanID(parts[2]) || len(parts[3]) != 2 || !isLowerHex(parts[3]) {
+		return "", "", false
+	}
+	return parts[1], parts[2], true
+}
+
+// ApplyTraceparent fills the trace fields of a from its Traceparent, the
+// header of the audited request, then clears it. The parent ID in the header
+// is the span of the caller: a browser event records the caller side of the
+// request, so the ID is its own span; a backend event records the receiving
+// side, so the ID is its parent span. Fields sent explicitly are kept.
+func ApplyTraceparent(a *Audit) {
+	traceID, parentID, ok := ParseTraceparent(a.Traceparent)
+	a.Traceparent = ""
+	if !ok {
+		return
+	}
+	if a.TraceID == "" {
+		a.TraceID = traceID
+	}
+	if a.TraceID != traceID {
+		return
+	}
+	if a.Source == "browser" {
+		if a.SpanID == "" {
+			a.SpanID = parentID
+		}
+	} else if a.ParentSpanID == "" {
+		a.ParentSpanID = parentID
+	}
+}
+
+// TraceSpan is an event of a trace and, in a Trace, the events it called.
+type TraceSpan struct {
+	AuditSummary
+	SpanID       string `json:"span_id,omitempty"`
+	ParentSpanID string `json:"parent_span_id,omitempty"`
+	Source       string `json:"source"`
+	RequestID    string `json:"request_id,omitempty"`
+
+	// OffsetMs is the time from the start of the trace to this event.
+	OffsetMs int64 `json:"offset_ms" gorm:"-"`
+	// HopMs is the time from the parent's start to this event's: the
+	// latency of the hop into this service. Unset on roots.
+	HopMs *int64 `json:"hop_ms,omitempty" gorm:"-"`
+	// MissingParent is set on a root whose parent span is not stored: the
+	// calling service did not audit the request, or its event is out of
+	// reach (another project, expired).
+	MissingParent bool         `json:"missing_parent,omitempty" gorm:"-"`
+	Children      []*TraceSpan `json:"children" gorm:"-"`
+}
+
+// Trace is the event tree of a trace.
+type Trace struct {
+	TraceID    string       `json:"trace_id"`
+	Start      time.Time    `json:"start"`
+	DurationMs int64        `json:"duration_ms"` // first start to last end
+	EventCount int          `json:"event_count"`
+	Services   []string     `json:"services"`
+	Truncated  bool         `json:"truncated,omitempty"` // more than maxTraceEvents events
+	Roots      []*TraceSpan `json:"roots"`
+}
+
+// BuildTrace links spans, oldest first, into a tree. An event's parent is
+// the event whose span is its parent span. A backend event without a parent
+// span hangs under the browser event with its request_id, as orphan
+// detection correlates them. Other events are roots.
+func BuildTrace(traceID string, spans []TraceSpan) *Trace {
+	t := &Trace{TraceID: traceID, EventCount: len(spans), Services: []string{}, Roots: []*TraceSpan{}}
+	if len(spans) == 0 {
+		return t
+	}
+
+	nodes := make([]*TraceSpan, len(spans))
+	bySpan := map[string]*TraceSpan{}
+	byRequest := map[string]*TraceSpan{}
+	services := map[string]bool{}
+	t.Start = spans[0].Timestamp
+	var end time.Time
+	for i := range spans {
+		n := &spans[i]
+		n.Children = []*TraceSpan{}
+		nodes[i] = n
+		if n.SpanID != "" && bySpan[n.SpanID] == nil {
+			bySpan[n.SpanID] = n
+		}
+		if n.Source == "browser" && n.RequestID != "" && byRequest[n.RequestID] == nil {
+			byRequest[n.RequestID] = n
+		}
+		if !services[n.ServiceName] {
+			services[n.ServiceName] = true
+			t.Services = append(t.Services, n.ServiceName)
+		}
+		if n.Timestamp.Before(t.Start) {
+			t.Start = n.Timestamp
+		}
+		if e := n.Timestamp.Add(time.Duration(n.ResponseTime) * time.Millisecond); e.After(end) {
+			end = e
+		}
+	}
+	t.DurationMs = end.Sub(t.Start).Milliseconds()
+	sort.Strings(t.Services)
+
+	parentOf := map[*TraceSpan]*TraceSpan{}
+	for _, n := range nodes {
+		n.OffsetMs = n.Timestamp.Sub(t.Start).Milliseconds()
+		var parent *TraceSpan
+		switch {
+		case n.ParentSpanID != "":
+			parent = bySpan[n.ParentSpanID]
+			n.MissingParent = parent == nil
+		case n.Source != "browser" && n.RequestID != "":
+			parent = byRequest[n.RequestID]
+		}
+		// Clocks differ between services, so a parent may start after its
+		// child; only a link that would close a cycle is refused.
+		if parent == nil || descends(parentOf, parent, n) {
+			t.Roots = append(t.Roots, n)
+			continue
+		}
+		parentOf[n] = parent
+		hop := n.Timestamp.Sub(parent.Timestamp).Milliseconds()
+		n.HopMs = &hop
+		parent.Children = append(parent.Children, n)
+	}
+	return t
+}
+
+// descends reports whether n is ancestor or one of its descendants.
+func descends(parentOf map[*TraceSpan]*TraceSpan, n, ancestor *TraceSpan) bool {
+	for ; n != nil; n = parentOf[n] {
+		if n == ancestor {
+			return true
+		}
+	}
+	return false
+}
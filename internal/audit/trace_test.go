@@ -0,0 +1,107 @@
+package audit
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const testTraceID = "4bf92f3577b34da6a3ce929d0e0e4736"
+
+func TestParseTraceparent(t *testing.T) {
+	traceID, parentID, ok := ParseTraceparent("00-" + testTraceID + "-00f067aa0ba902b7-01")
+	require.True(t, ok)
+	assert.Equal(t, testTraceID, traceID)
+	assert.Equal(t, "00f067aa0ba902b7", parentID)
+
+	_, _, ok = ParseTraceparent("cc-" + testTraceID + "-00f067aa0ba902b7-01-future")
+	assert.True(t, ok, "later versions may append fields")
+
+	for _, s := range []string{
+		"",
+		"00-" + testTraceID + "-00f067aa0ba902b7-01-extra",
+		"ff-" + testTraceID + "-00f067aa0ba902b7-01",
+		"00-00000000000000000000000000000000-00f067aa0ba902b7-01",
+		"00-" + testTraceID + "-0000000000000000-01",
+		"00-" + testTraceID + "-00f067aa0ba902b7-1",
+	} {
+		_, _, ok := ParseTraceparent(s)
+		assert.False(t, ok, s)
+	}
+}
+
+func TestApplyTraceparent(t *testing.T) {
+	header := "00-" + testTraceID + "-00f067aa0ba902b7-01"
+
+	browser := Audit{Source: "browser", Traceparent: header}
+	ApplyTraceparent(&browser)
+	assert.Equal(t, testTraceID, browser.TraceID)
+	assert.Equal(t, "00f067aa0ba902b7", browser.SpanID, "the browser is the caller")
+	assert.Empty(t, browser.ParentSpanID)
+	assert.Empty(t, browser.Traceparent, "not stored")
+
+	backend := Audit{Source: "backend", SpanID: "b7ad6b7169203331", Traceparent: header}
+	ApplyTraceparent(&backend)
+	assert.Equal(t, "00f067aa0ba902b7", backend.ParentSpanID, "the backend was called by it")
+	assert.Equal(t, "b7ad6b7169203331", backend.SpanID)
+
+	explicit := Audit{TraceID: "0af7651916cd43dd8448eb211c80319c", Traceparent: header}
+	ApplyTraceparent(&explicit)
+	assert.Equal(t, "0af7651916cd43dd8448eb211c80319c", explicit.TraceID)
+	assert.Empty(t, explicit.ParentSpanID, "a header of another trace is ignored")
+}
+
+func span(id, service, source, spanID, parentID, requestID string, at time.Time, ms int64) TraceSpan {
+	return TraceSpan{
+		AuditSummary: AuditSummary{ID: id, ServiceName: service, Timestamp: at, ResponseTime: ms},
+		SpanID:       spanID,
+		ParentSpanID: parentID,
+		Source:       source,
+		RequestID:    requestID,
+	}
+}
+
+func TestBuildTrace(t *testing.T) {
+	t0 := time.Date(2026, 10, 19, 9, 0, 0, 0, time.UTC)
+	trace := BuildTrace(testTraceID, []TraceSpan{
+		span("click", "web", "browser", "aaaaaaaaaaaaaaaa", "", "req-1", t0, 400),
+		span("gateway", "gateway", "backend", "bbbbbbbbbbbbbbbb", "aaaaaaaaaaaaaaaa", "req-1", t0.Add(20*time.Millisecond), 350),
+		span("orders", "orders", "backend", "cccccccccccccccc", "bbbbbbbbbbbbbbbb", "", t0.Add(35*time.Millisecond), 200),
+		span("legacy", "billing", "backend", "", "", "req-1", t0.Add(40*time.Millisecond), 50),
+		span("lost", "stock", "backend", "dddddddddddddddd", "eeeeeeeeeeeeeeee", "", t0.Add(60*time.Millisecond), 10),
+	})
+
+	assert.Equal(t, 5, trace.EventCount)
+	assert.Equal(t, int64(400), trace.DurationMs)
+	assert.Equal(t, []string{"billing", "gateway", "orders", "stock", "web"}, trace.Services)
+	require.Len(t, trace.Roots, 2)
+
+	click := trace.Roots[0]
+	assert.Equal(t, "click", click.ID)
+	assert.Nil(t, click.HopMs)
+	require.Len(t, click.Children, 2)
+	gateway, legacy := click.Children[0], click.Children[1]
+	assert.Equal(t, "gateway", gateway.ID)
+	assert.Equal(t, int64(20), *gateway.HopMs)
+	assert.Equal(t, "legacy", legacy.ID, "joined by request_id")
+	require.Len(t, gateway.Children, 1)
+	assert.Equal(t, int64(15), *gateway.Children[0].HopMs)
+	assert.Equal(t, int64(35), gateway.Children[0].OffsetMs)
+
+	lost := trace.Roots[1]
+	assert.Equal(t, "lost", lost.ID)
+	assert.True(t, lost.MissingParent)
+}
+
+func TestBuildTrace_Cycle(t *testing.T) {
+	t0 := time.Date(2026, 10, 19, 9, 0, 0, 0, time.UTC)
+	trace := BuildTrace(testTraceID, []TraceSpan{
+		span("a", "a", "backend", "aaaaaaaaaaaaaaaa", "bbbbbbbbbbbbbbbb", "", t0, 10),
+		span("b", "b", "backend", "bbbbbbbbbbbbbbbb", "aaaaaaaaaaaaaaaa", "", t0.Add(time.Millisecond), 10),
+	})
+	require.Len(t, trace.Roots, 1, "every event stays reachable")
+	assert.Equal(t, "b", trace.Roots[0].ID)
+	assert.Equal(t, "a", trace.Roots[0].Children[0].ID)
+}
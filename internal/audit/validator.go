@@ -18,6 +18,10 @@ func RegisterCustomValidations(v *validator.Validate) {
 	_ = v.RegisterValidation("valid_uuid", validateUUID)
 	_ = v.RegisterValidation("valid_url", validateURL)
 	_ = v.RegisterValidation("valid_service_name", validateServiceName)
+	_ = v.RegisterValidation("not_sealed", validateNotSealed)
+	_ = v.RegisterValidation("valid_trace_id", validateTraceID)
+	_ = v.RegisterValidation("valid_span_id", validateSpanID)
+	_ = v.RegisterValidation("valid_traceparent", validateTraceparent)
 }
 
 // validateHTTPMethod - verifies if the HTTP method is valid
@@ -125,7 +129,38 @@ func FormatValidationError(err validator.FieldError) string {
 		return "Invalid URL"
 	case "valid_service_name":
 		return "Invalid service name. Use only letters, numbers, hyphen, dot, and underscore"
+	case "not_sealed":
+		return "Reserved value: bataudit_enc envelopes are written by BatAudit only"
+	case "valid_trace_id":
+		return "Invalid trace ID. Use 32 lowercase hex digits, not all zero"
+	case "valid_span_id":
+		return "Invalid span ID. Use 16 lowercase hex digits, not all zero"
+	case "valid_traceparent":
+		return "Invalid traceparent. Expected 00-<trace-id>-<parent-id>-<flags>"
 	default:
 		return "Validation error: " + err.Tag()
 	}
 }
+
+// validateNotSealed - rejects JSON values shaped like an encrypted column
+// envelope, which only the Worker may write
+func validateNotSealed(fl validator.FieldLevel) bool {
+	_, sealed := ParseSealed(fl.Field().Bytes())
+	return !sealed
+}
+
+// validateTraceID - verifies a W3C trace ID
+func validateTraceID(fl validator.FieldLevel) bool {
+	return validTraceID(fl.Field().String())
+}
+
+// validateSpanID - verifies a W3C span (parent) ID
+func validateSpanID(fl validator.FieldLevel) bool {
+	return validSpanID(fl.Field().String())
+}
+
+// validateTraceparent - verifies a W3C traceparent header value
+func validateTraceparent(fl validator.FieldLevel) bool {
+	_, _, ok := ParseTraceparent(fl.Field().String())
+	return ok
+}
@@ -6,6 +6,7 @@ import (
 
 	"github.com/go-playground/validator/v10"
 	"github.com/stretchr/testify/assert"
+	"gorm.io/datatypes"
 )
 
 // newValidator returns a configured validator for use in tests.
@@ -182,6 +183,39 @@ func TestValidateServiceName_SpecialChars(t *testing.T) {
 	assert.Error(t, v.Struct(&a))
 }
 
+// --- Sealed envelopes ---
+
+func TestValidateNotSealed(t *testing.T) {
+	v := newValidator()
+
+	a := validBase()
+	a.RequestBody = datatypes.JSON(`{"bataudit_enc":"yes","note":"ordinary body"}`)
+	assert.NoError(t, v.Struct(&a), "look-alike bodies are accepted")
+
+	a.RequestBody = datatypes.JSON(`{"bataudit_enc":1,"id":"e1","kid":"k1","ct":"AAAA"}`)
+	err := v.Struct(&a)
+	if assert.Error(t, err, "clients cannot submit envelopes") {
+		errs := err.(validator.ValidationErrors)
+		assert.Contains(t, FormatValidationError(errs[0]), "Reserved value")
+	}
+}
+
+func TestParseSealed(t *testing.T) {
+	s, ok := ParseSealed([]byte(`{"bataudit_enc":1,"id":"e1","kid":"k1","ct":"AAAA"}`))
+	assert.True(t, ok)
+	assert.Equal(t, "k1", s.KeyID)
+
+	for _, raw := range []string{
+		`{"password":"x"}`,
+		`{"bataudit_enc":2,"id":"e1","kid":"k1","ct":"AAAA"}`,
+		`{"bataudit_enc":1,"id":"e1","kid":"k1","ct":"AAAA","extra":true}`,
+		`{"bataudit_enc":1,"id":"","kid":"k1","ct":"AAAA"}`,
+	} {
+		_, ok := ParseSealed([]byte(raw))
+		assert.False(t, ok, raw)
+	}
+}
+
 // --- FormatValidationError ---
 
 func TestFormatValidationError_KnownTags(t *testing.T) {
@@ -210,3 +244,27 @@ func TestFormatValidationError_UnknownTagReturnsGeneric(t *testing.T) {
 		assert.Contains(t, msg, "Validation error")
 	}
 }
+
+// --- Trace context ---
+
+func TestValidateTraceFields(t *testing.T) {
+	v := newValidator()
+	a := validBase()
+	a.TraceID = "4bf92f3577b34da6a3ce929d0e0e4736"
+	a.SpanID = "00f067aa0ba902b7"
+	a.ParentSpanID = "b7ad6b7169203331"
+	a.Traceparent = "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01"
+	assert.NoError(t, v.Struct(&a))
+
+	for _, edit := range []func(*Audit){
+		func(a *Audit) { a.TraceID = "4bf92f3577b34da6" },
+		func(a *Audit) { a.TraceID = "00000000000000000000000000000000" },
+		func(a *Audit) { a.SpanID = "00f067aa0ba902bz" },
+		func(a *Audit) { a.ParentSpanID = "0000000000000000" },
+		func(a *Audit) { a.Traceparent = "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7" },
+	} {
+		a := validBase()
+		edit(&a)
+		assert.Error(t, v.Struct(&a))
+	}
+}
@@ -0,0 +1,239 @@
+package audit
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// Chain break reasons.
+const (
+	BreakHashMismatch = "hash_mismatch"   // event content no longer matches its hash
+	BreakLinkMismatch = "link_mismatch"   // prev_hash does not match the previous link
+	BreakMissing      = "missing"         // links deleted without a checkpoint
+	BreakDuplicate    = "duplicate"       // two events claim the same position
+	BreakHead         = "head_mismatch"   // last link differs from the recorded head
+	BreakErasure      = "unknown_erasure" // marked erased, but no erasure covers it
+)
+
+const verifyPageSize = 1000
+
+// ChainBreak is the first point where the chain does not verify.
+type ChainBreak struct {
+	Seq     int64  `json:"seq"`
+	EventID string `json:"event_id,omitempty"`
+	Reason  string `json:"reason"`
+	Detail  string `json:"detail"`
+}
+
+// ChainVerification reports a walk over [FromSeq, ToSeq] of a project's chain.
+type ChainVerification struct {
+	ProjectID string `json:"project_id"`
+	FromSeq   int64  `json:"from_seq"`
+	ToSeq     int64  `json:"to_seq"`
+	// Anchored is false when FromSeq > 1 and the link before it is gone, so
+	// the first link is trusted rather than checked.
+	Anchored    bool        `json:"anchored"`
+	Events      int64       `json:"events"`
+	Erased      int64       `json:"erased"` // events checked by link only, see Audit.ErasedAt
+	Checkpoints int         `json:"checkpoints"`
+	Removed     int64       `json:"removed"`
+	Valid       bool        `json:"valid"`
+	Break       *ChainBreak `json:"break,omitempty"`
+}
+
+// erasure is a completed data-subject erasure of a project. The events it
+// erased carry its completion time in erased_at and its replacement
+// identifier, in the identifier column or, for anomaly alerts, in their
+// details. See package erasure.
+type erasure struct {
+	CompletedAt time.Time
+	Identifier  string
+}
+
+// erasures returns the completed erasures of a project.
+func erasures(db *gorm.DB, projectID string) ([]erasure, error) {
+	var out []erasure
+	err := db.Raw(`
+		SELECT completed_at,
+		       CASE WHEN mode = 'remove' THEN 'erased' ELSE pseudonym END AS identifier
+		FROM erasure_requests
+		WHERE project_id = ? AND status = 'completed' AND completed_at IS NOT NULL`, projectID).
+		Scan(&out).Error
+	return out, err
+}
+
+// covers reports whether e erased a.
+func (e erasure) covers(a *Audit) bool {
+	if !e.CompletedAt.Equal(*a.ErasedAt) {
+		return false
+	}
+	if a.Identifier == e.Identifier {
+		return true
+	}
+	var details struct {
+		Identifier string `json:"identifier"`
+	}
+	return a.EventType == "system.alert" && json.Unmarshal(a.RequestBody, &details) == nil &&
+		details.Identifier == e.Identifier
+}
+
+// VerifyChain walks a project's chain from fromSeq to toSeq (0 = the head),
+// recomputing every stored event's hash and checking each link. An erased
+// event's content is not checked, but a completed erasure of the project
+// must account for it. Ranges removed by tiering or archiving are crossed
+// through their checkpoints. It stops at the first break.
+func (r *repository) VerifyChain(ctx context.Context, projectID string, fromSeq, toSeq int64) (*ChainVerification, error) {
+	db := r.db.WithContext(ctx)
+
+	var head ChainHead
+	if err := db.First(&head, "project_id = ?", projectID).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return &ChainVerification{ProjectID: projectID, Anchored: true, Valid: true}, nil
+		}
+		return nil, err
+	}
+	if fromSeq < 1 {
+		fromSeq = 1
+	}
+	if toSeq <= 0 || toSeq > head.Seq {
+		toSeq = head.Seq
+	}
+	res := &ChainVerification{ProjectID: projectID, FromSeq: fromSeq, ToSeq: toSeq, Valid: true}
+	if fromSeq > toSeq {
+		res.Anchored = true
+		return res, nil
+	}
+
+	chainRows := func() *gorm.DB {
+		q := db.Model(&Audit{})
+		if projectID == "" {
+			return q.Where("project_id IS NULL")
+		}
+		return q.Where("project_id = ?", projectID)
+	}
+
+	// The hash the link at fromSeq must point to.
+	prev, anchored := "", fromSeq == 1
+	if !anchored {
+		var before Audit
+		err := chainRows().Where("chain_seq = ?", fromSeq-1).Take(&before).Error
+		switch {
+		case err == nil:
+			prev, anchored = before.Hash, true
+		case errors.Is(err, gorm.ErrRecordNotFound):
+			var cp ChainCheckpoint
+			if db.Where("project_id = ? AND last_seq = ?", projectID, fromSeq-1).Take(&cp).Error == nil {
+				prev, anchored = cp.LastHash, true
+			}
+		default:
+			return nil, err
+		}
+	}
+	res.Anchored = anchored
+
+	var checkpoints []ChainCheckpoint
+	if err := db.Where("project_id = ? AND last_seq >= ? AND first_seq <= ?", projectID, fromSeq, toSeq).
+		Order("first_seq").Find(&checkpoints).Error; err != nil {
+		return nil, err
+	}
+
+	fail := func(seq int64, id, reason, detail string) (*ChainVerification, error) {
+		res.Valid = false
+		res.Break = &ChainBreak{Seq: seq, EventID: id, Reason: reason, Detail: detail}
+		return res, nil
+	}
+
+	var erased []erasure
+	erasedLoaded := false
+
+	expected := fromSeq
+	checked := anchored
+	for expected <= toSeq {
+		var page []Audit
+		if err := chainRows().Where("chain_seq >= ? AND chain_seq <= ?", expected, toSeq).
+			Order("chain_seq").Limit(verifyPageSize).Find(&page).Error; err != nil {
+			return nil, err
+		}
+
+		for i := 0; ; i++ {
+			// Step over removed ranges that start here.
+			for len(checkpoints) > 0 && checkpoints[0].LastSeq < expected {
+				checkpoints = checkpoints[1:]
+			}
+			for len(checkpoints) > 0 && checkpoints[0].FirstSeq <= expected &&
+				(i >= len(page) || page[i].ChainSeq > expected) {
+				cp := checkpoints[0]
+				if checked && cp.FirstSeq == expected && cp.PrevHash != prev {
+					return fail(expected, "", BreakLinkMismatch,
+						fmt.Sprintf("checkpoint %d–%d does not link to the previous event", cp.FirstSeq, cp.LastSeq))
+				}
+				prev, checked = cp.LastHash, true
+				expected = cp.LastSeq + 1
+				res.Checkpoints++
+				res.Removed += cp.RowCount
+				checkpoints = checkpoints[1:]
+			}
+			if i >= len(page) {
+				break
+			}
+
+			a := page[i]
+			switch {
+			case a.ChainSeq < expected:
+				return fail(a.ChainSeq, a.ID, BreakDuplicate, "another event already holds this position")
+			case a.ChainSeq > expected:
+				return fail(expected, "", BreakMissing,
+					fmt.Sprintf("events %d–%d were removed without a checkpoint", expected, a.ChainSeq-1))
+			}
+			if checked && a.PrevHash != prev {
+				return fail(a.ChainSeq, a.ID, BreakLinkMismatch, "prev_hash does not match the previous event")
+			}
+			if a.ErasedAt != nil {
+				if !erasedLoaded {
+					var err error
+					if erased, err = erasures(db, projectID); err != nil {
+						return nil, err
+					}
+					erasedLoaded = true
+				}
+				covered := false
+				for _, e := range erased {
+					if e.covers(&a) {
+						covered = true
+						break
+					}
+				}
+				if !covered {
+					return fail(a.ChainSeq, a.ID, BreakErasure, "marked erased, but no completed erasure request covers it")
+				}
+				res.Erased++
+			} else {
+				hash, err := ChainHash(&a, a.PrevHash)
+				if err != nil {
+					return nil, err
+				}
+				if hash != a.Hash {
+					return fail(a.ChainSeq, a.ID, BreakHashMismatch, "stored content does not match its hash")
+				}
+			}
+			prev, checked = a.Hash, true
+			expected++
+			res.Events++
+		}
+
+		if len(page) < verifyPageSize && expected <= toSeq {
+			return fail(expected, "", BreakMissing,
+				fmt.Sprintf("events %d–%d were removed without a checkpoint", expected, toSeq))
+		}
+	}
+
+	if toSeq == head.Seq && prev != head.Hash {
+		return fail(toSeq, "", BreakHead, "the last event does not match the chain head")
+	}
+	return res, nil
+}
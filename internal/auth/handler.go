@@ -30,6 +30,7 @@ func (h *Handler) RegisterProtectedRoutes(router *gin.RouterGroup) {
 	router.GET("/users", h.ListUsers)
 	router.POST("/users", h.CreateUser)
 	router.DELETE("/users/:id", h.DeleteUser)
+	router.PATCH("/users/:id/permissions", h.UpdateUserPermissions)
 	router.GET("/invites", h.ListInvites)
 	router.POST("/invites", h.CreateInvite)
 	router.DELETE("/invites/:id", h.RevokeInvite)
@@ -112,9 +113,10 @@ func (h *Handler) Me(c *gin.Context) {
 	userClaims := claims.(*Claims)
 
 	c.JSON(http.StatusOK, gin.H{
-		"id":    userClaims.UserID,
-		"email": userClaims.Email,
-		"role":  userClaims.Role,
+		"id":          userClaims.UserID,
+		"email":       userClaims.Email,
+		"role":        userClaims.Role,
+		"can_decrypt": userClaims.CanDecrypt,
 	})
 }
 
@@ -130,9 +132,7 @@ func (h *Handler) Me(c *gin.Context) {
 // @Failure      403  {object}  map[string]string
 // @Router       /auth/users [get]
 func (h *Handler) ListUsers(c *gin.Context) {
-	claims := c.MustGet(ContextKeyClaims).(*Claims)
-	if claims.Role != RoleOwner && claims.Role != RoleAdmin {
-		c.JSON(http.StatusForbidden, gin.H{"error": "admin or owner only"})
+	if !RequireManager(c) {
 		return
 	}
 
@@ -143,20 +143,22 @@ func (h *Handler) ListUsers(c *gin.Context) {
 	}
 
 	type safeUser struct {
-		ID        string   `json:"id"`
-		Name      string   `json:"name"`
-		Email     string   `json:"email"`
-		Role      UserRole `json:"role"`
-		CreatedAt string   `json:"created_at"`
+		ID         string   `json:"id"`
+		Name       string   `json:"name"`
+		Email      string   `json:"email"`
+		Role       UserRole `json:"role"`
+		CanDecrypt bool     `json:"can_decrypt"`
+		CreatedAt  string   `json:"created_at"`
 	}
 	result := make([]safeUser, len(users))
 	for i, u := range users {
 		result[i] = safeUser{
-			ID:        u.ID,
-			Name:      u.Name,
-			Email:     u.Email,
-			Role:      u.Role,
-			CreatedAt: u.CreatedAt.Format(time.RFC3339),
+			ID:         u.ID,
+			Name:       u.Name,
+			Email:      u.Email,
+			Role:       u.Role,
+			CanDecrypt: u.CanDecrypt,
+			CreatedAt:  u.CreatedAt.Format(time.RFC3339),
 		}
 	}
 	c.JSON(http.StatusOK, gin.H{"data": result})
@@ -183,9 +185,7 @@ type createUserRequest struct {
 // @Failure      409   {object}  map[string]string
 // @Router       /auth/users [post]
 func (h *Handler) CreateUser(c *gin.Context) {
-	claims := c.MustGet(ContextKeyClaims).(*Claims)
-	if claims.Role != RoleOwner && claims.Role != RoleAdmin {
-		c.JSON(http.StatusForbidden, gin.H{"error": "admin or owner only"})
+	if !RequireManager(c) {
 		return
 	}
 
@@ -230,11 +230,10 @@ func (h *Handler) CreateUser(c *gin.Context) {
 // @Failure      403  {object}  map[string]string
 // @Router       /auth/users/{id} [delete]
 func (h *Handler) DeleteUser(c *gin.Context) {
-	claims := c.MustGet(ContextKeyClaims).(*Claims)
-	if claims.Role != RoleOwner && claims.Role != RoleAdmin {
-		c.JSON(http.StatusForbidden, gin.H{"error": "admin or owner only"})
+	if !RequireManager(c) {
 		return
 	}
+	claims := c.MustGet(ContextKeyClaims).(*Claims)
 
 	id := c.Param("id")
 	if id == claims.UserID {
@@ -250,6 +249,50 @@ func (h *Handler) DeleteUser(c *gin.Context) {
 	c.JSON(http.StatusOK, gin.H{"message": "user deleted"})
 }
 
+type updatePermissionsRequest struct {
+	CanDecrypt *bool `json:"can_decrypt" binding:"required"`
+}
+
+// UpdateUserPermissions godoc
+// @Summary      Update a user's permissions
+// @Description  Grants or revokes can_decrypt, which shows encrypted event fields in plaintext in event details (owner only). Takes effect at the user's next login.
+// @Tags         users
+// @Accept       json
+// @Produce      json
+// @Security     BearerAuth
+// @Param        id    path  string                    true  "User ID"
+// @Param        body  body  updatePermissionsRequest  true  "Permissions"
+// @Success      200  {object}  map[string]interface{}
+// @Failure      400  {object}  map[string]string
+// @Failure      403  {object}  map[string]string
+// @Failure      404  {object}  map[string]string
+// @Router       /auth/users/{id}/permissions [patch]
+func (h *Handler) UpdateUserPermissions(c *gin.Context) {
+	claims := c.MustGet(ContextKeyClaims).(*Claims)
+	if claims.Role != RoleOwner {
+		c.JSON(http.StatusForbidden, gin.H{"error": "owner only"})
+		return
+	}
+
+	var req updatePermissionsRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	id := c.Param("id")
+	if err := h.service.repo.SetUserCanDecrypt(id, *req.CanDecrypt); err != nil {
+		if err == ErrNotFound {
+			c.JSON(http.StatusNotFound, gin.H{"error": "user not found"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to update permissions"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"id": id, "can_decrypt": *req.CanDecrypt})
+}
+
 // --- Invites ---
 
 type createInviteRequest struct {
@@ -258,9 +301,7 @@ type createInviteRequest struct {
 }
 
 func (h *Handler) ListInvites(c *gin.Context) {
-	claims := c.MustGet(ContextKeyClaims).(*Claims)
-	if claims.Role != RoleOwner && claims.Role != RoleAdmin {
-		c.JSON(http.StatusForbidden, gin.H{"error": "admin or owner only"})
+	if !RequireManager(c) {
 		return
 	}
 	invites, err := h.service.repo.ListPendingInvites()
@@ -272,11 +313,10 @@ func (h *Handler) ListInvites(c *gin.Context) {
 }
 
 func (h *Handler) CreateInvite(c *gin.Context) {
-	claims := c.MustGet(ContextKeyClaims).(*Claims)
-	if claims.Role != RoleOwner && claims.Role != RoleAdmin {
-		c.JSON(http.StatusForbidden, gin.H{"error": "admin or owner only"})
+	if !RequireManager(c) {
 		return
 	}
+	claims := c.MustGet(ContextKeyClaims).(*Claims)
 
 	var req createInviteRequest
 	if err := c.ShouldBindJSON(&req); err != nil {
@@ -304,9 +344,7 @@ func (h *Handler) CreateInvite(c *gin.Context) {
 }
 
 func (h *Handler) RevokeInvite(c *gin.Context) {
-	claims := c.MustGet(ContextKeyClaims).(*Claims)
-	if claims.Role != RoleOwner && claims.Role != RoleAdmin {
-		c.JSON(http.StatusForbidden, gin.H{"error": "admin or owner only"})
+	if !RequireManager(c) {
 		return
 	}
 	id := c.Param("id")
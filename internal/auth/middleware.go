@@ -10,6 +10,7 @@ import (
 const ContextKeyClaims = "claims"
 const ContextKeyUserID = "user_id"
 const ContextKeyUserRole = "user_role"
+const ContextKeyCanDecrypt = "can_decrypt"
 const ContextKeyProjectID = "project_id"
 
 // JWTMiddleware validates the Bearer token and sets user claims in context.
@@ -37,6 +38,7 @@ func (s *Service) JWTMiddleware() gin.HandlerFunc {
 		c.Set(ContextKeyClaims, claims)
 		c.Set(ContextKeyUserID, claims.UserID)
 		c.Set(ContextKeyUserRole, string(claims.Role))
+		c.Set(ContextKeyCanDecrypt, claims.CanDecrypt)
 		c.Next()
 	}
 }
@@ -67,3 +69,16 @@ func (s *Service) APIKeyMiddleware() gin.HandlerFunc {
 		c.Next()
 	}
 }
+
+// RequireManager reports whether the caller is an owner or admin, the roles
+// that may change configuration and act on personal data, writing a 403 when
+// not. Handlers behind JWTMiddleware call it before anything else.
+func RequireManager(c *gin.Context) bool {
+	value, _ := c.Get(ContextKeyClaims)
+	claims, ok := value.(*Claims)
+	if !ok || (claims.Role != RoleOwner && claims.Role != RoleAdmin) {
+		c.JSON(http.StatusForbidden, gin.H{"error": "insufficient permissions"})
+		return false
+	}
+	return true
+}
@@ -27,6 +27,7 @@ type User struct {
 	Email        string    `json:"email"      gorm:"uniqueIndex"`
 	PasswordHash string    `json:"-"          gorm:"column:password_hash"`
 	Role         UserRole  `json:"role"`
+	CanDecrypt   bool      `json:"can_decrypt"` // sees encrypted event fields in plaintext
 	CreatedAt    time.Time `json:"created_at"`
 }
 
@@ -19,6 +19,7 @@ type Repository interface {
 	GetUserByEmail(email string) (*User, error)
 	ListUsers() ([]User, error)
 	DeleteUser(id string) error
+	SetUserCanDecrypt(id string, canDecrypt bool) error
 	CountUsers() (int64, error)
 
 	// Projects
@@ -95,13 +96,24 @@ func (r *repository) GetUserByEmail(email string) (*User, error) {
 
 func (r *repository) ListUsers() ([]User, error) {
 	var users []User
-	return users, r.db.Select("id, name, email, role, created_at").Order("created_at ASC").Find(&users).Error
+	return users, r.db.Select("id, name, email, role, can_decrypt, created_at").Order("created_at ASC").Find(&users).Error
 }
 
 func (r *repository) DeleteUser(id string) error {
 	return r.db.Delete(&User{}, "id = ?", id).Error
 }
 
+func (r *repository) SetUserCanDecrypt(id string, canDecrypt bool) error {
+	res := r.db.Model(&User{}).Where("id = ?", id).Update("can_decrypt", canDecrypt)
+	if res.Error != nil {
+		return res.Error
+	}
+	if res.RowsAffected == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
 func (r *repository) CountUsers() (int64, error) {
 	var count int64
 	if err := r.db.Model(&User{}).Count(&count).Error; err != nil {
@@ -22,6 +22,9 @@ type Claims struct {
 	UserID string   `json:"user_id"`
 	Email  string   `json:"email"`
 	Role   UserRole `json:"role"`
+	// CanDecrypt is read at login, so granting or revoking it applies from
+	// the user's next token.
+	CanDecrypt bool `json:"can_decrypt,omitempty"`
 	jwt.RegisteredClaims
 }
 
@@ -251,11 +254,32 @@ func (s *Service) EnsureProject(serviceName, apiKeyID string) (string, error) {
 	return newProject.ID, nil
 }
 
+// ReadableProjects returns the IDs of the projects a user may read: every
+// project for the owner, the projects they are a member of otherwise.
+func (s *Service) ReadableProjects(userID, role string) ([]string, error) {
+	var projects []Project
+	var err error
+	if UserRole(role) == RoleOwner {
+		projects, err = s.repo.ListAllProjects()
+	} else {
+		projects, err = s.repo.ListProjectsByUser(userID)
+	}
+	if err != nil {
+		return nil, err
+	}
+	ids := make([]string, len(projects))
+	for i, p := range projects {
+		ids[i] = p.ID
+	}
+	return ids, nil
+}
+
 func (s *Service) generateToken(user *User) (string, error) {
 	claims := &Claims{
-		UserID: user.ID,
-		Email:  user.Email,
-		Role:   user.Role,
+		UserID:     user.ID,
+		Email:      user.Email,
+		Role:       user.Role,
+		CanDecrypt: user.CanDecrypt,
 		RegisteredClaims: jwt.RegisteredClaims{
 			ExpiresAt: jwt.NewNumericDate(time.Now().Add(24 * time.Hour)),
 			IssuedAt:  jwt.NewNumericDate(time.Now()),
@@ -0,0 +1,1084 @@
+package conformance
+
+import (
+	"context"
+	"crypto/ed25519"
+	"crypto/rand"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/joaovrmoraes/bataudit/internal/audit"
+	"github.com/joaovrmoraes/bataudit/internal/db"
+	"github.com/joaovrmoraes/bataudit/internal/erasure"
+	"github.com/joaovrmoraes/bataudit/internal/integrity"
+	"github.com/joaovrmoraes/bataudit/internal/partition"
+	"github.com/joaovrmoraes/bataudit/internal/tiering"
+	"github.com/joaovrmoraes/bataudit/internal/wallboard"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gorm.io/gorm"
+)
+
+// engines are the databases the suite runs on, by name.
+var engines = map[string]*gorm.DB{}
+
+func TestMain(m *testing.M) {
+	// Migrations are read relative to the repository root.
+	if err := os.Chdir("../.."); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+
+	if os.Getenv("DB_DRIVER") == "postgres" {
+		conn, err := db.Init()
+		if err != nil {
+			fmt.Fprintln(os.Stderr, "postgres:", err)
+			os.Exit(1)
+		}
+		engines["postgres"] = conn
+	}
+
+	dir, err := os.MkdirTemp("", "bataudit-conformance")
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+	os.Setenv("DB_DRIVER", "sqlite")
+	os.Setenv("SQLITE_PATH", filepath.Join(dir, "bataudit.db"))
+	conn, err := db.Init()
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "sqlite:", err)
+		os.Exit(1)
+	}
+	engines["sqlite"] = conn
+
+	code := m.Run()
+	os.RemoveAll(dir)
+	os.Exit(code)
+}
+
+// forEachEngine runs fn against every engine, in a project of its own.
+func forEachEngine(t *testing.T, fn func(t *testing.T, conn *gorm.DB, projectID string)) {
+	for name, conn := range engines {
+		t.Run(name, func(t *testing.T) {
+			projectID := uuid.New().String()
+			require.NoError(t, conn.Exec(`INSERT INTO projects (id, name, slug, created_at) VALUES (?, ?, ?, ?)`,
+				projectID, "Conformance "+projectID[:8], projectID, time.Now().UTC()).Error)
+			t.Cleanup(func() {
+				for _, table := range []string{"audits", "audit_summaries", "audit_latency_sketches", "audit_chain_heads", "audit_chain_checkpoints", "audit_sessions", "session_settings", "wallboard_tokens", "erasure_requests"} {
+					conn.Exec(`DELETE FROM `+table+` WHERE project_id = ?`, projectID)
+				}
+				conn.Exec(`DELETE FROM projects WHERE id = ?`, projectID)
+			})
+			fn(t, conn, projectID)
+		})
+	}
+}
+
+// event is one stored audit event.
+type event struct {
+	at      time.Time
+	user    string
+	method  string
+	path    string
+	status  int
+	ms      int64
+	kind    string
+	session string
+	email   string
+}
+
+func seed(t *testing.T, conn *gorm.DB, projectID string, events []event) {
+	t.Helper()
+	repo := audit.NewRepository(conn)
+	for _, e := range events {
+		a := &audit.Audit{
+			ID:           uuid.New().String(),
+			Identifier:   e.user,
+			Method:       audit.HTTPMethod(e.method),
+			Path:         e.path,
+			StatusCode:   e.status,
+			ResponseTime: e.ms,
+			ServiceName:  "api",
+			Environment:  "production",
+			Timestamp:    e.at,
+			ProjectID:    projectID,
+			EventType:    "http",
+			SessionID:    e.session,
+			UserEmail:    e.email,
+		}
+		if e.kind != "" {
+			a.EventType = e.kind
+		}
+		require.NoError(t, repo.Create(a))
+	}
+}
+
+// iso is the format every engine renders timestamps in.
+func iso(t time.Time) string {
+	return t.UTC().Format("2006-01-02T15:04:05Z")
+}
+
+func TestSessions(t *testing.T) {
+	start := time.Now().UTC().Add(-3 * time.Hour).Truncate(time.Second)
+	forEachEngine(t, func(t *testing.T, conn *gorm.DB, projectID string) {
+		seed(t, conn, projectID, []event{
+			{at: start, user: "alice", method: "GET", path: "/a", status: 200, ms: 10, session: "s1-" + projectID},
+			{at: start.Add(5 * time.Minute), user: "alice", method: "GET", path: "/b", status: 200, ms: 10, session: "s1-" + projectID},
+			// More than 30 minutes later: a new session.
+			{at: start.Add(50 * time.Minute), user: "alice", method: "GET", path: "/c", status: 200, ms: 10},
+		})
+		repo := audit.NewRepository(conn)
+
+		page, err := repo.GetSessions(audit.SessionFilters{ProjectID: projectID})
+		require.NoError(t, err)
+		sessions := page.Data
+		require.Len(t, sessions, 2)
+		assert.Equal(t, iso(start.Add(50*time.Minute)), sessions[0].SessionStart)
+		assert.Equal(t, int64(1), sessions[0].EventCount)
+		assert.Equal(t, iso(start), sessions[1].SessionStart)
+		assert.Equal(t, iso(start.Add(5*time.Minute)), sessions[1].SessionEnd)
+		assert.InDelta(t, 300, sessions[1].DurationSeconds, 0.01)
+		assert.Equal(t, int64(2), sessions[1].EventCount)
+
+		detail, err := repo.GetSessionByID("s1-" + projectID)
+		require.NoError(t, err)
+		require.NotNil(t, detail)
+		assert.Equal(t, "alice", detail.Identifier)
+		assert.Equal(t, iso(start), detail.SessionStart)
+		assert.InDelta(t, 300, detail.DurationSeconds, 0.01)
+		assert.Len(t, detail.Events, 2)
+	})
+}
+
+func TestStoredSessions(t *testing.T) {
+	start := time.Now().UTC().Add(-6 * time.Hour).Truncate(time.Second)
+	forEachEngine(t, func(t *testing.T, conn *gorm.DB, projectID string) {
+		repo := audit.NewRepository(conn)
+		require.NoError(t, repo.SaveSessionSettings(&audit.SessionSettings{ProjectID: projectID, InactivityTimeoutSeconds: 600}))
+		settings, err := repo.GetSessionSettings(projectID)
+		require.NoError(t, err)
+		assert.Equal(t, 600, settings.InactivityTimeoutSeconds)
+		assert.False(t, settings.Default)
+
+		seed(t, conn, projectID, []event{
+			{at: start, user: "alice", method: "GET", path: "/a", status: 200, ms: 10},
+			{at: start.Add(16 * time.Minute), user: "alice", method: "GET", path: "/b", status: 500, ms: 30},
+			// Late: joins the two sessions above, 8 minutes from each.
+			{at: start.Add(8 * time.Minute), user: "alice", method: "GET", path: "/c", status: 200, ms: 20},
+			// More than 10 minutes later: a new session.
+			{at: start.Add(30 * time.Minute), user: "alice", method: "GET", path: "/d", status: 404, ms: 40},
+			{at: start.Add(time.Hour), user: "bob", method: "GET", path: "/a", status: 200, ms: 10, session: "s2-" + projectID},
+			{at: start.Add(3 * time.Hour), user: "bob", method: "GET", path: "/b", status: 200, ms: 10, session: "s2-" + projectID},
+		})
+
+		page, err := repo.GetSessions(audit.SessionFilters{ProjectID: projectID})
+		require.NoError(t, err)
+		require.Len(t, page.Data, 3)
+		assert.Empty(t, page.NextCursor)
+		explicit, second, first := page.Data[0], page.Data[1], page.Data[2]
+		assert.Equal(t, "s2-"+projectID, explicit.SessionID, "explicit sessions ignore the timeout")
+		assert.Equal(t, int64(2), explicit.EventCount)
+		assert.InDelta(t, 2*3600, explicit.DurationSeconds, 0.01)
+		assert.Equal(t, iso(start.Add(30*time.Minute)), second.SessionStart)
+		assert.Equal(t, int64(1), second.EventCount)
+		assert.Equal(t, iso(start), first.SessionStart)
+		assert.Equal(t, iso(start.Add(16*time.Minute)), first.SessionEnd)
+		assert.Equal(t, int64(3), first.EventCount)
+		assert.Equal(t, int64(1), first.ErrorCount)
+		assert.InDelta(t, 20, first.AvgResponseTime, 0.01)
+
+		// Pages by cursor.
+		var paged []audit.Session
+		filters := audit.SessionFilters{ProjectID: projectID, Limit: 2}
+		for {
+			page, err := repo.GetSessions(filters)
+			require.NoError(t, err)
+			paged = append(paged, page.Data...)
+			if page.NextCursor == "" {
+				break
+			}
+			filters.After, err = audit.ParseCursor(page.NextCursor)
+			require.NoError(t, err)
+		}
+		assert.Equal(t, []audit.Session{explicit, second, first}, paged)
+
+		// A range lists the sessions with events in it.
+		from, to := start.Add(20*time.Minute), start.Add(2*time.Hour)
+		page, err = repo.GetSessions(audit.SessionFilters{ProjectID: projectID, StartDate: &from, EndDate: &to})
+		require.NoError(t, err)
+		assert.Equal(t, []audit.Session{explicit, second}, page.Data)
+
+		// Rebuilding from the raw events finds the same sessions, with new IDs.
+		require.NoError(t, repo.RebuildSessions(projectID))
+		page, err = repo.GetSessions(audit.SessionFilters{ProjectID: projectID})
+		require.NoError(t, err)
+		require.Len(t, page.Data, 3)
+		for i, s := range page.Data {
+			want := []audit.Session{explicit, second, first}[i]
+			want.ID = s.ID
+			assert.Equal(t, want, s)
+		}
+		explicit, second, first = page.Data[0], page.Data[1], page.Data[2]
+
+		// Sessions keep their stats once their events are tiered away.
+		require.NoError(t, conn.Exec(`DELETE FROM audits WHERE project_id = ?`, projectID).Error)
+		page, err = repo.GetSessions(audit.SessionFilters{ProjectID: projectID})
+		require.NoError(t, err)
+		assert.Equal(t, []audit.Session{explicit, second, first}, page.Data)
+		detail, err := repo.GetSessionByID("s2-" + projectID)
+		require.NoError(t, err)
+		require.NotNil(t, detail)
+		assert.Equal(t, int64(2), detail.EventCount)
+		assert.Empty(t, detail.Events)
+	})
+}
+
+func TestStatsAndInsights(t *testing.T) {
+	last := time.Now().UTC().Add(-30 * time.Minute).Truncate(time.Second)
+	forEachEngine(t, func(t *testing.T, conn *gorm.DB, projectID string) {
+		seed(t, conn, projectID, []event{
+			{at: last.Add(-2 * time.Hour), user: "alice", method: "GET", path: "/a", status: 200, ms: 10},
+			{at: last.Add(-time.Hour), user: "alice", method: "GET", path: "/a", status: 404, ms: 20},
+			{at: last.Add(-time.Minute), user: "bob", method: "POST", path: "/b", status: 500, ms: 30},
+			{at: last, user: "bob", method: "POST", path: "/b", status: 502, ms: 40},
+		})
+		repo := audit.NewRepository(conn)
+
+		stats, err := repo.GetStats(audit.StatsFilters{ProjectID: projectID})
+		require.NoError(t, err)
+		assert.Equal(t, int64(4), stats.Total)
+		assert.Equal(t, int64(1), stats.Errors4xx)
+		assert.Equal(t, int64(2), stats.Errors5xx)
+		assert.InDelta(t, 25, stats.AvgResponseTime, 0.01)
+		assert.InDelta(t, 38.5, stats.P95ResponseTime, 0.01, "interpolated as percentile_cont")
+		assert.Equal(t, iso(last), stats.LastEventAt)
+		assert.Equal(t, map[string]int64{"2xx": 1, "3xx": 0, "4xx": 1, "5xx": 2}, stats.ByStatusClass)
+		assert.Equal(t, map[string]int64{"GET": 2, "POST": 2}, stats.ByMethod)
+		var timeline int64
+		for _, p := range stats.Timeline {
+			_, err := time.Parse("2006-01-02T15:04:05Z", p.Hour)
+			assert.NoError(t, err)
+			assert.Equal(t, p.Hour[14:], "00:00Z", "hour buckets")
+			timeline += p.Count
+		}
+		assert.Equal(t, int64(4), timeline)
+
+		insights, err := repo.GetInsights(audit.InsightFilters{ProjectID: projectID})
+		require.NoError(t, err)
+		require.Len(t, insights.TopEndpoints, 2)
+		assert.Equal(t, int64(2), insights.TopEndpoints[0].Count)
+		require.Len(t, insights.TopErrorRoutes, 2)
+		assert.Equal(t, "/b", insights.TopErrorRoutes[0].Path)
+
+		users, err := repo.GetAffectedUsers(projectID, "/b", "POST", "", "", 10)
+		require.NoError(t, err)
+		require.Len(t, users, 1)
+		assert.Equal(t, "bob", users[0].Identifier)
+		assert.Equal(t, int64(2), users[0].ErrorCount)
+		assert.True(t, last.Equal(users[0].LastSeen), "last seen %s, want %s", users[0].LastSeen, last)
+	})
+}
+
+func TestWallboard(t *testing.T) {
+	now := time.Now().UTC().Truncate(time.Second)
+	forEachEngine(t, func(t *testing.T, conn *gorm.DB, projectID string) {
+		seed(t, conn, projectID, []event{
+			{at: now.Add(-3 * time.Hour), user: "alice", method: "GET", path: "/old", status: 200, ms: 10},
+			{at: now.Add(-20 * time.Minute), user: "alice", method: "GET", path: "/a", status: 200, ms: 10},
+			{at: now.Add(-10 * time.Minute), user: "bob", method: "GET", path: "/a", status: 500, ms: 30},
+			{at: now.Add(-5 * time.Minute), user: "system", path: "error_rate", kind: "system.alert"},
+		})
+		repo := wallboard.NewRepository(conn)
+
+		summary, err := repo.GetSummary(projectID, "")
+		require.NoError(t, err)
+		assert.Equal(t, int64(4), summary.EventsToday)
+		assert.Equal(t, int64(1), summary.Errors5xx)
+
+		feed, err := repo.GetFeed(projectID, "", 10)
+		require.NoError(t, err)
+		require.Len(t, feed, 3, "alerts are not in the feed")
+		assert.Equal(t, iso(now.Add(-10*time.Minute)), feed[0].Timestamp)
+
+		volume, err := repo.GetVolume(projectID, "")
+		require.NoError(t, err)
+		var total int64
+		for _, p := range volume {
+			bucket, err := time.Parse("2006-01-02T15:04:05Z", p.Bucket)
+			require.NoError(t, err)
+			assert.Zero(t, bucket.Minute()%5, "5-minute buckets")
+			assert.Zero(t, bucket.Second())
+			total += p.Count
+		}
+		assert.Equal(t, int64(3), total, "last 2 hours only")
+
+		alerts, err := repo.GetAlerts(projectID, "")
+		require.NoError(t, err)
+		require.Len(t, alerts, 1)
+		assert.Equal(t, iso(now.Add(-5*time.Minute)), alerts[0].Timestamp)
+
+		routes, err := repo.GetErrorRoutes(projectID, "")
+		require.NoError(t, err)
+		require.Len(t, routes, 1)
+		assert.InDelta(t, 50, routes[0].ErrorRate, 0.01)
+
+		stats, err := repo.GetProjectStats("")
+		require.NoError(t, err)
+		var found bool
+		for _, s := range stats {
+			if s.ProjectID == projectID {
+				found = true
+				assert.Equal(t, int64(3), s.EventsToday, "alerts are left out")
+			}
+		}
+		assert.True(t, found)
+
+		tok, _, err := repo.GenerateToken(projectID, "lobby")
+		require.NoError(t, err)
+		got, err := repo.GetByCode(tok.Code)
+		require.NoError(t, err)
+		assert.Equal(t, tok.ID, got.ID)
+		require.NoError(t, repo.RenewExpiry(tok.ID, time.Now().Add(-time.Minute)))
+		_, err = repo.GetByCode(tok.Code)
+		assert.Error(t, err, "expired codes are not found")
+	})
+}
+
+func TestTiering(t *testing.T) {
+	hour := time.Now().UTC().Truncate(time.Hour).Add(-48 * time.Hour)
+	forEachEngine(t, func(t *testing.T, conn *gorm.DB, projectID string) {
+		seed(t, conn, projectID, []event{
+			{at: hour.Add(10 * time.Minute), user: "alice", method: "GET", path: "/a", status: 200, ms: 10},
+			{at: hour.Add(20 * time.Minute), user: "alice", method: "GET", path: "/a", status: 404, ms: 20},
+			{at: hour.Add(70 * time.Minute), user: "alice", method: "GET", path: "/a", status: 500, ms: 30},
+		})
+		repo := tiering.NewRepository(conn)
+		scope := tiering.Scope{ProjectID: projectID}
+
+		history, err := repo.GetHistory(projectID, hour.Add(-time.Hour), hour.Add(3*time.Hour))
+		require.NoError(t, err)
+		require.Len(t, history, 2)
+		assert.True(t, hour.Equal(history[0].PeriodStart), "period %s, want %s", history[0].PeriodStart, hour)
+		assert.Equal(t, int64(2), history[0].EventCount)
+		assert.Equal(t, int64(1), history[0].Errors4xx)
+		assert.InDelta(t, 19.5, history[0].P95Ms, 0.01)
+
+		n, err := repo.SummarizeRawToHourly(scope, hour.Add(2*time.Hour))
+		require.NoError(t, err)
+		assert.Equal(t, int64(2), n)
+		n, err = repo.SummarizeRawToHourly(scope, hour.Add(2*time.Hour))
+		require.NoError(t, err)
+		assert.Zero(t, n, "buckets already summarized are skipped")
+
+		history, err = repo.GetHistory(projectID, hour, hour.Add(3*time.Hour))
+		require.NoError(t, err)
+		require.Len(t, history, 2, "summaries and raw events of the same hour are merged")
+		assert.True(t, hour.Equal(history[0].PeriodStart), "period %s, want %s", history[0].PeriodStart, hour)
+		assert.Equal(t, tiering.PeriodHour, history[0].PeriodType)
+
+		counts, err := repo.CountExpiredRaw(scope, []tiering.RawRule{
+			{EventType: "http", Cutoff: hour.Add(time.Hour)},
+		})
+		require.NoError(t, err)
+		assert.Equal(t, []int64{2}, counts)
+
+		n, err = repo.CountExpiredHourly(scope, hour.Add(90*time.Minute))
+		require.NoError(t, err)
+		assert.Equal(t, int64(2), n)
+		n, err = repo.AggregateHourlyToDaily(scope, hour.Add(90*time.Minute))
+		require.NoError(t, err)
+		assert.Equal(t, int64(2), n, "hourly rows folded into the day")
+
+		var lastID string
+		require.NoError(t, conn.Raw(`SELECT id FROM audits WHERE project_id = ? AND status_code = 500`, projectID).Scan(&lastID).Error)
+		n, err = repo.DeleteRawByID([]string{lastID})
+		require.NoError(t, err)
+		assert.Equal(t, int64(1), n)
+		n, err = repo.DeleteRaw(scope, []tiering.RawRule{{EventType: "http", Cutoff: hour.Add(time.Hour)}})
+		require.NoError(t, err)
+		assert.Equal(t, int64(2), n)
+
+		var checkpoints []audit.ChainCheckpoint
+		require.NoError(t, conn.Where("project_id = ?", projectID).Order("first_seq").Find(&checkpoints).Error)
+		require.Len(t, checkpoints, 2)
+		assert.Equal(t, []int64{1, 2, 2}, []int64{checkpoints[0].FirstSeq, checkpoints[0].LastSeq, checkpoints[0].RowCount})
+		assert.Equal(t, audit.CheckpointTiering, checkpoints[0].Reason)
+		assert.Equal(t, []int64{3, 3, 1}, []int64{checkpoints[1].FirstSeq, checkpoints[1].LastSeq, checkpoints[1].RowCount})
+		assert.Equal(t, audit.CheckpointArchived, checkpoints[1].Reason)
+
+		verification, err := audit.NewRepository(conn).VerifyChain(context.Background(), projectID, 0, 0)
+		require.NoError(t, err)
+		assert.True(t, verification.Valid, "%+v", verification.Break)
+		assert.Equal(t, int64(3), verification.Removed)
+	})
+}
+
+func TestAggregate(t *testing.T) {
+	hour := time.Now().UTC().Truncate(time.Hour).Add(-48 * time.Hour)
+	recent := time.Now().UTC().Truncate(time.Hour).Add(-2*time.Hour + 5*time.Minute)
+	forEachEngine(t, func(t *testing.T, conn *gorm.DB, projectID string) {
+		seed(t, conn, projectID, []event{
+			{at: hour.Add(10 * time.Minute), user: "alice", method: "GET", path: "/a", status: 200, ms: 10},
+			{at: hour.Add(20 * time.Minute), user: "bob", method: "GET", path: "/a", status: 404, ms: 20},
+			{at: hour.Add(70 * time.Minute), user: "alice", method: "GET", path: "/a", status: 500, ms: 30},
+			{at: recent, user: "alice", method: "GET", path: "/b", status: 200, ms: 40},
+		})
+		svc := audit.NewService(audit.NewRepository(conn))
+		aggregate := func(q audit.AggregateQuery) *audit.AggregateResult {
+			t.Helper()
+			q.Filters.ProjectID = projectID
+			require.NoError(t, q.Validate())
+			result, err := svc.Aggregate(q)
+			require.NoError(t, err)
+			return result
+		}
+
+		result := aggregate(audit.AggregateQuery{
+			Metrics: []string{"count", "p50_latency", "distinct_identifiers"},
+			GroupBy: []string{"method", "status_class"},
+		})
+		assert.Equal(t, []string{"raw"}, result.Tiers)
+		require.Len(t, result.Rows, 3)
+		assert.Equal(t, map[string]string{"method": "GET", "status_class": "2xx"}, result.Rows[0].Group)
+		assert.Equal(t, 2.0, result.Rows[0].Metrics["count"])
+		assert.InDelta(t, 25.0, result.Rows[0].Metrics["p50_latency"], 0.01)
+		assert.Equal(t, 1.0, result.Rows[0].Metrics["distinct_identifiers"])
+
+		result = aggregate(audit.AggregateQuery{Metrics: []string{"count"}, Interval: "hour"})
+		require.Len(t, result.Rows, 3)
+		assert.True(t, hour.Equal(*result.Rows[0].Bucket), "bucket %s, want %s", result.Rows[0].Bucket, hour)
+		assert.Equal(t, 2.0, result.Rows[0].Metrics["count"])
+
+		// Tiering summarizes the old hours and deletes their raw events.
+		scope := tiering.Scope{ProjectID: projectID}
+		_, err := tiering.NewRepository(conn).SummarizeRawToHourly(scope, hour.Add(2*time.Hour))
+		require.NoError(t, err)
+		require.NoError(t, conn.Exec("DELETE FROM audits WHERE project_id = ? AND timestamp < ?", projectID, hour.Add(2*time.Hour)).Error)
+
+		result = aggregate(audit.AggregateQuery{
+			Metrics: []string{"count", "error_rate", "avg_latency"},
+			GroupBy: []string{"service"},
+		})
+		assert.Equal(t, []string{"summary", "raw"}, result.Tiers)
+		assert.Nil(t, result.RawSince)
+		require.Len(t, result.Rows, 1)
+		assert.Equal(t, map[string]float64{"count": 4, "error_rate": 50, "avg_latency": 25}, result.Rows[0].Metrics)
+
+		result = aggregate(audit.AggregateQuery{Metrics: []string{"count"}, Interval: "hour"})
+		require.Len(t, result.Rows, 3, "summarized hours and raw hours")
+		assert.True(t, hour.Equal(*result.Rows[0].Bucket), "bucket %s, want %s", result.Rows[0].Bucket, hour)
+
+		// Routes and percentiles come from the latency sketches.
+		result = aggregate(audit.AggregateQuery{Metrics: []string{"count", "max_latency"}, GroupBy: []string{"route"}})
+		assert.Equal(t, []string{"summary", "raw"}, result.Tiers)
+		assert.Nil(t, result.RawSince)
+		require.Len(t, result.Rows, 2)
+		assert.Equal(t, "/a", result.Rows[0].Group["route"])
+		assert.Equal(t, map[string]float64{"count": 3, "max_latency": 30}, result.Rows[0].Metrics)
+
+		latencies, err := audit.NewRepository(conn).GetLatency(audit.LatencyFilters{ProjectID: projectID, GroupBy: "service"})
+		require.NoError(t, err)
+		require.Len(t, latencies.Data, 1)
+		assert.Positive(t, latencies.Data[0].P95Ms)
+		result = aggregate(audit.AggregateQuery{Metrics: []string{"error_rate", "p95_latency"}, GroupBy: []string{"service"}})
+		require.Len(t, result.Rows, 1)
+		assert.Equal(t, 50.0, result.Rows[0].Metrics["error_rate"])
+		assert.InDelta(t, latencies.Data[0].P95Ms, result.Rows[0].Metrics["p95_latency"], 0.01, "the p95 of all events")
+
+		result = aggregate(audit.AggregateQuery{Metrics: []string{"error_count"}, GroupBy: []string{"route"}})
+		assert.Equal(t, []string{"raw"}, result.Tiers)
+		require.NotNil(t, result.RawSince, "neither tier has errors per route")
+		assert.True(t, hour.Add(2*time.Hour).Equal(*result.RawSince), "raw_since %s", result.RawSince)
+		require.Len(t, result.Rows, 1)
+		assert.Equal(t, "/b", result.Rows[0].Group["route"])
+	})
+}
+
+func TestLatency(t *testing.T) {
+	hour := time.Now().UTC().Truncate(24*time.Hour).Add(-48*time.Hour + 10*time.Hour)
+	recent := time.Now().UTC().Truncate(time.Hour).Add(-2*time.Hour + 5*time.Minute)
+	forEachEngine(t, func(t *testing.T, conn *gorm.DB, projectID string) {
+		seed(t, conn, projectID, []event{
+			{at: hour.Add(10 * time.Minute), user: "alice", method: "GET", path: "/a", status: 200, ms: 10},
+			{at: hour.Add(20 * time.Minute), user: "alice", method: "GET", path: "/a", status: 200, ms: 20},
+			{at: hour.Add(70 * time.Minute), user: "alice", method: "GET", path: "/a", status: 500, ms: 30},
+			{at: recent, user: "alice", method: "GET", path: "/b", status: 200, ms: 40},
+		})
+		repo := audit.NewRepository(conn)
+
+		result, err := repo.GetLatency(audit.LatencyFilters{ProjectID: projectID})
+		require.NoError(t, err)
+		assert.Equal(t, []string{"raw"}, result.Tiers)
+		require.Len(t, result.Data, 2)
+		assert.Equal(t, "/a", result.Data[0].Path)
+		assert.Equal(t, int64(3), result.Data[0].Count)
+		assert.Equal(t, int64(30), result.Data[0].MaxMs)
+		assert.InDelta(t, 20.0, result.Data[0].P50Ms, 5)
+
+		stats, err := repo.GetStats(audit.StatsFilters{ProjectID: projectID})
+		require.NoError(t, err)
+		assert.InDelta(t, 25.0, stats.P50ResponseTime, 0.01)
+		assert.Equal(t, int64(40), stats.MaxResponseTime)
+
+		// Tiering sketches the old hours and deletes their raw events.
+		tiers := tiering.NewRepository(conn)
+		scope := tiering.Scope{ProjectID: projectID}
+		_, err = tiers.SummarizeRawToHourly(scope, hour.Add(2*time.Hour))
+		require.NoError(t, err)
+		require.NoError(t, conn.Exec("DELETE FROM audits WHERE project_id = ? AND timestamp < ?", projectID, hour.Add(2*time.Hour)).Error)
+
+		result, err = repo.GetLatency(audit.LatencyFilters{ProjectID: projectID, GroupBy: "none"})
+		require.NoError(t, err)
+		assert.Equal(t, []string{"summary", "raw"}, result.Tiers)
+		require.Len(t, result.Data, 1)
+		all := result.Data[0]
+		assert.Equal(t, int64(4), all.Count)
+		assert.Equal(t, 25.0, all.AvgMs)
+		assert.Equal(t, int64(40), all.MaxMs)
+		var bucketed int64
+		for _, b := range all.Buckets {
+			bucketed += b.Count
+		}
+		assert.Equal(t, int64(4), bucketed)
+
+		// Folded into their day over two runs, the hours still add up.
+		_, err = tiers.AggregateHourlyToDaily(scope, hour.Add(30*time.Minute))
+		require.NoError(t, err)
+		_, err = tiers.AggregateHourlyToDaily(scope, hour.Add(2*time.Hour))
+		require.NoError(t, err)
+		var days, hours int64
+		conn.Raw("SELECT COUNT(*) FROM audit_latency_sketches WHERE project_id = ? AND period_type = 'day'", projectID).Scan(&days)
+		conn.Raw("SELECT COUNT(*) FROM audit_latency_sketches WHERE project_id = ? AND period_type = 'hour'", projectID).Scan(&hours)
+		assert.Equal(t, int64(1), days)
+		assert.Zero(t, hours)
+
+		result, err = repo.GetLatency(audit.LatencyFilters{ProjectID: projectID, Path: "/a"})
+		require.NoError(t, err)
+		require.Len(t, result.Data, 1)
+		assert.Equal(t, int64(3), result.Data[0].Count)
+		assert.Equal(t, 20.0, result.Data[0].AvgMs)
+		assert.Equal(t, int64(30), result.Data[0].MaxMs)
+	})
+}
+
+func TestCompare(t *testing.T) {
+	end := time.Now().UTC().Truncate(time.Hour)
+	current := audit.Window{Start: end.Add(-24 * time.Hour), End: end}
+	previous, err := audit.ComparisonWindow(audit.ComparePreviousPeriod, current, nil)
+	require.NoError(t, err)
+	forEachEngine(t, func(t *testing.T, conn *gorm.DB, projectID string) {
+		seed(t, conn, projectID, []event{
+			// Previous day: /old and carol, gone since.
+			{at: previous.Start.Add(time.Hour), user: "alice", method: "GET", path: "/a", status: 200, ms: 10},
+			{at: previous.Start.Add(2 * time.Hour), user: "carol", method: "GET", path: "/old", status: 500, ms: 50},
+			// Current day: /new and bob are new.
+			{at: current.Start.Add(time.Hour), user: "alice", method: "GET", path: "/a", status: 200, ms: 20},
+			{at: current.Start.Add(2 * time.Hour), user: "alice", method: "GET", path: "/a", status: 404, ms: 20},
+			{at: current.Start.Add(3 * time.Hour), user: "bob", method: "POST", path: "/new", status: 200, ms: 30},
+			// Outside both windows.
+			{at: end.Add(30 * time.Minute), user: "alice", method: "GET", path: "/a", status: 200, ms: 10},
+		})
+		repo := audit.NewRepository(conn)
+		svc := audit.NewService(repo)
+
+		stats, err := svc.CompareStats(audit.StatsFilters{ProjectID: projectID, Start: &current.Start, End: &current.End}, previous)
+		require.NoError(t, err)
+		assert.Equal(t, int64(3), stats.Current.Total)
+		assert.Equal(t, int64(2), stats.Previous.Total)
+		total := stats.Deltas["total"]
+		assert.Equal(t, 1.0, total.Change)
+		require.NotNil(t, total.Percent)
+		assert.Equal(t, 50.0, *total.Percent)
+		assert.Equal(t, -1.0, stats.Deltas["errors_5xx"].Change)
+		assert.Equal(t, 1.0, stats.ByStatusClass["4xx"].Current)
+		assert.Nil(t, stats.ByStatusClass["4xx"].Percent, "nothing to compare with")
+
+		insights, err := repo.CompareInsights(audit.InsightFilters{ProjectID: projectID}, current, previous)
+		require.NoError(t, err)
+		status := func(entries []audit.RankedDelta) map[string]string {
+			out := map[string]string{}
+			for _, e := range entries {
+				out[e.Path+e.Identifier] = e.Status
+			}
+			return out
+		}
+		assert.Equal(t, map[string]string{"/a": "", "/new": "new", "/old": "gone"}, status(insights.TopEndpoints))
+		assert.Equal(t, "/a", insights.TopEndpoints[0].Path)
+		assert.Equal(t, 2.0, insights.TopEndpoints[0].Current)
+		assert.Equal(t, map[string]string{"alice": "", "bob": "new", "carol": "gone"}, status(insights.TopUsers))
+		assert.Equal(t, map[string]string{"/a": "new", "/old": "gone"}, status(insights.TopErrorRoutes))
+		slow := insights.TopSlowRoutes
+		require.Len(t, slow, 3)
+		assert.Equal(t, "/new", slow[0].Path)
+		assert.Equal(t, "/a", slow[1].Path)
+		assert.Equal(t, 20.0, slow[1].Current)
+		assert.Equal(t, 10.0, slow[1].Previous)
+		assert.Equal(t, "gone", slow[2].Status)
+	})
+}
+
+func TestIdentity(t *testing.T) {
+	start := time.Now().UTC().Add(-3 * time.Hour).Truncate(time.Second)
+	forEachEngine(t, func(t *testing.T, conn *gorm.DB, projectID string) {
+		seed(t, conn, projectID, []event{
+			{at: start, user: "mallory", method: "GET", path: "/a", status: 200, ms: 10},
+			{at: start.Add(5 * time.Minute), user: "mallory", method: "POST", path: "/login", status: 401, ms: 10},
+			{at: start.Add(10 * time.Minute), user: "mallory", method: "POST", path: "/login", status: 503, ms: 10},
+			{at: start.Add(15 * time.Minute), user: "alice", method: "GET", path: "/a", status: 200, ms: 10},
+		})
+		require.NoError(t, conn.Exec("UPDATE audits SET ip = '203.0.113.7', user_agent = 'curl/8.0', tenant_id = 'acme' WHERE project_id = ? AND identifier = 'mallory'", projectID).Error)
+		require.NoError(t, conn.Exec("UPDATE audits SET ip = '198.51.100.1' WHERE project_id = ? AND identifier = 'mallory' AND status_code = 503", projectID).Error)
+		repo := audit.NewRepository(conn)
+		require.NoError(t, repo.Create(&audit.Audit{
+			ID: uuid.New().String(), EventType: "system.alert", Path: "brute_force", Identifier: "system",
+			ServiceName: "api", Environment: "production", ProjectID: projectID, Timestamp: start.Add(11 * time.Minute),
+			RequestBody: []byte(`{"identifier": "mallory", "fail_count": 10}`),
+		}))
+
+		profile, err := repo.GetIdentity("mallory", []string{projectID})
+		require.NoError(t, err)
+		require.NotNil(t, profile)
+		assert.True(t, start.Equal(profile.FirstSeen), "first seen %s", profile.FirstSeen)
+		assert.True(t, start.Add(10*time.Minute).Equal(profile.LastSeen), "last seen %s", profile.LastSeen)
+		assert.Equal(t, int64(3), profile.EventCount)
+		assert.Equal(t, int64(1), profile.Errors4xx)
+		assert.Equal(t, int64(1), profile.Errors5xx)
+		require.Len(t, profile.IPs, 2)
+		assert.Equal(t, audit.IdentityValue{Value: "203.0.113.7", Count: 2, LastSeen: profile.IPs[0].LastSeen}, profile.IPs[0])
+		assert.True(t, start.Add(5*time.Minute).Equal(profile.IPs[0].LastSeen))
+		require.Len(t, profile.Tenants, 1)
+		assert.Equal(t, "acme", profile.Tenants[0].Value)
+		require.Len(t, profile.UserAgents, 1)
+		require.Len(t, profile.Services, 1)
+		require.Len(t, profile.Sessions, 1)
+		assert.Equal(t, int64(3), profile.Sessions[0].EventCount)
+		require.Len(t, profile.Alerts, 1)
+		assert.Equal(t, "brute_force", profile.Alerts[0].Path)
+
+		none, err := repo.GetIdentity("mallory", []string{})
+		require.NoError(t, err)
+		assert.Nil(t, none, "no readable project")
+
+		page, err := repo.List(2, 0, audit.ListFilters{Identifier: "mallory", ProjectIDs: []string{projectID}, SortOrder: "asc", Total: audit.TotalNone})
+		require.NoError(t, err)
+		require.Len(t, page.Data, 2)
+		assert.Equal(t, "/a", page.Data[0].Path)
+		after, err := audit.ParseCursor(page.NextCursor)
+		require.NoError(t, err)
+		page, err = repo.List(2, 0, audit.ListFilters{Identifier: "mallory", ProjectIDs: []string{projectID}, SortOrder: "asc", Total: audit.TotalNone, After: after})
+		require.NoError(t, err)
+		require.Len(t, page.Data, 1)
+		assert.Equal(t, 503, page.Data[0].StatusCode)
+		assert.Empty(t, page.NextCursor)
+	})
+}
+
+func TestFunnelsAndPaths(t *testing.T) {
+	start := time.Now().UTC().Add(-5 * time.Hour).Truncate(time.Second)
+	at := func(minutes int) time.Time { return start.Add(time.Duration(minutes) * time.Minute) }
+	forEachEngine(t, func(t *testing.T, conn *gorm.DB, projectID string) {
+		seed(t, conn, projectID, []event{
+			{at: at(0), user: "alice", method: "GET", path: "/cart", status: 200, session: "s-alice"},
+			{at: at(5), user: "alice", method: "POST", path: "/checkout", status: 200, session: "s-alice"},
+			{at: at(8), user: "alice", method: "POST", path: "/pay", status: 201, session: "s-alice"},
+			{at: at(0), user: "bob", method: "GET", path: "/cart", status: 200},
+			{at: at(2), user: "bob", method: "POST", path: "/checkout", status: 200},
+			{at: at(3), user: "bob", method: "POST", path: "/pay", status: 402},
+			{at: at(0), user: "carol", method: "GET", path: "/cart", status: 200},
+			{at: at(90), user: "carol", method: "POST", path: "/checkout", status: 200},
+			{at: at(1), user: "anonymous", method: "GET", path: "/cart", status: 200},
+		})
+		repo := audit.NewRepository(conn)
+
+		q := audit.FunnelQuery{
+			JourneyFilters: audit.JourneyFilters{ProjectID: projectID},
+			Steps: []audit.FunnelStep{
+				{Method: "GET", Path: "/cart"},
+				{Method: "POST", Path: "/checkout"},
+				{Method: "POST", Path: "/pay", Status: "2xx"},
+			},
+		}
+		require.NoError(t, q.Validate())
+		funnel, err := repo.Funnel(q)
+		require.NoError(t, err)
+		require.Len(t, funnel.Steps, 3)
+		assert.Equal(t, int64(3), funnel.Steps[0].Entered)
+		assert.Equal(t, int64(2), funnel.Steps[1].Entered, "carol waited 90 minutes")
+		assert.Equal(t, int64(1), funnel.Steps[2].Entered, "bob's payment failed")
+		assert.Equal(t, 210.0, funnel.Steps[1].AvgSecondsFromPrevious)
+
+		q.By = "session"
+		funnel, err = repo.Funnel(q)
+		require.NoError(t, err)
+		assert.Equal(t, int64(1), funnel.Steps[2].Entered)
+		assert.Equal(t, 100.0, funnel.Steps[2].ConversionRate)
+
+		next := audit.PathQuery{JourneyFilters: audit.JourneyFilters{ProjectID: projectID}, Method: "GET", Path: "/cart"}
+		require.NoError(t, next.Validate())
+		paths, err := repo.Paths(next)
+		require.NoError(t, err)
+		assert.Equal(t, int64(3), paths.Occurrences)
+		assert.Equal(t, int64(1), paths.None, "carol left")
+		require.Len(t, paths.Transitions, 1)
+		assert.Equal(t, "/checkout", paths.Transitions[0].Path)
+		assert.Equal(t, int64(2), paths.Transitions[0].Count)
+		assert.InDelta(t, 66.67, paths.Transitions[0].Percent, 0.01)
+		assert.InDelta(t, 210.0, paths.Transitions[0].AvgSeconds, 0.01)
+
+		previous := audit.PathQuery{JourneyFilters: audit.JourneyFilters{ProjectID: projectID}, Method: "POST", Path: "/pay", Direction: "previous"}
+		require.NoError(t, previous.Validate())
+		paths, err = repo.Paths(previous)
+		require.NoError(t, err)
+		assert.Equal(t, int64(2), paths.Occurrences)
+		assert.Zero(t, paths.None)
+		require.Len(t, paths.Transitions, 1)
+		assert.Equal(t, "POST", paths.Transitions[0].Method)
+		assert.Equal(t, "/checkout", paths.Transitions[0].Path)
+	})
+}
+
+func TestQueryConsole(t *testing.T) {
+	ctx := context.Background()
+	forEachEngine(t, func(t *testing.T, conn *gorm.DB, projectID string) {
+		seed(t, conn, projectID, []event{
+			{at: time.Now().UTC(), user: "alice", method: "GET", path: "/a", status: 200, ms: 10},
+			{at: time.Now().UTC(), user: "bob", method: "DELETE", path: "/a", status: 500, ms: 10},
+		})
+		dialect := conn.Dialector.Name()
+
+		q, args, err := audit.ExpandFilters(
+			fmt.Sprintf("SELECT identifier FROM audits WHERE project_id = '%s' AND {{filters}} ORDER BY identifier", projectID),
+			nil, dialect)
+		require.NoError(t, err)
+		result, err := audit.RunQuery(ctx, conn, q, args...)
+		require.NoError(t, err)
+		assert.Equal(t, []string{"identifier"}, result.Columns)
+		assert.Equal(t, [][]any{{"alice"}, {"bob"}}, result.Rows)
+
+		result, err = audit.RunQuery(ctx, conn, fmt.Sprintf(
+			"SELECT COUNT(*) AS n FROM audits a JOIN audit_summaries s ON s.project_id = a.project_id WHERE a.project_id = '%s' AND a.method = 'DELETE'", projectID))
+		require.NoError(t, err, "DELETE as a value is fine")
+		assert.Len(t, result.Rows, 1)
+
+		for _, q := range []string{
+			"WITH gone AS (DELETE FROM audits RETURNING id) SELECT * FROM gone",
+			"SELECT * FROM audits; DELETE FROM audits",
+			"DELETE FROM audits",
+		} {
+			_, err := audit.RunQuery(ctx, conn, q)
+			assert.Error(t, err, q)
+		}
+		var n int64
+		require.NoError(t, conn.Raw(`SELECT COUNT(*) FROM audits WHERE project_id = ?`, projectID).Scan(&n).Error)
+		assert.Equal(t, int64(2), n, "nothing was deleted")
+
+		if dialect == "sqlite" {
+			// Postgres scopes reads with the bataudit_readonly role, when it
+			// can be provisioned; SQLite always does.
+			for _, q := range []string{"SELECT * FROM users", "SELECT * FROM sqlite_schema"} {
+				_, err := audit.RunQuery(ctx, conn, q)
+				assert.ErrorContains(t, err, "query rejected", q)
+			}
+		}
+
+		// The console's connection goes back to the pool writable.
+		seed(t, conn, projectID, []event{{at: time.Now().UTC(), user: "carol", method: "GET", path: "/a", status: 200}})
+	})
+}
+
+// notifier is an audit.Notifier the test announces events on by hand.
+type notifier struct {
+	subscribed chan func(string)
+}
+
+func (n *notifier) Subscribe(notify func(string)) func() {
+	n.subscribed <- notify
+	return func() {}
+}
+
+func TestLiveTail(t *testing.T) {
+	forEachEngine(t, func(t *testing.T, conn *gorm.DB, projectID string) {
+		now := time.Now().UTC()
+		seed(t, conn, projectID, []event{{at: now, user: "alice", method: "GET", path: "/before", status: 500}})
+		repo := audit.NewRepository(conn)
+		n := &notifier{subscribed: make(chan func(string), 1)}
+		tail := audit.NewTail(repo, n).WithPollInterval(time.Hour)
+
+		pos, err := tail.Start([]string{projectID}, nil)
+		require.NoError(t, err)
+		assert.Equal(t, audit.TailPosition{projectID: 1}, pos, "starts at the head")
+
+		// Stored before Run: delivered by its first catch-up.
+		seed(t, conn, projectID, []event{
+			{at: now, user: "alice", method: "GET", path: "/ok", status: 200},
+			{at: now, user: "alice", method: "GET", path: "/a", status: 500},
+		})
+
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+		type delivered struct {
+			path string
+			seq  int64
+			id   string
+		}
+		got := make(chan delivered, 10)
+		done := make(chan error, 1)
+		go func() {
+			done <- tail.Run(ctx, audit.ListFilters{StatusClass: "5xx"}, pos,
+				func(ev audit.TailEvent, pos audit.TailPosition) error {
+					got <- delivered{ev.Path, ev.ChainSeq, pos.Encode()}
+					return nil
+				},
+				func(audit.TailPosition) error { return nil })
+		}()
+		notify := <-n.subscribed
+
+		first := <-got
+		assert.Equal(t, "/a", first.path)
+		assert.Equal(t, int64(3), first.seq)
+
+		// Stored after: delivered when announced.
+		seed(t, conn, projectID, []event{{at: now, user: "alice", method: "GET", path: "/b", status: 503}})
+		notify("another-project")
+		notify(projectID)
+		select {
+		case second := <-got:
+			assert.Equal(t, "/b", second.path)
+			assert.Equal(t, int64(4), second.seq)
+		case <-time.After(5 * time.Second):
+			t.Fatal("announced event not delivered")
+		}
+		cancel()
+		require.NoError(t, <-done)
+
+		// Resuming after the first event replays the second.
+		from, err := audit.ParseTailPosition(first.id)
+		require.NoError(t, err)
+		pos, err = tail.Start([]string{projectID}, from)
+		require.NoError(t, err)
+		assert.Equal(t, int64(3), pos[projectID])
+		ctx, cancel = context.WithCancel(context.Background())
+		go func() {
+			done <- tail.Run(ctx, audit.ListFilters{StatusClass: "5xx"}, pos,
+				func(ev audit.TailEvent, pos audit.TailPosition) error {
+					got <- delivered{ev.Path, ev.ChainSeq, pos.Encode()}
+					return nil
+				},
+				func(audit.TailPosition) error { return nil })
+		}()
+		<-n.subscribed
+		replayed := <-got
+		assert.Equal(t, "/b", replayed.path)
+		cancel()
+		require.NoError(t, <-done)
+	})
+}
+
+func TestTraces(t *testing.T) {
+	forEachEngine(t, func(t *testing.T, conn *gorm.DB, projectID string) {
+		traceID := strings.ReplaceAll(uuid.New().String(), "-", "")
+		orphanTrace := strings.ReplaceAll(uuid.New().String(), "-", "")
+		now := time.Now().UTC().Truncate(time.Millisecond)
+		repo := audit.NewRepository(conn)
+		for _, a := range []*audit.Audit{
+			{Source: "browser", Path: "/checkout", SpanID: "aaaaaaaaaaaaaaaa", TraceID: traceID, Timestamp: now},
+			{Source: "backend", Path: "/orders", SpanID: "bbbbbbbbbbbbbbbb", ParentSpanID: "aaaaaaaaaaaaaaaa", TraceID: traceID, Timestamp: now.Add(30 * time.Millisecond)},
+			// Its backend never audited the request.
+			{Source: "browser", Path: "/pay", SpanID: "cccccccccccccccc", TraceID: orphanTrace, Timestamp: now},
+		} {
+			a.ID = uuid.New().String()
+			a.Identifier, a.ServiceName, a.Environment = "alice", "api", "production"
+			a.Method, a.StatusCode, a.EventType, a.ProjectID = "GET", 200, "http", projectID
+			require.NoError(t, repo.Create(a))
+		}
+
+		trace, err := audit.NewService(repo).GetTrace(traceID, []string{projectID})
+		require.NoError(t, err)
+		require.Equal(t, 2, trace.EventCount)
+		require.Len(t, trace.Roots, 1)
+		assert.Equal(t, "/checkout", trace.Roots[0].Path)
+		require.Len(t, trace.Roots[0].Children, 1)
+		assert.Equal(t, int64(30), *trace.Roots[0].Children[0].HopMs)
+
+		trace, err = audit.NewService(repo).GetTrace(traceID, []string{})
+		require.NoError(t, err)
+		assert.Zero(t, trace.EventCount, "out of the caller's projects")
+
+		orphans, err := repo.GetOrphans(audit.OrphanFilters{ProjectID: projectID})
+		require.NoError(t, err)
+		require.Len(t, orphans, 1)
+		assert.Equal(t, "/pay", orphans[0].Path)
+		assert.Equal(t, orphanTrace, orphans[0].TraceID)
+
+		verification, err := repo.VerifyChain(context.Background(), projectID, 0, 0)
+		require.NoError(t, err)
+		assert.True(t, verification.Valid, "trace fields are hashed as stored")
+	})
+}
+
+func TestErasureVerification(t *testing.T) {
+	start := time.Now().UTC().Add(-time.Hour).Truncate(time.Second)
+	_, key, err := ed25519.GenerateKey(rand.Reader)
+	require.NoError(t, err)
+	forEachEngine(t, func(t *testing.T, conn *gorm.DB, projectID string) {
+		seed(t, conn, projectID, []event{
+			{at: start, user: "alice", method: "GET", path: "/a", status: 200, ms: 10},
+			{at: start.Add(time.Minute), user: "bob", method: "GET", path: "/b", status: 200, ms: 10},
+		})
+		_, err := erasure.NewManager(conn).Request(projectID, erasure.SubjectIdentifier, "alice", erasure.ModePseudonymize, "", "owner@example.com")
+		require.NoError(t, err)
+		n, err := erasure.NewRunner(conn, integrity.NewSigner(key)).RunPending(context.Background())
+		require.NoError(t, err)
+		require.Equal(t, 1, n)
+
+		repo := audit.NewRepository(conn)
+		verification, err := repo.VerifyChain(context.Background(), projectID, 0, 0)
+		require.NoError(t, err)
+		assert.True(t, verification.Valid, "%+v", verification.Break)
+		assert.Equal(t, int64(1), verification.Erased)
+
+		// Marking an event erased does not let its content change.
+		var erasedAt time.Time
+		require.NoError(t, conn.Raw(`SELECT completed_at FROM erasure_requests WHERE project_id = ?`, projectID).Scan(&erasedAt).Error)
+		require.NoError(t, conn.Exec(`UPDATE audits SET erased_at = ?, path = '/forged' WHERE project_id = ? AND identifier = 'bob'`,
+			erasedAt, projectID).Error)
+		verification, err = repo.VerifyChain(context.Background(), projectID, 0, 0)
+		require.NoError(t, err)
+		assert.False(t, verification.Valid)
+		if assert.NotNil(t, verification.Break) {
+			assert.Equal(t, audit.BreakErasure, verification.Break.Reason)
+		}
+	})
+}
+
+func TestErasureRerun(t *testing.T) {
+	start := time.Now().UTC().Add(-time.Hour).Truncate(time.Second)
+	_, key, err := ed25519.GenerateKey(rand.Reader)
+	require.NoError(t, err)
+	forEachEngine(t, func(t *testing.T, conn *gorm.DB, projectID string) {
+		seed(t, conn, projectID, []event{
+			{at: start, user: "alice", method: "GET", path: "/a", status: 200, ms: 10},
+			{at: start.Add(time.Minute), user: "bob", method: "GET", path: "/b", status: 200, ms: 10},
+		})
+		req, err := erasure.NewManager(conn).Request(projectID, erasure.SubjectIdentifier, "alice", erasure.ModePseudonymize, "", "owner@example.com")
+		require.NoError(t, err)
+
+		// A Worker that crashed mid-run leaves the request running; it is
+		// claimed again once stale.
+		require.NoError(t, conn.Exec(`UPDATE erasure_requests SET status = ?, started_at = ? WHERE id = ?`,
+			erasure.StatusRunning, time.Now().UTC().Add(-2*time.Hour), req.ID).Error)
+		n, err := erasure.NewRunner(conn, integrity.NewSigner(key)).RunPending(context.Background())
+		require.NoError(t, err)
+		require.Equal(t, 1, n)
+
+		var mismatched int64
+		require.NoError(t, conn.Raw(`
+			SELECT COUNT(*) FROM audits a JOIN erasure_requests r ON r.project_id = a.project_id
+			WHERE a.project_id = ? AND a.erased_at IS NOT NULL AND a.erased_at <> r.completed_at`, projectID).
+			Scan(&mismatched).Error)
+		assert.Zero(t, mismatched, "events are erased at the completion time")
+
+		verification, err := audit.NewRepository(conn).VerifyChain(context.Background(), projectID, 0, 0)
+		require.NoError(t, err)
+		assert.True(t, verification.Valid, "%+v", verification.Break)
+		assert.Equal(t, int64(1), verification.Erased)
+	})
+}
+
+func TestErasureSessionsByEmail(t *testing.T) {
+	start := time.Now().UTC().Add(-time.Hour).Truncate(time.Second)
+	_, key, err := ed25519.GenerateKey(rand.Reader)
+	require.NoError(t, err)
+	forEachEngine(t, func(t *testing.T, conn *gorm.DB, projectID string) {
+		seed(t, conn, projectID, []event{
+			{at: start, user: "alice", method: "GET", path: "/a", status: 200, ms: 10, email: "alice@example.com"},
+			{at: start.Add(time.Minute), user: "bob", method: "GET", path: "/b", status: 200, ms: 10, email: "bob@example.com"},
+		})
+		req, err := erasure.NewManager(conn).Request(projectID, erasure.SubjectEmail, "Alice@example.com", erasure.ModePseudonymize, "", "owner@example.com")
+		require.NoError(t, err)
+		n, err := erasure.NewRunner(conn, integrity.NewSigner(key)).RunPending(context.Background())
+		require.NoError(t, err)
+		require.Equal(t, 1, n)
+
+		var identifiers []string
+		require.NoError(t, conn.Raw(`SELECT identifier FROM audit_sessions WHERE project_id = ?`, projectID).
+			Scan(&identifiers).Error)
+		assert.NotContains(t, identifiers, "alice", "the subject's sessions lose their identifier too")
+		assert.Contains(t, identifiers, req.Pseudonym)
+		assert.Contains(t, identifiers, "bob")
+	})
+}
+
+func TestPartitionIDKey(t *testing.T) {
+	forEachEngine(t, func(t *testing.T, conn *gorm.DB, projectID string) {
+		mgr := partition.NewManager(conn, partition.Config{Interval: partition.Monthly, Premake: 1, Expired: partition.Drop})
+		if !mgr.Enabled() {
+			t.Skip("partitioning needs postgres")
+		}
+		require.NoError(t, mgr.Maintain(context.Background()))
+
+		var def string
+		require.NoError(t, conn.Raw(`SELECT indexdef FROM pg_indexes WHERE tablename = 'audits' AND indexname = 'audits_id_timestamp_key'`).Scan(&def).Error)
+		assert.Contains(t, def, "UNIQUE INDEX", "the partitioned parent keeps id unique together with the partition key")
+
+		var partitions, covered int64
+		require.NoError(t, conn.Raw(`SELECT COUNT(*) FROM pg_inherits WHERE inhparent = 'audits'::regclass`).Scan(&partitions).Error)
+		require.NoError(t, conn.Raw(`
+			SELECT COUNT(*) FROM pg_inherits
+			WHERE inhparent = 'audits_id_timestamp_key'::regclass`).Scan(&covered).Error)
+		assert.Equal(t, partitions, covered, "every partition has its copy of the index attached")
+	})
+}
+
+func TestPartitionDrop(t *testing.T) {
+	at := time.Now().UTC().Add(-time.Hour).Truncate(time.Second)
+	forEachEngine(t, func(t *testing.T, conn *gorm.DB, projectID string) {
+		mgr := partition.NewManager(conn, partition.Config{Interval: partition.Monthly, Premake: 1, Expired: partition.Drop})
+		if !mgr.Enabled() {
+			t.Skip("partitioning needs postgres")
+		}
+		require.NoError(t, mgr.Maintain(context.Background()))
+		seed(t, conn, projectID, []event{
+			{at: at, user: "alice", method: "GET", path: "/a", status: 200, ms: 10},
+			{at: at, user: "alice", method: "GET", path: "/alert", status: 200, ms: 10, kind: "system.alert"},
+			{at: at, user: "bob", method: "GET", path: "/held", status: 200, ms: 10},
+		})
+		require.NoError(t, conn.Exec(`INSERT INTO legal_holds (id, project_id, identifier, tenant_id, reason, created_by, created_at) VALUES (?, ?, 'bob', '', 'case', 'test', ?)`,
+			uuid.New().String(), projectID, time.Now().UTC()).Error)
+		t.Cleanup(func() { conn.Exec(`DELETE FROM legal_holds WHERE project_id = ?`, projectID) })
+
+		var part string
+		require.NoError(t, conn.Raw(`SELECT tableoid::regclass::text FROM audits WHERE project_id = ? AND path = '/a'`, projectID).Scan(&part).Error)
+
+		// Expires the partition holding the events, but none after it.
+		_, err := mgr.DropExpired(context.Background(), time.Now().AddDate(0, 2, 0))
+		require.NoError(t, err)
+
+		var gone bool
+		require.NoError(t, conn.Raw(`SELECT to_regclass(?) IS NULL`, part).Scan(&gone).Error)
+		assert.True(t, gone, "the partition is dropped even though some of its rows stay")
+
+		var kept []struct {
+			Path      string
+			Partition string
+		}
+		require.NoError(t, conn.Raw(`SELECT path, tableoid::regclass::text AS partition FROM audits WHERE project_id = ? ORDER BY path`, projectID).
+			Scan(&kept).Error)
+		require.Len(t, kept, 2, "the alert, which no policy names, and the held event stay")
+		for i, path := range []string{"/alert", "/held"} {
+			assert.Equal(t, path, kept[i].Path)
+			assert.Equal(t, "audits_default", kept[i].Partition)
+		}
+
+		var checkpoints int64
+		require.NoError(t, conn.Raw(`SELECT COALESCE(SUM(row_count), 0) FROM audit_chain_checkpoints WHERE project_id = ? AND reason = ?`,
+			projectID, audit.CheckpointPartitionDrop).Scan(&checkpoints).Error)
+		assert.EqualValues(t, 1, checkpoints, "only the dropped row leaves a checkpoint")
+	})
+}
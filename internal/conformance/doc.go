@@ -0,0 +1,5 @@
+// Package conformance holds the test suite every supported database engine
+// must pass: the Reader's queries (sessions, stats, insights, wallboard,
+// tiering history and the SQL Query Console) run against SQLite, and against
+// Postgres when DB_DRIVER=postgres and the DB_* variables point at a server.
+package conformance
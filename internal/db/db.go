@@ -10,9 +10,12 @@ import (
 	"gorm.io/gorm"
 	_ "modernc.org/sqlite"
 
+	// Registers the SQL functions Reader queries use on SQLite.
+	_ "github.com/joaovrmoraes/bataudit/internal/dialect"
+
 	"github.com/golang-migrate/migrate/v4"
 	_ "github.com/golang-migrate/migrate/v4/database/postgres"
-	_ "github.com/golang-migrate/migrate/v4/database/sqlite3"
+	_ "github.com/golang-migrate/migrate/v4/database/sqlite"
 	_ "github.com/golang-migrate/migrate/v4/source/file"
 )
 
@@ -24,7 +27,7 @@ func RunMigrations(config *Database) error {
 			config.User, config.Password, config.Host, config.Port, config.Name)
 		migrationsPath = "file://internal/db/migrations"
 	case "sqlite":
-		dsn = "sqlite3://" + config.SQLitePath
+		dsn = "sqlite://" + config.SQLitePath
 		migrationsPath = "file://internal/db/migrations/sqlite"
 	default:
 		return fmt.Errorf("unsupported driver: %s", config.Driver)
@@ -67,7 +70,12 @@ func Init() (*gorm.DB, error) {
 			return nil, fmt.Errorf("failed to connect to postgres: %w", err)
 		}
 	case "sqlite":
-		db, err = gorm.Open(sqlite.Open("file:"+config.SQLitePath+"?_pragma=foreign_keys(1)"), &gorm.Config{})
+		// modernc.org/sqlite: pure Go, so CGO_ENABLED=0 builds work, and
+		// built with FTS5 (full-text search).
+		db, err = gorm.Open(sqlite.New(sqlite.Config{
+			DriverName: "sqlite",
+			DSN:        "file:" + config.SQLitePath + "?_pragma=foreign_keys(1)",
+		}), &gorm.Config{})
 		if err != nil {
 			return nil, fmt.Errorf("failed to connect to sqlite: %w", err)
 		}
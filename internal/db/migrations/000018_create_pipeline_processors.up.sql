@@ -0,0 +1,17 @@
+-- Per-project processing pipeline: an ordered chain of processors the worker
+-- runs on every event between dequeue and insert.
+CREATE TABLE IF NOT EXISTS pipeline_processors (
+    id         UUID         PRIMARY KEY DEFAULT gen_random_uuid(),
+    project_id VARCHAR(64)  NOT NULL REFERENCES projects(id) ON DELETE CASCADE,
+    position   INT          NOT NULL DEFAULT 0,
+    name       VARCHAR(100) NOT NULL,
+    kind       VARCHAR(64)  NOT NULL,                    -- registered processor kind (enricher, drop_filter, ...)
+    config     JSONB        NOT NULL DEFAULT '{}',
+    timeout_ms INT          NOT NULL DEFAULT 1000,
+    on_failure VARCHAR(16)  NOT NULL DEFAULT 'skip' CHECK (on_failure IN ('skip', 'fail', 'dead_letter')),
+    active     BOOLEAN      NOT NULL DEFAULT TRUE,
+    created_at TIMESTAMPTZ  NOT NULL DEFAULT NOW(),
+    updated_at TIMESTAMPTZ  NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX IF NOT EXISTS idx_pipeline_processors_project ON pipeline_processors (project_id, position);
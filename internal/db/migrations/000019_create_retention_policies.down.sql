@@ -0,0 +1,2 @@
+DROP INDEX IF EXISTS idx_retention_policies_scope;
+DROP TABLE IF EXISTS retention_policies;
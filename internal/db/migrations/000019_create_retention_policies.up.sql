@@ -0,0 +1,14 @@
+-- Per-project retention overrides for the tiering job. The most specific
+-- policy wins: environment+event_type, environment, event_type, project-wide.
+CREATE TABLE IF NOT EXISTS retention_policies (
+    id          UUID         PRIMARY KEY DEFAULT gen_random_uuid(),
+    project_id  VARCHAR(64)  NOT NULL REFERENCES projects(id) ON DELETE CASCADE,
+    environment VARCHAR(64)  NOT NULL DEFAULT '',        -- '' = every environment
+    event_type  VARCHAR(32)  NOT NULL DEFAULT '',        -- '' = HTTP traffic
+    raw_days    INT          NOT NULL CHECK (raw_days > 0),
+    hourly_days INT          CHECK (hourly_days > 0),    -- project-wide policies only; NULL = instance default
+    created_at  TIMESTAMPTZ  NOT NULL DEFAULT NOW(),
+    updated_at  TIMESTAMPTZ  NOT NULL DEFAULT NOW()
+);
+
+CREATE UNIQUE INDEX IF NOT EXISTS idx_retention_policies_scope ON retention_policies (project_id, environment, event_type);
@@ -0,0 +1,41 @@
+-- Archived events restored for investigation. audits_rehydrated holds copies
+-- of archive rows, never the source of truth; they are deleted when their
+-- rehydration expires. Columns mirror audits: a migration that adds a column
+-- to audits must add it here too.
+CREATE TABLE IF NOT EXISTS rehydrations (
+    id           UUID         PRIMARY KEY DEFAULT gen_random_uuid(),
+    project_id   VARCHAR(64)  NOT NULL REFERENCES projects(id) ON DELETE CASCADE,
+    from_time    TIMESTAMP    NOT NULL,
+    to_time      TIMESTAMP    NOT NULL,
+    status       VARCHAR(16)  NOT NULL DEFAULT 'pending' CHECK (status IN ('pending', 'running', 'ready', 'failed', 'expired')),
+    files        INT          NOT NULL DEFAULT 0,
+    row_count    BIGINT       NOT NULL DEFAULT 0,
+    error        TEXT         NOT NULL DEFAULT '',
+    requested_by VARCHAR(255) NOT NULL DEFAULT '',
+    expires_at   TIMESTAMPTZ  NOT NULL,
+    created_at   TIMESTAMPTZ  NOT NULL DEFAULT NOW(),
+    completed_at TIMESTAMPTZ
+);
+
+CREATE INDEX IF NOT EXISTS idx_rehydrations_project ON rehydrations (project_id, created_at DESC);
+CREATE INDEX IF NOT EXISTS idx_rehydrations_expires ON rehydrations (expires_at) WHERE status <> 'expired';
+
+CREATE TABLE IF NOT EXISTS audits_rehydrated (LIKE audits INCLUDING DEFAULTS);
+ALTER TABLE audits_rehydrated
+    ADD COLUMN rehydration_id UUID        NOT NULL REFERENCES rehydrations(id) ON DELETE CASCADE,
+    ADD COLUMN expires_at     TIMESTAMPTZ NOT NULL,
+    ADD PRIMARY KEY (rehydration_id, id);
+
+CREATE INDEX IF NOT EXISTS idx_audits_rehydrated_project_timestamp ON audits_rehydrated (project_id, timestamp DESC);
+CREATE INDEX IF NOT EXISTS idx_audits_rehydrated_id ON audits_rehydrated (id);
+
+-- Readable from the SQL Query Console (see 000016).
+DO $$
+BEGIN
+    IF EXISTS (SELECT 1 FROM pg_roles WHERE rolname = 'bataudit_readonly') THEN
+        GRANT SELECT ON audits_rehydrated TO bataudit_readonly;
+    END IF;
+EXCEPTION
+    WHEN insufficient_privilege THEN
+        RAISE NOTICE 'bataudit_readonly: insufficient privilege, skipping audits_rehydrated grant';
+END$$;
@@ -0,0 +1,13 @@
+DROP TABLE IF EXISTS audit_chain_checkpoints;
+DROP TABLE IF EXISTS audit_chain_heads;
+
+ALTER TABLE audits_rehydrated
+    DROP COLUMN IF EXISTS hash,
+    DROP COLUMN IF EXISTS prev_hash,
+    DROP COLUMN IF EXISTS chain_seq;
+
+DROP INDEX IF EXISTS idx_audits_chain;
+ALTER TABLE audits
+    DROP COLUMN IF EXISTS hash,
+    DROP COLUMN IF EXISTS prev_hash,
+    DROP COLUMN IF EXISTS chain_seq;
@@ -0,0 +1,41 @@
+-- Tamper-evident hash chain. The Worker sets chain_seq, prev_hash and hash on
+-- every event it stores; each hash covers the event's canonical content and the
+-- previous event's hash in the same project. Rows from before this migration
+-- stay NULL and are outside the chain.
+ALTER TABLE audits
+    ADD COLUMN IF NOT EXISTS chain_seq BIGINT,
+    ADD COLUMN IF NOT EXISTS prev_hash VARCHAR(64),
+    ADD COLUMN IF NOT EXISTS hash      VARCHAR(64);
+
+CREATE INDEX IF NOT EXISTS idx_audits_chain ON audits (project_id, chain_seq) WHERE chain_seq IS NOT NULL;
+
+ALTER TABLE audits_rehydrated
+    ADD COLUMN IF NOT EXISTS chain_seq BIGINT,
+    ADD COLUMN IF NOT EXISTS prev_hash VARCHAR(64),
+    ADD COLUMN IF NOT EXISTS hash      VARCHAR(64);
+
+-- Last link of each project's chain ('' = events without a project). Locked
+-- while an event is inserted, so links are assigned one at a time.
+CREATE TABLE IF NOT EXISTS audit_chain_heads (
+    project_id VARCHAR(64) PRIMARY KEY,
+    seq        BIGINT      NOT NULL,
+    hash       VARCHAR(64) NOT NULL,
+    updated_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+-- Runs of chained events removed by tiering, archiving or partition drops.
+-- Verification steps over a run from prev_hash to last_hash instead of
+-- reporting the events as missing.
+CREATE TABLE IF NOT EXISTS audit_chain_checkpoints (
+    id         BIGSERIAL   PRIMARY KEY,
+    project_id VARCHAR(64) NOT NULL,
+    first_seq  BIGINT      NOT NULL,
+    last_seq   BIGINT      NOT NULL,
+    prev_hash  VARCHAR(64) NOT NULL,
+    last_hash  VARCHAR(64) NOT NULL,
+    row_count  BIGINT      NOT NULL,
+    reason     VARCHAR(32) NOT NULL,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX IF NOT EXISTS idx_audit_chain_checkpoints_project ON audit_chain_checkpoints (project_id, first_seq);
@@ -0,0 +1,20 @@
+-- Signed Merkle checkpoints over each project's hash chain (see 000021).
+-- leaves holds the signed leaves (8-byte chain_seq + 32-byte hash each), so
+-- inclusion proofs can still be built after tiering removes the events.
+CREATE TABLE IF NOT EXISTS integrity_checkpoints (
+    id         BIGSERIAL   PRIMARY KEY,
+    project_id VARCHAR(64) NOT NULL,
+    first_seq  BIGINT      NOT NULL,
+    last_seq   BIGINT      NOT NULL,
+    leaf_count INT         NOT NULL,
+    root       VARCHAR(64) NOT NULL,
+    last_hash  VARCHAR(64) NOT NULL,
+    leaves     BYTEA       NOT NULL,
+    key_id     VARCHAR(16) NOT NULL,
+    public_key TEXT        NOT NULL,
+    signature  TEXT        NOT NULL,
+    created_at TIMESTAMPTZ NOT NULL,
+    UNIQUE (project_id, first_seq)
+);
+
+CREATE INDEX IF NOT EXISTS idx_integrity_checkpoints_range ON integrity_checkpoints (project_id, last_seq);
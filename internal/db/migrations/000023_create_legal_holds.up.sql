@@ -0,0 +1,32 @@
+-- Legal holds stop tiering, archiving and partition drops from removing the
+-- raw events they cover. Empty identifier/tenant_id and NULL from/to match
+-- anything. Holds are never deleted: releasing one sets released_at.
+CREATE TABLE IF NOT EXISTS legal_holds (
+    id             UUID         PRIMARY KEY DEFAULT gen_random_uuid(),
+    project_id     VARCHAR(64)  NOT NULL,
+    identifier     VARCHAR(128) NOT NULL DEFAULT '',
+    tenant_id      VARCHAR(100) NOT NULL DEFAULT '',
+    from_time      TIMESTAMP,
+    to_time        TIMESTAMP,
+    reason         TEXT         NOT NULL,
+    created_by     VARCHAR(255) NOT NULL,
+    created_at     TIMESTAMPTZ  NOT NULL DEFAULT NOW(),
+    released_by    VARCHAR(255) NOT NULL DEFAULT '',
+    release_reason TEXT         NOT NULL DEFAULT '',
+    released_at    TIMESTAMPTZ
+);
+
+CREATE INDEX IF NOT EXISTS idx_legal_holds_active ON legal_holds (project_id) WHERE released_at IS NULL;
+
+-- Append-only record of every hold action.
+CREATE TABLE IF NOT EXISTS legal_hold_events (
+    id         BIGSERIAL    PRIMARY KEY,
+    hold_id    UUID         NOT NULL REFERENCES legal_holds(id),
+    project_id VARCHAR(64)  NOT NULL,
+    action     VARCHAR(16)  NOT NULL CHECK (action IN ('created', 'released')),
+    actor      VARCHAR(255) NOT NULL,
+    reason     TEXT         NOT NULL,
+    created_at TIMESTAMPTZ  NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX IF NOT EXISTS idx_legal_hold_events_project ON legal_hold_events (project_id, created_at DESC);
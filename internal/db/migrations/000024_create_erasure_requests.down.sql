@@ -0,0 +1,3 @@
+DROP TABLE IF EXISTS erasure_requests;
+ALTER TABLE audits_rehydrated DROP COLUMN IF EXISTS erased_at;
+ALTER TABLE audits DROP COLUMN IF EXISTS erased_at;
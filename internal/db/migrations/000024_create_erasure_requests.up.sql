@@ -0,0 +1,36 @@
+-- Data-subject erasure. erased_at marks events whose personal data was
+-- pseudonymized or removed; their stored hash still covers the original
+-- content, so chain verification checks their links but not their content.
+ALTER TABLE audits ADD COLUMN IF NOT EXISTS erased_at TIMESTAMPTZ;
+ALTER TABLE audits_rehydrated ADD COLUMN IF NOT EXISTS erased_at TIMESTAMPTZ;
+
+-- subject is the identifier or email as submitted; it is cleared once the
+-- request completes. subject_hash is SHA-256(salt || subject), which lets
+-- restores from the archive recognise the subject's events afterwards.
+CREATE TABLE IF NOT EXISTS erasure_requests (
+    id               UUID         PRIMARY KEY DEFAULT gen_random_uuid(),
+    project_id       VARCHAR(64)  NOT NULL,
+    subject_type     VARCHAR(16)  NOT NULL CHECK (subject_type IN ('identifier', 'email')),
+    subject          TEXT         NOT NULL DEFAULT '',
+    salt             VARCHAR(64)  NOT NULL,
+    subject_hash     VARCHAR(64)  NOT NULL,
+    pseudonym        VARCHAR(64)  NOT NULL,
+    mode             VARCHAR(16)  NOT NULL CHECK (mode IN ('pseudonymize', 'remove')),
+    reason           TEXT         NOT NULL DEFAULT '',
+    status           VARCHAR(16)  NOT NULL DEFAULT 'pending' CHECK (status IN ('pending', 'running', 'completed', 'failed')),
+    events           BIGINT       NOT NULL DEFAULT 0,
+    restored_events  BIGINT       NOT NULL DEFAULT 0,
+    held_events      BIGINT       NOT NULL DEFAULT 0,
+    error            TEXT         NOT NULL DEFAULT '',
+    requested_by     VARCHAR(255) NOT NULL,
+    request_event_id VARCHAR(64)  NOT NULL DEFAULT '',
+    key_id           VARCHAR(16)  NOT NULL DEFAULT '',
+    public_key       TEXT         NOT NULL DEFAULT '',
+    signature        TEXT         NOT NULL DEFAULT '',
+    created_at       TIMESTAMPTZ  NOT NULL DEFAULT NOW(),
+    started_at       TIMESTAMPTZ,
+    completed_at     TIMESTAMPTZ
+);
+
+CREATE INDEX IF NOT EXISTS idx_erasure_requests_project ON erasure_requests (project_id, created_at DESC);
+CREATE INDEX IF NOT EXISTS idx_erasure_requests_open ON erasure_requests (created_at) WHERE status IN ('pending', 'running');
@@ -0,0 +1,18 @@
+-- Field-level encryption. Data keys are per project and stored wrapped by a
+-- master key that never reaches the database; retired keys are kept because
+-- archive files still hold values sealed with them.
+CREATE TABLE IF NOT EXISTS field_data_keys (
+    id             VARCHAR(32)  PRIMARY KEY,
+    project_id     VARCHAR(64)  NOT NULL DEFAULT '',
+    status         VARCHAR(16)  NOT NULL DEFAULT 'active' CHECK (status IN ('active', 'retired')),
+    master_key_id  VARCHAR(32)  NOT NULL,
+    wrapped        TEXT         NOT NULL,
+    created_at     TIMESTAMPTZ  NOT NULL DEFAULT NOW(),
+    retired_at     TIMESTAMPTZ,
+    reencrypted_at TIMESTAMPTZ
+);
+
+CREATE UNIQUE INDEX IF NOT EXISTS idx_field_data_keys_active ON field_data_keys (project_id) WHERE status = 'active';
+
+-- Users allowed to see decrypted fields in event details.
+ALTER TABLE users ADD COLUMN IF NOT EXISTS can_decrypt BOOLEAN NOT NULL DEFAULT FALSE;
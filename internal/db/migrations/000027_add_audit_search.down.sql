@@ -0,0 +1,2 @@
+DROP INDEX IF EXISTS idx_audits_rehydrated_search;
+DROP INDEX IF EXISTS idx_audits_search;
@@ -0,0 +1,6 @@
+-- Full-text search (GET /v1/audit?q=). The indexed expression must stay
+-- identical to searchDocument in internal/audit/search.go, or searches
+-- cannot use the index.
+CREATE INDEX IF NOT EXISTS idx_audits_search ON audits USING GIN ((to_tsvector('simple', translate(coalesce(path, ''), '/', ' ') || ' ' || coalesce(error_message, '') || ' ' || coalesce(identifier, '') || ' ' || coalesce(user_email, '') || ' ' || coalesce(user_name, '')) || jsonb_to_tsvector('simple', CASE WHEN request_body -> 'bataudit_enc' IS NULL THEN coalesce(request_body, 'null') ELSE 'null' END, '["string", "numeric"]') || jsonb_to_tsvector('simple', CASE WHEN response_body -> 'bataudit_enc' IS NULL THEN coalesce(response_body, 'null') ELSE 'null' END, '["string", "numeric"]')));
+
+CREATE INDEX IF NOT EXISTS idx_audits_rehydrated_search ON audits_rehydrated USING GIN ((to_tsvector('simple', translate(coalesce(path, ''), '/', ' ') || ' ' || coalesce(error_message, '') || ' ' || coalesce(identifier, '') || ' ' || coalesce(user_email, '') || ' ' || coalesce(user_name, '')) || jsonb_to_tsvector('simple', CASE WHEN request_body -> 'bataudit_enc' IS NULL THEN coalesce(request_body, 'null') ELSE 'null' END, '["string", "numeric"]') || jsonb_to_tsvector('simple', CASE WHEN response_body -> 'bataudit_enc' IS NULL THEN coalesce(response_body, 'null') ELSE 'null' END, '["string", "numeric"]')));
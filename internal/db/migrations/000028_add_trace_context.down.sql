@@ -0,0 +1,7 @@
+DROP INDEX IF EXISTS idx_audits_trace_id;
+ALTER TABLE audits_rehydrated DROP COLUMN IF EXISTS parent_span_id;
+ALTER TABLE audits_rehydrated DROP COLUMN IF EXISTS span_id;
+ALTER TABLE audits_rehydrated DROP COLUMN IF EXISTS trace_id;
+ALTER TABLE audits DROP COLUMN IF EXISTS parent_span_id;
+ALTER TABLE audits DROP COLUMN IF EXISTS span_id;
+ALTER TABLE audits DROP COLUMN IF EXISTS trace_id;
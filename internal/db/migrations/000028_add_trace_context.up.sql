@@ -0,0 +1,10 @@
+-- W3C trace context. Events of one user action share a trace_id across
+-- services; parent_span_id is the span that called the event's service.
+ALTER TABLE audits ADD COLUMN IF NOT EXISTS trace_id VARCHAR(32);
+ALTER TABLE audits ADD COLUMN IF NOT EXISTS span_id VARCHAR(16);
+ALTER TABLE audits ADD COLUMN IF NOT EXISTS parent_span_id VARCHAR(16);
+ALTER TABLE audits_rehydrated ADD COLUMN IF NOT EXISTS trace_id VARCHAR(32);
+ALTER TABLE audits_rehydrated ADD COLUMN IF NOT EXISTS span_id VARCHAR(16);
+ALTER TABLE audits_rehydrated ADD COLUMN IF NOT EXISTS parent_span_id VARCHAR(16);
+
+CREATE INDEX IF NOT EXISTS idx_audits_trace_id ON audits (trace_id) WHERE trace_id IS NOT NULL;
@@ -0,0 +1,33 @@
+-- Latency histograms per route, written by tiering next to audit_summaries.
+-- buckets holds the counts per latency.Bounds bucket as a JSON array.
+CREATE TABLE IF NOT EXISTS audit_latency_sketches (
+    id           UUID         PRIMARY KEY DEFAULT gen_random_uuid(),
+    period_start TIMESTAMPTZ  NOT NULL,
+    period_type  VARCHAR(4)   NOT NULL CHECK (period_type IN ('hour', 'day')),
+    project_id   TEXT         NOT NULL,
+    service_name VARCHAR(100) NOT NULL,
+    method       VARCHAR(8)   NOT NULL,
+    path         VARCHAR(255) NOT NULL,
+    event_count  BIGINT       NOT NULL DEFAULT 0,
+    sum_ms       BIGINT       NOT NULL DEFAULT 0,
+    max_ms       BIGINT       NOT NULL DEFAULT 0,
+    buckets      TEXT         NOT NULL,
+    created_at   TIMESTAMPTZ  NOT NULL DEFAULT NOW()
+);
+
+CREATE UNIQUE INDEX IF NOT EXISTS idx_audit_latency_sketches_unique
+    ON audit_latency_sketches (period_start, period_type, project_id, service_name, method, path);
+
+CREATE INDEX IF NOT EXISTS idx_audit_latency_sketches_lookup
+    ON audit_latency_sketches (project_id, period_type, period_start DESC);
+
+-- Readable from the SQL Query Console (see 000016).
+DO $$
+BEGIN
+    IF EXISTS (SELECT 1 FROM pg_roles WHERE rolname = 'bataudit_readonly') THEN
+        GRANT SELECT ON audit_latency_sketches TO bataudit_readonly;
+    END IF;
+EXCEPTION
+    WHEN insufficient_privilege THEN
+        RAISE NOTICE 'bataudit_readonly: insufficient privilege, skipping audit_latency_sketches grant';
+END$$;
@@ -0,0 +1,74 @@
+-- Sessions maintained by the Worker as events are stored, so listing them
+-- does not scan raw events and they outlive tiering. An event with a
+-- session_id belongs to that explicit session; any other event to the
+-- derived session of its identifier and service, which ends after the
+-- project's inactivity timeout (session_settings, default 30 minutes).
+CREATE TABLE IF NOT EXISTS audit_sessions (
+    id                  UUID         PRIMARY KEY DEFAULT gen_random_uuid(),
+    project_id          VARCHAR(64)  NOT NULL,               -- '' = events without a project
+    session_id          VARCHAR(100) NOT NULL DEFAULT '',    -- '' = derived session
+    identifier          VARCHAR(128) NOT NULL DEFAULT '',
+    service_name        VARCHAR(128) NOT NULL DEFAULT '',
+    started_at          TIMESTAMPTZ  NOT NULL,
+    ended_at            TIMESTAMPTZ  NOT NULL,
+    event_count         BIGINT       NOT NULL DEFAULT 0,
+    error_count         BIGINT       NOT NULL DEFAULT 0,    -- status_code >= 400
+    total_response_time BIGINT       NOT NULL DEFAULT 0,    -- ms
+    created_at          TIMESTAMPTZ  NOT NULL DEFAULT NOW(),
+    updated_at          TIMESTAMPTZ  NOT NULL DEFAULT NOW()
+);
+
+CREATE UNIQUE INDEX IF NOT EXISTS idx_audit_sessions_explicit
+    ON audit_sessions (project_id, session_id) WHERE session_id != '';
+
+CREATE INDEX IF NOT EXISTS idx_audit_sessions_derived
+    ON audit_sessions (project_id, identifier, service_name, ended_at) WHERE session_id = '';
+
+CREATE INDEX IF NOT EXISTS idx_audit_sessions_start ON audit_sessions (project_id, started_at DESC, id DESC);
+
+-- Per-project inactivity timeout of derived sessions.
+CREATE TABLE IF NOT EXISTS session_settings (
+    project_id                 VARCHAR(64) PRIMARY KEY REFERENCES projects(id) ON DELETE CASCADE,
+    inactivity_timeout_seconds INT         NOT NULL CHECK (inactivity_timeout_seconds > 0),
+    updated_at                 TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+-- Sessions of the events stored so far.
+INSERT INTO audit_sessions (project_id, session_id, identifier, service_name, started_at, ended_at, event_count, error_count, total_response_time)
+SELECT COALESCE(project_id, ''), session_id, MIN(COALESCE(identifier, '')), MIN(COALESCE(service_name, '')),
+       MIN(timestamp), MAX(timestamp), COUNT(*),
+       COUNT(CASE WHEN status_code >= 400 THEN 1 END), COALESCE(SUM(response_time), 0)
+FROM audits
+WHERE session_id IS NOT NULL AND session_id != ''
+GROUP BY COALESCE(project_id, ''), session_id;
+
+INSERT INTO audit_sessions (project_id, identifier, service_name, started_at, ended_at, event_count, error_count, total_response_time)
+SELECT project_key, identifier, service_name,
+       MIN(timestamp), MAX(timestamp), COUNT(*),
+       COUNT(CASE WHEN status_code >= 400 THEN 1 END), COALESCE(SUM(response_time), 0)
+FROM (
+    SELECT project_key, identifier, service_name, timestamp, status_code, response_time,
+           SUM(is_new) OVER (PARTITION BY project_key, identifier, service_name ORDER BY timestamp) AS n
+    FROM (
+        SELECT COALESCE(project_id, '') AS project_key, COALESCE(identifier, '') AS identifier,
+               COALESCE(service_name, '') AS service_name, timestamp, status_code, response_time,
+               CASE WHEN EXTRACT(EPOCH FROM (timestamp - LAG(timestamp) OVER (
+                        PARTITION BY COALESCE(project_id, ''), COALESCE(identifier, ''), COALESCE(service_name, '')
+                        ORDER BY timestamp))) <= 1800
+                    THEN 0 ELSE 1 END AS is_new
+        FROM audits
+        WHERE session_id IS NULL OR session_id = ''
+    ) starts
+) grouped
+GROUP BY project_key, identifier, service_name, n;
+
+-- Readable from the SQL Query Console (see 000016).
+DO $$
+BEGIN
+    IF EXISTS (SELECT 1 FROM pg_roles WHERE rolname = 'bataudit_readonly') THEN
+        GRANT SELECT ON audit_sessions TO bataudit_readonly;
+    END IF;
+EXCEPTION
+    WHEN insufficient_privilege THEN
+        RAISE NOTICE 'bataudit_readonly: insufficient privilege, skipping audit_sessions grant';
+END$$;
@@ -0,0 +1,2 @@
+DROP INDEX IF EXISTS idx_pipeline_processors_project;
+DROP TABLE IF EXISTS pipeline_processors;
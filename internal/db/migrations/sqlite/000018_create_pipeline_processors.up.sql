@@ -0,0 +1,15 @@
+CREATE TABLE IF NOT EXISTS pipeline_processors (
+    id         TEXT         PRIMARY KEY,
+    project_id VARCHAR(64)  NOT NULL REFERENCES projects(id) ON DELETE CASCADE,
+    position   INT          NOT NULL DEFAULT 0,
+    name       VARCHAR(100) NOT NULL,
+    kind       VARCHAR(64)  NOT NULL,
+    config     TEXT         NOT NULL DEFAULT '{}',
+    timeout_ms INT          NOT NULL DEFAULT 1000,
+    on_failure VARCHAR(16)  NOT NULL DEFAULT 'skip' CHECK (on_failure IN ('skip', 'fail', 'dead_letter')),
+    active     BOOLEAN      NOT NULL DEFAULT TRUE,
+    created_at DATETIME     NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    updated_at DATETIME     NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX IF NOT EXISTS idx_pipeline_processors_project ON pipeline_processors (project_id, position);
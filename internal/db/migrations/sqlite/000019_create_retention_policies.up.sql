@@ -0,0 +1,12 @@
+CREATE TABLE IF NOT EXISTS retention_policies (
+    id          TEXT         PRIMARY KEY,
+    project_id  VARCHAR(64)  NOT NULL REFERENCES projects(id) ON DELETE CASCADE,
+    environment VARCHAR(64)  NOT NULL DEFAULT '',
+    event_type  VARCHAR(32)  NOT NULL DEFAULT '',
+    raw_days    INT          NOT NULL CHECK (raw_days > 0),
+    hourly_days INT          CHECK (hourly_days > 0),
+    created_at  DATETIME     NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    updated_at  DATETIME     NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE UNIQUE INDEX IF NOT EXISTS idx_retention_policies_scope ON retention_policies (project_id, environment, event_type);
@@ -0,0 +1,4 @@
+DROP TABLE IF EXISTS audits_rehydrated;
+DROP INDEX IF EXISTS idx_rehydrations_expires;
+DROP INDEX IF EXISTS idx_rehydrations_project;
+DROP TABLE IF EXISTS rehydrations;
@@ -0,0 +1,57 @@
+CREATE TABLE IF NOT EXISTS rehydrations (
+    id           TEXT         PRIMARY KEY,
+    project_id   VARCHAR(64)  NOT NULL REFERENCES projects(id) ON DELETE CASCADE,
+    from_time    DATETIME     NOT NULL,
+    to_time      DATETIME     NOT NULL,
+    status       VARCHAR(16)  NOT NULL DEFAULT 'pending' CHECK (status IN ('pending', 'running', 'ready', 'failed', 'expired')),
+    files        INT          NOT NULL DEFAULT 0,
+    row_count    BIGINT       NOT NULL DEFAULT 0,
+    error        TEXT         NOT NULL DEFAULT '',
+    requested_by VARCHAR(255) NOT NULL DEFAULT '',
+    expires_at   DATETIME     NOT NULL,
+    created_at   DATETIME     NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    completed_at DATETIME
+);
+
+CREATE INDEX IF NOT EXISTS idx_rehydrations_project ON rehydrations (project_id, created_at DESC);
+CREATE INDEX IF NOT EXISTS idx_rehydrations_expires ON rehydrations (expires_at) WHERE status <> 'expired';
+
+-- Columns mirror audits: a migration that adds a column to audits must add it here too.
+CREATE TABLE IF NOT EXISTS audits_rehydrated (
+    id             VARCHAR(64)  NOT NULL,
+    method         VARCHAR(8)   NOT NULL,
+    path           VARCHAR(255) NOT NULL,
+    status_code    INTEGER,
+    response_time  BIGINT,
+
+    identifier     VARCHAR(128),
+    user_email     VARCHAR(128),
+    user_name      VARCHAR(128),
+    user_roles     TEXT,
+    user_type      VARCHAR(64),
+    tenant_id      VARCHAR(64),
+
+    ip             VARCHAR(64),
+    user_agent     VARCHAR(255),
+    request_id     VARCHAR(128),
+    query_params   TEXT,
+    path_params    TEXT,
+    request_body   TEXT,
+    response_body  TEXT,
+    error_message  TEXT,
+
+    service_name   VARCHAR(128),
+    environment    VARCHAR(64),
+    timestamp      DATETIME     NOT NULL,
+    project_id     VARCHAR(64),
+    source         VARCHAR(16)  NOT NULL DEFAULT 'backend',
+    event_type     VARCHAR(32)  NOT NULL DEFAULT 'http',
+    session_id     VARCHAR(100),
+
+    rehydration_id TEXT         NOT NULL REFERENCES rehydrations(id) ON DELETE CASCADE,
+    expires_at     DATETIME     NOT NULL,
+    PRIMARY KEY (rehydration_id, id)
+);
+
+CREATE INDEX IF NOT EXISTS idx_audits_rehydrated_project_timestamp ON audits_rehydrated (project_id, timestamp DESC);
+CREATE INDEX IF NOT EXISTS idx_audits_rehydrated_id ON audits_rehydrated (id);
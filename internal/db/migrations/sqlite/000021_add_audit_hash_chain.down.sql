@@ -0,0 +1,11 @@
+DROP TABLE IF EXISTS audit_chain_checkpoints;
+DROP TABLE IF EXISTS audit_chain_heads;
+
+ALTER TABLE audits_rehydrated DROP COLUMN hash;
+ALTER TABLE audits_rehydrated DROP COLUMN prev_hash;
+ALTER TABLE audits_rehydrated DROP COLUMN chain_seq;
+
+DROP INDEX IF EXISTS idx_audits_chain;
+ALTER TABLE audits DROP COLUMN hash;
+ALTER TABLE audits DROP COLUMN prev_hash;
+ALTER TABLE audits DROP COLUMN chain_seq;
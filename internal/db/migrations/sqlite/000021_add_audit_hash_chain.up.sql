@@ -0,0 +1,29 @@
+ALTER TABLE audits ADD COLUMN chain_seq BIGINT;
+ALTER TABLE audits ADD COLUMN prev_hash VARCHAR(64);
+ALTER TABLE audits ADD COLUMN hash VARCHAR(64);
+CREATE INDEX IF NOT EXISTS idx_audits_chain ON audits (project_id, chain_seq) WHERE chain_seq IS NOT NULL;
+
+ALTER TABLE audits_rehydrated ADD COLUMN chain_seq BIGINT;
+ALTER TABLE audits_rehydrated ADD COLUMN prev_hash VARCHAR(64);
+ALTER TABLE audits_rehydrated ADD COLUMN hash VARCHAR(64);
+
+CREATE TABLE IF NOT EXISTS audit_chain_heads (
+    project_id VARCHAR(64) PRIMARY KEY,
+    seq        BIGINT      NOT NULL,
+    hash       VARCHAR(64) NOT NULL,
+    updated_at DATETIME    NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE TABLE IF NOT EXISTS audit_chain_checkpoints (
+    id         INTEGER     PRIMARY KEY AUTOINCREMENT,
+    project_id VARCHAR(64) NOT NULL,
+    first_seq  BIGINT      NOT NULL,
+    last_seq   BIGINT      NOT NULL,
+    prev_hash  VARCHAR(64) NOT NULL,
+    last_hash  VARCHAR(64) NOT NULL,
+    row_count  BIGINT      NOT NULL,
+    reason     VARCHAR(32) NOT NULL,
+    created_at DATETIME    NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX IF NOT EXISTS idx_audit_chain_checkpoints_project ON audit_chain_checkpoints (project_id, first_seq);
@@ -0,0 +1,17 @@
+CREATE TABLE IF NOT EXISTS integrity_checkpoints (
+    id         INTEGER     PRIMARY KEY AUTOINCREMENT,
+    project_id VARCHAR(64) NOT NULL,
+    first_seq  BIGINT      NOT NULL,
+    last_seq   BIGINT      NOT NULL,
+    leaf_count INT         NOT NULL,
+    root       VARCHAR(64) NOT NULL,
+    last_hash  VARCHAR(64) NOT NULL,
+    leaves     BLOB        NOT NULL,
+    key_id     VARCHAR(16) NOT NULL,
+    public_key TEXT        NOT NULL,
+    signature  TEXT        NOT NULL,
+    created_at DATETIME    NOT NULL,
+    UNIQUE (project_id, first_seq)
+);
+
+CREATE INDEX IF NOT EXISTS idx_integrity_checkpoints_range ON integrity_checkpoints (project_id, last_seq);
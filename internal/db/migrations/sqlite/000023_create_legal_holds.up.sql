@@ -0,0 +1,28 @@
+CREATE TABLE IF NOT EXISTS legal_holds (
+    id             TEXT         PRIMARY KEY,
+    project_id     VARCHAR(64)  NOT NULL,
+    identifier     VARCHAR(128) NOT NULL DEFAULT '',
+    tenant_id      VARCHAR(100) NOT NULL DEFAULT '',
+    from_time      DATETIME,
+    to_time        DATETIME,
+    reason         TEXT         NOT NULL,
+    created_by     VARCHAR(255) NOT NULL,
+    created_at     DATETIME     NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    released_by    VARCHAR(255) NOT NULL DEFAULT '',
+    release_reason TEXT         NOT NULL DEFAULT '',
+    released_at    DATETIME
+);
+
+CREATE INDEX IF NOT EXISTS idx_legal_holds_active ON legal_holds (project_id) WHERE released_at IS NULL;
+
+CREATE TABLE IF NOT EXISTS legal_hold_events (
+    id         INTEGER      PRIMARY KEY AUTOINCREMENT,
+    hold_id    TEXT         NOT NULL REFERENCES legal_holds(id),
+    project_id VARCHAR(64)  NOT NULL,
+    action     VARCHAR(16)  NOT NULL CHECK (action IN ('created', 'released')),
+    actor      VARCHAR(255) NOT NULL,
+    reason     TEXT         NOT NULL,
+    created_at DATETIME     NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX IF NOT EXISTS idx_legal_hold_events_project ON legal_hold_events (project_id, created_at DESC);
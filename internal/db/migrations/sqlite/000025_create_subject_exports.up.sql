@@ -0,0 +1,21 @@
+CREATE TABLE IF NOT EXISTS subject_exports (
+    id              TEXT         PRIMARY KEY,
+    project_id      VARCHAR(64)  NOT NULL REFERENCES projects(id) ON DELETE CASCADE,
+    subject_type    VARCHAR(16)  NOT NULL DEFAULT '' CHECK (subject_type IN ('', 'identifier', 'email', 'tenant')),
+    subject         TEXT         NOT NULL DEFAULT '',
+    request_ids     TEXT         NOT NULL DEFAULT '[]',
+    status          VARCHAR(16)  NOT NULL DEFAULT 'pending' CHECK (status IN ('pending', 'running', 'ready', 'failed', 'expired')),
+    events          BIGINT       NOT NULL DEFAULT 0,
+    archived_events BIGINT       NOT NULL DEFAULT 0,
+    sha256          VARCHAR(64)  NOT NULL DEFAULT '',
+    bytes           INT          NOT NULL DEFAULT 0,
+    bundle          BLOB,
+    error           TEXT         NOT NULL DEFAULT '',
+    requested_by    VARCHAR(255) NOT NULL DEFAULT '',
+    expires_at      DATETIME     NOT NULL,
+    created_at      DATETIME     NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    completed_at    DATETIME
+);
+
+CREATE INDEX IF NOT EXISTS idx_subject_exports_project ON subject_exports (project_id, created_at DESC);
+CREATE INDEX IF NOT EXISTS idx_subject_exports_expires ON subject_exports (expires_at) WHERE status = 'ready';
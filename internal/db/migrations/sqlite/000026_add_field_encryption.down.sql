@@ -0,0 +1,2 @@
+ALTER TABLE users DROP COLUMN can_decrypt;
+DROP TABLE IF EXISTS field_data_keys;
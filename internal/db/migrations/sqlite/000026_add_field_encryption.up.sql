@@ -0,0 +1,14 @@
+CREATE TABLE IF NOT EXISTS field_data_keys (
+    id             VARCHAR(32)  PRIMARY KEY,
+    project_id     VARCHAR(64)  NOT NULL DEFAULT '',
+    status         VARCHAR(16)  NOT NULL DEFAULT 'active' CHECK (status IN ('active', 'retired')),
+    master_key_id  VARCHAR(32)  NOT NULL,
+    wrapped        TEXT         NOT NULL,
+    created_at     DATETIME     NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    retired_at     DATETIME,
+    reencrypted_at DATETIME
+);
+
+CREATE UNIQUE INDEX IF NOT EXISTS idx_field_data_keys_active ON field_data_keys (project_id) WHERE status = 'active';
+
+ALTER TABLE users ADD COLUMN can_decrypt BOOLEAN NOT NULL DEFAULT FALSE;
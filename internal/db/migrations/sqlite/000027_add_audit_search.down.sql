@@ -0,0 +1,8 @@
+DROP TRIGGER IF EXISTS audits_search_insert;
+DROP TRIGGER IF EXISTS audits_search_update;
+DROP TRIGGER IF EXISTS audits_search_delete;
+DROP TRIGGER IF EXISTS audits_rehydrated_search_insert;
+DROP TRIGGER IF EXISTS audits_rehydrated_search_update;
+DROP TRIGGER IF EXISTS audits_rehydrated_search_delete;
+DROP TABLE IF EXISTS audit_search;
+DROP TABLE IF EXISTS audit_search_rows;
@@ -0,0 +1,80 @@
+-- Full-text search (GET /v1/audit?q=). audit_search indexes the path, error
+-- message, user fields and the string and number values of request and
+-- response bodies (except bodies sealed by field encryption) of live and
+-- rehydrated events. Its rowids come from audit_search_rows, whose INTEGER
+-- PRIMARY KEY survives VACUUM, unlike the implicit rowids of audits.
+CREATE TABLE IF NOT EXISTS audit_search_rows (
+    rowid          INTEGER PRIMARY KEY,
+    source         VARCHAR(32) NOT NULL,
+    audit_id       TEXT        NOT NULL,
+    rehydration_id TEXT        NOT NULL DEFAULT '',
+    UNIQUE (source, audit_id, rehydration_id)
+);
+
+CREATE VIRTUAL TABLE IF NOT EXISTS audit_search USING fts5(path, error_message, user, body, tokenize = 'unicode61 remove_diacritics 2');
+
+CREATE TRIGGER IF NOT EXISTS audits_search_insert AFTER INSERT ON audits BEGIN
+    INSERT INTO audit_search_rows (source, audit_id, rehydration_id) VALUES ('audits', NEW.id, '');
+    INSERT INTO audit_search (rowid, path, error_message, user, body) VALUES (
+        (SELECT rowid FROM audit_search_rows WHERE source = 'audits' AND audit_id = NEW.id AND rehydration_id = ''),
+        NEW.path, NEW.error_message,
+        coalesce(NEW.identifier, '') || ' ' || coalesce(NEW.user_email, '') || ' ' || coalesce(NEW.user_name, ''),
+        coalesce((SELECT group_concat(value, ' ') FROM json_tree(CASE WHEN NOT json_valid(NEW.request_body) THEN 'null' WHEN json_type(NEW.request_body, '$.bataudit_enc') IS NOT NULL THEN 'null' ELSE NEW.request_body END) WHERE type IN ('text', 'integer', 'real')), '') || ' ' ||
+        coalesce((SELECT group_concat(value, ' ') FROM json_tree(CASE WHEN NOT json_valid(NEW.response_body) THEN 'null' WHEN json_type(NEW.response_body, '$.bataudit_enc') IS NOT NULL THEN 'null' ELSE NEW.response_body END) WHERE type IN ('text', 'integer', 'real')), ''));
+END;
+
+CREATE TRIGGER IF NOT EXISTS audits_search_update AFTER UPDATE OF path, error_message, identifier, user_email, user_name, request_body, response_body ON audits BEGIN
+    DELETE FROM audit_search WHERE rowid = (SELECT rowid FROM audit_search_rows WHERE source = 'audits' AND audit_id = OLD.id AND rehydration_id = '');
+    INSERT INTO audit_search (rowid, path, error_message, user, body) VALUES (
+        (SELECT rowid FROM audit_search_rows WHERE source = 'audits' AND audit_id = NEW.id AND rehydration_id = ''),
+        NEW.path, NEW.error_message,
+        coalesce(NEW.identifier, '') || ' ' || coalesce(NEW.user_email, '') || ' ' || coalesce(NEW.user_name, ''),
+        coalesce((SELECT group_concat(value, ' ') FROM json_tree(CASE WHEN NOT json_valid(NEW.request_body) THEN 'null' WHEN json_type(NEW.request_body, '$.bataudit_enc') IS NOT NULL THEN 'null' ELSE NEW.request_body END) WHERE type IN ('text', 'integer', 'real')), '') || ' ' ||
+        coalesce((SELECT group_concat(value, ' ') FROM json_tree(CASE WHEN NOT json_valid(NEW.response_body) THEN 'null' WHEN json_type(NEW.response_body, '$.bataudit_enc') IS NOT NULL THEN 'null' ELSE NEW.response_body END) WHERE type IN ('text', 'integer', 'real')), ''));
+END;
+
+CREATE TRIGGER IF NOT EXISTS audits_search_delete AFTER DELETE ON audits BEGIN
+    DELETE FROM audit_search WHERE rowid = (SELECT rowid FROM audit_search_rows WHERE source = 'audits' AND audit_id = OLD.id AND rehydration_id = '');
+    DELETE FROM audit_search_rows WHERE source = 'audits' AND audit_id = OLD.id AND rehydration_id = '';
+END;
+
+INSERT INTO audit_search_rows (source, audit_id, rehydration_id) SELECT 'audits', id, '' FROM audits;
+INSERT INTO audit_search (rowid, path, error_message, user, body)
+    SELECT r.rowid, a.path, a.error_message,
+        coalesce(a.identifier, '') || ' ' || coalesce(a.user_email, '') || ' ' || coalesce(a.user_name, ''),
+        coalesce((SELECT group_concat(value, ' ') FROM json_tree(CASE WHEN NOT json_valid(a.request_body) THEN 'null' WHEN json_type(a.request_body, '$.bataudit_enc') IS NOT NULL THEN 'null' ELSE a.request_body END) WHERE type IN ('text', 'integer', 'real')), '') || ' ' ||
+        coalesce((SELECT group_concat(value, ' ') FROM json_tree(CASE WHEN NOT json_valid(a.response_body) THEN 'null' WHEN json_type(a.response_body, '$.bataudit_enc') IS NOT NULL THEN 'null' ELSE a.response_body END) WHERE type IN ('text', 'integer', 'real')), '')
+    FROM audits a JOIN audit_search_rows r ON r.source = 'audits' AND r.audit_id = a.id AND r.rehydration_id = '';
+
+CREATE TRIGGER IF NOT EXISTS audits_rehydrated_search_insert AFTER INSERT ON audits_rehydrated BEGIN
+    INSERT INTO audit_search_rows (source, audit_id, rehydration_id) VALUES ('audits_rehydrated', NEW.id, NEW.rehydration_id);
+    INSERT INTO audit_search (rowid, path, error_message, user, body) VALUES (
+        (SELECT rowid FROM audit_search_rows WHERE source = 'audits_rehydrated' AND audit_id = NEW.id AND rehydration_id = NEW.rehydration_id),
+        NEW.path, NEW.error_message,
+        coalesce(NEW.identifier, '') || ' ' || coalesce(NEW.user_email, '') || ' ' || coalesce(NEW.user_name, ''),
+        coalesce((SELECT group_concat(value, ' ') FROM json_tree(CASE WHEN NOT json_valid(NEW.request_body) THEN 'null' WHEN json_type(NEW.request_body, '$.bataudit_enc') IS NOT NULL THEN 'null' ELSE NEW.request_body END) WHERE type IN ('text', 'integer', 'real')), '') || ' ' ||
+        coalesce((SELECT group_concat(value, ' ') FROM json_tree(CASE WHEN NOT json_valid(NEW.response_body) THEN 'null' WHEN json_type(NEW.response_body, '$.bataudit_enc') IS NOT NULL THEN 'null' ELSE NEW.response_body END) WHERE type IN ('text', 'integer', 'real')), ''));
+END;
+
+CREATE TRIGGER IF NOT EXISTS audits_rehydrated_search_update AFTER UPDATE OF path, error_message, identifier, user_email, user_name, request_body, response_body ON audits_rehydrated BEGIN
+    DELETE FROM audit_search WHERE rowid = (SELECT rowid FROM audit_search_rows WHERE source = 'audits_rehydrated' AND audit_id = OLD.id AND rehydration_id = OLD.rehydration_id);
+    INSERT INTO audit_search (rowid, path, error_message, user, body) VALUES (
+        (SELECT rowid FROM audit_search_rows WHERE source = 'audits_rehydrated' AND audit_id = NEW.id AND rehydration_id = NEW.rehydration_id),
+        NEW.path, NEW.error_message,
+        coalesce(NEW.identifier, '') || ' ' || coalesce(NEW.user_email, '') || ' ' || coalesce(NEW.user_name, ''),
+        coalesce((SELECT group_concat(value, ' ') FROM json_tree(CASE WHEN NOT json_valid(NEW.request_body) THEN 'null' WHEN json_type(NEW.request_body, '$.bataudit_enc') IS NOT NULL THEN 'null' ELSE NEW.request_body END) WHERE type IN ('text', 'integer', 'real')), '') || ' ' ||
+        coalesce((SELECT group_concat(value, ' ') FROM json_tree(CASE WHEN NOT json_valid(NEW.response_body) THEN 'null' WHEN json_type(NEW.response_body, '$.bataudit_enc') IS NOT NULL THEN 'null' ELSE NEW.response_body END) WHERE type IN ('text', 'integer', 'real')), ''));
+END;
+
+CREATE TRIGGER IF NOT EXISTS audits_rehydrated_search_delete AFTER DELETE ON audits_rehydrated BEGIN
+    DELETE FROM audit_search WHERE rowid = (SELECT rowid FROM audit_search_rows WHERE source = 'audits_rehydrated' AND audit_id = OLD.id AND rehydration_id = OLD.rehydration_id);
+    DELETE FROM audit_search_rows WHERE source = 'audits_rehydrated' AND audit_id = OLD.id AND rehydration_id = OLD.rehydration_id;
+END;
+
+INSERT INTO audit_search_rows (source, audit_id, rehydration_id) SELECT 'audits_rehydrated', id, rehydration_id FROM audits_rehydrated;
+INSERT INTO audit_search (rowid, path, error_message, user, body)
+    SELECT r.rowid, a.path, a.error_message,
+        coalesce(a.identifier, '') || ' ' || coalesce(a.user_email, '') || ' ' || coalesce(a.user_name, ''),
+        coalesce((SELECT group_concat(value, ' ') FROM json_tree(CASE WHEN NOT json_valid(a.request_body) THEN 'null' WHEN json_type(a.request_body, '$.bataudit_enc') IS NOT NULL THEN 'null' ELSE a.request_body END) WHERE type IN ('text', 'integer', 'real')), '') || ' ' ||
+        coalesce((SELECT group_concat(value, ' ') FROM json_tree(CASE WHEN NOT json_valid(a.response_body) THEN 'null' WHEN json_type(a.response_body, '$.bataudit_enc') IS NOT NULL THEN 'null' ELSE a.response_body END) WHERE type IN ('text', 'integer', 'real')), '')
+    FROM audits_rehydrated a JOIN audit_search_rows r ON r.source = 'audits_rehydrated' AND r.audit_id = a.id AND r.rehydration_id = a.rehydration_id;
@@ -0,0 +1,7 @@
+DROP INDEX IF EXISTS idx_audits_trace_id;
+ALTER TABLE audits_rehydrated DROP COLUMN parent_span_id;
+ALTER TABLE audits_rehydrated DROP COLUMN span_id;
+ALTER TABLE audits_rehydrated DROP COLUMN trace_id;
+ALTER TABLE audits DROP COLUMN parent_span_id;
+ALTER TABLE audits DROP COLUMN span_id;
+ALTER TABLE audits DROP COLUMN trace_id;
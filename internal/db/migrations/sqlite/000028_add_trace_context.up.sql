@@ -0,0 +1,8 @@
+ALTER TABLE audits ADD COLUMN trace_id VARCHAR(32);
+ALTER TABLE audits ADD COLUMN span_id VARCHAR(16);
+ALTER TABLE audits ADD COLUMN parent_span_id VARCHAR(16);
+ALTER TABLE audits_rehydrated ADD COLUMN trace_id VARCHAR(32);
+ALTER TABLE audits_rehydrated ADD COLUMN span_id VARCHAR(16);
+ALTER TABLE audits_rehydrated ADD COLUMN parent_span_id VARCHAR(16);
+
+CREATE INDEX IF NOT EXISTS idx_audits_trace_id ON audits (trace_id) WHERE trace_id IS NOT NULL;
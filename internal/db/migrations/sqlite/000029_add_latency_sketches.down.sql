@@ -0,0 +1,3 @@
+DROP INDEX IF EXISTS idx_audit_latency_sketches_lookup;
+DROP INDEX IF EXISTS idx_audit_latency_sketches_unique;
+DROP TABLE IF EXISTS audit_latency_sketches;
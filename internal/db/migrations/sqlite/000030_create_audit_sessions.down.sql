@@ -0,0 +1,5 @@
+DROP TABLE IF EXISTS session_settings;
+DROP INDEX IF EXISTS idx_audit_sessions_start;
+DROP INDEX IF EXISTS idx_audit_sessions_derived;
+DROP INDEX IF EXISTS idx_audit_sessions_explicit;
+DROP TABLE IF EXISTS audit_sessions;
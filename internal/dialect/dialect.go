@@ -0,0 +1,140 @@
+// Package dialect renders the SQL fragments that differ between Postgres and
+// SQLite: time formatting and truncation, time differences and percentiles.
+// Reader queries are written once with these helpers and run on both engines.
+//
+// Relative time windows ("the last 24 hours") are not a dialect concern: the
+// queries bind a time computed in Go instead of using NOW() - INTERVAL.
+package dialect
+
+import (
+	"database/sql/driver"
+	"fmt"
+	"strconv"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// Dialect is the SQL flavour of a connection.
+type Dialect string
+
+const (
+	Postgres Dialect = "postgres"
+	SQLite   Dialect = "sqlite"
+)
+
+// isoFormat is the layout of ISOTime on Postgres.
+const isoFormat = `'YYYY-MM-DD"T"HH24:MI:SS"Z"'`
+
+// Of returns the dialect of db. Anything but SQLite is treated as Postgres.
+func Of(db *gorm.DB) Dialect {
+	if db.Dialector.Name() == "sqlite" {
+		return SQLite
+	}
+	return Postgres
+}
+
+// UTC converts a timestamp without time zone to UTC before formatting.
+// SQLite timestamps are converted by every helper, so it is a no-op there.
+func (d Dialect) UTC(expr string) string {
+	if d == SQLite {
+		return expr
+	}
+	return expr + " AT TIME ZONE 'UTC'"
+}
+
+// ISOTime formats a timestamp as 2006-01-02T15:04:05Z.
+func (d Dialect) ISOTime(expr string) string {
+	if d == SQLite {
+		return "strftime('%Y-%m-%dT%H:%M:%SZ', " + utcFunc + "(" + expr + "))"
+	}
+	return "TO_CHAR(" + expr + ", " + isoFormat + ")"
+}
+
+// sqliteTruncFormats are strftime layouts truncating to a unit. The result is
+// written the way the driver stores time values, so it compares with stored
+// and bound timestamps and reads back as a time.Time.
+var sqliteTruncFormats = map[string]string{
+	"minute": "%Y-%m-%d %H:%M:00 +0000 UTC",
+	"hour":   "%Y-%m-%d %H:00:00 +0000 UTC",
+	"day":    "%Y-%m-%d 00:00:00 +0000 UTC",
+}
+
+// Trunc truncates a timestamp to the start of its minute, hour or day.
+func (d Dialect) Trunc(unit, expr string) string {
+	if d == SQLite {
+		format, ok := sqliteTruncFormats[unit]
+		if !ok {
+			panic("dialect: unsupported trunc unit " + unit)
+		}
+		return "strftime('" + format + "', " + utcFunc + "(" + expr + "))"
+	}
+	return "DATE_TRUNC('" + unit + "', " + expr + ")"
+}
+
+// Bucket truncates a timestamp to the start of its n-minute bucket within
+// the hour (n should divide 60).
+func (d Dialect) Bucket(minutes int, expr string) string {
+	n := strconv.Itoa(minutes)
+	if d == SQLite {
+		return fmt.Sprintf("strftime('%s', (CAST(strftime('%%s', %s(%s)) AS INTEGER) / %d) * %d, 'unixepoch')",
+			sqliteTruncFormats["minute"], utcFunc, expr, minutes*60, minutes*60)
+	}
+	return "(DATE_TRUNC('minute', " + expr + ") - (EXTRACT(MINUTE FROM " + expr + ")::int % " + n + ") * INTERVAL '1 minute')"
+}
+
+// Seconds is the number of seconds from one timestamp to another.
+func (d Dialect) Seconds(from, to string) string {
+	if d == SQLite {
+		return "((julianday(" + utcFunc + "(" + to + ")) - julianday(" + utcFunc + "(" + from + "))) * 86400)"
+	}
+	return "EXTRACT(EPOCH FROM (" + to + " - " + from + "))"
+}
+
+// Percentile is the continuous percentile p (0 to 1) of expr over a group,
+// interpolated as Postgres' percentile_cont. It is NULL for an empty group.
+func (d Dialect) Percentile(p float64, expr string) string {
+	fraction := strconv.FormatFloat(p, 'f', -1, 64)
+	if d == SQLite {
+		return percentileFunc + "(" + expr + ", " + fraction + ")"
+	}
+	return "PERCENTILE_CONT(" + fraction + ") WITHIN GROUP (ORDER BY " + expr + ")"
+}
+
+// Time scans a timestamp computed by a query, such as MAX(timestamp) or a
+// Trunc. SQLite returns those as text, which database/sql does not convert
+// to time.Time.
+type Time struct {
+	time.Time
+}
+
+// Scan implements sql.Scanner.
+func (t *Time) Scan(v any) error {
+	switch v := v.(type) {
+	case nil:
+		t.Time = time.Time{}
+	case time.Time:
+		t.Time = v
+	case string:
+		return t.parse(v)
+	case []byte:
+		return t.parse(string(v))
+	default:
+		return fmt.Errorf("dialect: cannot scan %T into Time", v)
+	}
+	return nil
+}
+
+// Value implements driver.Valuer.
+func (t Time) Value() (driver.Value, error) {
+	return t.Time, nil
+}
+
+func (t *Time) parse(s string) error {
+	parsed, ok := parseTime(s)
+	if !ok {
+		return fmt.Errorf("dialect: invalid time %q", s)
+	}
+	t.Time = parsed
+	return nil
+}
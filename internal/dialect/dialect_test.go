@@ -0,0 +1,71 @@
+package dialect
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+)
+
+func TestPostgresFragments(t *testing.T) {
+	d := Postgres
+	assert.Equal(t, `TO_CHAR(MIN(timestamp), 'YYYY-MM-DD"T"HH24:MI:SS"Z"')`, d.ISOTime("MIN(timestamp)"))
+	assert.Equal(t, `TO_CHAR(timestamp AT TIME ZONE 'UTC', 'YYYY-MM-DD"T"HH24:MI:SS"Z"')`, d.ISOTime(d.UTC("timestamp")))
+	assert.Equal(t, "DATE_TRUNC('hour', timestamp)", d.Trunc("hour", "timestamp"))
+	assert.Equal(t, "(DATE_TRUNC('minute', timestamp) - (EXTRACT(MINUTE FROM timestamp)::int % 5) * INTERVAL '1 minute')", d.Bucket(5, "timestamp"))
+	assert.Equal(t, "EXTRACT(EPOCH FROM (MAX(timestamp) - MIN(timestamp)))", d.Seconds("MIN(timestamp)", "MAX(timestamp)"))
+	assert.Equal(t, "PERCENTILE_CONT(0.95) WITHIN GROUP (ORDER BY response_time)", d.Percentile(0.95, "response_time"))
+}
+
+func TestSQLiteFragments(t *testing.T) {
+	db, err := gorm.Open(sqlite.New(sqlite.Config{DriverName: "sqlite", DSN: "file::memory:"}), &gorm.Config{})
+	require.NoError(t, err)
+	require.Equal(t, SQLite, Of(db))
+	require.NoError(t, db.Exec("CREATE TABLE t (ts DATETIME, ms INTEGER)").Error)
+
+	// Stored by the driver as time.String().
+	for i, ts := range []time.Time{
+		time.Date(2026, 10, 19, 9, 7, 30, 500, time.UTC),
+		time.Date(2026, 10, 19, 9, 12, 0, 0, time.UTC),
+		time.Date(2026, 10, 19, 10, 0, 0, 0, time.UTC),
+	} {
+		require.NoError(t, db.Exec("INSERT INTO t VALUES (?, ?)", ts, (i+1)*10).Error)
+	}
+
+	var row struct {
+		First   string
+		Seconds float64
+		P50     float64
+		P95     float64
+		Hour    Time
+		Bucket  string
+	}
+	d := SQLite
+	require.NoError(t, db.Raw(`SELECT `+
+		d.ISOTime("MIN(ts)")+` AS first, `+
+		d.Seconds("MIN(ts)", "MAX(ts)")+` AS seconds, `+
+		d.Percentile(0.5, "ms")+` AS p50, `+
+		d.Percentile(0.95, "ms")+` AS p95, `+
+		d.Trunc("hour", "MIN(ts)")+` AS hour, `+
+		d.ISOTime(d.UTC(d.Bucket(5, "MAX(ts)")))+` AS bucket
+		FROM t WHERE ts < ?`, time.Date(2026, 10, 19, 9, 30, 0, 0, time.UTC)).Scan(&row).Error)
+
+	assert.Equal(t, "2026-10-19T09:07:30Z", row.First)
+	assert.InDelta(t, 270, row.Seconds, 0.01)
+	assert.InDelta(t, 15, row.P50, 0.001)
+	assert.InDelta(t, 19.5, row.P95, 0.001)
+	assert.True(t, time.Date(2026, 10, 19, 9, 0, 0, 0, time.UTC).Equal(row.Hour.Time), row.Hour.Time)
+	assert.Equal(t, "2026-10-19T09:10:00Z", row.Bucket)
+
+	var iso string
+	brt := time.FixedZone("BRT", -3*3600)
+	require.NoError(t, db.Raw(`SELECT `+d.ISOTime("?"), time.Date(2026, 10, 19, 6, 12, 0, 0, brt)).Scan(&iso).Error)
+	assert.Equal(t, "2026-10-19T09:12:00Z", iso, "converted to UTC")
+
+	var empty *float64
+	require.NoError(t, db.Raw(`SELECT `+d.Percentile(0.95, "ms")+` FROM t WHERE ms > 100`).Scan(&empty).Error)
+	assert.Nil(t, empty, "NULL for an empty group, as percentile_cont")
+}
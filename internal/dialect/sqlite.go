@@ -0,0 +1,125 @@
+package dialect
+
+import (
+	"database/sql/driver"
+	"math"
+	"slices"
+	"strings"
+	"time"
+
+	"modernc.org/sqlite"
+)
+
+// SQL functions registered on every SQLite connection. They are registered
+// when the package is loaded, before any connection is opened.
+const (
+	// utcFunc(ts) turns a stored timestamp into SQLite's own UTC format,
+	// which strftime and julianday understand. The driver stores time values
+	// as Go's time.String(), which they do not.
+	utcFunc = "bat_utc"
+	// percentileFunc(value, fraction) is percentile_cont as an aggregate.
+	percentileFunc = "bat_percentile_cont"
+)
+
+// timeLayouts are the layouts utcFunc accepts: the driver's, SQLite's own
+// and RFC 3339.
+var timeLayouts = []string{
+	"2006-01-02 15:04:05.999999999 -0700 MST",
+	"2006-01-02 15:04:05.999999999-07:00",
+	"2006-01-02T15:04:05.999999999-07:00",
+	"2006-01-02 15:04:05.999999999",
+	"2006-01-02T15:04:05.999999999",
+	"2006-01-02 15:04",
+	"2006-01-02",
+}
+
+func init() {
+	sqlite.MustRegisterDeterministicScalarFunction(utcFunc, 1, func(_ *sqlite.FunctionContext, args []driver.Value) (driver.Value, error) {
+		var t time.Time
+		switch v := args[0].(type) {
+		case string:
+			parsed, ok := parseTime(v)
+			if !ok {
+				return nil, nil
+			}
+			t = parsed
+		case int64: // unix seconds, as SQLite's own 'unixepoch'
+			t = time.Unix(v, 0)
+		case time.Time:
+			t = v
+		default:
+			return nil, nil
+		}
+		return t.UTC().Format("2006-01-02 15:04:05.000"), nil
+	})
+	sqlite.MustRegisterFunction(percentileFunc, &sqlite.FunctionImpl{
+		NArgs:         2,
+		Deterministic: true,
+		MakeAggregate: func(sqlite.FunctionContext) (sqlite.AggregateFunction, error) {
+			return &percentile{}, nil
+		},
+	})
+}
+
+// parseTime parses a stored timestamp, ignoring the monotonic clock reading
+// (" m=+1.5") that time.String() appends.
+func parseTime(s string) (time.Time, bool) {
+	if i := strings.Index(s, " m="); i > 0 {
+		s = s[:i]
+	}
+	s = strings.TrimSuffix(s, "Z")
+	for _, layout := range timeLayouts {
+		if t, err := time.Parse(layout, s); err == nil {
+			return t, true
+		}
+	}
+	return time.Time{}, false
+}
+
+// percentile collects a group's values; NULLs are skipped, as in Postgres.
+type percentile struct {
+	values   []float64
+	fraction float64
+}
+
+func (p *percentile) Step(_ *sqlite.FunctionContext, args []driver.Value) error {
+	if f, ok := toFloat(args[1]); ok {
+		p.fraction = f
+	}
+	if f, ok := toFloat(args[0]); ok {
+		p.values = append(p.values, f)
+	}
+	return nil
+}
+
+func (p *percentile) WindowInverse(_ *sqlite.FunctionContext, args []driver.Value) error {
+	if f, ok := toFloat(args[0]); ok {
+		if i := slices.Index(p.values, f); i >= 0 {
+			p.values = slices.Delete(p.values, i, i+1)
+		}
+	}
+	return nil
+}
+
+func (p *percentile) WindowValue(*sqlite.FunctionContext) (driver.Value, error) {
+	if len(p.values) == 0 {
+		return nil, nil
+	}
+	sorted := slices.Clone(p.values)
+	slices.Sort(sorted)
+	pos := math.Min(math.Max(p.fraction, 0), 1) * float64(len(sorted)-1)
+	lo, hi := int(math.Floor(pos)), int(math.Ceil(pos))
+	return sorted[lo] + (sorted[hi]-sorted[lo])*(pos-float64(lo)), nil
+}
+
+func (p *percentile) Final(*sqlite.FunctionContext) {}
+
+func toFloat(v driver.Value) (float64, bool) {
+	switch n := v.(type) {
+	case int64:
+		return float64(n), true
+	case float64:
+		return n, true
+	}
+	return 0, false
+}
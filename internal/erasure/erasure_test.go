@@ -0,0 +1,98 @@
+package erasure
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"testing"
+	"time"
+
+	"github.com/joaovrmoraes/bataudit/internal/audit"
+	"github.com/joaovrmoraes/bataudit/internal/integrity"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gorm.io/datatypes"
+)
+
+func testRequest(t SubjectType, subject string, mode Mode) *Request {
+	salt := "00112233445566778899aabbccddeeff"
+	subject = normalize(t, subject)
+	return &Request{
+		ID:          "6d3fde77-c7ce-452e-bd1e-13a2daab369f",
+		ProjectID:   "p1",
+		SubjectType: t,
+		Subject:     subject,
+		Salt:        salt,
+		SubjectHash: subjectHash(salt, subject),
+		Pseudonym:   pseudonym(salt, subject),
+		Mode:        mode,
+		CreatedAt:   time.Date(2026, 10, 19, 9, 0, 0, 0, time.UTC),
+	}
+}
+
+func TestReceipt_signAndVerify(t *testing.T) {
+	_, key, err := ed25519.GenerateKey(rand.Reader)
+	require.NoError(t, err)
+	signer := integrity.NewSigner(key)
+
+	req := testRequest(SubjectEmail, "Alice@Example.com", ModePseudonymize)
+	assert.Nil(t, req.Receipt(), "no receipt before completion")
+
+	done := req.CreatedAt.Add(time.Minute)
+	req.Status, req.CompletedAt = StatusCompleted, &done
+	req.Events, req.HeldEvents = 12, 1
+	req.KeyID, req.PublicKey = signer.KeyID(), signer.PublicKey()
+	req.Signature = signer.Sign(req.Receipt().Message())
+
+	rc := req.Receipt()
+	require.NoError(t, rc.Verify(nil))
+	require.NoError(t, rc.Verify(key.Public().(ed25519.PublicKey)))
+	assert.Equal(t, subjectHash(rc.Salt, "alice@example.com"), rc.SubjectHash)
+
+	other, _, _ := ed25519.GenerateKey(rand.Reader)
+	assert.Error(t, rc.Verify(other))
+
+	rc.Events = 11
+	assert.Error(t, rc.Verify(nil))
+}
+
+func TestRedact_matchesAssignments(t *testing.T) {
+	for _, mode := range []Mode{ModePseudonymize, ModeRemove} {
+		req := testRequest(SubjectIdentifier, "alice", mode)
+		now := time.Now().UTC()
+		ev := audit.Audit{
+			Identifier: "alice", UserEmail: "alice@example.com", UserName: "Alice", IP: "10.0.0.1",
+			UserAgent: "curl", SessionID: "s1", ErrorMessage: "alice not allowed",
+			RequestBody: datatypes.JSON(`{"name":"Alice"}`), QueryParams: datatypes.JSON(`{"q":"x"}`),
+			StatusCode: 403, ServiceName: "api",
+		}
+		req.redact(&ev, now)
+
+		set := req.assignments(now)
+		assert.Equal(t, set["identifier"], ev.Identifier)
+		assert.Empty(t, ev.UserEmail)
+		assert.Empty(t, ev.IP)
+		assert.Nil(t, ev.RequestBody)
+		assert.Equal(t, 403, ev.StatusCode, "non-personal fields are kept")
+		assert.Equal(t, "api", ev.ServiceName)
+		require.NotNil(t, ev.ErasedAt)
+		_, clearsSession := set["session_id"]
+		assert.Equal(t, clearsSession, ev.SessionID == "", mode)
+	}
+	assert.Equal(t, "erased", testRequest(SubjectIdentifier, "alice", ModeRemove).identifier())
+}
+
+func TestRequest_matches(t *testing.T) {
+	byEmail := testRequest(SubjectEmail, "alice@example.com", ModePseudonymize)
+	assert.True(t, byEmail.matches("ALICE@example.com"))
+	assert.False(t, byEmail.matches("bob@example.com"))
+	assert.False(t, byEmail.matches(""))
+
+	byID := testRequest(SubjectIdentifier, "User-1", ModePseudonymize)
+	assert.True(t, byID.matches("User-1"))
+	assert.False(t, byID.matches("user-1"), "identifiers are case-sensitive")
+
+	alert := audit.Audit{EventType: "system.alert", RequestBody: datatypes.JSON(`{"identifier":"User-1","count":7}`)}
+	assert.True(t, byID.matches(alertIdentifier(&alert)))
+	byID.redactAlert(&alert, time.Now())
+	assert.JSONEq(t, `{"identifier":"`+byID.Pseudonym+`","count":7}`, string(alert.RequestBody))
+}
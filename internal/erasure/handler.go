@@ -0,0 +1,152 @@
+package erasure
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/joaovrmoraes/bataudit/internal/auth"
+	"gorm.io/gorm"
+)
+
+type Handler struct {
+	manager *Manager
+}
+
+func NewHandler(manager *Manager) *Handler {
+	return &Handler{manager: manager}
+}
+
+// RegisterRoutes mounts the erasure endpoints onto an already-JWT-protected
+// group. Expected base path: /v1/erasures
+func (h *Handler) RegisterRoutes(rg *gin.RouterGroup) {
+	rg.GET("", h.List)
+	rg.POST("", h.Create)
+	rg.GET("/:id", h.Get)
+	rg.GET("/:id/receipt", h.Receipt)
+}
+
+type createRequest struct {
+	ProjectID   string      `json:"project_id"   binding:"required"`
+	SubjectType SubjectType `json:"subject_type" binding:"required"`
+	Subject     string      `json:"subject"      binding:"required"`
+	// Mode is pseudonymize (default) or remove.
+	Mode   Mode   `json:"mode"`
+	Reason string `json:"reason"`
+}
+
+// Create godoc
+// @Summary      Request erasure of a data subject
+// @Description  Queues the pseudonymization or removal of the personal data of every event of an identifier or email in the project. The Worker runs it in the background; poll GET /erasures/{id}. Events under a legal hold are skipped. The request is recorded as a system.erasure event.
+// @Tags         erasures
+// @Accept       json
+// @Produce      json
+// @Security     BearerAuth
+// @Param        body  body  createRequest  true  "Subject and mode"
+// @Success      202  {object}  Request
+// @Failure      400  {object}  map[string]string
+// @Failure      403  {object}  map[string]string
+// @Router       /erasures [post]
+func (h *Handler) Create(c *gin.Context) {
+	if !auth.RequireManager(c) {
+		return
+	}
+	claims := c.MustGet(auth.ContextKeyClaims).(*auth.Claims)
+
+	var body createRequest
+	if err := c.ShouldBindJSON(&body); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	req, err := h.manager.Request(body.ProjectID, body.SubjectType, body.Subject, body.Mode, body.Reason, claims.Email)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusAccepted, req)
+}
+
+// List godoc
+// @Summary      List a project's erasure requests
+// @Tags         erasures
+// @Produce      json
+// @Security     BearerAuth
+// @Param        project_id  query  string  true  "Project ID"
+// @Success      200  {array}  Request
+// @Failure      400  {object}  map[string]string
+// @Router       /erasures [get]
+func (h *Handler) List(c *gin.Context) {
+	projectID := c.Query("project_id")
+	if projectID == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "project_id required"})
+		return
+	}
+	list, err := h.manager.List(projectID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, list)
+}
+
+// Get godoc
+// @Summary      Get an erasure request's status
+// @Tags         erasures
+// @Produce      json
+// @Security     BearerAuth
+// @Param        id          path   string  true  "Erasure request ID"
+// @Param        project_id  query  string  true  "Project ID"
+// @Success      200  {object}  Request
+// @Failure      404  {object}  map[string]string
+// @Router       /erasures/{id} [get]
+func (h *Handler) Get(c *gin.Context) {
+	req, ok := h.find(c)
+	if !ok {
+		return
+	}
+	c.JSON(http.StatusOK, req)
+}
+
+// Receipt godoc
+// @Summary      Get the signed receipt of a completed erasure
+// @Description  The receipt is signed with the instance integrity key. subject_hash is SHA-256(salt || subject), with emails lower-cased.
+// @Tags         erasures
+// @Produce      json
+// @Security     BearerAuth
+// @Param        id          path   string  true  "Erasure request ID"
+// @Param        project_id  query  string  true  "Project ID"
+// @Success      200  {object}  Receipt
+// @Failure      404  {object}  map[string]string
+// @Failure      409  {object}  map[string]string
+// @Router       /erasures/{id}/receipt [get]
+func (h *Handler) Receipt(c *gin.Context) {
+	req, ok := h.find(c)
+	if !ok {
+		return
+	}
+	rc := req.Receipt()
+	if rc == nil {
+		c.JSON(http.StatusConflict, gin.H{"error": "erasure is " + string(req.Status)})
+		return
+	}
+	c.JSON(http.StatusOK, rc)
+}
+
+func (h *Handler) find(c *gin.Context) (*Request, bool) {
+	projectID := c.Query("project_id")
+	if projectID == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "project_id required"})
+		return nil, false
+	}
+	req, err := h.manager.Get(c.Param("id"), projectID)
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "erasure request not found"})
+		return nil, false
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return nil, false
+	}
+	return req, true
+}
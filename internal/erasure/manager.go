@@ -0,0 +1,132 @@
+package erasure
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/joaovrmoraes/bataudit/internal/audit"
+	"gorm.io/datatypes"
+	"gorm.io/gorm"
+)
+
+// Manager accepts erasure requests; the Worker's Runner carries them out.
+type Manager struct {
+	db *gorm.DB
+}
+
+func NewManager(db *gorm.DB) *Manager {
+	return &Manager{db: db}
+}
+
+// Request queues the erasure of subject's personal data in a project and, in
+// the same transaction, records the request as a system.erasure event. The
+// event carries the subject's hash, never the subject.
+func (m *Manager) Request(projectID string, t SubjectType, subject string, mode Mode, reason, requestedBy string) (*Request, error) {
+	subject = normalize(t, subject)
+	if mode == "" {
+		mode = ModePseudonymize
+	}
+	switch {
+	case projectID == "":
+		return nil, errors.New("project_id is required")
+	case t != SubjectIdentifier && t != SubjectEmail:
+		return nil, errors.New("subject_type must be identifier or email")
+	case subject == "":
+		return nil, errors.New("subject is required")
+	case mode != ModePseudonymize && mode != ModeRemove:
+		return nil, errors.New("mode must be pseudonymize or remove")
+	}
+
+	salt, err := m.salt(projectID, t, subject)
+	if err != nil {
+		return nil, err
+	}
+	now := time.Now().UTC().Truncate(time.Microsecond)
+	req := &Request{
+		ID:          uuid.New().String(),
+		ProjectID:   projectID,
+		SubjectType: t,
+		Subject:     subject,
+		Salt:        salt,
+		SubjectHash: subjectHash(salt, subject),
+		Pseudonym:   pseudonym(salt, subject),
+		Mode:        mode,
+		Reason:      reason,
+		Status:      StatusPending,
+		RequestedBy: requestedBy,
+		CreatedAt:   now,
+	}
+
+	details, _ := json.Marshal(map[string]any{
+		"erasure_id":   req.ID,
+		"subject_type": req.SubjectType,
+		"subject_hash": req.SubjectHash,
+		"mode":         req.Mode,
+		"reason":       req.Reason,
+	})
+	event := audit.Audit{
+		ID:          uuid.New().String(),
+		EventType:   "system.erasure",
+		Path:        "/v1/erasures",
+		Identifier:  requestedBy,
+		ServiceName: "bataudit",
+		Environment: "production",
+		ProjectID:   projectID,
+		Timestamp:   now,
+		RequestBody: datatypes.JSON(details),
+	}
+	req.RequestEventID = event.ID
+
+	err = m.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(req).Error; err != nil {
+			return err
+		}
+		return audit.NewRepository(tx).Create(&event)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return req, nil
+}
+
+// salt reuses the salt of an earlier request for the same subject, so a
+// repeated request (e.g. once a legal hold is released) gives the subject
+// the same pseudonym.
+func (m *Manager) salt(projectID string, t SubjectType, subject string) (string, error) {
+	var prior []Request
+	err := m.db.Select("salt, subject_hash").
+		Where("project_id = ? AND subject_type = ?", projectID, t).
+		Find(&prior).Error
+	if err != nil {
+		return "", err
+	}
+	for _, p := range prior {
+		if subjectHash(p.Salt, subject) == p.SubjectHash {
+			return p.Salt, nil
+		}
+	}
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
+
+// List returns a project's erasure requests, newest first.
+func (m *Manager) List(projectID string) ([]Request, error) {
+	var list []Request
+	err := m.db.Where("project_id = ?", projectID).Order("created_at DESC").Find(&list).Error
+	return list, err
+}
+
+func (m *Manager) Get(id, projectID string) (*Request, error) {
+	var req Request
+	if err := m.db.Where("id = ? AND project_id = ?", id, projectID).First(&req).Error; err != nil {
+		return nil, err
+	}
+	return &req, nil
+}
@@ -0,0 +1,201 @@
+// Package erasure carries out data-subject erasure requests (GDPR art. 17,
+// LGPD art. 18). Given an identifier or email, the Worker pseudonymizes or
+// removes the personal data of the subject's events while keeping the rows
+// and their non-personal fields, so counts and statistics do not change.
+// Events under a legal hold are left untouched. Each completed request yields
+// a receipt signed with the instance integrity key.
+package erasure
+
+import (
+	"crypto/ed25519"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/joaovrmoraes/bataudit/internal/integrity"
+)
+
+const receiptVersion = "bataudit-erasure-receipt-v1"
+
+type SubjectType string
+
+const (
+	SubjectIdentifier SubjectType = "identifier"
+	SubjectEmail      SubjectType = "email"
+)
+
+type Mode string
+
+const (
+	// ModePseudonymize replaces the identifier with a pseudonym that is the
+	// same for every event of the subject, so per-user statistics and
+	// sessions still add up.
+	ModePseudonymize Mode = "pseudonymize"
+	// ModeRemove replaces the identifier with "erased" and also clears the
+	// session ID and error message, leaving nothing that links the events.
+	ModeRemove Mode = "remove"
+)
+
+// removedIdentifier replaces the identifier in ModeRemove.
+const removedIdentifier = "erased"
+
+type Status string
+
+const (
+	StatusPending   Status = "pending"
+	StatusRunning   Status = "running"
+	StatusCompleted Status = "completed"
+	StatusFailed    Status = "failed"
+)
+
+// Request is a data-subject erasure request. Subject is kept only until the
+// request completes; afterwards the subject is known by SubjectHash, which is
+// SHA-256(Salt || subject).
+type Request struct {
+	ID             string      `json:"id"               gorm:"primaryKey"`
+	ProjectID      string      `json:"project_id"`
+	SubjectType    SubjectType `json:"subject_type"`
+	Subject        string      `json:"-"`
+	Salt           string      `json:"-"`
+	SubjectHash    string      `json:"subject_hash"`
+	Pseudonym      string      `json:"pseudonym"`
+	Mode           Mode        `json:"mode"`
+	Reason         string      `json:"reason"`
+	Status         Status      `json:"status"`
+	Events         int64       `json:"events"`          // live events erased
+	RestoredEvents int64       `json:"restored_events"` // rehydrated copies erased
+	HeldEvents     int64       `json:"held_events"`     // left untouched by a legal hold
+	Error          string      `json:"error,omitempty"`
+	RequestedBy    string      `json:"requested_by"`
+	RequestEventID string      `json:"request_event_id"` // system.erasure event recording the request
+	KeyID          string      `json:"key_id,omitempty"`
+	PublicKey      string      `json:"-"`
+	Signature      string      `json:"-"`
+	CreatedAt      time.Time   `json:"created_at"`
+	StartedAt      *time.Time  `json:"started_at,omitempty"`
+	CompletedAt    *time.Time  `json:"completed_at,omitempty"`
+}
+
+func (Request) TableName() string { return "erasure_requests" }
+
+// normalize returns the canonical form of a subject: emails compare
+// case-insensitively, identifiers exactly.
+func normalize(t SubjectType, subject string) string {
+	subject = strings.TrimSpace(subject)
+	if t == SubjectEmail {
+		return strings.ToLower(subject)
+	}
+	return subject
+}
+
+func subjectHash(salt, subject string) string {
+	sum := sha256.Sum256([]byte(salt + subject))
+	return hex.EncodeToString(sum[:])
+}
+
+func pseudonym(salt, subject string) string {
+	sum := sha256.Sum256([]byte("pseudonym\n" + salt + "\n" + subject))
+	return "erased-" + hex.EncodeToString(sum[:8])
+}
+
+// identifier is what the subject's identifier becomes.
+func (r *Request) identifier() string {
+	if r.Mode == ModeRemove {
+		return removedIdentifier
+	}
+	return r.Pseudonym
+}
+
+// Receipt is the signed record of a completed erasure. Anyone holding the
+// subject can check it refers to them: SubjectHash = SHA-256(Salt || subject),
+// with emails lower-cased.
+type Receipt struct {
+	Version        string      `json:"version"`
+	ErasureID      string      `json:"erasure_id"`
+	ProjectID      string      `json:"project_id"`
+	SubjectType    SubjectType `json:"subject_type"`
+	Salt           string      `json:"salt"`
+	SubjectHash    string      `json:"subject_hash"`
+	Mode           Mode        `json:"mode"`
+	Events         int64       `json:"events"`
+	RestoredEvents int64       `json:"restored_events"`
+	HeldEvents     int64       `json:"held_events"`
+	RequestEventID string      `json:"request_event_id"`
+	RequestedBy    string      `json:"requested_by"`
+	RequestedAt    time.Time   `json:"requested_at"`
+	CompletedAt    time.Time   `json:"completed_at"`
+	KeyID          string      `json:"key_id"`
+	PublicKey      string      `json:"public_key"`
+	Signature      string      `json:"signature"`
+}
+
+// Receipt returns the request's receipt, or nil until it has completed.
+func (r *Request) Receipt() *Receipt {
+	if r.Status != StatusCompleted || r.CompletedAt == nil {
+		return nil
+	}
+	return &Receipt{
+		Version:        receiptVersion,
+		ErasureID:      r.ID,
+		ProjectID:      r.ProjectID,
+		SubjectType:    r.SubjectType,
+		Salt:           r.Salt,
+		SubjectHash:    r.SubjectHash,
+		Mode:           r.Mode,
+		Events:         r.Events,
+		RestoredEvents: r.RestoredEvents,
+		HeldEvents:     r.HeldEvents,
+		RequestEventID: r.RequestEventID,
+		RequestedBy:    r.RequestedBy,
+		RequestedAt:    r.CreatedAt.UTC(),
+		CompletedAt:    r.CompletedAt.UTC(),
+		KeyID:          r.KeyID,
+		PublicKey:      r.PublicKey,
+		Signature:      r.Signature,
+	}
+}
+
+// Message returns the bytes the signature covers.
+func (rc *Receipt) Message() []byte {
+	return []byte(strings.Join([]string{
+		receiptVersion,
+		rc.ErasureID,
+		rc.ProjectID,
+		string(rc.SubjectType),
+		rc.Salt,
+		rc.SubjectHash,
+		string(rc.Mode),
+		strconv.FormatInt(rc.Events, 10),
+		strconv.FormatInt(rc.RestoredEvents, 10),
+		strconv.FormatInt(rc.HeldEvents, 10),
+		rc.RequestEventID,
+		rc.RequestedBy,
+		rc.RequestedAt.UTC().Format(time.RFC3339Nano),
+		rc.CompletedAt.UTC().Format(time.RFC3339Nano),
+		rc.KeyID,
+	}, "\n"))
+}
+
+// Verify checks the receipt's signature against its own public key or, when
+// trusted is set, against that key.
+func (rc *Receipt) Verify(trusted ed25519.PublicKey) error {
+	pub, err := integrity.ParsePublicKey(rc.PublicKey)
+	if err != nil {
+		return err
+	}
+	if trusted != nil && !pub.Equal(trusted) {
+		return errors.New("erasure: receipt is not signed by the trusted key")
+	}
+	if integrity.KeyID(pub) != rc.KeyID {
+		return errors.New("erasure: key id does not match the public key")
+	}
+	sig, err := base64.StdEncoding.DecodeString(rc.Signature)
+	if err != nil || !ed25519.Verify(pub, rc.Message(), sig) {
+		return errors.New("erasure: invalid receipt signature")
+	}
+	return nil
+}
@@ -0,0 +1,131 @@
+package erasure
+
+import (
+	"context"
+	"encoding/json"
+	"time"
+
+	"github.com/joaovrmoraes/bataudit/internal/audit"
+	"gorm.io/datatypes"
+	"gorm.io/gorm"
+)
+
+// The personal data of an erased event is cleared by assignments in SQL and
+// by redact in memory; the two must stay in step.
+
+// match returns the condition selecting the subject's events.
+func (r *Request) match() (string, []interface{}) {
+	if r.SubjectType == SubjectEmail {
+		return "LOWER(user_email) = ?", []interface{}{r.Subject}
+	}
+	return "identifier = ?", []interface{}{r.Subject}
+}
+
+// assignments returns the column updates that erase an event.
+func (r *Request) assignments(now time.Time) map[string]interface{} {
+	set := map[string]interface{}{
+		"identifier":    r.identifier(),
+		"user_email":    "",
+		"user_name":     "",
+		"ip":            "",
+		"user_agent":    "",
+		"query_params":  nil,
+		"path_params":   nil,
+		"request_body":  nil,
+		"response_body": nil,
+		"erased_at":     now,
+	}
+	if r.Mode == ModeRemove {
+		set["session_id"] = ""
+		set["error_message"] = ""
+	}
+	return set
+}
+
+// redact erases ev in memory, as assignments does in SQL.
+func (r *Request) redact(ev *audit.Audit, now time.Time) {
+	ev.Identifier = r.identifier()
+	ev.UserEmail, ev.UserName, ev.IP, ev.UserAgent = "", "", "", ""
+	ev.QueryParams, ev.PathParams, ev.RequestBody, ev.ResponseBody = nil, nil, nil, nil
+	if r.Mode == ModeRemove {
+		ev.SessionID, ev.ErrorMessage = "", ""
+	}
+	ev.ErasedAt = &now
+}
+
+// alertIdentifier returns the identifier an anomaly alert was raised for.
+func alertIdentifier(ev *audit.Audit) string {
+	if ev.EventType != "system.alert" || len(ev.RequestBody) == 0 {
+		return ""
+	}
+	var details map[string]any
+	if json.Unmarshal(ev.RequestBody, &details) != nil {
+		return ""
+	}
+	s, _ := details["identifier"].(string)
+	return s
+}
+
+// redactAlert replaces the identifier in an alert's details, as eraseAlerts
+// does in SQL.
+func (r *Request) redactAlert(ev *audit.Audit, now time.Time) {
+	var details map[string]any
+	if json.Unmarshal(ev.RequestBody, &details) != nil {
+		return
+	}
+	details["identifier"] = r.identifier()
+	body, _ := json.Marshal(details)
+	ev.RequestBody = datatypes.JSON(body)
+	ev.ErasedAt = &now
+}
+
+// matches reports whether value belongs to the request's subject.
+func (r *Request) matches(value string) bool {
+	return value != "" && subjectHash(r.Salt, normalize(r.SubjectType, value)) == r.SubjectHash
+}
+
+// Redactor applies erasure requests to events restored from the archive,
+// whose files are write-once and keep the original data.
+type Redactor struct {
+	db *gorm.DB
+}
+
+func NewRedactor(db *gorm.DB) *Redactor {
+	return &Redactor{db: db}
+}
+
+// Redact erases, in place, the events that belong to the subject of any of
+// the project's erasure requests that has not failed.
+func (r *Redactor) Redact(ctx context.Context, projectID string, events []audit.Audit) error {
+	var reqs []Request
+	err := r.db.WithContext(ctx).
+		Where("project_id = ? AND status <> ?", projectID, StatusFailed).
+		Find(&reqs).Error
+	if err != nil || len(reqs) == 0 {
+		return err
+	}
+
+	now := time.Now().UTC().Truncate(time.Microsecond)
+	for i := range events {
+		ev := &events[i]
+		if ev.ErasedAt != nil {
+			continue
+		}
+		for k := range reqs {
+			req := &reqs[k]
+			value := ev.Identifier
+			if req.SubjectType == SubjectEmail {
+				value = ev.UserEmail
+			}
+			if req.matches(value) {
+				req.redact(ev, now)
+				break
+			}
+			if req.SubjectType == SubjectIdentifier && req.matches(alertIdentifier(ev)) {
+				req.redactAlert(ev, now)
+				break
+			}
+		}
+	}
+	return nil
+}
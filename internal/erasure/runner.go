@@ -0,0 +1,255 @@
+package erasure
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"time"
+
+	"github.com/joaovrmoraes/bataudit/internal/integrity"
+	"github.com/joaovrmoraes/bataudit/internal/legalhold"
+	"gorm.io/gorm"
+)
+
+const (
+	DefaultPollInterval = 30 * time.Second
+	// staleAfter is how long a running request may go without finishing
+	// before another Worker picks it up again. Erasure is idempotent.
+	staleAfter = time.Hour
+)
+
+// errReclaimed means another Worker claimed the request while it ran.
+var errReclaimed = errors.New("request was claimed again while running")
+
+// Runner carries out queued erasure requests in the Worker.
+type Runner struct {
+	db     *gorm.DB
+	signer *integrity.Signer
+	every  time.Duration
+}
+
+func NewRunner(db *gorm.DB, signer *integrity.Signer) *Runner {
+	return &Runner{db: db, signer: signer, every: DefaultPollInterval}
+}
+
+// WithInterval sets how often queued requests are picked up.
+func (r *Runner) WithInterval(d time.Duration) *Runner {
+	if d > 0 {
+		r.every = d
+	}
+	return r
+}
+
+// NewRunnerFromEnv signs receipts with the integrity key (see
+// integrity.SignerFromEnv) and polls every ERASURE_POLL_INTERVAL.
+func NewRunnerFromEnv(db *gorm.DB, getEnv func(string, string) string) (*Runner, error) {
+	signer, err := integrity.SignerFromEnv(getEnv)
+	if err != nil {
+		return nil, err
+	}
+	every, _ := time.ParseDuration(getEnv("ERASURE_POLL_INTERVAL", ""))
+	return NewRunner(db, signer).WithInterval(every), nil
+}
+
+// Start blocks until ctx is cancelled, running queued requests periodically.
+func (r *Runner) Start(ctx context.Context) {
+	ticker := time.NewTicker(r.every)
+	defer ticker.Stop()
+	for {
+		if n, err := r.RunPending(ctx); err != nil {
+			slog.Error("erasure: run failed", "error", err)
+		} else if n > 0 {
+			slog.Info("erasure: requests completed", "count", n)
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// RunPending carries out every queued request, returning how many completed.
+func (r *Runner) RunPending(ctx context.Context) (int, error) {
+	done := 0
+	for ctx.Err() == nil {
+		req, err := r.claim(ctx)
+		if err != nil || req == nil {
+			return done, err
+		}
+		if err := r.run(ctx, req); err != nil {
+			slog.Error("erasure: request failed", "id", req.ID, "project_id", req.ProjectID, "error", err)
+			continue
+		}
+		done++
+	}
+	return done, nil
+}
+
+// claim marks the oldest queued request as running and returns it, or nil
+// when there is none. Replicas race on the conditional update.
+func (r *Runner) claim(ctx context.Context) (*Request, error) {
+	db := r.db.WithContext(ctx)
+	now := time.Now().UTC().Truncate(time.Microsecond)
+	claimable := func(q *gorm.DB) *gorm.DB {
+		return q.Where("status = ? OR (status = ? AND started_at < ?)",
+			StatusPending, StatusRunning, now.Add(-staleAfter))
+	}
+	for {
+		var list []Request
+		if err := claimable(db).Order("created_at").Limit(1).Find(&list).Error; err != nil {
+			return nil, err
+		}
+		if len(list) == 0 {
+			return nil, nil
+		}
+		req := list[0]
+		res := claimable(db.Model(&Request{}).Where("id = ?", req.ID)).
+			Updates(map[string]interface{}{"status": StatusRunning, "started_at": now})
+		if res.Error != nil {
+			return nil, res.Error
+		}
+		if res.RowsAffected == 1 {
+			req.Status, req.StartedAt = StatusRunning, &now
+			return &req, nil
+		}
+	}
+}
+
+// run erases the subject's data and completes the request with a signed
+// receipt, forgetting the subject, in one transaction: the erased events
+// carry completed_at as their erased_at, so a re-run after a crash must
+// never find them erased by a request that is still running.
+func (r *Runner) run(ctx context.Context, req *Request) error {
+	now := time.Now().UTC().Truncate(time.Microsecond)
+	err := r.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		events, restored, held, err := erase(tx, req, now)
+		if err != nil {
+			return err
+		}
+
+		req.Status = StatusCompleted
+		req.Events, req.RestoredEvents, req.HeldEvents = events, restored, held
+		req.CompletedAt = &now
+		req.KeyID, req.PublicKey = r.signer.KeyID(), r.signer.PublicKey()
+		req.Signature = r.signer.Sign(req.Receipt().Message())
+
+		// A request left running past staleAfter may have been claimed
+		// again; only the latest claim completes it.
+		res := tx.Model(&Request{}).
+			Where("id = ? AND status = ? AND started_at = ?", req.ID, StatusRunning, req.StartedAt).
+			Updates(map[string]interface{}{
+				"status":          req.Status,
+				"subject":         "",
+				"events":          req.Events,
+				"restored_events": req.RestoredEvents,
+				"held_events":     req.HeldEvents,
+				"error":           "",
+				"key_id":          req.KeyID,
+				"public_key":      req.PublicKey,
+				"signature":       req.Signature,
+				"completed_at":    now,
+			})
+		if res.Error != nil {
+			return res.Error
+		}
+		if res.RowsAffected == 0 {
+			return errReclaimed
+		}
+		return nil
+	})
+	if errors.Is(err, errReclaimed) {
+		return err
+	}
+	if err != nil {
+		r.db.Model(&Request{}).Where("id = ? AND started_at = ?", req.ID, req.StartedAt).
+			Updates(map[string]interface{}{"status": StatusFailed, "error": err.Error()})
+		return err
+	}
+	if r.db.Dialector.Name() == "sqlite" {
+		// The full-text index keeps deleted terms until its segments are
+		// merged; merge them so erased values leave the file too.
+		if err := r.db.WithContext(ctx).Exec(`INSERT INTO audit_search (audit_search) VALUES ('optimize')`).Error; err != nil {
+			slog.Warn("erasure: search index merge failed", "id", req.ID, "error", err)
+		}
+	}
+	return nil
+}
+
+// erase clears the subject's personal data from live events, rehydrated
+// copies and sessions, skipping events under a legal hold, and counts the
+// held ones.
+func erase(tx *gorm.DB, req *Request, now time.Time) (events, restored, held int64, err error) {
+	match, args := req.match()
+
+	// Sessions are keyed by identifier, which an email subject's events
+	// carry too; collect them before the events lose it.
+	identifiers := []string{}
+	if req.SubjectType == SubjectIdentifier {
+		identifiers = append(identifiers, req.Subject)
+	} else if err := tx.Table("audits").
+		Where("project_id = ?", req.ProjectID).
+		Where(match, args...).
+		Where(legalhold.NotHeld("audits")).
+		Where("identifier <> '' AND erased_at IS NULL").
+		Distinct().Pluck("identifier", &identifiers).Error; err != nil {
+		return 0, 0, 0, err
+	}
+
+	set := req.assignments(now)
+	for _, t := range []struct {
+		table string
+		n     *int64
+	}{{"audits", &events}, {"audits_rehydrated", &restored}} {
+		res := tx.Table(t.table).
+			Where("project_id = ?", req.ProjectID).
+			Where(match, args...).
+			Where(legalhold.NotHeld(t.table)).
+			Updates(set)
+		if res.Error != nil {
+			return 0, 0, 0, res.Error
+		}
+		*t.n = res.RowsAffected
+	}
+	if req.SubjectType == SubjectIdentifier {
+		n, err := eraseAlerts(tx, req, now)
+		if err != nil {
+			return 0, 0, 0, err
+		}
+		events += n
+	}
+	if len(identifiers) > 0 {
+		// Sessions carry no other personal data.
+		if err := tx.Table("audit_sessions").
+			Where("project_id = ? AND identifier IN ?", req.ProjectID, identifiers).
+			Update("identifier", req.identifier()).Error; err != nil {
+			return 0, 0, 0, err
+		}
+	}
+	err = tx.Table("audits").
+		Where("project_id = ?", req.ProjectID).
+		Where(match, args...).
+		Where(legalhold.Held("audits")).
+		Count(&held).Error
+	return events, restored, held, err
+}
+
+// eraseAlerts replaces the subject in the details of anomaly alerts raised
+// for them.
+func eraseAlerts(tx *gorm.DB, req *Request, now time.Time) (int64, error) {
+	detail := `request_body->>'identifier'`
+	replace := `jsonb_set(request_body, '{identifier}', to_jsonb(CAST(? AS TEXT)))`
+	if tx.Dialector.Name() == "sqlite" {
+		detail = `json_extract(request_body, '$.identifier')`
+		replace = `json_set(request_body, '$.identifier', ?)`
+	}
+	res := tx.Exec(`
+		UPDATE audits SET request_body = `+replace+`, erased_at = ?
+		WHERE project_id = ?
+		  AND event_type = 'system.alert'
+		  AND `+detail+` = ?
+		  AND erased_at IS NULL
+		  AND `+legalhold.NotHeld("audits"),
+		req.identifier(), now, req.ProjectID, req.Subject)
+	return res.RowsAffected, res.Error
+}
@@ -0,0 +1,171 @@
+package fieldcrypt
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/joaovrmoraes/bataudit/internal/audit"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gorm.io/datatypes"
+)
+
+// testKeyring returns a Keyring whose caches hold an active data key for
+// project p1, so no database is needed.
+func testKeyring(t *testing.T, fields ...string) *Keyring {
+	t.Helper()
+	k, err := NewKeyring(nil, bytes.Repeat([]byte{1}, 32))
+	require.NoError(t, err)
+	k.WithFields(fields)
+	dk, err := k.newDataKey("p1")
+	require.NoError(t, err)
+	aead, err := k.unwrap(dk)
+	require.NoError(t, err)
+	k.keys[dk.ID] = aead
+	k.active["p1"] = activeKey{id: dk.ID, loaded: time.Now()}
+	return k
+}
+
+func TestParseFields(t *testing.T) {
+	fields, err := ParseFields(" request_body, response_body ,")
+	require.NoError(t, err)
+	assert.Equal(t, []string{FieldRequestBody, FieldResponseBody}, fields)
+
+	_, err = ParseFields("request_body,user_email")
+	assert.Error(t, err)
+}
+
+func TestNewKeyringFromEnv(t *testing.T) {
+	env := func(vars map[string]string) func(string, string) string {
+		return func(k, def string) string {
+			if v, ok := vars[k]; ok {
+				return v
+			}
+			return def
+		}
+	}
+	key := base64.StdEncoding.EncodeToString(bytes.Repeat([]byte{7}, 32))
+
+	k, err := NewKeyringFromEnv(nil, env(nil))
+	require.NoError(t, err)
+	assert.Nil(t, k, "not configured")
+
+	_, err = NewKeyringFromEnv(nil, env(map[string]string{"FIELD_ENCRYPTION_FIELDS": "request_body"}))
+	assert.Error(t, err, "fields without a key")
+
+	_, err = NewKeyringFromEnv(nil, env(map[string]string{"FIELD_ENCRYPTION_KEY": base64.StdEncoding.EncodeToString([]byte("short"))}))
+	assert.Error(t, err)
+
+	k, err = NewKeyringFromEnv(nil, env(map[string]string{"FIELD_ENCRYPTION_KEY": key, "FIELD_ENCRYPTION_FIELDS": "query_params"}))
+	require.NoError(t, err)
+	assert.Equal(t, []string{FieldQueryParams}, k.Fields())
+	assert.Len(t, k.MasterKeyID(), 16)
+}
+
+func TestSealOpen(t *testing.T) {
+	k := testKeyring(t, FieldRequestBody, FieldQueryParams)
+	ctx := context.Background()
+	ev := &audit.Audit{
+		ID:           "11111111-1111-1111-1111-111111111111",
+		ProjectID:    "p1",
+		RequestBody:  datatypes.JSON(`{"password":"hunter2"}`),
+		ResponseBody: datatypes.JSON(`{"ok":true}`),
+		QueryParams:  datatypes.JSON(`null`),
+	}
+	require.NoError(t, k.Seal(ctx, ev))
+
+	s, ok := audit.ParseSealed(ev.RequestBody)
+	require.True(t, ok)
+	assert.Equal(t, k.active["p1"].id, s.KeyID)
+	assert.NotContains(t, string(ev.RequestBody), "hunter2")
+	assert.JSONEq(t, `{"ok":true}`, string(ev.ResponseBody), "not configured")
+	assert.Equal(t, "null", string(ev.QueryParams), "empty values are not sealed")
+
+	sealed := ev.RequestBody
+	require.NoError(t, k.Seal(ctx, ev))
+	assert.Equal(t, sealed, ev.RequestBody, "sealed values are not sealed twice")
+
+	opened := *ev
+	require.NoError(t, k.Open(ctx, &opened))
+	assert.JSONEq(t, `{"password":"hunter2"}`, string(opened.RequestBody))
+
+	// A value moved to another event or column does not decrypt.
+	moved := *ev
+	moved.ID = "22222222-2222-2222-2222-222222222222"
+	assert.Error(t, k.Open(ctx, &moved))
+	swapped := *ev
+	swapped.ResponseBody = ev.RequestBody
+	swapped.RequestBody = nil
+	assert.Error(t, k.Open(ctx, &swapped))
+
+	// Tampered ciphertext does not decrypt.
+	s.Data = base64.StdEncoding.EncodeToString(append([]byte("x"), []byte(s.Data)...))
+	tampered := *ev
+	tampered.RequestBody, _ = json.Marshal(s)
+	assert.Error(t, k.Open(ctx, &tampered))
+}
+
+func TestReseal_keepsChainHash(t *testing.T) {
+	k := testKeyring(t, FieldRequestBody)
+	ctx := context.Background()
+	ev := &audit.Audit{
+		ID:          "11111111-1111-1111-1111-111111111111",
+		ProjectID:   "p1",
+		Method:      audit.POST,
+		Path:        "/login",
+		RequestBody: datatypes.JSON(`{"password":"hunter2"}`),
+		Timestamp:   time.Date(2026, 10, 19, 9, 0, 0, 0, time.UTC),
+	}
+	require.NoError(t, k.Seal(ctx, ev))
+	before, err := audit.ChainHash(ev, "")
+	require.NoError(t, err)
+	old, _ := audit.ParseSealed(ev.RequestBody)
+
+	// Rotate in memory: a new active key for the project.
+	dk, err := k.newDataKey("p1")
+	require.NoError(t, err)
+	aead, err := k.unwrap(dk)
+	require.NoError(t, err)
+	k.keys[dk.ID] = aead
+	k.active["p1"] = activeKey{id: dk.ID, loaded: time.Now()}
+
+	ev.RequestBody, err = k.reseal(ctx, ev.ID, ev.ProjectID, FieldRequestBody, old)
+	require.NoError(t, err)
+	s, _ := audit.ParseSealed(ev.RequestBody)
+	assert.Equal(t, dk.ID, s.KeyID)
+	assert.Equal(t, old.ID, s.ID)
+
+	after, err := audit.ChainHash(ev, "")
+	require.NoError(t, err)
+	assert.Equal(t, before, after)
+
+	require.NoError(t, k.Open(ctx, ev))
+	assert.JSONEq(t, `{"password":"hunter2"}`, string(ev.RequestBody))
+}
+
+func TestUnwrap_previousMaster(t *testing.T) {
+	oldMaster := bytes.Repeat([]byte{1}, 32)
+	old, err := NewKeyring(nil, oldMaster)
+	require.NoError(t, err)
+	dk, err := old.newDataKey("p1")
+	require.NoError(t, err)
+
+	current, err := NewKeyring(nil, bytes.Repeat([]byte{2}, 32))
+	require.NoError(t, err)
+	_, err = current.unwrap(dk)
+	assert.Error(t, err, "old master not configured")
+
+	rotated, err := NewKeyring(nil, bytes.Repeat([]byte{2}, 32), oldMaster)
+	require.NoError(t, err)
+	_, err = rotated.unwrap(dk)
+	assert.NoError(t, err)
+
+	// The wrapped key is bound to its project.
+	dk.ProjectID = "p2"
+	_, err = rotated.unwrap(dk)
+	assert.Error(t, err)
+}
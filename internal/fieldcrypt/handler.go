@@ -0,0 +1,112 @@
+package fieldcrypt
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/joaovrmoraes/bataudit/internal/auth"
+)
+
+type Handler struct {
+	keyring *Keyring // nil = field encryption not configured
+}
+
+func NewHandler(keyring *Keyring) *Handler {
+	return &Handler{keyring: keyring}
+}
+
+// RegisterRoutes mounts the field encryption endpoints onto an
+// already-JWT-protected group. Expected base path: /v1/encryption
+func (h *Handler) RegisterRoutes(rg *gin.RouterGroup) {
+	rg.GET("/keys", h.ListKeys)
+	rg.POST("/keys/rotate", h.Rotate)
+}
+
+type keysResponse struct {
+	Fields      []string  `json:"fields"`
+	MasterKeyID string    `json:"master_key_id"`
+	Keys        []DataKey `json:"keys"`
+}
+
+// ListKeys godoc
+// @Summary      List a project's field encryption keys
+// @Description  Returns the encrypted columns, the current master key ID and the project's data keys, newest first. Key material is never returned.
+// @Tags         encryption
+// @Produce      json
+// @Security     BearerAuth
+// @Param        project_id  query  string  true  "Project ID"
+// @Success      200  {object}  keysResponse
+// @Failure      400  {object}  map[string]string
+// @Failure      403  {object}  map[string]string
+// @Failure      503  {object}  map[string]string
+// @Router       /encryption/keys [get]
+func (h *Handler) ListKeys(c *gin.Context) {
+	if !auth.RequireManager(c) {
+		return
+	}
+	if !h.configured(c) {
+		return
+	}
+	projectID := c.Query("project_id")
+	if projectID == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "project_id required"})
+		return
+	}
+	keys, err := h.keyring.Keys(projectID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	fields := h.keyring.Fields()
+	if fields == nil {
+		fields = []string{}
+	}
+	c.JSON(http.StatusOK, keysResponse{Fields: fields, MasterKeyID: h.keyring.MasterKeyID(), Keys: keys})
+}
+
+type rotateRequest struct {
+	ProjectID string `json:"project_id" binding:"required"`
+}
+
+// Rotate godoc
+// @Summary      Rotate a project's data key
+// @Description  Retires the project's active data key and creates a new one for new events. The Worker then re-encrypts live events sealed with the retired key in the background; the key's reencrypted_at is set when it is done. Archive files keep the retired key, which is never deleted.
+// @Tags         encryption
+// @Accept       json
+// @Produce      json
+// @Security     BearerAuth
+// @Param        body  body  rotateRequest  true  "Project"
+// @Success      201  {object}  DataKey
+// @Failure      400  {object}  map[string]string
+// @Failure      403  {object}  map[string]string
+// @Failure      503  {object}  map[string]string
+// @Router       /encryption/keys/rotate [post]
+func (h *Handler) Rotate(c *gin.Context) {
+	claims := c.MustGet("claims").(*auth.Claims)
+	if claims.Role != auth.RoleOwner {
+		c.JSON(http.StatusForbidden, gin.H{"error": "owner only"})
+		return
+	}
+	if !h.configured(c) {
+		return
+	}
+	var body rotateRequest
+	if err := c.ShouldBindJSON(&body); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	dk, err := h.keyring.Rotate(body.ProjectID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusCreated, dk)
+}
+
+func (h *Handler) configured(c *gin.Context) bool {
+	if h.keyring == nil {
+		c.JSON(http.StatusServiceUnavailable, gin.H{"error": "field encryption is not configured"})
+		return false
+	}
+	return true
+}
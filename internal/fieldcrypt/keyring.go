@@ -0,0 +1,452 @@
+package fieldcrypt
+
+import (
+	"bytes"
+	"context"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/joaovrmoraes/bataudit/internal/audit"
+	"gorm.io/datatypes"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+const (
+	keyVersion   = "bataudit-field-key-v1"
+	valueVersion = "bataudit-field-v1"
+	// activeTTL is how long a project's active key is cached. A rotation in
+	// another process is picked up within this time.
+	activeTTL = time.Minute
+)
+
+// masterKey wraps data keys.
+type masterKey struct {
+	id   string
+	aead cipher.AEAD
+}
+
+func newMasterKey(raw []byte) (masterKey, error) {
+	if len(raw) != 32 {
+		return masterKey{}, fmt.Errorf("fieldcrypt: master key must be 32 bytes, got %d", len(raw))
+	}
+	aead, err := newAEAD(raw)
+	if err != nil {
+		return masterKey{}, err
+	}
+	sum := sha256.Sum256(raw)
+	return masterKey{id: hex.EncodeToString(sum[:8]), aead: aead}, nil
+}
+
+func newAEAD(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+// seal encrypts plaintext with a random nonce, returning base64(nonce || ciphertext).
+func seal(aead cipher.AEAD, plaintext, ad []byte) (string, error) {
+	nonce := make([]byte, aead.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return "", err
+	}
+	return base64.StdEncoding.EncodeToString(aead.Seal(nonce, nonce, plaintext, ad)), nil
+}
+
+func open(aead cipher.AEAD, sealed string, ad []byte) ([]byte, error) {
+	data, err := base64.StdEncoding.DecodeString(sealed)
+	if err != nil || len(data) < aead.NonceSize() {
+		return nil, errors.New("malformed ciphertext")
+	}
+	n := aead.NonceSize()
+	return aead.Open(nil, data[:n], data[n:], ad)
+}
+
+func keyAD(id, projectID string) []byte {
+	return []byte(keyVersion + "\n" + id + "\n" + projectID)
+}
+
+// valueAD binds a sealed value to its event, column and envelope ID, so it
+// cannot be moved to another event or column.
+func valueAD(eventID, field, sealedID string) []byte {
+	return []byte(valueVersion + "\n" + eventID + "\n" + field + "\n" + sealedID)
+}
+
+func randomHex(n int) (string, error) {
+	b := make([]byte, n)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
+
+type activeKey struct {
+	id     string
+	loaded time.Time
+}
+
+// Keyring seals and opens event columns with per-project data keys.
+type Keyring struct {
+	db      *gorm.DB
+	current masterKey
+	masters map[string]masterKey // by ID, current included
+	fields  []string             // columns sealed on ingest
+
+	mu     sync.Mutex
+	keys   map[string]cipher.AEAD // unwrapped data keys by ID
+	active map[string]activeKey   // by project
+}
+
+// NewKeyring uses master to wrap new data keys and previous, if any, to
+// unwrap data keys not yet rewrapped after a master key rotation. Both are
+// raw 32-byte keys.
+func NewKeyring(db *gorm.DB, master []byte, previous ...[]byte) (*Keyring, error) {
+	current, err := newMasterKey(master)
+	if err != nil {
+		return nil, err
+	}
+	k := &Keyring{
+		db:      db,
+		current: current,
+		masters: map[string]masterKey{current.id: current},
+		keys:    map[string]cipher.AEAD{},
+		active:  map[string]activeKey{},
+	}
+	for _, raw := range previous {
+		m, err := newMasterKey(raw)
+		if err != nil {
+			return nil, err
+		}
+		k.masters[m.id] = m
+	}
+	return k, nil
+}
+
+// WithFields sets the columns Seal encrypts.
+func (k *Keyring) WithFields(fields []string) *Keyring {
+	k.fields = fields
+	return k
+}
+
+// Fields returns the columns Seal encrypts.
+func (k *Keyring) Fields() []string { return k.fields }
+
+// MasterKeyID identifies the master key new data keys are wrapped with.
+func (k *Keyring) MasterKeyID() string { return k.current.id }
+
+// NewKeyringFromEnv builds a Keyring from FIELD_ENCRYPTION_KEY (or the file
+// named by FIELD_ENCRYPTION_KEY_FILE), FIELD_ENCRYPTION_PREVIOUS_KEYS and
+// FIELD_ENCRYPTION_FIELDS. Returns nil when no master key is configured; it
+// is an error to name fields without one.
+func NewKeyringFromEnv(db *gorm.DB, getEnv func(string, string) string) (*Keyring, error) {
+	fields, err := ParseFields(getEnv("FIELD_ENCRYPTION_FIELDS", ""))
+	if err != nil {
+		return nil, err
+	}
+
+	encoded := getEnv("FIELD_ENCRYPTION_KEY", "")
+	if encoded == "" {
+		if path := getEnv("FIELD_ENCRYPTION_KEY_FILE", ""); path != "" {
+			data, err := os.ReadFile(path)
+			if err != nil {
+				return nil, fmt.Errorf("fieldcrypt: %w", err)
+			}
+			encoded = string(data)
+		}
+	}
+	if encoded == "" {
+		if len(fields) > 0 {
+			return nil, errors.New("fieldcrypt: FIELD_ENCRYPTION_FIELDS is set but no master key is (set FIELD_ENCRYPTION_KEY or FIELD_ENCRYPTION_KEY_FILE)")
+		}
+		return nil, nil
+	}
+	master, err := base64.StdEncoding.DecodeString(strings.TrimSpace(encoded))
+	if err != nil {
+		return nil, fmt.Errorf("fieldcrypt: master key: %w", err)
+	}
+
+	var previous [][]byte
+	for _, s := range strings.Split(getEnv("FIELD_ENCRYPTION_PREVIOUS_KEYS", ""), ",") {
+		if s = strings.TrimSpace(s); s == "" {
+			continue
+		}
+		raw, err := base64.StdEncoding.DecodeString(s)
+		if err != nil {
+			return nil, fmt.Errorf("fieldcrypt: previous master key: %w", err)
+		}
+		previous = append(previous, raw)
+	}
+
+	k, err := NewKeyring(db, master, previous...)
+	if err != nil {
+		return nil, err
+	}
+	return k.WithFields(fields), nil
+}
+
+// Seal encrypts the configured columns of ev in place with its project's
+// active data key. Empty and already sealed columns are left alone.
+func (k *Keyring) Seal(ctx context.Context, ev *audit.Audit) error {
+	for _, field := range k.fields {
+		col := column(ev, field)
+		if isEmpty(*col) {
+			continue
+		}
+		if _, ok := audit.ParseSealed(*col); ok {
+			continue
+		}
+		keyID, aead, err := k.activeKey(ctx, ev.ProjectID)
+		if err != nil {
+			return err
+		}
+		id, err := randomHex(16)
+		if err != nil {
+			return err
+		}
+		sealed, err := sealValue(aead, keyID, id, ev.ID, field, *col)
+		if err != nil {
+			return err
+		}
+		*col = sealed
+	}
+	return nil
+}
+
+// Open decrypts, in place, every sealed column of ev.
+func (k *Keyring) Open(ctx context.Context, ev *audit.Audit) error {
+	for _, field := range sealable {
+		col := column(ev, field)
+		s, ok := audit.ParseSealed(*col)
+		if !ok {
+			continue
+		}
+		aead, err := k.dataKey(ctx, s.KeyID)
+		if err != nil {
+			return fmt.Errorf("%s: %w", field, err)
+		}
+		plain, err := open(aead, s.Data, valueAD(ev.ID, field, s.ID))
+		if err != nil {
+			return fmt.Errorf("%s: cannot decrypt: %w", field, err)
+		}
+		*col = datatypes.JSON(plain)
+	}
+	return nil
+}
+
+// reseal re-encrypts a sealed value of an event under the project's active
+// key, keeping its envelope ID so the event's chain hash does not change.
+func (k *Keyring) reseal(ctx context.Context, eventID, projectID, field string, s *audit.Sealed) (datatypes.JSON, error) {
+	old, err := k.dataKey(ctx, s.KeyID)
+	if err != nil {
+		return nil, err
+	}
+	plain, err := open(old, s.Data, valueAD(eventID, field, s.ID))
+	if err != nil {
+		return nil, err
+	}
+	keyID, aead, err := k.activeKey(ctx, projectID)
+	if err != nil {
+		return nil, err
+	}
+	return sealValue(aead, keyID, s.ID, eventID, field, plain)
+}
+
+func sealValue(aead cipher.AEAD, keyID, id, eventID, field string, plain []byte) (datatypes.JSON, error) {
+	ct, err := seal(aead, plain, valueAD(eventID, field, id))
+	if err != nil {
+		return nil, err
+	}
+	out, err := json.Marshal(audit.Sealed{Version: audit.SealedVersion, ID: id, KeyID: keyID, Data: ct})
+	return datatypes.JSON(out), err
+}
+
+func isEmpty(raw datatypes.JSON) bool {
+	t := bytes.TrimSpace(raw)
+	return len(t) == 0 || string(t) == "null"
+}
+
+// activeKey returns the project's active data key, creating it on first use.
+func (k *Keyring) activeKey(ctx context.Context, projectID string) (string, cipher.AEAD, error) {
+	k.mu.Lock()
+	a, ok := k.active[projectID]
+	k.mu.Unlock()
+	if ok && time.Since(a.loaded) < activeTTL {
+		aead, err := k.dataKey(ctx, a.id)
+		return a.id, aead, err
+	}
+
+	db := k.db.WithContext(ctx)
+	var list []DataKey
+	if err := db.Where("project_id = ? AND status = ?", projectID, KeyActive).Limit(1).Find(&list).Error; err != nil {
+		return "", nil, err
+	}
+	if len(list) == 0 {
+		dk, err := k.newDataKey(projectID)
+		if err != nil {
+			return "", nil, err
+		}
+		// Replicas race to create the first key; one insert wins.
+		if err := db.Clauses(clause.OnConflict{DoNothing: true}).Create(dk).Error; err != nil {
+			return "", nil, err
+		}
+		if err := db.Where("project_id = ? AND status = ?", projectID, KeyActive).Limit(1).Find(&list).Error; err != nil {
+			return "", nil, err
+		}
+		if len(list) == 0 {
+			return "", nil, errors.New("fieldcrypt: no active data key")
+		}
+	}
+
+	aead, err := k.unwrap(&list[0])
+	if err != nil {
+		return "", nil, err
+	}
+	k.mu.Lock()
+	k.keys[list[0].ID] = aead
+	k.active[projectID] = activeKey{id: list[0].ID, loaded: time.Now()}
+	k.mu.Unlock()
+	return list[0].ID, aead, nil
+}
+
+// dataKey returns a data key by ID, active or retired.
+func (k *Keyring) dataKey(ctx context.Context, id string) (cipher.AEAD, error) {
+	k.mu.Lock()
+	aead, ok := k.keys[id]
+	k.mu.Unlock()
+	if ok {
+		return aead, nil
+	}
+	var dk DataKey
+	if err := k.db.WithContext(ctx).Where("id = ?", id).First(&dk).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, fmt.Errorf("fieldcrypt: unknown data key %s", id)
+		}
+		return nil, err
+	}
+	aead, err := k.unwrap(&dk)
+	if err != nil {
+		return nil, err
+	}
+	k.mu.Lock()
+	k.keys[id] = aead
+	k.mu.Unlock()
+	return aead, nil
+}
+
+// newDataKey generates an active data key wrapped by the current master key.
+func (k *Keyring) newDataKey(projectID string) (*DataKey, error) {
+	id, err := randomHex(8)
+	if err != nil {
+		return nil, err
+	}
+	raw := make([]byte, 32)
+	if _, err := rand.Read(raw); err != nil {
+		return nil, err
+	}
+	wrapped, err := seal(k.current.aead, raw, keyAD(id, projectID))
+	if err != nil {
+		return nil, err
+	}
+	return &DataKey{
+		ID:          id,
+		ProjectID:   projectID,
+		Status:      KeyActive,
+		MasterKeyID: k.current.id,
+		Wrapped:     wrapped,
+		CreatedAt:   time.Now().UTC(),
+	}, nil
+}
+
+func (k *Keyring) unwrapRaw(dk *DataKey) ([]byte, error) {
+	m, ok := k.masters[dk.MasterKeyID]
+	if !ok {
+		return nil, fmt.Errorf("fieldcrypt: data key %s is wrapped by master key %s, which is not configured (add it to FIELD_ENCRYPTION_PREVIOUS_KEYS)", dk.ID, dk.MasterKeyID)
+	}
+	raw, err := open(m.aead, dk.Wrapped, keyAD(dk.ID, dk.ProjectID))
+	if err != nil {
+		return nil, fmt.Errorf("fieldcrypt: cannot unwrap data key %s: %w", dk.ID, err)
+	}
+	return raw, nil
+}
+
+func (k *Keyring) unwrap(dk *DataKey) (cipher.AEAD, error) {
+	raw, err := k.unwrapRaw(dk)
+	if err != nil {
+		return nil, err
+	}
+	return newAEAD(raw)
+}
+
+// Keys returns a project's data keys, newest first.
+func (k *Keyring) Keys(projectID string) ([]DataKey, error) {
+	var list []DataKey
+	err := k.db.Where("project_id = ?", projectID).Order("created_at DESC").Find(&list).Error
+	return list, err
+}
+
+// Rotate retires the project's active data key and creates a new one. The
+// Worker's Rotator then re-encrypts live events sealed with the old key.
+func (k *Keyring) Rotate(projectID string) (*DataKey, error) {
+	dk, err := k.newDataKey(projectID)
+	if err != nil {
+		return nil, err
+	}
+	err = k.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Model(&DataKey{}).
+			Where("project_id = ? AND status = ?", projectID, KeyActive).
+			Updates(map[string]any{"status": KeyRetired, "retired_at": dk.CreatedAt}).Error; err != nil {
+			return err
+		}
+		return tx.Create(dk).Error
+	})
+	if err != nil {
+		return nil, err
+	}
+	k.mu.Lock()
+	delete(k.active, projectID)
+	k.mu.Unlock()
+	return dk, nil
+}
+
+// Rewrap rewraps data keys wrapped by a previous master key with the current
+// one. Returns the number rewrapped.
+func (k *Keyring) Rewrap(ctx context.Context) (int, error) {
+	db := k.db.WithContext(ctx)
+	var list []DataKey
+	if err := db.Where("master_key_id <> ?", k.current.id).Find(&list).Error; err != nil {
+		return 0, err
+	}
+	n := 0
+	for i := range list {
+		dk := &list[i]
+		raw, err := k.unwrapRaw(dk)
+		if err != nil {
+			return n, err
+		}
+		wrapped, err := seal(k.current.aead, raw, keyAD(dk.ID, dk.ProjectID))
+		if err != nil {
+			return n, err
+		}
+		res := db.Model(&DataKey{}).
+			Where("id = ? AND master_key_id = ?", dk.ID, dk.MasterKeyID).
+			Updates(map[string]any{"wrapped": wrapped, "master_key_id": k.current.id})
+		if res.Error != nil {
+			return n, res.Error
+		}
+		n += int(res.RowsAffected)
+	}
+	return n, nil
+}
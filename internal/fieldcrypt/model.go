@@ -0,0 +1,83 @@
+// Package fieldcrypt encrypts configured JSON columns of audit events
+// (request and response bodies, query and path parameters) before the Worker
+// stores them. Each project has a data key, wrapped by a master key from the
+// environment; each value is sealed with AES-256-GCM into an audit.Sealed
+// envelope. Only Details decrypts, and only for users with the decrypt
+// permission. Data keys can be rotated, after which the Worker re-encrypts
+// live events in the background; master keys are rotated by rewrapping the
+// data keys.
+package fieldcrypt
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/joaovrmoraes/bataudit/internal/audit"
+	"gorm.io/datatypes"
+)
+
+// Columns that can be encrypted.
+const (
+	FieldQueryParams  = "query_params"
+	FieldPathParams   = "path_params"
+	FieldRequestBody  = "request_body"
+	FieldResponseBody = "response_body"
+)
+
+var sealable = []string{FieldQueryParams, FieldPathParams, FieldRequestBody, FieldResponseBody}
+
+// column returns the field of ev stored in the named column.
+func column(ev *audit.Audit, name string) *datatypes.JSON {
+	switch name {
+	case FieldQueryParams:
+		return &ev.QueryParams
+	case FieldPathParams:
+		return &ev.PathParams
+	case FieldRequestBody:
+		return &ev.RequestBody
+	case FieldResponseBody:
+		return &ev.ResponseBody
+	}
+	return nil
+}
+
+// ParseFields parses a comma-separated list of column names.
+func ParseFields(s string) ([]string, error) {
+	var fields []string
+	for _, f := range strings.Split(s, ",") {
+		f = strings.TrimSpace(f)
+		if f == "" {
+			continue
+		}
+		if column(&audit.Audit{}, f) == nil {
+			return nil, fmt.Errorf("fieldcrypt: %q cannot be encrypted (use %s)", f, strings.Join(sealable, ", "))
+		}
+		fields = append(fields, f)
+	}
+	return fields, nil
+}
+
+type KeyStatus string
+
+const (
+	KeyActive  KeyStatus = "active"
+	KeyRetired KeyStatus = "retired"
+)
+
+// DataKey is a project's data key, stored wrapped by a master key. Retired
+// keys are kept: archive files are write-once and still hold values sealed
+// with them.
+type DataKey struct {
+	ID          string     `json:"id"            gorm:"primaryKey"`
+	ProjectID   string     `json:"project_id"`
+	Status      KeyStatus  `json:"status"`
+	MasterKeyID string     `json:"master_key_id"`
+	Wrapped     string     `json:"-"`
+	CreatedAt   time.Time  `json:"created_at"`
+	RetiredAt   *time.Time `json:"retired_at,omitempty"`
+	// ReencryptedAt is set once no live event is sealed with the retired key.
+	ReencryptedAt *time.Time `json:"reencrypted_at,omitempty"`
+}
+
+func (DataKey) TableName() string { return "field_data_keys" }
@@ -0,0 +1,165 @@
+package fieldcrypt
+
+import (
+	"context"
+	"log/slog"
+	"time"
+
+	"github.com/joaovrmoraes/bataudit/internal/audit"
+	"gorm.io/gorm"
+)
+
+const (
+	reencryptBatch = 500
+	// settleAfter is how long after a rotation a retired key is still checked
+	// for new values: Writers that cached the old active key may keep sealing
+	// with it for up to activeTTL.
+	settleAfter = 2 * activeTTL
+)
+
+// Rotator rewraps data keys after a master key rotation and re-encrypts live
+// events sealed with retired data keys. Archive files are write-once and keep
+// the key they were sealed with.
+type Rotator struct {
+	keyring *Keyring
+	every   time.Duration
+}
+
+func NewRotator(keyring *Keyring) *Rotator {
+	return &Rotator{keyring: keyring, every: 10 * time.Minute}
+}
+
+// WithInterval sets how often the Rotator runs.
+func (r *Rotator) WithInterval(every time.Duration) *Rotator {
+	if every > 0 {
+		r.every = every
+	}
+	return r
+}
+
+// NewRotatorFromEnv reads FIELD_ENCRYPTION_ROTATION_INTERVAL.
+func NewRotatorFromEnv(keyring *Keyring, getEnv func(string, string) string) *Rotator {
+	r := NewRotator(keyring)
+	if d, err := time.ParseDuration(getEnv("FIELD_ENCRYPTION_ROTATION_INTERVAL", "")); err == nil {
+		r.WithInterval(d)
+	}
+	return r
+}
+
+// Start blocks until ctx is cancelled, running periodically.
+func (r *Rotator) Start(ctx context.Context) {
+	ticker := time.NewTicker(r.every)
+	defer ticker.Stop()
+	for {
+		if n, err := r.keyring.Rewrap(ctx); err != nil {
+			slog.Error("field key rewrap failed", "error", err)
+		} else if n > 0 {
+			slog.Info("field keys rewrapped", "count", n, "master_key_id", r.keyring.MasterKeyID())
+		}
+		if n, err := r.Reencrypt(ctx); err != nil {
+			slog.Error("field re-encryption failed", "error", err)
+		} else if n > 0 {
+			slog.Info("fields re-encrypted", "count", n)
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// Reencrypt re-encrypts every live value sealed with a retired data key
+// under its project's active key, and marks keys with none left. The
+// envelope ID is kept, so chain hashes do not change. Returns the number of
+// values re-encrypted.
+func (r *Rotator) Reencrypt(ctx context.Context) (int, error) {
+	db := r.keyring.db.WithContext(ctx)
+	var retired []DataKey
+	if err := db.Where("status = ? AND reencrypted_at IS NULL", KeyRetired).Find(&retired).Error; err != nil {
+		return 0, err
+	}
+	total := 0
+	for i := range retired {
+		dk := &retired[i]
+		left := false
+		for _, table := range []string{"audits", "audits_rehydrated"} {
+			for _, field := range sealable {
+				n, more, err := r.reencrypt(ctx, table, field, dk.ID)
+				total += n
+				if err != nil {
+					return total, err
+				}
+				left = left || more
+			}
+		}
+		if !left && dk.RetiredAt != nil && time.Since(*dk.RetiredAt) > settleAfter {
+			if err := db.Model(&DataKey{}).Where("id = ?", dk.ID).
+				Update("reencrypted_at", time.Now().UTC()).Error; err != nil {
+				return total, err
+			}
+		}
+	}
+	return total, nil
+}
+
+// reencrypt re-encrypts the values of one column sealed with keyID, batch by
+// batch. Reports whether values are left that could not be re-encrypted.
+func (r *Rotator) reencrypt(ctx context.Context, table, field, keyID string) (int, bool, error) {
+	db := r.keyring.db.WithContext(ctx)
+	kid := keyIDExpr(db, field)
+	total := 0
+	for {
+		var rows []struct {
+			ID        string
+			ProjectID string
+			Value     []byte
+		}
+		if err := db.Table(table).
+			Select("id, project_id, "+field+" AS value").
+			Where(kid+" = ?", keyID).
+			Limit(reencryptBatch).
+			Scan(&rows).Error; err != nil {
+			return total, false, err
+		}
+		if len(rows) == 0 {
+			return total, false, nil
+		}
+		progress := 0
+		for _, row := range rows {
+			s, ok := audit.ParseSealed(row.Value)
+			if !ok || s.KeyID != keyID {
+				continue
+			}
+			value, err := r.keyring.reseal(ctx, row.ID, row.ProjectID, field, s)
+			if err != nil {
+				slog.Error("field re-encryption skipped", "table", table, "id", row.ID, "field", field, "error", err)
+				continue
+			}
+			res := db.Table(table).
+				Where("id = ? AND "+kid+" = ?", row.ID, keyID).
+				Update(field, value)
+			if res.Error != nil {
+				return total, true, res.Error
+			}
+			if res.RowsAffected > 0 {
+				progress++
+			}
+		}
+		total += progress
+		// Values that cannot be re-encrypted stay sealed with the old key,
+		// which remains usable; stop rather than loop over them.
+		if progress == 0 {
+			return total, true, nil
+		}
+	}
+}
+
+// keyIDExpr returns the SQL expression extracting the data key ID of a sealed
+// column.
+func keyIDExpr(db *gorm.DB, field string) string {
+	if db.Dialector.Name() == "sqlite" {
+		return "json_extract(" + field + ", '$.kid')"
+	}
+	return field + "->>'kid'"
+}
@@ -0,0 +1,106 @@
+// Package geoip resolves IP addresses to countries from a CSV database of
+// address ranges, one per line: first address, last address, ISO 3166-1
+// alpha-2 code. This is the format of the free DB-IP "IP to Country Lite"
+// and IP2Location LITE exports; both IPv4 and IPv6 ranges are read.
+package geoip
+
+import (
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"net/netip"
+	"os"
+	"sort"
+	"strings"
+)
+
+type ipRange struct {
+	first, last netip.Addr
+	country     string
+}
+
+// DB is a loaded country database. Its lookups are safe for concurrent use.
+type DB struct {
+	ranges []ipRange // by first address, not overlapping
+}
+
+// Load reads a country database.
+func Load(r io.Reader) (*DB, error) {
+	reader := csv.NewReader(r)
+	reader.FieldsPerRecord = -1
+	reader.ReuseRecord = true
+	db := &DB{}
+	for line := 1; ; line++ {
+		record, err := reader.Read()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		if len(record) < 3 {
+			return nil, fmt.Errorf("geoip: line %d: expected first address, last address and country", line)
+		}
+		first, err1 := netip.ParseAddr(strings.TrimSpace(record[0]))
+		last, err2 := netip.ParseAddr(strings.TrimSpace(record[1]))
+		if err1 != nil || err2 != nil {
+			if line == 1 {
+				continue // header
+			}
+			return nil, fmt.Errorf("geoip: line %d: invalid address range", line)
+		}
+		country := strings.ToUpper(strings.TrimSpace(record[2]))
+		if country == "" || country == "-" || country == "ZZ" {
+			continue // unassigned
+		}
+		db.ranges = append(db.ranges, ipRange{first: first.Unmap(), last: last.Unmap(), country: country})
+	}
+	sort.Slice(db.ranges, func(i, j int) bool {
+		return db.ranges[i].first.Less(db.ranges[j].first)
+	})
+	return db, nil
+}
+
+// Open loads the country database at path.
+func Open(path string) (*DB, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	return Load(f)
+}
+
+// NewFromEnv opens the database at GEOIP_COUNTRY_CSV. It returns nil when
+// the variable is unset.
+func NewFromEnv(getEnv func(string, string) string) (*DB, error) {
+	path := getEnv("GEOIP_COUNTRY_CSV", "")
+	if path == "" {
+		return nil, nil
+	}
+	return Open(path)
+}
+
+// Country returns the country code of ip, or "" when ip is invalid or in
+// no range.
+func (db *DB) Country(ip string) string {
+	addr, err := netip.ParseAddr(ip)
+	if err != nil {
+		return ""
+	}
+	addr = addr.Unmap()
+	// The last range starting at or before addr.
+	i := sort.Search(len(db.ranges), func(i int) bool {
+		return addr.Less(db.ranges[i].first)
+	}) - 1
+	if i < 0 || db.ranges[i].last.Less(addr) {
+		return ""
+	}
+	return db.ranges[i].country
+}
+
+// Len is the number of ranges loaded.
+func (db *DB) Len() int {
+	return len(db.ranges)
+}
@@ -0,0 +1,45 @@
+package geoip
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const sample = `ip_start,ip_end,country
+1.0.0.0,1.0.0.255,AU
+1.0.1.0,1.0.3.255,cn
+8.8.8.0,8.8.8.255,US
+10.0.0.0,10.255.255.255,ZZ
+2001:4860::,2001:4860:ffff:ffff:ffff:ffff:ffff:ffff,US
+`
+
+func TestCountry(t *testing.T) {
+	db, err := Load(strings.NewReader(sample))
+	require.NoError(t, err)
+	assert.Equal(t, 4, db.Len(), "header and unassigned ranges are skipped")
+
+	for ip, want := range map[string]string{
+		"1.0.0.0":              "AU",
+		"1.0.0.255":            "AU",
+		"1.0.2.7":              "CN",
+		"8.8.8.8":              "US",
+		"::ffff:8.8.8.8":       "US",
+		"2001:4860:4860::8888": "US",
+		"8.8.9.1":              "",
+		"10.1.2.3":             "",
+		"0.0.0.1":              "",
+		"not an ip":            "",
+	} {
+		assert.Equal(t, want, db.Country(ip), ip)
+	}
+}
+
+func TestLoadRejectsBadLines(t *testing.T) {
+	_, err := Load(strings.NewReader("1.0.0.0,1.0.0.255,AU\n1.0.1.0,nope,CN\n"))
+	assert.Error(t, err)
+	_, err = Load(strings.NewReader("1.0.0.0,1.0.0.255\n"))
+	assert.Error(t, err)
+}
@@ -7,6 +7,8 @@ import (
 	"net/http"
 	"sync"
 	"time"
+
+	"github.com/joaovrmoraes/bataudit/internal/metrics"
 )
 
 // EventSink is implemented by the caller (worker) to persist healthcheck events
@@ -172,6 +174,11 @@ func (p *Poller) recordResult(m *Monitor, status MonitorStatus, statusCode *int,
 		CheckedAt:  now,
 	}
 
+	metrics.HealthcheckResults.Inc(m.Name, string(status))
+	if responseMs != nil {
+		metrics.HealthcheckDuration.Observe(float64(*responseMs)/1000, m.Name)
+	}
+
 	if err := p.repo.SaveResult(result); err != nil {
 		slog.Error("healthcheck: failed to save result", "monitor_id", m.ID, "error", err)
 	}
@@ -0,0 +1,202 @@
+package integrity
+
+import (
+	"bytes"
+	"crypto/ed25519"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/hex"
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/joaovrmoraes/bataudit/internal/audit"
+)
+
+const (
+	DefaultBundleEvents = 1000
+	MaxBundleEvents     = 10_000
+)
+
+// BuildBundle collects up to limit chained events of a project in [from, to]
+// with inclusion proofs into the signed checkpoints covering them.
+func BuildBundle(repo Repository, projectID string, from, to time.Time, limit int) (*Bundle, error) {
+	b := &Bundle{
+		Version:     bundleVersion,
+		ProjectID:   projectID,
+		From:        from.UTC(),
+		To:          to.UTC(),
+		GeneratedAt: time.Now().UTC(),
+		PublicKeys:  map[string]string{},
+		Checkpoints: []Checkpoint{},
+		Events:      []BundleEvent{},
+	}
+	events, err := repo.Events(projectID, from, to, limit)
+	if err != nil || len(events) == 0 {
+		return b, err
+	}
+	cps, err := repo.CheckpointsCovering(projectID, events[0].ChainSeq, events[len(events)-1].ChainSeq)
+	if err != nil {
+		return nil, err
+	}
+
+	trees := map[int64]*Tree{}
+	used := map[int64]bool{}
+	for _, ev := range events {
+		i := sort.Search(len(cps), func(i int) bool { return cps[i].LastSeq >= ev.ChainSeq })
+		if i == len(cps) || cps[i].FirstSeq > ev.ChainSeq {
+			b.Pending++
+			continue
+		}
+		cp := &cps[i]
+		leaves, err := cp.leaves()
+		if err != nil {
+			return nil, err
+		}
+		index := sort.Search(len(leaves), func(j int) bool {
+			return seqOf(leaves[j]) >= ev.ChainSeq
+		})
+		if index == len(leaves) || seqOf(leaves[index]) != ev.ChainSeq {
+			// Stored after its range was signed, which the chain rules out;
+			// leave it to chain verification.
+			b.Pending++
+			continue
+		}
+		tree := trees[cp.ID]
+		if tree == nil {
+			tree = NewTree(leaves)
+			trees[cp.ID] = tree
+		}
+		proof, err := tree.Proof(index)
+		if err != nil {
+			return nil, err
+		}
+		hexProof := make([]string, len(proof))
+		for k, p := range proof {
+			hexProof[k] = hex.EncodeToString(p)
+		}
+		b.Events = append(b.Events, BundleEvent{Event: ev, CheckpointID: cp.ID, LeafIndex: index, Proof: hexProof})
+		used[cp.ID] = true
+	}
+
+	for _, cp := range cps {
+		if used[cp.ID] {
+			b.Checkpoints = append(b.Checkpoints, cp)
+			b.PublicKeys[cp.KeyID] = cp.PublicKey
+		}
+	}
+	return b, nil
+}
+
+func seqOf(leaf []byte) int64 {
+	return int64(binary.BigEndian.Uint64(leaf))
+}
+
+// BundleReport is the outcome of VerifyBundle.
+type BundleReport struct {
+	Valid       bool     `json:"valid"`
+	Events      int      `json:"events"`
+	Erased      int      `json:"erased"`
+	Checkpoints int      `json:"checkpoints"`
+	KeyIDs      []string `json:"key_ids"`
+	Errors      []string `json:"errors,omitempty"`
+}
+
+// VerifyBundle checks a bundle without any other input: every checkpoint
+// signature, every event's hash against its content (unless erased), every inclusion proof
+// against its checkpoint's root, and the chain links between consecutive
+// events. With trusted set, checkpoints must be signed by that key.
+func VerifyBundle(b *Bundle, trusted ed25519.PublicKey) *BundleReport {
+	rep := &BundleReport{Events: len(b.Events), Checkpoints: len(b.Checkpoints), KeyIDs: []string{}}
+	fail := func(format string, args ...any) {
+		rep.Errors = append(rep.Errors, fmt.Sprintf(format, args...))
+	}
+	if b.Version != bundleVersion {
+		fail("unsupported bundle version %d", b.Version)
+		return rep
+	}
+
+	keys := map[string]ed25519.PublicKey{}
+	for id, s := range b.PublicKeys {
+		pub, err := ParsePublicKey(s)
+		switch {
+		case err != nil:
+			fail("public key %s: %v", id, err)
+		case KeyID(pub) != id:
+			fail("public key %s: id does not match the key", id)
+		case trusted != nil && !bytes.Equal(pub, trusted):
+			fail("public key %s is not the trusted key", id)
+		default:
+			keys[id] = pub
+			rep.KeyIDs = append(rep.KeyIDs, id)
+		}
+	}
+	sort.Strings(rep.KeyIDs)
+
+	roots := map[int64]Checkpoint{}
+	for _, cp := range b.Checkpoints {
+		pub, ok := keys[cp.KeyID]
+		if !ok {
+			fail("checkpoint %d: no valid key %s", cp.ID, cp.KeyID)
+			continue
+		}
+		sig, err := base64.StdEncoding.DecodeString(cp.Signature)
+		if err != nil || !ed25519.Verify(pub, cp.Message(), sig) {
+			fail("checkpoint %d: invalid signature", cp.ID)
+			continue
+		}
+		if cp.ProjectID != b.ProjectID {
+			fail("checkpoint %d: belongs to another project", cp.ID)
+			continue
+		}
+		roots[cp.ID] = cp
+	}
+
+	var prev *audit.Audit
+	for i := range b.Events {
+		be := &b.Events[i]
+		ev := &be.Event
+		if ev.ErasedAt != nil {
+			// Personal data was erased after signing: the proof still fixes
+			// the event's hash and position, but not its content.
+			rep.Erased++
+		} else if hash, err := audit.ChainHash(ev, ev.PrevHash); err != nil || hash != ev.Hash {
+			fail("event %s (seq %d): content does not match its hash", ev.ID, ev.ChainSeq)
+		}
+		if ev.ProjectID != b.ProjectID {
+			fail("event %s (seq %d): belongs to another project", ev.ID, ev.ChainSeq)
+		}
+		if prev != nil && ev.ChainSeq == prev.ChainSeq+1 && ev.PrevHash != prev.Hash {
+			fail("event %s (seq %d): does not link to the previous event", ev.ID, ev.ChainSeq)
+		}
+		prev = ev
+
+		cp, ok := roots[be.CheckpointID]
+		if !ok {
+			fail("event %s (seq %d): no verified checkpoint %d", ev.ID, ev.ChainSeq, be.CheckpointID)
+			continue
+		}
+		if ev.ChainSeq < cp.FirstSeq || ev.ChainSeq > cp.LastSeq {
+			fail("event %s (seq %d): outside checkpoint %d", ev.ID, ev.ChainSeq, cp.ID)
+			continue
+		}
+		leaf, err := encodeLeaf(ev.ChainSeq, ev.Hash)
+		if err != nil {
+			fail("event %s: %v", ev.ID, err)
+			continue
+		}
+		proof := make([][]byte, len(be.Proof))
+		for k, p := range be.Proof {
+			if proof[k], err = hex.DecodeString(p); err != nil {
+				break
+			}
+		}
+		root, rerr := hex.DecodeString(cp.Root)
+		if err != nil || rerr != nil || !VerifyInclusion(leaf, be.LeafIndex, cp.LeafCount, proof, root) {
+			fail("event %s (seq %d): inclusion proof does not match checkpoint %d", ev.ID, ev.ChainSeq, cp.ID)
+		}
+	}
+
+	rep.Valid = len(rep.Errors) == 0
+	return rep
+}
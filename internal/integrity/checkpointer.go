@@ -0,0 +1,144 @@
+package integrity
+
+import (
+	"context"
+	"encoding/hex"
+	"log/slog"
+	"time"
+
+	"github.com/joaovrmoraes/bataudit/internal/audit"
+)
+
+const (
+	DefaultCheckpointInterval = time.Hour
+	// maxLeaves bounds one checkpoint; a busy project gets several per run.
+	maxLeaves = 100_000
+)
+
+// Checkpointer periodically signs each project's new chain links.
+type Checkpointer struct {
+	repo   Repository
+	signer *Signer
+	every  time.Duration
+}
+
+func NewCheckpointer(repo Repository, signer *Signer) *Checkpointer {
+	return &Checkpointer{repo: repo, signer: signer, every: DefaultCheckpointInterval}
+}
+
+// WithInterval sets how often checkpoints are taken.
+func (c *Checkpointer) WithInterval(d time.Duration) *Checkpointer {
+	if d > 0 {
+		c.every = d
+	}
+	return c
+}
+
+// NewCheckpointerFromEnv builds a Checkpointer with the instance key (see
+// SignerFromEnv) and INTEGRITY_CHECKPOINT_INTERVAL (default 1h).
+func NewCheckpointerFromEnv(repo Repository, getEnv func(string, string) string) (*Checkpointer, error) {
+	signer, err := SignerFromEnv(getEnv)
+	if err != nil {
+		return nil, err
+	}
+	every, _ := time.ParseDuration(getEnv("INTEGRITY_CHECKPOINT_INTERVAL", ""))
+	return NewCheckpointer(repo, signer).WithInterval(every), nil
+}
+
+// Start blocks until ctx is cancelled, taking checkpoints periodically.
+func (c *Checkpointer) Start(ctx context.Context) {
+	slog.Info("integrity: checkpointer started", "every", c.every, "key_id", c.signer.KeyID())
+	ticker := time.NewTicker(c.every)
+	defer ticker.Stop()
+	for {
+		if n, err := c.Run(ctx); err != nil {
+			slog.Error("integrity: checkpoint run failed", "error", err)
+		} else if n > 0 {
+			slog.Info("integrity: checkpoints signed", "count", n)
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// Run checkpoints every project with links added since its last checkpoint.
+// Returns the number of checkpoints written.
+func (c *Checkpointer) Run(ctx context.Context) (int, error) {
+	heads, err := c.repo.Heads()
+	if err != nil {
+		return 0, err
+	}
+	written := 0
+	for _, head := range heads {
+		for ctx.Err() == nil {
+			cp, err := c.checkpoint(head)
+			if err != nil {
+				slog.Error("integrity: checkpoint failed", "project_id", head.ProjectID, "error", err)
+				break
+			}
+			if cp == nil {
+				break
+			}
+			written++
+		}
+	}
+	return written, ctx.Err()
+}
+
+// checkpoint signs the next range of head's chain, returning nil when the
+// chain is already covered up to head.
+func (c *Checkpointer) checkpoint(head audit.ChainHead) (*Checkpoint, error) {
+	var after int64
+	last, err := c.repo.LastCheckpoint(head.ProjectID)
+	if err != nil {
+		return nil, err
+	}
+	if last != nil {
+		after = last.LastSeq
+	}
+	if head.Seq <= after {
+		return nil, nil
+	}
+
+	links, err := c.repo.Links(head.ProjectID, after, head.Seq, maxLeaves)
+	if err != nil {
+		return nil, err
+	}
+	cp := &Checkpoint{
+		ProjectID: head.ProjectID,
+		FirstSeq:  after + 1,
+		LastSeq:   head.Seq,
+		LastHash:  head.Hash,
+		LeafCount: len(links),
+		KeyID:     c.signer.KeyID(),
+		PublicKey: c.signer.PublicKey(),
+		CreatedAt: time.Now().UTC().Truncate(time.Microsecond),
+	}
+	if len(links) == maxLeaves {
+		cp.LastSeq, cp.LastHash = links[len(links)-1].ChainSeq, links[len(links)-1].Hash
+	}
+
+	leaves := make([][]byte, len(links))
+	cp.Leaves = make([]byte, 0, len(links)*leafSize)
+	for i, l := range links {
+		if leaves[i], err = encodeLeaf(l.ChainSeq, l.Hash); err != nil {
+			return nil, err
+		}
+		cp.Leaves = append(cp.Leaves, leaves[i]...)
+	}
+	cp.Root = hex.EncodeToString(NewTree(leaves).Root())
+	cp.Signature = c.signer.Sign(cp.Message())
+
+	stored, err := c.repo.CreateCheckpoint(cp)
+	if err != nil {
+		return nil, err
+	}
+	if !stored {
+		// Another replica took this range; pick up from its checkpoint.
+		return c.checkpoint(head)
+	}
+	return cp, nil
+}
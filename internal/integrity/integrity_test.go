@@ -0,0 +1,157 @@
+package integrity
+
+import (
+	"context"
+	"crypto/ed25519"
+	"crypto/rand"
+	"encoding/json"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/joaovrmoraes/bataudit/internal/audit"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestTree_proofs(t *testing.T) {
+	for n := 1; n <= 33; n++ {
+		leaves := make([][]byte, n)
+		for i := range leaves {
+			leaves[i] = []byte(fmt.Sprintf("leaf-%d", i))
+		}
+		tree := NewTree(leaves)
+		root := tree.Root()
+		for i := range leaves {
+			proof, err := tree.Proof(i)
+			require.NoError(t, err)
+			assert.True(t, VerifyInclusion(leaves[i], i, n, proof, root), "n=%d i=%d", n, i)
+			assert.False(t, VerifyInclusion([]byte("other"), i, n, proof, root), "n=%d i=%d", n, i)
+			if n > 1 {
+				assert.False(t, VerifyInclusion(leaves[i], (i+1)%n, n, proof, root), "n=%d i=%d", n, i)
+			}
+		}
+	}
+}
+
+// memRepo is an in-memory Repository over one project's chain.
+type memRepo struct {
+	events      []audit.Audit
+	checkpoints []Checkpoint
+}
+
+func (m *memRepo) Heads() ([]audit.ChainHead, error) {
+	last := m.events[len(m.events)-1]
+	return []audit.ChainHead{{ProjectID: last.ProjectID, Seq: last.ChainSeq, Hash: last.Hash}}, nil
+}
+
+func (m *memRepo) LastCheckpoint(string) (*Checkpoint, error) {
+	if len(m.checkpoints) == 0 {
+		return nil, nil
+	}
+	return &m.checkpoints[len(m.checkpoints)-1], nil
+}
+
+func (m *memRepo) Links(_ string, after, to int64, limit int) ([]Link, error) {
+	var links []Link
+	for _, e := range m.events {
+		if e.ChainSeq > after && e.ChainSeq <= to && len(links) < limit {
+			links = append(links, Link{ChainSeq: e.ChainSeq, Hash: e.Hash})
+		}
+	}
+	return links, nil
+}
+
+func (m *memRepo) CreateCheckpoint(c *Checkpoint) (bool, error) {
+	c.ID = int64(len(m.checkpoints) + 1)
+	m.checkpoints = append(m.checkpoints, *c)
+	return true, nil
+}
+
+func (m *memRepo) ListCheckpoints(string, int) ([]Checkpoint, error) { return m.checkpoints, nil }
+
+func (m *memRepo) CheckpointsCovering(_ string, from, to int64) ([]Checkpoint, error) {
+	var out []Checkpoint
+	for _, c := range m.checkpoints {
+		if c.LastSeq >= from && c.FirstSeq <= to {
+			out = append(out, c)
+		}
+	}
+	return out, nil
+}
+
+func (m *memRepo) Events(string, time.Time, time.Time, int) ([]audit.Audit, error) {
+	return m.events, nil
+}
+
+func (m *memRepo) add(t *testing.T, n int) {
+	for i := 0; i < n; i++ {
+		ev := audit.Audit{
+			ID: fmt.Sprintf("00000000-0000-0000-0000-%012d", len(m.events)), EventType: "http", Method: audit.POST,
+			Path: "/orders", StatusCode: 201, Identifier: "u1", ServiceName: "api", Environment: "prod",
+			Timestamp: time.Date(2026, 10, 19, 12, 0, len(m.events), 0, time.UTC), ProjectID: "p1",
+			ChainSeq: int64(len(m.events) + 1),
+		}
+		if len(m.events) > 0 {
+			ev.PrevHash = m.events[len(m.events)-1].Hash
+		}
+		var err error
+		ev.Hash, err = audit.ChainHash(&ev, ev.PrevHash)
+		require.NoError(t, err)
+		m.events = append(m.events, ev)
+	}
+}
+
+func TestBundle_roundTrip(t *testing.T) {
+	_, key, err := ed25519.GenerateKey(rand.Reader)
+	require.NoError(t, err)
+	signer := NewSigner(key)
+	repo := &memRepo{}
+	cp := NewCheckpointer(repo, signer)
+
+	repo.add(t, 5)
+	n, err := cp.Run(context.Background())
+	require.NoError(t, err)
+	assert.Equal(t, 1, n)
+	repo.add(t, 3)
+	_, err = cp.Run(context.Background())
+	require.NoError(t, err)
+	require.Len(t, repo.checkpoints, 2)
+	assert.Equal(t, int64(6), repo.checkpoints[1].FirstSeq)
+
+	repo.add(t, 1) // not yet checkpointed
+	bundle, err := BuildBundle(repo, "p1", time.Time{}, time.Now(), 100)
+	require.NoError(t, err)
+	assert.Len(t, bundle.Events, 8)
+	assert.Equal(t, 1, bundle.Pending)
+
+	// Through JSON, as an auditor receives it.
+	data, err := json.Marshal(bundle)
+	require.NoError(t, err)
+	decode := func() *Bundle {
+		var b Bundle
+		require.NoError(t, json.Unmarshal(data, &b))
+		return &b
+	}
+
+	pub := key.Public().(ed25519.PublicKey)
+	rep := VerifyBundle(decode(), pub)
+	assert.True(t, rep.Valid, rep.Errors)
+	assert.Equal(t, []string{signer.KeyID()}, rep.KeyIDs)
+
+	other, _, _ := ed25519.GenerateKey(rand.Reader)
+	assert.False(t, VerifyBundle(decode(), other).Valid, "pinned key")
+
+	edited := decode()
+	edited.Events[2].Event.StatusCode = 200
+	assert.False(t, VerifyBundle(edited, pub).Valid, "edited event")
+
+	rehashed := decode()
+	rehashed.Events[2].Event.StatusCode = 200
+	rehashed.Events[2].Event.Hash, _ = audit.ChainHash(&rehashed.Events[2].Event, rehashed.Events[2].Event.PrevHash)
+	assert.False(t, VerifyBundle(rehashed, pub).Valid, "edited event with a recomputed hash")
+
+	resigned := decode()
+	resigned.Checkpoints[0].Root = resigned.Checkpoints[1].Root
+	assert.False(t, VerifyBundle(resigned, pub).Valid, "altered checkpoint")
+}
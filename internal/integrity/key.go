@@ -0,0 +1,113 @@
+package integrity
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+const defaultKeyFile = "data/integrity.key"
+
+// Signer holds the instance signing key.
+type Signer struct {
+	key ed25519.PrivateKey
+}
+
+func NewSigner(key ed25519.PrivateKey) *Signer {
+	return &Signer{key: key}
+}
+
+// PublicKey returns the base64-encoded public key.
+func (s *Signer) PublicKey() string {
+	return base64.StdEncoding.EncodeToString(s.key.Public().(ed25519.PublicKey))
+}
+
+// KeyID returns the short identifier of the public key.
+func (s *Signer) KeyID() string {
+	return KeyID(s.key.Public().(ed25519.PublicKey))
+}
+
+func (s *Signer) Sign(msg []byte) string {
+	return base64.StdEncoding.EncodeToString(ed25519.Sign(s.key, msg))
+}
+
+// KeyID is the first 8 bytes of the SHA-256 of a public key, in hex.
+func KeyID(pub ed25519.PublicKey) string {
+	sum := sha256.Sum256(pub)
+	return hex.EncodeToString(sum[:8])
+}
+
+// ParsePublicKey decodes a base64 Ed25519 public key.
+func ParsePublicKey(s string) (ed25519.PublicKey, error) {
+	raw, err := base64.StdEncoding.DecodeString(strings.TrimSpace(s))
+	if err != nil || len(raw) != ed25519.PublicKeySize {
+		return nil, errors.New("integrity: invalid public key")
+	}
+	return ed25519.PublicKey(raw), nil
+}
+
+// parsePrivateKey accepts a base64 32-byte seed or 64-byte private key.
+func parsePrivateKey(s string) (ed25519.PrivateKey, error) {
+	raw, err := base64.StdEncoding.DecodeString(strings.TrimSpace(s))
+	if err != nil {
+		return nil, fmt.Errorf("integrity: signing key is not base64: %w", err)
+	}
+	switch len(raw) {
+	case ed25519.SeedSize:
+		return ed25519.NewKeyFromSeed(raw), nil
+	case ed25519.PrivateKeySize:
+		return ed25519.PrivateKey(raw), nil
+	}
+	return nil, errors.New("integrity: signing key must be a 32-byte seed or 64-byte private key")
+}
+
+// SignerFromEnv loads the instance key from INTEGRITY_SIGNING_KEY (base64
+// seed), or else from INTEGRITY_KEY_FILE (default data/integrity.key),
+// generating the file on first start. Publish the logged public key so
+// auditors can pin it.
+func SignerFromEnv(getEnv func(string, string) string) (*Signer, error) {
+	if v := getEnv("INTEGRITY_SIGNING_KEY", ""); v != "" {
+		key, err := parsePrivateKey(v)
+		if err != nil {
+			return nil, err
+		}
+		return NewSigner(key), nil
+	}
+
+	path := getEnv("INTEGRITY_KEY_FILE", defaultKeyFile)
+	data, err := os.ReadFile(path)
+	if err == nil {
+		key, err := parsePrivateKey(string(data))
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", path, err)
+		}
+		return NewSigner(key), nil
+	}
+	if !os.IsNotExist(err) {
+		return nil, fmt.Errorf("integrity: %w", err)
+	}
+
+	_, key, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		return nil, err
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0o700); err != nil {
+		return nil, fmt.Errorf("integrity: %w", err)
+	}
+	seed := base64.StdEncoding.EncodeToString(key.Seed())
+	if err := os.WriteFile(path, []byte(seed+"\n"), 0o600); err != nil {
+		return nil, fmt.Errorf("integrity: %w", err)
+	}
+	signer := NewSigner(key)
+	slog.Warn("integrity: generated a new signing key — back it up and publish the public key",
+		"file", path, "key_id", signer.KeyID(), "public_key", signer.PublicKey())
+	return signer, nil
+}
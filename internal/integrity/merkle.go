@@ -0,0 +1,117 @@
+// Package integrity signs each project's hash chain at regular intervals and
+// builds evidence bundles that auditors can verify offline: the worker
+// computes a Merkle tree over the event hashes added since the last
+// checkpoint and signs its root with the instance Ed25519 key; a bundle
+// carries events, their inclusion proofs, the signed checkpoints and the
+// public keys.
+package integrity
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"errors"
+)
+
+// The Merkle tree follows RFC 6962 (Certificate Transparency): leaves and
+// interior nodes are hashed with distinct prefixes, and a tree of n leaves
+// splits at the largest power of two below n.
+
+func leafHash(data []byte) []byte {
+	h := sha256.New()
+	h.Write([]byte{0x00})
+	h.Write(data)
+	return h.Sum(nil)
+}
+
+func nodeHash(left, right []byte) []byte {
+	h := sha256.New()
+	h.Write([]byte{0x01})
+	h.Write(left)
+	h.Write(right)
+	return h.Sum(nil)
+}
+
+// Tree holds every level of a Merkle tree, leaf hashes first. Building the
+// levels bottom-up and carrying an unpaired last node up unchanged gives the
+// same tree as RFC 6962's recursive definition.
+type Tree struct {
+	levels [][][]byte
+}
+
+func NewTree(leaves [][]byte) *Tree {
+	level := make([][]byte, len(leaves))
+	for i, l := range leaves {
+		level[i] = leafHash(l)
+	}
+	t := &Tree{levels: [][][]byte{level}}
+	for len(level) > 1 {
+		next := make([][]byte, 0, (len(level)+1)/2)
+		for i := 0; i < len(level); i += 2 {
+			if i+1 < len(level) {
+				next = append(next, nodeHash(level[i], level[i+1]))
+			} else {
+				next = append(next, level[i])
+			}
+		}
+		t.levels = append(t.levels, next)
+		level = next
+	}
+	return t
+}
+
+// Size returns the number of leaves.
+func (t *Tree) Size() int { return len(t.levels[0]) }
+
+// Root returns the tree's root. The root of an empty tree is the hash of the
+// empty string.
+func (t *Tree) Root() []byte {
+	if t.Size() == 0 {
+		sum := sha256.Sum256(nil)
+		return sum[:]
+	}
+	return t.levels[len(t.levels)-1][0]
+}
+
+// Proof returns the inclusion proof (audit path) for the leaf at index, from
+// the leaf's sibling up to the root's child.
+func (t *Tree) Proof(index int) ([][]byte, error) {
+	if index < 0 || index >= t.Size() {
+		return nil, errors.New("integrity: leaf index out of range")
+	}
+	var proof [][]byte
+	for _, level := range t.levels[:len(t.levels)-1] {
+		if sibling := index ^ 1; sibling < len(level) {
+			proof = append(proof, level[sibling])
+		}
+		index >>= 1
+	}
+	return proof, nil
+}
+
+// VerifyInclusion reports whether leaf sits at index in a tree of size leaves
+// with the given root.
+func VerifyInclusion(leaf []byte, index, size int, proof [][]byte, root []byte) bool {
+	if index < 0 || index >= size {
+		return false
+	}
+	// RFC 9162, section 2.1.3.2.
+	fn, sn := index, size-1
+	r := leafHash(leaf)
+	for _, p := range proof {
+		if sn == 0 {
+			return false
+		}
+		if fn&1 == 1 || fn == sn {
+			r = nodeHash(p, r)
+			for fn&1 == 0 && fn != 0 {
+				fn >>= 1
+				sn >>= 1
+			}
+		} else {
+			r = nodeHash(r, p)
+		}
+		fn >>= 1
+		sn >>= 1
+	}
+	return sn == 0 && bytes.Equal(r, root)
+}
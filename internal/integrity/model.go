@@ -0,0 +1,123 @@
+package integrity
+
+import (
+	"encoding/binary"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/joaovrmoraes/bataudit/internal/audit"
+)
+
+const (
+	messageVersion = "bataudit-checkpoint-v1"
+	bundleVersion  = 1
+	leafSize       = 8 + 32 // big-endian chain_seq + event hash
+)
+
+// Checkpoint is a signed Merkle root over the chain links a project gained
+// between FirstSeq and LastSeq. Leaves are the links still stored when the
+// checkpoint was taken, in chain order; each leaf is the event's chain_seq
+// followed by its hash, so a proof fixes both content and position.
+type Checkpoint struct {
+	ID        int64     `json:"id"`
+	ProjectID string    `json:"project_id"`
+	FirstSeq  int64     `json:"first_seq"`
+	LastSeq   int64     `json:"last_seq"`
+	LeafCount int       `json:"leaf_count"`
+	Root      string    `json:"root"`
+	LastHash  string    `json:"last_hash"` // chain hash at LastSeq
+	KeyID     string    `json:"key_id"`
+	Signature string    `json:"signature"`
+	CreatedAt time.Time `json:"created_at"`
+
+	PublicKey string `json:"-"`
+	Leaves    []byte `json:"-"` // LeafCount entries of leafSize bytes
+}
+
+func (Checkpoint) TableName() string { return "integrity_checkpoints" }
+
+// Message returns the bytes the signature covers.
+func (c *Checkpoint) Message() []byte {
+	return []byte(strings.Join([]string{
+		messageVersion,
+		c.ProjectID,
+		strconv.FormatInt(c.FirstSeq, 10),
+		strconv.FormatInt(c.LastSeq, 10),
+		strconv.Itoa(c.LeafCount),
+		c.Root,
+		c.LastHash,
+		c.CreatedAt.UTC().Format(time.RFC3339Nano),
+		c.KeyID,
+	}, "\n"))
+}
+
+// encodeLeaf builds the leaf for an event's chain link.
+func encodeLeaf(seq int64, hash string) ([]byte, error) {
+	raw, err := hex.DecodeString(hash)
+	if err != nil || len(raw) != 32 {
+		return nil, fmt.Errorf("integrity: invalid chain hash at seq %d", seq)
+	}
+	leaf := make([]byte, leafSize)
+	binary.BigEndian.PutUint64(leaf, uint64(seq))
+	copy(leaf[8:], raw)
+	return leaf, nil
+}
+
+// leaves splits the stored leaf blob.
+func (c *Checkpoint) leaves() ([][]byte, error) {
+	if len(c.Leaves) != c.LeafCount*leafSize {
+		return nil, fmt.Errorf("integrity: checkpoint %d has a damaged leaf list", c.ID)
+	}
+	out := make([][]byte, c.LeafCount)
+	for i := range out {
+		out[i] = c.Leaves[i*leafSize : (i+1)*leafSize]
+	}
+	return out, nil
+}
+
+// Bundle is self-contained evidence for a set of events: each event with an
+// inclusion proof into a signed checkpoint, and the keys that signed them.
+type Bundle struct {
+	Version     int               `json:"version"`
+	ProjectID   string            `json:"project_id"`
+	From        time.Time         `json:"from"`
+	To          time.Time         `json:"to"`
+	GeneratedAt time.Time         `json:"generated_at"`
+	PublicKeys  map[string]string `json:"public_keys"` // key_id → base64 Ed25519 public key
+	Checkpoints []Checkpoint      `json:"checkpoints"`
+	Events      []BundleEvent     `json:"events"`
+	// Pending counts events in range not yet covered by a checkpoint; they
+	// are left out.
+	Pending int `json:"pending"`
+}
+
+type BundleEvent struct {
+	Event        audit.Audit `json:"event"`
+	CheckpointID int64       `json:"checkpoint_id"`
+	LeafIndex    int         `json:"leaf_index"`
+	Proof        []string    `json:"proof"`
+}
+
+// UnmarshalJSON reads Event.Method as a plain string so system events, which
+// have no method, decode.
+func (e *BundleEvent) UnmarshalJSON(data []byte) error {
+	type plain BundleEvent
+	var v struct {
+		plain
+		Event struct {
+			audit.Audit
+			Method string `json:"method"`
+		} `json:"event"`
+	}
+	if err := json.Unmarshal(data, &v); err != nil {
+		return err
+	}
+	*e = BundleEvent(v.plain)
+	e.Event = v.Event.Audit
+	e.Event.Method = audit.HTTPMethod(v.Event.Method)
+	return nil
+}
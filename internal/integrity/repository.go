@@ -0,0 +1,109 @@
+package integrity
+
+import (
+	"time"
+
+	"github.com/joaovrmoraes/bataudit/internal/audit"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// Link is one stored hash chain link.
+type Link struct {
+	ChainSeq int64
+	Hash     string
+}
+
+type Repository interface {
+	Heads() ([]audit.ChainHead, error)
+	// LastCheckpoint returns the project's newest checkpoint, or nil.
+	LastCheckpoint(projectID string) (*Checkpoint, error)
+	// Links returns up to limit stored links with afterSeq < chain_seq <= toSeq.
+	Links(projectID string, afterSeq, toSeq int64, limit int) ([]Link, error)
+	// CreateCheckpoint stores c unless another replica already checkpointed
+	// the same range, reporting whether it was stored.
+	CreateCheckpoint(c *Checkpoint) (bool, error)
+	// ListCheckpoints returns the newest checkpoints, without leaves.
+	ListCheckpoints(projectID string, limit int) ([]Checkpoint, error)
+	// CheckpointsCovering returns the checkpoints overlapping [fromSeq, toSeq],
+	// with leaves.
+	CheckpointsCovering(projectID string, fromSeq, toSeq int64) ([]Checkpoint, error)
+	// Events returns chained events in the time range, in chain order.
+	Events(projectID string, from, to time.Time, limit int) ([]audit.Audit, error)
+}
+
+type repository struct {
+	db *gorm.DB
+}
+
+func NewRepository(db *gorm.DB) Repository {
+	return &repository{db: db}
+}
+
+func (r *repository) Heads() ([]audit.ChainHead, error) {
+	var heads []audit.ChainHead
+	err := r.db.Where("seq > 0").Find(&heads).Error
+	return heads, err
+}
+
+func (r *repository) LastCheckpoint(projectID string) (*Checkpoint, error) {
+	var list []Checkpoint
+	err := r.db.Omit("leaves").Where("project_id = ?", projectID).
+		Order("last_seq DESC").Limit(1).Find(&list).Error
+	if err != nil || len(list) == 0 {
+		return nil, err
+	}
+	return &list[0], nil
+}
+
+// chainRows scopes audits to a chain key ("" = events without a project).
+func (r *repository) chainRows(projectID string) *gorm.DB {
+	q := r.db.Model(&audit.Audit{})
+	if projectID == "" {
+		return q.Where("project_id IS NULL")
+	}
+	return q.Where("project_id = ?", projectID)
+}
+
+func (r *repository) Links(projectID string, afterSeq, toSeq int64, limit int) ([]Link, error) {
+	var links []Link
+	err := r.chainRows(projectID).
+		Select("chain_seq, hash").
+		Where("chain_seq > ? AND chain_seq <= ?", afterSeq, toSeq).
+		Order("chain_seq").
+		Limit(limit).
+		Scan(&links).Error
+	return links, err
+}
+
+func (r *repository) CreateCheckpoint(c *Checkpoint) (bool, error) {
+	res := r.db.Clauses(clause.OnConflict{
+		Columns:   []clause.Column{{Name: "project_id"}, {Name: "first_seq"}},
+		DoNothing: true,
+	}).Create(c)
+	return res.RowsAffected > 0, res.Error
+}
+
+func (r *repository) ListCheckpoints(projectID string, limit int) ([]Checkpoint, error) {
+	var list []Checkpoint
+	err := r.db.Omit("leaves").Where("project_id = ?", projectID).
+		Order("last_seq DESC").Limit(limit).Find(&list).Error
+	return list, err
+}
+
+func (r *repository) CheckpointsCovering(projectID string, fromSeq, toSeq int64) ([]Checkpoint, error) {
+	var list []Checkpoint
+	err := r.db.Where("project_id = ? AND last_seq >= ? AND first_seq <= ?", projectID, fromSeq, toSeq).
+		Order("first_seq").Find(&list).Error
+	return list, err
+}
+
+func (r *repository) Events(projectID string, from, to time.Time, limit int) ([]audit.Audit, error) {
+	var events []audit.Audit
+	err := r.chainRows(projectID).
+		Where("chain_seq IS NOT NULL AND timestamp >= ? AND timestamp <= ?", from, to).
+		Order("chain_seq").
+		Limit(limit).
+		Find(&events).Error
+	return events, err
+}
@@ -0,0 +1,188 @@
+// Package latency keeps response times as mergeable histograms (sketches).
+// Percentiles of a group of requests cannot be computed from the percentiles
+// of its parts, but a sketch of the group is the sum of the sketches of its
+// parts: tiering stores one per route and hour, folds hours into days, and
+// the Reader adds the raw events of the range on top.
+//
+// Buckets grow with latency, 1-2-2.5-3-4-5-6-8 per decade, so a percentile
+// read from a sketch is within about 25% of the exact value (and never above
+// the maximum, which is kept exactly). Bounds must never change: stored
+// sketches are only meaningful against the bounds they were counted with.
+package latency
+
+import (
+	"encoding/json"
+	"errors"
+	"strconv"
+	"strings"
+)
+
+// Bounds are the inclusive upper bounds of the buckets, in milliseconds.
+// A last, unbounded bucket holds everything above 60 seconds.
+var Bounds = []int64{
+	1, 2, 3, 4, 5, 6, 8,
+	10, 12, 15, 20, 25, 30, 40, 50, 60, 80,
+	100, 120, 150, 200, 250, 300, 400, 500, 600, 800,
+	1000, 1200, 1500, 2000, 2500, 3000, 4000, 5000, 6000, 8000,
+	10000, 12000, 15000, 20000, 25000, 30000, 40000, 50000, 60000,
+}
+
+// Sketch is the latency histogram of a group of requests.
+type Sketch struct {
+	Counts []int64 // per bucket: len(Bounds)+1
+	Count  int64
+	SumMs  int64
+	MaxMs  int64
+}
+
+// Bucket is a non-empty bucket of a sketch: requests that took more than
+// FromMs, up to ToMs (unbounded when nil).
+type Bucket struct {
+	FromMs int64  `json:"from_ms"`
+	ToMs   *int64 `json:"to_ms"`
+	Count  int64  `json:"count"`
+}
+
+// New returns an empty sketch.
+func New() *Sketch {
+	return &Sketch{Counts: make([]int64, len(Bounds)+1)}
+}
+
+// Index returns the bucket of a response time.
+func Index(ms int64) int {
+	lo, hi := 0, len(Bounds)
+	for lo < hi {
+		mid := (lo + hi) / 2
+		if ms <= Bounds[mid] {
+			hi = mid
+		} else {
+			lo = mid + 1
+		}
+	}
+	return lo
+}
+
+// IndexExpr is the SQL expression computing Index of column, so a query
+// can count a sketch with GROUP BY.
+func IndexExpr(column string) string {
+	var b strings.Builder
+	b.WriteString("CASE")
+	for i, bound := range Bounds {
+		b.WriteString(" WHEN " + column + " <= " + strconv.FormatInt(bound, 10) + " THEN " + strconv.Itoa(i))
+	}
+	b.WriteString(" ELSE " + strconv.Itoa(len(Bounds)) + " END")
+	return b.String()
+}
+
+// Add counts one response time.
+func (s *Sketch) Add(ms int64) {
+	s.AddBucket(Index(ms), 1, ms, ms)
+}
+
+// AddBucket counts n requests of bucket i, with their sum and maximum, as a
+// query grouping by IndexExpr returns them.
+func (s *Sketch) AddBucket(i int, n, sumMs, maxMs int64) {
+	if i < 0 || i >= len(s.Counts) || n <= 0 {
+		return
+	}
+	s.Counts[i] += n
+	s.Count += n
+	s.SumMs += sumMs
+	s.MaxMs = max(s.MaxMs, maxMs)
+}
+
+// Merge adds o to s.
+func (s *Sketch) Merge(o *Sketch) {
+	for i, n := range o.Counts {
+		if i < len(s.Counts) {
+			s.Counts[i] += n
+		}
+	}
+	s.Count += o.Count
+	s.SumMs += o.SumMs
+	s.MaxMs = max(s.MaxMs, o.MaxMs)
+}
+
+// Mean is the average response time, 0 for an empty sketch.
+func (s *Sketch) Mean() float64 {
+	if s.Count == 0 {
+		return 0
+	}
+	return float64(s.SumMs) / float64(s.Count)
+}
+
+// Quantile estimates the q-quantile (0 to 1), interpolating linearly within
+// its bucket. It is 0 for an empty sketch.
+func (s *Sketch) Quantile(q float64) float64 {
+	if s.Count == 0 {
+		return 0
+	}
+	rank := q * float64(s.Count)
+	var seen int64
+	for i, n := range s.Counts {
+		if n == 0 || float64(seen+n) < rank {
+			seen += n
+			continue
+		}
+		from, to := s.bucketRange(i)
+		v := from + (rank-float64(seen))/float64(n)*(to-from)
+		return min(v, float64(s.MaxMs))
+	}
+	return float64(s.MaxMs)
+}
+
+func (s *Sketch) bucketRange(i int) (from, to float64) {
+	if i > 0 {
+		from = float64(Bounds[i-1])
+	}
+	if i < len(Bounds) {
+		return from, float64(Bounds[i])
+	}
+	return from, max(from, float64(s.MaxMs))
+}
+
+// Buckets returns the non-empty buckets, fastest first.
+func (s *Sketch) Buckets() []Bucket {
+	buckets := []Bucket{}
+	for i, n := range s.Counts {
+		if n == 0 {
+			continue
+		}
+		b := Bucket{Count: n}
+		if i > 0 {
+			b.FromMs = Bounds[i-1]
+		}
+		if i < len(Bounds) {
+			to := Bounds[i]
+			b.ToMs = &to
+		}
+		buckets = append(buckets, b)
+	}
+	return buckets
+}
+
+// EncodeCounts renders the bucket counts as stored: a JSON array, without
+// its trailing empty buckets.
+func (s *Sketch) EncodeCounts() string {
+	end := len(s.Counts)
+	for end > 0 && s.Counts[end-1] == 0 {
+		end--
+	}
+	b, _ := json.Marshal(s.Counts[:end])
+	return string(b)
+}
+
+// Decode rebuilds a stored sketch.
+func Decode(counts string, count, sumMs, maxMs int64) (*Sketch, error) {
+	s := New()
+	var stored []int64
+	if err := json.Unmarshal([]byte(counts), &stored); err != nil {
+		return nil, err
+	}
+	if len(stored) > len(s.Counts) {
+		return nil, errors.New("latency: sketch has more buckets than Bounds")
+	}
+	copy(s.Counts, stored)
+	s.Count, s.SumMs, s.MaxMs = count, sumMs, maxMs
+	return s, nil
+}
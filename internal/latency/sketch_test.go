@@ -0,0 +1,76 @@
+package latency
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestIndex(t *testing.T) {
+	assert.Equal(t, 0, Index(0))
+	assert.Equal(t, 0, Index(1))
+	assert.Equal(t, 1, Index(2))
+	assert.Equal(t, 7, Index(10))
+	assert.Equal(t, 8, Index(11))
+	assert.Equal(t, len(Bounds)-1, Index(60000))
+	assert.Equal(t, len(Bounds), Index(60001))
+}
+
+func TestQuantile(t *testing.T) {
+	s := New()
+	for ms := int64(1); ms <= 1000; ms++ {
+		s.Add(ms)
+	}
+	assert.InDelta(t, 500.5, s.Mean(), 0.001)
+	for q, exact := range map[float64]float64{0.5: 500, 0.9: 900, 0.99: 990} {
+		got := s.Quantile(q)
+		assert.InDelta(t, exact, got, exact*0.25, "p%v", q*100)
+	}
+	assert.Equal(t, 1000.0, s.Quantile(1))
+	assert.Zero(t, New().Quantile(0.5))
+
+	one := New()
+	one.Add(7)
+	assert.Equal(t, 7.0, one.Quantile(0.99), "never above the maximum")
+
+	slow := New()
+	slow.Add(90000)
+	assert.Equal(t, 90000.0, slow.Quantile(1), "the unbounded bucket ends at the maximum")
+}
+
+func TestMergeEqualsWhole(t *testing.T) {
+	whole, a, b := New(), New(), New()
+	for ms := int64(0); ms < 5000; ms += 7 {
+		whole.Add(ms)
+		if ms%2 == 0 {
+			a.Add(ms)
+		} else {
+			b.Add(ms)
+		}
+	}
+	a.Merge(b)
+	assert.Equal(t, whole, a)
+}
+
+func TestEncodeDecode(t *testing.T) {
+	s := New()
+	s.Add(3)
+	s.Add(3)
+	s.Add(250)
+	encoded := s.EncodeCounts()
+	assert.Equal(t, "[0,0,2,0,0,0,0,0,0,0,0,0,0,0,0,0,0,0,0,0,0,1]", encoded)
+
+	decoded, err := Decode(encoded, s.Count, s.SumMs, s.MaxMs)
+	require.NoError(t, err)
+	assert.Equal(t, s, decoded)
+
+	_, err = Decode("not json", 0, 0, 0)
+	assert.Error(t, err)
+
+	buckets := s.Buckets()
+	require.Len(t, buckets, 2)
+	assert.Equal(t, int64(2), buckets[0].FromMs)
+	assert.Equal(t, int64(3), *buckets[0].ToMs)
+	assert.Equal(t, int64(2), buckets[0].Count)
+}
@@ -0,0 +1,261 @@
+package legalhold
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/joaovrmoraes/bataudit/internal/auth"
+	"gorm.io/gorm"
+)
+
+const defaultEventLimit = 200
+
+type Handler struct {
+	repo Repository
+}
+
+func NewHandler(repo Repository) *Handler {
+	return &Handler{repo: repo}
+}
+
+// RegisterRoutes mounts the legal hold endpoints onto an already-JWT-protected
+// group. Expected base path: /v1/legal-holds
+func (h *Handler) RegisterRoutes(rg *gin.RouterGroup) {
+	rg.GET("", h.List)
+	rg.POST("", h.Create)
+	rg.GET("/events", h.Events)
+	rg.GET("/report", h.Report)
+	rg.GET("/:id", h.Get)
+	rg.POST("/:id/release", h.Release)
+}
+
+type createRequest struct {
+	ProjectID  string     `json:"project_id" binding:"required"`
+	Identifier string     `json:"identifier"`
+	TenantID   string     `json:"tenant_id"`
+	From       *time.Time `json:"from"`
+	To         *time.Time `json:"to"`
+	Reason     string     `json:"reason"     binding:"required"`
+}
+
+type releaseRequest struct {
+	ProjectID string `json:"project_id" binding:"required"`
+	Reason    string `json:"reason"     binding:"required"`
+}
+
+// Create godoc
+// @Summary      Place a legal hold
+// @Description  Stops tiering, archiving and partition drops from removing the project's raw events matching the hold until it is released. Owners only.
+// @Tags         legal-holds
+// @Accept       json
+// @Produce      json
+// @Security     BearerAuth
+// @Param        body  body  createRequest  true  "Hold scope and reason"
+// @Success      201  {object}  Hold
+// @Failure      400  {object}  map[string]string
+// @Failure      403  {object}  map[string]string
+// @Router       /legal-holds [post]
+func (h *Handler) Create(c *gin.Context) {
+	actor, ok := owner(c)
+	if !ok {
+		return
+	}
+
+	var req createRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	hold := &Hold{
+		ProjectID:  req.ProjectID,
+		Identifier: req.Identifier,
+		TenantID:   req.TenantID,
+		From:       utc(req.From),
+		To:         utc(req.To),
+		Reason:     req.Reason,
+		CreatedBy:  actor,
+	}
+	if err := hold.validate(); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if err := h.repo.Create(hold); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusCreated, hold)
+}
+
+// Release godoc
+// @Summary      Release a legal hold
+// @Description  Ends the hold; the events it covered become subject to retention again on the next tiering run. Owners only.
+// @Tags         legal-holds
+// @Accept       json
+// @Produce      json
+// @Security     BearerAuth
+// @Param        id    path  string          true  "Hold ID"
+// @Param        body  body  releaseRequest  true  "Project and reason"
+// @Success      200  {object}  Hold
+// @Failure      400  {object}  map[string]string
+// @Failure      403  {object}  map[string]string
+// @Failure      404  {object}  map[string]string
+// @Failure      409  {object}  map[string]string
+// @Router       /legal-holds/{id}/release [post]
+func (h *Handler) Release(c *gin.Context) {
+	actor, ok := owner(c)
+	if !ok {
+		return
+	}
+
+	var req releaseRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	hold, err := h.repo.Release(c.Param("id"), req.ProjectID, actor, req.Reason)
+	switch {
+	case errors.Is(err, gorm.ErrRecordNotFound):
+		c.JSON(http.StatusNotFound, gin.H{"error": "hold not found"})
+	case errors.Is(err, ErrReleased):
+		c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+	case err != nil:
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+	default:
+		c.JSON(http.StatusOK, hold)
+	}
+}
+
+// List godoc
+// @Summary      List a project's legal holds
+// @Tags         legal-holds
+// @Produce      json
+// @Security     BearerAuth
+// @Param        project_id  query  string  true   "Project ID"
+// @Param        active      query  bool    false  "Only holds not yet released"
+// @Success      200  {array}  Hold
+// @Failure      400  {object}  map[string]string
+// @Router       /legal-holds [get]
+func (h *Handler) List(c *gin.Context) {
+	projectID, ok := requireProject(c)
+	if !ok {
+		return
+	}
+	holds, err := h.repo.List(projectID, c.Query("active") == "true")
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, holds)
+}
+
+// Get godoc
+// @Summary      Get a legal hold
+// @Tags         legal-holds
+// @Produce      json
+// @Security     BearerAuth
+// @Param        id          path   string  true  "Hold ID"
+// @Param        project_id  query  string  true  "Project ID"
+// @Success      200  {object}  Hold
+// @Failure      404  {object}  map[string]string
+// @Router       /legal-holds/{id} [get]
+func (h *Handler) Get(c *gin.Context) {
+	projectID, ok := requireProject(c)
+	if !ok {
+		return
+	}
+	hold, err := h.repo.Get(c.Param("id"), projectID)
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "hold not found"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, hold)
+}
+
+// Events godoc
+// @Summary      List legal hold actions
+// @Description  Every hold created or released in the project, newest first.
+// @Tags         legal-holds
+// @Produce      json
+// @Security     BearerAuth
+// @Param        project_id  query  string  true   "Project ID"
+// @Param        limit       query  int     false  "Max entries (default 200)"
+// @Success      200  {array}  Event
+// @Failure      400  {object}  map[string]string
+// @Router       /legal-holds/events [get]
+func (h *Handler) Events(c *gin.Context) {
+	projectID, ok := requireProject(c)
+	if !ok {
+		return
+	}
+	limit := defaultEventLimit
+	if v, err := strconv.Atoi(c.Query("limit")); err == nil && v > 0 && v <= 1000 {
+		limit = v
+	}
+	events, err := h.repo.Events(projectID, limit)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, events)
+}
+
+// Report godoc
+// @Summary      Report data under legal hold
+// @Description  Counts the raw events each active hold currently keeps, and the project total.
+// @Tags         legal-holds
+// @Produce      json
+// @Security     BearerAuth
+// @Param        project_id  query  string  true  "Project ID"
+// @Success      200  {object}  Report
+// @Failure      400  {object}  map[string]string
+// @Router       /legal-holds/report [get]
+func (h *Handler) Report(c *gin.Context) {
+	projectID, ok := requireProject(c)
+	if !ok {
+		return
+	}
+	rep, err := h.repo.Report(projectID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, rep)
+}
+
+func requireProject(c *gin.Context) (string, bool) {
+	projectID := c.Query("project_id")
+	if projectID == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "project_id required"})
+		return "", false
+	}
+	return projectID, true
+}
+
+// owner returns the caller's email when they are an owner, writing a 403
+// when not. Holds bind the organisation legally, so admins cannot place or
+// release them.
+func owner(c *gin.Context) (string, bool) {
+	claims, ok := c.MustGet("claims").(*auth.Claims)
+	if !ok || claims.Role != auth.RoleOwner {
+		c.JSON(http.StatusForbidden, gin.H{"error": "only owners can manage legal holds"})
+		return "", false
+	}
+	return claims.Email, true
+}
+
+func utc(t *time.Time) *time.Time {
+	if t == nil {
+		return nil
+	}
+	u := t.UTC()
+	return &u
+}
@@ -0,0 +1,29 @@
+package legalhold
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestHold_validate(t *testing.T) {
+	from := time.Date(2026, 3, 1, 0, 0, 0, 0, time.UTC)
+	to := from.Add(-time.Hour)
+
+	assert.NoError(t, (&Hold{ProjectID: "p", Reason: "case 42"}).validate())
+	assert.NoError(t, (&Hold{ProjectID: "p", Reason: "case 42", From: &from}).validate())
+	assert.EqualError(t, (&Hold{Reason: "case 42"}).validate(), "project_id is required")
+	assert.EqualError(t, (&Hold{ProjectID: "p"}).validate(), "reason is required")
+	assert.EqualError(t, (&Hold{ProjectID: "p", Reason: "case 42", From: &from, To: &to}).validate(), "to must not be before from")
+}
+
+func TestHeld_qualifiesColumns(t *testing.T) {
+	// Unqualified columns would resolve to legal_holds inside the subquery.
+	cond := Held("audits_p2026_01")
+	for _, col := range []string{"project_id", "identifier", "tenant_id", "timestamp"} {
+		assert.Contains(t, cond, "audits_p2026_01."+col)
+	}
+	assert.True(t, strings.HasPrefix(NotHeld("audits"), "NOT EXISTS"))
+}
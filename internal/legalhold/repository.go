@@ -0,0 +1,151 @@
+package legalhold
+
+import (
+	"errors"
+	"time"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// ErrReleased is returned when releasing a hold that is already released.
+var ErrReleased = errors.New("hold already released")
+
+type Repository interface {
+	// List returns a project's holds, newest first; only active ones when
+	// activeOnly is set.
+	List(projectID string, activeOnly bool) ([]Hold, error)
+	Get(id, projectID string) (*Hold, error)
+	// Create stores h and records the action by h.CreatedBy.
+	Create(h *Hold) error
+	// Release ends an active hold and records the action.
+	Release(id, projectID, actor, reason string) (*Hold, error)
+	// Events returns the newest hold actions of a project.
+	Events(projectID string, limit int) ([]Event, error)
+	// Report counts the raw events currently under each active hold.
+	Report(projectID string) (*Report, error)
+}
+
+type repository struct {
+	db *gorm.DB
+}
+
+func NewRepository(db *gorm.DB) Repository {
+	return &repository{db: db}
+}
+
+func (r *repository) List(projectID string, activeOnly bool) ([]Hold, error) {
+	q := r.db.Where("project_id = ?", projectID)
+	if activeOnly {
+		q = q.Where("released_at IS NULL")
+	}
+	var holds []Hold
+	err := q.Order("created_at DESC").Find(&holds).Error
+	return holds, err
+}
+
+func (r *repository) Get(id, projectID string) (*Hold, error) {
+	var h Hold
+	if err := r.db.Where("id = ? AND project_id = ?", id, projectID).First(&h).Error; err != nil {
+		return nil, err
+	}
+	return &h, nil
+}
+
+func (r *repository) Create(h *Hold) error {
+	if err := h.validate(); err != nil {
+		return err
+	}
+	h.ID = uuid.New().String()
+	h.CreatedAt = time.Now().UTC()
+	return r.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(h).Error; err != nil {
+			return err
+		}
+		return tx.Create(&Event{
+			HoldID:    h.ID,
+			ProjectID: h.ProjectID,
+			Action:    ActionCreated,
+			Actor:     h.CreatedBy,
+			Reason:    h.Reason,
+			CreatedAt: h.CreatedAt,
+		}).Error
+	})
+}
+
+func (r *repository) Release(id, projectID, actor, reason string) (*Hold, error) {
+	var h Hold
+	err := r.db.Transaction(func(tx *gorm.DB) error {
+		now := time.Now().UTC()
+		res := tx.Model(&Hold{}).
+			Where("id = ? AND project_id = ? AND released_at IS NULL", id, projectID).
+			Updates(map[string]interface{}{
+				"released_at":    now,
+				"released_by":    actor,
+				"release_reason": reason,
+			})
+		if res.Error != nil {
+			return res.Error
+		}
+		if err := tx.Where("id = ? AND project_id = ?", id, projectID).First(&h).Error; err != nil {
+			return err
+		}
+		if res.RowsAffected == 0 {
+			return ErrReleased
+		}
+		return tx.Create(&Event{
+			HoldID:    id,
+			ProjectID: projectID,
+			Action:    ActionReleased,
+			Actor:     actor,
+			Reason:    reason,
+			CreatedAt: now,
+		}).Error
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &h, nil
+}
+
+func (r *repository) Events(projectID string, limit int) ([]Event, error) {
+	var events []Event
+	err := r.db.Where("project_id = ?", projectID).
+		Order("created_at DESC, id DESC").
+		Limit(limit).
+		Find(&events).Error
+	return events, err
+}
+
+func (r *repository) Report(projectID string) (*Report, error) {
+	holds, err := r.List(projectID, true)
+	if err != nil {
+		return nil, err
+	}
+	rep := &Report{ProjectID: projectID, Holds: make([]HoldReport, 0, len(holds))}
+	for _, h := range holds {
+		hr := HoldReport{Hold: h}
+		var row struct {
+			Count  int64
+			Oldest *time.Time
+			Newest *time.Time
+		}
+		err := r.db.Raw(`
+			SELECT COUNT(*) AS count, MIN(audits.timestamp) AS oldest, MAX(audits.timestamp) AS newest
+			FROM audits
+			JOIN legal_holds lh ON lh.id = ? AND `+match("audits"), h.ID).Scan(&row).Error
+		if err != nil {
+			return nil, err
+		}
+		hr.Events, hr.Oldest, hr.Newest = row.Count, row.Oldest, row.Newest
+		rep.Holds = append(rep.Holds, hr)
+	}
+	if len(holds) > 0 {
+		err = r.db.Raw(`SELECT COUNT(*) FROM audits WHERE audits.project_id = ? AND `+Held("audits"), projectID).
+			Scan(&rep.Events).Error
+		if err != nil {
+			return nil, err
+		}
+	}
+	return rep, nil
+}
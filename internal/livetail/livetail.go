@@ -0,0 +1,123 @@
+// Package livetail carries the Worker's "event committed" notices to the
+// Reader over Redis pub/sub. A notice names the project and the event; the
+// Reader's live tails (audit.Tail) then read the event itself from the
+// database, with their filters, so pub/sub never has to be reliable: a lost
+// notice only delays an event until the next poll.
+package livetail
+
+import (
+	"context"
+	"encoding/json"
+	"log/slog"
+	"sync"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+)
+
+const (
+	// DefaultChannel is the pub/sub channel notices are published on.
+	DefaultChannel = "bataudit:events:committed"
+
+	publishTimeout = time.Second
+)
+
+// Notice announces a committed event.
+type Notice struct {
+	ProjectID string `json:"project_id"`
+	ID        string `json:"id"`
+}
+
+// Publisher publishes notices for the Worker.
+type Publisher struct {
+	client  *redis.Client
+	channel string
+}
+
+// NewPublisher creates a publisher on channel (DefaultChannel when empty).
+func NewPublisher(client *redis.Client, channel string) *Publisher {
+	if channel == "" {
+		channel = DefaultChannel
+	}
+	return &Publisher{client: client, channel: channel}
+}
+
+// Publish announces that the event id of projectID was committed.
+func (p *Publisher) Publish(projectID, id string) error {
+	b, err := json.Marshal(Notice{ProjectID: projectID, ID: id})
+	if err != nil {
+		return err
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), publishTimeout)
+	defer cancel()
+	return p.client.Publish(ctx, p.channel, b).Err()
+}
+
+// Hub receives notices for the Reader and fans them out to its subscribers.
+// It implements audit.Notifier.
+type Hub struct {
+	client  *redis.Client
+	channel string
+
+	mu   sync.RWMutex
+	next int
+	subs map[int]func(projectID string)
+}
+
+// NewHub creates a hub on channel (DefaultChannel when empty). It receives
+// nothing until Start is called.
+func NewHub(client *redis.Client, channel string) *Hub {
+	if channel == "" {
+		channel = DefaultChannel
+	}
+	return &Hub{client: client, channel: channel, subs: map[int]func(string){}}
+}
+
+// Subscribe calls notify with the project of every notice received until
+// cancel is called.
+func (h *Hub) Subscribe(notify func(projectID string)) (cancel func()) {
+	h.mu.Lock()
+	id := h.next
+	h.next++
+	h.subs[id] = notify
+	h.mu.Unlock()
+	return func() {
+		h.mu.Lock()
+		delete(h.subs, id)
+		h.mu.Unlock()
+	}
+}
+
+// Start receives notices until ctx is done. The Redis client reconnects and
+// resubscribes on its own after a connection loss.
+func (h *Hub) Start(ctx context.Context) {
+	pubsub := h.client.Subscribe(ctx, h.channel)
+	defer pubsub.Close()
+
+	slog.Info("Live tail listening", "channel", h.channel)
+	messages := pubsub.Channel()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case msg, ok := <-messages:
+			if !ok {
+				return
+			}
+			var n Notice
+			if err := json.Unmarshal([]byte(msg.Payload), &n); err != nil {
+				slog.Warn("Invalid live tail notice", "error", err)
+				continue
+			}
+			h.broadcast(n.ProjectID)
+		}
+	}
+}
+
+func (h *Hub) broadcast(projectID string) {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+	for _, notify := range h.subs {
+		notify(projectID)
+	}
+}
@@ -0,0 +1,46 @@
+package metrics
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+const contentType = "text/plain; version=0.0.4; charset=utf-8"
+
+// Handler serves the Default registry in the Prometheus text format.
+func Handler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		w.Header().Set("Content-Type", contentType)
+		Default.Write(w)
+	})
+}
+
+// GinMiddleware records request latency per route template. Requests that
+// match no route are reported under route "unmatched" to keep cardinality
+// bounded.
+func GinMiddleware(service string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		start := time.Now()
+		c.Next()
+
+		route := c.FullPath()
+		if route == "" {
+			route = "unmatched"
+		}
+		HTTPRequestDuration.Observe(time.Since(start).Seconds(),
+			service, c.Request.Method, route, strconv.Itoa(c.Writer.Status()))
+	}
+}
+
+// Serve runs a metrics server on its own listener, apart from the public
+// API, which scrapers reach on the internal network. It returns when the
+// server stops.
+func Serve(addr string) error {
+	mux := http.NewServeMux()
+	mux.Handle("/metrics", Handler())
+	srv := &http.Server{Addr: addr, Handler: mux, ReadHeaderTimeout: 5 * time.Second}
+	return srv.ListenAndServe()
+}
@@ -0,0 +1,87 @@
+// Package metrics exposes BatAudit's operational metrics in the Prometheus
+// text format. Every binary serves them on /metrics; a metric that a binary
+// never touches is simply reported without series.
+package metrics
+
+// Default is the registry served by Handler.
+var Default = NewRegistry()
+
+// slowBuckets cover background jobs that run for seconds to minutes.
+var slowBuckets = []float64{.1, .5, 1, 5, 15, 30, 60, 120, 300, 600, 1800}
+
+// ── Writer ────────────────────────────────────────────────────────────────────
+
+var (
+	// IngestEvents counts POST /v1/audit requests. status is "accepted" or
+	// "rejected"; code is the BAT error code, empty when accepted.
+	IngestEvents = Default.NewCounterVec("bataudit_ingest_events_total",
+		"Events received by the Writer.", "project_id", "status", "code")
+
+	// ValidationFailures counts ingest validation errors per offending field.
+	ValidationFailures = Default.NewCounterVec("bataudit_validation_failures_total",
+		"Ingest validation failures by field.", "field", "tag")
+)
+
+// ── Queue & worker ────────────────────────────────────────────────────────────
+
+var (
+	QueueDepth = Default.NewGaugeVec("bataudit_queue_depth",
+		"Items waiting in the Redis queue.", "queue")
+
+	DequeueDuration = Default.NewHistogramVec("bataudit_dequeue_duration_seconds",
+		"Time spent waiting on a dequeue that returned an item.", nil)
+
+	WorkersActive = Default.NewGaugeVec("bataudit_workers_active",
+		"Number of running worker goroutines.")
+
+	// ProcessingDuration measures dequeue-to-done per event. outcome is one of
+	// stored, failed, dropped, rejected, dead_letter.
+	ProcessingDuration = Default.NewHistogramVec("bataudit_event_processing_duration_seconds",
+		"Time to process one event, from dequeue to completion.", nil, "outcome")
+
+	ProcessingRetries = Default.NewCounterVec("bataudit_event_retries_total",
+		"Failed insert attempts that were retried.")
+
+	DeadLetters = Default.NewCounterVec("bataudit_dead_letters_total",
+		"Events moved to the dead-letter queue.", "project_id", "step")
+)
+
+// ── Anomaly, notifications, healthchecks ──────────────────────────────────────
+
+var (
+	AlertsFired = Default.NewCounterVec("bataudit_anomaly_alerts_total",
+		"Anomaly alerts fired, by rule.", "rule_type")
+
+	NotificationDeliveries = Default.NewCounterVec("bataudit_notification_deliveries_total",
+		"Notification delivery attempts, by channel type and status.", "channel", "status")
+
+	HealthcheckResults = Default.NewCounterVec("bataudit_healthcheck_results_total",
+		"Healthcheck probe results, by monitor and status.", "monitor", "status")
+
+	HealthcheckDuration = Default.NewHistogramVec("bataudit_healthcheck_response_seconds",
+		"Healthcheck probe response time.", nil, "monitor")
+)
+
+// ── Tiering ───────────────────────────────────────────────────────────────────
+
+var (
+	// TieringDuration and TieringRows are labelled by stage: raw_to_hourly or
+	// hourly_to_daily.
+	TieringDuration = Default.NewHistogramVec("bataudit_tiering_job_duration_seconds",
+		"Duration of a tiering aggregation stage.", slowBuckets, "stage", "status")
+
+	TieringRows = Default.NewCounterVec("bataudit_tiering_rows_moved_total",
+		"Rows aggregated and removed by tiering.", "stage")
+
+	// ArchiveFiles is labelled by status: ok (written and verified) or error.
+	ArchiveFiles = Default.NewCounterVec("bataudit_archive_files_total",
+		"Cold archive files written.", "status")
+
+	ArchiveRows = Default.NewCounterVec("bataudit_archive_rows_total",
+		"Raw events written to verified cold archive files.")
+)
+
+// ── HTTP ──────────────────────────────────────────────────────────────────────
+
+var HTTPRequestDuration = Default.NewHistogramVec("bataudit_http_request_duration_seconds",
+	"HTTP request latency by route.", nil, "service", "method", "route", "status")
@@ -0,0 +1,336 @@
+package metrics
+
+import (
+	"fmt"
+	"io"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+)
+
+// collector is anything that can render itself in the Prometheus text format.
+type collector interface {
+	name() string
+	write(w io.Writer)
+}
+
+// Registry holds the metrics exposed by one process.
+type Registry struct {
+	mu         sync.Mutex
+	collectors map[string]collector
+}
+
+func NewRegistry() *Registry {
+	return &Registry{collectors: make(map[string]collector)}
+}
+
+func (r *Registry) register(c collector) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if _, dup := r.collectors[c.name()]; dup {
+		panic("metrics: duplicate metric " + c.name())
+	}
+	r.collectors[c.name()] = c
+}
+
+// Write renders every registered metric, sorted by name.
+func (r *Registry) Write(w io.Writer) {
+	r.mu.Lock()
+	list := make([]collector, 0, len(r.collectors))
+	for _, c := range r.collectors {
+		list = append(list, c)
+	}
+	r.mu.Unlock()
+
+	sort.Slice(list, func(i, j int) bool { return list[i].name() < list[j].name() })
+	for _, c := range list {
+		c.write(w)
+	}
+}
+
+// ── label handling ────────────────────────────────────────────────────────────
+
+// maxSeries caps the number of label combinations per metric so a bad label
+// (e.g. a raw path) can't grow memory without bound. Extra series are folded
+// into a single series whose label values are all "other".
+const maxSeries = 2000
+
+type vec[T any] struct {
+	labels []string
+
+	mu     sync.RWMutex
+	series map[string]*T
+	values map[string][]string
+	newT   func() *T
+}
+
+func newVec[T any](labels []string, newT func() *T) vec[T] {
+	return vec[T]{
+		labels: labels,
+		series: make(map[string]*T),
+		values: make(map[string][]string),
+		newT:   newT,
+	}
+}
+
+func (v *vec[T]) get(values []string) *T {
+	if len(values) != len(v.labels) {
+		panic(fmt.Sprintf("metrics: expected %d label values, got %d", len(v.labels), len(values)))
+	}
+	key := strings.Join(values, "\xff")
+
+	v.mu.RLock()
+	s, ok := v.series[key]
+	v.mu.RUnlock()
+	if ok {
+		return s
+	}
+
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	if s, ok := v.series[key]; ok {
+		return s
+	}
+	if len(v.series) >= maxSeries {
+		values = make([]string, len(v.labels))
+		for i := range values {
+			values[i] = "other"
+		}
+		key = strings.Join(values, "\xff")
+		if s, ok := v.series[key]; ok {
+			return s
+		}
+	}
+	s = v.newT()
+	v.series[key] = s
+	v.values[key] = append([]string(nil), values...)
+	return s
+}
+
+// each calls fn for every series in a stable order.
+func (v *vec[T]) each(fn func(labels string, s *T)) {
+	v.mu.RLock()
+	keys := make([]string, 0, len(v.series))
+	for k := range v.series {
+		keys = append(keys, k)
+	}
+	v.mu.RUnlock()
+	sort.Strings(keys)
+
+	for _, k := range keys {
+		v.mu.RLock()
+		s, vals := v.series[k], v.values[k]
+		v.mu.RUnlock()
+		fn(formatLabels(v.labels, vals), s)
+	}
+}
+
+func formatLabels(names, values []string) string {
+	if len(names) == 0 {
+		return ""
+	}
+	var b strings.Builder
+	b.WriteByte('{')
+	for i, n := range names {
+		if i > 0 {
+			b.WriteByte(',')
+		}
+		b.WriteString(n)
+		b.WriteString(`="`)
+		b.WriteString(escapeLabel(values[i]))
+		b.WriteByte('"')
+	}
+	b.WriteByte('}')
+	return b.String()
+}
+
+var labelEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+
+func escapeLabel(s string) string { return labelEscaper.Replace(s) }
+
+// withLabel appends one more label to an already formatted label set.
+func withLabel(labels, name, value string) string {
+	pair := name + `="` + escapeLabel(value) + `"`
+	if labels == "" {
+		return "{" + pair + "}"
+	}
+	return labels[:len(labels)-1] + "," + pair + "}"
+}
+
+func formatFloat(f float64) string {
+	switch {
+	case math.IsInf(f, 1):
+		return "+Inf"
+	case math.IsInf(f, -1):
+		return "-Inf"
+	case math.IsNaN(f):
+		return "NaN"
+	}
+	return strconv.FormatFloat(f, 'g', -1, 64)
+}
+
+func writeHeader(w io.Writer, name, help, kind string) {
+	fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s %s\n", name, help, name, kind)
+}
+
+// atomicFloat is a float64 updated with compare-and-swap.
+type atomicFloat struct{ bits atomic.Uint64 }
+
+func (f *atomicFloat) add(delta float64) {
+	for {
+		old := f.bits.Load()
+		next := math.Float64bits(math.Float64frombits(old) + delta)
+		if f.bits.CompareAndSwap(old, next) {
+			return
+		}
+	}
+}
+
+func (f *atomicFloat) set(v float64) { f.bits.Store(math.Float64bits(v)) }
+func (f *atomicFloat) load() float64 { return math.Float64frombits(f.bits.Load()) }
+
+// ── counter ───────────────────────────────────────────────────────────────────
+
+// CounterVec is a monotonically increasing value per label combination.
+type CounterVec struct {
+	metricName, help string
+	vec[atomicFloat]
+}
+
+// NewCounterVec creates and registers a counter.
+func (r *Registry) NewCounterVec(name, help string, labels ...string) *CounterVec {
+	c := &CounterVec{metricName: name, help: help, vec: newVec(labels, func() *atomicFloat { return &atomicFloat{} })}
+	r.register(c)
+	return c
+}
+
+// Inc adds one to the series identified by the label values.
+func (c *CounterVec) Inc(labelValues ...string) { c.get(labelValues).add(1) }
+
+// Add adds n (which must not be negative) to the series.
+func (c *CounterVec) Add(n float64, labelValues ...string) {
+	if n < 0 {
+		return
+	}
+	c.get(labelValues).add(n)
+}
+
+func (c *CounterVec) name() string { return c.metricName }
+
+func (c *CounterVec) write(w io.Writer) {
+	writeHeader(w, c.metricName, c.help, "counter")
+	c.each(func(labels string, v *atomicFloat) {
+		fmt.Fprintf(w, "%s%s %s\n", c.metricName, labels, formatFloat(v.load()))
+	})
+}
+
+// ── gauge ─────────────────────────────────────────────────────────────────────
+
+// GaugeVec is a value that can go up and down, per label combination.
+type GaugeVec struct {
+	metricName, help string
+	vec[atomicFloat]
+}
+
+// NewGaugeVec creates and registers a gauge.
+func (r *Registry) NewGaugeVec(name, help string, labels ...string) *GaugeVec {
+	g := &GaugeVec{metricName: name, help: help, vec: newVec(labels, func() *atomicFloat { return &atomicFloat{} })}
+	r.register(g)
+	return g
+}
+
+func (g *GaugeVec) Set(v float64, labelValues ...string) { g.get(labelValues).set(v) }
+func (g *GaugeVec) Add(v float64, labelValues ...string) { g.get(labelValues).add(v) }
+
+func (g *GaugeVec) name() string { return g.metricName }
+
+func (g *GaugeVec) write(w io.Writer) {
+	writeHeader(w, g.metricName, g.help, "gauge")
+	g.each(func(labels string, v *atomicFloat) {
+		fmt.Fprintf(w, "%s%s %s\n", g.metricName, labels, formatFloat(v.load()))
+	})
+}
+
+// ── histogram ─────────────────────────────────────────────────────────────────
+
+// DefBuckets are latency buckets in seconds, from 5ms to 10s.
+var DefBuckets = []float64{.005, .01, .025, .05, .1, .25, .5, 1, 2.5, 5, 10}
+
+type histogram struct {
+	counts []atomic.Uint64 // one per bucket, non-cumulative
+	count  atomic.Uint64
+	sum    atomicFloat
+}
+
+// HistogramVec tracks the distribution of observed values per label combination.
+type HistogramVec struct {
+	metricName, help string
+	buckets          []float64
+	vec[histogram]
+}
+
+// NewHistogramVec creates and registers a histogram. Buckets must be sorted;
+// nil uses DefBuckets.
+func (r *Registry) NewHistogramVec(name, help string, buckets []float64, labels ...string) *HistogramVec {
+	if buckets == nil {
+		buckets = DefBuckets
+	}
+	h := &HistogramVec{metricName: name, help: help, buckets: buckets}
+	h.vec = newVec(labels, func() *histogram {
+		return &histogram{counts: make([]atomic.Uint64, len(buckets))}
+	})
+	r.register(h)
+	return h
+}
+
+// Observe records one value.
+func (h *HistogramVec) Observe(v float64, labelValues ...string) {
+	s := h.get(labelValues)
+	i := sort.SearchFloat64s(h.buckets, v)
+	if i < len(s.counts) {
+		s.counts[i].Add(1)
+	}
+	s.count.Add(1)
+	s.sum.add(v)
+}
+
+func (h *HistogramVec) name() string { return h.metricName }
+
+func (h *HistogramVec) write(w io.Writer) {
+	writeHeader(w, h.metricName, h.help, "histogram")
+	h.each(func(labels string, s *histogram) {
+		var cumulative uint64
+		for i, le := range h.buckets {
+			cumulative += s.counts[i].Load()
+			fmt.Fprintf(w, "%s_bucket%s %d\n", h.metricName, withLabel(labels, "le", formatFloat(le)), cumulative)
+		}
+		fmt.Fprintf(w, "%s_bucket%s %d\n", h.metricName, withLabel(labels, "le", "+Inf"), s.count.Load())
+		fmt.Fprintf(w, "%s_sum%s %s\n", h.metricName, labels, formatFloat(s.sum.load()))
+		fmt.Fprintf(w, "%s_count%s %d\n", h.metricName, labels, s.count.Load())
+	})
+}
+
+// ── gauge func ────────────────────────────────────────────────────────────────
+
+// GaugeFunc is a gauge whose value is read when metrics are scraped.
+type GaugeFunc struct {
+	metricName, help string
+	fn               func() float64
+}
+
+// NewGaugeFunc creates and registers a gauge backed by fn.
+func (r *Registry) NewGaugeFunc(name, help string, fn func() float64) *GaugeFunc {
+	g := &GaugeFunc{metricName: name, help: help, fn: fn}
+	r.register(g)
+	return g
+}
+
+func (g *GaugeFunc) name() string { return g.metricName }
+
+func (g *GaugeFunc) write(w io.Writer) {
+	writeHeader(w, g.metricName, g.help, "gauge")
+	fmt.Fprintf(w, "%s %s\n", g.metricName, formatFloat(g.fn()))
+}
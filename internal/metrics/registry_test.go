@@ -0,0 +1,78 @@
+package metrics
+
+import (
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func render(r *Registry) string {
+	var b strings.Builder
+	r.Write(&b)
+	return b.String()
+}
+
+func TestCounterVec_exposition(t *testing.T) {
+	r := NewRegistry()
+	c := r.NewCounterVec("test_total", "A test counter.", "code")
+	c.Inc("BAT-001")
+	c.Inc("BAT-001")
+	c.Add(3, `quote"d`)
+	c.Add(-1, "BAT-001") // ignored: counters never decrease
+
+	out := render(r)
+
+	assert.Contains(t, out, "# HELP test_total A test counter.\n# TYPE test_total counter\n")
+	assert.Contains(t, out, `test_total{code="BAT-001"} 2`+"\n")
+	assert.Contains(t, out, `test_total{code="quote\"d"} 3`+"\n")
+}
+
+func TestHistogramVec_cumulativeBuckets(t *testing.T) {
+	r := NewRegistry()
+	h := r.NewHistogramVec("test_seconds", "A test histogram.", []float64{0.1, 1}, "route")
+	h.Observe(0.05, "/a")
+	h.Observe(0.1, "/a") // upper bounds are inclusive
+	h.Observe(0.5, "/a")
+	h.Observe(5, "/a")
+
+	out := render(r)
+
+	assert.Contains(t, out, `test_seconds_bucket{route="/a",le="0.1"} 2`)
+	assert.Contains(t, out, `test_seconds_bucket{route="/a",le="1"} 3`)
+	assert.Contains(t, out, `test_seconds_bucket{route="/a",le="+Inf"} 4`)
+	assert.Contains(t, out, `test_seconds_sum{route="/a"} 5.65`)
+	assert.Contains(t, out, `test_seconds_count{route="/a"} 4`)
+}
+
+func TestGauges(t *testing.T) {
+	r := NewRegistry()
+	g := r.NewGaugeVec("test_depth", "Depth.")
+	g.Set(7)
+	g.Add(-2)
+	r.NewGaugeFunc("test_func", "Func.", func() float64 { return 1.5 })
+
+	out := render(r)
+
+	assert.Contains(t, out, "test_depth 5\n")
+	assert.Contains(t, out, "test_func 1.5\n")
+	assert.Less(t, strings.Index(out, "test_depth"), strings.Index(out, "test_func"), "metrics are sorted by name")
+}
+
+func TestVec_seriesCap(t *testing.T) {
+	r := NewRegistry()
+	c := r.NewCounterVec("test_capped_total", "Capped.", "path")
+	for i := 0; i < maxSeries+10; i++ {
+		c.Inc("/users/" + strconv.Itoa(i))
+	}
+
+	assert.LessOrEqual(t, len(c.series), maxSeries+1)
+	assert.Contains(t, render(r), `test_capped_total{path="other"}`)
+}
+
+func TestRegistry_duplicatePanics(t *testing.T) {
+	r := NewRegistry()
+	r.NewCounterVec("dup_total", "x")
+	assert.Panics(t, func() { r.NewGaugeVec("dup_total", "x") })
+}
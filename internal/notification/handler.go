@@ -127,12 +127,7 @@ func (h *Handler) ListWebhooks(c *gin.Context) {
 
 // CreateWebhook registers a new webhook channel.
 func (h *Handler) CreateWebhook(c *gin.Context) {
-	claims := mustClaims(c)
-	if claims == nil {
-		return
-	}
-	if claims.Role != auth.RoleOwner && claims.Role != auth.RoleAdmin {
-		c.JSON(http.StatusForbidden, gin.H{"error": "insufficient permissions"})
+	if !auth.RequireManager(c) {
 		return
 	}
 
@@ -165,12 +160,7 @@ func (h *Handler) CreateWebhook(c *gin.Context) {
 
 // DeleteWebhook deactivates a webhook channel.
 func (h *Handler) DeleteWebhook(c *gin.Context) {
-	claims := mustClaims(c)
-	if claims == nil {
-		return
-	}
-	if claims.Role != auth.RoleOwner && claims.Role != auth.RoleAdmin {
-		c.JSON(http.StatusForbidden, gin.H{"error": "insufficient permissions"})
+	if !auth.RequireManager(c) {
 		return
 	}
 
@@ -14,6 +14,7 @@ import (
 
 	webpush "github.com/SherClockHolmes/webpush-go"
 	"github.com/google/uuid"
+	"github.com/joaovrmoraes/bataudit/internal/metrics"
 )
 
 // Sender loads active channels for a project and dispatches notifications.
@@ -67,6 +68,7 @@ func (s *Sender) NotifyAll(ctx context.Context, payload AlertPayload) {
 					"channel_id", ch.ID, "type", ch.Type, "error", sendErr)
 			}
 
+			metrics.NotificationDeliveries.Inc(string(ch.Type), status)
 			_ = s.repo.CreateDelivery(&Delivery{
 				ID:           uuid.New().String(),
 				ChannelID:    ch.ID,
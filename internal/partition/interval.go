@@ -0,0 +1,124 @@
+package partition
+
+import (
+	"fmt"
+	"regexp"
+	"time"
+)
+
+// Interval is the width of one audits partition.
+type Interval string
+
+const (
+	Daily   Interval = "day"
+	Monthly Interval = "month"
+)
+
+func (i Interval) IsValid() bool { return i == Daily || i == Monthly }
+
+// start returns the beginning of the partition containing t (UTC).
+func (i Interval) start(t time.Time) time.Time {
+	t = t.UTC()
+	if i == Daily {
+		return time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, time.UTC)
+	}
+	return time.Date(t.Year(), t.Month(), 1, 0, 0, 0, 0, time.UTC)
+}
+
+// next returns the start of the partition after the one starting at t.
+func (i Interval) next(t time.Time) time.Time {
+	if i == Daily {
+		return t.AddDate(0, 0, 1)
+	}
+	return t.AddDate(0, 1, 0)
+}
+
+// tableName returns the partition name for the range starting at t, e.g.
+// audits_p2026_11 (monthly) or audits_p2026_11_05 (daily).
+func (i Interval) tableName(t time.Time) string {
+	if i == Daily {
+		return fmt.Sprintf("%s_p%s", parentTable, t.Format("2006_01_02"))
+	}
+	return fmt.Sprintf("%s_p%s", parentTable, t.Format("2006_01"))
+}
+
+// Range is one partition's bounds: [From, To). A zero From means MINVALUE,
+// which is only used for the legacy partition created by the conversion.
+type Range struct {
+	Name string
+	From time.Time
+	To   time.Time
+}
+
+// upcoming returns the partitions that should exist from now on: the current
+// one plus premake future ones.
+func (i Interval) upcoming(now time.Time, premake int) []Range {
+	ranges := make([]Range, 0, premake+1)
+	from := i.start(now)
+	for n := 0; n <= premake; n++ {
+		to := i.next(from)
+		ranges = append(ranges, Range{Name: i.tableName(from), From: from, To: to})
+		from = to
+	}
+	return ranges
+}
+
+// expired returns the partitions that lie entirely before cutoff.
+func expired(parts []Range, cutoff time.Time) []Range {
+	var out []Range
+	for _, p := range parts {
+		if !p.To.After(cutoff) {
+			out = append(out, p)
+		}
+	}
+	return out
+}
+
+const boundLayout = "2006-01-02 15:04:05"
+
+var (
+	// FOR VALUES FROM ('2026-11-01 00:00:00') TO ('2026-12-01 00:00:00')
+	// FOR VALUES FROM (MINVALUE) TO ('2026-12-01 00:00:00')
+	boundExpr = regexp.MustCompile(`FROM \((MINVALUE|'[^']+')\) TO \('([^']+)'\)`)
+	// CHECK (("timestamp" < '2026-12-01 00:00:00'::timestamp without time zone))
+	checkExpr = regexp.MustCompile(`< '([^']+)'`)
+)
+
+// parseBound reads a partition bound as returned by pg_get_expr(relpartbound).
+func parseBound(name, expr string) (Range, error) {
+	m := boundExpr.FindStringSubmatch(expr)
+	if m == nil {
+		return Range{}, fmt.Errorf("partition %s: unsupported bound %q", name, expr)
+	}
+	r := Range{Name: name}
+	var err error
+	if m[1] != "MINVALUE" {
+		if r.From, err = parseTimestamp(m[1][1 : len(m[1])-1]); err != nil {
+			return Range{}, err
+		}
+	}
+	if r.To, err = parseTimestamp(m[2]); err != nil {
+		return Range{}, err
+	}
+	return r, nil
+}
+
+// parseCheckBound reads the cutover from the legacy table's CHECK constraint.
+func parseCheckBound(def string) (time.Time, error) {
+	m := checkExpr.FindStringSubmatch(def)
+	if m == nil {
+		return time.Time{}, fmt.Errorf("unsupported constraint %q", def)
+	}
+	return parseTimestamp(m[1])
+}
+
+func parseTimestamp(s string) (time.Time, error) {
+	if len(s) > len(boundLayout) {
+		s = s[:len(boundLayout)] // drop fractional seconds / zone suffix
+	}
+	return time.ParseInLocation(boundLayout, s, time.UTC)
+}
+
+func formatTimestamp(t time.Time) string {
+	return t.UTC().Format(boundLayout)
+}
@@ -0,0 +1,88 @@
+package partition
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func date(y int, m time.Month, d int) time.Time {
+	return time.Date(y, m, d, 0, 0, 0, 0, time.UTC)
+}
+
+func TestInterval_upcoming(t *testing.T) {
+	now := time.Date(2026, 12, 30, 15, 4, 5, 0, time.UTC)
+
+	monthly := Monthly.upcoming(now, 2)
+	require.Len(t, monthly, 3)
+	assert.Equal(t, Range{Name: "audits_p2026_12", From: date(2026, 12, 1), To: date(2027, 1, 1)}, monthly[0])
+	assert.Equal(t, "audits_p2027_02", monthly[2].Name)
+	assert.Equal(t, date(2027, 3, 1), monthly[2].To)
+
+	daily := Daily.upcoming(now, 2)
+	require.Len(t, daily, 3)
+	assert.Equal(t, "audits_p2026_12_30", daily[0].Name)
+	assert.Equal(t, Range{Name: "audits_p2027_01_01", From: date(2027, 1, 1), To: date(2027, 1, 2)}, daily[2])
+}
+
+func TestExpired(t *testing.T) {
+	parts := []Range{
+		{Name: legacyTable, To: date(2026, 9, 1)},
+		{Name: "audits_p2026_09", From: date(2026, 9, 1), To: date(2026, 10, 1)},
+		{Name: "audits_p2026_10", From: date(2026, 10, 1), To: date(2026, 11, 1)},
+	}
+
+	got := expired(parts, date(2026, 10, 1))
+
+	require.Len(t, got, 2, "a partition ending exactly at the cutoff is fully expired")
+	assert.Equal(t, legacyTable, got[0].Name)
+	assert.Equal(t, "audits_p2026_09", got[1].Name)
+	assert.Empty(t, expired(parts, date(2026, 8, 31)))
+}
+
+func TestParseBound(t *testing.T) {
+	r, err := parseBound("audits_p2026_11", "FOR VALUES FROM ('2026-11-01 00:00:00') TO ('2026-12-01 00:00:00')")
+	require.NoError(t, err)
+	assert.Equal(t, date(2026, 11, 1), r.From)
+	assert.Equal(t, date(2026, 12, 1), r.To)
+
+	r, err = parseBound(legacyTable, "FOR VALUES FROM (MINVALUE) TO ('2026-12-01 00:00:00')")
+	require.NoError(t, err)
+	assert.True(t, r.From.IsZero())
+	assert.Equal(t, date(2026, 12, 1), r.To)
+
+	_, err = parseBound("x", "FOR VALUES IN ('a')")
+	assert.Error(t, err)
+}
+
+func TestParseCheckBound(t *testing.T) {
+	got, err := parseCheckBound(`CHECK (("timestamp" < '2027-01-01 00:00:00'::timestamp without time zone)) NOT VALID`)
+	require.NoError(t, err)
+	assert.Equal(t, date(2027, 1, 1), got)
+}
+
+func TestIndexTarget(t *testing.T) {
+	def := "CREATE INDEX idx_audits_project_timestamp ON public.audits_legacy USING btree (project_id, \"timestamp\" DESC)"
+	assert.Equal(t,
+		"CREATE INDEX idx_audits_project_timestamp ON audits USING btree (project_id, \"timestamp\" DESC)",
+		indexTarget.ReplaceAllString(def, " ON "+parentTable+" "))
+}
+
+func TestLegacyIndexName(t *testing.T) {
+	assert.Equal(t, "idx_audits_event_type_legacy", legacyIndexName("idx_audits_event_type"))
+	assert.Len(t, legacyIndexName(strings.Repeat("x", 63)), 63)
+}
+
+func TestConfigFromEnv(t *testing.T) {
+	env := map[string]string{"AUDIT_PARTITION_INTERVAL": "day", "AUDIT_PARTITION_PREMAKE": "7", "AUDIT_PARTITION_EXPIRED": "bogus"}
+	cfg := ConfigFromEnv(func(k, def string) string {
+		if v, ok := env[k]; ok {
+			return v
+		}
+		return def
+	})
+	assert.Equal(t, Config{Interval: Daily, Premake: 7, Expired: Drop}, cfg)
+}
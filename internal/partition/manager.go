@@ -0,0 +1,518 @@
+// Package partition converts the audits table to native Postgres range
+// partitions on timestamp and keeps them maintained: future partitions are
+// created ahead of time and expired ones are detached or dropped after the
+// tiering job has aggregated them, instead of being removed with DELETE.
+package partition
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"log/slog"
+	"regexp"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/joaovrmoraes/bataudit/internal/audit"
+	"github.com/joaovrmoraes/bataudit/internal/legalhold"
+	"gorm.io/gorm"
+)
+
+const (
+	parentTable      = "audits"
+	legacyTable      = "audits_legacy"
+	defaultPartition = "audits_default"
+	cutoverCheck     = "audits_partition_cutover"
+
+	// idKey keeps id unique across partitions. A unique index on a
+	// partitioned table must include the partition key, so it covers
+	// (id, timestamp); each partition also has its own primary key on id.
+	idKey = "audits_id_timestamp_key"
+
+	// advisoryLockKey serializes maintenance across worker replicas.
+	advisoryLockKey = 0x62617461 // "bata"
+
+	maintenanceInterval = time.Hour
+)
+
+// ExpiredAction is what happens to a partition once it is past retention.
+type ExpiredAction string
+
+const (
+	Drop   ExpiredAction = "drop"   // remove the partition and its data
+	Detach ExpiredAction = "detach" // keep it as a standalone table, outside audits
+)
+
+// Config controls partitioning. A zero Interval disables it.
+type Config struct {
+	Interval Interval
+	Premake  int // future partitions to keep ahead of now
+	Expired  ExpiredAction
+}
+
+// ConfigFromEnv reads AUDIT_PARTITION_INTERVAL ("", "day" or "month"),
+// AUDIT_PARTITION_PREMAKE (default 3) and AUDIT_PARTITION_EXPIRED
+// ("drop" or "detach", default "drop").
+func ConfigFromEnv(getEnv func(string, string) string) Config {
+	cfg := Config{
+		Interval: Interval(getEnv("AUDIT_PARTITION_INTERVAL", "")),
+		Premake:  3,
+		Expired:  ExpiredAction(getEnv("AUDIT_PARTITION_EXPIRED", string(Drop))),
+	}
+	if n, err := strconv.Atoi(getEnv("AUDIT_PARTITION_PREMAKE", "3")); err == nil && n > 0 {
+		cfg.Premake = n
+	}
+	if cfg.Expired != Detach {
+		cfg.Expired = Drop
+	}
+	return cfg
+}
+
+// Manager maintains the audits partitions.
+type Manager struct {
+	db  *gorm.DB
+	cfg Config
+}
+
+func NewManager(db *gorm.DB, cfg Config) *Manager {
+	return &Manager{db: db, cfg: cfg}
+}
+
+// Enabled reports whether partitioning is configured and supported by the
+// database. SQLite has no native partitioning, so it is always disabled there.
+func (m *Manager) Enabled() bool {
+	return m.cfg.Interval.IsValid() && m.db.Dialector.Name() == "postgres"
+}
+
+// Active reports whether audits is currently a partitioned table.
+func (m *Manager) Active(ctx context.Context) bool {
+	if !m.Enabled() {
+		return false
+	}
+	ok, err := m.isPartitioned(m.db.WithContext(ctx))
+	if err != nil {
+		slog.Error("partition: failed to inspect audits", "error", err)
+	}
+	return ok
+}
+
+// Start converts the table if needed and then keeps future partitions
+// created, checking once an hour. It blocks until ctx is cancelled.
+func (m *Manager) Start(ctx context.Context) {
+	if m.cfg.Interval != "" && !m.Enabled() {
+		slog.Warn("partition: AUDIT_PARTITION_INTERVAL ignored (needs postgres and \"day\" or \"month\")",
+			"interval", m.cfg.Interval, "driver", m.db.Dialector.Name())
+	}
+	if !m.Enabled() {
+		return
+	}
+
+	ticker := time.NewTicker(maintenanceInterval)
+	defer ticker.Stop()
+	for {
+		if err := m.Maintain(ctx); err != nil {
+			slog.Error("partition: maintenance failed", "error", err)
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// Maintain runs one maintenance pass: convert (or continue converting) the
+// table, then make sure the current and upcoming partitions exist.
+func (m *Manager) Maintain(ctx context.Context) error {
+	return m.withLock(ctx, func(conn *gorm.DB) error {
+		partitioned, err := m.isPartitioned(conn)
+		if err != nil {
+			return err
+		}
+		if !partitioned {
+			if err := m.convert(conn); err != nil {
+				return fmt.Errorf("convert: %w", err)
+			}
+		}
+		return m.ensureFuture(conn, time.Now())
+	})
+}
+
+// ExpiredBefore returns the end of the newest partition DropExpired would
+// remove for cutoff, or the zero time if none has expired.
+func (m *Manager) ExpiredBefore(ctx context.Context, cutoff time.Time) (time.Time, error) {
+	parts, err := m.partitions(m.db.WithContext(ctx))
+	if err != nil {
+		return time.Time{}, err
+	}
+	var bound time.Time
+	for _, p := range expired(parts, cutoff) {
+		if p.To.After(bound) {
+			bound = p.To
+		}
+	}
+	return bound, nil
+}
+
+// Expirable selects the rows a partition drop may remove: the HTTP events of
+// a project, which the raw retention rules always cover. Other event types
+// and events without a project are moved to the default partition until a
+// policy names them, and the tiering job deletes those row by row.
+const Expirable = "event_type = 'http' AND project_id IS NOT NULL AND project_id != ''"
+
+// DropExpired detaches (and, unless configured to keep them, drops) every
+// partition whose range ends at or before cutoff. Rows that must stay, those
+// under a legal hold or not Expirable, are first moved into the default
+// partition, so the partition still goes in one piece. It returns the
+// estimated number of rows removed from audits.
+func (m *Manager) DropExpired(ctx context.Context, cutoff time.Time) (int64, error) {
+	var total int64
+	err := m.withLock(ctx, func(conn *gorm.DB) error {
+		parts, err := m.partitions(conn)
+		if err != nil {
+			return err
+		}
+		for _, p := range expired(parts, cutoff) {
+			var rows int64
+			conn.Raw(`SELECT GREATEST(reltuples, 0)::bigint FROM pg_class WHERE oid = to_regclass(?)`, p.Name).Scan(&rows)
+
+			// Detach, move out the rows that stay and record the remaining
+			// chain links as removed in one transaction, so late inserts
+			// can't slip between. Once detached, nothing covers the
+			// partition's range, and the moved rows land in the default
+			// partition.
+			var moved int64
+			err := conn.Transaction(func(tx *gorm.DB) error {
+				if err := tx.Exec(fmt.Sprintf(`ALTER TABLE %s DETACH PARTITION %s`, parentTable, p.Name)).Error; err != nil {
+					return err
+				}
+				stays := fmt.Sprintf(`%s OR NOT COALESCE(%s, FALSE)`, legalhold.Held(p.Name), Expirable)
+				res := tx.Exec(fmt.Sprintf(`INSERT INTO %s SELECT * FROM %s WHERE %s`, parentTable, p.Name, stays))
+				if res.Error != nil {
+					return res.Error
+				}
+				moved = res.RowsAffected
+				if moved > 0 {
+					if err := tx.Exec(fmt.Sprintf(`DELETE FROM %s WHERE %s`, p.Name, stays)).Error; err != nil {
+						return err
+					}
+				}
+				return audit.CheckpointTable(tx, p.Name, audit.CheckpointPartitionDrop)
+			})
+			if err != nil {
+				return fmt.Errorf("detach %s: %w", p.Name, err)
+			}
+			if m.cfg.Expired == Drop {
+				if err := conn.Exec(fmt.Sprintf(`DROP TABLE %s`, p.Name)).Error; err != nil {
+					return fmt.Errorf("drop %s: %w", p.Name, err)
+				}
+			}
+			rows = max(rows-moved, 0)
+			slog.Info("partition: expired partition removed",
+				"partition", p.Name, "to", p.To.Format(time.RFC3339), "action", m.cfg.Expired, "rows", rows, "rows_kept", moved)
+			total += rows
+		}
+		return nil
+	})
+	return total, err
+}
+
+// withLock runs fn on a single pooled connection while holding the advisory
+// lock, so only one replica does maintenance at a time. If another replica
+// holds the lock, fn is skipped.
+func (m *Manager) withLock(ctx context.Context, fn func(conn *gorm.DB) error) error {
+	return m.db.WithContext(ctx).Connection(func(conn *gorm.DB) error {
+		var locked bool
+		if err := conn.Raw(`SELECT pg_try_advisory_lock(?)`, advisoryLockKey).Scan(&locked).Error; err != nil {
+			return err
+		}
+		if !locked {
+			slog.Debug("partition: maintenance running elsewhere, skipping")
+			return nil
+		}
+		defer conn.Exec(`SELECT pg_advisory_unlock(?)`, advisoryLockKey)
+
+		// DDL below takes short exclusive locks; never queue behind a long
+		// query for more than a few seconds.
+		if err := conn.Exec(`SET lock_timeout = '5s'`).Error; err != nil {
+			return err
+		}
+		defer conn.Exec(`RESET lock_timeout`)
+
+		return fn(conn)
+	})
+}
+
+func (m *Manager) isPartitioned(conn *gorm.DB) (bool, error) {
+	var ok bool
+	err := conn.Raw(`SELECT EXISTS (SELECT 1 FROM pg_partitioned_table WHERE partrelid = to_regclass(?))`, parentTable).
+		Scan(&ok).Error
+	return ok, err
+}
+
+// partitions lists the range partitions of audits, oldest first. The default
+// partition is not included.
+func (m *Manager) partitions(conn *gorm.DB) ([]Range, error) {
+	var rows []struct {
+		Name  string
+		Bound string
+	}
+	err := conn.Raw(`
+		SELECT c.relname AS name, pg_get_expr(c.relpartbound, c.oid) AS bound
+		FROM pg_inherits i
+		JOIN pg_class c ON c.oid = i.inhrelid
+		WHERE i.inhparent = to_regclass(?)
+	`, parentTable).Scan(&rows).Error
+	if err != nil {
+		return nil, err
+	}
+
+	out := make([]Range, 0, len(rows))
+	for _, r := range rows {
+		if r.Bound == "DEFAULT" {
+			continue
+		}
+		p, err := parseBound(r.Name, r.Bound)
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, p)
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].To.Before(out[j].To) })
+	return out, nil
+}
+
+// ensureFuture creates the partitions needed from the newest existing one up
+// to premake periods ahead of now, filling any gap left while maintenance
+// was not running.
+func (m *Manager) ensureFuture(conn *gorm.DB, now time.Time) error {
+	parts, err := m.partitions(conn)
+	if err != nil {
+		return err
+	}
+	iv := m.cfg.Interval
+	wanted := iv.upcoming(now, m.cfg.Premake)
+	horizon := wanted[len(wanted)-1].To
+
+	from := wanted[0].From
+	if len(parts) > 0 {
+		from = parts[len(parts)-1].To
+	}
+	for from.Before(horizon) {
+		// A partition may start mid-period if the interval was changed (or
+		// right after the conversion cutover); it still ends on a boundary.
+		to := iv.next(iv.start(from))
+		if err := m.createPartition(conn, Range{Name: iv.tableName(from), From: from, To: to}); err != nil {
+			return err
+		}
+		from = to
+	}
+	return nil
+}
+
+// createPartition builds the partition as a standalone table, moves any rows
+// for its range out of the default partition, and attaches it. Attaching only
+// scans the new table and the (small) default partition.
+func (m *Manager) createPartition(conn *gorm.DB, r Range) error {
+	from, to := formatTimestamp(r.From), formatTimestamp(r.To)
+	stmts := []string{
+		fmt.Sprintf(`CREATE TABLE %s (LIKE %s INCLUDING DEFAULTS INCLUDING STORAGE)`, r.Name, parentTable),
+		fmt.Sprintf(`ALTER TABLE %s ADD PRIMARY KEY (id)`, r.Name),
+		fmt.Sprintf(`INSERT INTO %s SELECT * FROM %s WHERE timestamp >= '%s' AND timestamp < '%s'`, r.Name, defaultPartition, from, to),
+		fmt.Sprintf(`DELETE FROM %s WHERE timestamp >= '%s' AND timestamp < '%s'`, defaultPartition, from, to),
+		fmt.Sprintf(`ALTER TABLE %s ATTACH PARTITION %s FOR VALUES FROM ('%s') TO ('%s')`, parentTable, r.Name, from, to),
+	}
+	err := conn.Transaction(func(tx *gorm.DB) error {
+		for _, s := range stmts {
+			if err := tx.Exec(s).Error; err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return fmt.Errorf("create partition %s: %w", r.Name, err)
+	}
+	slog.Info("partition: created", "partition", r.Name, "from", from, "to", to)
+	return nil
+}
+
+// convert turns the plain audits table into a partitioned one without
+// copying data. The existing table becomes the partition for everything
+// before a cutover a full period or more in the future:
+//
+//  1. add CHECK (timestamp < cutover) NOT VALID          — brief lock
+//  2. VALIDATE the constraint and build a unique (id, timestamp) index
+//     CONCURRENTLY                                         — full scans, but reads and writes continue
+//  3. in one transaction: rename to audits_legacy, create the partitioned
+//     audits, attach audits_legacy FROM (MINVALUE) TO (cutover) — the valid
+//     CHECK lets Postgres skip the scan, so this holds its lock only briefly
+//
+// Each step is resumable; the legacy partition ages out through DropExpired
+// like any other once the cutover is past retention.
+func (m *Manager) convert(conn *gorm.DB) error {
+	iv := m.cfg.Interval
+	now := time.Now()
+
+	cutover, err := m.existingCutover(conn)
+	if err != nil {
+		return err
+	}
+	// Inserts past the cutover would violate the CHECK until the swap, so
+	// start again if a previous attempt left a cutover that is too close.
+	minCutover := iv.next(iv.start(now))
+	if !cutover.IsZero() && cutover.Before(minCutover) {
+		if err := conn.Exec(fmt.Sprintf(`ALTER TABLE %s DROP CONSTRAINT %s`, parentTable, cutoverCheck)).Error; err != nil {
+			return err
+		}
+		cutover = time.Time{}
+	}
+	if cutover.IsZero() {
+		cutover = iv.next(minCutover)
+		slog.Info("partition: starting conversion of audits", "cutover", formatTimestamp(cutover))
+		if err := conn.Exec(fmt.Sprintf(`ALTER TABLE %s ADD CONSTRAINT %s CHECK (timestamp < '%s') NOT VALID`,
+			parentTable, cutoverCheck, formatTimestamp(cutover))).Error; err != nil {
+			return err
+		}
+	}
+
+	// Validation scans the whole table; allow it to wait for locks normally.
+	if err := conn.Exec(`SET lock_timeout = 0`).Error; err != nil {
+		return err
+	}
+	err = conn.Exec(fmt.Sprintf(`ALTER TABLE %s VALIDATE CONSTRAINT %s`, parentTable, cutoverCheck)).Error
+	if err != nil {
+		conn.Exec(`SET lock_timeout = '5s'`)
+		return fmt.Errorf("validate cutover (rows dated at or after %s?): %w", formatTimestamp(cutover), err)
+	}
+	err = buildIDKey(conn)
+	conn.Exec(`SET lock_timeout = '5s'`)
+	if err != nil {
+		return fmt.Errorf("build %s: %w", legacyIndexName(idKey), err)
+	}
+
+	if err := conn.Transaction(func(tx *gorm.DB) error { return swap(tx, cutover) }); err != nil {
+		return fmt.Errorf("swap: %w", err)
+	}
+	slog.Info("partition: audits is now partitioned", "legacy_until", formatTimestamp(cutover))
+	return nil
+}
+
+// existingCutover returns the cutover of a previous, unfinished conversion.
+func (m *Manager) existingCutover(conn *gorm.DB) (time.Time, error) {
+	var def sql.NullString
+	err := conn.Raw(`SELECT pg_get_constraintdef(oid) FROM pg_constraint WHERE conrelid = to_regclass(?) AND conname = ?`,
+		parentTable, cutoverCheck).Scan(&def).Error
+	if err != nil || !def.Valid {
+		return time.Time{}, err
+	}
+	return parseCheckBound(def.String)
+}
+
+// buildIDKey builds, on the plain audits table, the unique index that the
+// partitioned parent's idKey adopts on ATTACH. An interrupted concurrent
+// build leaves an invalid index behind, which is dropped and rebuilt.
+func buildIDKey(conn *gorm.DB) error {
+	name := legacyIndexName(idKey)
+	var valid sql.NullBool
+	if err := conn.Raw(`SELECT indisvalid FROM pg_index WHERE indexrelid = to_regclass(?)`, name).Scan(&valid).Error; err != nil {
+		return err
+	}
+	if valid.Valid && valid.Bool {
+		return nil
+	}
+	if valid.Valid {
+		if err := conn.Exec(fmt.Sprintf(`DROP INDEX CONCURRENTLY %s`, name)).Error; err != nil {
+			return err
+		}
+	}
+	return conn.Exec(fmt.Sprintf(`CREATE UNIQUE INDEX CONCURRENTLY %s ON %s (id, timestamp)`, name, parentTable)).Error
+}
+
+var indexTarget = regexp.MustCompile(` ON (\S+\.)?` + legacyTable + ` `)
+
+// swap performs step 3 of the conversion inside tx.
+func swap(tx *gorm.DB, cutover time.Time) error {
+	exec := func(format string, args ...any) error {
+		return tx.Exec(fmt.Sprintf(format, args...)).Error
+	}
+
+	if err := exec(`ALTER TABLE %s RENAME TO %s`, parentTable, legacyTable); err != nil {
+		return err
+	}
+
+	// Recreate the legacy table's non-unique indexes on the new parent under
+	// their original names. On ATTACH, Postgres adopts the matching legacy
+	// indexes instead of building new ones.
+	var indexes []struct {
+		IndexName string `gorm:"column:indexname"`
+		IndexDef  string `gorm:"column:indexdef"`
+	}
+	if err := tx.Raw(`SELECT indexname, indexdef FROM pg_indexes WHERE tablename = ? AND indexdef NOT LIKE 'CREATE UNIQUE%'`, legacyTable).
+		Scan(&indexes).Error; err != nil {
+		return err
+	}
+	for _, ix := range indexes {
+		if err := exec(`ALTER INDEX %s RENAME TO %s`, ix.IndexName, legacyIndexName(ix.IndexName)); err != nil {
+			return err
+		}
+	}
+
+	if err := exec(`CREATE TABLE %s (LIKE %s INCLUDING DEFAULTS INCLUDING STORAGE INCLUDING COMMENTS) PARTITION BY RANGE (timestamp)`,
+		parentTable, legacyTable); err != nil {
+		return err
+	}
+	if err := exec(`ALTER TABLE %s ADD FOREIGN KEY (project_id) REFERENCES projects(id)`, parentTable); err != nil {
+		return err
+	}
+	for _, ix := range indexes {
+		def := indexTarget.ReplaceAllString(ix.IndexDef, " ON "+parentTable+" ")
+		if def == ix.IndexDef {
+			return errors.New("unexpected index definition: " + ix.IndexDef)
+		}
+		if err := tx.Exec(def).Error; err != nil {
+			return err
+		}
+	}
+	// The legacy table's copy was built by buildIDKey; new partitions get
+	// theirs when they are attached.
+	if err := exec(`CREATE UNIQUE INDEX %s ON %s (id, timestamp)`, idKey, parentTable); err != nil {
+		return err
+	}
+
+	if err := exec(`ALTER TABLE %s ATTACH PARTITION %s FOR VALUES FROM (MINVALUE) TO ('%s')`,
+		parentTable, legacyTable, formatTimestamp(cutover)); err != nil {
+		return err
+	}
+	if err := exec(`ALTER TABLE %s DROP CONSTRAINT %s`, legacyTable, cutoverCheck); err != nil {
+		return err
+	}
+
+	// Catch-all for out-of-range timestamps (e.g. client clocks far in the
+	// future); createPartition moves its rows into place later.
+	if err := exec(`CREATE TABLE %s PARTITION OF %s DEFAULT`, defaultPartition, parentTable); err != nil {
+		return err
+	}
+	if err := exec(`ALTER TABLE %s ADD PRIMARY KEY (id)`, defaultPartition); err != nil {
+		return err
+	}
+
+	// Keep the Query Console's read-only role working (see migration 000016).
+	return exec(`DO $$ BEGIN
+		IF EXISTS (SELECT 1 FROM pg_roles WHERE rolname = 'bataudit_readonly') THEN
+			GRANT SELECT ON %s TO bataudit_readonly;
+		END IF;
+	END $$`, parentTable)
+}
+
+// legacyIndexName frees an index name for the new parent, staying within
+// Postgres' 63-byte identifier limit.
+func legacyIndexName(name string) string {
+	const suffix = "_legacy"
+	if len(name)+len(suffix) > 63 {
+		name = name[:63-len(suffix)]
+	}
+	return name + suffix
+}
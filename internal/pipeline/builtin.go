@@ -0,0 +1,503 @@
+package pipeline
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/joaovrmoraes/bataudit/internal/audit"
+)
+
+// Built-in processor kinds.
+const (
+	KindEnricher        = "enricher"
+	KindFieldMapper     = "field_mapper"
+	KindDropFilter      = "drop_filter"
+	KindRouteNormalizer = "route_normalizer"
+	KindHTTPLookup      = "http_lookup"
+)
+
+func init() {
+	Register(KindEnricher, newEnricher)
+	Register(KindFieldMapper, newFieldMapper)
+	Register(KindDropFilter, newDropFilter)
+	Register(KindRouteNormalizer, newRouteNormalizer)
+	Register(KindHTTPLookup, newHTTPLookup)
+}
+
+func decodeConfig(raw json.RawMessage, v any) error {
+	dec := json.NewDecoder(strings.NewReader(string(raw)))
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(v); err != nil {
+		return fmt.Errorf("invalid config: %w", err)
+	}
+	return nil
+}
+
+// ── enricher ──────────────────────────────────────────────────────────────────
+
+// enricherConfig sets static values, e.g. {"fields": {"tenant_id": "acme"}}.
+// Existing values are kept unless overwrite is true.
+type enricherConfig struct {
+	Fields    map[string]string `json:"fields"`
+	Overwrite bool              `json:"overwrite"`
+}
+
+type enricher struct{ cfg enricherConfig }
+
+func newEnricher(raw json.RawMessage) (Processor, error) {
+	var cfg enricherConfig
+	if err := decodeConfig(raw, &cfg); err != nil {
+		return nil, err
+	}
+	if len(cfg.Fields) == 0 {
+		return nil, errors.New("fields is required")
+	}
+	for name := range cfg.Fields {
+		if err := validateTarget(name); err != nil {
+			return nil, err
+		}
+	}
+	return &enricher{cfg: cfg}, nil
+}
+
+func (p *enricher) Process(_ context.Context, ev *audit.Audit) (Action, error) {
+	for name, value := range p.cfg.Fields {
+		if _, present := getField(ev, name); present && !p.cfg.Overwrite {
+			continue
+		}
+		setField(ev, name, value)
+	}
+	return Continue, nil
+}
+
+// ── field_mapper ──────────────────────────────────────────────────────────────
+
+// fieldMapperConfig copies values between fields (including dotted paths into
+// bodies, e.g. request_body.customer.email → user_email) and removes fields.
+type fieldMapperConfig struct {
+	Mappings []struct {
+		From      string `json:"from"`
+		To        string `json:"to"`
+		Overwrite bool   `json:"overwrite"`
+	} `json:"mappings"`
+	Remove []string `json:"remove"`
+}
+
+type fieldMapper struct{ cfg fieldMapperConfig }
+
+func newFieldMapper(raw json.RawMessage) (Processor, error) {
+	var cfg fieldMapperConfig
+	if err := decodeConfig(raw, &cfg); err != nil {
+		return nil, err
+	}
+	if len(cfg.Mappings) == 0 && len(cfg.Remove) == 0 {
+		return nil, errors.New("mappings or remove is required")
+	}
+	for _, m := range cfg.Mappings {
+		if err := validateSource(m.From); err != nil {
+			return nil, err
+		}
+		if err := validateTarget(m.To); err != nil {
+			return nil, err
+		}
+	}
+	for _, ref := range cfg.Remove {
+		if err := validateSource(ref); err != nil {
+			return nil, err
+		}
+	}
+	return &fieldMapper{cfg: cfg}, nil
+}
+
+func (p *fieldMapper) Process(_ context.Context, ev *audit.Audit) (Action, error) {
+	for _, m := range p.cfg.Mappings {
+		value, ok := getField(ev, m.From)
+		if !ok {
+			continue
+		}
+		if _, present := getField(ev, m.To); present && !m.Overwrite {
+			continue
+		}
+		setField(ev, m.To, value)
+	}
+	for _, ref := range p.cfg.Remove {
+		removeField(ev, ref)
+	}
+	return Continue, nil
+}
+
+// ── drop_filter ───────────────────────────────────────────────────────────────
+
+// dropFilterConfig drops events matching every condition that is set, e.g.
+// {"methods": ["GET"], "path_prefixes": ["/health"]}.
+type dropFilterConfig struct {
+	Methods      []string `json:"methods"`
+	PathPrefixes []string `json:"path_prefixes"`
+	PathPattern  string   `json:"path_pattern"`
+	StatusCodes  []int    `json:"status_codes"`
+	EventTypes   []string `json:"event_types"`
+	UserAgents   []string `json:"user_agents"` // substring match
+}
+
+type dropFilter struct {
+	cfg     dropFilterConfig
+	pattern *regexp.Regexp
+}
+
+func newDropFilter(raw json.RawMessage) (Processor, error) {
+	var cfg dropFilterConfig
+	if err := decodeConfig(raw, &cfg); err != nil {
+		return nil, err
+	}
+	p := &dropFilter{cfg: cfg}
+	if cfg.PathPattern != "" {
+		re, err := regexp.Compile(cfg.PathPattern)
+		if err != nil {
+			return nil, fmt.Errorf("invalid path_pattern: %w", err)
+		}
+		p.pattern = re
+	}
+	if len(cfg.Methods)+len(cfg.PathPrefixes)+len(cfg.StatusCodes)+len(cfg.EventTypes)+len(cfg.UserAgents) == 0 && p.pattern == nil {
+		return nil, errors.New("at least one condition is required")
+	}
+	return p, nil
+}
+
+func (p *dropFilter) Process(_ context.Context, ev *audit.Audit) (Action, error) {
+	if len(p.cfg.Methods) > 0 && !containsFold(p.cfg.Methods, string(ev.Method)) {
+		return Continue, nil
+	}
+	if len(p.cfg.PathPrefixes) > 0 && !hasAnyPrefix(ev.Path, p.cfg.PathPrefixes) {
+		return Continue, nil
+	}
+	if p.pattern != nil && !p.pattern.MatchString(ev.Path) {
+		return Continue, nil
+	}
+	if len(p.cfg.StatusCodes) > 0 && !containsInt(p.cfg.StatusCodes, ev.StatusCode) {
+		return Continue, nil
+	}
+	if len(p.cfg.EventTypes) > 0 && !containsFold(p.cfg.EventTypes, ev.EventType) {
+		return Continue, nil
+	}
+	if len(p.cfg.UserAgents) > 0 && !containsSubstring(ev.UserAgent, p.cfg.UserAgents) {
+		return Continue, nil
+	}
+	return Drop, nil
+}
+
+// ── route_normalizer ──────────────────────────────────────────────────────────
+
+// routeNormalizerConfig rewrites concrete paths into route templates so that
+// /users/42 and /users/43 aggregate together. Rules run first, in order; with
+// auto enabled, remaining numeric, UUID and long hex segments become ":id".
+type routeNormalizerConfig struct {
+	Rules []struct {
+		Pattern string `json:"pattern"`
+		Replace string `json:"replace"`
+	} `json:"rules"`
+	Auto bool `json:"auto"`
+}
+
+type routeRule struct {
+	re      *regexp.Regexp
+	replace string
+}
+
+type routeNormalizer struct {
+	rules []routeRule
+	auto  bool
+}
+
+var (
+	numericSegment = regexp.MustCompile(`^\d+$`)
+	uuidSegment    = regexp.MustCompile(`^(?i)[0-9a-f]{8}-[0-9a-f]{4}-[0-9a-f]{4}-[0-9a-f]{4}-[0-9a-f]{12}$`)
+	hexSegment     = regexp.MustCompile(`^(?i)[0-9a-f]{16,}$`)
+)
+
+func newRouteNormalizer(raw json.RawMessage) (Processor, error) {
+	var cfg routeNormalizerConfig
+	if err := decodeConfig(raw, &cfg); err != nil {
+		return nil, err
+	}
+	p := &routeNormalizer{auto: cfg.Auto}
+	for _, r := range cfg.Rules {
+		re, err := regexp.Compile(r.Pattern)
+		if err != nil {
+			return nil, fmt.Errorf("invalid pattern %q: %w", r.Pattern, err)
+		}
+		p.rules = append(p.rules, routeRule{re: re, replace: r.Replace})
+	}
+	if len(p.rules) == 0 && !p.auto {
+		return nil, errors.New("rules or auto is required")
+	}
+	return p, nil
+}
+
+func (p *routeNormalizer) Process(_ context.Context, ev *audit.Audit) (Action, error) {
+	path := ev.Path
+	for _, r := range p.rules {
+		if r.re.MatchString(path) {
+			path = r.re.ReplaceAllString(path, r.replace)
+		}
+	}
+	if p.auto {
+		path = NormalizePath(path)
+	}
+	ev.Path = path
+	return Continue, nil
+}
+
+// NormalizePath replaces numeric, UUID and long hex path segments with ":id".
+// The query string, if any, is dropped.
+func NormalizePath(path string) string {
+	path, _, _ = strings.Cut(path, "?")
+	segments := strings.Split(path, "/")
+	for i, s := range segments {
+		if numericSegment.MatchString(s) || uuidSegment.MatchString(s) || hexSegment.MatchString(s) {
+			segments[i] = ":id"
+		}
+	}
+	return strings.Join(segments, "/")
+}
+
+// ── http_lookup ───────────────────────────────────────────────────────────────
+
+// httpLookupConfig calls an external service and copies values from its JSON
+// response into the event, e.g.
+//
+//	{"url": "https://crm.example.com/users/{identifier}",
+//	 "fields": {"user_email": "email", "tenant_id": "org.id"}}
+//
+// {field} placeholders are replaced with URL-escaped event values; events
+// lacking a referenced value pass through unchanged. Responses are cached per
+// URL for cache_ttl_seconds (default 300, 0 keeps the default).
+//
+// Lookups only reach public addresses: loopback, private and link-local
+// targets are refused when the processor is built and again when connecting,
+// which also covers redirects and names resolving to such addresses.
+type httpLookupConfig struct {
+	URL             string            `json:"url"`
+	Headers         map[string]string `json:"headers"`
+	Fields          map[string]string `json:"fields"`
+	Overwrite       bool              `json:"overwrite"`
+	CacheTTLSeconds int               `json:"cache_ttl_seconds"`
+}
+
+var placeholder = regexp.MustCompile(`\{([a-z_.]+)\}`)
+
+type lookupEntry struct {
+	doc       any
+	expiresAt time.Time
+}
+
+type httpLookup struct {
+	cfg    httpLookupConfig
+	client *http.Client
+	ttl    time.Duration
+
+	mu    sync.Mutex
+	cache map[string]lookupEntry
+}
+
+const (
+	maxLookupCache     = 10_000
+	maxLookupRedirects = 5
+)
+
+var errLookupTarget = errors.New("lookup target is not a public address")
+
+// lookupTargetAllowed reports whether http_lookup may connect to ip. Tests
+// replace it to reach local servers.
+var lookupTargetAllowed = func(ip net.IP) bool {
+	return !ip.IsLoopback() && !ip.IsPrivate() && !ip.IsUnspecified() &&
+		!ip.IsLinkLocalUnicast() && !ip.IsLinkLocalMulticast() && !ip.IsInterfaceLocalMulticast()
+}
+
+// lookupClient connects to allowed addresses only, checked on the resolved
+// address of every connection, and follows a few http(s) redirects.
+func lookupClient() *http.Client {
+	dialer := &net.Dialer{
+		Timeout: 5 * time.Second,
+		Control: func(_, address string, _ syscall.RawConn) error {
+			host, _, err := net.SplitHostPort(address)
+			if err != nil {
+				return err
+			}
+			if ip := net.ParseIP(host); ip == nil || !lookupTargetAllowed(ip) {
+				return errLookupTarget
+			}
+			return nil
+		},
+	}
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.Proxy = nil // the proxy would be the address checked
+	transport.DialContext = dialer.DialContext
+	return &http.Client{
+		Transport: transport,
+		CheckRedirect: func(req *http.Request, via []*http.Request) error {
+			if len(via) >= maxLookupRedirects {
+				return errors.New("too many redirects")
+			}
+			if req.URL.Scheme != "http" && req.URL.Scheme != "https" {
+				return errors.New("redirect to a non-http(s) URL")
+			}
+			return nil
+		},
+	}
+}
+
+func newHTTPLookup(raw json.RawMessage) (Processor, error) {
+	var cfg httpLookupConfig
+	if err := decodeConfig(raw, &cfg); err != nil {
+		return nil, err
+	}
+	u, err := url.Parse(placeholder.ReplaceAllString(cfg.URL, "x"))
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return nil, errors.New("url must be an absolute http(s) URL")
+	}
+	if ip := net.ParseIP(u.Hostname()); (ip != nil && !lookupTargetAllowed(ip)) || strings.EqualFold(u.Hostname(), "localhost") {
+		return nil, errLookupTarget
+	}
+	for _, m := range placeholder.FindAllStringSubmatch(cfg.URL, -1) {
+		if err := validateSource(m[1]); err != nil {
+			return nil, err
+		}
+	}
+	if len(cfg.Fields) == 0 {
+		return nil, errors.New("fields is required")
+	}
+	for name := range cfg.Fields {
+		if err := validateTarget(name); err != nil {
+			return nil, err
+		}
+	}
+	ttl := 5 * time.Minute
+	if cfg.CacheTTLSeconds > 0 {
+		ttl = time.Duration(cfg.CacheTTLSeconds) * time.Second
+	}
+	return &httpLookup{
+		cfg:    cfg,
+		client: lookupClient(),
+		ttl:    ttl,
+		cache:  make(map[string]lookupEntry),
+	}, nil
+}
+
+func (p *httpLookup) Process(ctx context.Context, ev *audit.Audit) (Action, error) {
+	missing := false
+	target := placeholder.ReplaceAllStringFunc(p.cfg.URL, func(m string) string {
+		v, ok := getField(ev, m[1:len(m)-1])
+		if !ok {
+			missing = true
+		}
+		return url.PathEscape(v)
+	})
+	if missing {
+		return Continue, nil
+	}
+
+	doc, err := p.fetch(ctx, target)
+	if err != nil {
+		return Continue, err
+	}
+	for name, path := range p.cfg.Fields {
+		if _, present := getField(ev, name); present && !p.cfg.Overwrite {
+			continue
+		}
+		if v, ok := lookupPath(doc, path); ok {
+			setField(ev, name, v)
+		}
+	}
+	return Continue, nil
+}
+
+func (p *httpLookup) fetch(ctx context.Context, target string) (any, error) {
+	p.mu.Lock()
+	if e, ok := p.cache[target]; ok && time.Now().Before(e.expiresAt) {
+		p.mu.Unlock()
+		return e.doc, nil
+	}
+	p.mu.Unlock()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, target, nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Accept", "application/json")
+	for k, v := range p.cfg.Headers {
+		req.Header.Set(k, v)
+	}
+	resp, err := p.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode == http.StatusNotFound {
+		return nil, nil // unknown subject: nothing to enrich
+	}
+	if resp.StatusCode >= 300 {
+		return nil, fmt.Errorf("lookup returned HTTP %d", resp.StatusCode)
+	}
+	var doc any
+	if err := json.NewDecoder(io.LimitReader(resp.Body, 1<<20)).Decode(&doc); err != nil {
+		return nil, fmt.Errorf("invalid lookup response: %w", err)
+	}
+
+	p.mu.Lock()
+	if len(p.cache) >= maxLookupCache {
+		p.cache = make(map[string]lookupEntry)
+	}
+	p.cache[target] = lookupEntry{doc: doc, expiresAt: time.Now().Add(p.ttl)}
+	p.mu.Unlock()
+	return doc, nil
+}
+
+// ── helpers ───────────────────────────────────────────────────────────────────
+
+func containsFold(list []string, v string) bool {
+	for _, s := range list {
+		if strings.EqualFold(s, v) {
+			return true
+		}
+	}
+	return false
+}
+
+func containsInt(list []int, v int) bool {
+	for _, n := range list {
+		if n == v {
+			return true
+		}
+	}
+	return false
+}
+
+func hasAnyPrefix(s string, prefixes []string) bool {
+	for _, p := range prefixes {
+		if strings.HasPrefix(s, p) {
+			return true
+		}
+	}
+	return false
+}
+
+func containsSubstring(s string, subs []string) bool {
+	for _, sub := range subs {
+		if strings.Contains(s, sub) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,188 @@
+package pipeline
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/joaovrmoraes/bataudit/internal/audit"
+	"gorm.io/datatypes"
+)
+
+// Step is a built processor with its execution settings.
+type Step struct {
+	Name      string
+	Kind      string
+	Processor Processor
+	Timeout   time.Duration
+	OnFailure FailurePolicy
+}
+
+// Chain runs its steps in order against one event at a time.
+type Chain struct {
+	Steps []Step
+}
+
+// StepTrace records how a single step handled an event.
+type StepTrace struct {
+	Name       string `json:"name"`
+	Kind       string `json:"kind"`
+	Outcome    string `json:"outcome"` // ok | dropped | skipped | failed | dead_letter
+	DurationMs int64  `json:"duration_ms"`
+	Error      string `json:"error,omitempty"`
+}
+
+// Result is the outcome of running a chain on one event.
+type Result struct {
+	Event      audit.Audit `json:"event"`
+	Dropped    bool        `json:"dropped"`
+	DeadLetter bool        `json:"dead_letter"`
+	FailedStep string      `json:"failed_step,omitempty"` // step that dropped, failed or dead-lettered the event
+	Err        error       `json:"-"`
+	Trace      []StepTrace `json:"trace"`
+}
+
+// Persist reports whether the event should be written to the database.
+func (r Result) Persist() bool {
+	return !r.Dropped && !r.DeadLetter && r.Err == nil
+}
+
+// ErrTimeout is returned for a step that did not finish within its timeout.
+var ErrTimeout = errors.New("processor timed out")
+
+// BuildChain turns stored configs into a runnable chain. Inactive configs are
+// ignored; a config that fails to build is reported in the joined error and
+// left out, so one broken step doesn't disable the whole pipeline.
+func BuildChain(configs []ProcessorConfig) (*Chain, error) {
+	chain := &Chain{}
+	var errs []error
+	for _, cfg := range configs {
+		if !cfg.Active {
+			continue
+		}
+		p, err := New(cfg.Kind, cfg.Config)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("%s (%s): %w", cfg.Name, cfg.Kind, err))
+			continue
+		}
+		policy := cfg.OnFailure
+		if !policy.IsValid() {
+			policy = OnFailureSkip
+		}
+		chain.Steps = append(chain.Steps, Step{
+			Name:      cfg.Name,
+			Kind:      cfg.Kind,
+			Processor: p,
+			Timeout:   cfg.Timeout(),
+			OnFailure: policy,
+		})
+	}
+	return chain, errors.Join(errs...)
+}
+
+// Run passes the event through every step. Each step works on a copy, so a
+// failed or timed-out processor never leaves a half-modified event behind.
+func (c *Chain) Run(ctx context.Context, ev audit.Audit) Result {
+	res := Result{Event: ev, Trace: make([]StepTrace, 0, len(c.Steps))}
+
+	for _, step := range c.Steps {
+		start := time.Now()
+		next, action, err := runStep(ctx, step, res.Event)
+		trace := StepTrace{Name: step.Name, Kind: step.Kind, DurationMs: time.Since(start).Milliseconds()}
+
+		if err != nil {
+			trace.Error = err.Error()
+			switch step.OnFailure {
+			case OnFailureFail:
+				trace.Outcome = "failed"
+				res.Err = fmt.Errorf("processor %q: %w", step.Name, err)
+			case OnFailureDeadLetter:
+				trace.Outcome = "dead_letter"
+				res.DeadLetter = true
+				res.Err = fmt.Errorf("processor %q: %w", step.Name, err)
+			default:
+				trace.Outcome = "skipped"
+				res.Trace = append(res.Trace, trace)
+				continue
+			}
+			res.FailedStep = step.Name
+			res.Trace = append(res.Trace, trace)
+			return res
+		}
+
+		res.Event = next
+		if action == Drop {
+			trace.Outcome = "dropped"
+			res.Dropped = true
+			res.FailedStep = step.Name
+			res.Trace = append(res.Trace, trace)
+			return res
+		}
+		trace.Outcome = "ok"
+		res.Trace = append(res.Trace, trace)
+	}
+	return res
+}
+
+// runStep executes one processor on a copy of ev under the step timeout. A
+// processor that ignores ctx is abandoned when the timeout fires; it keeps
+// running on its own copy, which is then discarded.
+func runStep(ctx context.Context, step Step, ev audit.Audit) (audit.Audit, Action, error) {
+	timeout := step.Timeout
+	if timeout <= 0 {
+		timeout = defaultTimeout
+	}
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	type outcome struct {
+		ev     audit.Audit
+		action Action
+		err    error
+	}
+	done := make(chan outcome, 1)
+	work := cloneEvent(ev)
+
+	go func() {
+		defer func() {
+			if r := recover(); r != nil {
+				done <- outcome{err: fmt.Errorf("processor panicked: %v", r)}
+			}
+		}()
+		action, err := step.Processor.Process(ctx, &work)
+		done <- outcome{ev: work, action: action, err: err}
+	}()
+
+	select {
+	case out := <-done:
+		if out.err != nil {
+			return ev, Continue, out.err
+		}
+		return out.ev, out.action, nil
+	case <-ctx.Done():
+		if errors.Is(ctx.Err(), context.DeadlineExceeded) {
+			return ev, Continue, ErrTimeout
+		}
+		return ev, Continue, ctx.Err()
+	}
+}
+
+// cloneEvent copies the event including its JSON payloads, which are byte
+// slices that would otherwise be shared.
+func cloneEvent(ev audit.Audit) audit.Audit {
+	out := ev
+	out.UserRoles = cloneJSON(ev.UserRoles)
+	out.QueryParams = cloneJSON(ev.QueryParams)
+	out.PathParams = cloneJSON(ev.PathParams)
+	out.RequestBody = cloneJSON(ev.RequestBody)
+	out.ResponseBody = cloneJSON(ev.ResponseBody)
+	return out
+}
+
+func cloneJSON(j datatypes.JSON) datatypes.JSON {
+	if j == nil {
+		return nil
+	}
+	return append(datatypes.JSON(nil), j...)
+}
@@ -0,0 +1,253 @@
+package pipeline
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/joaovrmoraes/bataudit/internal/audit"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gorm.io/datatypes"
+)
+
+func sampleEvent() audit.Audit {
+	return audit.Audit{
+		ID:          "evt-1",
+		Method:      audit.GET,
+		Path:        "/users/42/orders/7f3e1c2a-9b4d-4e6f-8a1b-2c3d4e5f6a7b",
+		StatusCode:  200,
+		Identifier:  "user-1",
+		ServiceName: "api",
+		ProjectID:   "proj-1",
+		RequestBody: datatypes.JSON(`{"customer":{"email":"a@example.com","id":9}}`),
+	}
+}
+
+func step(name string, p Processor, policy FailurePolicy) Step {
+	return Step{Name: name, Kind: "test", Processor: p, Timeout: 50 * time.Millisecond, OnFailure: policy}
+}
+
+func failing(ev *audit.Audit) (Action, error) {
+	ev.UserEmail = "should-not-leak"
+	return Continue, errors.New("boom")
+}
+
+func TestChain_failurePolicies(t *testing.T) {
+	setTenant := ProcessorFunc(func(_ context.Context, ev *audit.Audit) (Action, error) {
+		ev.TenantID = "acme"
+		return Continue, nil
+	})
+	fail := ProcessorFunc(func(_ context.Context, ev *audit.Audit) (Action, error) { return failing(ev) })
+
+	t.Run("skip keeps the event as it was before the step", func(t *testing.T) {
+		chain := &Chain{Steps: []Step{step("fail", fail, OnFailureSkip), step("tenant", setTenant, OnFailureSkip)}}
+		res := chain.Run(context.Background(), sampleEvent())
+
+		assert.True(t, res.Persist())
+		assert.Empty(t, res.Event.UserEmail)
+		assert.Equal(t, "acme", res.Event.TenantID)
+		require.Len(t, res.Trace, 2)
+		assert.Equal(t, "skipped", res.Trace[0].Outcome)
+		assert.Equal(t, "boom", res.Trace[0].Error)
+		assert.Equal(t, "ok", res.Trace[1].Outcome)
+	})
+
+	t.Run("fail stops the chain and rejects the event", func(t *testing.T) {
+		chain := &Chain{Steps: []Step{step("fail", fail, OnFailureFail), step("tenant", setTenant, OnFailureSkip)}}
+		res := chain.Run(context.Background(), sampleEvent())
+
+		assert.False(t, res.Persist())
+		assert.False(t, res.DeadLetter)
+		assert.Error(t, res.Err)
+		assert.Equal(t, "fail", res.FailedStep)
+		assert.Len(t, res.Trace, 1)
+	})
+
+	t.Run("dead_letter marks the event for the DLQ", func(t *testing.T) {
+		chain := &Chain{Steps: []Step{step("fail", fail, OnFailureDeadLetter)}}
+		res := chain.Run(context.Background(), sampleEvent())
+
+		assert.False(t, res.Persist())
+		assert.True(t, res.DeadLetter)
+		assert.Equal(t, "dead_letter", res.Trace[0].Outcome)
+	})
+}
+
+func TestChain_timeout(t *testing.T) {
+	slow := ProcessorFunc(func(ctx context.Context, ev *audit.Audit) (Action, error) {
+		<-ctx.Done()
+		return Continue, ctx.Err()
+	})
+	stuck := ProcessorFunc(func(_ context.Context, ev *audit.Audit) (Action, error) {
+		time.Sleep(200 * time.Millisecond) // ignores ctx
+		ev.TenantID = "late"
+		return Continue, nil
+	})
+
+	for name, p := range map[string]Processor{"honours ctx": slow, "ignores ctx": stuck} {
+		t.Run(name, func(t *testing.T) {
+			chain := &Chain{Steps: []Step{step("slow", p, OnFailureFail)}}
+			res := chain.Run(context.Background(), sampleEvent())
+
+			assert.ErrorIs(t, res.Err, ErrTimeout)
+			assert.Empty(t, res.Event.TenantID)
+		})
+	}
+}
+
+func TestChain_panicIsAFailure(t *testing.T) {
+	boom := ProcessorFunc(func(context.Context, *audit.Audit) (Action, error) { panic("nil map") })
+	chain := &Chain{Steps: []Step{step("boom", boom, OnFailureSkip)}}
+
+	res := chain.Run(context.Background(), sampleEvent())
+
+	assert.True(t, res.Persist())
+	assert.Contains(t, res.Trace[0].Error, "panicked")
+}
+
+func TestBuildChain(t *testing.T) {
+	configs := []ProcessorConfig{
+		{Name: "norm", Kind: KindRouteNormalizer, Config: json.RawMessage(`{"auto":true}`), Active: true},
+		{Name: "off", Kind: KindEnricher, Config: json.RawMessage(`{"fields":{"tenant_id":"x"}}`), Active: false},
+		{Name: "bad", Kind: "nope", Active: true},
+	}
+
+	chain, err := BuildChain(configs)
+
+	assert.ErrorContains(t, err, "bad")
+	require.Len(t, chain.Steps, 1)
+	assert.Equal(t, "norm", chain.Steps[0].Name)
+	assert.Equal(t, OnFailureSkip, chain.Steps[0].OnFailure)
+	assert.Equal(t, time.Second, chain.Steps[0].Timeout)
+}
+
+func TestRegister_duplicatePanics(t *testing.T) {
+	assert.Panics(t, func() {
+		Register(KindEnricher, newEnricher)
+	})
+}
+
+func build(t *testing.T, kind, cfg string) Processor {
+	t.Helper()
+	p, err := New(kind, json.RawMessage(cfg))
+	require.NoError(t, err)
+	return p
+}
+
+func TestBuiltins(t *testing.T) {
+	ctx := context.Background()
+
+	t.Run("enricher keeps existing values unless overwrite", func(t *testing.T) {
+		ev := sampleEvent()
+		ev.Environment = "staging"
+		_, err := build(t, KindEnricher, `{"fields":{"environment":"prod","tenant_id":"acme"}}`).Process(ctx, &ev)
+		require.NoError(t, err)
+		assert.Equal(t, "staging", ev.Environment)
+		assert.Equal(t, "acme", ev.TenantID)
+	})
+
+	t.Run("field_mapper copies from bodies and removes keys", func(t *testing.T) {
+		ev := sampleEvent()
+		p := build(t, KindFieldMapper, `{"mappings":[{"from":"request_body.customer.email","to":"user_email"}],"remove":["request_body.customer.email"]}`)
+		_, err := p.Process(ctx, &ev)
+		require.NoError(t, err)
+		assert.Equal(t, "a@example.com", ev.UserEmail)
+		assert.JSONEq(t, `{"customer":{"id":9}}`, string(ev.RequestBody))
+	})
+
+	t.Run("drop_filter requires every condition", func(t *testing.T) {
+		p := build(t, KindDropFilter, `{"methods":["get"],"path_prefixes":["/health"]}`)
+
+		ev := sampleEvent()
+		action, _ := p.Process(ctx, &ev)
+		assert.Equal(t, Continue, action)
+
+		ev.Path = "/health/live"
+		action, _ = p.Process(ctx, &ev)
+		assert.Equal(t, Drop, action)
+	})
+
+	t.Run("route_normalizer", func(t *testing.T) {
+		ev := sampleEvent()
+		_, err := build(t, KindRouteNormalizer, `{"auto":true}`).Process(ctx, &ev)
+		require.NoError(t, err)
+		assert.Equal(t, "/users/:id/orders/:id", ev.Path)
+	})
+
+	t.Run("unknown config keys are rejected", func(t *testing.T) {
+		_, err := New(KindEnricher, json.RawMessage(`{"feilds":{}}`))
+		assert.Error(t, err)
+	})
+}
+
+// allowLoopbackLookups lets http_lookup reach httptest servers for the test.
+func allowLoopbackLookups(t *testing.T) {
+	allowed := lookupTargetAllowed
+	lookupTargetAllowed = func(ip net.IP) bool { return ip.IsLoopback() }
+	t.Cleanup(func() { lookupTargetAllowed = allowed })
+}
+
+func TestHTTPLookup(t *testing.T) {
+	allowLoopbackLookups(t)
+	var calls atomic.Int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls.Add(1)
+		if r.URL.Path != "/users/user-1" {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		_, _ = w.Write([]byte(`{"email":"u1@example.com","org":{"id":"acme"}}`))
+	}))
+	defer srv.Close()
+
+	p := build(t, KindHTTPLookup, `{"url":"`+srv.URL+`/users/{identifier}","fields":{"user_email":"email","tenant_id":"org.id"}}`)
+
+	for i := 0; i < 2; i++ {
+		ev := sampleEvent()
+		_, err := p.Process(context.Background(), &ev)
+		require.NoError(t, err)
+		assert.Equal(t, "u1@example.com", ev.UserEmail)
+		assert.Equal(t, "acme", ev.TenantID)
+	}
+	assert.Equal(t, int32(1), calls.Load(), "second lookup should be served from cache")
+
+	ev := sampleEvent()
+	ev.Identifier = "unknown"
+	_, err := p.Process(context.Background(), &ev)
+	require.NoError(t, err)
+	assert.Empty(t, ev.TenantID)
+}
+
+func TestHTTPLookup_privateTargets(t *testing.T) {
+	for _, target := range []string{
+		"http://127.0.0.1/users/{identifier}",
+		"http://localhost:8080/users/{identifier}",
+		"http://10.0.0.5/users/{identifier}",
+		"http://[::1]/users/{identifier}",
+		"http://169.254.169.254/latest/meta-data/{identifier}",
+	} {
+		_, err := New(KindHTTPLookup, json.RawMessage(`{"url":"`+target+`","fields":{"tenant_id":"org.id"}}`))
+		assert.ErrorIs(t, err, errLookupTarget, target)
+	}
+
+	// A public name resolving to a private address, or redirecting to one,
+	// is refused when connecting.
+	allowLoopbackLookups(t)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Redirect(w, r, "http://169.254.169.254/latest/meta-data/", http.StatusFound)
+	}))
+	defer srv.Close()
+
+	p := build(t, KindHTTPLookup, `{"url":"`+srv.URL+`/users/{identifier}","fields":{"tenant_id":"org.id"}}`)
+	ev := sampleEvent()
+	_, err := p.Process(context.Background(), &ev)
+	assert.ErrorIs(t, err, errLookupTarget)
+	assert.Empty(t, ev.TenantID)
+}
@@ -0,0 +1,153 @@
+package pipeline
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"github.com/joaovrmoraes/bataudit/internal/audit"
+	"gorm.io/datatypes"
+)
+
+// stringFields maps the JSON name of every plain string field on audit.Audit
+// to an accessor, so processors can be configured by field name.
+var stringFields = map[string]func(ev *audit.Audit) *string{
+	"event_type":    func(ev *audit.Audit) *string { return &ev.EventType },
+	"path":          func(ev *audit.Audit) *string { return &ev.Path },
+	"identifier":    func(ev *audit.Audit) *string { return &ev.Identifier },
+	"user_email":    func(ev *audit.Audit) *string { return &ev.UserEmail },
+	"user_name":     func(ev *audit.Audit) *string { return &ev.UserName },
+	"user_type":     func(ev *audit.Audit) *string { return &ev.UserType },
+	"tenant_id":     func(ev *audit.Audit) *string { return &ev.TenantID },
+	"ip":            func(ev *audit.Audit) *string { return &ev.IP },
+	"user_agent":    func(ev *audit.Audit) *string { return &ev.UserAgent },
+	"request_id":    func(ev *audit.Audit) *string { return &ev.RequestID },
+	"error_message": func(ev *audit.Audit) *string { return &ev.ErrorMessage },
+	"source":        func(ev *audit.Audit) *string { return &ev.Source },
+	"service_name":  func(ev *audit.Audit) *string { return &ev.ServiceName },
+	"environment":   func(ev *audit.Audit) *string { return &ev.Environment },
+	"session_id":    func(ev *audit.Audit) *string { return &ev.SessionID },
+}
+
+// jsonFields maps the JSON payload fields that dotted paths may reach into.
+var jsonFields = map[string]func(ev *audit.Audit) *datatypes.JSON{
+	"request_body":  func(ev *audit.Audit) *datatypes.JSON { return &ev.RequestBody },
+	"response_body": func(ev *audit.Audit) *datatypes.JSON { return &ev.ResponseBody },
+	"query_params":  func(ev *audit.Audit) *datatypes.JSON { return &ev.QueryParams },
+	"path_params":   func(ev *audit.Audit) *datatypes.JSON { return &ev.PathParams },
+}
+
+// validateTarget checks that name is a writable string field.
+func validateTarget(name string) error {
+	if _, ok := stringFields[name]; !ok {
+		return fmt.Errorf("unknown field %q", name)
+	}
+	return nil
+}
+
+// validateSource checks that a field reference is either a string field or a
+// dotted path into a JSON payload (e.g. request_body.customer.id).
+func validateSource(ref string) error {
+	if _, ok := stringFields[ref]; ok {
+		return nil
+	}
+	root, rest, ok := strings.Cut(ref, ".")
+	if _, known := jsonFields[root]; known && ok && rest != "" {
+		return nil
+	}
+	return fmt.Errorf("unknown field %q", ref)
+}
+
+// getField resolves a field reference to its string value. Non-string JSON
+// values are rendered as JSON. The bool is false when the value is absent.
+func getField(ev *audit.Audit, ref string) (string, bool) {
+	if acc, ok := stringFields[ref]; ok {
+		v := *acc(ev)
+		return v, v != ""
+	}
+	root, rest, _ := strings.Cut(ref, ".")
+	acc, ok := jsonFields[root]
+	if !ok {
+		return "", false
+	}
+	var doc any
+	if err := json.Unmarshal(*acc(ev), &doc); err != nil {
+		return "", false
+	}
+	return lookupPath(doc, rest)
+}
+
+// setField writes a string field.
+func setField(ev *audit.Audit, name, value string) {
+	if acc, ok := stringFields[name]; ok {
+		*acc(ev) = value
+	}
+}
+
+// removeField clears a string field or deletes a key inside a JSON payload.
+func removeField(ev *audit.Audit, ref string) {
+	if acc, ok := stringFields[ref]; ok {
+		*acc(ev) = ""
+		return
+	}
+	root, rest, _ := strings.Cut(ref, ".")
+	acc, ok := jsonFields[root]
+	if !ok || len(*acc(ev)) == 0 {
+		return
+	}
+	var doc any
+	if err := json.Unmarshal(*acc(ev), &doc); err != nil {
+		return
+	}
+	if !deletePath(doc, strings.Split(rest, ".")) {
+		return
+	}
+	if out, err := json.Marshal(doc); err == nil {
+		*acc(ev) = datatypes.JSON(out)
+	}
+}
+
+// lookupPath walks a decoded JSON document along a dotted path.
+func lookupPath(doc any, path string) (string, bool) {
+	cur := doc
+	for _, part := range strings.Split(path, ".") {
+		obj, ok := cur.(map[string]any)
+		if !ok {
+			return "", false
+		}
+		if cur, ok = obj[part]; !ok {
+			return "", false
+		}
+	}
+	switch v := cur.(type) {
+	case nil:
+		return "", false
+	case string:
+		return v, true
+	default:
+		out, err := json.Marshal(v)
+		if err != nil {
+			return "", false
+		}
+		return string(out), true
+	}
+}
+
+func deletePath(doc any, parts []string) bool {
+	obj, ok := doc.(map[string]any)
+	if !ok {
+		return false
+	}
+	if len(parts) == 1 {
+		if _, exists := obj[parts[0]]; !exists {
+			return false
+		}
+		delete(obj, parts[0])
+		return true
+	}
+	child, ok := obj[parts[0]]
+	if !ok {
+		return false
+	}
+	return deletePath(child, parts[1:])
+}
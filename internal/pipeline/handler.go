@@ -0,0 +1,294 @@
+package pipeline
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/joaovrmoraes/bataudit/internal/audit"
+	"github.com/joaovrmoraes/bataudit/internal/auth"
+	"gorm.io/gorm"
+)
+
+// maxTestSamples bounds how many events one POST /pipeline/test may run.
+const maxTestSamples = 100
+
+// Handler exposes the pipeline configuration API.
+type Handler struct {
+	repo Repository
+}
+
+func NewHandler(repo Repository) *Handler {
+	return &Handler{repo: repo}
+}
+
+// RegisterRoutes mounts the pipeline endpoints under the provided router group.
+// Expected: the group is already JWT-protected.
+func (h *Handler) RegisterRoutes(rg *gin.RouterGroup) {
+	rg.GET("/types", h.ListTypes)
+	rg.POST("/test", h.Test)
+	rg.GET("/processors", h.ListProcessors)
+	rg.POST("/processors", h.CreateProcessor)
+	rg.PUT("/processors/:id", h.UpdateProcessor)
+	rg.DELETE("/processors/:id", h.DeleteProcessor)
+}
+
+// ListTypes godoc
+// @Summary      List registered processor kinds
+// @Tags         pipeline
+// @Produce      json
+// @Success      200  {array}  string
+// @Router       /pipeline/types [get]
+func (h *Handler) ListTypes(c *gin.Context) {
+	c.JSON(http.StatusOK, Kinds())
+}
+
+// ListProcessors godoc
+// @Summary      List the processors of a project's pipeline, in execution order
+// @Tags         pipeline
+// @Produce      json
+// @Param        project_id  query  string  true  "Project ID"
+// @Success      200  {array}  ProcessorConfig
+// @Router       /pipeline/processors [get]
+func (h *Handler) ListProcessors(c *gin.Context) {
+	projectID := c.Query("project_id")
+	if projectID == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "project_id required"})
+		return
+	}
+
+	list, err := h.repo.ListByProject(projectID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, list)
+}
+
+type processorRequest struct {
+	ProjectID string          `json:"project_id" binding:"required"`
+	Position  int             `json:"position"`
+	Name      string          `json:"name"       binding:"required"`
+	Kind      string          `json:"kind"       binding:"required"`
+	Config    json.RawMessage `json:"config"`
+	TimeoutMs int             `json:"timeout_ms"`
+	OnFailure FailurePolicy   `json:"on_failure"`
+	Active    *bool           `json:"active"`
+}
+
+// toConfig validates the request by building the processor, so a broken
+// config is rejected here instead of being skipped by every worker.
+func (r processorRequest) toConfig() (*ProcessorConfig, error) {
+	if r.OnFailure == "" {
+		r.OnFailure = OnFailureSkip
+	}
+	if !r.OnFailure.IsValid() {
+		return nil, errors.New("on_failure must be skip, fail or dead_letter")
+	}
+	if r.TimeoutMs < 0 {
+		return nil, errors.New("timeout_ms must not be negative")
+	}
+	if len(r.Config) == 0 {
+		r.Config = json.RawMessage(`{}`)
+	}
+	if _, err := New(r.Kind, r.Config); err != nil {
+		return nil, err
+	}
+	active := true
+	if r.Active != nil {
+		active = *r.Active
+	}
+	return &ProcessorConfig{
+		ProjectID: r.ProjectID,
+		Position:  r.Position,
+		Name:      r.Name,
+		Kind:      r.Kind,
+		Config:    r.Config,
+		TimeoutMs: r.TimeoutMs,
+		OnFailure: r.OnFailure,
+		Active:    active,
+	}, nil
+}
+
+// CreateProcessor godoc
+// @Summary      Add a processor to a project's pipeline
+// @Tags         pipeline
+// @Accept       json
+// @Produce      json
+// @Param        body  body  processorRequest  true  "Processor"
+// @Success      201  {object}  ProcessorConfig
+// @Router       /pipeline/processors [post]
+func (h *Handler) CreateProcessor(c *gin.Context) {
+	if !auth.RequireManager(c) {
+		return
+	}
+
+	var req processorRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	p, err := req.toConfig()
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if err := h.repo.Create(p); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusCreated, p)
+}
+
+// UpdateProcessor godoc
+// @Summary      Replace a pipeline processor
+// @Tags         pipeline
+// @Accept       json
+// @Produce      json
+// @Param        id    path  string            true  "Processor ID"
+// @Param        body  body  processorRequest  true  "Processor"
+// @Success      200  {object}  ProcessorConfig
+// @Router       /pipeline/processors/{id} [put]
+func (h *Handler) UpdateProcessor(c *gin.Context) {
+	if !auth.RequireManager(c) {
+		return
+	}
+
+	var req processorRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	existing, err := h.repo.Get(c.Param("id"), req.ProjectID)
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "processor not found"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	p, err := req.toConfig()
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	p.ID = existing.ID
+	p.CreatedAt = existing.CreatedAt
+
+	if err := h.repo.Update(p); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, p)
+}
+
+// DeleteProcessor godoc
+// @Summary      Remove a processor from a project's pipeline
+// @Tags         pipeline
+// @Param        id          path   string  true  "Processor ID"
+// @Param        project_id  query  string  true  "Project ID"
+// @Success      204
+// @Router       /pipeline/processors/{id} [delete]
+func (h *Handler) DeleteProcessor(c *gin.Context) {
+	if !auth.RequireManager(c) {
+		return
+	}
+
+	projectID := c.Query("project_id")
+	if projectID == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "project_id required"})
+		return
+	}
+	if err := h.repo.Delete(c.Param("id"), projectID); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.Status(http.StatusNoContent)
+}
+
+type testRequest struct {
+	// ProjectID runs the project's saved pipeline (active processors only).
+	ProjectID string `json:"project_id"`
+	// Processors, when given, are run instead of the saved pipeline, so a
+	// chain can be tried before it is saved.
+	Processors []processorRequest `json:"processors"`
+	Events     []audit.Audit      `json:"events" binding:"required"`
+}
+
+type testResult struct {
+	Result
+	Persisted bool   `json:"persisted"`
+	Error     string `json:"error,omitempty"`
+}
+
+// Test godoc
+// @Summary      Run a pipeline against sample events without persisting anything
+// @Description  Returns the processed event and a per-step trace for each sample.
+// @Tags         pipeline
+// @Accept       json
+// @Produce      json
+// @Param        body  body  testRequest  true  "Chain and sample events"
+// @Success      200  {object}  map[string]interface{}
+// @Router       /pipeline/test [post]
+func (h *Handler) Test(c *gin.Context) {
+	if !auth.RequireManager(c) {
+		return
+	}
+
+	var req testRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if len(req.Events) == 0 || len(req.Events) > maxTestSamples {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "events must contain between 1 and 100 samples"})
+		return
+	}
+
+	var configs []ProcessorConfig
+	switch {
+	case len(req.Processors) > 0:
+		for i, pr := range req.Processors {
+			if pr.Position == 0 {
+				pr.Position = i
+			}
+			p, err := pr.toConfig()
+			if err != nil {
+				c.JSON(http.StatusBadRequest, gin.H{"error": pr.Name + ": " + err.Error()})
+				return
+			}
+			configs = append(configs, *p)
+		}
+	case req.ProjectID != "":
+		list, err := h.repo.ListActiveByProject(req.ProjectID)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		configs = list
+	default:
+		c.JSON(http.StatusBadRequest, gin.H{"error": "project_id or processors required"})
+		return
+	}
+
+	chain, buildErr := BuildChain(configs)
+	results := RunSamples(c.Request.Context(), chain, req.Events)
+
+	out := make([]testResult, 0, len(results))
+	for _, r := range results {
+		tr := testResult{Result: r, Persisted: r.Persist()}
+		if r.Err != nil {
+			tr.Error = r.Err.Error()
+		}
+		out = append(out, tr)
+	}
+
+	resp := gin.H{"results": out}
+	if buildErr != nil {
+		resp["build_errors"] = buildErr.Error()
+	}
+	c.JSON(http.StatusOK, resp)
+}
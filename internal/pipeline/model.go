@@ -0,0 +1,51 @@
+package pipeline
+
+import (
+	"encoding/json"
+	"time"
+)
+
+// FailurePolicy decides what happens to an event when a processor errors or
+// times out.
+type FailurePolicy string
+
+const (
+	OnFailureSkip       FailurePolicy = "skip"        // ignore the processor, keep the event as it was before it ran
+	OnFailureFail       FailurePolicy = "fail"        // reject the event; it is not persisted
+	OnFailureDeadLetter FailurePolicy = "dead_letter" // move the event to the dead-letter queue
+)
+
+func (p FailurePolicy) IsValid() bool {
+	switch p {
+	case OnFailureSkip, OnFailureFail, OnFailureDeadLetter:
+		return true
+	}
+	return false
+}
+
+// ProcessorConfig is one step of a project's pipeline, stored in pipeline_processors.
+type ProcessorConfig struct {
+	ID        string          `json:"id"         gorm:"primaryKey"`
+	ProjectID string          `json:"project_id"`
+	Position  int             `json:"position"`
+	Name      string          `json:"name"`
+	Kind      string          `json:"kind"`
+	Config    json.RawMessage `json:"config"     gorm:"type:jsonb;serializer:json"`
+	TimeoutMs int             `json:"timeout_ms"`
+	OnFailure FailurePolicy   `json:"on_failure"`
+	Active    bool            `json:"active"`
+	CreatedAt time.Time       `json:"created_at"`
+	UpdatedAt time.Time       `json:"updated_at"`
+}
+
+func (ProcessorConfig) TableName() string { return "pipeline_processors" }
+
+const defaultTimeout = time.Second
+
+// Timeout returns the per-step timeout, falling back to one second.
+func (c ProcessorConfig) Timeout() time.Duration {
+	if c.TimeoutMs <= 0 {
+		return defaultTimeout
+	}
+	return time.Duration(c.TimeoutMs) * time.Millisecond
+}
@@ -0,0 +1,81 @@
+package pipeline
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"sync"
+
+	"github.com/joaovrmoraes/bataudit/internal/audit"
+)
+
+// Action tells the chain what to do with the event after a processor ran.
+type Action int
+
+const (
+	Continue Action = iota // pass the (possibly modified) event to the next step
+	Drop                   // discard the event; later steps don't run
+)
+
+// Processor transforms, enriches or filters one event. It may modify ev in
+// place; on error the chain discards those changes and applies the step's
+// failure policy. Processors must honour ctx, which carries the step timeout.
+type Processor interface {
+	Process(ctx context.Context, ev *audit.Audit) (Action, error)
+}
+
+// ProcessorFunc adapts a plain function to the Processor interface.
+type ProcessorFunc func(ctx context.Context, ev *audit.Audit) (Action, error)
+
+func (f ProcessorFunc) Process(ctx context.Context, ev *audit.Audit) (Action, error) {
+	return f(ctx, ev)
+}
+
+// Factory builds a Processor from the JSON config stored for a pipeline step.
+type Factory func(config json.RawMessage) (Processor, error)
+
+var (
+	registryMu sync.RWMutex
+	registry   = make(map[string]Factory)
+)
+
+// Register makes a processor kind available to project pipelines. It is meant
+// to be called from init functions; registering the same kind twice panics.
+func Register(kind string, factory Factory) {
+	registryMu.Lock()
+	defer registryMu.Unlock()
+	if factory == nil {
+		panic("pipeline: Register factory is nil for " + kind)
+	}
+	if _, dup := registry[kind]; dup {
+		panic("pipeline: Register called twice for " + kind)
+	}
+	registry[kind] = factory
+}
+
+// Kinds returns the registered processor kinds, sorted.
+func Kinds() []string {
+	registryMu.RLock()
+	defer registryMu.RUnlock()
+	kinds := make([]string, 0, len(registry))
+	for k := range registry {
+		kinds = append(kinds, k)
+	}
+	sort.Strings(kinds)
+	return kinds
+}
+
+// New builds a processor of the given kind.
+func New(kind string, config json.RawMessage) (Processor, error) {
+	registryMu.RLock()
+	factory, ok := registry[kind]
+	registryMu.RUnlock()
+	if !ok {
+		return nil, fmt.Errorf("unknown processor kind %q", kind)
+	}
+	if len(config) == 0 {
+		config = json.RawMessage(`{}`)
+	}
+	return factory(config)
+}
@@ -0,0 +1,80 @@
+package pipeline
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+type Repository interface {
+	ListByProject(projectID string) ([]ProcessorConfig, error)
+	ListActiveByProject(projectID string) ([]ProcessorConfig, error)
+	Get(id, projectID string) (*ProcessorConfig, error)
+	Create(p *ProcessorConfig) error
+	Update(p *ProcessorConfig) error
+	Delete(id, projectID string) error
+}
+
+type repository struct {
+	db *gorm.DB
+}
+
+func NewRepository(db *gorm.DB) Repository {
+	return &repository{db: db}
+}
+
+func (r *repository) ListByProject(projectID string) ([]ProcessorConfig, error) {
+	var list []ProcessorConfig
+	err := r.db.Where("project_id = ?", projectID).
+		Order("position ASC, created_at ASC").
+		Find(&list).Error
+	return list, err
+}
+
+func (r *repository) ListActiveByProject(projectID string) ([]ProcessorConfig, error) {
+	var list []ProcessorConfig
+	err := r.db.Where("project_id = ? AND active = TRUE", projectID).
+		Order("position ASC, created_at ASC").
+		Find(&list).Error
+	return list, err
+}
+
+func (r *repository) Get(id, projectID string) (*ProcessorConfig, error) {
+	var p ProcessorConfig
+	if err := r.db.Where("id = ? AND project_id = ?", id, projectID).First(&p).Error; err != nil {
+		return nil, err
+	}
+	return &p, nil
+}
+
+func (r *repository) Create(p *ProcessorConfig) error {
+	if p.ID == "" {
+		p.ID = uuid.New().String()
+	}
+	now := time.Now()
+	p.CreatedAt = now
+	p.UpdatedAt = now
+	return r.db.Create(p).Error
+}
+
+func (r *repository) Update(p *ProcessorConfig) error {
+	p.UpdatedAt = time.Now()
+	return r.db.Model(&ProcessorConfig{}).
+		Where("id = ? AND project_id = ?", p.ID, p.ProjectID).
+		Updates(map[string]any{
+			"position":   p.Position,
+			"name":       p.Name,
+			"kind":       p.Kind,
+			"config":     string(p.Config),
+			"timeout_ms": p.TimeoutMs,
+			"on_failure": p.OnFailure,
+			"active":     p.Active,
+			"updated_at": p.UpdatedAt,
+		}).Error
+}
+
+func (r *repository) Delete(id, projectID string) error {
+	return r.db.Where("id = ? AND project_id = ?", id, projectID).
+		Delete(&ProcessorConfig{}).Error
+}
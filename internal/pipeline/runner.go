@@ -0,0 +1,97 @@
+package pipeline
+
+import (
+	"context"
+	"log/slog"
+	"sync"
+	"time"
+
+	"github.com/joaovrmoraes/bataudit/internal/audit"
+)
+
+// DefaultReloadInterval is how long the Runner caches a project's chain before
+// reloading it from the database, so edits apply without restarting workers.
+const DefaultReloadInterval = 30 * time.Second
+
+type cachedChain struct {
+	chain    *Chain
+	loadedAt time.Time
+}
+
+// Runner applies each project's pipeline to events in the worker.
+type Runner struct {
+	repo   Repository
+	reload time.Duration
+
+	mu     sync.Mutex
+	chains map[string]cachedChain
+}
+
+func NewRunner(repo Repository) *Runner {
+	return &Runner{
+		repo:   repo,
+		reload: DefaultReloadInterval,
+		chains: make(map[string]cachedChain),
+	}
+}
+
+// WithReloadInterval overrides how long chains are cached.
+func (r *Runner) WithReloadInterval(d time.Duration) *Runner {
+	r.reload = d
+	return r
+}
+
+// Run passes ev through its project's chain. Events without a project, or
+// whose project has no processors, come back unchanged.
+func (r *Runner) Run(ctx context.Context, ev audit.Audit) Result {
+	if ev.ProjectID == "" {
+		return Result{Event: ev}
+	}
+	chain := r.chainFor(ev.ProjectID)
+	if chain == nil || len(chain.Steps) == 0 {
+		return Result{Event: ev}
+	}
+	return chain.Run(ctx, ev)
+}
+
+func (r *Runner) chainFor(projectID string) *Chain {
+	r.mu.Lock()
+	cached, ok := r.chains[projectID]
+	r.mu.Unlock()
+	if ok && time.Since(cached.loadedAt) < r.reload {
+		return cached.chain
+	}
+
+	configs, err := r.repo.ListActiveByProject(projectID)
+	if err != nil {
+		slog.Error("pipeline: failed to load processors", "project_id", projectID, "error", err)
+		// keep using the previous chain rather than silently disabling processing
+		return cached.chain
+	}
+	chain, err := BuildChain(configs)
+	if err != nil {
+		slog.Warn("pipeline: some processors could not be built", "project_id", projectID, "error", err)
+	}
+
+	r.mu.Lock()
+	r.chains[projectID] = cachedChain{chain: chain, loadedAt: time.Now()}
+	r.mu.Unlock()
+	return chain
+}
+
+// Invalidate drops the cached chain for a project.
+func (r *Runner) Invalidate(projectID string) {
+	r.mu.Lock()
+	delete(r.chains, projectID)
+	r.mu.Unlock()
+}
+
+// RunSamples runs every sample through chain and returns one result per
+// sample. It is the test harness behind POST /v1/pipeline/test.
+func RunSamples(ctx context.Context, chain *Chain, samples []audit.Audit) []Result {
+	results := make([]Result, 0, len(samples))
+	for _, ev := range samples {
+		results = append(results, chain.Run(ctx, ev))
+	}
+	return results
+}
@@ -10,6 +10,10 @@ import (
 
 const (
 	DefaultQueueName = "bataudit:events"
+
+	// deadLetterSuffix is appended to the queue name for events the processing
+	// pipeline could not handle.
+	deadLetterSuffix = ":dead"
 )
 
 type RedisQueue struct {
@@ -67,11 +71,31 @@ func (q *RedisQueue) Dequeue(ctx context.Context) ([]byte, error) {
 	return []byte(result[1]), nil
 }
 
+// DeadLetter - push an item to the dead-letter list (<queue>:dead) for later inspection or replay
+func (q *RedisQueue) DeadLetter(ctx context.Context, item interface{}) error {
+	data, err := json.Marshal(item)
+	if err != nil {
+		return err
+	}
+
+	return q.client.RPush(ctx, q.queue+deadLetterSuffix, data).Err()
+}
+
+// DeadLetterLength - returns the current length of the dead-letter list
+func (q *RedisQueue) DeadLetterLength(ctx context.Context) (int64, error) {
+	return q.client.LLen(ctx, q.queue+deadLetterSuffix).Result()
+}
+
 // QueueLength - returns the current length of the queue
 func (q *RedisQueue) QueueLength(ctx context.Context) (int64, error) {
 	return q.client.LLen(ctx, q.queue).Result()
 }
 
+// Client - returns the underlying Redis client, for components that share the connection
+func (q *RedisQueue) Client() *redis.Client {
+	return q.client
+}
+
 // Close - close the Redis client connection
 func (q *RedisQueue) Close() error {
 	return q.client.Close()
@@ -6,6 +6,7 @@ import (
 
 	"github.com/gin-gonic/gin"
 	"github.com/google/uuid"
+	"github.com/joaovrmoraes/bataudit/internal/auth"
 	"gorm.io/datatypes"
 )
 
@@ -25,11 +26,6 @@ func (h *Handler) RegisterRoutes(rg *gin.RouterGroup) {
 	rg.DELETE("/:id", h.Delete)
 }
 
-func canWrite(c *gin.Context) bool {
-	role := c.GetString("user_role")
-	return role == "owner" || role == "admin"
-}
-
 func (h *Handler) List(c *gin.Context) {
 	items, err := h.repo.List(c.Query("project_id"))
 	if err != nil {
@@ -56,8 +52,7 @@ type reportBody struct {
 }
 
 func (h *Handler) Create(c *gin.Context) {
-	if !canWrite(c) {
-		c.JSON(http.StatusForbidden, gin.H{"error": "owner or admin only"})
+	if !auth.RequireManager(c) {
 		return
 	}
 	var body reportBody
@@ -84,8 +79,7 @@ func (h *Handler) Create(c *gin.Context) {
 }
 
 func (h *Handler) Update(c *gin.Context) {
-	if !canWrite(c) {
-		c.JSON(http.StatusForbidden, gin.H{"error": "owner or admin only"})
+	if !auth.RequireManager(c) {
 		return
 	}
 	var body reportBody
@@ -108,8 +102,7 @@ func (h *Handler) Update(c *gin.Context) {
 }
 
 func (h *Handler) Delete(c *gin.Context) {
-	if !canWrite(c) {
-		c.JSON(http.StatusForbidden, gin.H{"error": "owner or admin only"})
+	if !auth.RequireManager(c) {
 		return
 	}
 	if err := h.repo.Delete(c.Param("id")); err != nil {
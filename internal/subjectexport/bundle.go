@@ -0,0 +1,144 @@
+package subjectexport
+
+import (
+	"archive/zip"
+	"bytes"
+	"crypto/sha256"
+	"encoding/csv"
+	"encoding/hex"
+	"encoding/json"
+	"strconv"
+	"time"
+
+	"github.com/joaovrmoraes/bataudit/internal/audit"
+)
+
+const bundleVersion = "bataudit-subject-export-v1"
+
+// Source is where an exported event was found.
+type Source string
+
+const (
+	SourceLive    Source = "live"
+	SourceArchive Source = "archive"
+)
+
+// Entry is one event of an export as written to events.json.
+type Entry struct {
+	audit.Audit
+	Source Source `json:"source"`
+	Match  Match  `json:"match"`
+}
+
+// Document is the content of events.json.
+type Document struct {
+	Version     string      `json:"version"`
+	ExportID    string      `json:"export_id"`
+	ProjectID   string      `json:"project_id"`
+	SubjectType SubjectType `json:"subject_type"`
+	Subject     string      `json:"subject"`
+	RequestIDs  []string    `json:"request_ids"`
+	GeneratedAt time.Time   `json:"generated_at"`
+	Events      []Entry     `json:"events"`
+}
+
+// Manifest is the content of manifest.json: the SHA-256 of every other file
+// of the bundle.
+type Manifest struct {
+	Version     string            `json:"version"`
+	ExportID    string            `json:"export_id"`
+	GeneratedAt time.Time         `json:"generated_at"`
+	Events      int               `json:"events"`
+	Files       map[string]string `json:"files"`
+}
+
+var summaryHeader = []string{
+	"id", "timestamp", "source", "match", "event_type", "service_name", "environment",
+	"method", "path", "status_code", "identifier", "user_email", "user_name", "tenant_id",
+	"ip", "request_id", "session_id",
+}
+
+// encodeBundle writes the export's ZIP file and returns it with its SHA-256.
+func encodeBundle(doc *Document) ([]byte, string, error) {
+	events, err := json.MarshalIndent(doc, "", "  ")
+	if err != nil {
+		return nil, "", err
+	}
+	summary, err := encodeSummary(doc.Events)
+	if err != nil {
+		return nil, "", err
+	}
+	files := []struct {
+		name string
+		data []byte
+	}{{"events.json", events}, {"summary.csv", summary}}
+
+	m := Manifest{
+		Version:     bundleVersion,
+		ExportID:    doc.ExportID,
+		GeneratedAt: doc.GeneratedAt,
+		Events:      len(doc.Events),
+		Files:       map[string]string{},
+	}
+	for _, f := range files {
+		m.Files[f.name] = sha256Hex(f.data)
+	}
+	manifest, err := json.MarshalIndent(m, "", "  ")
+	if err != nil {
+		return nil, "", err
+	}
+	files = append(files, struct {
+		name string
+		data []byte
+	}{"manifest.json", manifest})
+
+	var buf bytes.Buffer
+	zw := zip.NewWriter(&buf)
+	for _, f := range files {
+		w, err := zw.CreateHeader(&zip.FileHeader{Name: f.name, Method: zip.Deflate, Modified: doc.GeneratedAt})
+		if err != nil {
+			return nil, "", err
+		}
+		if _, err := w.Write(f.data); err != nil {
+			return nil, "", err
+		}
+	}
+	if err := zw.Close(); err != nil {
+		return nil, "", err
+	}
+	return buf.Bytes(), sha256Hex(buf.Bytes()), nil
+}
+
+func encodeSummary(entries []Entry) ([]byte, error) {
+	var buf bytes.Buffer
+	w := csv.NewWriter(&buf)
+	_ = w.Write(summaryHeader)
+	for _, e := range entries {
+		_ = w.Write([]string{
+			e.ID,
+			e.Timestamp.UTC().Format(time.RFC3339Nano),
+			string(e.Source),
+			string(e.Match),
+			e.EventType,
+			e.ServiceName,
+			e.Environment,
+			string(e.Method),
+			e.Path,
+			strconv.Itoa(e.StatusCode),
+			e.Identifier,
+			e.UserEmail,
+			e.UserName,
+			e.TenantID,
+			e.IP,
+			e.RequestID,
+			e.SessionID,
+		})
+	}
+	w.Flush()
+	return buf.Bytes(), w.Error()
+}
+
+func sha256Hex(data []byte) string {
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
@@ -0,0 +1,373 @@
+package subjectexport
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/joaovrmoraes/bataudit/internal/archive"
+	"github.com/joaovrmoraes/bataudit/internal/audit"
+	"gorm.io/gorm"
+)
+
+const (
+	DefaultTTL       = 72 * time.Hour
+	DefaultMaxEvents = 100_000
+
+	maxTTL        = 30 * 24 * time.Hour
+	maxRequestIDs = 1000
+	// sessionChunk bounds the IN list of one session query.
+	sessionChunk = 1000
+)
+
+// Exporter collects and packages access exports. Like rehydrations, exports
+// run in the background of the Reader that accepted them.
+type Exporter struct {
+	db        *gorm.DB
+	store     archive.Store // nil = archive not configured; only live events are searched
+	redactor  archive.Redactor
+	ttl       time.Duration
+	maxEvents int
+}
+
+func NewExporter(db *gorm.DB, store archive.Store) *Exporter {
+	return &Exporter{db: db, store: store, ttl: DefaultTTL, maxEvents: DefaultMaxEvents}
+}
+
+// WithTTL sets how long a finished export can be downloaded.
+func (x *Exporter) WithTTL(ttl time.Duration) *Exporter {
+	if ttl > 0 {
+		x.ttl = min(ttl, maxTTL)
+	}
+	return x
+}
+
+// WithMaxEvents caps how many events one export may contain.
+func (x *Exporter) WithMaxEvents(n int) *Exporter {
+	if n > 0 {
+		x.maxEvents = n
+	}
+	return x
+}
+
+// WithRedactor applies data-subject erasures to events read from the
+// archive, so an export never returns data that was erased from live storage.
+func (x *Exporter) WithRedactor(redactor archive.Redactor) *Exporter {
+	x.redactor = redactor
+	return x
+}
+
+// NewExporterFromEnv builds an Exporter from ARCHIVE_TARGET,
+// SUBJECT_EXPORT_TTL (default 72h) and SUBJECT_EXPORT_MAX_EVENTS (default
+// 100,000). Without ARCHIVE_TARGET only live events are exported.
+func NewExporterFromEnv(db *gorm.DB, getEnv func(string, string) string) (*Exporter, error) {
+	var store archive.Store
+	if target := getEnv("ARCHIVE_TARGET", ""); target != "" {
+		var err error
+		if store, err = archive.NewStore(target, getEnv); err != nil {
+			return nil, err
+		}
+	}
+	ttl, _ := time.ParseDuration(getEnv("SUBJECT_EXPORT_TTL", ""))
+	maxEvents, _ := strconv.Atoi(getEnv("SUBJECT_EXPORT_MAX_EVENTS", ""))
+	return NewExporter(db, store).WithTTL(ttl).WithMaxEvents(maxEvents), nil
+}
+
+// Request validates and records an export of a subject's events. Either a
+// subject or request IDs (or both) must be given. Call Run to build it.
+func (x *Exporter) Request(projectID string, t SubjectType, subject string, requestIDs []string, requestedBy string) (*Export, error) {
+	subject = normalize(t, subject)
+	ids := make([]string, 0, len(requestIDs))
+	for _, id := range requestIDs {
+		if id = strings.TrimSpace(id); id != "" {
+			ids = append(ids, id)
+		}
+	}
+	switch {
+	case projectID == "":
+		return nil, errors.New("project_id required")
+	case subject == "" && len(ids) == 0:
+		return nil, errors.New("subject or request_ids required")
+	case subject != "" && t != SubjectIdentifier && t != SubjectEmail && t != SubjectTenant:
+		return nil, errors.New("subject_type must be identifier, email or tenant")
+	case len(ids) > maxRequestIDs:
+		return nil, fmt.Errorf("at most %d request_ids", maxRequestIDs)
+	}
+	if subject == "" {
+		t = ""
+	}
+
+	now := time.Now().UTC()
+	exp := &Export{
+		ID:          uuid.New().String(),
+		ProjectID:   projectID,
+		SubjectType: t,
+		Subject:     subject,
+		RequestIDs:  ids,
+		Status:      StatusPending,
+		RequestedBy: requestedBy,
+		ExpiresAt:   now.Add(x.ttl),
+		CreatedAt:   now,
+	}
+	if err := x.db.Create(exp).Error; err != nil {
+		return nil, err
+	}
+	return exp, nil
+}
+
+// Run collects the export's events, packages them and records the outcome.
+func (x *Exporter) Run(ctx context.Context, exp *Export) error {
+	exp.Status = StatusRunning
+	x.db.Model(exp).Update("status", exp.Status)
+
+	entries, err := x.collect(ctx, exp)
+	now := time.Now().UTC()
+	exp.CompletedAt = &now
+	var data []byte
+	if err == nil {
+		data, exp.SHA256, err = encodeBundle(&Document{
+			Version:     bundleVersion,
+			ExportID:    exp.ID,
+			ProjectID:   exp.ProjectID,
+			SubjectType: exp.SubjectType,
+			Subject:     exp.Subject,
+			RequestIDs:  exp.RequestIDs,
+			GeneratedAt: now,
+			Events:      entries,
+		})
+	}
+
+	exp.Status = StatusReady
+	exp.Events, exp.ArchivedEvents, exp.Bytes = int64(len(entries)), 0, len(data)
+	for _, e := range entries {
+		if e.Source == SourceArchive {
+			exp.ArchivedEvents++
+		}
+	}
+	if err != nil {
+		exp.Status, exp.Error = StatusFailed, err.Error()
+		exp.Events, exp.ArchivedEvents, exp.SHA256, exp.Bytes, data = 0, 0, "", 0, nil
+	}
+	if uerr := x.db.Model(exp).Updates(map[string]any{
+		"status":          exp.Status,
+		"events":          exp.Events,
+		"archived_events": exp.ArchivedEvents,
+		"sha256":          exp.SHA256,
+		"bytes":           exp.Bytes,
+		"bundle":          data,
+		"error":           exp.Error,
+		"completed_at":    exp.CompletedAt,
+	}).Error; uerr != nil && err == nil {
+		err = uerr
+	}
+
+	slog.Info("subject export finished",
+		"id", exp.ID, "project_id", exp.ProjectID, "status", exp.Status, "events", exp.Events, "archived", exp.ArchivedEvents)
+	return err
+}
+
+// collector gathers an export's events, keeping the first copy of each.
+type collector struct {
+	max      int
+	entries  map[string]Entry
+	sessions map[string]bool
+}
+
+func (c *collector) add(ev audit.Audit, src Source, m Match) error {
+	if _, ok := c.entries[ev.ID]; ok {
+		return nil
+	}
+	if len(c.entries) >= c.max {
+		return fmt.Errorf("more than %d events; narrow the request and try again", c.max)
+	}
+	c.entries[ev.ID] = Entry{Audit: ev, Source: src, Match: m}
+	if m != MatchSession && ev.SessionID != "" {
+		c.sessions[ev.SessionID] = true
+	}
+	return nil
+}
+
+// collect finds the events matched directly (subject or request ID), then
+// the events of the sessions those belong to — each time in live storage
+// first, then in the archive. An event both live and archived is exported
+// once, from live storage.
+func (x *Exporter) collect(ctx context.Context, exp *Export) ([]Entry, error) {
+	c := &collector{max: x.maxEvents, entries: map[string]Entry{}, sessions: map[string]bool{}}
+	db := x.db.WithContext(ctx)
+
+	var conds []string
+	var args []any
+	if exp.Subject != "" {
+		conds = append(conds, exp.column()+" = ?")
+		args = append(args, exp.Subject)
+	}
+	if len(exp.RequestIDs) > 0 {
+		conds = append(conds, "request_id IN ?")
+		args = append(args, []string(exp.RequestIDs))
+	}
+	var direct []audit.Audit
+	if err := db.Where("project_id = ?", exp.ProjectID).
+		Where("("+strings.Join(conds, " OR ")+")", args...).
+		Limit(x.maxEvents + 1).
+		Find(&direct).Error; err != nil {
+		return nil, err
+	}
+	for _, ev := range direct {
+		if err := c.add(ev, SourceLive, exp.match(&ev)); err != nil {
+			return nil, err
+		}
+	}
+	err := x.scan(ctx, exp.ProjectID, func(ev *audit.Audit) error {
+		if m := exp.match(ev); m != "" {
+			return c.add(*ev, SourceArchive, m)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	if len(c.sessions) > 0 {
+		sessions := make([]string, 0, len(c.sessions))
+		for s := range c.sessions {
+			sessions = append(sessions, s)
+		}
+		sort.Strings(sessions)
+		for i := 0; i < len(sessions); i += sessionChunk {
+			var linked []audit.Audit
+			if err := db.Where("project_id = ? AND session_id IN ?", exp.ProjectID, sessions[i:min(i+sessionChunk, len(sessions))]).
+				Limit(x.maxEvents + 1).
+				Find(&linked).Error; err != nil {
+				return nil, err
+			}
+			for _, ev := range linked {
+				if err := c.add(ev, SourceLive, MatchSession); err != nil {
+					return nil, err
+				}
+			}
+		}
+		err := x.scan(ctx, exp.ProjectID, func(ev *audit.Audit) error {
+			if ev.SessionID != "" && c.sessions[ev.SessionID] {
+				return c.add(*ev, SourceArchive, MatchSession)
+			}
+			return nil
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	entries := make([]Entry, 0, len(c.entries))
+	for _, e := range c.entries {
+		entries = append(entries, e)
+	}
+	sort.Slice(entries, func(i, j int) bool {
+		if !entries[i].Timestamp.Equal(entries[j].Timestamp) {
+			return entries[i].Timestamp.Before(entries[j].Timestamp)
+		}
+		return entries[i].ID < entries[j].ID
+	})
+	return entries, nil
+}
+
+// scan calls fn with every archived event of the project, after erasures
+// have been applied to it. It does nothing without an archive.
+func (x *Exporter) scan(ctx context.Context, projectID string, fn func(ev *audit.Audit) error) error {
+	if x.store == nil {
+		return nil
+	}
+	return archive.Scan(ctx, x.store, projectID, func(events []audit.Audit) error {
+		if x.redactor != nil {
+			if err := x.redactor.Redact(ctx, projectID, events); err != nil {
+				return err
+			}
+		}
+		for i := range events {
+			if err := fn(&events[i]); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// List returns a project's exports, newest first, without their bundles.
+func (x *Exporter) List(projectID string) ([]Export, error) {
+	var list []Export
+	err := x.db.Omit("bundle").Where("project_id = ?", projectID).Order("created_at DESC").Find(&list).Error
+	return list, err
+}
+
+// Get returns an export without its bundle.
+func (x *Exporter) Get(id, projectID string) (*Export, error) {
+	var exp Export
+	if err := x.db.Omit("bundle").Where("id = ? AND project_id = ?", id, projectID).First(&exp).Error; err != nil {
+		return nil, err
+	}
+	return &exp, nil
+}
+
+// Bundle returns an export with its bundle.
+func (x *Exporter) Bundle(id, projectID string) (*Export, error) {
+	var exp Export
+	if err := x.db.Where("id = ? AND project_id = ?", id, projectID).First(&exp).Error; err != nil {
+		return nil, err
+	}
+	return &exp, nil
+}
+
+// staleAfter marks an export still pending or running after this long as
+// interrupted (e.g. the Reader restarted mid-export).
+const staleAfter = 6 * time.Hour
+
+// Janitor drops the bundles of exports past their TTL.
+type Janitor struct {
+	db    *gorm.DB
+	every time.Duration
+}
+
+func NewJanitor(db *gorm.DB) *Janitor {
+	return &Janitor{db: db, every: 10 * time.Minute}
+}
+
+// Start blocks until ctx is cancelled, sweeping periodically.
+func (j *Janitor) Start(ctx context.Context) {
+	ticker := time.NewTicker(j.every)
+	defer ticker.Stop()
+	for {
+		if n, err := j.Sweep(ctx); err != nil {
+			slog.Error("subject export sweep failed", "error", err)
+		} else if n > 0 {
+			slog.Info("subject exports expired", "count", n)
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// Sweep expires exports past their TTL and fails stale ones. Returns the
+// number expired.
+func (j *Janitor) Sweep(ctx context.Context) (int, error) {
+	db := j.db.WithContext(ctx)
+	now := time.Now().UTC()
+
+	if err := db.Model(&Export{}).
+		Where("status IN ? AND created_at < ?", []Status{StatusPending, StatusRunning}, now.Add(-staleAfter)).
+		Updates(map[string]any{"status": StatusFailed, "error": "interrupted"}).Error; err != nil {
+		return 0, err
+	}
+
+	res := db.Model(&Export{}).
+		Where("status = ? AND expires_at < ?", StatusReady, now).
+		Updates(map[string]any{"status": StatusExpired, "bundle": nil})
+	return int(res.RowsAffected), res.Error
+}
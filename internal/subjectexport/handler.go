@@ -0,0 +1,198 @@
+package subjectexport
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/joaovrmoraes/bataudit/internal/auth"
+	"gorm.io/gorm"
+)
+
+type Handler struct {
+	exporter *Exporter
+}
+
+func NewHandler(exporter *Exporter) *Handler {
+	return &Handler{exporter: exporter}
+}
+
+// RegisterRoutes mounts the access export endpoints onto an
+// already-JWT-protected group. Expected base path: /v1/subject-exports
+func (h *Handler) RegisterRoutes(rg *gin.RouterGroup) {
+	rg.GET("", h.List)
+	rg.POST("", h.Create)
+	rg.GET("/:id", h.Get)
+	rg.GET("/:id/download", h.Download)
+}
+
+type createRequest struct {
+	ProjectID string `json:"project_id" binding:"required"`
+	// SubjectType is identifier, email or tenant; required with Subject.
+	SubjectType SubjectType `json:"subject_type"`
+	Subject     string      `json:"subject"`
+	// RequestIDs adds events carrying these request IDs (max 1000).
+	RequestIDs []string `json:"request_ids"`
+}
+
+// exportResponse adds the download link to an export.
+type exportResponse struct {
+	Export
+	DownloadURL string `json:"download_url,omitempty"`
+}
+
+func respond(c *gin.Context, exp *Export) exportResponse {
+	res := exportResponse{Export: *exp}
+	if exp.Status == StatusReady {
+		base := strings.TrimSuffix(strings.TrimSuffix(c.FullPath(), "/download"), "/:id")
+		res.DownloadURL = fmt.Sprintf("%s/%s/download?project_id=%s", base, exp.ID, url.QueryEscape(exp.ProjectID))
+	}
+	return res
+}
+
+// Create godoc
+// @Summary      Export a data subject's events
+// @Description  Collects every event of an identifier, email or tenant, plus events carrying the given request IDs and events of the sessions these belong to, from live storage and the cold archive. Runs in the background; poll GET /subject-exports/{id} until status is ready, then follow download_url. Erased data stays erased in the export.
+// @Tags         subject-exports
+// @Accept       json
+// @Produce      json
+// @Security     BearerAuth
+// @Param        body  body  createRequest  true  "Subject and/or request IDs"
+// @Success      202  {object}  exportResponse
+// @Failure      400  {object}  map[string]string
+// @Failure      403  {object}  map[string]string
+// @Router       /subject-exports [post]
+func (h *Handler) Create(c *gin.Context) {
+	claims, ok := canExport(c)
+	if !ok {
+		return
+	}
+
+	var body createRequest
+	if err := c.ShouldBindJSON(&body); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	exp, err := h.exporter.Request(body.ProjectID, body.SubjectType, body.Subject, body.RequestIDs, claims.Email)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	go func(exp Export) {
+		_ = h.exporter.Run(context.Background(), &exp)
+	}(*exp)
+
+	c.JSON(http.StatusAccepted, respond(c, exp))
+}
+
+// List godoc
+// @Summary      List a project's access exports
+// @Tags         subject-exports
+// @Produce      json
+// @Security     BearerAuth
+// @Param        project_id  query  string  true  "Project ID"
+// @Success      200  {array}  exportResponse
+// @Failure      400  {object}  map[string]string
+// @Failure      403  {object}  map[string]string
+// @Router       /subject-exports [get]
+func (h *Handler) List(c *gin.Context) {
+	if _, ok := canExport(c); !ok {
+		return
+	}
+	projectID := c.Query("project_id")
+	if projectID == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "project_id required"})
+		return
+	}
+	list, err := h.exporter.List(projectID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	res := make([]exportResponse, 0, len(list))
+	for i := range list {
+		res = append(res, respond(c, &list[i]))
+	}
+	c.JSON(http.StatusOK, res)
+}
+
+// Get godoc
+// @Summary      Get an access export's status
+// @Tags         subject-exports
+// @Produce      json
+// @Security     BearerAuth
+// @Param        id          path   string  true  "Export ID"
+// @Param        project_id  query  string  true  "Project ID"
+// @Success      200  {object}  exportResponse
+// @Failure      404  {object}  map[string]string
+// @Router       /subject-exports/{id} [get]
+func (h *Handler) Get(c *gin.Context) {
+	exp, ok := h.find(c, h.exporter.Get)
+	if !ok {
+		return
+	}
+	c.JSON(http.StatusOK, respond(c, exp))
+}
+
+// Download godoc
+// @Summary      Download a finished access export
+// @Description  A ZIP with events.json (every event, with where it was found and why it matched), summary.csv (one row per event) and manifest.json (generation time and the SHA-256 of each file). X-Content-SHA256 carries the SHA-256 of the ZIP itself, also shown as sha256 on the export.
+// @Tags         subject-exports
+// @Produce      application/zip
+// @Security     BearerAuth
+// @Param        id          path   string  true  "Export ID"
+// @Param        project_id  query  string  true  "Project ID"
+// @Success      200
+// @Failure      404  {object}  map[string]string
+// @Failure      409  {object}  map[string]string
+// @Router       /subject-exports/{id}/download [get]
+func (h *Handler) Download(c *gin.Context) {
+	exp, ok := h.find(c, h.exporter.Bundle)
+	if !ok {
+		return
+	}
+	if exp.Status != StatusReady {
+		c.JSON(http.StatusConflict, gin.H{"error": "export is " + string(exp.Status)})
+		return
+	}
+	c.Header("Content-Disposition", fmt.Sprintf(`attachment; filename="bataudit-subject-export-%s.zip"`, exp.ID))
+	c.Header("X-Content-SHA256", exp.SHA256)
+	c.Data(http.StatusOK, "application/zip", exp.Bundle)
+}
+
+func (h *Handler) find(c *gin.Context, get func(id, projectID string) (*Export, error)) (*Export, bool) {
+	if _, ok := canExport(c); !ok {
+		return nil, false
+	}
+	projectID := c.Query("project_id")
+	if projectID == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "project_id required"})
+		return nil, false
+	}
+	exp, err := get(c.Param("id"), projectID)
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "export not found"})
+		return nil, false
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return nil, false
+	}
+	return exp, true
+}
+
+// canExport reports whether the caller may export personal data, writing a
+// 403 when not. Exports contain a subject's whole history, so viewers may
+// not even list them.
+func canExport(c *gin.Context) (*auth.Claims, bool) {
+	if !auth.RequireManager(c) {
+		return nil, false
+	}
+	return c.MustGet(auth.ContextKeyClaims).(*auth.Claims), true
+}
@@ -0,0 +1,109 @@
+// Package subjectexport answers data-subject access requests (GDPR art. 15,
+// LGPD art. 18 II). Given an identifier, email or tenant, it collects every
+// event of the subject — plus events carrying given request IDs and events of
+// the subject's sessions — from live storage and the cold archive, and
+// packages them as a ZIP bundle (events.json, summary.csv, manifest.json)
+// that can be downloaded until the export expires.
+package subjectexport
+
+import (
+	"strings"
+	"time"
+
+	"github.com/joaovrmoraes/bataudit/internal/audit"
+	"gorm.io/datatypes"
+)
+
+type SubjectType string
+
+const (
+	SubjectIdentifier SubjectType = "identifier"
+	SubjectEmail      SubjectType = "email"
+	SubjectTenant     SubjectType = "tenant"
+)
+
+type Status string
+
+const (
+	StatusPending Status = "pending"
+	StatusRunning Status = "running"
+	StatusReady   Status = "ready"
+	StatusFailed  Status = "failed"
+	StatusExpired Status = "expired"
+)
+
+// Export is one access export. Bundle is cleared, and the record kept as a
+// trail of who exported whose data, once the export expires.
+type Export struct {
+	ID             string                      `json:"id"              gorm:"primaryKey"`
+	ProjectID      string                      `json:"project_id"`
+	SubjectType    SubjectType                 `json:"subject_type"`
+	Subject        string                      `json:"subject"`
+	RequestIDs     datatypes.JSONSlice[string] `json:"request_ids"`
+	Status         Status                      `json:"status"`
+	Events         int64                       `json:"events"`           // events in the bundle
+	ArchivedEvents int64                       `json:"archived_events"`  // of which were found only in the archive
+	SHA256         string                      `json:"sha256,omitempty"` // of the bundle file
+	Bytes          int                         `json:"bytes"`
+	Bundle         []byte                      `json:"-"`
+	Error          string                      `json:"error,omitempty"`
+	RequestedBy    string                      `json:"requested_by"`
+	ExpiresAt      time.Time                   `json:"expires_at"`
+	CreatedAt      time.Time                   `json:"created_at"`
+	CompletedAt    *time.Time                  `json:"completed_at,omitempty"`
+}
+
+func (Export) TableName() string { return "subject_exports" }
+
+// normalize returns the canonical form of a subject: emails compare
+// case-insensitively, identifiers and tenants exactly.
+func normalize(t SubjectType, subject string) string {
+	subject = strings.TrimSpace(subject)
+	if t == SubjectEmail {
+		return strings.ToLower(subject)
+	}
+	return subject
+}
+
+// column returns the audits column the subject is matched against.
+func (e *Export) column() string {
+	switch e.SubjectType {
+	case SubjectEmail:
+		return "LOWER(user_email)"
+	case SubjectTenant:
+		return "tenant_id"
+	}
+	return "identifier"
+}
+
+// Match is why an event is part of an export.
+type Match string
+
+const (
+	MatchSubject   Match = "subject"
+	MatchRequestID Match = "request_id"
+	MatchSession   Match = "session"
+)
+
+// match reports why ev belongs to the export directly, or "" when it does
+// not. Events linked only through a session are matched separately.
+func (e *Export) match(ev *audit.Audit) Match {
+	value := ev.Identifier
+	switch e.SubjectType {
+	case SubjectEmail:
+		value = strings.ToLower(ev.UserEmail)
+	case SubjectTenant:
+		value = ev.TenantID
+	}
+	if value != "" && value == e.Subject {
+		return MatchSubject
+	}
+	if ev.RequestID != "" {
+		for _, id := range e.RequestIDs {
+			if id == ev.RequestID {
+				return MatchRequestID
+			}
+		}
+	}
+	return ""
+}
@@ -0,0 +1,94 @@
+package subjectexport
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"io"
+	"testing"
+	"time"
+
+	"github.com/joaovrmoraes/bataudit/internal/audit"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestExport_match(t *testing.T) {
+	byEmail := &Export{SubjectType: SubjectEmail, Subject: normalize(SubjectEmail, " Alice@Example.com "), RequestIDs: []string{"req-9"}}
+	assert.Equal(t, "alice@example.com", byEmail.Subject)
+	assert.Equal(t, "LOWER(user_email)", byEmail.column())
+	assert.Equal(t, MatchSubject, byEmail.match(&audit.Audit{UserEmail: "ALICE@example.com"}))
+	assert.Equal(t, MatchRequestID, byEmail.match(&audit.Audit{UserEmail: "bob@example.com", RequestID: "req-9"}))
+	assert.Equal(t, Match(""), byEmail.match(&audit.Audit{UserEmail: "bob@example.com"}))
+
+	byTenant := &Export{SubjectType: SubjectTenant, Subject: "acme"}
+	assert.Equal(t, "tenant_id", byTenant.column())
+	assert.Equal(t, MatchSubject, byTenant.match(&audit.Audit{TenantID: "acme"}))
+	assert.Equal(t, Match(""), byTenant.match(&audit.Audit{Identifier: "acme"}))
+
+	onlyRequests := &Export{RequestIDs: []string{"req-1"}}
+	assert.Equal(t, Match(""), onlyRequests.match(&audit.Audit{}), "empty values never match")
+}
+
+func TestCollector_add(t *testing.T) {
+	c := &collector{max: 2, entries: map[string]Entry{}, sessions: map[string]bool{}}
+	require.NoError(t, c.add(audit.Audit{ID: "a", SessionID: "s1"}, SourceLive, MatchSubject))
+	require.NoError(t, c.add(audit.Audit{ID: "a"}, SourceArchive, MatchSubject))
+	assert.Equal(t, SourceLive, c.entries["a"].Source, "first copy wins")
+	require.NoError(t, c.add(audit.Audit{ID: "b", SessionID: "s2"}, SourceLive, MatchSession))
+	assert.Equal(t, map[string]bool{"s1": true}, c.sessions, "session matches do not widen the search")
+	assert.Error(t, c.add(audit.Audit{ID: "c"}, SourceLive, MatchSubject))
+}
+
+func TestEncodeBundle(t *testing.T) {
+	ts := time.Date(2026, 10, 19, 9, 0, 0, 0, time.UTC)
+	doc := &Document{
+		Version:     bundleVersion,
+		ExportID:    "e1",
+		ProjectID:   "p1",
+		SubjectType: SubjectIdentifier,
+		Subject:     "alice",
+		GeneratedAt: ts,
+		Events: []Entry{
+			{Audit: audit.Audit{ID: "a", Method: audit.GET, Identifier: "alice", Path: "/x", StatusCode: 200, Timestamp: ts}, Source: SourceLive, Match: MatchSubject},
+			{Audit: audit.Audit{ID: "b", Method: audit.POST, Identifier: "alice", Path: "/y", Timestamp: ts.Add(-time.Hour)}, Source: SourceArchive, Match: MatchSession},
+		},
+	}
+	data, sum, err := encodeBundle(doc)
+	require.NoError(t, err)
+	assert.Equal(t, sha256Hex(data), sum)
+
+	zr, err := zip.NewReader(bytes.NewReader(data), int64(len(data)))
+	require.NoError(t, err)
+	files := map[string][]byte{}
+	for _, f := range zr.File {
+		rc, err := f.Open()
+		require.NoError(t, err)
+		files[f.Name], _ = io.ReadAll(rc)
+		rc.Close()
+	}
+	require.Len(t, files, 3)
+
+	var m Manifest
+	require.NoError(t, json.Unmarshal(files["manifest.json"], &m))
+	assert.Equal(t, ts, m.GeneratedAt)
+	assert.Equal(t, 2, m.Events)
+	assert.Equal(t, sha256Hex(files["events.json"]), m.Files["events.json"])
+	assert.Equal(t, sha256Hex(files["summary.csv"]), m.Files["summary.csv"])
+
+	var got Document
+	require.NoError(t, json.Unmarshal(files["events.json"], &got))
+	require.Len(t, got.Events, 2)
+	assert.Equal(t, SourceArchive, got.Events[1].Source)
+	assert.Equal(t, "/y", got.Events[1].Path)
+
+	rows, err := csv.NewReader(bytes.NewReader(files["summary.csv"])).ReadAll()
+	require.NoError(t, err)
+	require.Len(t, rows, 3)
+	assert.Equal(t, summaryHeader, rows[0])
+	assert.Equal(t, []string{"a", "2026-10-19T09:00:00Z", "live", "subject"}, rows[1][:4])
+
+	again, _, _ := encodeBundle(doc)
+	assert.Equal(t, data, again, "output is deterministic")
+}
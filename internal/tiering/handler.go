@@ -1,18 +1,32 @@
 package tiering
 
 import (
+	"errors"
 	"net/http"
+	"strings"
 	"time"
 
 	"github.com/gin-gonic/gin"
+	"github.com/joaovrmoraes/bataudit/internal/auth"
 )
 
+// maxRetentionDays bounds a policy's raw_days and hourly_days (100 years).
+const maxRetentionDays = 36500
+
 type Handler struct {
-	repo Repository
+	repo     Repository
+	settings Settings
 }
 
 func NewHandler(repo Repository) *Handler {
-	return &Handler{repo: repo}
+	return &Handler{repo: repo, settings: Settings{RawDays: 30, HourlyDays: 365, RunHour: 2}}
+}
+
+// WithSettings sets the instance defaults the retention endpoints report and
+// preview against; they must match the worker's.
+func (h *Handler) WithSettings(s Settings) *Handler {
+	h.settings = s
+	return h
 }
 
 // RegisterRoutes mounts tiering endpoints onto an already-JWT-protected group.
@@ -22,6 +36,15 @@ func (h *Handler) RegisterRoutes(rg *gin.RouterGroup) {
 	rg.GET("/usage", h.Usage)
 }
 
+// RegisterRetentionRoutes mounts the retention policy endpoints onto an
+// already-JWT-protected group. Expected base path: /v1/retention
+func (h *Handler) RegisterRetentionRoutes(rg *gin.RouterGroup) {
+	rg.GET("/policies", h.ListPolicies)
+	rg.PUT("/policies", h.SavePolicy)
+	rg.DELETE("/policies/:id", h.DeletePolicy)
+	rg.GET("/preview", h.Preview)
+}
+
 // History godoc
 // @Summary      Audit event history (time series)
 // @Description  Returns hourly/daily time series merging raw events and pre-aggregated summaries.
@@ -91,3 +114,177 @@ func (h *Handler) Usage(c *gin.Context) {
 
 	c.JSON(http.StatusOK, stat)
 }
+
+// ListPolicies godoc
+// @Summary      List a project's retention policies
+// @Description  Returns the project's policies together with the instance-wide defaults they override.
+// @Tags         retention
+// @Produce      json
+// @Security     BearerAuth
+// @Param        project_id  query  string  true  "Project ID"
+// @Success      200  {object}  map[string]interface{}
+// @Failure      400  {object}  map[string]string
+// @Failure      500  {object}  map[string]string
+// @Router       /retention/policies [get]
+func (h *Handler) ListPolicies(c *gin.Context) {
+	projectID := c.Query("project_id")
+	if projectID == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "project_id required"})
+		return
+	}
+
+	list, err := h.repo.ListPolicies(projectID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"data": list, "defaults": h.settings})
+}
+
+type policyRequest struct {
+	ProjectID   string `json:"project_id"  binding:"required"`
+	Environment string `json:"environment"`
+	EventType   string `json:"event_type"`
+	RawDays     int    `json:"raw_days"    binding:"required"`
+	HourlyDays  *int   `json:"hourly_days"`
+}
+
+func (r policyRequest) toPolicy() (*RetentionPolicy, error) {
+	p := &RetentionPolicy{
+		ProjectID:   r.ProjectID,
+		Environment: strings.TrimSpace(r.Environment),
+		EventType:   strings.TrimSpace(r.EventType),
+		RawDays:     r.RawDays,
+		HourlyDays:  r.HourlyDays,
+	}
+	if p.EventType == httpEventType {
+		p.EventType = "" // same rule; keep one spelling so precedence stays unambiguous
+	}
+	if p.RawDays < 1 || p.RawDays > maxRetentionDays {
+		return nil, errors.New("raw_days must be between 1 and 36500")
+	}
+	if p.HourlyDays != nil {
+		if p.Environment != "" || p.EventType != "" {
+			return nil, errors.New("hourly_days can only be set on a project-wide policy")
+		}
+		if *p.HourlyDays < 1 || *p.HourlyDays > maxRetentionDays {
+			return nil, errors.New("hourly_days must be between 1 and 36500")
+		}
+	}
+	return p, nil
+}
+
+// SavePolicy godoc
+// @Summary      Create or replace a retention policy
+// @Description  Policies are keyed by project, environment and event type; saving an existing key replaces it.
+// @Tags         retention
+// @Accept       json
+// @Produce      json
+// @Security     BearerAuth
+// @Param        body  body  policyRequest  true  "Policy"
+// @Success      200  {object}  RetentionPolicy
+// @Failure      400  {object}  map[string]string
+// @Failure      403  {object}  map[string]string
+// @Failure      500  {object}  map[string]string
+// @Router       /retention/policies [put]
+func (h *Handler) SavePolicy(c *gin.Context) {
+	if !auth.RequireManager(c) {
+		return
+	}
+
+	var req policyRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	p, err := req.toPolicy()
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if err := h.repo.SavePolicy(p); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, p)
+}
+
+// DeletePolicy godoc
+// @Summary      Delete a retention policy
+// @Tags         retention
+// @Security     BearerAuth
+// @Param        id          path   string  true  "Policy ID"
+// @Param        project_id  query  string  true  "Project ID"
+// @Success      204
+// @Failure      400  {object}  map[string]string
+// @Failure      403  {object}  map[string]string
+// @Router       /retention/policies/{id} [delete]
+func (h *Handler) DeletePolicy(c *gin.Context) {
+	if !auth.RequireManager(c) {
+		return
+	}
+
+	projectID := c.Query("project_id")
+	if projectID == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "project_id required"})
+		return
+	}
+	if err := h.repo.DeletePolicy(c.Param("id"), projectID); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.Status(http.StatusNoContent)
+}
+
+// Preview godoc
+// @Summary      Preview the next tiering run for a project
+// @Description  Counts the raw events and hourly summaries the next run would remove under the project's current policies.
+// @Tags         retention
+// @Produce      json
+// @Security     BearerAuth
+// @Param        project_id  query  string  true  "Project ID"
+// @Success      200  {object}  RetentionPreview
+// @Failure      400  {object}  map[string]string
+// @Failure      500  {object}  map[string]string
+// @Router       /retention/preview [get]
+func (h *Handler) Preview(c *gin.Context) {
+	projectID := c.Query("project_id")
+	if projectID == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "project_id required"})
+		return
+	}
+
+	policies, err := h.repo.ListPolicies(projectID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	runAt := h.settings.NextRun(time.Now())
+	sp := buildScopePlan(Scope{ProjectID: projectID}, policies, h.settings, runAt)
+
+	counts, err := h.repo.CountExpiredRaw(sp.Scope, sp.Rules)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	hourly, err := h.repo.CountExpiredHourly(sp.Scope, sp.HourlyCutoff)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	preview := RetentionPreview{
+		ProjectID:       projectID,
+		RunAt:           runAt,
+		SummaryCutoff:   sp.SummaryCutoff,
+		HourlyCutoff:    sp.HourlyCutoff,
+		HourlySummaries: hourly,
+	}
+	for i, rule := range sp.Rules {
+		preview.Rules = append(preview.Rules, RuleImpact{RawRule: rule, RawEvents: counts[i]})
+		preview.RawEvents += counts[i]
+	}
+	c.JSON(http.StatusOK, preview)
+}
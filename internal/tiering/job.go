@@ -5,38 +5,84 @@ import (
 	"log/slog"
 	"strconv"
 	"time"
+
+	"github.com/joaovrmoraes/bataudit/internal/legalhold"
+	"github.com/joaovrmoraes/bataudit/internal/metrics"
+	"github.com/joaovrmoraes/bataudit/internal/partition"
 )
 
 // Job runs the data tiering aggregation.
 type Job struct {
-	repo        Repository
-	rawDays     int // aggregate raw events older than this many days
-	hourlyDays  int // aggregate hourly summaries older than this many days
+	repo       Repository
+	settings   Settings   // instance defaults; per-project policies override them
+	partitions Partitions // nil = raw events are removed with DELETE
+	archiver   Archiver   // nil = raw events are removed without a cold copy
+}
+
+// Partitions removes expired raw events by dropping whole audits partitions.
+// Implemented by partition.Manager.
+type Partitions interface {
+	Active(ctx context.Context) bool
+	// ExpiredBefore returns the end of the newest partition DropExpired would
+	// remove for cutoff, or the zero time if none.
+	ExpiredBefore(ctx context.Context, cutoff time.Time) (time.Time, error)
+	// DropExpired removes the partitions past cutoff. Only rows matching
+	// partition.Expirable and not under a legal hold go with them; the rest
+	// are moved to the default partition first.
+	DropExpired(ctx context.Context, cutoff time.Time) (int64, error)
+}
+
+// Archiver copies raw events to cold storage before they are removed. It
+// streams the events matching where and calls remove, when non-nil, with the
+// IDs of each batch once its archive file is verified. Implemented by
+// archive.Archiver.
+type Archiver interface {
+	Archive(ctx context.Context, where string, args []interface{}, remove func(ids []string) error) (int64, error)
 }
 
 func NewJob(repo Repository, rawDays, hourlyDays int) *Job {
-	return &Job{repo: repo, rawDays: rawDays, hourlyDays: hourlyDays}
+	return &Job{repo: repo, settings: Settings{RawDays: rawDays, HourlyDays: hourlyDays}}
 }
 
-// Run executes one full tiering cycle: raw→hourly, then hourly→daily.
+// Run executes one full tiering cycle: raw→hourly, then hourly→daily, with
+// each project's retention policies applied.
 func (j *Job) Run(ctx context.Context) {
 	slog.Info("tiering: starting aggregation cycle",
-		"raw_days", j.rawDays, "hourly_days", j.hourlyDays)
+		"raw_days", j.settings.RawDays, "hourly_days", j.settings.HourlyDays)
 
-	rawCutoff := time.Now().UTC().AddDate(0, 0, -j.rawDays)
-	n, err := j.repo.AggregateRawToHourly(rawCutoff)
+	// Without the policies the instance defaults could delete rows a project
+	// must keep, so skip the run rather than fall back.
+	policies, err := j.repo.ListPolicies("")
+	if err != nil {
+		slog.Error("tiering: loading retention policies failed, skipping run", "error", err)
+		return
+	}
+	plan := BuildPlan(policies, j.settings, time.Now())
+
+	start := time.Now()
+	n, err := j.aggregateRaw(ctx, plan)
+	observeStage("raw_to_hourly", start, n, err)
 	if err != nil {
 		slog.Error("tiering: raw→hourly aggregation failed", "error", err)
 	} else {
-		slog.Info("tiering: raw→hourly complete", "events_deleted", n)
+		slog.Info("tiering: raw→hourly complete", "events_deleted", n, "policies", len(policies))
 	}
 
 	if ctx.Err() != nil {
 		return
 	}
 
-	hourlyCutoff := time.Now().UTC().AddDate(0, 0, -j.hourlyDays)
-	n, err = j.repo.AggregateHourlyToDaily(hourlyCutoff)
+	start = time.Now()
+	n = 0
+	for _, sp := range plan.Scopes {
+		var deleted int64
+		deleted, err = j.repo.AggregateHourlyToDaily(sp.Scope, sp.HourlyCutoff)
+		n += deleted
+		if err != nil {
+			break
+		}
+	}
+	observeStage("hourly_to_daily", start, n, err)
 	if err != nil {
 		slog.Error("tiering: hourly→daily aggregation failed", "error", err)
 	} else {
@@ -44,32 +90,136 @@ func (j *Job) Run(ctx context.Context) {
 	}
 }
 
+// aggregateRaw summarizes expired raw events and removes them. Every scope is
+// summarized before anything is deleted. With partitioning active, partitions
+// past the oldest cutoff of any rule are dropped and only rules with a shorter
+// retention delete rows; rows under the longest retention stay until their
+// whole partition has expired. Summaries for already-aggregated hours are not
+// rewritten, so re-summarizing them on later runs is harmless.
+//
+// With an archiver, every row is copied to a verified archive file first and
+// rows are deleted by ID, so nothing is removed without a cold copy. A failed
+// archive stops the run before anything else is removed.
+//
+// Rows under a legal hold are summarized like any other, since summarizing
+// never removes them, but are neither archived nor removed until the hold
+// is released.
+func (j *Job) aggregateRaw(ctx context.Context, plan Plan) (int64, error) {
+	for _, sp := range plan.Scopes {
+		if _, err := j.repo.SummarizeRawToHourly(sp.Scope, sp.SummaryCutoff); err != nil {
+			return 0, err
+		}
+	}
+
+	partitioned := j.partitions != nil && j.partitions.Active(ctx)
+	var total int64
+	if partitioned {
+		n, err := j.dropPartitions(ctx, plan.DropCutoff)
+		if err != nil {
+			return 0, err
+		}
+		total += n
+	}
+
+	for _, sp := range plan.Scopes {
+		rules := sp.Rules
+		if partitioned {
+			rules = sp.withoutDroppable(plan.DropCutoff)
+		}
+		n, err := j.deleteRaw(ctx, sp.Scope, rules)
+		total += n
+		if err != nil {
+			return total, err
+		}
+	}
+	return total, nil
+}
+
+// dropPartitions archives the expirable unheld rows of the partitions about
+// to expire, then drops them. Events backfilled into those partitions while the archive is
+// being written are not covered.
+func (j *Job) dropPartitions(ctx context.Context, cutoff time.Time) (int64, error) {
+	if j.archiver != nil {
+		bound, err := j.partitions.ExpiredBefore(ctx, cutoff)
+		if err != nil {
+			return 0, err
+		}
+		if bound.IsZero() {
+			return 0, nil
+		}
+		// The rows DropExpired removes; others are archived when a rule
+		// deletes them.
+		where := "timestamp < ? AND " + partition.Expirable + " AND " + legalhold.NotHeld("audits")
+		if _, err := j.archiver.Archive(ctx, where, []interface{}{bound}, nil); err != nil {
+			return 0, err
+		}
+		cutoff = bound
+	}
+	return j.partitions.DropExpired(ctx, cutoff)
+}
+
+func (j *Job) deleteRaw(ctx context.Context, scope Scope, rules []RawRule) (int64, error) {
+	if j.archiver == nil {
+		return j.repo.DeleteRaw(scope, rules)
+	}
+	where, args, ok := expiredRawFilter(scope, rules)
+	if !ok {
+		return 0, nil
+	}
+	var deleted int64
+	_, err := j.archiver.Archive(ctx, where, args, func(ids []string) error {
+		n, err := j.repo.DeleteRawByID(ids)
+		deleted += n
+		return err
+	})
+	return deleted, err
+}
+
+func observeStage(stage string, start time.Time, rows int64, err error) {
+	status := "ok"
+	if err != nil {
+		status = "error"
+	}
+	metrics.TieringDuration.Observe(time.Since(start).Seconds(), stage, status)
+	metrics.TieringRows.Add(float64(rows), stage)
+}
+
 // Scheduler runs the tiering Job once per day at the configured hour (UTC).
 type Scheduler struct {
-	job  *Job
-	hour int // UTC hour to run (0-23)
+	job *Job
 }
 
 func NewScheduler(job *Job, runHour int) *Scheduler {
-	return &Scheduler{job: job, hour: runHour}
+	job.settings.RunHour = runHour // UTC hour to run (0-23)
+	return &Scheduler{job: job}
 }
 
-// NewSchedulerFromEnv creates a Scheduler reading TIERING_HOUR (default "2"),
-// TIERING_RAW_DAYS (default "30"), TIERING_HOURLY_DAYS (default "365").
-func NewSchedulerFromEnv(repo Repository, getEnv func(string, string) string) *Scheduler {
-	rawDays := parseIntEnv(getEnv("TIERING_RAW_DAYS", "30"), 30)
-	hourlyDays := parseIntEnv(getEnv("TIERING_HOURLY_DAYS", "365"), 365)
-	hour := parseIntEnv(getEnv("TIERING_HOUR", "2"), 2)
+// WithPartitions makes the job drop expired audits partitions instead of
+// deleting raw rows, once the table has been partitioned.
+func (s *Scheduler) WithPartitions(p Partitions) *Scheduler {
+	s.job.partitions = p
+	return s
+}
 
-	job := NewJob(repo, rawDays, hourlyDays)
-	return NewScheduler(job, hour)
+// WithArchiver makes the job copy raw events into verified archive files
+// before removing them.
+func (s *Scheduler) WithArchiver(a Archiver) *Scheduler {
+	s.job.archiver = a
+	return s
+}
+
+// NewSchedulerFromEnv creates a Scheduler from SettingsFromEnv.
+func NewSchedulerFromEnv(repo Repository, getEnv func(string, string) string) *Scheduler {
+	settings := SettingsFromEnv(getEnv)
+	job := NewJob(repo, settings.RawDays, settings.HourlyDays)
+	return NewScheduler(job, settings.RunHour)
 }
 
 // Start blocks until ctx is cancelled, running the job once per day at the
 // configured hour.
 func (s *Scheduler) Start(ctx context.Context) {
 	for {
-		next := s.nextRun()
+		next := s.job.settings.NextRun(time.Now())
 		slog.Info("tiering: next run scheduled", "at", next.Format(time.RFC3339))
 
 		select {
@@ -81,15 +231,6 @@ func (s *Scheduler) Start(ctx context.Context) {
 	}
 }
 
-func (s *Scheduler) nextRun() time.Time {
-	now := time.Now().UTC()
-	candidate := time.Date(now.Year(), now.Month(), now.Day(), s.hour, 0, 0, 0, time.UTC)
-	if !candidate.After(now) {
-		candidate = candidate.Add(24 * time.Hour)
-	}
-	return candidate
-}
-
 func parseIntEnv(v string, defaultVal int) int {
 	if n, err := strconv.Atoi(v); err == nil && n > 0 {
 		return n
@@ -28,6 +28,25 @@ type AuditSummary struct {
 
 func (AuditSummary) TableName() string { return "audit_summaries" }
 
+// LatencySketch is the latency histogram of one route over a period, stored
+// in audit_latency_sketches. Buckets is latency.Sketch.EncodeCounts.
+type LatencySketch struct {
+	ID          string     `gorm:"primaryKey"`
+	PeriodStart time.Time  `gorm:"column:period_start"`
+	PeriodType  PeriodType `gorm:"column:period_type"`
+	ProjectID   string     `gorm:"column:project_id"`
+	ServiceName string     `gorm:"column:service_name"`
+	Method      string     `gorm:"column:method"`
+	Path        string     `gorm:"column:path"`
+	EventCount  int64      `gorm:"column:event_count"`
+	SumMs       int64      `gorm:"column:sum_ms"`
+	MaxMs       int64      `gorm:"column:max_ms"`
+	Buckets     string     `gorm:"column:buckets"`
+	CreatedAt   time.Time  `gorm:"column:created_at"`
+}
+
+func (LatencySketch) TableName() string { return "audit_latency_sketches" }
+
 // HistoryPoint is a single item returned by the history API.
 type HistoryPoint struct {
 	PeriodStart time.Time  `json:"period_start"`
@@ -45,3 +64,23 @@ type UsageStat struct {
 	HourlySummaries int64 `json:"hourly_summaries"`
 	DailySummaries  int64 `json:"daily_summaries"`
 }
+
+// RuleImpact is one resolved retention rule and how many raw events it would
+// remove on the next run.
+type RuleImpact struct {
+	RawRule
+	RawEvents int64 `json:"raw_events"`
+}
+
+// RetentionPreview is what the next tiering run would do to one project.
+type RetentionPreview struct {
+	ProjectID     string       `json:"project_id"`
+	RunAt         time.Time    `json:"run_at"`
+	Rules         []RuleImpact `json:"rules"` // precedence order
+	SummaryCutoff time.Time    `json:"summary_cutoff"`
+	HourlyCutoff  time.Time    `json:"hourly_cutoff"`
+	// RawEvents past their cutoff. With partitioning, rows under the longest
+	// retention go when their partition is dropped, up to one interval later.
+	RawEvents       int64 `json:"raw_events"`
+	HourlySummaries int64 `json:"hourly_summaries"`
+}
@@ -0,0 +1,194 @@
+package tiering
+
+import (
+	"sort"
+	"time"
+)
+
+// httpEventType is the event type tiering aggregates into summaries. Policies
+// that don't name an event type apply to it.
+const httpEventType = "http"
+
+// RetentionPolicy overrides the instance-wide retention for a project,
+// optionally narrowed to one environment and/or event type.
+//
+// Policies without an event type cover HTTP traffic. Other event types
+// (system.alert, custom types) are kept until a policy names them.
+type RetentionPolicy struct {
+	ID          string    `json:"id"           gorm:"primaryKey"`
+	ProjectID   string    `json:"project_id"`
+	Environment string    `json:"environment"` // "" = every environment
+	EventType   string    `json:"event_type"`  // "" = HTTP traffic
+	RawDays     int       `json:"raw_days"`
+	HourlyDays  *int      `json:"hourly_days,omitempty"` // project-wide policies only; nil = instance default
+	CreatedAt   time.Time `json:"created_at"`
+	UpdatedAt   time.Time `json:"updated_at"`
+}
+
+func (RetentionPolicy) TableName() string { return "retention_policies" }
+
+// specificity orders policies for precedence: environment+type, then
+// environment, then type, then project-wide.
+func (p RetentionPolicy) specificity() int {
+	n := 0
+	if p.Environment != "" {
+		n += 2
+	}
+	if p.EventType != "" {
+		n++
+	}
+	return n
+}
+
+// Settings are the instance-wide tiering defaults.
+type Settings struct {
+	RawDays    int `json:"raw_days"`
+	HourlyDays int `json:"hourly_days"`
+	RunHour    int `json:"run_hour"` // UTC
+}
+
+// SettingsFromEnv reads TIERING_RAW_DAYS (default 30), TIERING_HOURLY_DAYS
+// (default 365) and TIERING_HOUR (default 2).
+func SettingsFromEnv(getEnv func(string, string) string) Settings {
+	return Settings{
+		RawDays:    parseIntEnv(getEnv("TIERING_RAW_DAYS", "30"), 30),
+		HourlyDays: parseIntEnv(getEnv("TIERING_HOURLY_DAYS", "365"), 365),
+		RunHour:    parseIntEnv(getEnv("TIERING_HOUR", "2"), 2),
+	}
+}
+
+// NextRun returns the next time the nightly job runs after now.
+func (s Settings) NextRun(now time.Time) time.Time {
+	now = now.UTC()
+	candidate := time.Date(now.Year(), now.Month(), now.Day(), s.RunHour, 0, 0, 0, time.UTC)
+	if !candidate.After(now) {
+		candidate = candidate.Add(24 * time.Hour)
+	}
+	return candidate
+}
+
+// RawRule removes raw events matching Environment ("" = any) and EventType
+// that are older than Cutoff. A zero Cutoff keeps matching rows; it still
+// takes precedence over less specific rules.
+type RawRule struct {
+	Environment string    `json:"environment"`
+	EventType   string    `json:"event_type"`
+	RawDays     int       `json:"raw_days"`
+	Cutoff      time.Time `json:"cutoff"`
+}
+
+// Scope selects the projects a tiering query runs on: one project, or every
+// project except those listed.
+type Scope struct {
+	ProjectID string
+	Exclude   []string
+}
+
+// ScopePlan is the resolved retention for one scope.
+type ScopePlan struct {
+	Scope Scope
+	// Rules in precedence order; the first matching rule decides a row's cutoff.
+	Rules []RawRule
+	// SummaryCutoff is the newest HTTP cutoff: hours before it are summarized
+	// while all their rows still exist, before any of them is deleted.
+	SummaryCutoff time.Time
+	HourlyCutoff  time.Time
+}
+
+// Plan is everything one tiering run does.
+type Plan struct {
+	Scopes []ScopePlan // projects with policies first, then everyone else
+	// DropCutoff is the oldest HTTP raw cutoff of any rule: partitions ending
+	// before it hold no HTTP event of a project that a rule still retains.
+	// Other rows are not dropped with their partition (see Partitions).
+	DropCutoff time.Time
+}
+
+// hourCutoff is now minus days, aligned to the hour so a bucket is never
+// summarized while part of it is still raw.
+func hourCutoff(now time.Time, days int) time.Time {
+	return now.UTC().AddDate(0, 0, -days).Truncate(time.Hour)
+}
+
+// BuildPlan resolves policies against the instance defaults as of now.
+func BuildPlan(policies []RetentionPolicy, s Settings, now time.Time) Plan {
+	byProject := make(map[string][]RetentionPolicy)
+	for _, p := range policies {
+		byProject[p.ProjectID] = append(byProject[p.ProjectID], p)
+	}
+	projects := make([]string, 0, len(byProject))
+	for id := range byProject {
+		projects = append(projects, id)
+	}
+	sort.Strings(projects)
+
+	defaultRule := RawRule{EventType: httpEventType, RawDays: s.RawDays, Cutoff: hourCutoff(now, s.RawDays)}
+	plan := Plan{DropCutoff: defaultRule.Cutoff}
+
+	for _, id := range projects {
+		sp := buildScopePlan(Scope{ProjectID: id}, byProject[id], s, now)
+		for _, r := range sp.Rules {
+			if r.EventType == httpEventType && !r.Cutoff.IsZero() && r.Cutoff.Before(plan.DropCutoff) {
+				plan.DropCutoff = r.Cutoff
+			}
+		}
+		plan.Scopes = append(plan.Scopes, sp)
+	}
+
+	plan.Scopes = append(plan.Scopes, ScopePlan{
+		Scope:         Scope{Exclude: projects},
+		Rules:         []RawRule{defaultRule},
+		SummaryCutoff: defaultRule.Cutoff,
+		HourlyCutoff:  hourCutoff(now, s.HourlyDays),
+	})
+	return plan
+}
+
+func buildScopePlan(scope Scope, policies []RetentionPolicy, s Settings, now time.Time) ScopePlan {
+	sorted := append([]RetentionPolicy(nil), policies...)
+	sort.SliceStable(sorted, func(i, j int) bool { return sorted[i].specificity() > sorted[j].specificity() })
+
+	sp := ScopePlan{Scope: scope, HourlyCutoff: hourCutoff(now, s.HourlyDays)}
+	hasProjectDefault := false
+	for _, p := range sorted {
+		eventType := p.EventType
+		if eventType == "" {
+			eventType = httpEventType
+		}
+		rule := RawRule{Environment: p.Environment, EventType: eventType, RawDays: p.RawDays, Cutoff: hourCutoff(now, p.RawDays)}
+		sp.Rules = append(sp.Rules, rule)
+
+		if p.Environment == "" && p.EventType == "" {
+			hasProjectDefault = true
+			if p.HourlyDays != nil {
+				sp.HourlyCutoff = hourCutoff(now, *p.HourlyDays)
+			}
+		}
+	}
+	if !hasProjectDefault {
+		sp.Rules = append(sp.Rules, RawRule{EventType: httpEventType, RawDays: s.RawDays, Cutoff: hourCutoff(now, s.RawDays)})
+	}
+
+	for _, r := range sp.Rules {
+		if r.EventType == httpEventType && r.Cutoff.After(sp.SummaryCutoff) {
+			sp.SummaryCutoff = r.Cutoff
+		}
+	}
+	return sp
+}
+
+// withoutDroppable returns the rules with every HTTP cutoff at or before the
+// drop cutoff cleared: with partitioning, those rows go when their partition
+// is dropped, so deleting them row by row would only defeat the purpose.
+// Rules for other event types keep their cutoff, as partition drops leave
+// those rows alone.
+func (sp ScopePlan) withoutDroppable(dropCutoff time.Time) []RawRule {
+	rules := make([]RawRule, len(sp.Rules))
+	for i, r := range sp.Rules {
+		if r.EventType == httpEventType && !r.Cutoff.After(dropCutoff) {
+			r.Cutoff = time.Time{}
+		}
+		rules[i] = r
+	}
+	return rules
+}
@@ -0,0 +1,128 @@
+package tiering
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var (
+	testNow      = time.Date(2026, 10, 19, 2, 30, 0, 0, time.UTC)
+	testSettings = Settings{RawDays: 30, HourlyDays: 365, RunHour: 2}
+)
+
+func days(n int) *int { return &n }
+
+func TestBuildPlan_noPolicies(t *testing.T) {
+	plan := BuildPlan(nil, testSettings, testNow)
+
+	require.Len(t, plan.Scopes, 1)
+	sp := plan.Scopes[0]
+	assert.Empty(t, sp.Scope.ProjectID)
+	assert.Empty(t, sp.Scope.Exclude)
+	assert.Equal(t, []RawRule{{EventType: "http", RawDays: 30, Cutoff: time.Date(2026, 9, 19, 2, 0, 0, 0, time.UTC)}}, sp.Rules)
+	assert.Equal(t, sp.Rules[0].Cutoff, sp.SummaryCutoff)
+	assert.Equal(t, time.Date(2025, 10, 19, 2, 0, 0, 0, time.UTC), sp.HourlyCutoff)
+	assert.Equal(t, sp.Rules[0].Cutoff, plan.DropCutoff)
+}
+
+func TestBuildPlan_precedence(t *testing.T) {
+	policies := []RetentionPolicy{
+		{ProjectID: "p1", RawDays: 2555, HourlyDays: days(3650)},
+		{ProjectID: "p1", EventType: "system.alert", RawDays: 4000},
+		{ProjectID: "p1", Environment: "dev", RawDays: 3},
+		{ProjectID: "p1", Environment: "dev", EventType: "system.alert", RawDays: 7},
+	}
+
+	plan := BuildPlan(policies, testSettings, testNow)
+
+	require.Len(t, plan.Scopes, 2)
+	sp := plan.Scopes[0]
+	assert.Equal(t, Scope{ProjectID: "p1"}, sp.Scope)
+	require.Len(t, sp.Rules, 4, "a project-wide policy replaces the instance default")
+	assert.Equal(t, RawRule{Environment: "dev", EventType: "system.alert", RawDays: 7, Cutoff: hourCutoff(testNow, 7)}, sp.Rules[0])
+	assert.Equal(t, RawRule{Environment: "dev", EventType: "http", RawDays: 3, Cutoff: hourCutoff(testNow, 3)}, sp.Rules[1])
+	assert.Equal(t, RawRule{EventType: "system.alert", RawDays: 4000, Cutoff: hourCutoff(testNow, 4000)}, sp.Rules[2])
+	assert.Equal(t, RawRule{EventType: "http", RawDays: 2555, Cutoff: hourCutoff(testNow, 2555)}, sp.Rules[3])
+
+	assert.Equal(t, hourCutoff(testNow, 3), sp.SummaryCutoff, "summaries follow the shortest HTTP retention")
+	assert.Equal(t, hourCutoff(testNow, 3650), sp.HourlyCutoff)
+	assert.Equal(t, hourCutoff(testNow, 2555), plan.DropCutoff, "partitions follow the longest HTTP retention")
+
+	rest := plan.Scopes[1]
+	assert.Equal(t, Scope{Exclude: []string{"p1"}}, rest.Scope)
+	assert.Equal(t, hourCutoff(testNow, 365), rest.HourlyCutoff)
+}
+
+func TestBuildPlan_scopedPoliciesFallBackToDefault(t *testing.T) {
+	plan := BuildPlan([]RetentionPolicy{{ProjectID: "p1", Environment: "dev", RawDays: 3}}, testSettings, testNow)
+
+	sp := plan.Scopes[0]
+	require.Len(t, sp.Rules, 2)
+	assert.Equal(t, "dev", sp.Rules[0].Environment)
+	assert.Equal(t, RawRule{EventType: "http", RawDays: 30, Cutoff: hourCutoff(testNow, 30)}, sp.Rules[1])
+	assert.Equal(t, hourCutoff(testNow, 365), sp.HourlyCutoff)
+}
+
+func TestScopePlan_withoutDroppable(t *testing.T) {
+	plan := BuildPlan([]RetentionPolicy{
+		{ProjectID: "p1", Environment: "dev", RawDays: 3},
+		{ProjectID: "p1", RawDays: 90},
+	}, testSettings, testNow)
+
+	rules := plan.Scopes[0].withoutDroppable(plan.DropCutoff)
+	assert.Equal(t, hourCutoff(testNow, 3), rules[0].Cutoff, "shorter retention is still deleted row by row")
+	assert.True(t, rules[1].Cutoff.IsZero(), "the longest retention is left to partition drops")
+
+	rest := plan.Scopes[1].withoutDroppable(plan.DropCutoff)
+	assert.False(t, rest[0].Cutoff.IsZero(), "30 days is shorter than the 90 day drop cutoff")
+	assert.False(t, plan.Scopes[0].Rules[1].Cutoff.IsZero(), "the plan itself is not modified")
+}
+
+func TestScopePlan_withoutDroppableKeepsOtherTypes(t *testing.T) {
+	plan := BuildPlan([]RetentionPolicy{
+		{ProjectID: "p1", EventType: "system.alert", RawDays: 10},
+		{ProjectID: "p1", RawDays: 90},
+	}, testSettings, testNow)
+
+	assert.Equal(t, hourCutoff(testNow, 90), plan.DropCutoff, "other event types do not move the drop cutoff")
+	rules := plan.Scopes[0].withoutDroppable(hourCutoff(testNow, 5))
+	assert.Equal(t, hourCutoff(testNow, 10), rules[0].Cutoff, "alerts are not dropped with partitions, so rules delete them")
+	assert.True(t, rules[1].Cutoff.IsZero())
+}
+
+func TestCutoffExpr(t *testing.T) {
+	cutoff := hourCutoff(testNow, 3)
+	expr, args, newest, ok := cutoffExpr([]RawRule{
+		{Environment: "prod", EventType: "http"},
+		{EventType: "http", Cutoff: cutoff},
+	})
+
+	assert.True(t, ok)
+	assert.Equal(t, cutoff, newest)
+	assert.Equal(t, "CASE WHEN event_type = ? AND environment = ? THEN FALSE WHEN event_type = ? THEN timestamp < ? END", expr)
+	assert.Equal(t, []interface{}{"http", "prod", "http", cutoff}, args)
+
+	_, _, _, ok = cutoffExpr([]RawRule{{EventType: "http"}})
+	assert.False(t, ok, "nothing to delete when every rule keeps its rows")
+}
+
+func TestSettings_NextRun(t *testing.T) {
+	s := Settings{RunHour: 2}
+	assert.Equal(t, time.Date(2026, 10, 20, 2, 0, 0, 0, time.UTC), s.NextRun(testNow))
+	assert.Equal(t, time.Date(2026, 10, 19, 2, 0, 0, 0, time.UTC), s.NextRun(testNow.Add(-time.Hour)))
+}
+
+func TestPolicyRequest_toPolicy(t *testing.T) {
+	p, err := policyRequest{ProjectID: "p1", EventType: "http", RawDays: 3}.toPolicy()
+	require.NoError(t, err)
+	assert.Empty(t, p.EventType, "http is stored as the default event type")
+
+	_, err = policyRequest{ProjectID: "p1", Environment: "dev", RawDays: 3, HourlyDays: days(30)}.toPolicy()
+	assert.Error(t, err)
+
+	_, err = policyRequest{ProjectID: "p1", RawDays: 0}.toPolicy()
+	assert.Error(t, err)
+}
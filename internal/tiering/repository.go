@@ -1,19 +1,58 @@
 package tiering
 
 import (
+	"errors"
+	"strconv"
+	"strings"
 	"time"
 
+	"github.com/google/uuid"
+	"github.com/joaovrmoraes/bataudit/internal/audit"
+	"github.com/joaovrmoraes/bataudit/internal/dialect"
+	"github.com/joaovrmoraes/bataudit/internal/latency"
+	"github.com/joaovrmoraes/bataudit/internal/legalhold"
 	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
 )
 
 type Repository interface {
-	// AggregateRawToHourly aggregates raw events older than cutoff into hourly
-	// summaries and deletes the source rows. Returns count of events processed.
-	AggregateRawToHourly(cutoff time.Time) (int64, error)
+	// SummarizeRawToHourly writes hourly summaries, and latency sketches per
+	// route, for raw HTTP events in scope older than cutoff, skipping
+	// already-aggregated buckets. Source rows are left in place. Returns count
+	// of summaries written.
+	SummarizeRawToHourly(scope Scope, cutoff time.Time) (int64, error)
 
-	// AggregateHourlyToDaily aggregates hourly summaries older than cutoff into
-	// daily summaries and deletes the source hourly rows.
-	AggregateHourlyToDaily(cutoff time.Time) (int64, error)
+	// DeleteRaw deletes raw events in scope that are older than the cutoff of
+	// the first rule they match. Rows matching no rule, or under a legal
+	// hold, are kept. Removed hash chain links are recorded as checkpoints.
+	DeleteRaw(scope Scope, rules []RawRule) (int64, error)
+
+	// DeleteRawByID deletes the given raw events, once they have been archived,
+	// except those placed under a legal hold since.
+	DeleteRawByID(ids []string) (int64, error)
+
+	// AggregateHourlyToDaily aggregates hourly summaries and latency sketches
+	// in scope older than cutoff into daily ones and deletes the source
+	// hourly rows.
+	AggregateHourlyToDaily(scope Scope, cutoff time.Time) (int64, error)
+
+	// CountExpiredRaw returns, per rule, how many raw events in scope are older
+	// than that rule's cutoff, match no earlier rule and are not held.
+	CountExpiredRaw(scope Scope, rules []RawRule) ([]int64, error)
+
+	// CountExpiredHourly returns how many hourly summaries in scope are older
+	// than cutoff.
+	CountExpiredHourly(scope Scope, cutoff time.Time) (int64, error)
+
+	// ListPolicies returns a project's retention policies, or every project's
+	// when projectID is empty.
+	ListPolicies(projectID string) ([]RetentionPolicy, error)
+
+	// SavePolicy creates the policy or replaces the one with the same project,
+	// environment and event type.
+	SavePolicy(p *RetentionPolicy) error
+
+	DeletePolicy(id, projectID string) error
 
 	// GetHistory returns merged time-series data for a project spanning both raw
 	// events and pre-aggregated summaries.
@@ -23,6 +62,12 @@ type Repository interface {
 	GetUsage(projectID string) (UsageStat, error)
 }
 
+// deleteBatchSize bounds the IN list of one DeleteRawByID statement.
+const deleteBatchSize = 1000
+
+// sketchBatchSize bounds the rows of one latency sketch INSERT.
+const sketchBatchSize = 500
+
 type repository struct {
 	db *gorm.DB
 }
@@ -31,7 +76,50 @@ func NewRepository(db *gorm.DB) Repository {
 	return &repository{db: db}
 }
 
-func (r *repository) AggregateRawToHourly(cutoff time.Time) (int64, error) {
+// scopeFilter returns the WHERE fragment restricting a query to scope.
+func scopeFilter(scope Scope) (string, []interface{}) {
+	if scope.ProjectID != "" {
+		return "project_id = ?", []interface{}{scope.ProjectID}
+	}
+	if len(scope.Exclude) > 0 {
+		return "project_id NOT IN ?", []interface{}{scope.Exclude}
+	}
+	return "TRUE", nil
+}
+
+// cutoffExpr builds a CASE condition true when a row is older than the cutoff
+// of the first rule it matches, and false or NULL (keep) otherwise. The
+// cutoff is compared inside the CASE, so its type follows the column on
+// every dialect. newest is the newest cutoff of any rule, usable as an
+// index-friendly upper bound; ok is false when no rule deletes anything.
+func cutoffExpr(rules []RawRule) (expr string, args []interface{}, newest time.Time, ok bool) {
+	var b strings.Builder
+	b.WriteString("CASE")
+	for _, rule := range rules {
+		b.WriteString(" WHEN event_type = ?")
+		args = append(args, rule.EventType)
+		if rule.Environment != "" {
+			b.WriteString(" AND environment = ?")
+			args = append(args, rule.Environment)
+		}
+		if rule.Cutoff.IsZero() {
+			b.WriteString(" THEN FALSE")
+			continue
+		}
+		b.WriteString(" THEN timestamp < ?")
+		args = append(args, rule.Cutoff)
+		if rule.Cutoff.After(newest) {
+			newest = rule.Cutoff
+		}
+		ok = true
+	}
+	b.WriteString(" END")
+	return b.String(), args, newest, ok
+}
+
+func (r *repository) SummarizeRawToHourly(scope Scope, cutoff time.Time) (int64, error) {
+	d := dialect.Of(r.db)
+	filter, args := scopeFilter(scope)
 	// Insert hourly summaries from raw events, skipping already-aggregated buckets.
 	ins := r.db.Exec(`
 		INSERT INTO audit_summaries
@@ -39,7 +127,7 @@ func (r *repository) AggregateRawToHourly(cutoff time.Time) (int64, error) {
 			 status_2xx, status_3xx, status_4xx, status_5xx,
 			 avg_ms, p95_ms, event_count)
 		SELECT
-			date_trunc('hour', timestamp)                                                          AS period_start,
+			`+d.Trunc("hour", "timestamp")+`                                                          AS period_start,
 			'hour'                                                                                 AS period_type,
 			project_id,
 			service_name,
@@ -48,39 +136,201 @@ func (r *repository) AggregateRawToHourly(cutoff time.Time) (int64, error) {
 			COUNT(*) FILTER (WHERE status_code >= 400 AND status_code < 500)                      AS status_4xx,
 			COUNT(*) FILTER (WHERE status_code >= 500)                                            AS status_5xx,
 			COALESCE(AVG(response_time), 0)                                                       AS avg_ms,
-			COALESCE(percentile_cont(0.95) WITHIN GROUP (ORDER BY response_time), 0)              AS p95_ms,
+			COALESCE(`+d.Percentile(0.95, "response_time")+`, 0)              AS p95_ms,
 			COUNT(*)                                                                               AS event_count
 		FROM audits
-		WHERE timestamp < ?
+		WHERE `+filter+`
+		  AND timestamp < ?
 		  AND event_type = 'http'
 		  AND project_id IS NOT NULL
 		  AND project_id != ''
-		GROUP BY date_trunc('hour', timestamp), project_id, service_name
+		GROUP BY `+d.Trunc("hour", "timestamp")+`, project_id, service_name
 		ON CONFLICT (period_start, period_type, project_id, service_name) DO NOTHING
-	`, cutoff)
+	`, append(args, cutoff)...)
 	if ins.Error != nil {
 		return 0, ins.Error
 	}
+	return ins.RowsAffected, r.sketchRawToHourly(scope, cutoff)
+}
 
-	// Delete the raw events that were just aggregated.
-	del := r.db.Exec(`
-		DELETE FROM audits
-		WHERE timestamp < ?
+// sketchRawToHourly writes the hourly latency sketch of every route for raw
+// HTTP events in scope older than cutoff. Hours already sketched, on their
+// own or folded into their day, are skipped.
+func (r *repository) sketchRawToHourly(scope Scope, cutoff time.Time) error {
+	d := dialect.Of(r.db)
+	filter, args := scopeFilter(scope)
+	var rows []struct {
+		PeriodStart dialect.Time `gorm:"column:period_start"`
+		ProjectID   string       `gorm:"column:project_id"`
+		ServiceName string       `gorm:"column:service_name"`
+		Method      string       `gorm:"column:method"`
+		Path        string       `gorm:"column:path"`
+		Bucket      int          `gorm:"column:bucket"`
+		Count       int64        `gorm:"column:event_count"`
+		SumMs       int64        `gorm:"column:sum_ms"`
+		MaxMs       int64        `gorm:"column:max_ms"`
+	}
+	err := r.db.Raw(`
+		SELECT
+			`+d.Trunc("hour", "timestamp")+` AS period_start,
+			project_id,
+			service_name,
+			method,
+			path,
+			`+latency.IndexExpr("response_time")+` AS bucket,
+			COUNT(*)           AS event_count,
+			SUM(response_time) AS sum_ms,
+			MAX(response_time) AS max_ms
+		FROM audits
+		WHERE `+filter+`
+		  AND timestamp < ?
 		  AND event_type = 'http'
 		  AND project_id IS NOT NULL
 		  AND project_id != ''
-	`, cutoff)
-	return del.RowsAffected, del.Error
+		  AND NOT EXISTS (
+			SELECT 1 FROM audit_latency_sketches s
+			WHERE s.project_id = audits.project_id
+			  AND ((s.period_type = 'hour' AND s.period_start = `+d.Trunc("hour", "audits.timestamp")+`)
+			    OR (s.period_type = 'day' AND s.period_start = `+d.Trunc("day", "audits.timestamp")+`))
+		  )
+		GROUP BY 1, 2, 3, 4, 5, 6
+		ORDER BY 1, 2, 3, 4, 5
+	`, append(args, cutoff)...).Scan(&rows).Error
+	if err != nil {
+		return err
+	}
+
+	var sketches []LatencySketch
+	var current *latency.Sketch
+	for i, row := range rows {
+		if i == 0 || !row.PeriodStart.Equal(rows[i-1].PeriodStart.Time) || row.ProjectID != rows[i-1].ProjectID ||
+			row.ServiceName != rows[i-1].ServiceName || row.Method != rows[i-1].Method || row.Path != rows[i-1].Path {
+			current = latency.New()
+			sketches = append(sketches, LatencySketch{
+				PeriodStart: row.PeriodStart.UTC(),
+				PeriodType:  PeriodHour,
+				ProjectID:   row.ProjectID,
+				ServiceName: row.ServiceName,
+				Method:      row.Method,
+				Path:        row.Path,
+			})
+		}
+		current.AddBucket(row.Bucket, row.Count, row.SumMs, row.MaxMs)
+		setSketch(&sketches[len(sketches)-1], current)
+	}
+	if len(sketches) == 0 {
+		return nil
+	}
+	return r.db.Clauses(clause.OnConflict{DoNothing: true}).CreateInBatches(sketches, sketchBatchSize).Error
+}
+
+// setSketch stores s into row, giving it an ID if it has none.
+func setSketch(row *LatencySketch, s *latency.Sketch) {
+	if row.ID == "" {
+		row.ID = uuid.New().String()
+	}
+	row.EventCount, row.SumMs, row.MaxMs = s.Count, s.SumMs, s.MaxMs
+	row.Buckets = s.EncodeCounts()
+	row.CreatedAt = time.Now().UTC()
+}
+
+// expiredRawFilter returns the condition matching raw events in scope that
+// are past their rule's cutoff and not under a legal hold; ok is false when
+// no rule deletes anything.
+func expiredRawFilter(scope Scope, rules []RawRule) (where string, args []interface{}, ok bool) {
+	expr, exprArgs, newest, ok := cutoffExpr(rules)
+	if !ok {
+		return "", nil, false
+	}
+	filter, args := scopeFilter(scope)
+	args = append(args, newest)
+	args = append(args, exprArgs...)
+	return filter + `
+		  AND timestamp < ?
+		  AND ` + expr + `
+		  AND project_id IS NOT NULL
+		  AND project_id != ''
+		  AND ` + legalhold.NotHeld("audits"), args, true
+}
+
+func (r *repository) DeleteRaw(scope Scope, rules []RawRule) (int64, error) {
+	where, args, ok := expiredRawFilter(scope, rules)
+	if !ok {
+		return 0, nil
+	}
+	return audit.DeleteWithCheckpoints(r.db, where, args, audit.CheckpointTiering)
 }
 
-func (r *repository) AggregateHourlyToDaily(cutoff time.Time) (int64, error) {
+func (r *repository) DeleteRawByID(ids []string) (int64, error) {
+	var total int64
+	for start := 0; start < len(ids); start += deleteBatchSize {
+		end := min(start+deleteBatchSize, len(ids))
+		n, err := audit.DeleteWithCheckpoints(r.db, "id IN ? AND "+legalhold.NotHeld("audits"),
+			[]interface{}{ids[start:end]}, audit.CheckpointArchived)
+		if err != nil {
+			return total, err
+		}
+		total += n
+	}
+	return total, nil
+}
+
+func (r *repository) CountExpiredRaw(scope Scope, rules []RawRule) ([]int64, error) {
+	counts := make([]int64, len(rules))
+	where, filterArgs, ok := expiredRawFilter(scope, rules)
+	if !ok {
+		return counts, nil
+	}
+
+	// Same CASE, but yielding the index of the matching rule.
+	var which strings.Builder
+	var whichArgs []interface{}
+	which.WriteString("CASE")
+	for i, rule := range rules {
+		which.WriteString(" WHEN event_type = ?")
+		whichArgs = append(whichArgs, rule.EventType)
+		if rule.Environment != "" {
+			which.WriteString(" AND environment = ?")
+			whichArgs = append(whichArgs, rule.Environment)
+		}
+		which.WriteString(" THEN " + strconv.Itoa(i))
+	}
+	which.WriteString(" END")
+
+	args := append(whichArgs, filterArgs...)
+
+	var rows []struct {
+		Rule  int   `gorm:"column:rule"`
+		Count int64 `gorm:"column:count"`
+	}
+	err := r.db.Raw(`
+		SELECT `+which.String()+` AS rule, COUNT(*) AS count
+		FROM audits
+		WHERE `+where+`
+		GROUP BY 1
+	`, args...).Scan(&rows).Error
+	if err != nil {
+		return nil, err
+	}
+	for _, row := range rows {
+		if row.Rule >= 0 && row.Rule < len(counts) {
+			counts[row.Rule] = row.Count
+		}
+	}
+	return counts, nil
+}
+
+func (r *repository) AggregateHourlyToDaily(scope Scope, cutoff time.Time) (int64, error) {
+	d := dialect.Of(r.db)
+	filter, args := scopeFilter(scope)
+	args = append(args, cutoff)
 	ins := r.db.Exec(`
 		INSERT INTO audit_summaries
 			(period_start, period_type, project_id, service_name,
 			 status_2xx, status_3xx, status_4xx, status_5xx,
 			 avg_ms, p95_ms, event_count)
 		SELECT
-			date_trunc('day', period_start)           AS period_start,
+			`+d.Trunc("day", "period_start")+`           AS period_start,
 			'day'                                     AS period_type,
 			project_id,
 			service_name,
@@ -92,21 +342,155 @@ func (r *repository) AggregateHourlyToDaily(cutoff time.Time) (int64, error) {
 			MAX(p95_ms)                               AS p95_ms,
 			SUM(event_count)                          AS event_count
 		FROM audit_summaries
-		WHERE period_type = 'hour'
+		WHERE `+filter+`
+		  AND period_type = 'hour'
 		  AND period_start < ?
-		GROUP BY date_trunc('day', period_start), project_id, service_name
+		GROUP BY `+d.Trunc("day", "period_start")+`, project_id, service_name
 		ON CONFLICT (period_start, period_type, project_id, service_name) DO NOTHING
-	`, cutoff)
+	`, args...)
 	if ins.Error != nil {
 		return 0, ins.Error
 	}
 
 	del := r.db.Exec(`
 		DELETE FROM audit_summaries
-		WHERE period_type = 'hour'
+		WHERE `+filter+`
+		  AND period_type = 'hour'
 		  AND period_start < ?
-	`, cutoff)
-	return del.RowsAffected, del.Error
+	`, args...)
+	if del.Error != nil {
+		return 0, del.Error
+	}
+	return del.RowsAffected, r.foldSketchesToDaily(scope, cutoff)
+}
+
+// foldSketchesToDaily merges the hourly latency sketches in scope older than
+// cutoff into their day's sketch and deletes them. The cutoff falls on any
+// hour, so a day folded in part on one run gets its later hours merged in on
+// the next.
+func (r *repository) foldSketchesToDaily(scope Scope, cutoff time.Time) error {
+	filter, args := scopeFilter(scope)
+	return r.db.Transaction(func(tx *gorm.DB) error {
+		var hourly []LatencySketch
+		err := tx.Where(filter, args...).
+			Where("period_type = ? AND period_start < ?", PeriodHour, cutoff).
+			Order("period_start").
+			Find(&hourly).Error
+		if err != nil || len(hourly) == 0 {
+			return err
+		}
+
+		type key struct {
+			day                                  time.Time
+			projectID, serviceName, method, path string
+		}
+		days := map[key]*latency.Sketch{}
+		var order []key
+		for _, h := range hourly {
+			s, err := latency.Decode(h.Buckets, h.EventCount, h.SumMs, h.MaxMs)
+			if err != nil {
+				return err
+			}
+			start := h.PeriodStart.UTC()
+			k := key{time.Date(start.Year(), start.Month(), start.Day(), 0, 0, 0, 0, time.UTC), h.ProjectID, h.ServiceName, h.Method, h.Path}
+			if days[k] == nil {
+				days[k] = latency.New()
+				order = append(order, k)
+			}
+			days[k].Merge(s)
+		}
+
+		for _, k := range order {
+			var day LatencySketch
+			found := tx.Where("period_type = ? AND period_start = ? AND project_id = ? AND service_name = ? AND method = ? AND path = ?",
+				PeriodDay, k.day, k.projectID, k.serviceName, k.method, k.path).Limit(1).Find(&day)
+			if found.Error != nil {
+				return found.Error
+			}
+			if found.RowsAffected == 0 {
+				day = LatencySketch{PeriodStart: k.day, PeriodType: PeriodDay, ProjectID: k.projectID,
+					ServiceName: k.serviceName, Method: k.method, Path: k.path}
+				setSketch(&day, days[k])
+				if err := tx.Create(&day).Error; err != nil {
+					return err
+				}
+				continue
+			}
+
+			existing, err := latency.Decode(day.Buckets, day.EventCount, day.SumMs, day.MaxMs)
+			if err != nil {
+				return err
+			}
+			days[k].Merge(existing)
+			setSketch(&day, days[k])
+			if err := tx.Model(&LatencySketch{}).Where("id = ?", day.ID).Updates(map[string]any{
+				"event_count": day.EventCount,
+				"sum_ms":      day.SumMs,
+				"max_ms":      day.MaxMs,
+				"buckets":     day.Buckets,
+			}).Error; err != nil {
+				return err
+			}
+		}
+
+		return tx.Where(filter, args...).
+			Where("period_type = ? AND period_start < ?", PeriodHour, cutoff).
+			Delete(&LatencySketch{}).Error
+	})
+}
+
+func (r *repository) CountExpiredHourly(scope Scope, cutoff time.Time) (int64, error) {
+	filter, args := scopeFilter(scope)
+	var n int64
+	err := r.db.Raw(`
+		SELECT COUNT(*) FROM audit_summaries
+		WHERE `+filter+`
+		  AND period_type = 'hour'
+		  AND period_start < ?
+	`, append(args, cutoff)...).Scan(&n).Error
+	return n, err
+}
+
+func (r *repository) ListPolicies(projectID string) ([]RetentionPolicy, error) {
+	q := r.db.Order("project_id, environment, event_type")
+	if projectID != "" {
+		q = q.Where("project_id = ?", projectID)
+	}
+	var list []RetentionPolicy
+	err := q.Find(&list).Error
+	return list, err
+}
+
+func (r *repository) SavePolicy(p *RetentionPolicy) error {
+	now := time.Now()
+	p.UpdatedAt = now
+
+	var existing RetentionPolicy
+	err := r.db.Where("project_id = ? AND environment = ? AND event_type = ?",
+		p.ProjectID, p.Environment, p.EventType).First(&existing).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		p.ID = uuid.New().String()
+		p.CreatedAt = now
+		return r.db.Create(p).Error
+	}
+	if err != nil {
+		return err
+	}
+
+	p.ID = existing.ID
+	p.CreatedAt = existing.CreatedAt
+	return r.db.Model(&RetentionPolicy{}).
+		Where("id = ?", p.ID).
+		Updates(map[string]any{
+			"raw_days":    p.RawDays,
+			"hourly_days": p.HourlyDays,
+			"updated_at":  p.UpdatedAt,
+		}).Error
+}
+
+func (r *repository) DeletePolicy(id, projectID string) error {
+	return r.db.Where("id = ? AND project_id = ?", id, projectID).
+		Delete(&RetentionPolicy{}).Error
 }
 
 func (r *repository) GetHistory(projectID string, from, to time.Time) ([]HistoryPoint, error) {
@@ -141,28 +525,29 @@ func (r *repository) GetHistory(projectID string, from, to time.Time) ([]History
 	}
 
 	// Query raw events in range, bucketed by hour.
+	d := dialect.Of(r.db)
 	var raw []struct {
-		PeriodStart time.Time `gorm:"column:period_start"`
-		EventCount  int64     `gorm:"column:event_count"`
-		Status4xx   int64     `gorm:"column:status_4xx"`
-		Status5xx   int64     `gorm:"column:status_5xx"`
-		AvgMs       float64   `gorm:"column:avg_ms"`
-		P95Ms       float64   `gorm:"column:p95_ms"`
+		PeriodStart dialect.Time `gorm:"column:period_start"`
+		EventCount  int64        `gorm:"column:event_count"`
+		Status4xx   int64        `gorm:"column:status_4xx"`
+		Status5xx   int64        `gorm:"column:status_5xx"`
+		AvgMs       float64      `gorm:"column:avg_ms"`
+		P95Ms       float64      `gorm:"column:p95_ms"`
 	}
 	err = r.db.Raw(`
 		SELECT
-			date_trunc('hour', timestamp)                                             AS period_start,
+			`+d.Trunc("hour", "timestamp")+`                                             AS period_start,
 			COUNT(*)                                                                  AS event_count,
 			COUNT(*) FILTER (WHERE status_code >= 400 AND status_code < 500)         AS status_4xx,
 			COUNT(*) FILTER (WHERE status_code >= 500)                               AS status_5xx,
 			COALESCE(AVG(response_time), 0)                                           AS avg_ms,
-			COALESCE(percentile_cont(0.95) WITHIN GROUP (ORDER BY response_time), 0) AS p95_ms
+			COALESCE(`+d.Percentile(0.95, "response_time")+`, 0) AS p95_ms
 		FROM audits
 		WHERE project_id = ?
 		  AND event_type = 'http'
 		  AND timestamp >= ?
 		  AND timestamp < ?
-		GROUP BY date_trunc('hour', timestamp)
+		GROUP BY `+d.Trunc("hour", "timestamp")+`
 		ORDER BY period_start ASC
 	`, projectID, from, to).Scan(&raw).Error
 	if err != nil {
@@ -186,11 +571,11 @@ func (r *repository) GetHistory(projectID string, from, to time.Time) ([]History
 		})
 	}
 	for _, r := range raw {
-		if seen[r.PeriodStart] {
+		if seen[r.PeriodStart.Time] {
 			continue
 		}
 		points = append(points, HistoryPoint{
-			PeriodStart: r.PeriodStart,
+			PeriodStart: r.PeriodStart.Time,
 			PeriodType:  PeriodHour,
 			EventCount:  r.EventCount,
 			Errors4xx:   r.Status4xx,
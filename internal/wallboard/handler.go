@@ -11,6 +11,7 @@ import (
 
 	"github.com/gin-gonic/gin"
 	"github.com/golang-jwt/jwt/v5"
+	"github.com/joaovrmoraes/bataudit/internal/audit"
 )
 
 const (
@@ -22,12 +23,19 @@ const (
 type Handler struct {
 	repo      Repository
 	jwtSecret []byte
+	tail      *audit.Tail // nil = /feed/stream unavailable
 }
 
 func NewHandler(repo Repository, jwtSecret string) *Handler {
 	return &Handler{repo: repo, jwtSecret: []byte(jwtSecret)}
 }
 
+// WithTail enables GET /feed/stream, the live version of the feed.
+func (h *Handler) WithTail(t *audit.Tail) *Handler {
+	h.tail = t
+	return h
+}
+
 // RegisterPublicRoutes — code activation + token refresh (no auth required)
 func (h *Handler) RegisterPublicRoutes(r *gin.RouterGroup) {
 	r.POST("/activate", h.Activate)
@@ -39,6 +47,7 @@ func (h *Handler) RegisterDataRoutes(r *gin.RouterGroup) {
 	r.Use(h.Middleware())
 	r.GET("/summary", h.Summary)
 	r.GET("/feed", h.Feed)
+	r.GET("/feed/stream", h.FeedStream)
 	r.GET("/volume", h.Volume)
 	r.GET("/health", h.Health)
 	r.GET("/alerts", h.Alerts)
@@ -268,6 +277,44 @@ func (h *Handler) Feed(c *gin.Context) {
 	c.JSON(http.StatusOK, gin.H{"data": events})
 }
 
+// FeedStream is Feed as Server-Sent Events: a "feed" message with a
+// FeedEvent for each event stored from now on, resumable with Last-Event-ID
+// (see audit.Tail.Serve).
+func (h *Handler) FeedStream(c *gin.Context) {
+	if h.tail == nil {
+		c.JSON(http.StatusServiceUnavailable, gin.H{"error": "live feed unavailable"})
+		return
+	}
+	var projects []string
+	if p := projectFromCtx(c); p != "" {
+		projects = []string{p}
+	} else {
+		all, err := h.repo.GetProjects()
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to fetch projects"})
+			return
+		}
+		for _, p := range all {
+			projects = append(projects, p.ID)
+		}
+	}
+
+	filters := audit.ListFilters{Environment: c.Query("environment")}
+	h.tail.Serve(c, "feed", filters, projects, func(ev audit.TailEvent) any {
+		if ev.EventType == "system.alert" {
+			return nil
+		}
+		return FeedEvent{
+			Method:      string(ev.Method),
+			Path:        ev.Path,
+			StatusCode:  ev.StatusCode,
+			ResponseMs:  ev.ResponseTime,
+			ServiceName: ev.ServiceName,
+			Timestamp:   ev.Timestamp.UTC().Format("2006-01-02T15:04:05Z"),
+		}
+	})
+}
+
 func (h *Handler) Volume(c *gin.Context) {
 	points, err := h.repo.GetVolume(projectFromCtx(c), c.Query("environment"))
 	if err != nil {
@@ -9,6 +9,7 @@ import (
 	"time"
 
 	"github.com/google/uuid"
+	"github.com/joaovrmoraes/bataudit/internal/dialect"
 	"gorm.io/gorm"
 )
 
@@ -89,7 +90,7 @@ func (r *repository) ListTokens(projectID string) ([]Token, error) {
 
 func (r *repository) GetByCode(code string) (*Token, error) {
 	var tok Token
-	if err := r.db.Where("code = ? AND expires_at > NOW()", code).First(&tok).Error; err != nil {
+	if err := r.db.Where("code = ? AND expires_at > ?", code, time.Now()).First(&tok).Error; err != nil {
 		return nil, err
 	}
 	return &tok, nil
@@ -97,7 +98,7 @@ func (r *repository) GetByCode(code string) (*Token, error) {
 
 func (r *repository) GetByRefreshHash(hash string) (*Token, error) {
 	var tok Token
-	if err := r.db.Where("refresh_hash = ? AND expires_at > NOW()", hash).First(&tok).Error; err != nil {
+	if err := r.db.Where("refresh_hash = ? AND expires_at > ?", hash, time.Now()).First(&tok).Error; err != nil {
 		return nil, err
 	}
 	return &tok, nil
@@ -136,10 +137,16 @@ func envFilter(db *gorm.DB, environment string) *gorm.DB {
 	return db
 }
 
+// since is the start of a window ending now, bound in place of
+// NOW() - INTERVAL so the queries run on every dialect.
+func since(d time.Duration) time.Time {
+	return time.Now().UTC().Add(-d)
+}
+
 func (r *repository) GetSummary(projectID, environment string) (*Summary, error) {
 	var s Summary
 	q := envFilter(projectFilter(r.db.Table("audits"), projectID), environment).
-		Where("timestamp >= NOW() - INTERVAL '24 hours'").
+		Where("timestamp >= ?", since(24*time.Hour)).
 		Select(`
 			COUNT(*) AS events_today,
 			COUNT(CASE WHEN status_code >= 400 AND status_code < 500 THEN 1 END) AS errors_4xx,
@@ -158,9 +165,10 @@ func (r *repository) GetFeed(projectID, environment string, limit int) ([]FeedEv
 		limit = 20
 	}
 	var events []FeedEvent
+	d := dialect.Of(r.db)
 	q := envFilter(projectFilter(r.db.Table("audits"), projectID), environment).
 		Where("event_type != 'system.alert' OR event_type IS NULL").
-		Select(`method, path, status_code, response_time AS response_ms, service_name, TO_CHAR(timestamp AT TIME ZONE 'UTC', 'YYYY-MM-DD"T"HH24:MI:SS"Z"') AS timestamp`).
+		Select(`method, path, status_code, response_time AS response_ms, service_name, ` + d.ISOTime(d.UTC("timestamp")) + ` AS timestamp`).
 		Order("timestamp DESC").
 		Limit(limit)
 	if err := q.Scan(&events).Error; err != nil {
@@ -171,9 +179,10 @@ func (r *repository) GetFeed(projectID, environment string, limit int) ([]FeedEv
 
 func (r *repository) GetVolume(projectID, environment string) ([]VolumePoint, error) {
 	var points []VolumePoint
+	d := dialect.Of(r.db)
 	q := envFilter(projectFilter(r.db.Table("audits"), projectID), environment).
-		Where("timestamp >= NOW() - INTERVAL '2 hours'").
-		Select(`TO_CHAR((DATE_TRUNC('minute', timestamp) - (EXTRACT(MINUTE FROM timestamp)::int % 5) * INTERVAL '1 minute') AT TIME ZONE 'UTC', 'YYYY-MM-DD"T"HH24:MI:SS"Z"') AS bucket, COUNT(*) AS count`).
+		Where("timestamp >= ?", since(2*time.Hour)).
+		Select(d.ISOTime(d.UTC(d.Bucket(5, "timestamp"))) + ` AS bucket, COUNT(*) AS count`).
 		Group("bucket").
 		Order("bucket ASC")
 	if err := q.Scan(&points).Error; err != nil {
@@ -200,10 +209,11 @@ func (r *repository) GetHealth(projectID string) ([]HealthEntry, error) {
 		LastChecked string
 	}
 	var rows []row
+	d := dialect.Of(r.db)
 	healthQuery := `
 		SELECT m.name, m.url, m.last_status,
 			COALESCE((SELECT response_ms FROM healthcheck_results r WHERE r.monitor_id = m.id ORDER BY r.checked_at DESC LIMIT 1), 0) AS response_ms,
-			COALESCE((SELECT TO_CHAR(r.checked_at AT TIME ZONE 'UTC', 'YYYY-MM-DD"T"HH24:MI:SS"Z"') FROM healthcheck_results r WHERE r.monitor_id = m.id ORDER BY r.checked_at DESC LIMIT 1), '') AS last_checked
+			COALESCE((SELECT ` + d.ISOTime(d.UTC("r.checked_at")) + ` FROM healthcheck_results r WHERE r.monitor_id = m.id ORDER BY r.checked_at DESC LIMIT 1), '') AS last_checked
 		FROM healthcheck_monitors m
 		WHERE m.enabled = true`
 	healthArgs := []interface{}{}
@@ -223,10 +233,11 @@ func (r *repository) GetHealth(projectID string) ([]HealthEntry, error) {
 
 func (r *repository) GetAlerts(projectID, environment string) ([]AlertEntry, error) {
 	var alerts []AlertEntry
+	d := dialect.Of(r.db)
 	q := envFilter(projectFilter(r.db.Table("audits"), projectID), environment).
 		Where("event_type = 'system.alert'").
-		Where("timestamp >= NOW() - INTERVAL '30 minutes'").
-		Select(`path AS rule_type, service_name, environment, TO_CHAR(timestamp AT TIME ZONE 'UTC', 'YYYY-MM-DD"T"HH24:MI:SS"Z"') AS timestamp`).
+		Where("timestamp >= ?", since(30*time.Minute)).
+		Select(`path AS rule_type, service_name, environment, ` + d.ISOTime(d.UTC("timestamp")) + ` AS timestamp`).
 		Order("timestamp DESC").
 		Limit(20)
 	if err := q.Scan(&alerts).Error; err != nil {
@@ -258,10 +269,10 @@ func (r *repository) GetProjectStats(environment string) ([]ProjectStat, error)
 			), 0) AS down_monitors
 		FROM projects p
 		LEFT JOIN audits a ON a.project_id = p.id
-			AND a.timestamp >= NOW() - INTERVAL '24 hours'
+			AND a.timestamp >= ?
 			AND (a.event_type != 'system.alert' OR a.event_type IS NULL)`
 
-	args := []interface{}{}
+	args := []interface{}{since(24 * time.Hour)}
 	if environment != "" {
 		query += " AND a.environment = ?"
 		args = append(args, environment)
@@ -280,7 +291,7 @@ func (r *repository) GetProjectStats(environment string) ([]ProjectStat, error)
 func (r *repository) GetErrorRoutes(projectID, environment string) ([]ErrorRoute, error) {
 	var routes []ErrorRoute
 	q := envFilter(projectFilter(r.db.Table("audits"), projectID), environment).
-		Where("timestamp >= NOW() - INTERVAL '1 hour'").
+		Where("timestamp >= ?", since(time.Hour)).
 		Select(`path, method, COUNT(CASE WHEN status_code >= 400 THEN 1 END) AS error_count, COUNT(*) AS total`).
 		Group("path, method").
 		Having("COUNT(CASE WHEN status_code >= 400 THEN 1 END) > 0").
@@ -6,6 +6,8 @@ import (
 	"math"
 	"sync"
 	"time"
+
+	"github.com/joaovrmoraes/bataudit/internal/metrics"
 )
 
 // scaleWorkers adjusts the number of active workers to the target count
@@ -54,6 +56,7 @@ func (s *Service) scaleUp(ctx context.Context, wg *sync.WaitGroup, targetCount i
 		s.activeWorkers++
 	}
 
+	metrics.WorkersActive.Set(float64(s.activeWorkers))
 	s.lastScaleTime = time.Now()
 }
 
@@ -82,6 +85,7 @@ func (s *Service) scaleDown(targetCount int) {
 	}
 
 	s.activeWorkers -= workersToRemove
+	metrics.WorkersActive.Set(float64(s.activeWorkers))
 	s.lastScaleTime = time.Now()
 }
 
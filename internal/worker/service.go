@@ -9,6 +9,10 @@ import (
 
 	"github.com/joaovrmoraes/bataudit/internal/anomaly"
 	"github.com/joaovrmoraes/bataudit/internal/audit"
+	"github.com/joaovrmoraes/bataudit/internal/fieldcrypt"
+	"github.com/joaovrmoraes/bataudit/internal/livetail"
+	"github.com/joaovrmoraes/bataudit/internal/metrics"
+	"github.com/joaovrmoraes/bataudit/internal/pipeline"
 	"github.com/joaovrmoraes/bataudit/internal/queue"
 )
 
@@ -16,7 +20,10 @@ import (
 type Service struct {
 	config     *Config
 	auditSvc   *audit.Service
-	detector   *anomaly.Detector // nil = anomaly detection disabled
+	detector   *anomaly.Detector   // nil = anomaly detection disabled
+	pipeline   *pipeline.Runner    // nil = events are stored as received
+	keyring    *fieldcrypt.Keyring // nil = fields are stored in plaintext
+	publisher  *livetail.Publisher // nil = live tails only poll
 	redisQueue *queue.RedisQueue
 
 	// Worker management
@@ -51,6 +58,24 @@ func (s *Service) WithDetector(d *anomaly.Detector) *Service {
 	return s
 }
 
+// WithPipeline attaches the per-project processing pipeline to the service.
+func (s *Service) WithPipeline(r *pipeline.Runner) *Service {
+	s.pipeline = r
+	return s
+}
+
+// WithKeyring encrypts the configured fields of each event before it is stored.
+func (s *Service) WithKeyring(k *fieldcrypt.Keyring) *Service {
+	s.keyring = k
+	return s
+}
+
+// WithPublisher announces each stored event to the Reader's live tails.
+func (s *Service) WithPublisher(p *livetail.Publisher) *Service {
+	s.publisher = p
+	return s
+}
+
 // Start starts the workers and waits until the context is canceled
 func (s *Service) Start(ctx context.Context) error {
 	var wg sync.WaitGroup
@@ -105,6 +130,7 @@ func (s *Service) monitorQueueWithAutoscaling(ctx context.Context, wg *sync.Wait
 			)
 
 			s.scalingMetrics.lastQueueSize = queueLen
+			metrics.QueueDepth.Set(float64(queueLen), s.config.QueueName)
 
 			if s.config.EnableAutoscaling {
 				timeSinceLastScale := time.Since(s.lastScaleTime)
@@ -146,6 +172,7 @@ func (s *Service) runWorkerWithControl(ctx context.Context, id int, wg *sync.Wai
 			return
 
 		case <-ticker.C:
+			dequeueStart := time.Now()
 			ctxDequeue, cancel := context.WithTimeout(context.Background(), 1*time.Second)
 			data, err := s.redisQueue.Dequeue(ctxDequeue)
 			cancel()
@@ -161,6 +188,8 @@ func (s *Service) runWorkerWithControl(ctx context.Context, id int, wg *sync.Wai
 			if data == nil {
 				continue
 			}
+			metrics.DequeueDuration.Observe(time.Since(dequeueStart).Seconds())
+			processStart := time.Now()
 
 			ctxQueueLen, cancelQueueLen := context.WithTimeout(context.Background(), 1*time.Second)
 			queueLen, errQueueLen := s.redisQueue.QueueLength(ctxQueueLen)
@@ -178,19 +207,81 @@ func (s *Service) runWorkerWithControl(ctx context.Context, id int, wg *sync.Wai
 			}
 			slog.Info("Processing event", "worker_id", id, "event_id", auditEvent.ID, "queue_remaining", remaining)
 
+			auditEvent, outcome := s.applyPipeline(ctx, id, auditEvent)
+			if outcome != "" {
+				metrics.ProcessingDuration.Observe(time.Since(processStart).Seconds(), outcome)
+				continue
+			}
+
+			outcome = "stored"
 			if !s.processWithRetry(id, auditEvent) {
+				outcome = "failed"
 				slog.Error("Failed to process event after max retries", "worker_id", id, "event_id", auditEvent.ID, "max_retries", s.config.MaxRetries)
 			}
+			metrics.ProcessingDuration.Observe(time.Since(processStart).Seconds(), outcome)
+		}
+	}
+}
+
+// deadLetter is the record pushed to the dead-letter queue.
+type deadLetter struct {
+	Event    audit.Audit `json:"event"`
+	Step     string      `json:"step"`
+	Reason   string      `json:"reason"`
+	FailedAt time.Time   `json:"failed_at"`
+}
+
+// applyPipeline runs the project's processor chain on the event. It returns
+// the processed event and, when the event must not be persisted, why:
+// "dropped", "dead_letter" or "rejected". An empty outcome means store it.
+func (s *Service) applyPipeline(ctx context.Context, id int, auditEvent audit.Audit) (audit.Audit, string) {
+	if s.pipeline == nil {
+		return auditEvent, ""
+	}
+
+	res := s.pipeline.Run(ctx, auditEvent)
+	switch {
+	case res.Dropped:
+		slog.Debug("Event dropped by pipeline", "worker_id", id, "event_id", auditEvent.ID, "step", res.FailedStep)
+		return res.Event, "dropped"
+
+	case res.DeadLetter:
+		slog.Warn("Event moved to dead-letter queue", "worker_id", id, "event_id", auditEvent.ID, "step", res.FailedStep, "error", res.Err)
+		ctxDLQ, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+		defer cancel()
+		if err := s.redisQueue.DeadLetter(ctxDLQ, deadLetter{
+			Event:    auditEvent,
+			Step:     res.FailedStep,
+			Reason:   res.Err.Error(),
+			FailedAt: time.Now(),
+		}); err != nil {
+			slog.Error("Failed to dead-letter event", "worker_id", id, "event_id", auditEvent.ID, "error", err)
+		} else {
+			metrics.DeadLetters.Inc(auditEvent.ProjectID, res.FailedStep)
 		}
+		return res.Event, "dead_letter"
+
+	case res.Err != nil:
+		slog.Error("Event rejected by pipeline", "worker_id", id, "event_id", auditEvent.ID, "step", res.FailedStep, "error", res.Err)
+		return res.Event, "rejected"
 	}
+	return res.Event, ""
 }
 
 // processWithRetry tries to process an event with retries in case of failure
 func (s *Service) processWithRetry(id int, auditEvent audit.Audit) bool {
 	for attempt := 0; attempt < s.config.MaxRetries; attempt++ {
-		err := s.auditSvc.CreateAudit(auditEvent)
+		err := s.seal(&auditEvent)
+		if err == nil {
+			err = s.auditSvc.CreateAudit(auditEvent)
+		}
 		if err == nil {
 			slog.Info("Event processed", "worker_id", id, "event_id", auditEvent.ID)
+			if s.publisher != nil {
+				if err := s.publisher.Publish(auditEvent.ProjectID, auditEvent.ID); err != nil {
+					slog.Warn("Failed to announce event to live tails", "worker_id", id, "event_id", auditEvent.ID, "error", err)
+				}
+			}
 			if s.detector != nil && auditEvent.EventType != "system.alert" {
 				s.detector.ProcessEvent(anomaly.Event{
 					ProjectID:   auditEvent.ProjectID,
@@ -206,7 +297,17 @@ func (s *Service) processWithRetry(id int, auditEvent audit.Audit) bool {
 			return true
 		}
 		slog.Warn("Processing attempt failed", "worker_id", id, "attempt", attempt+1, "error", err)
+		metrics.ProcessingRetries.Inc()
 		time.Sleep(2 * time.Second)
 	}
 	return false
 }
+
+// seal encrypts the event's configured fields. Fields sealed by a previous
+// attempt are left as they are.
+func (s *Service) seal(auditEvent *audit.Audit) error {
+	if s.keyring == nil {
+		return nil
+	}
+	return s.keyring.Seal(context.Background(), auditEvent)
+}